@@ -17,34 +17,109 @@ limitations under the License.
 package v1alpha2
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
 )
 
 // Format specifies the output format of the bootstrap data
-// +kubebuilder:validation:Enum=cloud-config
+// +kubebuilder:validation:Enum=cloud-config;join-script;json
 type Format string
 
 const (
 	// CloudConfig make the bootstrap data to be of cloud-config format
 	CloudConfig Format = "cloud-config"
+
+	// JoinScript makes the bootstrap data of worker nodes a compact shell script running kubeadm join,
+	// identical for all the instances sharing the bootstrap token, e.g. in autoscaling groups.
+	// The bootstrap token is refreshed for as long as the config exists.
+	JoinScript Format = "join-script"
+
+	// JSON makes the bootstrap data a JSON document listing the files, commands and users of the cloud-config,
+	// for infrastructure providers or agents provisioning machines without cloud-init.
+	JSON Format = "json"
+)
+
+// GzipBootstrapDataEncoding is the BootstrapDataEncoding of the bootstrap data of the status compressed with gzip.
+const GzipBootstrapDataEncoding = "gzip"
+
+// OSFamily is the operating system family of the machine image, which determines the paths and commands used in the
+// bootstrap data.
+// +kubebuilder:validation:Enum=debian;rhel;flatcar;sles;windows
+type OSFamily string
+
+const (
+	// Debian is the family of Debian based distributions, e.g. Ubuntu.
+	Debian OSFamily = "debian"
+
+	// RHEL is the family of Red Hat based distributions, e.g. CentOS and Amazon Linux.
+	RHEL OSFamily = "rhel"
+
+	// Flatcar is the family of Flatcar Container Linux and Fedora CoreOS, whose /usr is read-only.
+	Flatcar OSFamily = "flatcar"
+
+	// SLES is the family of SUSE based distributions, e.g. openSUSE.
+	SLES OSFamily = "sles"
+
+	// Windows is the family of Windows Server images bootstrapped with cloudbase-init. It is only supported for
+	// worker machines.
+	Windows OSFamily = "windows"
 )
 
+// DataSource is a cloud-init data source with specific requirements on the cloud-config.
+// +kubebuilder:validation:Enum=nocloud;configdrive
+type DataSource string
+
+const (
+	// NoCloudDataSource is the cloud-init NoCloud data source, e.g. used with ISO images on bare metal.
+	NoCloudDataSource DataSource = "nocloud"
+
+	// ConfigDriveDataSource is the cloud-init OpenStack ConfigDrive data source.
+	ConfigDriveDataSource DataSource = "configdrive"
+)
+
+// FormatOptions tunes the bootstrap data for its consumer.
+type FormatOptions struct {
+	// DataSource is the cloud-init data source the cloud-config is consumed by. When set, the cloud-config starts
+	// with the #cloud-config header, without jinja templating, and the meta data the data source expects is stored
+	// alongside the bootstrap data: under the meta-data key of the bootstrap data secret for nocloud, and under the
+	// meta_data.json key for configdrive.
+	// +optional
+	DataSource DataSource `json:"dataSource,omitempty"`
+}
+
 // KubeadmConfigSpec defines the desired state of KubeadmConfig.
 // Either ClusterConfiguration and InitConfiguration should be defined or the JoinConfiguration should be defined.
 type KubeadmConfigSpec struct {
 	// ClusterConfiguration along with InitConfiguration are the configurations necessary for the init command
 	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
 	ClusterConfiguration *kubeadmv1beta1.ClusterConfiguration `json:"clusterConfiguration,omitempty"`
 	// InitConfiguration along with ClusterConfiguration are the configurations necessary for the init command
 	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
 	InitConfiguration *kubeadmv1beta1.InitConfiguration `json:"initConfiguration,omitempty"`
 	// JoinConfiguration is the kubeadm configuration for the join command
 	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
 	JoinConfiguration *kubeadmv1beta1.JoinConfiguration `json:"joinConfiguration,omitempty"`
 	// Files specifies extra files to be passed to user_data upon creation.
 	// +optional
 	Files []File `json:"files,omitempty"`
+	// StaticPodManifests specifies extra static pod manifests to be written into the kubelet
+	// static pod manifest directory before kubeadm runs, e.g. a local load balancer for the API server.
+	// +optional
+	StaticPodManifests []StaticPodManifest `json:"staticPodManifests,omitempty"`
+	// ControlPlaneVIP specifies a virtual IP to be managed by the control plane nodes themselves,
+	// allowing HA control planes without an external load balancer. Joining machines whose config does not set it
+	// connect to the virtual IP of a control plane machine of the cluster.
+	// +optional
+	ControlPlaneVIP *ControlPlaneVIP `json:"controlPlaneVIP,omitempty"`
+	// APIServerEndpointDNS specifies a DNS name or SRV record the API server endpoint of joining machines is resolved
+	// from at boot, instead of the endpoint of the cluster, so that replacing the load balancer of the control plane
+	// does not invalidate the bootstrap data of existing workers.
+	// +optional
+	APIServerEndpointDNS *APIServerEndpointDNS `json:"apiServerEndpointDNS,omitempty"`
 	// PreKubeadmCommands specifies extra commands to run before kubeadm runs
 	// +optional
 	PreKubeadmCommands []string `json:"preKubeadmCommands,omitempty"`
@@ -60,6 +135,210 @@ type KubeadmConfigSpec struct {
 	// Format specifies the output format of the bootstrap data
 	// +optional
 	Format Format `json:"format,omitempty"`
+	// FormatOptions tunes the bootstrap data for its consumer, e.g. a specific cloud-init data source.
+	// +optional
+	FormatOptions *FormatOptions `json:"formatOptions,omitempty"`
+	// Discovery specifies how CABPK handles the discovery settings of the join configuration.
+	// +optional
+	Discovery *DiscoveryPolicy `json:"discovery,omitempty"`
+	// EnsureBootstrapTokenRBAC specifies whether CABPK should ensure the workload cluster contains the RBAC rules
+	// required for joining nodes with bootstrap tokens, including CSR auto-approval, before generating the join data.
+	// This is useful for clusters initialized with the kubeadm bootstrap-token phase skipped.
+	// +optional
+	EnsureBootstrapTokenRBAC bool `json:"ensureBootstrapTokenRBAC,omitempty"`
+	// ClusterInfoCheck specifies whether CABPK checks, before generating the join data of machines using bootstrap
+	// token discovery, that the cluster-info ConfigMap of the workload cluster exists and holds the current cluster CA
+	// and API server endpoint, so that discovery failures are reported on the config instead of on the node.
+	// +optional
+	ClusterInfoCheck ClusterInfoCheckMode `json:"clusterInfoCheck,omitempty"`
+	// APIServerCheck specifies whether CABPK probes, before generating the join data of machines using bootstrap token
+	// discovery, that the API server endpoint of the workload cluster answers, so that joining machines do not fail
+	// discovery against a load balancer which is not live yet. The join data is delayed until the endpoint answers.
+	// +optional
+	APIServerCheck APIServerCheckMode `json:"apiServerCheck,omitempty"`
+	// ControlPlaneJoinCheck specifies whether CABPK checks, before generating the join data of control plane machines,
+	// that kubeadm join --control-plane would accept them: the kubeadm-config ConfigMap of the workload cluster must
+	// define a controlPlaneEndpoint, and the Kubernetes version of the Machine must be the version of the cluster or of
+	// its next minor release. The join data is delayed while the checks fail. It is ignored for worker machines.
+	// +optional
+	ControlPlaneJoinCheck bool `json:"controlPlaneJoinCheck,omitempty"`
+	// RegistryMirrors maps an image registry host (e.g. k8s.gcr.io) to the list of mirror endpoints
+	// that should be tried before the registry itself. Mirrors are rendered into the containerd
+	// configuration; mirrors for docker.io are also rendered into the docker daemon configuration.
+	// +optional
+	RegistryMirrors map[string][]string `json:"registryMirrors,omitempty"`
+	// ResetBeforeJoin specifies whether a joining machine should run `kubeadm reset` and remove stale
+	// static pod manifests and etcd data if it finds state left behind by a previous kubeadm run.
+	// This is useful for providers that reuse hosts, e.g. bare metal.
+	// +optional
+	ResetBeforeJoin bool `json:"resetBeforeJoin,omitempty"`
+	// IdempotentCommands specifies whether the pre and post kubeadm commands should also be skipped when the
+	// bootstrap data is executed again on a machine where kubeadm already succeeded. kubeadm itself is never
+	// run again on such machines.
+	// +optional
+	IdempotentCommands bool `json:"idempotentCommands,omitempty"`
+	// AdoptExistingNode specifies whether the bootstrap data of a worker machine adopts an already running node
+	// instead of joining it with kubeadm: the kubelet credentials are replaced with a bootstrap kubeconfig holding a
+	// fresh token, and the kubelet is restarted to register again. The bootstrap data is a shell script meant to be
+	// run on the node out of band, e.g. when migrating nodes of a manually built cluster. The kubelet of the node must
+	// be started with the --bootstrap-kubeconfig and --kubeconfig flags set by kubeadm.
+	// +optional
+	AdoptExistingNode bool `json:"adoptExistingNode,omitempty"`
+	// NodeName specifies how the hostname of the machine and the name of its Kubernetes Node are generated.
+	// If unset, the hostname is left to cloud-init and the Node name to kubeadm.
+	// +optional
+	NodeName *NodeName `json:"nodeName,omitempty"`
+	// PrePlacedEtcdCertificates lists the etcd certificates CABPK should generate with the etcd CA and write
+	// on control plane machines joining a cluster with stacked etcd, instead of leaving them to kubeadm.
+	// This is required when the kubeadm certs phases are skipped on the node.
+	// +optional
+	PrePlacedEtcdCertificates []EtcdCertificateName `json:"prePlacedEtcdCertificates,omitempty"`
+	// Hardening applies a preset of kubelet and control plane settings, file permissions and audit
+	// configuration to the generated configuration. Values set explicitly by the user take precedence.
+	// +optional
+	Hardening HardeningPreset `json:"hardening,omitempty"`
+	// AdditionalTrustBundles specifies PEM encoded CA certificates to be added to the trust store of the machine,
+	// e.g. for private registries or proxies using certificates signed by a custom CA.
+	// +optional
+	AdditionalTrustBundles []TrustBundle `json:"additionalTrustBundles,omitempty"`
+	// AdditionalKubeadmConfigDocuments specifies raw YAML documents appended, in order, to the kubeadm config file
+	// handed to init and join, e.g. KubeletConfiguration or KubeProxyConfiguration component configs.
+	// Each entry must hold a single document; only component config kinds are allowed.
+	// +optional
+	AdditionalKubeadmConfigDocuments []string `json:"additionalKubeadmConfigDocuments,omitempty"`
+	// NodeClientCertificate specifies whether CABPK should sign a kubelet client certificate for joining machines
+	// with the cluster CA and ship it in the bootstrap data, so that nodes join without bootstrap tokens.
+	// The node name must be known in advance.
+	// +optional
+	NodeClientCertificate bool `json:"nodeClientCertificate,omitempty"`
+	// TokenBackend is the name of the token backend issuing the join credentials of the machine instead of bootstrap
+	// tokens, e.g. from the cloud identity of the machine. Backends are registered with the controller; the Exec
+	// backend joins with the credentials of an exec credential plugin, such as aws-iam-authenticator.
+	// Defaults to bootstrap tokens.
+	// +optional
+	TokenBackend string `json:"tokenBackend,omitempty"`
+	// NodeIP enables detecting the IP address of the machine at boot and passing it to the kubelet with --node-ip,
+	// so that machines with multiple network interfaces register the expected address.
+	// +optional
+	NodeIP *NodeIPDetection `json:"nodeIP,omitempty"`
+	// SELinux configures the SELinux mode of the machine and the relabeling of the files written from the
+	// bootstrap data, as kubeadm fails on some distributions running SELinux in enforcing mode otherwise.
+	// +optional
+	SELinux *SELinux `json:"selinux,omitempty"`
+	// DisableSwap disables swap before kubeadm runs, as the kubelet refuses to start with swap enabled: the active
+	// swap devices are turned off, the swap entries of /etc/fstab are commented out, and the zram swap services of
+	// the OS family are masked, so that swap stays disabled after a reboot.
+	// +optional
+	DisableSwap bool `json:"disableSwap,omitempty"`
+	// SystemdUnits are systemd units and drop-ins written on the machine, then enabled and started before or after
+	// kubeadm runs, e.g. for node agents and log shippers.
+	// +optional
+	SystemdUnits []SystemdUnit `json:"systemdUnits,omitempty"`
+	// Diagnostics enables uploading the cloud-init, kubelet and container runtime logs of the machine if kubeadm
+	// fails, so that failed machines that get deleted still leave debuggable evidence.
+	// +optional
+	Diagnostics *BootstrapDiagnostics `json:"diagnostics,omitempty"`
+	// ControlPlaneNodes specifies the taints and labels of control plane nodes, applied with the admin kubeconfig
+	// once kubeadm is done. It is ignored for worker machines.
+	// +optional
+	ControlPlaneNodes *ControlPlaneNodePolicy `json:"controlPlaneNodes,omitempty"`
+	// SingleNode configures the machine as a single node cluster running both the control plane and the workloads:
+	// the control plane node is untainted, the prerequisites of the local-path storage provisioner are created,
+	// and the config is rejected unless its Machine is the first control plane machine of the cluster,
+	// instead of waiting for a control plane or workers that will never exist.
+	// +optional
+	SingleNode bool `json:"singleNode,omitempty"`
+	// UploadCerts runs kubeadm init with --upload-certs, so that joining control plane machines download the
+	// control plane certificates from the kubeadm-certs secret of the workload cluster instead of receiving them
+	// in their bootstrap data. The secret is uploaded again for control plane machines joining after it expired,
+	// and deleted once all control plane machines have joined. It is ignored for joining machines.
+	// +optional
+	UploadCerts bool `json:"uploadCerts,omitempty"`
+	// Certificates specifies the validity and the renewal of the certificates of the machine. Control plane providers
+	// can override it for the machines they manage with the certificates annotations of the Machine.
+	// +optional
+	Certificates *CertificatesPolicy `json:"certificates,omitempty"`
+	// OSFamily is the operating system family of the machine image. It selects the paths and commands CABPK uses in
+	// the bootstrap data, e.g. the trust store directory, the directory scripts are written to and the name of the
+	// sshd service. If unset, a Debian-like image is assumed, with fallbacks for Red Hat based distributions.
+	// +optional
+	OSFamily OSFamily `json:"osFamily,omitempty"`
+	// SSH establishes the SSH trust of the machine with the SSH certificate authority of the cluster, generated by
+	// CABPK: the host key of the machine is signed by it, so that clients trusting it connect without prompting to
+	// accept the host key, and sshd accepts user certificates signed by it.
+	// +optional
+	SSH *SSHCertificates `json:"ssh,omitempty"`
+	// FailureDomain propagates the failure domain of the Machine, set with the
+	// bootstrap.cluster.x-k8s.io/failure-domain annotation, to the generated kubeadm configuration, so that
+	// topology-aware clusters get consistent zone labels from the first boot. It is not supported by the
+	// join-script format, whose data is shared by machines in different failure domains.
+	// +optional
+	FailureDomain *FailureDomainPropagation `json:"failureDomain,omitempty"`
+	// NodeGroup labels worker nodes with their role and node group with the node-labels kubelet argument, so that
+	// the nodes of a MachineDeployment are identifiable in the workload cluster from their registration. It is not
+	// supported by control plane machines, whose labels are set with ControlPlaneNodes.
+	// +optional
+	NodeGroup *NodeGroupLabels `json:"nodeGroup,omitempty"`
+	// BootstrapResources are Secrets and ConfigMaps of the namespace of the config applied to the workload cluster
+	// with kubectl by the first control plane machine right after kubeadm init, in order, e.g. the manifests of a CNI
+	// or cloud credentials. Their content is stored in the bootstrap data. They are ignored for joining machines.
+	// +optional
+	BootstrapResources []BootstrapResource `json:"bootstrapResources,omitempty"`
+	// CNI applies the manifest of a CNI plugin to the workload cluster with kubectl by the first control plane
+	// machine right after kubeadm init, after the BootstrapResources, so that its nodes become schedulable without
+	// further steps. It is ignored for joining machines.
+	// +optional
+	CNI *CNI `json:"cni,omitempty"`
+	// TokenPool keeps a pool of pre-created bootstrap tokens for the machines of the MachineDeployment of the config,
+	// set in its KubeadmConfigTemplate, so that the joins of rapidly replaced machines, e.g. spot or preemptible
+	// instances, do not wait for a token to be created in the workload cluster. It is ignored for control plane
+	// machines, machines not owned by a MachineDeployment, and configs setting their own token.
+	// +optional
+	TokenPool *TokenPoolPolicy `json:"tokenPool,omitempty"`
+	// CredentialProviders configures the kubelet image credential provider plugins of the machine, so that images of
+	// private registries, e.g. ECR, GCR or ACR, are pulled from the first boot. It requires a Machine version of at
+	// least v1.20; the KubeletCredentialProviders feature gate is enabled below v1.24.
+	// +optional
+	CredentialProviders *KubeletCredentialProviders `json:"credentialProviders,omitempty"`
+	// Templates renders the content of the Files without encoding and the PreKubeadmCommands and PostKubeadmCommands
+	// as Go templates when the bootstrap data is generated. Templates use the <% and %> delimiters, so that they do not
+	// conflict with the jinja templating of cloud-init.
+	// +optional
+	Templates *TemplatesPolicy `json:"templates,omitempty"`
+	// DeprecatedArgs defines the handling of the kubelet and control plane extra args deprecated or removed in the
+	// Kubernetes version of the Machine. They are always reported with the DeprecatedArgs condition; Migrate also
+	// renames them to their replacement, and drops the removed ones without replacement. Defaults to Warn.
+	// +optional
+	DeprecatedArgs DeprecatedArgsPolicy `json:"deprecatedArgs,omitempty"`
+
+	// DNS configures the DNS servers and search domains of the machine, and the resolv.conf the kubelet passes to
+	// pods, e.g. on premises where the DNS servers configured by DHCP cannot resolve the names the cluster needs.
+	// +optional
+	DNS *NodeDNS `json:"dns,omitempty"`
+
+	// Prerequisites are the prerequisite modules installed in order before kubeadm runs, e.g. the nvidia-driver and
+	// containerd-nvidia-runtime modules of GPU machines. Each module expands into the files and commands vetted by
+	// CABPK or by the integrator registering it.
+	// +optional
+	Prerequisites []Prerequisite `json:"prerequisites,omitempty"`
+
+	// NodeAgent installs an agent on the machine applying the files and commands it defines once the node has joined,
+	// and again whenever they change, so that day-2 changes to the configuration of the node, e.g. rotating registry
+	// mirrors or updating kubelet flags, do not require re-provisioning the machine.
+	// +optional
+	NodeAgent *NodeAgent `json:"nodeAgent,omitempty"`
+
+	// Addons generates the node-side prerequisites of the optional addons the cluster plans to install, e.g. the
+	// interface and the kubelet DNS settings of NodeLocal DNSCache, so that nodes are consistently configured for
+	// them from first boot.
+	// +optional
+	Addons *AddonPrerequisites `json:"addons,omitempty"`
+
+	// KubeletServingCertificate makes the kubelet request its serving certificate from the cluster CA with a
+	// certificate signing request, as serverTLSBootstrap does in the KubeletConfiguration, and rotate it, instead of
+	// serving with a self-signed certificate. The requests are not approved by Kubernetes: an approver is required.
+	// +optional
+	KubeletServingCertificate *KubeletServingCertificate `json:"kubeletServingCertificate,omitempty"`
 }
 
 // KubeadmConfigStatus defines the observed state of KubeadmConfig
@@ -67,10 +346,23 @@ type KubeadmConfigStatus struct {
 	// Ready indicates the BootstrapData field is ready to be consumed
 	Ready bool `json:"ready,omitempty"`
 
+	// ReadyTime is the time the bootstrap data was first generated and the config became ready.
+	// +optional
+	ReadyTime *metav1.Time `json:"readyTime,omitempty"`
+
+	// DataSecretName is the name of the secret that stores the bootstrap data script.
+	// +optional
+	DataSecretName *string `json:"dataSecretName,omitempty"`
+
 	// BootstrapData will be a cloud-init script for now
+	// Deprecated: This field is kept for backward compatibility with the v1alpha2 Machine contract, use DataSecretName instead.
 	// +optional
 	BootstrapData []byte `json:"bootstrapData,omitempty"`
 
+	// BootstrapDataEncoding is the encoding of BootstrapData: gzip if it is compressed, or empty.
+	// +optional
+	BootstrapDataEncoding string `json:"bootstrapDataEncoding,omitempty"`
+
 	// ErrorReason will be set on non-retryable errors
 	// +optional
 	ErrorReason string `json:"errorReason,omitempty"`
@@ -78,12 +370,125 @@ type KubeadmConfigStatus struct {
 	// ErrorMessage will be set on non-retryable errors
 	// +optional
 	ErrorMessage string `json:"errorMessage,omitempty"`
+
+	// Conditions describe the current state of the bootstrap data generation.
+	// +optional
+	Conditions []KubeadmConfigCondition `json:"conditions,omitempty"`
+
+	// RenderedSpecHash is the hash of the spec the bootstrap data was rendered from.
+	// It is compared with the current spec to detect changes that are not reflected in the bootstrap data.
+	// +optional
+	RenderedSpecHash string `json:"renderedSpecHash,omitempty"`
+
+	// KubeadmConfigAPIVersion is the kubeadm config API version of the configuration documents of the bootstrap data,
+	// e.g. kubeadm.k8s.io/v1beta2, which must be supported by the kubeadm of the machine.
+	// +optional
+	KubeadmConfigAPIVersion string `json:"kubeadmConfigAPIVersion,omitempty"`
+
+	// ObservedGeneration is the latest generation of the config observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastRequeueReason is a brief CamelCase reason why the controller is waiting before generating the bootstrap
+	// data, e.g. WaitingForControlPlaneInitialization. It is cleared once the bootstrap data is generated.
+	// +optional
+	LastRequeueReason string `json:"lastRequeueReason,omitempty"`
+
+	// NodeAgentRevision is the revision of the node agent files and commands last published to the workload cluster.
+	// The agent annotates the node with the revision it applied.
+	// +optional
+	NodeAgentRevision string `json:"nodeAgentRevision,omitempty"`
+}
+
+// KubeadmConfigConditionType is the type of a KubeadmConfig condition.
+type KubeadmConfigConditionType string
+
+const (
+	// WaitingForClusterEndpointCondition is true while the bootstrap data of a joining machine cannot be generated
+	// because the Cluster has no APIEndpoints yet.
+	WaitingForClusterEndpointCondition KubeadmConfigConditionType = "WaitingForClusterEndpoint"
+
+	// OwnerMachineFailedCondition is true while the Machine owning the config has a terminal error set.
+	// The config is not reconciled until the error is cleared.
+	OwnerMachineFailedCondition KubeadmConfigConditionType = "OwnerMachineFailed"
+
+	// ClusterInfoInvalidCondition is true while the cluster-info ConfigMap of the workload cluster is missing or does
+	// not hold the current cluster CA and API server endpoint, so that joining machines would fail discovery.
+	ClusterInfoInvalidCondition KubeadmConfigConditionType = "ClusterInfoInvalid"
+
+	// APIServerUnreachableCondition is true while the API server endpoint of the workload cluster does not answer the
+	// probes of the APIServerCheck, so that joining machines would fail discovery.
+	APIServerUnreachableCondition KubeadmConfigConditionType = "APIServerUnreachable"
+
+	// ControlPlaneJoinIncompatibleCondition is true while the checks of the ControlPlaneJoinCheck fail, so that the
+	// control plane machine would fail to join the workload cluster.
+	ControlPlaneJoinIncompatibleCondition KubeadmConfigConditionType = "ControlPlaneJoinIncompatible"
+
+	// ExternalEtcdInvalidCondition is true while the user supplied certificates of the external etcd are missing, or
+	// the apiserver-etcd-client certificate is not valid for the etcd CA bundle or the etcd endpoints.
+	ExternalEtcdInvalidCondition KubeadmConfigConditionType = "ExternalEtcdInvalid"
+
+	// BootstrapDataOutOfDateCondition is true when the spec was changed after the bootstrap data was rendered,
+	// so the changes are not applied to the machine.
+	BootstrapDataOutOfDateCondition KubeadmConfigConditionType = "BootstrapDataOutOfDate"
+
+	// WaitingForInitLockCondition is true while the bootstrap data of a control plane machine cannot be generated
+	// because another machine holds the kubeadm init lock of the Cluster.
+	WaitingForInitLockCondition KubeadmConfigConditionType = "WaitingForInitLock"
+
+	// ClusterCertificatesInvalidCondition is true while the certificates of the cluster secrets cannot be used, e.g. a
+	// certificate authority without key or whose key does not match its certificate, so that the bootstrap data of
+	// control plane machines is not generated until the secrets are fixed or deleted.
+	ClusterCertificatesInvalidCondition KubeadmConfigConditionType = "ClusterCertificatesInvalid"
+
+	// DeprecatedArgsCondition is true while the kubelet or control plane extra args used to bootstrap the machine are
+	// deprecated or removed in the Kubernetes version of the Machine.
+	DeprecatedArgsCondition KubeadmConfigConditionType = "DeprecatedArgs"
+
+	// InsecureDiscoveryCondition is true while the bootstrap token discovery of a joining machine skips the
+	// verification of the cluster CA, which its cluster or the controller requires, so that its bootstrap data is not
+	// generated.
+	InsecureDiscoveryCondition KubeadmConfigConditionType = "InsecureDiscovery"
+
+	// WorkloadClusterCircuitOpenCondition is true while the calls to the workload cluster fail fast, because it failed
+	// too many consecutive calls, so that the bootstrap data of the machines needing it, e.g. joining with a bootstrap
+	// token, is not generated until it answers again.
+	WorkloadClusterCircuitOpenCondition KubeadmConfigConditionType = "WorkloadClusterCircuitOpen"
+)
+
+// KubeadmConfigCondition describes the state of a KubeadmConfig at a certain point.
+type KubeadmConfigCondition struct {
+	// Type of the condition.
+	Type KubeadmConfigConditionType `json:"type"`
+
+	// Status of the condition, one of True, False, Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the last time the condition transitioned from one status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// LastProbeTime is the last time the condition was checked.
+	// +optional
+	LastProbeTime metav1.Time `json:"lastProbeTime,omitempty"`
+
+	// Reason is a brief CamelCase reason for the last transition of the condition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable message with details about the last transition.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:path=kubeadmconfigs,scope=Namespaced,categories=cluster-api
 // +kubebuilder:storageversion
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Bootstrap data is ready to be consumed"
+// +kubebuilder:printcolumn:name="DataSecret",type="string",JSONPath=".status.dataSecretName",description="Name of the secret holding the bootstrap data"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.lastRequeueReason",description="Reason the controller is waiting before generating the bootstrap data"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // KubeadmConfig is the Schema for the kubeadmconfigs API
 type KubeadmConfig struct {
@@ -103,10 +508,6 @@ type KubeadmConfigList struct {
 	Items           []KubeadmConfig `json:"items"`
 }
 
-func init() {
-	SchemeBuilder.Register(&KubeadmConfig{}, &KubeadmConfigList{})
-}
-
 // Encoding specifies the cloud-init file encoding.
 // +kubebuilder:validation:Enum=base64;gzip;gzip+base64
 type Encoding string
@@ -125,7 +526,8 @@ type File struct {
 	// Path specifies the full path on disk where to store the file.
 	Path string `json:"path"`
 
-	// Owner specifies the ownership of the file, e.g. "root:root".
+	// Owner specifies the ownership of the file, as user and group names or numeric IDs, e.g. "root:root" or
+	// "1000:1000". Numeric IDs allow owning files by users and groups that do not exist yet when the file is written.
 	// +optional
 	Owner string `json:"owner,omitempty"`
 
@@ -133,6 +535,17 @@ type File struct {
 	// +optional
 	Permissions string `json:"permissions,omitempty"`
 
+	// DirectoryPermissions creates the parent directory of the file with these permissions, e.g. "0750", if it does
+	// not exist when the machine boots. Missing directories are otherwise created by cloud-init with permissions
+	// depending on its version and the umask of the distribution.
+	// +optional
+	DirectoryPermissions string `json:"directoryPermissions,omitempty"`
+
+	// Defer writes the file in the final stage of cloud-init, after the users and packages are created, so that it
+	// can be owned by a user created by cloud-init. It requires cloud-init 21.4 or later.
+	// +optional
+	Defer bool `json:"defer,omitempty"`
+
 	// Encoding specifies the encoding of the file contents.
 	// +optional
 	Encoding Encoding `json:"encoding,omitempty"`
@@ -141,6 +554,96 @@ type File struct {
 	Content string `json:"content"`
 }
 
+// StaticPodManifest defines a static pod manifest to be written into /etc/kubernetes/manifests.
+type StaticPodManifest struct {
+	// Name specifies the name of the manifest file, without the .yaml extension.
+	// It must be a DNS-1123 subdomain.
+	Name string `json:"name"`
+
+	// Content is the inline content of the manifest.
+	// Exactly one of Content or ContentFrom should be set.
+	// +optional
+	Content string `json:"content,omitempty"`
+
+	// ContentFrom is a reference to a secret key holding the content of the manifest.
+	// Exactly one of Content or ContentFrom should be set.
+	// +optional
+	ContentFrom *SecretKeyReference `json:"contentFrom,omitempty"`
+}
+
+// SecretKeyReference is a reference to a key of a secret in the same namespace as the KubeadmConfig.
+type SecretKeyReference struct {
+	// Name of the secret.
+	Name string `json:"name"`
+
+	// Key of the secret data to select.
+	Key string `json:"key"`
+}
+
+// TrustBundle defines a bundle of PEM encoded CA certificates to be added to the trust store of a machine.
+type TrustBundle struct {
+	// Name specifies the name of the bundle file in the trust store, without the .crt extension.
+	Name string `json:"name"`
+
+	// Content is the inline PEM encoded bundle.
+	// Exactly one of Content or ContentFrom should be set.
+	// +optional
+	Content string `json:"content,omitempty"`
+
+	// ContentFrom is a reference to a config map key holding the PEM encoded bundle.
+	// Exactly one of Content or ContentFrom should be set.
+	// +optional
+	ContentFrom *ConfigMapKeyReference `json:"contentFrom,omitempty"`
+}
+
+// ConfigMapKeyReference is a reference to a key of a config map in the same namespace as the KubeadmConfig.
+type ConfigMapKeyReference struct {
+	// Name of the config map.
+	Name string `json:"name"`
+
+	// Key of the config map data to select.
+	Key string `json:"key"`
+}
+
+// VIPProvider specifies the implementation used to manage the control plane virtual IP.
+// +kubebuilder:validation:Enum=kube-vip;keepalived
+type VIPProvider string
+
+const (
+	// KubeVIP manages the control plane virtual IP with a kube-vip static pod.
+	KubeVIP VIPProvider = "kube-vip"
+	// Keepalived manages the control plane virtual IP with a keepalived static pod.
+	Keepalived VIPProvider = "keepalived"
+)
+
+// ControlPlaneVIP defines the input for generating a static pod managing the control plane virtual IP.
+type ControlPlaneVIP struct {
+	// Provider specifies the implementation used to manage the virtual IP.
+	Provider VIPProvider `json:"provider"`
+
+	// Address is the virtual IP address used as the control plane endpoint.
+	Address string `json:"address"`
+
+	// Interface is the network interface the virtual IP is bound to, e.g. "eth0".
+	Interface string `json:"interface"`
+
+	// Port is the port of the API server behind the virtual IP. Defaults to 6443.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// Image overrides the default image of the selected provider.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// VirtualRouterID is the VRRP virtual router id used by keepalived. Defaults to 51.
+	// +optional
+	VirtualRouterID int32 `json:"virtualRouterID,omitempty"`
+
+	// CredentialsFrom is a reference to a secret key holding the VRRP authentication password used by keepalived.
+	// +optional
+	CredentialsFrom *SecretKeyReference `json:"credentialsFrom,omitempty"`
+}
+
 // User defines the input for a generated user in cloud-init.
 type User struct {
 	// Name specifies the user name
@@ -197,3 +700,504 @@ type NTP struct {
 	// +optional
 	Enabled *bool `json:"enabled,omitempty"`
 }
+
+// EtcdCertificateName is the name of an etcd certificate generated by kubeadm for stacked etcd.
+// +kubebuilder:validation:Enum=server;peer;healthcheck-client;apiserver-etcd-client
+type EtcdCertificateName string
+
+const (
+	// EtcdServerCertificate is the certificate etcd serves client requests with.
+	EtcdServerCertificate EtcdCertificateName = "server"
+
+	// EtcdPeerCertificate is the certificate etcd members use to communicate with each other.
+	EtcdPeerCertificate EtcdCertificateName = "peer"
+
+	// EtcdHealthcheckClientCertificate is the client certificate used by the etcd liveness probe.
+	EtcdHealthcheckClientCertificate EtcdCertificateName = "healthcheck-client"
+
+	// APIServerEtcdClientCertificate is the client certificate the API server uses to connect to etcd.
+	APIServerEtcdClientCertificate EtcdCertificateName = "apiserver-etcd-client"
+)
+
+// ClusterInfoCheckMode specifies how the cluster-info ConfigMap of the workload cluster is checked.
+// +kubebuilder:validation:Enum=Validate;Repair
+type ClusterInfoCheckMode string
+
+const (
+	// ClusterInfoValidate reports an invalid cluster-info ConfigMap, and waits for it to be fixed before generating
+	// the join data.
+	ClusterInfoValidate ClusterInfoCheckMode = "Validate"
+
+	// ClusterInfoRepair creates or updates an invalid cluster-info ConfigMap with the current cluster CA and
+	// API server endpoint.
+	ClusterInfoRepair ClusterInfoCheckMode = "Repair"
+)
+
+// APIServerCheckMode specifies how the API server endpoint of the workload cluster is probed.
+// +kubebuilder:validation:Enum=TCP;HTTPS
+type APIServerCheckMode string
+
+const (
+	// APIServerCheckTCP probes that the API server endpoint accepts TCP connections.
+	APIServerCheckTCP APIServerCheckMode = "TCP"
+
+	// APIServerCheckHTTPS probes that the /healthz endpoint of the API server answers over TLS, verified with the
+	// cluster CA.
+	APIServerCheckHTTPS APIServerCheckMode = "HTTPS"
+)
+
+// NodeNameStrategy specifies how the name of a node is generated.
+// +kubebuilder:validation:Enum=MachineName;CloudMetadata;Template
+type NodeNameStrategy string
+
+const (
+	// MachineNameStrategy names the node after the Machine.
+	MachineNameStrategy NodeNameStrategy = "MachineName"
+
+	// CloudMetadataStrategy names the node after the local hostname reported by the cloud-init datasource.
+	CloudMetadataStrategy NodeNameStrategy = "CloudMetadata"
+
+	// TemplateStrategy names the node after a custom template.
+	TemplateStrategy NodeNameStrategy = "Template"
+)
+
+// NodeName defines how the hostname of a machine and the name of its Kubernetes Node are generated,
+// so that they are consistent. An explicit NodeRegistration.Name takes precedence for the Node name.
+type NodeName struct {
+	// Strategy specifies how the name is generated.
+	Strategy NodeNameStrategy `json:"strategy"`
+
+	// Template is a Go template generating the name when using the Template strategy.
+	// The template can reference .MachineName, .ClusterName and .Namespace, e.g. "{{ .ClusterName }}-{{ .MachineName }}".
+	// +optional
+	Template string `json:"template,omitempty"`
+
+	// Domain is appended to the hostname to generate the fully qualified domain name of the machine.
+	// It is ignored when using the CloudMetadata strategy.
+	// +optional
+	Domain string `json:"domain,omitempty"`
+}
+
+// CertificatesPolicy defines the validity and the renewal of the certificates of a machine.
+type CertificatesPolicy struct {
+	// CAExpiryDays is the validity, in days, of the certificate authorities generated when the first control plane
+	// machine of the cluster is bootstrapped. It is ignored for other machines and for existing certificate
+	// authorities. Defaults to 3650.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	CAExpiryDays *int32 `json:"caExpiryDays,omitempty"`
+
+	// ExpiryDays is the validity, in days, of the certificates CABPK signs for the machine, i.e. the pre-placed etcd
+	// certificates and the SSH host certificate. It never exceeds the validity of the signing certificate authority. Defaults to 365.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ExpiryDays *int32 `json:"expiryDays,omitempty"`
+
+	// RenewBeforeDays makes control plane machines check their certificates daily and renew them with
+	// kubeadm alpha certs renew once the API server certificate expires in less than the given number of days.
+	// The control plane components are restarted to load the renewed certificates. It is ignored for workers,
+	// whose kubelet rotates its own certificates. It must be lower than 365, the validity of the kubeadm certificates.
+	// Certificates are not renewed if unset.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RenewBeforeDays *int32 `json:"renewBeforeDays,omitempty"`
+}
+
+// FailureDomainPropagation defines where the failure domain of a Machine is propagated to.
+type FailureDomainPropagation struct {
+	// NodeLabels adds the failure-domain.beta.kubernetes.io/zone label, and from Kubernetes v1.17 on the
+	// topology.kubernetes.io/zone label, with the failure domain to the node-labels kubelet argument, unless the
+	// labels are already set.
+	// +optional
+	NodeLabels bool `json:"nodeLabels,omitempty"`
+
+	// ExtraArgs replaces $(FAILURE_DOMAIN) with the failure domain in the extra args of the kubelet and, on the
+	// first control plane machine, of the API server, controller manager, scheduler and local etcd. Machines without
+	// a failure domain are rejected if the placeholder is used.
+	// +optional
+	ExtraArgs bool `json:"extraArgs,omitempty"`
+}
+
+// NodeGroupLabels defines the role and node group labels of worker nodes. Labels already set with the node-labels
+// kubelet argument are not overridden.
+type NodeGroupLabels struct {
+	// Role adds the node-role.kubernetes.io/<role> label, e.g. node-role.kubernetes.io/worker. Kubelets from
+	// v1.16 on refuse to set labels of the node-role.kubernetes.io namespace, so Role requires a Machine version
+	// below v1.16.
+	// +optional
+	Role string `json:"role,omitempty"`
+
+	// Name adds the node.kubernetes.io/instance-group label with the name of the node group, e.g. the name of the
+	// MachineDeployment.
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// BootstrapResourceKind is the kind of a bootstrap resource.
+// +kubebuilder:validation:Enum=Secret;ConfigMap
+type BootstrapResourceKind string
+
+const (
+	// SecretBootstrapResource is a Secret bootstrap resource.
+	SecretBootstrapResource BootstrapResourceKind = "Secret"
+
+	// ConfigMapBootstrapResource is a ConfigMap bootstrap resource.
+	ConfigMapBootstrapResource BootstrapResourceKind = "ConfigMap"
+)
+
+// BootstrapResource references a Secret or ConfigMap of the management cluster to be applied to the workload cluster.
+type BootstrapResource struct {
+	// Kind of the resource.
+	Kind BootstrapResourceKind `json:"kind"`
+
+	// Name of the resource, in the namespace of the KubeadmConfig.
+	Name string `json:"name"`
+
+	// Manifests applies the values of the resource data, in key order, as YAML or JSON manifests, e.g. the manifests
+	// of a CNI, instead of the resource itself.
+	// +optional
+	Manifests bool `json:"manifests,omitempty"`
+
+	// Namespace is the namespace the resource itself is applied to in the workload cluster, kube-system by default.
+	// It is ignored with Manifests.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// CNIPlugin is a CNI plugin whose manifest is bundled with CABPK.
+// +kubebuilder:validation:Enum=calico;cilium;flannel
+type CNIPlugin string
+
+const (
+	// CalicoCNIPlugin is the Calico CNI plugin, with its default pod network 192.168.0.0/16.
+	CalicoCNIPlugin CNIPlugin = "calico"
+
+	// CiliumCNIPlugin is the Cilium CNI plugin.
+	CiliumCNIPlugin CNIPlugin = "cilium"
+
+	// FlannelCNIPlugin is the Flannel CNI plugin, with its default pod network 10.244.0.0/16.
+	FlannelCNIPlugin CNIPlugin = "flannel"
+)
+
+// CNI defines the CNI plugin applied to the workload cluster.
+type CNI struct {
+	// Plugin is the CNI plugin whose bundled manifest is applied, downloaded from the release of the plugin by the
+	// machine. The pod network of the cluster, if set, must be the default pod network of the plugin.
+	// +optional
+	Plugin CNIPlugin `json:"plugin,omitempty"`
+
+	// ManifestFrom is a reference to a config map key holding the manifest to apply instead of a bundled one, e.g.
+	// for a customized pod network or machines without internet access.
+	// Exactly one of Plugin or ManifestFrom should be set.
+	// +optional
+	ManifestFrom *ConfigMapKeyReference `json:"manifestFrom,omitempty"`
+}
+
+// KubeletCredentialProviders defines the image credential provider plugins of the kubelet.
+type KubeletCredentialProviders struct {
+	// Config is the CredentialProviderConfig of the kubelet, in YAML, listing the plugins and the images they provide
+	// credentials for. It is written to /etc/kubernetes/credential-providers.yaml and passed to the kubelet with
+	// --image-credential-provider-config.
+	Config string `json:"config"`
+
+	// BinDir is the absolute path of the directory holding the plugin binaries named by the config, passed to the
+	// kubelet with --image-credential-provider-bin-dir. The binaries are provided by the machine image, or with Files.
+	BinDir string `json:"binDir"`
+}
+
+// TemplatesPolicy defines the rendering of the files and commands of a config as Go templates.
+type TemplatesPolicy struct {
+	// ConfigMaps are the names of the config maps of the config namespace whose keys the templates may read with the
+	// lookup function. Templates cannot read any other object.
+	// +optional
+	ConfigMaps []string `json:"configMaps,omitempty"`
+}
+
+// TokenPoolPolicy defines the pool of bootstrap tokens of a MachineDeployment.
+type TokenPoolPolicy struct {
+	// Size is the number of unused tokens kept in the pool, e.g. the number of machines expected to be replaced at
+	// once.
+	// +kubebuilder:validation:Minimum=1
+	Size int32 `json:"size"`
+
+	// TTLMinutes is the validity, in minutes, of the pooled tokens until they are claimed by a machine. Tokens are
+	// replaced once half of their validity has passed. Defaults to the bootstrap token TTL of the controller.
+	// +kubebuilder:validation:Minimum=2
+	// +optional
+	TTLMinutes *int32 `json:"ttlMinutes,omitempty"`
+}
+
+// SSHCertificates defines the SSH host certificate of a machine.
+type SSHCertificates struct {
+	// HostPrincipals are the host names the host certificate is valid for, e.g. the DNS names of the machine,
+	// in addition to the node name if it is known in advance. At least one principal is required.
+	// The host certificate is valid for Certificates.ExpiryDays.
+	// +optional
+	HostPrincipals []string `json:"hostPrincipals,omitempty"`
+}
+
+// NodeIPDetection defines how the IP address registered by the kubelet is detected on the machine.
+type NodeIPDetection struct {
+	// MetadataURL is an http(s) URL returning the IP address of the machine in plain text,
+	// e.g. http://169.254.169.254/latest/meta-data/local-ipv4. It is queried before the network interface.
+	// +optional
+	MetadataURL string `json:"metadataURL,omitempty"`
+
+	// Interface is the network interface whose first global IPv4 address is used if no metadata URL is set
+	// or the metadata URL cannot be queried. Defaults to the interface of the default route.
+	// +optional
+	Interface string `json:"interface,omitempty"`
+}
+
+// Prerequisite selects a prerequisite module of the controller.
+type Prerequisite struct {
+	// Name is the name of the module, e.g. nvidia-driver.
+	Name string `json:"name"`
+
+	// Parameters are the parameters of the module, e.g. the driver version.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// NodeAgent defines the files and commands the node agent applies to a node after it has joined.
+type NodeAgent struct {
+	// Files are written by the agent, e.g. the registry mirror configuration of the container runtime or a kubelet
+	// drop-in. Defer is ignored.
+	// +optional
+	Files []File `json:"files,omitempty"`
+
+	// Commands are run in order by the agent once the files are written, e.g. to restart the kubelet.
+	// +optional
+	Commands []string `json:"commands,omitempty"`
+
+	// IntervalSeconds is the interval the agent checks for updates at. Defaults to 60.
+	// +kubebuilder:validation:Minimum=10
+	// +optional
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+}
+
+// AddonPrerequisites defines the addons the node-side prerequisites are generated for.
+type AddonPrerequisites struct {
+	// NodeLocalDNS prepares the machine for NodeLocal DNSCache: a dummy interface holding the local IP of the cache
+	// is created before kubeadm runs, and the kubelet passes the local IP to pods as their DNS server. Pods cannot
+	// resolve names until the node-local-dns DaemonSet runs on the node.
+	// +optional
+	NodeLocalDNS *NodeLocalDNSPrerequisites `json:"nodeLocalDNS,omitempty"`
+
+	// KubeProxyIPVS loads the kernel modules kube-proxy requires in IPVS mode at boot, before kubeadm runs.
+	// +optional
+	KubeProxyIPVS bool `json:"kubeProxyIPVS,omitempty"`
+}
+
+// NodeLocalDNSPrerequisites defines the node-side settings of NodeLocal DNSCache.
+type NodeLocalDNSPrerequisites struct {
+	// LocalIP is the link-local IP address the cache listens on, which must match the one of the node-local-dns
+	// DaemonSet. Defaults to 169.254.20.10.
+	// +optional
+	LocalIP string `json:"localIP,omitempty"`
+}
+
+// KubeletServingCertificate defines the bootstrap of the serving certificate of the kubelet.
+type KubeletServingCertificate struct {
+	// ApproverManifestFrom is a reference to a config map key holding the manifest of an approver of the kubelet
+	// serving certificate signing requests, e.g. kubelet-csr-approver, applied to the workload cluster with kubectl by
+	// the first control plane machine right after kubeadm init, after the CNI. It is ignored for joining machines.
+	// +optional
+	ApproverManifestFrom *ConfigMapKeyReference `json:"approverManifestFrom,omitempty"`
+}
+
+// NodeDNSResolver is the resolver configured with the DNS servers and search domains of a machine.
+// +kubebuilder:validation:Enum=ResolvConf;SystemdResolved
+type NodeDNSResolver string
+
+const (
+	// ResolvConfResolver replaces /etc/resolv.conf with a link to /etc/kubernetes/resolv.conf, which the kubelet
+	// passes to pods.
+	ResolvConfResolver NodeDNSResolver = "ResolvConf"
+
+	// SystemdResolvedResolver configures systemd-resolved with a drop-in, and passes the upstream servers of
+	// systemd-resolved in /run/systemd/resolve/resolv.conf to pods instead of its local stub resolver.
+	SystemdResolvedResolver NodeDNSResolver = "SystemdResolved"
+)
+
+// NodeDNS defines the DNS resolution of a machine and of its pods.
+type NodeDNS struct {
+	// Nameservers are the IP addresses of the DNS servers of the machine, at most 3.
+	// Required by the ResolvConf resolver.
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// SearchDomains are the DNS search domains of the machine, at most 6.
+	// +optional
+	SearchDomains []string `json:"searchDomains,omitempty"`
+
+	// Resolver is the resolver configured with the nameservers and search domains. Defaults to ResolvConf.
+	// +optional
+	Resolver NodeDNSResolver `json:"resolver,omitempty"`
+
+	// KubeletResolvConf is the absolute path of the resolv.conf the kubelet passes to pods with --resolv-conf.
+	// Defaults to the resolv.conf of the resolver.
+	// +optional
+	KubeletResolvConf string `json:"kubeletResolvConf,omitempty"`
+}
+
+// APIServerEndpointDNS defines the DNS name or SRV record the API server endpoint of joining machines is resolved from.
+// Exactly one of Name or SRVRecord must be set.
+type APIServerEndpointDNS struct {
+	// Name is a DNS name of the API server, e.g. api.cluster.example.com, joined with Port into the discovery API
+	// server endpoint and resolved by kubeadm on the machine.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Port is the port of the API server used with Name. Defaults to 6443.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// SRVRecord is the name of a DNS SRV record, e.g. _kubernetes._tcp.cluster.example.com, resolved on the machine
+	// before kubeadm runs; the target and port of the answer with the lowest priority and the highest weight are
+	// used as the discovery API server endpoint. dig or host must be installed on the machine.
+	// +optional
+	SRVRecord string `json:"srvRecord,omitempty"`
+}
+
+// DiscoveryPolicy defines how CABPK handles the discovery settings of the join configuration.
+type DiscoveryPolicy struct {
+	// Manual leaves the discovery settings of the join configuration to external tooling: CABPK neither creates a
+	// bootstrap token nor injects the API server endpoint, the CA certificate hashes or the skip of the CA
+	// verification, and refuses to generate the join data if the discovery settings are incomplete.
+	// +optional
+	Manual bool `json:"manual,omitempty"`
+}
+
+// ControlPlaneNodePolicy defines the taints and labels of control plane nodes.
+type ControlPlaneNodePolicy struct {
+	// Untainted removes the node-role.kubernetes.io/master:NoSchedule taint kubeadm adds to control plane nodes,
+	// so that they run regular workloads.
+	// +optional
+	Untainted bool `json:"untainted,omitempty"`
+
+	// UntaintSingleNode removes the node-role.kubernetes.io/master:NoSchedule taint of the first control plane
+	// node if its Machine is the only Machine of the cluster when the bootstrap data is generated, so that
+	// single node clusters, e.g. for edge or development use cases, run regular workloads.
+	// +optional
+	UntaintSingleNode bool `json:"untaintSingleNode,omitempty"`
+
+	// Labels are added to control plane nodes. Unlike labels set with the node-labels kubelet argument, they
+	// may use the kubernetes.io namespace, e.g. node-role.kubernetes.io/control-plane.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// BootstrapDiagnostics defines where the logs of a machine that failed to bootstrap are uploaded.
+type BootstrapDiagnostics struct {
+	// UploadURL is an http(s) URL the compressed logs are uploaded to with a PUT request, e.g. a pre-signed
+	// object storage URL. If unset, the logs of joining machines are uploaded with their bootstrap token to a
+	// secret of the workload cluster, and copied to the <config name>-bootstrap-diagnostics secret of the
+	// management cluster. Init control plane machines require an upload URL.
+	// +optional
+	UploadURL string `json:"uploadURL,omitempty"`
+}
+
+// SELinux defines the SELinux settings applied to the machine before kubeadm runs.
+type SELinux struct {
+	// Mode is the SELinux mode set on the machine and persisted in /etc/selinux/config.
+	// Disabling SELinux only takes effect after a reboot; until then, the machine runs in permissive mode.
+	// If unset, the mode of the machine is left unchanged.
+	// +optional
+	Mode SELinuxMode `json:"mode,omitempty"`
+
+	// Relabel restores the default SELinux contexts of the files written from the bootstrap data and of the
+	// directories used by kubeadm and the kubelet before kubeadm runs.
+	// +optional
+	Relabel bool `json:"relabel,omitempty"`
+
+	// RelabelPaths lists additional paths whose default SELinux contexts are restored, recursively, when Relabel is set.
+	// +optional
+	RelabelPaths []string `json:"relabelPaths,omitempty"`
+}
+
+// SELinuxMode is the mode SELinux runs in.
+// +kubebuilder:validation:Enum=enforcing;permissive;disabled
+type SELinuxMode string
+
+const (
+	// SELinuxEnforcing enforces the SELinux policy.
+	SELinuxEnforcing SELinuxMode = "enforcing"
+
+	// SELinuxPermissive logs the violations of the SELinux policy without enforcing it.
+	SELinuxPermissive SELinuxMode = "permissive"
+
+	// SELinuxDisabled disables SELinux.
+	SELinuxDisabled SELinuxMode = "disabled"
+)
+
+// SystemdUnit defines a systemd unit written on the machine, along with its drop-ins.
+type SystemdUnit struct {
+	// Name is the name of the unit, including its type suffix, e.g. node-problem-detector.service.
+	Name string `json:"name"`
+
+	// Contents is the content of the unit file written to /etc/systemd/system. If empty, only the drop-ins are
+	// written, e.g. to configure a unit shipped by the distribution.
+	// +optional
+	Contents string `json:"contents,omitempty"`
+
+	// DropIns are written to the drop-in directory of the unit, /etc/systemd/system/<name>.d.
+	// +optional
+	DropIns []SystemdDropIn `json:"dropIns,omitempty"`
+
+	// Enable enables the unit, so that it is started at boot.
+	// +optional
+	Enable bool `json:"enable,omitempty"`
+
+	// Start starts the unit, or restarts it if it is already running so that its drop-ins are applied.
+	// +optional
+	Start bool `json:"start,omitempty"`
+
+	// Phase specifies whether the unit is enabled and started before kubeadm runs, the default, or after kubeadm
+	// is done, e.g. for units relying on the kubelet kubeconfig.
+	// +optional
+	Phase SystemdUnitPhase `json:"phase,omitempty"`
+}
+
+// SystemdDropIn defines a drop-in overriding the settings of a systemd unit.
+type SystemdDropIn struct {
+	// Name is the name of the drop-in file, e.g. 10-environment.conf.
+	Name string `json:"name"`
+
+	// Contents is the content of the drop-in file.
+	Contents string `json:"contents"`
+}
+
+// SystemdUnitPhase is the phase of the bootstrap a systemd unit is enabled and started in.
+// +kubebuilder:validation:Enum=PreKubeadm;PostKubeadm
+type SystemdUnitPhase string
+
+const (
+	// PreKubeadmPhase enables and starts the unit before kubeadm runs.
+	PreKubeadmPhase SystemdUnitPhase = "PreKubeadm"
+
+	// PostKubeadmPhase enables and starts the unit after kubeadm is done.
+	PostKubeadmPhase SystemdUnitPhase = "PostKubeadm"
+)
+
+// DeprecatedArgsPolicy defines the handling of deprecated extra args.
+// +kubebuilder:validation:Enum=Warn;Migrate
+type DeprecatedArgsPolicy string
+
+const (
+	// WarnDeprecatedArgs reports the deprecated extra args, and uses them as is.
+	WarnDeprecatedArgs DeprecatedArgsPolicy = "Warn"
+
+	// MigrateDeprecatedArgs reports the deprecated extra args, renames them to their replacement and drops the removed
+	// ones without replacement.
+	MigrateDeprecatedArgs DeprecatedArgsPolicy = "Migrate"
+)
+
+// HardeningPreset is a set of security settings applied to the generated configuration.
+// +kubebuilder:validation:Enum=cis
+type HardeningPreset string
+
+const (
+	// CISHardening applies the settings recommended by the CIS Kubernetes benchmark.
+	CISHardening HardeningPreset = "cis"
+)
@@ -0,0 +1,210 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+// kubeadmConfigurationFields are the fields of the spec holding kubeadm configurations, with their kubeadm types.
+// The CRDs preserve their unknown fields, so that they reach the validating webhook and are rejected there instead of
+// being silently dropped.
+var kubeadmConfigurationFields = []struct {
+	name   string
+	newObj func() interface{}
+}{
+	{"clusterConfiguration", func() interface{} { return &v1beta1.ClusterConfiguration{} }},
+	{"initConfiguration", func() interface{} { return &v1beta1.InitConfiguration{} }},
+	{"joinConfiguration", func() interface{} { return &v1beta1.JoinConfiguration{} }},
+}
+
+// ValidateStrictDecoding returns the unknown fields and type mismatches of the kubeadm configurations of the spec
+// at the given path of the raw JSON object, which would otherwise vanish when the object is decoded and only fail
+// on the machine.
+func ValidateStrictDecoding(raw []byte, path *field.Path, specPath ...string) field.ErrorList {
+	spec, allErrs := kubeadmConfigurations(raw, path, specPath)
+	for _, f := range kubeadmConfigurationFields {
+		value, ok := spec[f.name]
+		if !ok || string(value) == "null" {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(f.newObj()); err != nil {
+			allErrs = append(allErrs, strictDecodingError(path.Child(f.name), err))
+		}
+	}
+	return allErrs
+}
+
+// ValidateStrictDecodingUpdate returns the type mismatches of the kubeadm configurations of the spec at the given
+// path of the raw JSON object, and their unknown fields absent from the old object, so that objects stored with
+// unknown fields before they were rejected can still be updated, e.g. by controllers patching their metadata.
+func ValidateStrictDecodingUpdate(raw, oldRaw []byte, path *field.Path, specPath ...string) field.ErrorList {
+	spec, allErrs := kubeadmConfigurations(raw, path, specPath)
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+	oldSpec, _ := kubeadmConfigurations(oldRaw, path, specPath)
+	for _, f := range kubeadmConfigurationFields {
+		value, ok := spec[f.name]
+		if !ok || string(value) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(value, f.newObj()); err != nil {
+			allErrs = append(allErrs, strictDecodingError(path.Child(f.name), err))
+			continue
+		}
+		existing := map[string]bool{}
+		for _, fieldPath := range unknownFields(path.Child(f.name), oldSpec[f.name], f.newObj()) {
+			existing[fieldPath.String()] = true
+		}
+		for _, fieldPath := range unknownFields(path.Child(f.name), value, f.newObj()) {
+			if !existing[fieldPath.String()] {
+				allErrs = append(allErrs, field.Forbidden(fieldPath, "unknown field"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// kubeadmConfigurations returns the raw fields of the spec at the given path of the raw JSON object.
+func kubeadmConfigurations(raw []byte, path *field.Path, specPath []string) (map[string]json.RawMessage, field.ErrorList) {
+	spec := map[string]json.RawMessage{}
+	data := json.RawMessage(raw)
+	for _, name := range specPath {
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, field.ErrorList{field.Invalid(path, "", err.Error())}
+		}
+		data = object[name]
+		if len(data) == 0 {
+			return nil, nil
+		}
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, field.ErrorList{field.Invalid(path, "", err.Error())}
+	}
+	return spec, nil
+}
+
+// unknownFields returns the paths of all the non-empty fields of the raw JSON value that are dropped when it is
+// decoded into obj, unlike the strict decoder which stops at the first one.
+func unknownFields(path *field.Path, raw json.RawMessage, obj interface{}) []*field.Path {
+	if len(raw) == 0 {
+		return nil
+	}
+	// type mismatches are reported separately, the other fields are decoded anyway
+	_ = json.Unmarshal(raw, obj)
+	decoded, err := json.Marshal(obj)
+	if err != nil {
+		return nil
+	}
+	var rawValue, decodedValue interface{}
+	if err := json.Unmarshal(raw, &rawValue); err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(decoded, &decodedValue); err != nil {
+		return nil
+	}
+	return droppedFields(path, rawValue, decodedValue)
+}
+
+// droppedFields returns the paths of the non-empty fields of the raw value missing in the decoded one. Field names
+// are matched case-insensitively, like the JSON decoder does.
+func droppedFields(path *field.Path, raw, decoded interface{}) []*field.Path {
+	var dropped []*field.Path
+	switch raw := raw.(type) {
+	case map[string]interface{}:
+		decodedObject, _ := decoded.(map[string]interface{})
+		names := make([]string, 0, len(raw))
+		for name := range raw {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			decodedField, ok := decodedObject[name]
+			if !ok {
+				for decodedName, value := range decodedObject {
+					if strings.EqualFold(decodedName, name) {
+						decodedField, ok = value, true
+						break
+					}
+				}
+			}
+			switch {
+			case ok:
+				dropped = append(dropped, droppedFields(path.Child(name), raw[name], decodedField)...)
+			case !isEmptyJSON(raw[name]):
+				dropped = append(dropped, path.Child(name))
+			}
+		}
+	case []interface{}:
+		decodedList, _ := decoded.([]interface{})
+		for i, item := range raw {
+			var decodedItem interface{}
+			if i < len(decodedList) {
+				decodedItem = decodedList[i]
+			}
+			dropped = append(dropped, droppedFields(path.Index(i), item, decodedItem)...)
+		}
+	}
+	return dropped
+}
+
+// isEmptyJSON returns whether the decoded JSON value is empty, i.e. omitted when encoded if known.
+func isEmptyJSON(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !value
+	case float64:
+		return value == 0
+	case string:
+		return value == ""
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		return len(value) == 0
+	}
+	return false
+}
+
+// strictDecodingError returns the field error of an error decoding the kubeadm configuration at the given path.
+func strictDecodingError(path *field.Path, err error) *field.Error {
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		if typeErr.Field != "" {
+			for _, name := range strings.Split(typeErr.Field, ".") {
+				path = path.Child(name)
+			}
+		}
+		return field.Invalid(path, typeErr.Value, fmt.Sprintf("must be of type %s", typeErr.Type))
+	}
+	message := strings.TrimPrefix(err.Error(), "json: ")
+	if strings.HasPrefix(message, "unknown field ") {
+		return field.Forbidden(path, message)
+	}
+	return field.Invalid(path, "", message)
+}
@@ -0,0 +1,416 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// ValidateCreate implements webhook.Validator.
+func (c *KubeadmConfig) ValidateCreate() error {
+	return c.validate()
+}
+
+// ValidateUpdate implements webhook.Validator.
+func (c *KubeadmConfig) ValidateUpdate(old runtime.Object) error {
+	return c.validate()
+}
+
+// ValidateDelete implements webhook.Validator.
+func (c *KubeadmConfig) ValidateDelete() error {
+	return nil
+}
+
+func (c *KubeadmConfig) validate() error {
+	allErrs := ValidateExtraArgs(&c.Spec, field.NewPath("spec"))
+	allErrs = append(allErrs, ValidateExternalEtcd(&c.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, ValidateFiles(&c.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, ValidateNodeGroup(&c.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, ValidateCNI(&c.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, ValidateCredentialProviders(&c.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, ValidateDNS(&c.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, ValidatePrerequisites(&c.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, ValidateAddons(&c.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, ValidateKubeletServingCertificate(&c.Spec, field.NewPath("spec"))...)
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("KubeadmConfig").GroupKind(), c.Name, allErrs)
+}
+
+// ValidateCreate implements webhook.Validator.
+func (t *KubeadmConfigTemplate) ValidateCreate() error {
+	return t.validate()
+}
+
+// ValidateUpdate implements webhook.Validator.
+func (t *KubeadmConfigTemplate) ValidateUpdate(old runtime.Object) error {
+	return t.validate()
+}
+
+// ValidateDelete implements webhook.Validator.
+func (t *KubeadmConfigTemplate) ValidateDelete() error {
+	return nil
+}
+
+func (t *KubeadmConfigTemplate) validate() error {
+	allErrs := ValidateExtraArgs(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))
+	allErrs = append(allErrs, ValidateExternalEtcd(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))...)
+	allErrs = append(allErrs, ValidateFiles(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))...)
+	allErrs = append(allErrs, ValidateNodeGroup(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))...)
+	allErrs = append(allErrs, ValidateCNI(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))...)
+	allErrs = append(allErrs, ValidateCredentialProviders(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))...)
+	allErrs = append(allErrs, ValidateDNS(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))...)
+	allErrs = append(allErrs, ValidatePrerequisites(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))...)
+	allErrs = append(allErrs, ValidateAddons(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))...)
+	allErrs = append(allErrs, ValidateKubeletServingCertificate(&t.Spec.Template.Spec, field.NewPath("spec", "template", "spec"))...)
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("KubeadmConfigTemplate").GroupKind(), t.Name, allErrs)
+}
+
+// ValidateExtraArgs returns the extra arguments of the control plane components conflicting with the values kubeadm
+// sets from the other fields of the spec, which would otherwise only fail on the machine.
+func ValidateExtraArgs(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if cc := spec.ClusterConfiguration; cc != nil {
+		ccPath := path.Child("clusterConfiguration")
+		networkingPath := ccPath.Child("networking")
+		apiServerPath := ccPath.Child("apiServer", "extraArgs")
+		controllerManagerPath := ccPath.Child("controllerManager", "extraArgs")
+		schedulerPath := ccPath.Child("scheduler", "extraArgs")
+
+		allErrs = append(allErrs, conflictingArg(cc.APIServer.ExtraArgs, apiServerPath, "service-cluster-ip-range", cc.Networking.ServiceSubnet, networkingPath.Child("serviceSubnet"))...)
+		allErrs = append(allErrs, conflictingArg(cc.ControllerManager.ExtraArgs, controllerManagerPath, "service-cluster-ip-range", cc.Networking.ServiceSubnet, networkingPath.Child("serviceSubnet"))...)
+		allErrs = append(allErrs, conflictingArg(cc.ControllerManager.ExtraArgs, controllerManagerPath, "cluster-cidr", cc.Networking.PodSubnet, networkingPath.Child("podSubnet"))...)
+
+		// the kubeconfig files of the controller manager and the scheduler are generated by kubeadm at fixed paths
+		allErrs = append(allErrs, conflictingArg(cc.ControllerManager.ExtraArgs, controllerManagerPath, "kubeconfig", "/etc/kubernetes/controller-manager.conf", nil)...)
+		allErrs = append(allErrs, conflictingArg(cc.Scheduler.ExtraArgs, schedulerPath, "kubeconfig", "/etc/kubernetes/scheduler.conf", nil)...)
+
+		if ic := spec.InitConfiguration; ic != nil {
+			endpointPath := path.Child("initConfiguration", "localAPIEndpoint")
+			allErrs = append(allErrs, conflictingArg(cc.APIServer.ExtraArgs, apiServerPath, "advertise-address", ic.LocalAPIEndpoint.AdvertiseAddress, endpointPath.Child("advertiseAddress"))...)
+			if ic.LocalAPIEndpoint.BindPort != 0 {
+				allErrs = append(allErrs, conflictingArg(cc.APIServer.ExtraArgs, apiServerPath, "secure-port", strconv.Itoa(int(ic.LocalAPIEndpoint.BindPort)), endpointPath.Child("bindPort"))...)
+			}
+		}
+		if jc := spec.JoinConfiguration; jc != nil && jc.ControlPlane != nil {
+			endpointPath := path.Child("joinConfiguration", "controlPlane", "localAPIEndpoint")
+			allErrs = append(allErrs, conflictingArg(cc.APIServer.ExtraArgs, apiServerPath, "advertise-address", jc.ControlPlane.LocalAPIEndpoint.AdvertiseAddress, endpointPath.Child("advertiseAddress"))...)
+			if jc.ControlPlane.LocalAPIEndpoint.BindPort != 0 {
+				allErrs = append(allErrs, conflictingArg(cc.APIServer.ExtraArgs, apiServerPath, "secure-port", strconv.Itoa(int(jc.ControlPlane.LocalAPIEndpoint.BindPort)), endpointPath.Child("bindPort"))...)
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// ValidateExternalEtcd returns the errors of the external etcd settings of the cluster configuration: the etcd CA,
+// client certificate and key files are set together, and the endpoints are URLs, using https with TLS.
+func ValidateExternalEtcd(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	if spec.ClusterConfiguration == nil || spec.ClusterConfiguration.Etcd.External == nil {
+		return nil
+	}
+	external := spec.ClusterConfiguration.Etcd.External
+	externalPath := path.Child("clusterConfiguration", "etcd", "external")
+
+	var allErrs field.ErrorList
+	if len(external.Endpoints) == 0 {
+		allErrs = append(allErrs, field.Required(externalPath.Child("endpoints"), "at least one etcd endpoint is required"))
+	}
+	useTLS := external.CAFile != "" || external.CertFile != "" || external.KeyFile != ""
+	if useTLS {
+		for _, file := range []struct {
+			name, value string
+		}{
+			{"caFile", external.CAFile},
+			{"certFile", external.CertFile},
+			{"keyFile", external.KeyFile},
+		} {
+			if file.value == "" {
+				allErrs = append(allErrs, field.Required(externalPath.Child(file.name), "caFile, certFile and keyFile must be set together"))
+			}
+		}
+	}
+	for i, endpoint := range external.Endpoints {
+		u, err := url.Parse(endpoint)
+		switch {
+		case err != nil || u.Host == "":
+			allErrs = append(allErrs, field.Invalid(externalPath.Child("endpoints").Index(i), endpoint, "must be a URL with a host"))
+		case useTLS && u.Scheme != "https":
+			allErrs = append(allErrs, field.Invalid(externalPath.Child("endpoints").Index(i), endpoint, "must use https with TLS certificates"))
+		case u.Scheme != "https" && u.Scheme != "http":
+			allErrs = append(allErrs, field.Invalid(externalPath.Child("endpoints").Index(i), endpoint, "must use http or https"))
+		}
+	}
+	return allErrs
+}
+
+var (
+	// fileOwnerRegexp matches a user and an optional group, as names or numeric IDs.
+	fileOwnerRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*(:[a-zA-Z0-9_][a-zA-Z0-9_.-]*)?$`)
+	// filePermissionsRegexp matches octal permissions.
+	filePermissionsRegexp = regexp.MustCompile(`^[0-7]{3,4}$`)
+)
+
+// ValidateFiles returns the errors of the files of the spec: owners are user and group names or numeric IDs, and
+// permissions are octal.
+func ValidateFiles(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, file := range spec.Files {
+		filePath := path.Child("files").Index(i)
+		if file.Owner != "" && !fileOwnerRegexp.MatchString(file.Owner) {
+			allErrs = append(allErrs, field.Invalid(filePath.Child("owner"), file.Owner, "must be a user and an optional group, as names or numeric IDs, e.g. root:root or 1000:1000"))
+		}
+		for _, permissions := range []struct {
+			name, value string
+		}{
+			{"permissions", file.Permissions},
+			{"directoryPermissions", file.DirectoryPermissions},
+		} {
+			if permissions.value != "" && !filePermissionsRegexp.MatchString(permissions.value) {
+				allErrs = append(allErrs, field.Invalid(filePath.Child(permissions.name), permissions.value, "must be octal permissions, e.g. 0640"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// ValidateNodeGroup returns the errors of the node group labels of the spec: the role is the name of a label of the
+// node-role.kubernetes.io prefix and the name a label value. Node groups label worker nodes only.
+func ValidateNodeGroup(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	if spec.NodeGroup == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	nodeGroupPath := path.Child("nodeGroup")
+	if role := spec.NodeGroup.Role; role != "" {
+		for _, msg := range validation.IsQualifiedName("node-role.kubernetes.io/" + role) {
+			allErrs = append(allErrs, field.Invalid(nodeGroupPath.Child("role"), role, msg))
+		}
+	}
+	if name := spec.NodeGroup.Name; name != "" {
+		for _, msg := range validation.IsValidLabelValue(name) {
+			allErrs = append(allErrs, field.Invalid(nodeGroupPath.Child("name"), name, msg))
+		}
+	}
+	if spec.JoinConfiguration != nil && spec.JoinConfiguration.ControlPlane != nil {
+		allErrs = append(allErrs, field.Forbidden(nodeGroupPath, "is not supported by control plane machines, set controlPlaneNodes.labels instead"))
+	}
+	return allErrs
+}
+
+// ValidateCNI returns the errors of the CNI of the spec, which is either a bundled plugin or a manifest.
+func ValidateCNI(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	if spec.CNI == nil {
+		return nil
+	}
+	if (spec.CNI.Plugin == "") == (spec.CNI.ManifestFrom == nil) {
+		return field.ErrorList{field.Invalid(path.Child("cni"), spec.CNI, "must define exactly one of plugin or manifestFrom")}
+	}
+	return nil
+}
+
+// credentialProviderArgs are the kubelet arguments set from the credential providers of the spec.
+var credentialProviderArgs = []string{"image-credential-provider-config", "image-credential-provider-bin-dir"}
+
+// ValidateCredentialProviders returns the errors of the kubelet credential providers of the spec: the config is a
+// CredentialProviderConfig of the kubelet.config.k8s.io group, the binary directory an absolute path, and the kubelet
+// arguments they set are not set by the node registrations.
+func ValidateCredentialProviders(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	providers := spec.CredentialProviders
+	if providers == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	providersPath := path.Child("credentialProviders")
+
+	typeMeta := metav1.TypeMeta{}
+	if err := yaml.Unmarshal([]byte(providers.Config), &typeMeta); err != nil {
+		allErrs = append(allErrs, field.Invalid(providersPath.Child("config"), providers.Config, fmt.Sprintf("must be YAML: %v", err)))
+	} else if gv, err := schema.ParseGroupVersion(typeMeta.APIVersion); err != nil || gv.Group != "kubelet.config.k8s.io" || typeMeta.Kind != "CredentialProviderConfig" {
+		allErrs = append(allErrs, field.Invalid(providersPath.Child("config"), providers.Config, "must be a CredentialProviderConfig of the kubelet.config.k8s.io API group"))
+	}
+	if !strings.HasPrefix(providers.BinDir, "/") {
+		allErrs = append(allErrs, field.Invalid(providersPath.Child("binDir"), providers.BinDir, "must be an absolute path"))
+	}
+
+	if spec.InitConfiguration != nil {
+		allErrs = append(allErrs, credentialProviderArgsErrors(spec.InitConfiguration.NodeRegistration.KubeletExtraArgs, path.Child("initConfiguration", "nodeRegistration", "kubeletExtraArgs"))...)
+	}
+	if spec.JoinConfiguration != nil {
+		allErrs = append(allErrs, credentialProviderArgsErrors(spec.JoinConfiguration.NodeRegistration.KubeletExtraArgs, path.Child("joinConfiguration", "nodeRegistration", "kubeletExtraArgs"))...)
+	}
+	return allErrs
+}
+
+// credentialProviderArgsErrors returns an error for each kubelet argument set from the credential providers.
+func credentialProviderArgsErrors(kubeletExtraArgs map[string]string, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, arg := range credentialProviderArgs {
+		if value, ok := kubeletExtraArgs[arg]; ok {
+			allErrs = append(allErrs, field.Invalid(path.Key(arg), value, "is set from credentialProviders and must not be set"))
+		}
+	}
+	return allErrs
+}
+
+const (
+	// maxNameservers and maxSearchDomains are the maximum number of nameservers and search domains honored by the
+	// resolver of glibc.
+	maxNameservers   = 3
+	maxSearchDomains = 6
+)
+
+// ValidateDNS returns the errors of the DNS configuration of the spec: the nameservers are IP addresses, required by
+// the ResolvConf resolver, the search domains DNS names, the kubelet resolv.conf an absolute path, and the kubelet
+// resolv-conf argument is not set by the node registrations.
+func ValidateDNS(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	dns := spec.DNS
+	if dns == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	dnsPath := path.Child("dns")
+
+	if len(dns.Nameservers) == 0 && dns.Resolver != SystemdResolvedResolver {
+		allErrs = append(allErrs, field.Required(dnsPath.Child("nameservers"), "is required by the "+string(ResolvConfResolver)+" resolver"))
+	}
+	if len(dns.Nameservers) > maxNameservers {
+		allErrs = append(allErrs, field.Invalid(dnsPath.Child("nameservers"), dns.Nameservers, fmt.Sprintf("must have at most %d items", maxNameservers)))
+	}
+	for i, nameserver := range dns.Nameservers {
+		if net.ParseIP(nameserver) == nil {
+			allErrs = append(allErrs, field.Invalid(dnsPath.Child("nameservers").Index(i), nameserver, "must be an IP address"))
+		}
+	}
+	if len(dns.SearchDomains) > maxSearchDomains {
+		allErrs = append(allErrs, field.Invalid(dnsPath.Child("searchDomains"), dns.SearchDomains, fmt.Sprintf("must have at most %d items", maxSearchDomains)))
+	}
+	for i, domain := range dns.SearchDomains {
+		if errs := validation.IsDNS1123Subdomain(strings.ToLower(domain)); len(errs) > 0 {
+			allErrs = append(allErrs, field.Invalid(dnsPath.Child("searchDomains").Index(i), domain, strings.Join(errs, ", ")))
+		}
+	}
+	if dns.KubeletResolvConf != "" && !strings.HasPrefix(dns.KubeletResolvConf, "/") {
+		allErrs = append(allErrs, field.Invalid(dnsPath.Child("kubeletResolvConf"), dns.KubeletResolvConf, "must be an absolute path"))
+	}
+
+	if spec.InitConfiguration != nil {
+		if value, ok := spec.InitConfiguration.NodeRegistration.KubeletExtraArgs["resolv-conf"]; ok {
+			allErrs = append(allErrs, field.Invalid(path.Child("initConfiguration", "nodeRegistration", "kubeletExtraArgs").Key("resolv-conf"), value, "is set from dns and must not be set"))
+		}
+	}
+	if spec.JoinConfiguration != nil {
+		if value, ok := spec.JoinConfiguration.NodeRegistration.KubeletExtraArgs["resolv-conf"]; ok {
+			allErrs = append(allErrs, field.Invalid(path.Child("joinConfiguration", "nodeRegistration", "kubeletExtraArgs").Key("resolv-conf"), value, "is set from dns and must not be set"))
+		}
+	}
+	return allErrs
+}
+
+// ValidatePrerequisites returns the errors of the prerequisites of the spec: each module is named and selected once.
+// The modules and their parameters are checked by the controller, which registers them.
+func ValidatePrerequisites(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := map[string]bool{}
+	for i, prerequisite := range spec.Prerequisites {
+		namePath := path.Child("prerequisites").Index(i).Child("name")
+		switch {
+		case prerequisite.Name == "":
+			allErrs = append(allErrs, field.Required(namePath, "must be the name of a prerequisite module"))
+		case seen[prerequisite.Name]:
+			allErrs = append(allErrs, field.Duplicate(namePath, prerequisite.Name))
+		}
+		seen[prerequisite.Name] = true
+	}
+	return allErrs
+}
+
+// ValidateAddons returns the errors of the addon prerequisites of the spec: the local IP of NodeLocal DNSCache is an
+// IP address, and the DNS server the kubelet passes to pods is not set in its extra arguments.
+func ValidateAddons(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	if spec.Addons == nil || spec.Addons.NodeLocalDNS == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	if localIP := spec.Addons.NodeLocalDNS.LocalIP; localIP != "" && net.ParseIP(localIP) == nil {
+		allErrs = append(allErrs, field.Invalid(path.Child("addons", "nodeLocalDNS", "localIP"), localIP, "must be an IP address"))
+	}
+
+	if spec.InitConfiguration != nil {
+		if value, ok := spec.InitConfiguration.NodeRegistration.KubeletExtraArgs["cluster-dns"]; ok {
+			allErrs = append(allErrs, field.Invalid(path.Child("initConfiguration", "nodeRegistration", "kubeletExtraArgs").Key("cluster-dns"), value, "is set from addons.nodeLocalDNS and must not be set"))
+		}
+	}
+	if spec.JoinConfiguration != nil {
+		if value, ok := spec.JoinConfiguration.NodeRegistration.KubeletExtraArgs["cluster-dns"]; ok {
+			allErrs = append(allErrs, field.Invalid(path.Child("joinConfiguration", "nodeRegistration", "kubeletExtraArgs").Key("cluster-dns"), value, "is set from addons.nodeLocalDNS and must not be set"))
+		}
+	}
+	return allErrs
+}
+
+// ValidateKubeletServingCertificate returns the errors of the kubelet serving certificate of the spec: the kubelet
+// argument it sets is not set by the node registrations.
+func ValidateKubeletServingCertificate(spec *KubeadmConfigSpec, path *field.Path) field.ErrorList {
+	if spec.KubeletServingCertificate == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+	if spec.InitConfiguration != nil {
+		if value, ok := spec.InitConfiguration.NodeRegistration.KubeletExtraArgs["rotate-server-certificates"]; ok {
+			allErrs = append(allErrs, field.Invalid(path.Child("initConfiguration", "nodeRegistration", "kubeletExtraArgs").Key("rotate-server-certificates"), value, "is set from kubeletServingCertificate and must not be set"))
+		}
+	}
+	if spec.JoinConfiguration != nil {
+		if value, ok := spec.JoinConfiguration.NodeRegistration.KubeletExtraArgs["rotate-server-certificates"]; ok {
+			allErrs = append(allErrs, field.Invalid(path.Child("joinConfiguration", "nodeRegistration", "kubeletExtraArgs").Key("rotate-server-certificates"), value, "is set from kubeletServingCertificate and must not be set"))
+		}
+	}
+	return allErrs
+}
+
+// conflictingArg returns an error if the extra argument is set to a value different from the one kubeadm sets.
+// If the value is set from another field, that field is referenced in the error; an empty value never conflicts.
+func conflictingArg(extraArgs map[string]string, path *field.Path, arg, value string, valuePath *field.Path) field.ErrorList {
+	set, ok := extraArgs[arg]
+	if !ok || value == "" || set == value {
+		return nil
+	}
+	if valuePath == nil {
+		return field.ErrorList{field.Invalid(path.Key(arg), set, fmt.Sprintf("is set by kubeadm to %q and must not be overridden", value))}
+	}
+	return field.ErrorList{field.Invalid(path.Key(arg), set, fmt.Sprintf("conflicts with %s %q; set %s instead", valuePath, value, valuePath))}
+}
@@ -0,0 +1,641 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestValidateExtraArgs(t *testing.T) {
+	tests := []struct {
+		name           string
+		spec           KubeadmConfigSpec
+		expectedFields []string
+	}{
+		{
+			name: "no cluster configuration",
+		},
+		{
+			name: "matching values",
+			spec: KubeadmConfigSpec{
+				ClusterConfiguration: &v1beta1.ClusterConfiguration{
+					Networking: v1beta1.Networking{ServiceSubnet: "10.96.0.0/12", PodSubnet: "192.168.0.0/16"},
+					APIServer: v1beta1.APIServer{
+						ControlPlaneComponent: v1beta1.ControlPlaneComponent{ExtraArgs: map[string]string{"service-cluster-ip-range": "10.96.0.0/12", "secure-port": "6443"}},
+					},
+					ControllerManager: v1beta1.ControlPlaneComponent{ExtraArgs: map[string]string{"cluster-cidr": "192.168.0.0/16"}},
+				},
+				InitConfiguration: &v1beta1.InitConfiguration{
+					LocalAPIEndpoint: v1beta1.APIEndpoint{BindPort: 6443},
+				},
+			},
+		},
+		{
+			name: "conflicting values",
+			spec: KubeadmConfigSpec{
+				ClusterConfiguration: &v1beta1.ClusterConfiguration{
+					Networking: v1beta1.Networking{ServiceSubnet: "10.96.0.0/12", PodSubnet: "192.168.0.0/16"},
+					APIServer: v1beta1.APIServer{
+						ControlPlaneComponent: v1beta1.ControlPlaneComponent{ExtraArgs: map[string]string{"service-cluster-ip-range": "10.0.0.0/16", "advertise-address": "10.0.0.2"}},
+					},
+					ControllerManager: v1beta1.ControlPlaneComponent{ExtraArgs: map[string]string{"cluster-cidr": "10.244.0.0/16"}},
+					Scheduler:         v1beta1.ControlPlaneComponent{ExtraArgs: map[string]string{"kubeconfig": "/root/scheduler.conf"}},
+				},
+				JoinConfiguration: &v1beta1.JoinConfiguration{
+					ControlPlane: &v1beta1.JoinControlPlane{
+						LocalAPIEndpoint: v1beta1.APIEndpoint{AdvertiseAddress: "10.0.0.1"},
+					},
+				},
+			},
+			expectedFields: []string{
+				"spec.clusterConfiguration.apiServer.extraArgs[service-cluster-ip-range]",
+				"spec.clusterConfiguration.controllerManager.extraArgs[cluster-cidr]",
+				"spec.clusterConfiguration.scheduler.extraArgs[kubeconfig]",
+				"spec.clusterConfiguration.apiServer.extraArgs[advertise-address]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: tt.spec}
+			errs := ValidateExtraArgs(&config.Spec, field.NewPath("spec"))
+			if len(errs) != len(tt.expectedFields) {
+				t.Fatalf("expected %d errors, got %v", len(tt.expectedFields), errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.expectedFields[i] {
+					t.Errorf("expected error on %s, got %v", tt.expectedFields[i], err)
+				}
+			}
+			if err := config.ValidateCreate(); (err != nil) != (len(tt.expectedFields) > 0) {
+				t.Errorf("expected create validation to fail: %v, got %v", len(tt.expectedFields) > 0, err)
+			}
+		})
+	}
+}
+
+func TestValidateExternalEtcd(t *testing.T) {
+	tests := []struct {
+		name           string
+		external       *v1beta1.ExternalEtcd
+		expectedFields []string
+	}{
+		{
+			name: "stacked etcd",
+		},
+		{
+			name: "TLS",
+			external: &v1beta1.ExternalEtcd{
+				Endpoints: []string{"https://etcd-0.example.com:2379", "https://10.0.0.1:2379"},
+				CAFile:    "/etc/kubernetes/pki/etcd/ca.crt",
+				CertFile:  "/etc/kubernetes/pki/apiserver-etcd-client.crt",
+				KeyFile:   "/etc/kubernetes/pki/apiserver-etcd-client.key",
+			},
+		},
+		{
+			name:     "plain http",
+			external: &v1beta1.ExternalEtcd{Endpoints: []string{"http://10.0.0.1:2379"}},
+		},
+		{
+			name: "incomplete TLS settings",
+			external: &v1beta1.ExternalEtcd{
+				Endpoints: []string{"http://10.0.0.1:2379", "10.0.0.2:2379"},
+				CAFile:    "/etc/kubernetes/pki/etcd/ca.crt",
+			},
+			expectedFields: []string{
+				"spec.clusterConfiguration.etcd.external.certFile",
+				"spec.clusterConfiguration.etcd.external.keyFile",
+				"spec.clusterConfiguration.etcd.external.endpoints[0]",
+				"spec.clusterConfiguration.etcd.external.endpoints[1]",
+			},
+		},
+		{
+			name:           "no endpoints",
+			external:       &v1beta1.ExternalEtcd{},
+			expectedFields: []string{"spec.clusterConfiguration.etcd.external.endpoints"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: KubeadmConfigSpec{
+				ClusterConfiguration: &v1beta1.ClusterConfiguration{Etcd: v1beta1.Etcd{External: tt.external}},
+			}}
+			errs := ValidateExternalEtcd(&config.Spec, field.NewPath("spec"))
+			if len(errs) != len(tt.expectedFields) {
+				t.Fatalf("expected %d errors, got %v", len(tt.expectedFields), errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.expectedFields[i] {
+					t.Errorf("expected error on %s, got %v", tt.expectedFields[i], err)
+				}
+			}
+			if err := config.ValidateCreate(); (err != nil) != (len(tt.expectedFields) > 0) {
+				t.Errorf("expected create validation to fail: %v, got %v", len(tt.expectedFields) > 0, err)
+			}
+		})
+	}
+}
+
+func TestValidateFiles(t *testing.T) {
+	tests := []struct {
+		name           string
+		files          []File
+		expectedFields []string
+	}{
+		{
+			name: "valid files",
+			files: []File{
+				{Path: "/etc/file", Owner: "root:root", Permissions: "0640"},
+				{Path: "/home/capi/.config/file", Owner: "1000:1000", Permissions: "600", DirectoryPermissions: "0700", Defer: true},
+				{Path: "/etc/other", Owner: "nobody"},
+			},
+		},
+		{
+			name: "invalid owner and permissions",
+			files: []File{
+				{Path: "/etc/file", Owner: "root:root:root", Permissions: "rw-r-----"},
+				{Path: "/etc/other", Owner: ":root", DirectoryPermissions: "0799"},
+			},
+			expectedFields: []string{
+				"spec.files[0].owner",
+				"spec.files[0].permissions",
+				"spec.files[1].owner",
+				"spec.files[1].directoryPermissions",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: KubeadmConfigSpec{Files: tt.files}}
+			errs := ValidateFiles(&config.Spec, field.NewPath("spec"))
+			if len(errs) != len(tt.expectedFields) {
+				t.Fatalf("expected %d errors, got %v", len(tt.expectedFields), errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.expectedFields[i] {
+					t.Errorf("expected error on %s, got %v", tt.expectedFields[i], err)
+				}
+			}
+			if err := config.ValidateCreate(); (err != nil) != (len(tt.expectedFields) > 0) {
+				t.Errorf("expected create validation to fail: %v, got %v", len(tt.expectedFields) > 0, err)
+			}
+		})
+	}
+}
+
+func TestValidateNodeGroup(t *testing.T) {
+	tests := []struct {
+		name           string
+		spec           KubeadmConfigSpec
+		expectedFields []string
+	}{
+		{
+			name: "valid node group",
+			spec: KubeadmConfigSpec{NodeGroup: &NodeGroupLabels{Role: "worker", Name: "md-0"}},
+		},
+		{
+			name: "invalid role and name",
+			spec: KubeadmConfigSpec{NodeGroup: &NodeGroupLabels{Role: "worker/gpu", Name: "md 0"}},
+			expectedFields: []string{
+				"spec.nodeGroup.role",
+				"spec.nodeGroup.name",
+			},
+		},
+		{
+			name: "control plane join",
+			spec: KubeadmConfigSpec{
+				NodeGroup:         &NodeGroupLabels{Name: "md-0"},
+				JoinConfiguration: &v1beta1.JoinConfiguration{ControlPlane: &v1beta1.JoinControlPlane{}},
+			},
+			expectedFields: []string{"spec.nodeGroup"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: tt.spec}
+			errs := ValidateNodeGroup(&config.Spec, field.NewPath("spec"))
+			if len(errs) != len(tt.expectedFields) {
+				t.Fatalf("expected %d errors, got %v", len(tt.expectedFields), errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.expectedFields[i] {
+					t.Errorf("expected error on %s, got %v", tt.expectedFields[i], err)
+				}
+			}
+			if err := config.ValidateCreate(); (err != nil) != (len(tt.expectedFields) > 0) {
+				t.Errorf("expected create validation to fail: %v, got %v", len(tt.expectedFields) > 0, err)
+			}
+		})
+	}
+}
+
+func TestValidateCNI(t *testing.T) {
+	tests := []struct {
+		name      string
+		cni       *CNI
+		expectErr bool
+	}{
+		{
+			name: "no CNI",
+		},
+		{
+			name: "bundled plugin",
+			cni:  &CNI{Plugin: CalicoCNIPlugin},
+		},
+		{
+			name: "manifest",
+			cni:  &CNI{ManifestFrom: &ConfigMapKeyReference{Name: "cni", Key: "manifest.yaml"}},
+		},
+		{
+			name:      "plugin and manifest",
+			cni:       &CNI{Plugin: CalicoCNIPlugin, ManifestFrom: &ConfigMapKeyReference{Name: "cni", Key: "manifest.yaml"}},
+			expectErr: true,
+		},
+		{
+			name:      "neither plugin nor manifest",
+			cni:       &CNI{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: KubeadmConfigSpec{CNI: tt.cni}}
+			if errs := ValidateCNI(&config.Spec, field.NewPath("spec")); (len(errs) > 0) != tt.expectErr {
+				t.Errorf("expected errors: %v, got %v", tt.expectErr, errs)
+			}
+			if err := config.ValidateCreate(); (err != nil) != tt.expectErr {
+				t.Errorf("expected create validation to fail: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateCredentialProviders(t *testing.T) {
+	config := `apiVersion: kubelet.config.k8s.io/v1alpha1
+kind: CredentialProviderConfig
+providers:
+- name: ecr-credential-provider
+  matchImages: ["*.dkr.ecr.*.amazonaws.com"]
+  defaultCacheDuration: 12h
+  apiVersion: credentialprovider.kubelet.k8s.io/v1alpha1
+`
+	tests := []struct {
+		name                string
+		credentialProviders *KubeletCredentialProviders
+		kubeletExtraArgs    map[string]string
+		expectErr           bool
+	}{
+		{
+			name: "no credential providers",
+		},
+		{
+			name:                "credential providers",
+			credentialProviders: &KubeletCredentialProviders{Config: config, BinDir: "/opt/credential-providers"},
+		},
+		{
+			name:                "not a credential provider config",
+			credentialProviders: &KubeletCredentialProviders{Config: "apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\n", BinDir: "/opt/credential-providers"},
+			expectErr:           true,
+		},
+		{
+			name:                "relative binary directory",
+			credentialProviders: &KubeletCredentialProviders{Config: config, BinDir: "credential-providers"},
+			expectErr:           true,
+		},
+		{
+			name:                "kubelet argument set by the user",
+			credentialProviders: &KubeletCredentialProviders{Config: config, BinDir: "/opt/credential-providers"},
+			kubeletExtraArgs:    map[string]string{"image-credential-provider-bin-dir": "/usr/local/bin"},
+			expectErr:           true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: KubeadmConfigSpec{
+				CredentialProviders: tt.credentialProviders,
+				JoinConfiguration: &v1beta1.JoinConfiguration{
+					NodeRegistration: v1beta1.NodeRegistrationOptions{KubeletExtraArgs: tt.kubeletExtraArgs},
+				},
+			}}
+			if errs := ValidateCredentialProviders(&config.Spec, field.NewPath("spec")); (len(errs) > 0) != tt.expectErr {
+				t.Errorf("expected errors: %v, got %v", tt.expectErr, errs)
+			}
+			if err := config.ValidateCreate(); (err != nil) != tt.expectErr {
+				t.Errorf("expected create validation to fail: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateDNS(t *testing.T) {
+	tests := []struct {
+		name             string
+		dns              *NodeDNS
+		kubeletExtraArgs map[string]string
+		expectErr        bool
+	}{
+		{
+			name: "no DNS",
+		},
+		{
+			name: "nameservers and search domains",
+			dns:  &NodeDNS{Nameservers: []string{"10.0.0.2", "fd00::2"}, SearchDomains: []string{"corp.example.com"}},
+		},
+		{
+			name: "systemd-resolved without nameservers",
+			dns:  &NodeDNS{Resolver: SystemdResolvedResolver},
+		},
+		{
+			name:      "resolv.conf without nameservers",
+			dns:       &NodeDNS{SearchDomains: []string{"corp.example.com"}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid nameserver",
+			dns:       &NodeDNS{Nameservers: []string{"dns.example.com"}},
+			expectErr: true,
+		},
+		{
+			name:      "too many nameservers",
+			dns:       &NodeDNS{Nameservers: []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}},
+			expectErr: true,
+		},
+		{
+			name:      "invalid search domain",
+			dns:       &NodeDNS{Nameservers: []string{"10.0.0.2"}, SearchDomains: []string{"corp example"}},
+			expectErr: true,
+		},
+		{
+			name:      "relative kubelet resolv.conf",
+			dns:       &NodeDNS{Resolver: SystemdResolvedResolver, KubeletResolvConf: "resolv.conf"},
+			expectErr: true,
+		},
+		{
+			name:             "kubelet argument set by the user",
+			dns:              &NodeDNS{Nameservers: []string{"10.0.0.2"}},
+			kubeletExtraArgs: map[string]string{"resolv-conf": "/etc/resolv.conf"},
+			expectErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: KubeadmConfigSpec{
+				DNS: tt.dns,
+				JoinConfiguration: &v1beta1.JoinConfiguration{
+					NodeRegistration: v1beta1.NodeRegistrationOptions{KubeletExtraArgs: tt.kubeletExtraArgs},
+				},
+			}}
+			if errs := ValidateDNS(&config.Spec, field.NewPath("spec")); (len(errs) > 0) != tt.expectErr {
+				t.Errorf("expected errors: %v, got %v", tt.expectErr, errs)
+			}
+			if err := config.ValidateCreate(); (err != nil) != tt.expectErr {
+				t.Errorf("expected create validation to fail: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidatePrerequisites(t *testing.T) {
+	tests := []struct {
+		name          string
+		prerequisites []Prerequisite
+		expectErr     bool
+	}{
+		{
+			name: "no prerequisites",
+		},
+		{
+			name:          "prerequisites",
+			prerequisites: []Prerequisite{{Name: "nvidia-driver", Parameters: map[string]string{"version": "535"}}, {Name: "containerd-nvidia-runtime"}},
+		},
+		{
+			name:          "unnamed prerequisite",
+			prerequisites: []Prerequisite{{Parameters: map[string]string{"version": "535"}}},
+			expectErr:     true,
+		},
+		{
+			name:          "duplicate prerequisite",
+			prerequisites: []Prerequisite{{Name: "nvidia-driver"}, {Name: "nvidia-driver"}},
+			expectErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: KubeadmConfigSpec{Prerequisites: tt.prerequisites}}
+			if errs := ValidatePrerequisites(&config.Spec, field.NewPath("spec")); (len(errs) > 0) != tt.expectErr {
+				t.Errorf("expected errors: %v, got %v", tt.expectErr, errs)
+			}
+			if err := config.ValidateCreate(); (err != nil) != tt.expectErr {
+				t.Errorf("expected create validation to fail: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateAddons(t *testing.T) {
+	tests := []struct {
+		name             string
+		addons           *AddonPrerequisites
+		kubeletExtraArgs map[string]string
+		expectErr        bool
+	}{
+		{
+			name: "no addons",
+		},
+		{
+			name:   "default local IP",
+			addons: &AddonPrerequisites{NodeLocalDNS: &NodeLocalDNSPrerequisites{}},
+		},
+		{
+			name:   "IPv6 local IP",
+			addons: &AddonPrerequisites{NodeLocalDNS: &NodeLocalDNSPrerequisites{LocalIP: "fd00::10"}},
+		},
+		{
+			name:      "invalid local IP",
+			addons:    &AddonPrerequisites{NodeLocalDNS: &NodeLocalDNSPrerequisites{LocalIP: "node-local-dns"}},
+			expectErr: true,
+		},
+		{
+			name:             "kubelet argument set by the user",
+			addons:           &AddonPrerequisites{NodeLocalDNS: &NodeLocalDNSPrerequisites{}},
+			kubeletExtraArgs: map[string]string{"cluster-dns": "10.96.0.10"},
+			expectErr:        true,
+		},
+		{
+			name:             "kubelet argument without NodeLocal DNSCache",
+			addons:           &AddonPrerequisites{KubeProxyIPVS: true},
+			kubeletExtraArgs: map[string]string{"cluster-dns": "10.96.0.10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: KubeadmConfigSpec{
+				Addons: tt.addons,
+				JoinConfiguration: &v1beta1.JoinConfiguration{
+					NodeRegistration: v1beta1.NodeRegistrationOptions{KubeletExtraArgs: tt.kubeletExtraArgs},
+				},
+			}}
+			if errs := ValidateAddons(&config.Spec, field.NewPath("spec")); (len(errs) > 0) != tt.expectErr {
+				t.Errorf("expected errors: %v, got %v", tt.expectErr, errs)
+			}
+			if err := config.ValidateCreate(); (err != nil) != tt.expectErr {
+				t.Errorf("expected create validation to fail: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateKubeletServingCertificate(t *testing.T) {
+	tests := []struct {
+		name             string
+		serving          *KubeletServingCertificate
+		kubeletExtraArgs map[string]string
+		expectErr        bool
+	}{
+		{
+			name:             "no serving certificate bootstrap",
+			kubeletExtraArgs: map[string]string{"rotate-server-certificates": "true"},
+		},
+		{
+			name:    "serving certificate bootstrap with an approver",
+			serving: &KubeletServingCertificate{ApproverManifestFrom: &ConfigMapKeyReference{Name: "approver", Key: "manifest.yaml"}},
+		},
+		{
+			name:             "kubelet argument set by the user",
+			serving:          &KubeletServingCertificate{},
+			kubeletExtraArgs: map[string]string{"rotate-server-certificates": "false"},
+			expectErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubeadmConfig{Spec: KubeadmConfigSpec{
+				KubeletServingCertificate: tt.serving,
+				JoinConfiguration: &v1beta1.JoinConfiguration{
+					NodeRegistration: v1beta1.NodeRegistrationOptions{KubeletExtraArgs: tt.kubeletExtraArgs},
+				},
+			}}
+			if errs := ValidateKubeletServingCertificate(&config.Spec, field.NewPath("spec")); (len(errs) > 0) != tt.expectErr {
+				t.Errorf("expected errors: %v, got %v", tt.expectErr, errs)
+			}
+			if err := config.ValidateCreate(); (err != nil) != tt.expectErr {
+				t.Errorf("expected create validation to fail: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateStrictDecoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		raw            string
+		specPath       []string
+		expectedFields []string
+	}{
+		{
+			name:     "known fields",
+			raw:      `{"spec":{"clusterConfiguration":{"apiServer":{"extraArgs":{"audit-log-path":"/var/log/audit.log"}}},"joinConfiguration":null}}`,
+			specPath: []string{"spec"},
+		},
+		{
+			name:     "no spec",
+			raw:      `{"metadata":{"name":"cfg"}}`,
+			specPath: []string{"spec"},
+		},
+		{
+			name:           "unknown fields",
+			raw:            `{"spec":{"clusterConfiguration":{"apiServer":{"extraArg":{"audit-log-path":"/var/log/audit.log"}}},"initConfiguration":{"nodeRegistration":{"kubeletExtraArgs":{}}},"joinConfiguration":{"nodeRegistraton":{}}}}`,
+			specPath:       []string{"spec"},
+			expectedFields: []string{"spec.clusterConfiguration", "spec.joinConfiguration"},
+		},
+		{
+			name:           "type mismatch in a template",
+			raw:            `{"spec":{"template":{"spec":{"joinConfiguration":{"caCertPath":1}}}}}`,
+			specPath:       []string{"spec", "template", "spec"},
+			expectedFields: []string{"spec.template.spec.joinConfiguration.caCertPath"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateStrictDecoding([]byte(tt.raw), field.NewPath(tt.specPath[0], tt.specPath[1:]...), tt.specPath...)
+			if len(errs) != len(tt.expectedFields) {
+				t.Fatalf("expected %d errors, got %v", len(tt.expectedFields), errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.expectedFields[i] {
+					t.Errorf("expected error on %s, got %v", tt.expectedFields[i], err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateStrictDecodingUpdate(t *testing.T) {
+	oldRaw := `{"spec":{"clusterConfiguration":{"apiServer":{"extraArg":{"audit-log-path":"/var/log/audit.log"}}},"joinConfiguration":{"nodeRegistration":{"taints":[{"key":"a","effect":"NoSchedule","valeu":"b"}]}}}}`
+	tests := []struct {
+		name           string
+		raw            string
+		expectedFields []string
+	}{
+		{
+			name: "unknown fields of the old object",
+			raw:  oldRaw,
+		},
+		{
+			name: "unknown fields removed",
+			raw:  `{"spec":{"clusterConfiguration":{"apiServer":{}}}}`,
+		},
+		{
+			name:           "new unknown fields next to existing ones",
+			raw:            `{"spec":{"clusterConfiguration":{"apiServer":{"extraArg":{"audit-log-path":"/var/log/audit.log"},"certSAN":["a"]}},"initConfiguration":{"nodeRegistraton":{"name":"a"}},"joinConfiguration":{"nodeRegistration":{"taints":[{"key":"a","effect":"NoSchedule","valeu":"b"},{"key":"c","effect":"NoSchedule","valeu":"d"}]}}}}`,
+			expectedFields: []string{"spec.clusterConfiguration.apiServer.certSAN", "spec.initConfiguration.nodeRegistraton", "spec.joinConfiguration.nodeRegistration.taints[1].valeu"},
+		},
+		{
+			name:           "type mismatch",
+			raw:            `{"spec":{"joinConfiguration":{"caCertPath":1}}}`,
+			expectedFields: []string{"spec.joinConfiguration.caCertPath"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateStrictDecodingUpdate([]byte(tt.raw), []byte(oldRaw), field.NewPath("spec"), "spec")
+			if len(errs) != len(tt.expectedFields) {
+				t.Fatalf("expected %d errors, got %v", len(tt.expectedFields), errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.expectedFields[i] {
+					t.Errorf("expected error on %s, got %v", tt.expectedFields[i], err)
+				}
+			}
+		})
+	}
+}
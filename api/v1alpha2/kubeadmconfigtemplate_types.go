@@ -45,7 +45,3 @@ type KubeadmConfigTemplateList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []KubeadmConfigTemplate `json:"items"`
 }
-
-func init() {
-	SchemeBuilder.Register(&KubeadmConfigTemplate{}, &KubeadmConfigTemplateList{})
-}
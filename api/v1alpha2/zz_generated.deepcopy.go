@@ -25,6 +25,208 @@ import (
 	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIServerEndpointDNS) DeepCopyInto(out *APIServerEndpointDNS) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIServerEndpointDNS.
+func (in *APIServerEndpointDNS) DeepCopy() *APIServerEndpointDNS {
+	if in == nil {
+		return nil
+	}
+	out := new(APIServerEndpointDNS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AddonPrerequisites) DeepCopyInto(out *AddonPrerequisites) {
+	*out = *in
+	if in.NodeLocalDNS != nil {
+		in, out := &in.NodeLocalDNS, &out.NodeLocalDNS
+		*out = new(NodeLocalDNSPrerequisites)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AddonPrerequisites.
+func (in *AddonPrerequisites) DeepCopy() *AddonPrerequisites {
+	if in == nil {
+		return nil
+	}
+	out := new(AddonPrerequisites)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BootstrapDiagnostics) DeepCopyInto(out *BootstrapDiagnostics) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BootstrapDiagnostics.
+func (in *BootstrapDiagnostics) DeepCopy() *BootstrapDiagnostics {
+	if in == nil {
+		return nil
+	}
+	out := new(BootstrapDiagnostics)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BootstrapResource) DeepCopyInto(out *BootstrapResource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BootstrapResource.
+func (in *BootstrapResource) DeepCopy() *BootstrapResource {
+	if in == nil {
+		return nil
+	}
+	out := new(BootstrapResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNI) DeepCopyInto(out *CNI) {
+	*out = *in
+	if in.ManifestFrom != nil {
+		in, out := &in.ManifestFrom, &out.ManifestFrom
+		*out = new(ConfigMapKeyReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNI.
+func (in *CNI) DeepCopy() *CNI {
+	if in == nil {
+		return nil
+	}
+	out := new(CNI)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificatesPolicy) DeepCopyInto(out *CertificatesPolicy) {
+	*out = *in
+	if in.CAExpiryDays != nil {
+		in, out := &in.CAExpiryDays, &out.CAExpiryDays
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ExpiryDays != nil {
+		in, out := &in.ExpiryDays, &out.ExpiryDays
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RenewBeforeDays != nil {
+		in, out := &in.RenewBeforeDays, &out.RenewBeforeDays
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificatesPolicy.
+func (in *CertificatesPolicy) DeepCopy() *CertificatesPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificatesPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigMapKeyReference) DeepCopyInto(out *ConfigMapKeyReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapKeyReference.
+func (in *ConfigMapKeyReference) DeepCopy() *ConfigMapKeyReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigMapKeyReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControlPlaneNodePolicy) DeepCopyInto(out *ControlPlaneNodePolicy) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControlPlaneNodePolicy.
+func (in *ControlPlaneNodePolicy) DeepCopy() *ControlPlaneNodePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ControlPlaneNodePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControlPlaneVIP) DeepCopyInto(out *ControlPlaneVIP) {
+	*out = *in
+	if in.CredentialsFrom != nil {
+		in, out := &in.CredentialsFrom, &out.CredentialsFrom
+		*out = new(SecretKeyReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControlPlaneVIP.
+func (in *ControlPlaneVIP) DeepCopy() *ControlPlaneVIP {
+	if in == nil {
+		return nil
+	}
+	out := new(ControlPlaneVIP)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiscoveryPolicy) DeepCopyInto(out *DiscoveryPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscoveryPolicy.
+func (in *DiscoveryPolicy) DeepCopy() *DiscoveryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DiscoveryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailureDomainPropagation) DeepCopyInto(out *FailureDomainPropagation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureDomainPropagation.
+func (in *FailureDomainPropagation) DeepCopy() *FailureDomainPropagation {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureDomainPropagation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *File) DeepCopyInto(out *File) {
 	*out = *in
@@ -40,6 +242,21 @@ func (in *File) DeepCopy() *File {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FormatOptions) DeepCopyInto(out *FormatOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FormatOptions.
+func (in *FormatOptions) DeepCopy() *FormatOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(FormatOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeadmConfig) DeepCopyInto(out *KubeadmConfig) {
 	*out = *in
@@ -67,6 +284,23 @@ func (in *KubeadmConfig) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeadmConfigCondition) DeepCopyInto(out *KubeadmConfigCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeadmConfigCondition.
+func (in *KubeadmConfigCondition) DeepCopy() *KubeadmConfigCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeadmConfigCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeadmConfigList) DeepCopyInto(out *KubeadmConfigList) {
 	*out = *in
@@ -122,6 +356,23 @@ func (in *KubeadmConfigSpec) DeepCopyInto(out *KubeadmConfigSpec) {
 		*out = make([]File, len(*in))
 		copy(*out, *in)
 	}
+	if in.StaticPodManifests != nil {
+		in, out := &in.StaticPodManifests, &out.StaticPodManifests
+		*out = make([]StaticPodManifest, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ControlPlaneVIP != nil {
+		in, out := &in.ControlPlaneVIP, &out.ControlPlaneVIP
+		*out = new(ControlPlaneVIP)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.APIServerEndpointDNS != nil {
+		in, out := &in.APIServerEndpointDNS, &out.APIServerEndpointDNS
+		*out = new(APIServerEndpointDNS)
+		**out = **in
+	}
 	if in.PreKubeadmCommands != nil {
 		in, out := &in.PreKubeadmCommands, &out.PreKubeadmCommands
 		*out = make([]string, len(*in))
@@ -144,6 +395,152 @@ func (in *KubeadmConfigSpec) DeepCopyInto(out *KubeadmConfigSpec) {
 		*out = new(NTP)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.FormatOptions != nil {
+		in, out := &in.FormatOptions, &out.FormatOptions
+		*out = new(FormatOptions)
+		**out = **in
+	}
+	if in.Discovery != nil {
+		in, out := &in.Discovery, &out.Discovery
+		*out = new(DiscoveryPolicy)
+		**out = **in
+	}
+	if in.RegistryMirrors != nil {
+		in, out := &in.RegistryMirrors, &out.RegistryMirrors
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.NodeName != nil {
+		in, out := &in.NodeName, &out.NodeName
+		*out = new(NodeName)
+		**out = **in
+	}
+	if in.PrePlacedEtcdCertificates != nil {
+		in, out := &in.PrePlacedEtcdCertificates, &out.PrePlacedEtcdCertificates
+		*out = make([]EtcdCertificateName, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalTrustBundles != nil {
+		in, out := &in.AdditionalTrustBundles, &out.AdditionalTrustBundles
+		*out = make([]TrustBundle, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AdditionalKubeadmConfigDocuments != nil {
+		in, out := &in.AdditionalKubeadmConfigDocuments, &out.AdditionalKubeadmConfigDocuments
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeIP != nil {
+		in, out := &in.NodeIP, &out.NodeIP
+		*out = new(NodeIPDetection)
+		**out = **in
+	}
+	if in.SELinux != nil {
+		in, out := &in.SELinux, &out.SELinux
+		*out = new(SELinux)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SystemdUnits != nil {
+		in, out := &in.SystemdUnits, &out.SystemdUnits
+		*out = make([]SystemdUnit, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Diagnostics != nil {
+		in, out := &in.Diagnostics, &out.Diagnostics
+		*out = new(BootstrapDiagnostics)
+		**out = **in
+	}
+	if in.ControlPlaneNodes != nil {
+		in, out := &in.ControlPlaneNodes, &out.ControlPlaneNodes
+		*out = new(ControlPlaneNodePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Certificates != nil {
+		in, out := &in.Certificates, &out.Certificates
+		*out = new(CertificatesPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SSH != nil {
+		in, out := &in.SSH, &out.SSH
+		*out = new(SSHCertificates)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FailureDomain != nil {
+		in, out := &in.FailureDomain, &out.FailureDomain
+		*out = new(FailureDomainPropagation)
+		**out = **in
+	}
+	if in.NodeGroup != nil {
+		in, out := &in.NodeGroup, &out.NodeGroup
+		*out = new(NodeGroupLabels)
+		**out = **in
+	}
+	if in.BootstrapResources != nil {
+		in, out := &in.BootstrapResources, &out.BootstrapResources
+		*out = make([]BootstrapResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.CNI != nil {
+		in, out := &in.CNI, &out.CNI
+		*out = new(CNI)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TokenPool != nil {
+		in, out := &in.TokenPool, &out.TokenPool
+		*out = new(TokenPoolPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialProviders != nil {
+		in, out := &in.CredentialProviders, &out.CredentialProviders
+		*out = new(KubeletCredentialProviders)
+		**out = **in
+	}
+	if in.Templates != nil {
+		in, out := &in.Templates, &out.Templates
+		*out = new(TemplatesPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(NodeDNS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Prerequisites != nil {
+		in, out := &in.Prerequisites, &out.Prerequisites
+		*out = make([]Prerequisite, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NodeAgent != nil {
+		in, out := &in.NodeAgent, &out.NodeAgent
+		*out = new(NodeAgent)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Addons != nil {
+		in, out := &in.Addons, &out.Addons
+		*out = new(AddonPrerequisites)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KubeletServingCertificate != nil {
+		in, out := &in.KubeletServingCertificate, &out.KubeletServingCertificate
+		*out = new(KubeletServingCertificate)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeadmConfigSpec.
@@ -159,11 +556,27 @@ func (in *KubeadmConfigSpec) DeepCopy() *KubeadmConfigSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubeadmConfigStatus) DeepCopyInto(out *KubeadmConfigStatus) {
 	*out = *in
+	if in.ReadyTime != nil {
+		in, out := &in.ReadyTime, &out.ReadyTime
+		*out = (*in).DeepCopy()
+	}
+	if in.DataSecretName != nil {
+		in, out := &in.DataSecretName, &out.DataSecretName
+		*out = new(string)
+		**out = **in
+	}
 	if in.BootstrapData != nil {
 		in, out := &in.BootstrapData, &out.BootstrapData
 		*out = make([]byte, len(*in))
 		copy(*out, *in)
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]KubeadmConfigCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeadmConfigStatus.
@@ -266,6 +679,41 @@ func (in *KubeadmConfigTemplateSpec) DeepCopy() *KubeadmConfigTemplateSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeletCredentialProviders) DeepCopyInto(out *KubeletCredentialProviders) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeletCredentialProviders.
+func (in *KubeletCredentialProviders) DeepCopy() *KubeletCredentialProviders {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeletCredentialProviders)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeletServingCertificate) DeepCopyInto(out *KubeletServingCertificate) {
+	*out = *in
+	if in.ApproverManifestFrom != nil {
+		in, out := &in.ApproverManifestFrom, &out.ApproverManifestFrom
+		*out = new(ConfigMapKeyReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeletServingCertificate.
+func (in *KubeletServingCertificate) DeepCopy() *KubeletServingCertificate {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeletServingCertificate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NTP) DeepCopyInto(out *NTP) {
 	*out = *in
@@ -291,6 +739,308 @@ func (in *NTP) DeepCopy() *NTP {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeAgent) DeepCopyInto(out *NodeAgent) {
+	*out = *in
+	if in.Files != nil {
+		in, out := &in.Files, &out.Files
+		*out = make([]File, len(*in))
+		copy(*out, *in)
+	}
+	if in.Commands != nil {
+		in, out := &in.Commands, &out.Commands
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeAgent.
+func (in *NodeAgent) DeepCopy() *NodeAgent {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeAgent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeDNS) DeepCopyInto(out *NodeDNS) {
+	*out = *in
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SearchDomains != nil {
+		in, out := &in.SearchDomains, &out.SearchDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeDNS.
+func (in *NodeDNS) DeepCopy() *NodeDNS {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeDNS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeGroupLabels) DeepCopyInto(out *NodeGroupLabels) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeGroupLabels.
+func (in *NodeGroupLabels) DeepCopy() *NodeGroupLabels {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeGroupLabels)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeIPDetection) DeepCopyInto(out *NodeIPDetection) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeIPDetection.
+func (in *NodeIPDetection) DeepCopy() *NodeIPDetection {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeIPDetection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeLocalDNSPrerequisites) DeepCopyInto(out *NodeLocalDNSPrerequisites) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeLocalDNSPrerequisites.
+func (in *NodeLocalDNSPrerequisites) DeepCopy() *NodeLocalDNSPrerequisites {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeLocalDNSPrerequisites)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeName) DeepCopyInto(out *NodeName) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeName.
+func (in *NodeName) DeepCopy() *NodeName {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeName)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Prerequisite) DeepCopyInto(out *Prerequisite) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Prerequisite.
+func (in *Prerequisite) DeepCopy() *Prerequisite {
+	if in == nil {
+		return nil
+	}
+	out := new(Prerequisite)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SELinux) DeepCopyInto(out *SELinux) {
+	*out = *in
+	if in.RelabelPaths != nil {
+		in, out := &in.RelabelPaths, &out.RelabelPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SELinux.
+func (in *SELinux) DeepCopy() *SELinux {
+	if in == nil {
+		return nil
+	}
+	out := new(SELinux)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHCertificates) DeepCopyInto(out *SSHCertificates) {
+	*out = *in
+	if in.HostPrincipals != nil {
+		in, out := &in.HostPrincipals, &out.HostPrincipals
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHCertificates.
+func (in *SSHCertificates) DeepCopy() *SSHCertificates {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHCertificates)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyReference) DeepCopyInto(out *SecretKeyReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyReference.
+func (in *SecretKeyReference) DeepCopy() *SecretKeyReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticPodManifest) DeepCopyInto(out *StaticPodManifest) {
+	*out = *in
+	if in.ContentFrom != nil {
+		in, out := &in.ContentFrom, &out.ContentFrom
+		*out = new(SecretKeyReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticPodManifest.
+func (in *StaticPodManifest) DeepCopy() *StaticPodManifest {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticPodManifest)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SystemdDropIn) DeepCopyInto(out *SystemdDropIn) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SystemdDropIn.
+func (in *SystemdDropIn) DeepCopy() *SystemdDropIn {
+	if in == nil {
+		return nil
+	}
+	out := new(SystemdDropIn)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SystemdUnit) DeepCopyInto(out *SystemdUnit) {
+	*out = *in
+	if in.DropIns != nil {
+		in, out := &in.DropIns, &out.DropIns
+		*out = make([]SystemdDropIn, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SystemdUnit.
+func (in *SystemdUnit) DeepCopy() *SystemdUnit {
+	if in == nil {
+		return nil
+	}
+	out := new(SystemdUnit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplatesPolicy) DeepCopyInto(out *TemplatesPolicy) {
+	*out = *in
+	if in.ConfigMaps != nil {
+		in, out := &in.ConfigMaps, &out.ConfigMaps
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplatesPolicy.
+func (in *TemplatesPolicy) DeepCopy() *TemplatesPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplatesPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenPoolPolicy) DeepCopyInto(out *TokenPoolPolicy) {
+	*out = *in
+	if in.TTLMinutes != nil {
+		in, out := &in.TTLMinutes, &out.TTLMinutes
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenPoolPolicy.
+func (in *TokenPoolPolicy) DeepCopy() *TokenPoolPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenPoolPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrustBundle) DeepCopyInto(out *TrustBundle) {
+	*out = *in
+	if in.ContentFrom != nil {
+		in, out := &in.ContentFrom, &out.ContentFrom
+		*out = new(ConfigMapKeyReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrustBundle.
+func (in *TrustBundle) DeepCopy() *TrustBundle {
+	if in == nil {
+		return nil
+	}
+	out := new(TrustBundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *User) DeepCopyInto(out *User) {
 	*out = *in
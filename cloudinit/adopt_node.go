@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// AdoptionBackupDir is the directory the kubelet credentials of an adopted node are moved to.
+	AdoptionBackupDir = "/var/lib/cabpk/adoption-backup"
+
+	// adoptNodeHeredocMarker ends the files written by the adoption script.
+	adoptNodeHeredocMarker = "CABPK_EOF"
+
+	// adoptNodeScript replaces the kubelet credentials of a running node with a bootstrap kubeconfig, and restarts the
+	// kubelet for it to register again through the TLS bootstrap. The kubelet must be started with the
+	// --bootstrap-kubeconfig and --kubeconfig flags set by kubeadm.
+	adoptNodeScript = `#!/bin/sh
+set -e
+{{- if .IdempotentCommands }}
+` + skipIfBootstrappedCommand + `
+{{- end }}
+{{- range .PreKubeadmCommands }}
+{{ . }}
+{{- end }}
+if [ ! -f ` + SentinelFile + ` ]; then
+  systemctl stop kubelet
+  mkdir -p ` + AdoptionBackupDir + `
+  for f in /etc/kubernetes/kubelet.conf /etc/kubernetes/bootstrap-kubelet.conf /etc/kubernetes/pki/ca.crt /var/lib/kubelet/pki/kubelet-client-current.pem; do
+    if [ -e "$f" ]; then
+      mv "$f" ` + AdoptionBackupDir + `/
+    fi
+  done
+  mkdir -p /etc/kubernetes/pki
+  cat > /etc/kubernetes/pki/ca.crt <<'` + adoptNodeHeredocMarker + `'
+{{ .CACert }}` + adoptNodeHeredocMarker + `
+  (umask 077 && cat > /etc/kubernetes/bootstrap-kubelet.conf <<'` + adoptNodeHeredocMarker + `'
+{{ .BootstrapKubeconfig }}` + adoptNodeHeredocMarker + `
+  )
+  systemctl start kubelet
+  i=0
+  while [ ! -f /etc/kubernetes/kubelet.conf ]; do
+    i=$((i+1))
+    if [ "$i" -gt 60 ]; then
+      echo "the kubelet did not complete the TLS bootstrap" >&2
+      exit 1
+    fi
+    sleep 5
+  done
+  mkdir -p /var/lib/cabpk && touch ` + SentinelFile + `
+fi
+{{- range .PostKubeadmCommands }}
+{{ . }}
+{{- end }}
+`
+)
+
+var adoptNodeScriptTemplate = template.Must(template.New("AdoptNodeScript").Parse(adoptNodeScript))
+
+// AdoptNodeInput defines the context to generate the adoption script of an existing node.
+type AdoptNodeInput struct {
+	PreKubeadmCommands  []string
+	PostKubeadmCommands []string
+	IdempotentCommands  bool
+
+	// CACert is the PEM encoded cluster CA.
+	CACert string
+	// BootstrapKubeconfig is the kubeconfig the kubelet performs the TLS bootstrap with.
+	BootstrapKubeconfig string
+}
+
+// NewAdoptNodeScript returns a shell script adopting an already running node instead of joining it with kubeadm:
+// its kubelet credentials are replaced with a bootstrap kubeconfig, then the kubelet is restarted to register
+// again with a fresh client certificate. The script is meant to be run on the node out of band, e.g. when
+// bringing nodes of a manually built cluster under Cluster API management. The replaced credentials are kept in
+// AdoptionBackupDir.
+func NewAdoptNodeScript(input *AdoptNodeInput) ([]byte, error) {
+	if input.CACert == "" || input.BootstrapKubeconfig == "" {
+		return nil, errors.New("node adoption script requires the cluster CA and a bootstrap kubeconfig")
+	}
+
+	data := *input
+	for _, content := range []*string{&data.CACert, &data.BootstrapKubeconfig} {
+		if strings.Contains(*content, adoptNodeHeredocMarker) {
+			return nil, errors.Errorf("node adoption script files must not contain %q", adoptNodeHeredocMarker)
+		}
+		if !strings.HasSuffix(*content, "\n") {
+			*content += "\n"
+		}
+	}
+
+	var out bytes.Buffer
+	if err := adoptNodeScriptTemplate.Execute(&out, data); err != nil {
+		return nil, errors.Wrap(err, "failed to generate node adoption script")
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"testing"
+
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func BenchmarkNewInitControlPlane(b *testing.B) {
+	certificates := goldenCertificates(cluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{}))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewInitControlPlane(&ControlPlaneInput{
+			BaseUserData:         goldenBaseUserData(),
+			Certificates:         certificates,
+			ClusterConfiguration: "kind: ClusterConfiguration",
+			InitConfiguration:    "kind: InitConfiguration",
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewJoinControlPlane(b *testing.B) {
+	certificates := goldenCertificates(cluster.NewCertificatesForJoiningControlPlane())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewJoinControlPlane(&ControlPlaneJoinInput{
+			BaseUserData:      goldenBaseUserData(),
+			Certificates:      certificates,
+			JoinConfiguration: "kind: JoinConfiguration",
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewNode(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewNode(&NodeInput{
+			BaseUserData:      goldenBaseUserData(),
+			JoinConfiguration: "kind: JoinConfiguration",
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package cloudinit
 
 import (
 	"bytes"
+	"sync"
 	"text/template"
 
 	"github.com/pkg/errors"
@@ -27,6 +28,10 @@ import (
 const (
 	cloudConfigHeader = `## template: jinja
 #cloud-config
+`
+
+	// plainCloudConfigHeader is used by data sources requiring #cloud-config on the first line, without templating.
+	plainCloudConfigHeader = `#cloud-config
 `
 )
 
@@ -37,37 +42,110 @@ type BaseUserData struct {
 	PostKubeadmCommands []string
 	AdditionalFiles     []bootstrapv1.File
 	WriteFiles          []bootstrapv1.File
+	StaticPodManifests  []bootstrapv1.File
 	Users               []bootstrapv1.User
 	NTP                 *bootstrapv1.NTP
+	ResetBeforeJoin     bool
+	IdempotentCommands  bool
+	Hostname            string
+	FQDN                string
+
+	// BootCommands are run by cloud-init on every boot, before the files are written. They create the missing parent
+	// directories of the files with directory permissions.
+	BootCommands []string
+
+	// VerifySignature adds a boot command verifying the embedded signature of the user data with the public key baked
+	// in the machine image, and the runcmd script ends before the pre kubeadm commands if the key is missing or the
+	// signature is invalid.
+	VerifySignature bool
+
+	// AdditionalKubeadmConfigDocuments are appended, in order, to the kubeadm config file.
+	AdditionalKubeadmConfigDocuments []string
+	// DisableTemplating omits the jinja template header, for data sources requiring #cloud-config on the first line.
+	// Jinja expressions are then left as is.
+	DisableTemplating bool
+	// Windows renders the node user data for cloudbase-init on Windows machines, without templating.
+	Windows bool
 }
 
-func generate(kind string, tpl string, data interface{}) ([]byte, error) {
-	tm := template.New(kind).Funcs(defaultTemplateFuncMap)
-	if _, err := tm.Parse(filesTemplate); err != nil {
-		return nil, errors.Wrap(err, "failed to parse files template")
+// setHeader sets the cloud-config header, with jinja templating unless disabled.
+func (input *BaseUserData) setHeader() {
+	input.Header = cloudConfigHeader
+	if input.DisableTemplating || input.Windows {
+		input.Header = plainCloudConfigHeader
 	}
+}
 
-	if _, err := tm.Parse(commandsTemplate); err != nil {
-		return nil, errors.Wrap(err, "failed to parse commands template")
+// setBootCommands sets the boot commands from the files to be written, after the signature verifier if any.
+func (input *BaseUserData) setBootCommands() {
+	input.BootCommands = directoryCommands(input.WriteFiles)
+	if input.VerifySignature {
+		input.BootCommands = append([]string{verifySignatureCommand()}, input.BootCommands...)
 	}
+}
 
-	if _, err := tm.Parse(ntpTemplate); err != nil {
-		return nil, errors.Wrap(err, "failed to parse ntp template")
-	}
+// sharedTemplates are the templates shared by all the kinds of user data.
+var sharedTemplates = []struct {
+	name string
+	tpl  string
+}{
+	{"files", filesTemplate},
+	{"commands", commandsTemplate},
+	{"ntp", ntpTemplate},
+	{"users", usersTemplate},
+	{"hostname", hostnameTemplate},
+	{"bootcmd", bootCommandsTemplate},
+	{"sentinel", sentinelTemplate},
+	{"verifier", verifierTemplate},
+	{"kubeadm documents", kubeadmDocumentsTemplate},
+}
 
-	if _, err := tm.Parse(usersTemplate); err != nil {
-		return nil, errors.Wrap(err, "failed to parse users template")
+// bufferPool holds the buffers user data is rendered in, as user data with large files would otherwise grow
+// new buffers for every machine.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// newTemplate parses the template of a kind of user data along with the shared templates. It is called once per kind
+// when the package is initialized, as parsing templates for every machine is expensive; executing a parsed template
+// is safe for concurrent use.
+func newTemplate(kind string, tpl string) (*template.Template, error) {
+	tm := template.New(kind).Funcs(defaultTemplateFuncMap)
+	for _, shared := range sharedTemplates {
+		if _, err := tm.Parse(shared.tpl); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s template", shared.name)
+		}
 	}
 
 	t, err := tm.Parse(tpl)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to parse %s template", kind)
 	}
+	return t, nil
+}
+
+// mustNewTemplate is like newTemplate but panics if the templates cannot be parsed.
+func mustNewTemplate(kind string, tpl string) *template.Template {
+	return template.Must(newTemplate(kind, tpl))
+}
+
+func generate(t *template.Template, data interface{}) ([]byte, error) {
+	kind := t.Name()
+
+	out := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(out)
+	out.Reset()
 
-	var out bytes.Buffer
-	if err := t.Execute(&out, data); err != nil {
+	if err := t.Execute(out, data); err != nil {
 		return nil, errors.Wrapf(err, "failed to generate %s template", kind)
 	}
 
-	return out.Bytes(), nil
+	if err := validateCloudConfig(out.Bytes()); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s cloud-config", kind)
+	}
+
+	// the buffer is reused once returned to the pool
+	return append([]byte(nil), out.Bytes()...), nil
 }
@@ -18,6 +18,8 @@ package cloudinit
 
 import (
 	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	infrav1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
@@ -115,3 +117,330 @@ func TestNewInitControlPlaneCommands(t *testing.T) {
 		}
 	}
 }
+
+func TestNewNodeStaticPodManifests(t *testing.T) {
+	nodeinput := &NodeInput{
+		BaseUserData: BaseUserData{
+			StaticPodManifests: []infrav1.File{
+				{
+					Path:    "/etc/kubernetes/manifests/haproxy.yaml",
+					Content: "kind: Pod",
+				},
+			},
+		},
+		JoinConfiguration: "my-join-config",
+	}
+
+	out, err := NewNode(nodeinput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`-   path: /etc/kubernetes/manifests/haproxy.yaml
+    content: |
+      kind: Pod`,
+		`kubeadm join --config /tmp/kubeadm-node.yaml --ignore-preflight-errors=DirAvailable--etc-kubernetes-manifests`,
+	}
+	for _, f := range expected {
+		if !bytes.Contains(out, []byte(f)) {
+			t.Errorf("%s\ndid not contain\n%s", out, f)
+		}
+	}
+}
+
+func TestNewNodeResetBeforeJoin(t *testing.T) {
+	for _, reset := range []bool{true, false} {
+		nodeinput := &NodeInput{
+			BaseUserData: BaseUserData{
+				ResetBeforeJoin: reset,
+			},
+			JoinConfiguration: "my-join-config",
+		}
+
+		out, err := NewNode(nodeinput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(out, []byte("kubeadm reset -f")) != reset {
+			t.Errorf("expected reset command to be rendered: %v, got:\n%s", reset, out)
+		}
+		if reset && !bytes.Contains(out, []byte("bootcmd:\n  - 'cloud-init-per instance kubeadm-reset")) {
+			t.Errorf("expected reset command to run as a bootcmd once per instance, got:\n%s", out)
+		}
+	}
+}
+
+func TestNewNodeFileOwnershipAndDirectories(t *testing.T) {
+	nodeinput := &NodeInput{
+		BaseUserData: BaseUserData{
+			ResetBeforeJoin: true,
+			AdditionalFiles: []infrav1.File{
+				{Path: "/home/capi/.config/app/config", Owner: "1000:50", DirectoryPermissions: "0700", Defer: true, Content: "a"},
+				{Path: "/home/capi/.config/app/other", Owner: "capi:capi", DirectoryPermissions: "0700", Content: "b"},
+			},
+		},
+		JoinConfiguration: "my-join-config",
+	}
+
+	out, err := NewNode(nodeinput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`-   path: /home/capi/.config/app/config
+    owner: '1000:50'
+    defer: true
+    content: |`,
+		`-   path: /home/capi/.config/app/other
+    owner: capi:capi
+    content: |`,
+		"bootcmd:\n  - 'cloud-init-per instance kubeadm-reset",
+		"\n  - \"[ -d '/home/capi/.config/app' ] || mkdir -p -m '0700' '/home/capi/.config/app'\"\n",
+	}
+	for _, f := range expected {
+		if !bytes.Contains(out, []byte(f)) {
+			t.Errorf("%s\ndid not contain\n%s", out, f)
+		}
+	}
+	if n := bytes.Count(out, []byte("mkdir -p -m")); n != 1 {
+		t.Errorf("expected the directory to be created once, got %d commands:\n%s", n, out)
+	}
+}
+
+func TestNewNodeIdempotentCommands(t *testing.T) {
+	for _, idempotent := range []bool{true, false} {
+		nodeinput := &NodeInput{
+			BaseUserData: BaseUserData{
+				PreKubeadmCommands: []string{"echo pre-kubeadm"},
+				IdempotentCommands: idempotent,
+			},
+			JoinConfiguration: "my-join-config",
+		}
+
+		out, err := NewNode(nodeinput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		guarded := "  - 'test -f " + SentinelFile + " || { kubeadm join --config /tmp/kubeadm-node.yaml && mkdir -p /var/lib/cabpk && touch " + SentinelFile + "; }'"
+		if !bytes.Contains(out, []byte(guarded)) {
+			t.Errorf("%s\ndid not contain\n%s", out, guarded)
+		}
+		skip := "runcmd:\n  - '" + skipIfBootstrappedCommand + "'\n  - \"echo pre-kubeadm\""
+		if bytes.Contains(out, []byte(skip)) != idempotent {
+			t.Errorf("expected commands to be skipped on re-run: %v, got:\n%s", idempotent, out)
+		}
+	}
+}
+
+func TestNewNodeSignatureVerifier(t *testing.T) {
+	for _, verified := range []bool{true, false} {
+		nodeinput := &NodeInput{
+			BaseUserData: BaseUserData{
+				PreKubeadmCommands: []string{"echo pre-kubeadm"},
+				VerifySignature:    verified,
+			},
+			JoinConfiguration: "my-join-config",
+		}
+
+		out, err := NewNode(nodeinput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validateCloudConfig(out); err != nil {
+			t.Fatalf("expected valid cloud-config, got %v:\n%s", err, out)
+		}
+		skip := "runcmd:\n  - '" + skipIfUnverifiedCommand + "'\n  - \"echo pre-kubeadm\""
+		if bytes.Contains(out, []byte(skip)) != verified {
+			t.Errorf("expected commands to be skipped if the signature is invalid: %v, got:\n%s", verified, out)
+		}
+		if bytes.Contains(out, []byte("bootcmd:")) != verified || bytes.Contains(out, []byte("openssl dgst -sha256 -verify "+SigningPublicKeyFile)) != verified {
+			t.Errorf("expected a boot command verifying the signature: %v, got:\n%s", verified, out)
+		}
+		if bytes.Contains(out, []byte("> "+SigningPublicKeyFile)) {
+			t.Errorf("expected the public key not to be written from the user data, got:\n%s", out)
+		}
+		if verified && !bytes.Contains(out, []byte("test -f "+SigningPublicKeyFile+" && tail")) {
+			t.Errorf("expected the verification to fail without the public key of the machine image, got:\n%s", out)
+		}
+	}
+}
+
+func TestNewNodeDisableTemplating(t *testing.T) {
+	for _, disabled := range []bool{true, false} {
+		nodeinput := &NodeInput{
+			BaseUserData: BaseUserData{
+				DisableTemplating: disabled,
+			},
+			JoinConfiguration: "my-join-config",
+		}
+
+		out, err := NewNode(nodeinput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.HasPrefix(out, []byte("#cloud-config\n")) != disabled {
+			t.Errorf("expected #cloud-config on the first line: %v, got:\n%s", disabled, out)
+		}
+		if bytes.Contains(out, []byte("## template: jinja")) == disabled {
+			t.Errorf("expected jinja templating: %v, got:\n%s", !disabled, out)
+		}
+	}
+}
+
+func TestNewNodeWindows(t *testing.T) {
+	nodeinput := &NodeInput{
+		BaseUserData: BaseUserData{
+			Windows:            true,
+			PreKubeadmCommands: []string{"echo pre"},
+			IdempotentCommands: true,
+			Hostname:           "worker-0",
+		},
+		JoinConfiguration: "my-join-config",
+	}
+
+	out, err := NewNode(nodeinput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out, []byte("#cloud-config\n")) {
+		t.Errorf("expected #cloud-config on the first line, got:\n%s", out)
+	}
+	for _, expected := range []string{"path: C:\\k\\kubeadm-node.yaml\n", "  - \"echo pre\"\n  - 'kubeadm join --config C:\\k\\kubeadm-node.yaml'\n"} {
+		if !bytes.Contains(out, []byte(expected)) {
+			t.Errorf("%s\ndid not contain\n%s", out, expected)
+		}
+	}
+	for _, unexpected := range []string{SentinelFile, "hostname:", "/tmp/kubeadm-node.yaml"} {
+		if bytes.Contains(out, []byte(unexpected)) {
+			t.Errorf("expected no %q on Windows, got:\n%s", unexpected, out)
+		}
+	}
+}
+
+func TestNewNodeHostname(t *testing.T) {
+	nodeinput := &NodeInput{
+		BaseUserData: BaseUserData{
+			Hostname: "worker-0",
+			FQDN:     "worker-0.example.com",
+		},
+		JoinConfiguration: "my-join-config",
+	}
+
+	out, err := NewNode(nodeinput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "preserve_hostname: false\nhostname: worker-0\nfqdn: worker-0.example.com\nmanage_etc_hosts: true\n"
+	if !bytes.Contains(out, []byte(expected)) {
+		t.Errorf("%s\ndid not contain\n%s", out, expected)
+	}
+
+	out, err = NewNode(&NodeInput{JoinConfiguration: "my-join-config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("hostname:")) {
+		t.Errorf("expected no hostname settings, got:\n%s", out)
+	}
+}
+
+func TestNewJoinScript(t *testing.T) {
+	out, err := NewJoinScript(&JoinScriptInput{
+		PreKubeadmCommands:  []string{"echo pre-kubeadm"},
+		PostKubeadmCommands: []string{"echo post-kubeadm"},
+		APIServerEndpoint:   "10.0.0.1:6443",
+		Token:               "abcdef.0123456789abcdef",
+		CACertHashes:        []string{"sha256:abc"},
+		CRISocket:           "/run/containerd/containerd.sock",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "#!/bin/sh\n" +
+		"echo pre-kubeadm\n" +
+		"test -f " + SentinelFile + " || { kubeadm join '10.0.0.1:6443' --token 'abcdef.0123456789abcdef'" +
+		" --discovery-token-ca-cert-hash 'sha256:abc' --cri-socket '/run/containerd/containerd.sock'" +
+		" && mkdir -p /var/lib/cabpk && touch " + SentinelFile + "; }\n" +
+		"echo post-kubeadm\n"
+	if string(out) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out)
+	}
+
+	if _, err := NewJoinScript(&JoinScriptInput{APIServerEndpoint: "10.0.0.1:6443"}); err == nil {
+		t.Error("expected an error without token")
+	}
+}
+
+func TestNewAdoptNodeScript(t *testing.T) {
+	out, err := NewAdoptNodeScript(&AdoptNodeInput{
+		PreKubeadmCommands:  []string{"echo pre-kubeadm"},
+		PostKubeadmCommands: []string{"echo post-kubeadm"},
+		IdempotentCommands:  true,
+		CACert:              "ca-cert",
+		BootstrapKubeconfig: "kubeconfig\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"#!/bin/sh\nset -e\ntest ! -f " + SentinelFile + " || exit 0\necho pre-kubeadm\nif [ ! -f " + SentinelFile + " ]; then\n",
+		"      mv \"$f\" " + AdoptionBackupDir + "/\n",
+		"<<'CABPK_EOF'\nca-cert\nCABPK_EOF\n",
+		"<<'CABPK_EOF'\nkubeconfig\nCABPK_EOF\n",
+		"  mkdir -p /var/lib/cabpk && touch " + SentinelFile + "\nfi\necho post-kubeadm\n",
+	} {
+		if !bytes.Contains(out, []byte(expected)) {
+			t.Errorf("%s\ndid not contain\n%s", out, expected)
+		}
+	}
+
+	if _, err := NewAdoptNodeScript(&AdoptNodeInput{CACert: "ca-cert"}); err == nil {
+		t.Error("expected an error without bootstrap kubeconfig")
+	}
+	if _, err := NewAdoptNodeScript(&AdoptNodeInput{CACert: "ca-cert", BootstrapKubeconfig: "CABPK_EOF\n"}); err == nil {
+		t.Error("expected an error for files containing the heredoc marker")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	lockPassword := false
+	userData, err := NewNode(&NodeInput{
+		BaseUserData: BaseUserData{
+			PreKubeadmCommands: []string{"echo pre-kubeadm"},
+			AdditionalFiles:    []infrav1.File{{Path: "/etc/file", Owner: "root:root", Content: "content"}},
+			Users:              []infrav1.User{{Name: "admin", LockPassword: &lockPassword, SSHAuthorizedKeys: []string{"ssh-rsa key"}}},
+			ResetBeforeJoin:    true,
+			DisableTemplating:  true,
+			Hostname:           "worker-0",
+		},
+		JoinConfiguration: "my-join-config",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ToJSON(userData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := Document{}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("expected a JSON document, got %v:\n%s", err, out)
+	}
+	if len(doc.Files) != 2 || doc.Files[0].Path != "/etc/file" || doc.Files[0].Content != "content\n" || doc.Files[1].Path != "/tmp/kubeadm-node.yaml" {
+		t.Errorf("unexpected files %+v", doc.Files)
+	}
+	if len(doc.Commands) != 2 || doc.Commands[0] != "echo pre-kubeadm" || !strings.Contains(doc.Commands[1], "kubeadm join --config /tmp/kubeadm-node.yaml") {
+		t.Errorf("unexpected commands %v", doc.Commands)
+	}
+	if len(doc.BootCommands) != 1 || doc.BootCommands[0] != resetCommand {
+		t.Errorf("unexpected boot commands %v", doc.BootCommands)
+	}
+	if len(doc.Users) != 1 || doc.Users[0].Name != "admin" || doc.Users[0].LockPassword == nil || *doc.Users[0].LockPassword ||
+		len(doc.Users[0].SSHAuthorizedKeys) != 1 {
+		t.Errorf("unexpected users %+v", doc.Users)
+	}
+	if doc.Hostname != "worker-0" {
+		t.Errorf("expected hostname worker-0, got %q", doc.Hostname)
+	}
+}
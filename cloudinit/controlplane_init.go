@@ -31,15 +31,22 @@ const (
 {{.ClusterConfiguration | Indent 6}}
       ---
 {{.InitConfiguration | Indent 6}}
+{{- template "kubeadmdocuments" .AdditionalKubeadmConfigDocuments }}
 runcmd:
+{{- template "sentinel" .IdempotentCommands }}
+{{- template "verifier" .VerifySignature }}
 {{- template "commands" .PreKubeadmCommands }}
-  - 'kubeadm init --config /tmp/kubeadm.yaml'
+  - '` + sentinelGuard + `kubeadm init --config /tmp/kubeadm.yaml{{ if .CertificateKey }} --upload-certs --certificate-key {{ .CertificateKey }}{{ end }}{{ if .StaticPodManifests }} --ignore-preflight-errors=DirAvailable--etc-kubernetes-manifests{{ end }}` + sentinelMark + `'
 {{- template "commands" .PostKubeadmCommands }}
 {{- template "ntp" .NTP }}
 {{- template "users" .Users }}
+{{- template "hostname" . }}
+{{- template "bootcmd" . }}
 `
 )
 
+var controlPlaneInitTemplate = mustNewTemplate("InitControlplane", controlPlaneCloudInit)
+
 // ControlPlaneInput defines the context to generate a controlplane instance user data.
 type ControlPlaneInput struct {
 	BaseUserData
@@ -47,14 +54,21 @@ type ControlPlaneInput struct {
 
 	ClusterConfiguration string
 	InitConfiguration    string
+	// CertificateKey is the key the control plane certificates are encrypted with when uploaded to the
+	// kubeadm-certs secret. The certificates are not uploaded if empty.
+	CertificateKey string
 }
 
 // NewInitControlPlane returns the user data string to be used on a controlplane instance.
 func NewInitControlPlane(input *ControlPlaneInput) ([]byte, error) {
-	input.Header = cloudConfigHeader
+	input.setHeader()
 	input.WriteFiles = input.Certificates.AsFiles()
 	input.WriteFiles = append(input.WriteFiles, input.AdditionalFiles...)
-	userData, err := generate("InitControlplane", controlPlaneCloudInit, input)
+	input.WriteFiles = append(input.WriteFiles, input.StaticPodManifests...)
+	input.setBootCommands()
+	// hosts are only reset before joining a cluster
+	input.ResetBeforeJoin = false
+	userData, err := generate(controlPlaneInitTemplate, input)
 	if err != nil {
 		return nil, err
 	}
@@ -18,26 +18,37 @@ package cloudinit
 
 import (
 	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
 	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
 )
 
 const (
+	// ControlPlaneJoinConfigurationPath is the path the join configuration is written to on joining control plane machines.
+	ControlPlaneJoinConfigurationPath = "/tmp/kubeadm-controlplane-join-config.yaml"
+
 	controlPlaneJoinCloudInit = `{{.Header}}
 {{template "files" .WriteFiles}}
--   path: /tmp/kubeadm-controlplane-join-config.yaml
+-   path: ` + ControlPlaneJoinConfigurationPath + `
     owner: root:root
     permissions: '0640'
     content: |
 {{.JoinConfiguration | Indent 6}}
+{{- template "kubeadmdocuments" .AdditionalKubeadmConfigDocuments }}
 runcmd:
+{{- template "sentinel" .IdempotentCommands }}
+{{- template "verifier" .VerifySignature }}
 {{- template "commands" .PreKubeadmCommands }}
-  - 'kubeadm join --config /tmp/kubeadm-controlplane-join-config.yaml'
+  - '` + sentinelGuard + `kubeadm join --config ` + ControlPlaneJoinConfigurationPath + `{{ if .CertificateKey }} --certificate-key {{ .CertificateKey }}{{ end }}{{ if .StaticPodManifests }} --ignore-preflight-errors=DirAvailable--etc-kubernetes-manifests{{ end }}` + sentinelMark + `'
 {{- template "commands" .PostKubeadmCommands }}
 {{- template "ntp" .NTP }}
 {{- template "users" .Users }}
+{{- template "hostname" . }}
+{{- template "bootcmd" . }}
 `
 )
 
+var controlPlaneJoinTemplate = mustNewTemplate("JoinControlplane", controlPlaneJoinCloudInit)
+
 // ControlPlaneJoinInput defines context to generate controlplane instance user data for control plane node join.
 type ControlPlaneJoinInput struct {
 	BaseUserData
@@ -45,15 +56,23 @@ type ControlPlaneJoinInput struct {
 
 	BootstrapToken    string
 	JoinConfiguration string
+	// EtcdCertificates are etcd certificate files written alongside the cluster certificates.
+	EtcdCertificates []bootstrapv1.File
+	// CertificateKey is the key used to decrypt the control plane certificates downloaded from the kubeadm-certs
+	// secret. The certificates are not downloaded if empty.
+	CertificateKey string
 }
 
 // NewJoinControlPlane returns the user data string to be used on a new control plane instance.
 func NewJoinControlPlane(input *ControlPlaneJoinInput) ([]byte, error) {
-	input.Header = cloudConfigHeader
+	input.setHeader()
 	// TODO: Consider validating that the correct certificates exist. It is different for external/stacked etcd
 	input.WriteFiles = input.Certificates.AsFiles()
+	input.WriteFiles = append(input.WriteFiles, input.EtcdCertificates...)
 	input.WriteFiles = append(input.WriteFiles, input.AdditionalFiles...)
-	userData, err := generate("JoinControlplane", controlPlaneJoinCloudInit, input)
+	input.WriteFiles = append(input.WriteFiles, input.StaticPodManifests...)
+	input.setBootCommands()
+	userData, err := generate(controlPlaneJoinTemplate, input)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to generate user data for machine joining control plane")
 	}
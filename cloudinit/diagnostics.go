@@ -0,0 +1,100 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// diagnosticsLogSize is the number of bytes kept from the end of each log, so that the archive fits in a secret.
+	diagnosticsLogSize = 256 * 1024
+
+	diagnosticsScript = `#!/bin/sh
+# Collects the bootstrap logs and uploads them if kubeadm did not complete successfully.
+set -e
+if [ -f ` + SentinelFile + ` ]; then
+  exit 0
+fi
+dir=$(mktemp -d)
+archive=$(mktemp)
+trap 'rm -rf "$dir" "$archive" "$archive.json"' EXIT
+for log in /var/log/cloud-init.log /var/log/cloud-init-output.log; do
+  if [ -f "$log" ]; then
+    tail -c {{ .LogSize }} "$log" > "$dir/$(basename "$log")"
+  fi
+done
+journalctl --no-pager -u kubelet 2>&1 | tail -c {{ .LogSize }} > "$dir/kubelet.log" || true
+journalctl --no-pager -u containerd -u docker 2>&1 | tail -c {{ .LogSize }} > "$dir/container-runtime.log" || true
+tar -C "$dir" -czf "$archive" .
+{{- if .UploadURL }}
+curl -sSf --retry 5 -X PUT -T "$archive" {{ ShellQuote .UploadURL }}
+{{- else }}
+cat > "$dir/ca.crt" <<'CA_CERT'
+{{ .CACert }}
+CA_CERT
+printf '{"apiVersion":"v1","kind":"Secret","metadata":{"name":"%s","namespace":"%s"},"type":"%s","data":{"%s":"%s"}}' \
+  {{ ShellQuote .SecretName }} {{ ShellQuote .Namespace }} {{ ShellQuote .SecretType }} {{ ShellQuote .SecretKey }} "$(base64 -w 0 "$archive")" > "$archive.json"
+kubectl --kubeconfig=/dev/null --server={{ ShellQuote .Server }} --certificate-authority="$dir/ca.crt" --token={{ ShellQuote .Token }} replace -f "$archive.json"
+{{- end }}
+`
+)
+
+var diagnosticsTemplate = template.Must(template.New("Diagnostics").Funcs(template.FuncMap{"ShellQuote": ShellQuote}).Parse(diagnosticsScript))
+
+// DiagnosticsInput defines the context to generate a script uploading the bootstrap logs of a machine, either with
+// a PUT request to an upload URL, or with a bootstrap token to a secret of the workload cluster.
+type DiagnosticsInput struct {
+	UploadURL string
+
+	APIServerEndpoint string
+	CACert            string
+	Token             string
+	Namespace         string
+	SecretName        string
+	SecretType        string
+	SecretKey         string
+}
+
+// NewDiagnosticsScript returns a shell script collecting the cloud-init, kubelet and container runtime logs of a
+// machine where kubeadm did not complete, and uploading them. Uploading to the workload cluster requires kubectl.
+func NewDiagnosticsScript(input *DiagnosticsInput) ([]byte, error) {
+	if input.UploadURL == "" && (input.APIServerEndpoint == "" || input.Token == "" || input.CACert == "" || input.SecretName == "") {
+		return nil, errors.New("uploading diagnostics requires an upload URL, or an API server endpoint, a CA certificate and a bootstrap token")
+	}
+
+	data := struct {
+		DiagnosticsInput
+		Server  string
+		LogSize int
+	}{
+		DiagnosticsInput: *input,
+		Server:           "https://" + input.APIServerEndpoint,
+		LogSize:          diagnosticsLogSize,
+	}
+	data.CACert = strings.TrimSpace(input.CACert)
+
+	var out bytes.Buffer
+	if err := diagnosticsTemplate.Execute(&out, data); err != nil {
+		return nil, errors.Wrap(err, "failed to generate diagnostics script")
+	}
+	return out.Bytes(), nil
+}
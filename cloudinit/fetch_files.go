@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+const (
+	fetchFilesScript = `#!/bin/sh
+# Fetches the files that do not fit in the bootstrap data from the workload cluster.
+set -e
+ca=$(mktemp)
+tmp=$(mktemp)
+trap 'rm -f "$ca" "$tmp"' EXIT
+cat > "$ca" <<'CA_CERT'
+{{ .CACert }}
+CA_CERT
+fetch() {
+  data=$(kubectl --kubeconfig=/dev/null --server={{ ShellQuote .Server }} --certificate-authority="$ca" --token={{ ShellQuote .Token }} --namespace={{ ShellQuote .Namespace }} get secret "$1" -o jsonpath={{ ShellQuote .JSONPath }})
+  printf '%s' "$data" | base64 -d
+}
+{{- range .Files }}
+: > "$tmp"
+{{- range .Secrets }}
+fetch {{ ShellQuote . }} >> "$tmp"
+{{- end }}
+{{- if .DirectoryPermissions }}
+[ -d "$(dirname {{ ShellQuote .Path }})" ] || mkdir -p -m {{ ShellQuote .DirectoryPermissions }} "$(dirname {{ ShellQuote .Path }})"
+{{- else }}
+mkdir -p "$(dirname {{ ShellQuote .Path }})"
+{{- end }}
+{{- if eq .Encoding "base64" }}
+base64 -d "$tmp" > {{ ShellQuote .Path }}
+{{- else if eq .Encoding "gzip" }}
+gunzip -c "$tmp" > {{ ShellQuote .Path }}
+{{- else if eq .Encoding "gzip+base64" }}
+base64 -d "$tmp" | gunzip -c > {{ ShellQuote .Path }}
+{{- else }}
+cp "$tmp" {{ ShellQuote .Path }}
+{{- end }}
+{{- if .Owner }}
+chown {{ ShellQuote .Owner }} {{ ShellQuote .Path }}
+{{- end }}
+{{- if .Permissions }}
+chmod {{ ShellQuote .Permissions }} {{ ShellQuote .Path }}
+{{- end }}
+{{- end }}
+`
+)
+
+var fetchFilesTemplate = template.Must(template.New("FetchFiles").Funcs(template.FuncMap{"ShellQuote": ShellQuote}).Parse(fetchFilesScript))
+
+// FetchedFile is a file fetched from the workload cluster at boot instead of being written from the bootstrap data.
+// Its content is ignored; it is the concatenation of the content of the given secrets.
+type FetchedFile struct {
+	bootstrapv1.File
+	Secrets []string
+}
+
+// FetchFilesInput defines the context to generate a script fetching files from the workload cluster with a
+// bootstrap token.
+type FetchFilesInput struct {
+	APIServerEndpoint string
+	CACert            string
+	Token             string
+	Namespace         string
+	SecretKey         string
+	Files             []FetchedFile
+}
+
+// NewFetchFilesScript returns a shell script fetching files stored in secrets of the workload cluster, so that large
+// files do not exceed the size limits of the bootstrap data. The script requires kubectl on the machine.
+func NewFetchFilesScript(input *FetchFilesInput) ([]byte, error) {
+	if input.APIServerEndpoint == "" || input.Token == "" || input.CACert == "" {
+		return nil, errors.New("fetching files requires an API server endpoint, a CA certificate and a bootstrap token")
+	}
+
+	data := struct {
+		FetchFilesInput
+		Server   string
+		JSONPath string
+	}{
+		FetchFilesInput: *input,
+		Server:          "https://" + input.APIServerEndpoint,
+		JSONPath:        "{.data." + input.SecretKey + "}",
+	}
+	data.CACert = strings.TrimSpace(input.CACert)
+
+	var out bytes.Buffer
+	if err := fetchFilesTemplate.Execute(&out, data); err != nil {
+		return nil, errors.Wrap(err, "failed to generate fetch files script")
+	}
+	return out.Bytes(), nil
+}
@@ -16,6 +16,13 @@ limitations under the License.
 
 package cloudinit
 
+import (
+	"path"
+	"strings"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
 const (
 	filesTemplate = `{{ define "files" -}}
 write_files:{{ range . }}
@@ -24,14 +31,48 @@ write_files:{{ range . }}
     encoding: "{{.Encoding}}"
     {{ end -}}
     {{ if ne .Owner "" -}}
-    owner: {{.Owner}}
+    owner: {{ QuoteOwner .Owner }}
     {{ end -}}
     {{ if ne .Permissions "" -}}
     permissions: '{{.Permissions}}'
     {{ end -}}
+    {{ if .Defer -}}
+    defer: true
+    {{ end -}}
     content: |
 {{.Content | Indent 6}}
 {{- end -}}
 {{- end -}}
 `
 )
+
+// templateQuoteOwner quotes owners starting with a numeric ID, as YAML 1.1 parsers such as the one of cloud-init read
+// values like 1000:50 as sexagesimal integers.
+func templateQuoteOwner(owner string) string {
+	if owner[0] < '0' || owner[0] > '9' {
+		return owner
+	}
+	return "'" + owner + "'"
+}
+
+// directoryCommands returns the commands creating the missing parent directories of the files with directory
+// permissions, as cloud-init creates them with default permissions otherwise. They are run as boot commands, before
+// the files are written.
+func directoryCommands(files []bootstrapv1.File) []string {
+	var commands []string
+	seen := map[string]bool{}
+	for _, f := range files {
+		if f.DirectoryPermissions == "" {
+			continue
+		}
+		dir := path.Dir(f.Path)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		commands = append(commands, strings.Join([]string{
+			"[ -d", ShellQuote(dir), "] || mkdir -p -m", ShellQuote(f.DirectoryPermissions), ShellQuote(dir),
+		}, " "))
+	}
+	return commands
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	joinScript = `#!/bin/sh
+{{- if .IdempotentCommands }}
+` + skipIfBootstrappedCommand + `
+{{- end }}
+{{- range .PreKubeadmCommands }}
+{{ . }}
+{{- end }}
+` + sentinelGuard + `kubeadm join {{ ShellQuote .APIServerEndpoint }} --token {{ ShellQuote .Token }}
+{{- range .CACertHashes }} --discovery-token-ca-cert-hash {{ ShellQuote . }}{{ end }}
+{{- if .UnsafeSkipCAVerification }} --discovery-token-unsafe-skip-ca-verification{{ end }}
+{{- if .CRISocket }} --cri-socket {{ ShellQuote .CRISocket }}{{ end }}` + sentinelMark + `
+{{- range .PostKubeadmCommands }}
+{{ . }}
+{{- end }}
+`
+)
+
+var joinScriptTemplate = template.Must(template.New("JoinScript").Funcs(template.FuncMap{"ShellQuote": ShellQuote}).Parse(joinScript))
+
+// JoinScriptInput defines the context to generate a join script for a worker node.
+type JoinScriptInput struct {
+	PreKubeadmCommands  []string
+	PostKubeadmCommands []string
+	IdempotentCommands  bool
+
+	APIServerEndpoint        string
+	Token                    string
+	CACertHashes             []string
+	UnsafeSkipCAVerification bool
+	CRISocket                string
+}
+
+// NewJoinScript returns a shell script joining a worker node with bootstrap token discovery. Unlike the cloud-config
+// user data, it does not write any file nor configure the instance, so it is compact and identical for all the
+// instances sharing the token, e.g. in autoscaling group launch templates.
+func NewJoinScript(input *JoinScriptInput) ([]byte, error) {
+	if input.APIServerEndpoint == "" || input.Token == "" {
+		return nil, errors.New("join script requires an API server endpoint and a bootstrap token")
+	}
+
+	var out bytes.Buffer
+	if err := joinScriptTemplate.Execute(&out, input); err != nil {
+		return nil, errors.Wrap(err, "failed to generate join script")
+	}
+	return out.Bytes(), nil
+}
+
+// ShellQuote quotes the value for use as a single shell word.
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+// Document is the bootstrap data as a structured JSON document, for agents provisioning machines without cloud-init.
+// Files are written first, then the boot commands and commands are run in order by a shell.
+type Document struct {
+	Files        []bootstrapv1.File `json:"files,omitempty"`
+	BootCommands []string           `json:"bootCommands,omitempty"`
+	Commands     []string           `json:"commands,omitempty"`
+	Users        []bootstrapv1.User `json:"users,omitempty"`
+	NTP          *bootstrapv1.NTP   `json:"ntp,omitempty"`
+	Hostname     string             `json:"hostname,omitempty"`
+	FQDN         string             `json:"fqdn,omitempty"`
+}
+
+// cloudConfig holds the sections of a cloud-config generated by CABPK.
+type cloudConfig struct {
+	WriteFiles []bootstrapv1.File `json:"write_files,omitempty"`
+	BootCmd    []string           `json:"bootcmd,omitempty"`
+	RunCmd     []string           `json:"runcmd,omitempty"`
+	Users      []cloudConfigUser  `json:"users,omitempty"`
+	NTP        *bootstrapv1.NTP   `json:"ntp,omitempty"`
+	Hostname   string             `json:"hostname,omitempty"`
+	FQDN       string             `json:"fqdn,omitempty"`
+}
+
+// cloudConfigUser is a user as defined by the cloud-config schema.
+type cloudConfigUser struct {
+	Name              string   `json:"name"`
+	Gecos             *string  `json:"gecos,omitempty"`
+	Groups            *string  `json:"groups,omitempty"`
+	HomeDir           *string  `json:"homedir,omitempty"`
+	Inactive          *bool    `json:"inactive,omitempty"`
+	Shell             *string  `json:"shell,omitempty"`
+	Passwd            *string  `json:"passwd,omitempty"`
+	PrimaryGroup      *string  `json:"primary_group,omitempty"`
+	LockPassword      *bool    `json:"lock_passwd,omitempty"`
+	Sudo              *string  `json:"sudo,omitempty"`
+	SSHAuthorizedKeys []string `json:"ssh_authorized_keys,omitempty"`
+}
+
+// ToJSON converts user data rendered as a cloud-config to a JSON Document. The cloud-config must not rely on
+// jinja templating, as the expressions are left as is.
+func ToJSON(userData []byte) ([]byte, error) {
+	var in cloudConfig
+	if err := yaml.Unmarshal(userData, &in); err != nil {
+		return nil, errors.Wrap(err, "failed to parse cloud-config")
+	}
+
+	out := Document{
+		Files:        in.WriteFiles,
+		BootCommands: in.BootCmd,
+		Commands:     in.RunCmd,
+		NTP:          in.NTP,
+		Hostname:     in.Hostname,
+		FQDN:         in.FQDN,
+	}
+	for _, u := range in.Users {
+		out.Users = append(out.Users, bootstrapv1.User{
+			Name:              u.Name,
+			Gecos:             u.Gecos,
+			Groups:            u.Groups,
+			HomeDir:           u.HomeDir,
+			Inactive:          u.Inactive,
+			Shell:             u.Shell,
+			Passwd:            u.Passwd,
+			PrimaryGroup:      u.PrimaryGroup,
+			LockPassword:      u.LockPassword,
+			Sudo:              u.Sudo,
+			SSHAuthorizedKeys: u.SSHAuthorizedKeys,
+		})
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal JSON bootstrap data")
+	}
+	return data, nil
+}
@@ -17,23 +17,55 @@ limitations under the License.
 package cloudinit
 
 const (
+	// NodeJoinConfigurationPath is the path the join configuration is written to on worker machines.
+	NodeJoinConfigurationPath = "/tmp/kubeadm-node.yaml"
+
 	nodeCloudInit = `{{.Header}}
 {{template "files" .WriteFiles}}
--   path: /tmp/kubeadm-node.yaml
+-   path: ` + NodeJoinConfigurationPath + `
     owner: root:root
     permissions: '0640'
     content: |
       ---
 {{.JoinConfiguration | Indent 6}}
+{{- template "kubeadmdocuments" .AdditionalKubeadmConfigDocuments }}
 runcmd:
+{{- template "sentinel" .IdempotentCommands }}
+{{- template "verifier" .VerifySignature }}
 {{- template "commands" .PreKubeadmCommands }}
-  - 'kubeadm join --config /tmp/kubeadm-node.yaml'
+  - '` + sentinelGuard + `kubeadm join --config ` + NodeJoinConfigurationPath + `{{ if .StaticPodManifests }} --ignore-preflight-errors=DirAvailable--etc-kubernetes-manifests{{ end }}` + sentinelMark + `'
 {{- template "commands" .PostKubeadmCommands }}
 {{- template "ntp" .NTP }}
 {{- template "users" .Users }}
+{{- template "hostname" . }}
+{{- template "bootcmd" . }}
+`
+
+	// windowsJoinConfigurationPath is the path the join configuration is written to on Windows machines.
+	windowsJoinConfigurationPath = `C:\k\kubeadm-node.yaml`
+
+	// windowsNodeCloudInit is consumed by cloudbase-init, which runs the commands with cmd.exe and supports neither
+	// jinja templating nor the cloud-init modules configuring the NTP servers and the hostname.
+	windowsNodeCloudInit = `{{.Header}}
+{{template "files" .WriteFiles}}
+-   path: ` + windowsJoinConfigurationPath + `
+    content: |
+      ---
+{{.JoinConfiguration | Indent 6}}
+{{- template "kubeadmdocuments" .AdditionalKubeadmConfigDocuments }}
+runcmd:
+{{- template "commands" .PreKubeadmCommands }}
+  - 'kubeadm join --config ` + windowsJoinConfigurationPath + `'
+{{- template "commands" .PostKubeadmCommands }}
+{{- template "users" .Users }}
 `
 )
 
+var (
+	nodeTemplate        = mustNewTemplate("Node", nodeCloudInit)
+	windowsNodeTemplate = mustNewTemplate("WindowsNode", windowsNodeCloudInit)
+)
+
 // NodeInput defines the context to generate a node user data.
 type NodeInput struct {
 	BaseUserData
@@ -43,7 +75,12 @@ type NodeInput struct {
 
 // NewNode returns the user data string to be used on a node instance.
 func NewNode(input *NodeInput) ([]byte, error) {
-	input.Header = cloudConfigHeader
+	input.setHeader()
 	input.WriteFiles = append(input.WriteFiles, input.AdditionalFiles...)
-	return generate("Node", nodeCloudInit, input)
+	input.WriteFiles = append(input.WriteFiles, input.StaticPodManifests...)
+	input.setBootCommands()
+	if input.Windows {
+		return generate(windowsNodeTemplate, input)
+	}
+	return generate(nodeTemplate, input)
 }
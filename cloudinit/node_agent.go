@@ -0,0 +1,140 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"text/template"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+const (
+	// NodeAgentStateDir is the directory the node agent keeps the revision it applied and the update script in.
+	NodeAgentStateDir = "/var/lib/cabpk/node-agent"
+
+	// NodeAgentRevisionKey, NodeAgentScriptKey and NodeAgentNodeKey are the keys of the revision, the update script
+	// and the node name in the secrets the node agent reads its updates from.
+	NodeAgentRevisionKey = "revision"
+	NodeAgentScriptKey   = "script"
+	NodeAgentNodeKey     = "node"
+
+	// nodeAgentKubeconfig is the kubeconfig of the kubelet written by kubeadm, which the agent authenticates with.
+	nodeAgentKubeconfig = "/etc/kubernetes/kubelet.conf"
+
+	nodeAgentScript = `#!/bin/sh
+# Applies the updates of the node configuration published by the management cluster.
+set -e
+if [ ! -f ` + nodeAgentKubeconfig + ` ]; then
+  exit 0
+fi
+get() {
+  kubectl --kubeconfig=` + nodeAgentKubeconfig + ` --namespace={{ ShellQuote .Namespace }} get secret {{ ShellQuote .SecretName }} -o jsonpath="{.data.$1}" | base64 -d
+}
+revision=$(get ` + NodeAgentRevisionKey + ` 2>/dev/null || true)
+if [ -z "$revision" ] || [ "$revision" = "$(cat ` + NodeAgentStateDir + `/revision 2>/dev/null)" ]; then
+  exit 0
+fi
+mkdir -p -m 0700 ` + NodeAgentStateDir + `
+get ` + NodeAgentScriptKey + ` > ` + NodeAgentStateDir + `/update.sh
+chmod 0700 ` + NodeAgentStateDir + `/update.sh
+` + NodeAgentStateDir + `/update.sh
+printf '%s' "$revision" > ` + NodeAgentStateDir + `/revision
+kubectl --kubeconfig=` + nodeAgentKubeconfig + ` annotate node "$(get ` + NodeAgentNodeKey + `)" --overwrite {{ ShellQuote .RevisionAnnotation }}="$revision"
+`
+
+	nodeAgentUpdateScript = `#!/bin/sh
+set -e
+{{- range .Files }}
+{{- if .DirectoryPermissions }}
+[ -d "$(dirname {{ ShellQuote .Path }})" ] || mkdir -p -m {{ ShellQuote .DirectoryPermissions }} "$(dirname {{ ShellQuote .Path }})"
+{{- else }}
+mkdir -p "$(dirname {{ ShellQuote .Path }})"
+{{- end }}
+{{- if eq .Encoding "base64" }}
+echo {{ Base64 .Content }} | base64 -d | base64 -d > {{ ShellQuote .Path }}.cabpk-tmp
+{{- else if eq .Encoding "gzip" }}
+echo {{ Base64 .Content }} | base64 -d | gunzip -c > {{ ShellQuote .Path }}.cabpk-tmp
+{{- else if eq .Encoding "gzip+base64" }}
+echo {{ Base64 .Content }} | base64 -d | base64 -d | gunzip -c > {{ ShellQuote .Path }}.cabpk-tmp
+{{- else }}
+echo {{ Base64 .Content }} | base64 -d > {{ ShellQuote .Path }}.cabpk-tmp
+{{- end }}
+{{- if .Owner }}
+chown {{ ShellQuote .Owner }} {{ ShellQuote .Path }}.cabpk-tmp
+{{- end }}
+{{- if .Permissions }}
+chmod {{ ShellQuote .Permissions }} {{ ShellQuote .Path }}.cabpk-tmp
+{{- end }}
+mv {{ ShellQuote .Path }}.cabpk-tmp {{ ShellQuote .Path }}
+{{- end }}
+{{- range .Commands }}
+{{ . }}
+{{- end }}
+`
+)
+
+var (
+	nodeAgentTemplate = template.Must(template.New("NodeAgent").Funcs(template.FuncMap{"ShellQuote": ShellQuote}).Parse(nodeAgentScript))
+
+	nodeAgentUpdateTemplate = template.Must(template.New("NodeAgentUpdate").Funcs(template.FuncMap{
+		"ShellQuote": ShellQuote,
+		"Base64":     func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	}).Parse(nodeAgentUpdateScript))
+)
+
+// NodeAgentInput defines the context to generate the node agent script.
+type NodeAgentInput struct {
+	Namespace          string
+	SecretName         string
+	RevisionAnnotation string
+}
+
+// NewNodeAgentScript returns a shell script applying the updates published to a secret of the workload cluster once
+// the node has joined: when the revision of the secret differs from the one last applied, its update script is run,
+// and the node is annotated with the revision. The script authenticates with the kubelet credentials and requires
+// kubectl on the machine.
+func NewNodeAgentScript(input *NodeAgentInput) ([]byte, error) {
+	if input.Namespace == "" || input.SecretName == "" || input.RevisionAnnotation == "" {
+		return nil, errors.New("the node agent requires a namespace, a secret name and a revision annotation")
+	}
+
+	var out bytes.Buffer
+	if err := nodeAgentTemplate.Execute(&out, input); err != nil {
+		return nil, errors.Wrap(err, "failed to generate node agent script")
+	}
+	return out.Bytes(), nil
+}
+
+// NodeAgentUpdateInput defines the files and commands of a node agent update.
+type NodeAgentUpdateInput struct {
+	Files    []bootstrapv1.File
+	Commands []string
+}
+
+// NewNodeAgentUpdateScript returns the shell script the node agent runs to apply an update: the files are replaced
+// atomically, then the commands are run in order. The script stops at the first failure, and is run again by the
+// agent until it succeeds.
+func NewNodeAgentUpdateScript(input *NodeAgentUpdateInput) ([]byte, error) {
+	var out bytes.Buffer
+	if err := nodeAgentUpdateTemplate.Execute(&out, input); err != nil {
+		return nil, errors.Wrap(err, "failed to generate node agent update script")
+	}
+	return out.Bytes(), nil
+}
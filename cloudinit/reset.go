@@ -0,0 +1,37 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+const (
+	// resetCommand cleans up the state left behind by a previous kubeadm run on a reused host.
+	// It runs once per instance as a bootcmd, before write_files, so files rendered for the
+	// current join (certificates, static pod manifests) are not removed by the reset. The sentinel file
+	// is removed as well, so that the reset host is joined again.
+	resetCommand = `cloud-init-per instance kubeadm-reset sh -c "if [ -f /etc/kubernetes/kubelet.conf ] || [ -d /var/lib/etcd/member ]; then kubeadm reset -f; rm -rf /etc/kubernetes/manifests/* /var/lib/etcd/* ` + SentinelFile + `; fi"`
+
+	// bootCommandsTemplate renders the commands run by cloud-init on every boot, before the files are written.
+	bootCommandsTemplate = `{{- define "bootcmd" -}}
+{{- if or .ResetBeforeJoin .BootCommands }}
+bootcmd:
+{{- if .ResetBeforeJoin }}
+  - '` + resetCommand + `'
+{{- end }}
+{{- template "commands" .BootCommands }}
+{{- end -}}
+{{- end -}}
+`
+)
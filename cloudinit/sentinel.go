@@ -0,0 +1,38 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+const (
+	// SentinelFile is written once kubeadm has successfully run on the machine. It is stored on disk rather
+	// than in /run, so that it survives reboots.
+	SentinelFile = "/var/lib/cabpk/bootstrap-success.complete"
+
+	// sentinelGuard and sentinelMark wrap the kubeadm command, so that it is skipped if the user data is
+	// executed again on a machine where it already succeeded, e.g. by images re-running user data on reboot.
+	sentinelGuard = "test -f " + SentinelFile + " || { "
+	sentinelMark  = " && mkdir -p /var/lib/cabpk && touch " + SentinelFile + "; }"
+
+	// skipIfBootstrappedCommand ends the runcmd script early, skipping the pre and post kubeadm commands too.
+	skipIfBootstrappedCommand = "test ! -f " + SentinelFile + " || exit 0"
+
+	sentinelTemplate = `{{- define "sentinel" -}}
+{{- if . }}
+  - '` + skipIfBootstrappedCommand + `'
+{{- end -}}
+{{- end -}}
+`
+)
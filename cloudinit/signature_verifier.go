@@ -0,0 +1,63 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"strings"
+
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/signing"
+)
+
+const (
+	// SigningPublicKeyFile holds the public key the user data signature is verified with. It must be baked in the
+	// machine image, as a key shipped in the user data could be swapped along with the data; the user data is
+	// considered unverified if it is missing.
+	SigningPublicKeyFile = "/etc/cabpk/bootstrap-data-signing-key.pub"
+
+	// UnverifiedUserDataFile is written by the signature verifier if the signature of the user data is invalid.
+	UnverifiedUserDataFile = "/run/cabpk/bootstrap-data-unverified"
+
+	// userDataFile is the user data as received by cloud-init, including its signature line.
+	userDataFile = "/var/lib/cloud/instance/user-data.txt"
+
+	// userDataSignatureFile is the decoded signature of the user data.
+	userDataSignatureFile = "/run/cabpk/user-data.sig"
+
+	// skipIfUnverifiedCommand ends the runcmd script before the pre kubeadm commands if the user data signature is
+	// invalid, as the boot commands cannot stop cloud-init.
+	skipIfUnverifiedCommand = "test ! -f " + UnverifiedUserDataFile + " || exit 1"
+
+	verifierTemplate = `{{- define "verifier" -}}
+{{- if . }}
+  - '` + skipIfUnverifiedCommand + `'
+{{- end -}}
+{{- end -}}
+`
+)
+
+// verifySignatureCommand returns the boot command verifying the embedded signature of the user data with the public
+// key of the machine image in SigningPublicKeyFile. It runs before the files, e.g. the kubeadm config file, are
+// written, and writes UnverifiedUserDataFile if the key is missing or the signature is invalid.
+func verifySignatureCommand() string {
+	return strings.Join([]string{
+		"mkdir -p /run/cabpk && rm -f", UnverifiedUserDataFile,
+		"&& test -f", SigningPublicKeyFile,
+		"&& tail -n 1", userDataFile, "| sed", ShellQuote("s/^" + signing.SignatureLinePrefix + "//"), "| base64 -d >", userDataSignatureFile,
+		"&& head -n -1", userDataFile, "| openssl dgst -sha256 -verify", SigningPublicKeyFile, "-signature", userDataSignatureFile,
+		"|| touch", UnverifiedUserDataFile,
+	}, " ")
+}
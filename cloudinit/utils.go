@@ -23,7 +23,8 @@ import (
 
 var (
 	defaultTemplateFuncMap = template.FuncMap{
-		"Indent": templateYAMLIndent,
+		"Indent":     templateYAMLIndent,
+		"QuoteOwner": templateQuoteOwner,
 	}
 )
 
@@ -0,0 +1,176 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudinit
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// cloudConfigEncodings are the write_files encodings supported by cloud-init.
+	cloudConfigEncodings = map[string]bool{
+		"b64": true, "base64": true,
+		"gz": true, "gzip": true,
+		"gz+b64": true, "gz+base64": true, "gzip+b64": true, "gzip+base64": true,
+	}
+)
+
+// validateCloudConfig checks that the rendered user data is a cloud-config document cloud-init can consume:
+// it must be valid YAML, and the sections generated by CABPK must have the structure defined by the
+// cloud-config schema, since cloud-init silently skips sections it cannot parse.
+func validateCloudConfig(data []byte) error {
+	if !bytes.Contains(data, []byte("\n#cloud-config\n")) && !bytes.HasPrefix(data, []byte("#cloud-config\n")) {
+		return errors.New("missing #cloud-config header")
+	}
+
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return errors.Wrap(err, "invalid YAML")
+	}
+
+	if err := validateList(doc, "write_files", validateWriteFile); err != nil {
+		return err
+	}
+	for _, key := range []string{"bootcmd", "runcmd"} {
+		if err := validateList(doc, key, validateCommand); err != nil {
+			return err
+		}
+	}
+	if err := validateList(doc, "users", validateUser); err != nil {
+		return err
+	}
+	if ntp, ok := doc["ntp"]; ok {
+		if err := validateNTP(ntp); err != nil {
+			return errors.Wrap(err, "invalid ntp")
+		}
+	}
+	for _, key := range []string{"hostname", "fqdn"} {
+		if v, ok := doc[key]; ok {
+			if _, ok := v.(string); !ok {
+				return errors.Errorf("invalid %s: expected a string, got %T", key, v)
+			}
+		}
+	}
+	return nil
+}
+
+func validateList(doc map[string]interface{}, key string, validate func(interface{}) error) error {
+	v, ok := doc[key]
+	if !ok {
+		return nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return errors.Errorf("invalid %s: expected a list, got %T", key, v)
+	}
+	for i, item := range items {
+		if err := validate(item); err != nil {
+			return errors.Wrapf(err, "invalid %s[%d]", key, i)
+		}
+	}
+	return nil
+}
+
+func validateWriteFile(v interface{}) error {
+	file, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.Errorf("expected a map, got %T", v)
+	}
+	if path, ok := file["path"].(string); !ok || path == "" {
+		return errors.New("path must be a non empty string")
+	}
+	for _, key := range []string{"content", "owner", "permissions", "encoding"} {
+		if value, ok := file[key]; ok && value != nil {
+			if _, ok := value.(string); !ok {
+				return errors.Errorf("%s must be a string, got %T", key, value)
+			}
+		}
+	}
+	if value, ok := file["defer"]; ok && value != nil {
+		if _, ok := value.(bool); !ok {
+			return errors.Errorf("defer must be a boolean, got %T", value)
+		}
+	}
+	if encoding, ok := file["encoding"].(string); ok && !cloudConfigEncodings[encoding] {
+		return errors.Errorf("unsupported encoding %q", encoding)
+	}
+	return nil
+}
+
+func validateCommand(v interface{}) error {
+	switch command := v.(type) {
+	case string:
+		return nil
+	case []interface{}:
+		for _, arg := range command {
+			if _, ok := arg.(string); !ok {
+				return errors.Errorf("command arguments must be strings, got %T", arg)
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("expected a string or a list of strings, got %T", v)
+	}
+}
+
+func validateUser(v interface{}) error {
+	user, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.Errorf("expected a map, got %T", v)
+	}
+	if name, ok := user["name"].(string); !ok || name == "" {
+		return errors.New("name must be a non empty string")
+	}
+	if keys, ok := user["ssh_authorized_keys"]; ok {
+		if err := validateStrings(keys); err != nil {
+			return errors.Wrap(err, "invalid ssh_authorized_keys")
+		}
+	}
+	return nil
+}
+
+func validateNTP(v interface{}) error {
+	ntp, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.Errorf("expected a map, got %T", v)
+	}
+	if enabled, ok := ntp["enabled"]; ok {
+		if _, ok := enabled.(bool); !ok {
+			return errors.Errorf("enabled must be a boolean, got %T", enabled)
+		}
+	}
+	if servers, ok := ntp["servers"]; ok && servers != nil {
+		return validateStrings(servers)
+	}
+	return nil
+}
+
+func validateStrings(v interface{}) error {
+	items, ok := v.([]interface{})
+	if !ok {
+		return errors.Errorf("expected a list, got %T", v)
+	}
+	for _, item := range items {
+		if _, ok := item.(string); !ok {
+			return errors.Errorf("expected a string, got %T", item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command getdata writes the bootstrap data of a KubeadmConfig of the management cluster the current kubeconfig
+// points to, decoded, to stdout, or split into its files and commands into a directory for review.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/bootstrapdata"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func main() {
+	var configName, outputDir string
+	flag.StringVar(&configName, "config", "",
+		"The namespace/name of the KubeadmConfig to get the bootstrap data of.")
+	flag.StringVar(&outputDir, "output-dir", "",
+		"The directory to split the bootstrap data into, with its files under files/, its commands in bootcmd.sh and runcmd.sh, and the rest in document.yaml. The bootstrap data is written to stdout if unset.")
+	flag.Parse()
+
+	parts := strings.Split(configName, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		fmt.Fprintf(os.Stderr, "invalid --config %q, expected namespace/name\n", configName)
+		os.Exit(2)
+	}
+	key := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to get the management cluster kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bootstrapv1.AddToScheme(scheme)
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to create the management cluster client: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := bootstrapdata.Fetch(context.Background(), c, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if outputDir == "" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write the bootstrap data: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	doc, err := bootstrapdata.Split(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to split the bootstrap data: %v\n", err)
+		os.Exit(1)
+	}
+	if err := bootstrapdata.Write(outputDir, doc); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the bootstrap data to %s: %v\n", outputDir, err)
+		os.Exit(1)
+	}
+}
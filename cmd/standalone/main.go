@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command standalone writes the bootstrap data of a KubeadmConfig read from a YAML file to stdout, without any
+// management cluster.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/standalone"
+	"sigs.k8s.io/yaml"
+)
+
+func main() {
+	var configPath string
+	input := &standalone.Input{}
+	flag.StringVar(&configPath, "config", "",
+		"The KubeadmConfig YAML file to generate the bootstrap data for.")
+	flag.StringVar(&input.CertificatesDir, "certificates-dir", "pki",
+		"The directory of the cluster certificates. The missing certificates are generated into it for the first control plane machine.")
+	flag.StringVar(&input.ClusterName, "cluster-name", "",
+		"The cluster name, unless set by the ClusterConfiguration.")
+	flag.StringVar(&input.ControlPlaneEndpoint, "control-plane-endpoint", "",
+		"The control plane endpoint, unless set by the ClusterConfiguration or the join discovery.")
+	flag.StringVar(&input.KubernetesVersion, "kubernetes-version", "",
+		"The Kubernetes version, unless set by the ClusterConfiguration.")
+	flag.Parse()
+
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "--config is required")
+		os.Exit(2)
+	}
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", configPath, err)
+		os.Exit(1)
+	}
+	input.Config = &bootstrapv1.KubeadmConfig{}
+	if err := yaml.UnmarshalStrict(data, input.Config); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to decode %s: %v\n", configPath, err)
+		os.Exit(1)
+	}
+
+	userData, err := standalone.Generate(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to generate the bootstrap data: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stdout.Write(userData); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the bootstrap data: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+const (
+	// defaultNodeLocalDNSIP is the local IP of the node-local-dns DaemonSet of the Kubernetes addons.
+	defaultNodeLocalDNSIP = "169.254.20.10"
+
+	// nodeLocalDNSInterface is the name of the dummy interface node-local-dns binds its local IP to.
+	nodeLocalDNSInterface = "nodelocaldns"
+
+	nodeLocalDNSServiceName = "cabpk-nodelocaldns.service"
+
+	// nodeLocalDNSService creates the interface of node-local-dns at boot, before the kubelet starts; node-local-dns
+	// reuses the interface when it starts.
+	nodeLocalDNSService = `[Unit]
+Description=Create the interface of NodeLocal DNSCache
+After=network.target
+Before=kubelet.service
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/bin/sh -c 'ip link show ` + nodeLocalDNSInterface + ` >/dev/null 2>&1 || ip link add ` + nodeLocalDNSInterface + ` type dummy'
+ExecStart=/bin/sh -c 'ip addr replace %s dev ` + nodeLocalDNSInterface + `'
+
+[Install]
+WantedBy=multi-user.target
+`
+
+	kubeProxyIPVSModulesPath = "/etc/modules-load.d/cabpk-kube-proxy-ipvs.conf"
+)
+
+// kubeProxyIPVSModules are the kernel modules kube-proxy requires in IPVS mode.
+var kubeProxyIPVSModules = []string{"ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "nf_conntrack"}
+
+// nodeLocalDNSIP returns the local IP of NodeLocal DNSCache of the addon prerequisites.
+func nodeLocalDNSIP(nodeLocalDNS *bootstrapv1.NodeLocalDNSPrerequisites) string {
+	if nodeLocalDNS.LocalIP == "" {
+		return defaultNodeLocalDNSIP
+	}
+	return nodeLocalDNS.LocalIP
+}
+
+// addonFiles returns the files generated for the addon prerequisites of the config, along with the commands to be run
+// before kubeadm for the machine to apply them.
+func addonFiles(config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, error) {
+	addons := config.Spec.Addons
+	if addons == nil {
+		return nil, nil, nil
+	}
+	if errs := bootstrapv1.ValidateAddons(&config.Spec, field.NewPath("spec")); len(errs) > 0 {
+		return nil, nil, errs.ToAggregate()
+	}
+
+	var files []bootstrapv1.File
+	var commands []string
+	if addons.KubeProxyIPVS {
+		files = append(files, bootstrapv1.File{
+			Path:        kubeProxyIPVSModulesPath,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     strings.Join(kubeProxyIPVSModules, "\n") + "\n",
+		})
+		commands = append(commands, "modprobe -a "+strings.Join(kubeProxyIPVSModules, " "))
+	}
+	if addons.NodeLocalDNS != nil {
+		localIP := nodeLocalDNSIP(addons.NodeLocalDNS)
+		prefix := "/32"
+		if net.ParseIP(localIP).To4() == nil {
+			prefix = "/128"
+		}
+		files = append(files, bootstrapv1.File{
+			Path:        path.Join(systemdUnitDir, nodeLocalDNSServiceName),
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     fmt.Sprintf(nodeLocalDNSService, localIP+prefix),
+		})
+		commands = append(commands, "systemctl daemon-reload", "systemctl enable --now "+nodeLocalDNSServiceName)
+	}
+	return files, commands, nil
+}
+
+// applyAddonsToNodeRegistration sets the DNS server the kubelet passes to pods on the node registration to the local
+// IP of NodeLocal DNSCache, so that every node of the cluster uses the cache from first boot.
+func applyAddonsToNodeRegistration(addons *bootstrapv1.AddonPrerequisites, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions) {
+	if addons == nil || addons.NodeLocalDNS == nil {
+		return
+	}
+	if nodeRegistration.KubeletExtraArgs == nil {
+		nodeRegistration.KubeletExtraArgs = map[string]string{}
+	}
+	nodeRegistration.KubeletExtraArgs["cluster-dns"] = nodeLocalDNSIP(addons.NodeLocalDNS)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestAddonFiles(t *testing.T) {
+	testcases := []struct {
+		name             string
+		addons           *bootstrapv1.AddonPrerequisites
+		expectedAddress  string
+		expectedCommands []string
+		expectedArgs     map[string]string
+		expectErr        bool
+	}{
+		{
+			name: "nothing is configured by default",
+		},
+		{
+			name:             "NodeLocal DNSCache with the default local IP",
+			addons:           &bootstrapv1.AddonPrerequisites{NodeLocalDNS: &bootstrapv1.NodeLocalDNSPrerequisites{}},
+			expectedAddress:  "ip addr replace 169.254.20.10/32 dev nodelocaldns",
+			expectedCommands: []string{"systemctl daemon-reload", "systemctl enable --now cabpk-nodelocaldns.service"},
+			expectedArgs:     map[string]string{"cluster-dns": "169.254.20.10"},
+		},
+		{
+			name:             "NodeLocal DNSCache with an IPv6 local IP",
+			addons:           &bootstrapv1.AddonPrerequisites{NodeLocalDNS: &bootstrapv1.NodeLocalDNSPrerequisites{LocalIP: "fd00::10"}},
+			expectedAddress:  "ip addr replace fd00::10/128 dev nodelocaldns",
+			expectedCommands: []string{"systemctl daemon-reload", "systemctl enable --now cabpk-nodelocaldns.service"},
+			expectedArgs:     map[string]string{"cluster-dns": "fd00::10"},
+		},
+		{
+			name:             "kube-proxy IPVS modules",
+			addons:           &bootstrapv1.AddonPrerequisites{KubeProxyIPVS: true},
+			expectedCommands: []string{"modprobe -a ip_vs ip_vs_rr ip_vs_wrr ip_vs_sh nf_conntrack"},
+		},
+		{
+			name:      "invalid local IPs are rejected",
+			addons:    &bootstrapv1.AddonPrerequisites{NodeLocalDNS: &bootstrapv1.NodeLocalDNSPrerequisites{LocalIP: "169.254.20.10' && reboot '"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKubeadmConfig(newWorkerMachine(newCluster("cluster")), "worker-join-cfg")
+			config.Spec.Addons = tc.addons
+			files, commands, err := addonFiles(config)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error: %v, got %v", tc.expectErr, err)
+			}
+			if tc.expectErr {
+				return
+			}
+			if !reflect.DeepEqual(commands, tc.expectedCommands) {
+				t.Errorf("expected commands %v, got %v", tc.expectedCommands, commands)
+			}
+			if tc.expectedAddress != "" {
+				if len(files) != 1 || files[0].Path != "/etc/systemd/system/cabpk-nodelocaldns.service" || !strings.Contains(files[0].Content, tc.expectedAddress) {
+					t.Errorf("expected the interface unit to run %q, got %+v", tc.expectedAddress, files)
+				}
+			}
+
+			nodeRegistration := &kubeadmv1beta1.NodeRegistrationOptions{}
+			applyAddonsToNodeRegistration(tc.addons, nodeRegistration)
+			if !reflect.DeepEqual(nodeRegistration.KubeletExtraArgs, tc.expectedArgs) {
+				t.Errorf("expected kubelet args %v, got %v", tc.expectedArgs, nodeRegistration.KubeletExtraArgs)
+			}
+		})
+	}
+}
+
+func TestAddonFilesKubeProxyIPVS(t *testing.T) {
+	config := newKubeadmConfig(nil, "worker-join-cfg")
+	config.Spec.Addons = &bootstrapv1.AddonPrerequisites{KubeProxyIPVS: true}
+	files, _, err := addonFiles(config)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if len(files) != 1 || files[0].Path != kubeProxyIPVSModulesPath || files[0].Content != "ip_vs\nip_vs_rr\nip_vs_wrr\nip_vs_sh\nnf_conntrack\n" {
+		t.Errorf("expected the modules to be loaded at boot, got %+v", files)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultAdminKubeconfigTTL is the default validity of minted admin kubeconfigs.
+	DefaultAdminKubeconfigTTL = time.Hour
+
+	// MaxAdminKubeconfigTTL is the maximum validity of minted admin kubeconfigs. Client certificates cannot be
+	// revoked, so minted kubeconfigs must expire soon.
+	MaxAdminKubeconfigTTL = 24 * time.Hour
+
+	// adminGroup is the group admin kubeconfigs are granted by default, like the kubeadm admin kubeconfig.
+	adminGroup = "system:masters"
+)
+
+// AdminKubeconfigOptions are the options of a minted admin kubeconfig.
+type AdminKubeconfigOptions struct {
+	// User is the name the workload cluster authenticates the kubeconfig as, e.g. the name of the person requesting it,
+	// so that its requests can be told apart in the audit logs.
+	User string
+	// Groups are the groups the kubeconfig is authenticated with. Defaults to system:masters.
+	Groups []string
+	// TTL is the validity of the kubeconfig. Defaults to DefaultAdminKubeconfigTTL.
+	TTL time.Duration
+}
+
+// NewAdminKubeconfig signs a short-lived client certificate with the cluster CA and returns a kubeconfig using it,
+// targeting the same server as the cluster kubeconfig secret.
+func NewAdminKubeconfig(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, opts AdminKubeconfigOptions) ([]byte, error) {
+	if opts.User == "" {
+		return nil, errors.New("a user name is required")
+	}
+	if len(opts.Groups) == 0 {
+		opts.Groups = []string{adminGroup}
+	}
+	if opts.TTL == 0 {
+		opts.TTL = DefaultAdminKubeconfigTTL
+	}
+	if opts.TTL < 0 || opts.TTL > MaxAdminKubeconfigTTL {
+		return nil, errors.Errorf("the TTL must be positive and at most %s, got %s", MaxAdminKubeconfigTTL, opts.TTL)
+	}
+
+	server, err := kubeconfigServer(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if server == "" {
+		return nil, errors.Errorf("cluster %s/%s has no APIEndpoints", cluster.Namespace, cluster.Name)
+	}
+
+	certificates := internalcluster.Certificates{&internalcluster.Certificate{Purpose: internalcluster.ClusterCA}}
+	if err := certsecret.Lookup(ctx, c, cluster, certificates); err != nil {
+		return nil, errors.Wrap(err, "failed to look up the cluster CA")
+	}
+	if err := certificates.EnsureAllExist(); err != nil {
+		return nil, errors.Wrap(err, "the cluster CA and its key are required to sign admin kubeconfigs")
+	}
+	ca := certificates.GetByPurpose(internalcluster.ClusterCA)
+
+	keyPair, err := ca.NewSignedClientKeyPair(pkix.Name{CommonName: opts.User, Organization: opts.Groups}, opts.TTL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to sign client certificate for %q", opts.User)
+	}
+	return clientKubeconfig(cluster.Name, server, ca.KeyPair.Cert, opts.User, keyPair)
+}
+
+// clientKubeconfig returns a kubeconfig authenticating to the cluster with the client certificate of the key pair.
+func clientKubeconfig(clusterName, server string, caCert []byte, user string, keyPair *certs.KeyPair) ([]byte, error) {
+	kubeconfig := clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			clusterName: {
+				Server:                   server,
+				CertificateAuthorityData: caCert,
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			user: {
+				ClientCertificateData: keyPair.Cert,
+				ClientKeyData:         keyPair.Key,
+			},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			user + "@" + clusterName: {
+				Cluster:  clusterName,
+				AuthInfo: user,
+			},
+		},
+		CurrentContext: user + "@" + clusterName,
+	}
+	out, err := clientcmd.Write(kubeconfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to serialize kubeconfig")
+	}
+	return out, nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/secret"
+)
+
+func TestNewAdminKubeconfig(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "10.0.0.1", Port: 6443}}
+	config := newControlPlaneInitKubeadmConfig(newControlPlaneMachine(cluster, "control-plane"), "control-plane-cfg")
+	objects := append(createSecrets(t, cluster, config), cluster)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	out, err := NewAdminKubeconfig(context.Background(), myclient, cluster, AdminKubeconfigOptions{User: "alice", TTL: 30 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caSecret, err := secret.Get(myclient, cluster, secret.ClusterCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := certs.DecodeCertPEM(caSecret.Data[secret.TLSCrtDataName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateKubeconfig(out, caCert, "https://10.0.0.1:6443", time.Now()); err != nil {
+		t.Fatalf("expected a valid kubeconfig, got %v", err)
+	}
+	if err := validateKubeconfig(out, caCert, "https://10.0.0.1:6443", time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("expected the kubeconfig to expire after its TTL")
+	}
+
+	cfg, err := clientcmd.Load(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := certs.DecodeCertPEM(cfg.AuthInfos["alice"].ClientCertificateData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientCert.Subject.CommonName != "alice" || len(clientCert.Subject.Organization) != 1 || clientCert.Subject.Organization[0] != adminGroup {
+		t.Errorf("unexpected subject %v", clientCert.Subject)
+	}
+
+	if _, err := NewAdminKubeconfig(context.Background(), myclient, cluster, AdminKubeconfigOptions{User: "alice", TTL: 48 * time.Hour}); err == nil {
+		t.Error("expected a TTL longer than the maximum to be rejected")
+	}
+	if _, err := NewAdminKubeconfig(context.Background(), myclient, cluster, AdminKubeconfigOptions{}); err == nil {
+		t.Error("expected a missing user to be rejected")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+const (
+	// bootstrapKubeconfigCluster and bootstrapKubeconfigUser are the names kubeadm join uses in the bootstrap kubeconfig
+	// of the kubelet.
+	bootstrapKubeconfigCluster = "kubernetes"
+	bootstrapKubeconfigUser    = "tls-bootstrap-token-user"
+)
+
+// validateNodeAdoption checks that a config adopting an existing node belongs to a worker machine, and only uses
+// settings supported by the adoption script.
+func validateNodeAdoption(config *bootstrapv1.KubeadmConfig, isControlPlane bool) error {
+	if !config.Spec.AdoptExistingNode {
+		return nil
+	}
+	if isControlPlane {
+		return errors.New("adoptExistingNode is only supported for worker machines")
+	}
+	if config.Spec.Format != "" && config.Spec.Format != bootstrapv1.CloudConfig {
+		return errors.Errorf("adoptExistingNode is not supported by the %s format", config.Spec.Format)
+	}
+	if field := unsupportedScriptSetting(config); field != "" {
+		return errors.Errorf("%s is not supported by adoptExistingNode", field)
+	}
+	return nil
+}
+
+// newAdoptNodeScript generates the script adopting an existing node from the join configuration, in which discovery
+// has been reconciled. The kubelet is already configured on such nodes, so only its credentials are replaced.
+func newAdoptNodeScript(config *bootstrapv1.KubeadmConfig, joinConfiguration *kubeadmv1beta1.JoinConfiguration, certificates internalcluster.Certificates) ([]byte, error) {
+	bootstrapToken := joinConfiguration.Discovery.BootstrapToken
+	if bootstrapToken == nil {
+		return nil, errors.New("adoptExistingNode requires bootstrap token discovery")
+	}
+
+	caCert := certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair.Cert
+	kubeconfig, err := bootstrapKubeletKubeconfig("https://"+bootstrapToken.APIServerEndpoint, caCert, bootstrapToken.Token)
+	if err != nil {
+		return nil, err
+	}
+	return cloudinit.NewAdoptNodeScript(&cloudinit.AdoptNodeInput{
+		PreKubeadmCommands:  config.Spec.PreKubeadmCommands,
+		PostKubeadmCommands: config.Spec.PostKubeadmCommands,
+		IdempotentCommands:  config.Spec.IdempotentCommands,
+		CACert:              string(caCert),
+		BootstrapKubeconfig: string(kubeconfig),
+	})
+}
+
+// bootstrapKubeletKubeconfig returns the kubeconfig the kubelet performs the TLS bootstrap with, as written by
+// kubeadm join.
+func bootstrapKubeletKubeconfig(server string, caCert []byte, token string) ([]byte, error) {
+	kubeconfig := clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			bootstrapKubeconfigCluster: {
+				Server:                   server,
+				CertificateAuthorityData: caCert,
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			bootstrapKubeconfigUser: {
+				Token: token,
+			},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			bootstrapKubeconfigUser + "@" + bootstrapKubeconfigCluster: {
+				Cluster:  bootstrapKubeconfigCluster,
+				AuthInfo: bootstrapKubeconfigUser,
+			},
+		},
+		CurrentContext: bootstrapKubeconfigUser + "@" + bootstrapKubeconfigCluster,
+	}
+	out, err := clientcmd.Write(kubeconfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to serialize bootstrap kubeconfig")
+	}
+	return out, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestValidateNodeAdoption(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+	config.Spec.NTP = &bootstrapv1.NTP{Servers: []string{"pool.ntp.org"}}
+	if err := validateNodeAdoption(config, true); err != nil {
+		t.Fatalf("expected configs not adopting nodes not to be validated, got %v", err)
+	}
+
+	config.Spec.AdoptExistingNode = true
+	if err := validateNodeAdoption(config, false); err == nil {
+		t.Error("expected NTP to be rejected for adopted nodes")
+	}
+
+	config.Spec.NTP = nil
+	if err := validateNodeAdoption(config, false); err != nil {
+		t.Errorf("expected nil, got error %v", err)
+	}
+	if err := validateNodeAdoption(config, true); err == nil {
+		t.Error("expected control plane machines to be rejected")
+	}
+
+	config.Spec.Format = bootstrapv1.JoinScript
+	if err := validateNodeAdoption(config, false); err == nil {
+		t.Error("expected the join script format to be rejected for adopted nodes")
+	}
+}
+
+func TestKubeadmConfigReconciler_Reconcile_AdoptExistingNode(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Status.ControlPlaneInitialized = true
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+	workerJoinConfig.Spec.AdoptExistingNode = true
+	workerJoinConfig.Spec.PreKubeadmCommands = []string{"echo pre-kubeadm"}
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	objects = append(objects, createSecrets(t, cluster, workerJoinConfig)...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+	}
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	if _, err := k.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+
+	cfg, err := getKubeadmConfig(myclient, "worker-join-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Status.Ready {
+		t.Fatal("Expected status ready")
+	}
+	script := cfg.Status.BootstrapData
+	for _, expected := range []string{
+		"#!/bin/sh\n",
+		"echo pre-kubeadm\n",
+		"mv \"$f\" " + cloudinit.AdoptionBackupDir + "/\n",
+		"cat > /etc/kubernetes/bootstrap-kubelet.conf",
+	} {
+		if !bytes.Contains(script, []byte(expected)) {
+			t.Errorf("%s\ndid not contain\n%s", script, expected)
+		}
+	}
+	if bytes.Contains(script, []byte("kubeadm join")) {
+		t.Errorf("expected the node not to be joined with kubeadm, got:\n%s", script)
+	}
+
+	start := bytes.Index(script, []byte("/etc/kubernetes/bootstrap-kubelet.conf <<'CABPK_EOF'\n"))
+	kubeconfigData := script[start:]
+	kubeconfigData = kubeconfigData[bytes.IndexByte(kubeconfigData, '\n')+1:]
+	kubeconfigData = kubeconfigData[:bytes.Index(kubeconfigData, []byte("CABPK_EOF\n"))]
+	kubeconfig, err := clientcmd.Load(kubeconfigData)
+	if err != nil {
+		t.Fatalf("failed to load the bootstrap kubeconfig: %v", err)
+	}
+	if server := kubeconfig.Clusters[bootstrapKubeconfigCluster].Server; server != "https://100.105.150.1:6443" {
+		t.Errorf("expected the bootstrap kubeconfig to target the API server endpoint, got %s", server)
+	}
+	if kubeconfig.AuthInfos[bootstrapKubeconfigUser].Token != cfg.Spec.JoinConfiguration.Discovery.BootstrapToken.Token {
+		t.Error("expected the bootstrap kubeconfig to hold the bootstrap token of the config")
+	}
+}
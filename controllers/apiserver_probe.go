@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+)
+
+// DefaultAPIServerProbeTimeout is the default timeout of the probes of the API server endpoint.
+const DefaultAPIServerProbeTimeout = 5 * time.Second
+
+// NetAPIServerProber probes the API server endpoint of workload clusters from the controller.
+type NetAPIServerProber struct {
+	// Timeout is the timeout of a probe. Defaults to DefaultAPIServerProbeTimeout.
+	Timeout time.Duration
+}
+
+// Probe returns an error if the API server endpoint does not accept TCP connections, or, in HTTPS mode, if its
+// /healthz endpoint does not answer. Answers denying anonymous requests count as healthy, as they are returned by the
+// API server itself and not by a load balancer without backends.
+func (p NetAPIServerProber) Probe(ctx context.Context, mode bootstrapv1.APIServerCheckMode, endpoint string, caCert []byte) error {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = DefaultAPIServerProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch mode {
+	case bootstrapv1.APIServerCheckTCP:
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", endpoint)
+		if err != nil {
+			return errors.Wrapf(err, "failed to connect to %s", endpoint)
+		}
+		return conn.Close()
+	case bootstrapv1.APIServerCheckHTTPS:
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return errors.New("failed to parse the cluster CA")
+		}
+		httpClient := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: pool},
+				DisableKeepAlives: true,
+			},
+		}
+		url := "https://" + endpoint + "/healthz"
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return errors.Wrapf(err, "invalid API server endpoint %s", endpoint)
+		}
+		resp, err := httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return errors.Wrapf(err, "failed to get %s", url)
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusUnauthorized, http.StatusForbidden:
+			return nil
+		}
+		return errors.Errorf("%s returned %s", url, resp.Status)
+	}
+	return errors.Errorf("unknown API server check mode %q", mode)
+}
+
+// apiServerProber returns the prober of the API server endpoints, defaulted to a NetAPIServerProber.
+func (r *KubeadmConfigReconciler) apiServerProber() APIServerProber {
+	if r.APIServerProber == nil {
+		return NetAPIServerProber{}
+	}
+	return r.APIServerProber
+}
+
+// reconcileAPIServerReachability probes the API server endpoint used for discovery, and records whether it answers
+// on the config. The join data is not generated while the endpoint does not answer, as joining machines would fail
+// discovery.
+func (r *KubeadmConfigReconciler) reconcileAPIServerReachability(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, endpoint string, caCert []byte) error {
+	now := metav1.Now()
+	err := r.apiServerProber().Probe(ctx, config.Spec.APIServerCheck, endpoint, caCert)
+	if err == nil {
+		if condition := getCondition(config, bootstrapv1.APIServerUnreachableCondition); condition != nil {
+			setCondition(config, bootstrapv1.APIServerUnreachableCondition, corev1.ConditionFalse, APIServerReachableReason, "", now)
+		}
+		return nil
+	}
+
+	message := fmt.Sprintf("The API server endpoint %s of Cluster %s does not answer: %v", endpoint, cluster.Name, err)
+	condition := getCondition(config, bootstrapv1.APIServerUnreachableCondition)
+	if (condition == nil || condition.Status != corev1.ConditionTrue) && r.Recorder != nil {
+		r.Recorder.Event(config, corev1.EventTypeWarning, APIServerUnreachableReason, message)
+	}
+	setCondition(config, bootstrapv1.APIServerUnreachableCondition, corev1.ConditionTrue, APIServerUnreachableReason, message, now)
+	return errors.Wrap(&capierrors.RequeueAfterError{RequeueAfter: currentTunables().RequeueInterval}, message)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+type fakeAPIServerProber struct {
+	err error
+}
+
+func (p fakeAPIServerProber) Probe(_ context.Context, _ bootstrapv1.APIServerCheckMode, _ string, _ []byte) error {
+	return p.err
+}
+
+func TestNetAPIServerProber(t *testing.T) {
+	prober := NetAPIServerProber{}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := listener.Addr().String()
+	if err := prober.Probe(context.Background(), bootstrapv1.APIServerCheckTCP, endpoint, nil); err != nil {
+		t.Errorf("expected a listening endpoint to answer, got %v", err)
+	}
+	listener.Close()
+	if err := prober.Probe(context.Background(), bootstrapv1.APIServerCheckTCP, endpoint, nil); err == nil {
+		t.Error("expected a closed endpoint not to answer")
+	}
+
+	status := http.StatusServiceUnavailable
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	endpoint = strings.TrimPrefix(server.URL, "https://")
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	if err := prober.Probe(context.Background(), bootstrapv1.APIServerCheckHTTPS, endpoint, caCert); err == nil {
+		t.Error("expected an unavailable API server not to answer")
+	}
+	for _, status = range []int{http.StatusOK, http.StatusUnauthorized} {
+		if err := prober.Probe(context.Background(), bootstrapv1.APIServerCheckHTTPS, endpoint, caCert); err != nil {
+			t.Errorf("expected the API server to answer with status %d, got %v", status, err)
+		}
+	}
+	if err := prober.Probe(context.Background(), bootstrapv1.APIServerCheckHTTPS, endpoint, []byte(newTestCABundle(t))); err == nil {
+		t.Error("expected an API server with a certificate not signed by the cluster CA to be rejected")
+	}
+}
+
+func TestReconcileAPIServerReachability(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newKubeadmConfig(nil, "cfg")
+	config.Spec.APIServerCheck = bootstrapv1.APIServerCheckTCP
+
+	r := &KubeadmConfigReconciler{
+		Log:             log.Log,
+		APIServerProber: fakeAPIServerProber{err: errors.New("connection refused")},
+	}
+	err := r.reconcileAPIServerReachability(context.Background(), cluster, config, "10.0.0.1:6443", nil)
+	if _, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); !ok {
+		t.Fatalf("expected a requeue for an unreachable API server, got %v", err)
+	}
+	if condition := getCondition(config, bootstrapv1.APIServerUnreachableCondition); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Errorf("expected the %s condition to be true, got %+v", bootstrapv1.APIServerUnreachableCondition, condition)
+	}
+	if reason := discoveryRequeueReason(config); reason != APIServerUnreachableReason {
+		t.Errorf("expected the requeue reason to be %s, got %s", APIServerUnreachableReason, reason)
+	}
+
+	r.APIServerProber = fakeAPIServerProber{}
+	if err := r.reconcileAPIServerReachability(context.Background(), cluster, config, "10.0.0.1:6443", nil); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if condition := getCondition(config, bootstrapv1.APIServerUnreachableCondition); condition.Status != corev1.ConditionFalse || condition.Reason != APIServerReachableReason {
+		t.Errorf("expected the %s condition to be false once the API server answers, got %+v", bootstrapv1.APIServerUnreachableCondition, condition)
+	}
+}
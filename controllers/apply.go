@@ -0,0 +1,149 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// FieldManager is the field manager CABPK uses for server-side apply and, with WithFieldManager, for all its
+	// writes.
+	FieldManager = "cluster-api-bootstrap-provider-kubeadm"
+
+	// SecretFieldConflictReason is the reason of the events recorded on secrets whose fields managed by CABPK were
+	// overwritten by another field manager, before CABPK takes them back.
+	SecretFieldConflictReason = "FieldManagerConflict"
+)
+
+var (
+	// conflictManagerRegexp matches the field manager in the message of a server-side apply conflict, e.g.
+	// conflict with "kubectl" using v1.
+	conflictManagerRegexp = regexp.MustCompile(`conflict with "([^"]*)"`)
+
+	secretFieldConflictsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cabpk_secret_field_conflicts_total",
+			Help: "Number of fields of secrets managed by CABPK found overwritten by another field manager.",
+		},
+		[]string{"manager"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(secretFieldConflictsTotal)
+}
+
+// applySecret creates or updates a secret with server-side apply. The secret must only hold the fields CABPK manages:
+// fields set by other managers, e.g. labels or annotations added by other controllers, are preserved, while fields
+// previously applied by CABPK and missing from the secret are removed. Conflicts on the fields CABPK manages are
+// resolved in favor of CABPK, after being counted per field manager and, if the recorder is not nil, recorded as an
+// event on the secret.
+func applySecret(ctx context.Context, c client.Client, recorder record.EventRecorder, s *corev1.Secret) error {
+	s.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+	s.ResourceVersion = ""
+	s.ManagedFields = nil
+	err := c.Patch(ctx, s, client.Apply, client.FieldOwner(FieldManager))
+	if err == nil || !apierrors.IsConflict(err) {
+		return err
+	}
+
+	conflicts := conflictingFields(err)
+	managers := make([]string, 0, len(conflicts))
+	for manager := range conflicts {
+		managers = append(managers, manager)
+	}
+	sort.Strings(managers)
+	for _, manager := range managers {
+		secretFieldConflictsTotal.WithLabelValues(manager).Add(float64(len(conflicts[manager])))
+		if recorder != nil {
+			recorder.Eventf(s, corev1.EventTypeWarning, SecretFieldConflictReason, "Fields %s managed by %s were overwritten by %s", strings.Join(conflicts[manager], ", "), FieldManager, manager)
+		}
+	}
+	return c.Patch(ctx, s, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+// conflictingFields returns the fields of a server-side apply conflict error by field manager.
+func conflictingFields(err error) map[string][]string {
+	conflicts := map[string][]string{}
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return conflicts
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		manager := "unknown"
+		if m := conflictManagerRegexp.FindStringSubmatch(cause.Message); m != nil {
+			manager = m[1]
+		}
+		conflicts[manager] = append(conflicts[manager], cause.Field)
+	}
+	return conflicts
+}
+
+// WithFieldManager returns a client setting FieldManager as the field manager of the create, update and patch
+// requests that set none, so that the fields CABPK writes are attributed to the same manager as its server-side
+// applies, instead of to the name of the binary.
+func WithFieldManager(c client.Client) client.Client {
+	return &fieldManagerClient{Client: c}
+}
+
+type fieldManagerClient struct {
+	client.Client
+}
+
+func (c *fieldManagerClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return c.Client.Create(ctx, obj, append([]client.CreateOption{client.FieldOwner(FieldManager)}, opts...)...)
+}
+
+func (c *fieldManagerClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return c.Client.Update(ctx, obj, append([]client.UpdateOption{client.FieldOwner(FieldManager)}, opts...)...)
+}
+
+func (c *fieldManagerClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.Client.Patch(ctx, obj, patch, append([]client.PatchOption{client.FieldOwner(FieldManager)}, opts...)...)
+}
+
+func (c *fieldManagerClient) Status() client.StatusWriter {
+	return &fieldManagerStatusWriter{StatusWriter: c.Client.Status()}
+}
+
+type fieldManagerStatusWriter struct {
+	client.StatusWriter
+}
+
+func (w *fieldManagerStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return w.StatusWriter.Update(ctx, obj, append([]client.UpdateOption{client.FieldOwner(FieldManager)}, opts...)...)
+}
+
+func (w *fieldManagerStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return w.StatusWriter.Patch(ctx, obj, patch, append([]client.PatchOption{client.FieldOwner(FieldManager)}, opts...)...)
+}
@@ -0,0 +1,335 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newFakeClientWithScheme returns a fake client emulating server-side apply, which the controller-runtime
+// fake client does not support.
+func newFakeClientWithScheme(scheme *runtime.Scheme, objects ...runtime.Object) client.Client {
+	return &applyClient{
+		Client:  fake.NewFakeClientWithScheme(scheme, objects...),
+		applied: map[types.NamespacedName]map[string]interface{}{},
+	}
+}
+
+// applyClient emulates server-side apply for a single field manager: applied objects are created if missing,
+// otherwise merged into the existing objects, and the fields applied previously but missing from the applied
+// object are removed. Only the fields of the metadata labels and annotations, and the top level fields of
+// other sections, e.g. the keys of secret data, are tracked.
+type applyClient struct {
+	client.Client
+
+	lock    sync.Mutex
+	applied map[types.NamespacedName]map[string]interface{}
+}
+
+func (c *applyClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() == types.MergePatchType {
+		return c.mergePatch(ctx, obj, patch, c.Client.Update)
+	}
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	key := types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	intent := map[string]interface{}{}
+	if err := json.Unmarshal(data, &intent); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	previous := c.applied[key]
+	c.applied[key] = intent
+
+	existing := obj.DeepCopyObject()
+	if err := c.Client.Get(ctx, key, existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		return c.Client.Create(ctx, obj)
+	}
+
+	// Remove the fields owned by the previous apply that are missing from the new one.
+	mergePatch := removedFields(previous, intent)
+	for k, v := range intent {
+		mergePatch[k] = mergeSection(mergePatch[k], v)
+	}
+	mergePatchData, err := json.Marshal(mergePatch)
+	if err != nil {
+		return err
+	}
+
+	// The patch is applied here, as the fake client merges patched maps into the existing ones instead of replacing them.
+	existingData, err := json.Marshal(existing)
+	if err != nil {
+		return err
+	}
+	merged, err := jsonpatch.MergePatch(existingData, mergePatchData)
+	if err != nil {
+		return err
+	}
+	updated := obj.DeepCopyObject()
+	if err := json.Unmarshal(merged, updated); err != nil {
+		return err
+	}
+	if err := c.Client.Update(ctx, updated); err != nil {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func (c *applyClient) Status() client.StatusWriter {
+	return &applyStatusWriter{StatusWriter: c.Client.Status(), client: c}
+}
+
+type applyStatusWriter struct {
+	client.StatusWriter
+	client *applyClient
+}
+
+func (w *applyStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.MergePatchType {
+		return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+	}
+	return w.client.mergePatch(ctx, obj, patch, func(ctx context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+		return w.StatusWriter.Update(ctx, obj)
+	})
+}
+
+// mergePatch applies a JSON merge patch like the API server, removing the fields patched to null, which the fake
+// client keeps as it decodes the patched object into the existing one.
+func (c *applyClient) mergePatch(ctx context.Context, obj runtime.Object, patch client.Patch, update func(context.Context, runtime.Object, ...client.UpdateOption) error) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	key, err := client.ObjectKeyFromObject(obj)
+	if err != nil {
+		return err
+	}
+	existing := newEmptyObject(obj)
+	if err := c.Client.Get(ctx, key, existing); err != nil {
+		return err
+	}
+	existingData, err := json.Marshal(existing)
+	if err != nil {
+		return err
+	}
+	merged, err := jsonpatch.MergePatch(existingData, data)
+	if err != nil {
+		return err
+	}
+	updated := newEmptyObject(obj)
+	if err := json.Unmarshal(merged, updated); err != nil {
+		return err
+	}
+	if err := update(ctx, updated); err != nil {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+// newEmptyObject returns a new empty object of the type of obj.
+func newEmptyObject(obj runtime.Object) runtime.Object {
+	return reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+}
+
+// removedFields returns a merge patch removing the fields of previous missing from current.
+func removedFields(previous, current map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for section := range previous {
+		if section == "metadata" {
+			continue
+		}
+		if removed := removedKeys(previous[section], current[section]); len(removed) > 0 {
+			patch[section] = removed
+		}
+	}
+
+	previousMeta, _ := previous["metadata"].(map[string]interface{})
+	currentMeta, _ := current["metadata"].(map[string]interface{})
+	removedMeta := map[string]interface{}{}
+	for _, field := range []string{"labels", "annotations"} {
+		if removed := removedKeys(previousMeta[field], currentMeta[field]); len(removed) > 0 {
+			removedMeta[field] = removed
+		}
+	}
+	if len(removedMeta) > 0 {
+		patch["metadata"] = removedMeta
+	}
+	return patch
+}
+
+// removedKeys returns a merge patch removing the keys of previous missing from current, if both are maps.
+func removedKeys(previous, current interface{}) map[string]interface{} {
+	previousFields, ok := previous.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	currentFields, _ := current.(map[string]interface{})
+	removed := map[string]interface{}{}
+	for field := range previousFields {
+		if _, ok := currentFields[field]; !ok {
+			removed[field] = nil
+		}
+	}
+	return removed
+}
+
+func mergeSection(removed, applied interface{}) interface{} {
+	removedFields, ok := removed.(map[string]interface{})
+	appliedFields, ok2 := applied.(map[string]interface{})
+	if !ok || !ok2 {
+		return applied
+	}
+	for k, v := range appliedFields {
+		removedFields[k] = mergeSection(removedFields[k], v)
+	}
+	return removedFields
+}
+
+func TestApplySecret(t *testing.T) {
+	c := newFakeClientWithScheme(setupScheme())
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "default", Name: "secret"}
+
+	if err := applySecret(ctx, c, nil, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name, Annotations: map[string]string{"managed": "true"}},
+		Data:       map[string][]byte{"a": []byte("a"), "b": []byte("b")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another controller labels the secret.
+	s := &corev1.Secret{}
+	if err := c.Get(ctx, key, s); err != nil {
+		t.Fatal(err)
+	}
+	s.Labels = map[string]string{"other": "true"}
+	if err := c.Update(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applySecret(ctx, c, nil, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		Data:       map[string][]byte{"a": []byte("updated")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s = &corev1.Secret{}
+	if err := c.Get(ctx, key, s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Labels["other"] != "true" {
+		t.Errorf("expected the labels of other controllers to be preserved, got %v", s.Labels)
+	}
+	if _, ok := s.Annotations["managed"]; ok {
+		t.Errorf("expected the annotation no longer applied to be removed, got %v", s.Annotations)
+	}
+	if string(s.Data["a"]) != "updated" || len(s.Data) != 1 {
+		t.Errorf("expected only the applied data, got %v", s.Data)
+	}
+}
+
+// conflictClient rejects the server-side applies that do not force ownership with a conflict on the given fields.
+type conflictClient struct {
+	client.Client
+	causes []metav1.StatusCause
+}
+
+func (c *conflictClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	options := (&client.PatchOptions{}).ApplyOptions(opts)
+	if patch.Type() == types.ApplyPatchType && (options.Force == nil || !*options.Force) {
+		return &apierrors.StatusError{ErrStatus: metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusConflict,
+			Reason:  metav1.StatusReasonConflict,
+			Details: &metav1.StatusDetails{Causes: c.causes},
+		}}
+	}
+	if options.FieldManager != FieldManager {
+		return errors.Errorf("expected field manager %q, got %q", FieldManager, options.FieldManager)
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApplySecret_Conflict(t *testing.T) {
+	c := &conflictClient{
+		Client: WithFieldManager(newFakeClientWithScheme(setupScheme())),
+		causes: []metav1.StatusCause{
+			{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "argocd-controller" using v1`, Field: ".data.value"},
+			{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "argocd-controller" using v1`, Field: ".metadata.labels.app"},
+		},
+	}
+	recorder := record.NewFakeRecorder(10)
+	before := testutil.ToFloat64(secretFieldConflictsTotal.WithLabelValues("argocd-controller"))
+
+	if err := applySecret(context.Background(), c, recorder, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "secret"},
+		Data:       map[string][]byte{"value": []byte("data")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if conflicts := testutil.ToFloat64(secretFieldConflictsTotal.WithLabelValues("argocd-controller")) - before; conflicts != 2 {
+		t.Errorf("expected 2 conflicts counted for the other manager, got %v", conflicts)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, SecretFieldConflictReason) || !strings.Contains(event, "argocd-controller") || !strings.Contains(event, ".data.value, .metadata.labels.app") {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Error("expected a conflict event")
+	}
+	s := &corev1.Secret{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "secret"}, s); err != nil {
+		t.Fatalf("expected the secret to be applied with forced ownership: %v", err)
+	}
+}
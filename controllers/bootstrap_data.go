@@ -0,0 +1,197 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/envelope"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// bootstrapDataSecretType is the type of the secrets storing bootstrap data.
+	bootstrapDataSecretType corev1.SecretType = "cluster.x-k8s.io/secret"
+
+	// bootstrapDataSecretKey is the key of the bootstrap data in the bootstrap data secret.
+	bootstrapDataSecretKey = "value"
+
+	// The config types of the bootstrap data, as labelled in metrics.
+	initConfigType             = "init"
+	controlPlaneJoinConfigType = "control-plane-join"
+	workerJoinConfigType       = "worker-join"
+)
+
+var bootstrapDataReadySeconds = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "cabpk_bootstrap_data_ready_seconds",
+		Help:    "Time from the creation of a config to its bootstrap data being ready.",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	},
+	[]string{"type"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(bootstrapDataReadySeconds)
+}
+
+// storeBootstrapData stores the bootstrap data in a secret owned by the config and marks the config as ready.
+// Unless disabled, the bootstrap data is also stored in the config status for backward compatibility.
+// The hash of the spec is recorded to detect later changes that are not reflected in the bootstrap data.
+// The data source meta data, if any, is stored in the secret alongside the bootstrap data.
+// If envelope encryption is enabled, the bootstrap data is encrypted with the data key of the cluster and never
+// stored in the status; the meta data is stored unencrypted. The config type labels the time-to-ready metric.
+// If signing is enabled, the bootstrap data is signed before being stored, see signBootstrapData; the checksum of the
+// bootstrap data is recorded in an annotation of the secret in any case.
+func (r *KubeadmConfigReconciler) storeBootstrapData(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, configType string, data []byte, metadata map[string][]byte) error {
+	annotations := map[string]string{}
+	if r.BootstrapDataSigner != nil {
+		signed, signatureAnnotations, err := signBootstrapData(r.BootstrapDataSigner, config, data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to sign bootstrap data for KubeadmConfig %s/%s", config.Namespace, config.Name)
+		}
+		data = signed
+		for k, v := range signatureAnnotations {
+			annotations[k] = v
+		}
+	}
+	annotations[BootstrapDataChecksumAnnotation] = bootstrapDataChecksum(data)
+
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      config.Name,
+			Namespace: config.Namespace,
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: cluster.Name,
+			},
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: bootstrapv1.GroupVersion.String(),
+					Kind:       "KubeadmConfig",
+					Name:       config.Name,
+					UID:        config.UID,
+					Controller: boolPtr(true),
+				},
+			},
+		},
+		Type: bootstrapDataSecretType,
+		Data: map[string][]byte{
+			bootstrapDataSecretKey: data,
+		},
+	}
+
+	if r.BootstrapDataKeyWrapper != nil {
+		encrypted, err := r.encryptBootstrapData(ctx, cluster, data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to encrypt bootstrap data for KubeadmConfig %s/%s", config.Namespace, config.Name)
+		}
+		s.Data[bootstrapDataSecretKey] = encrypted
+		s.Annotations[BootstrapDataEncryptionAnnotation] = envelope.Algorithm
+		s.Annotations[BootstrapDataKeySecretAnnotation] = dataKeySecretName(cluster)
+	}
+
+	for k, v := range metadata {
+		s.Data[k] = v
+	}
+
+	hash, err := specHash(&config.Spec)
+	if err != nil {
+		return errors.Wrapf(err, "failed to hash spec of KubeadmConfig %s/%s", config.Namespace, config.Name)
+	}
+
+	if err := applySecret(ctx, r.Client, r.Recorder, s); err != nil {
+		return errors.Wrapf(err, "failed to apply bootstrap data secret for KubeadmConfig %s/%s", config.Namespace, config.Name)
+	}
+
+	config.Status.DataSecretName = &s.Name
+	if !r.DisableLegacyBootstrapData && r.BootstrapDataKeyWrapper == nil {
+		config.Status.BootstrapData = data
+		config.Status.BootstrapDataEncoding = ""
+		if r.CompressLegacyBootstrapData && compressibleBootstrapData(config) {
+			compressed, err := gzipBootstrapData(data)
+			if err != nil {
+				return errors.Wrapf(err, "failed to compress bootstrap data for KubeadmConfig %s/%s", config.Namespace, config.Name)
+			}
+			config.Status.BootstrapData = compressed
+			config.Status.BootstrapDataEncoding = bootstrapv1.GzipBootstrapDataEncoding
+		}
+	}
+	r.markReady(config, configType)
+	config.Status.RenderedSpecHash = hash
+	if getCondition(config, bootstrapv1.BootstrapDataOutOfDateCondition) != nil {
+		setCondition(config, bootstrapv1.BootstrapDataOutOfDateCondition, corev1.ConditionFalse, SpecUpToDateReason, "", metav1.Now())
+	}
+	return nil
+}
+
+// compressibleBootstrapData returns whether the bootstrap data of the config is cloud-config user data, which
+// cloud-init decompresses. Scripts and JSON are consumed as is, so they are never compressed.
+func compressibleBootstrapData(config *bootstrapv1.KubeadmConfig) bool {
+	return (config.Spec.Format == "" || config.Spec.Format == bootstrapv1.CloudConfig) && !config.Spec.AdoptExistingNode
+}
+
+// gzipBootstrapData returns the bootstrap data compressed with gzip. The header holds no name nor time, so that the
+// same data is always compressed the same way and the status does not change when it is stored again.
+func gzipBootstrapData(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	w, err := gzip.NewWriterLevel(&out, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// markReady marks the config as ready. The first time, the ready time is recorded, the time from the creation of
+// the config is observed in the time-to-ready metric of its type, and an event is emitted.
+func (r *KubeadmConfigReconciler) markReady(config *bootstrapv1.KubeadmConfig, configType string) {
+	config.Status.Ready = true
+	if config.Status.ReadyTime != nil {
+		return
+	}
+	now := metav1.Now()
+	config.Status.ReadyTime = &now
+	if !config.CreationTimestamp.IsZero() {
+		bootstrapDataReadySeconds.WithLabelValues(configType).Observe(now.Sub(config.CreationTimestamp.Time).Seconds())
+	}
+	if r.Recorder != nil {
+		r.Recorder.Eventf(config, corev1.EventTypeNormal, BootstrapDataReadyReason, "The %s bootstrap data is ready", configType)
+	}
+}
+
+// hasBootstrapData returns true if bootstrap data was already delivered to the machine or stored for the config.
+func hasBootstrapData(machine *clusterv1.Machine, config *bootstrapv1.KubeadmConfig) bool {
+	return machine.Spec.Bootstrap.Data != nil || config.Status.DataSecretName != nil
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/envelope"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// BootstrapDataEncryptionAnnotation is set on the secrets holding encrypted bootstrap data to the encryption
+	// algorithm.
+	BootstrapDataEncryptionAnnotation = "bootstrap.cluster.x-k8s.io/encryption"
+
+	// BootstrapDataKeySecretAnnotation is set on the secrets holding encrypted bootstrap data to the name of the
+	// secret holding the wrapped data key of the cluster.
+	BootstrapDataKeySecretAnnotation = "bootstrap.cluster.x-k8s.io/data-key-secret"
+
+	// dataKeySecretType is the type of the secrets holding the wrapped data keys of clusters.
+	dataKeySecretType corev1.SecretType = "bootstrap.cluster.x-k8s.io/data-key"
+
+	// dataKeySecretKey and dataKeyIDSecretKey are the keys of the wrapped data key and of the ID of the key
+	// encryption key it was wrapped with in the data key secrets.
+	dataKeySecretKey   = "key"
+	dataKeyIDSecretKey = "keyID"
+)
+
+// dataKeySecretName returns the name of the secret holding the wrapped data key of the cluster.
+func dataKeySecretName(cluster *clusterv1.Cluster) string {
+	return cluster.Name + "-bootstrap-data-key"
+}
+
+// encryptBootstrapData encrypts the bootstrap data with the data key of the cluster.
+func (r *KubeadmConfigReconciler) encryptBootstrapData(ctx context.Context, cluster *clusterv1.Cluster, data []byte) ([]byte, error) {
+	dataKey, err := r.clusterDataKey(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Seal(dataKey, data)
+}
+
+// clusterDataKey returns the data key of the cluster, generating it and storing it wrapped with the key encryption
+// key if absent. The secret is owned by the Cluster, so that the key is shared by all its machines.
+func (r *KubeadmConfigReconciler) clusterDataKey(ctx context.Context, cluster *clusterv1.Cluster) ([]byte, error) {
+	name := dataKeySecretName(cluster)
+	s := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: name}, s)
+	if apierrors.IsNotFound(err) {
+		dataKey, err := envelope.NewDataKey()
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := r.BootstrapDataKeyWrapper.WrapKey(dataKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to wrap data key of Cluster %s/%s", cluster.Namespace, cluster.Name)
+		}
+
+		s = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cluster.Namespace,
+				Labels: map[string]string{
+					clusterv1.MachineClusterLabelName: cluster.Name,
+				},
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: clusterv1.GroupVersion.String(),
+						Kind:       "Cluster",
+						Name:       cluster.Name,
+						UID:        cluster.UID,
+					},
+				},
+			},
+			Type: dataKeySecretType,
+			Data: map[string][]byte{
+				dataKeySecretKey:   wrapped,
+				dataKeyIDSecretKey: []byte(r.BootstrapDataKeyWrapper.KeyID()),
+			},
+		}
+		if err := r.Create(ctx, s); err != nil {
+			// another config of the cluster may have created the key first; it is used on the next attempt
+			return nil, errors.Wrapf(err, "failed to create data key secret %s/%s", cluster.Namespace, name)
+		}
+		return dataKey, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get data key secret %s/%s", cluster.Namespace, name)
+	}
+
+	if keyID := string(s.Data[dataKeyIDSecretKey]); keyID != r.BootstrapDataKeyWrapper.KeyID() {
+		return nil, errors.Errorf("data key secret %s/%s is wrapped with key %q, but the key encryption key is %q", cluster.Namespace, name, keyID, r.BootstrapDataKeyWrapper.KeyID())
+	}
+	dataKey, err := r.BootstrapDataKeyWrapper.UnwrapKey(s.Data[dataKeySecretKey])
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to unwrap data key of Cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	return dataKey, nil
+}
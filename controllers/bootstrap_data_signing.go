@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/signing"
+)
+
+const (
+	// BootstrapDataChecksumAnnotation is set on the secrets holding bootstrap data to the SHA-256 checksum of the
+	// bootstrap data, before encryption.
+	BootstrapDataChecksumAnnotation = "bootstrap.cluster.x-k8s.io/checksum"
+
+	// BootstrapDataSignatureAnnotation is set on the secrets holding signed bootstrap data to the base64 encoded
+	// signature of the bootstrap data, without its embedded signature line.
+	BootstrapDataSignatureAnnotation = "bootstrap.cluster.x-k8s.io/signature"
+
+	// BootstrapDataSigningKeyAnnotation is set on the secrets holding signed bootstrap data to the fingerprint of the
+	// public key verifying the signature.
+	BootstrapDataSigningKeyAnnotation = "bootstrap.cluster.x-k8s.io/signing-key-id"
+)
+
+// bootstrapDataChecksum returns the checksum of the bootstrap data.
+func bootstrapDataChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// signBootstrapData signs the bootstrap data of the config, and returns the data along with the annotations of the
+// signature. Cloud-config documents and join scripts embed the signature as their last line, which is a comment, so
+// that machines can verify them; JSON documents cannot, and are only signed in the annotations.
+func signBootstrapData(signer crypto.Signer, config *bootstrapv1.KubeadmConfig, data []byte) ([]byte, map[string]string, error) {
+	keyID, err := signing.KeyID(signer.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var signature []byte
+	if config.Spec.Format == bootstrapv1.JSON {
+		signature, err = signing.Sign(signer, data)
+	} else {
+		data, signature, err = signing.SignEmbedded(signer, data)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, map[string]string{
+		BootstrapDataSignatureAnnotation:  base64.StdEncoding.EncodeToString(signature),
+		BootstrapDataSigningKeyAnnotation: keyID,
+	}, nil
+}
+
+// verifiesSignature returns whether the bootstrap data of the config verifies its own signature on the machine. Only
+// cloud-config bootstrap data of Linux machines is verified, as it is the only one read back by cloud-init from
+// user-data.txt with its signature line.
+func (r *KubeadmConfigReconciler) verifiesSignature(config *bootstrapv1.KubeadmConfig) bool {
+	if !r.BootstrapDataSignatureVerifier || r.BootstrapDataSigner == nil {
+		return false
+	}
+	return (config.Spec.Format == "" || config.Spec.Format == bootstrapv1.CloudConfig) && config.Spec.OSFamily != bootstrapv1.Windows
+}
@@ -0,0 +1,342 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/bootstrapdata"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/envelope"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/signing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_StoreBootstrapData(t *testing.T) {
+	testcases := []struct {
+		name                       string
+		disableLegacyBootstrapData bool
+		encrypt                    bool
+	}{
+		{
+			name: "with legacy bootstrap data",
+		},
+		{
+			name:                       "without legacy bootstrap data",
+			disableLegacyBootstrapData: true,
+		},
+		{
+			name:    "with envelope encryption",
+			encrypt: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := newCluster("cluster")
+			machine := newMachine(cluster, "machine")
+			config := newKubeadmConfig(machine, "cfg")
+
+			k := &KubeadmConfigReconciler{
+				Log:                        log.Log,
+				Client:                     newFakeClientWithScheme(setupScheme()),
+				DisableLegacyBootstrapData: tc.disableLegacyBootstrapData,
+			}
+			if tc.encrypt {
+				wrapper, err := envelope.NewAESKeyWrapper(bytes.Repeat([]byte("k"), 32))
+				if err != nil {
+					t.Fatal(err)
+				}
+				k.BootstrapDataKeyWrapper = wrapper
+			}
+
+			// store twice to verify an existing secret is updated
+			for _, data := range []string{"first", "second"} {
+				if err := k.storeBootstrapData(context.Background(), cluster, config, workerJoinConfigType, []byte(data), nil); err != nil {
+					t.Fatalf("Failed to store bootstrap data:\n %+v", err)
+				}
+			}
+
+			if !config.Status.Ready {
+				t.Fatal("expected the config to be ready")
+			}
+			if config.Status.DataSecretName == nil || *config.Status.DataSecretName != config.Name {
+				t.Fatalf("expected DataSecretName %q, got %v", config.Name, config.Status.DataSecretName)
+			}
+			legacy := !tc.disableLegacyBootstrapData && !tc.encrypt
+			if !legacy && config.Status.BootstrapData != nil {
+				t.Fatal("did not expect BootstrapData to be set")
+			}
+			if legacy && string(config.Status.BootstrapData) != "second" {
+				t.Fatalf("expected BootstrapData %q, got %q", "second", config.Status.BootstrapData)
+			}
+
+			s := &corev1.Secret{}
+			if err := k.Get(context.Background(), client.ObjectKey{Namespace: config.Namespace, Name: config.Name}, s); err != nil {
+				t.Fatalf("expected bootstrap data secret to exist: %v", err)
+			}
+			data := s.Data[bootstrapDataSecretKey]
+			if tc.encrypt {
+				if s.Annotations[BootstrapDataEncryptionAnnotation] != envelope.Algorithm || s.Annotations[BootstrapDataKeySecretAnnotation] != dataKeySecretName(cluster) {
+					t.Fatalf("expected encryption annotations, got %v", s.Annotations)
+				}
+				keySecret := &corev1.Secret{}
+				if err := k.Get(context.Background(), client.ObjectKey{Namespace: cluster.Namespace, Name: dataKeySecretName(cluster)}, keySecret); err != nil {
+					t.Fatalf("expected data key secret to exist: %v", err)
+				}
+				dataKey, err := k.BootstrapDataKeyWrapper.UnwrapKey(keySecret.Data[dataKeySecretKey])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if data, err = envelope.Open(dataKey, data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if string(data) != "second" {
+				t.Fatalf("expected secret data %q, got %q", "second", data)
+			}
+			if checksum := s.Annotations[BootstrapDataChecksumAnnotation]; checksum != bootstrapDataChecksum([]byte("second")) {
+				t.Fatalf("expected the checksum of the bootstrap data, got %q", checksum)
+			}
+			if !hasBootstrapData(machine, config) {
+				t.Fatal("expected the config to have bootstrap data")
+			}
+		})
+	}
+}
+
+func TestKubeadmConfigReconciler_StoreSignedBootstrapData(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, err := signing.KeyID(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []bootstrapv1.Format{bootstrapv1.CloudConfig, bootstrapv1.JoinScript, bootstrapv1.JSON} {
+		format := format
+		t.Run(string(format), func(t *testing.T) {
+			cluster := newCluster("cluster")
+			machine := newMachine(cluster, "machine")
+			config := newKubeadmConfig(machine, "cfg")
+			config.Spec.Format = format
+
+			k := &KubeadmConfigReconciler{
+				Log:                 log.Log,
+				Client:              newFakeClientWithScheme(setupScheme()),
+				BootstrapDataSigner: key,
+			}
+			if err := k.storeBootstrapData(context.Background(), cluster, config, workerJoinConfigType, []byte("data"), nil); err != nil {
+				t.Fatalf("Failed to store bootstrap data:\n %+v", err)
+			}
+
+			s := &corev1.Secret{}
+			if err := k.Get(context.Background(), client.ObjectKey{Namespace: config.Namespace, Name: config.Name}, s); err != nil {
+				t.Fatalf("expected bootstrap data secret to exist: %v", err)
+			}
+			data := s.Data[bootstrapDataSecretKey]
+			if !bytes.Equal(config.Status.BootstrapData, data) {
+				t.Errorf("expected the legacy bootstrap data to be signed too, got %q", config.Status.BootstrapData)
+			}
+			if s.Annotations[BootstrapDataSigningKeyAnnotation] != keyID || s.Annotations[BootstrapDataChecksumAnnotation] != bootstrapDataChecksum(data) {
+				t.Errorf("expected signature annotations, got %v", s.Annotations)
+			}
+			signature, err := base64.StdEncoding.DecodeString(s.Annotations[BootstrapDataSignatureAnnotation])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if format == bootstrapv1.JSON {
+				if string(data) != "data" {
+					t.Fatalf("expected JSON bootstrap data without embedded signature, got %q", data)
+				}
+				if err := signing.Verify(key.Public(), data, signature); err != nil {
+					t.Fatalf("expected the signature annotation to be valid: %v", err)
+				}
+				return
+			}
+			if err := signing.VerifyEmbedded(key.Public(), data); err != nil {
+				t.Fatalf("expected the embedded signature to be valid: %v", err)
+			}
+			if err := signing.Verify(key.Public(), []byte("data\n"), signature); err != nil {
+				t.Fatalf("expected the signature annotation to be valid: %v", err)
+			}
+		})
+	}
+}
+
+func TestKubeadmConfigReconciler_VerifiesSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name     string
+		verifier bool
+		format   bootstrapv1.Format
+		osFamily bootstrapv1.OSFamily
+		expected bool
+	}{
+		{name: "verifier disabled", format: bootstrapv1.CloudConfig},
+		{name: "cloud-config", verifier: true, format: bootstrapv1.CloudConfig, expected: true},
+		{name: "default format", verifier: true, expected: true},
+		{name: "join-script", verifier: true, format: bootstrapv1.JoinScript},
+		{name: "json", verifier: true, format: bootstrapv1.JSON},
+		{name: "windows", verifier: true, osFamily: bootstrapv1.Windows},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKubeadmConfig(nil, "cfg")
+			config.Spec.Format = tc.format
+			config.Spec.OSFamily = tc.osFamily
+			k := &KubeadmConfigReconciler{
+				Log:                            log.Log,
+				BootstrapDataSigner:            key,
+				BootstrapDataSignatureVerifier: tc.verifier,
+			}
+			if verified := k.verifiesSignature(config); verified != tc.expected {
+				t.Errorf("expected the signature to be verified: %v, got %v", tc.expected, verified)
+			}
+		})
+	}
+}
+
+func TestKubeadmConfigReconciler_StoreCompressedBootstrapData(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newKubeadmConfig(newMachine(cluster, "machine"), "cfg")
+	k := &KubeadmConfigReconciler{
+		Log:                         log.Log,
+		Client:                      newFakeClientWithScheme(setupScheme()),
+		CompressLegacyBootstrapData: true,
+	}
+	data := []byte(strings.Repeat("#cloud-config\n", 100))
+	if err := k.storeBootstrapData(context.Background(), cluster, config, workerJoinConfigType, data, nil); err != nil {
+		t.Fatalf("Failed to store bootstrap data:\n %+v", err)
+	}
+	if config.Status.BootstrapDataEncoding != bootstrapv1.GzipBootstrapDataEncoding || len(config.Status.BootstrapData) >= len(data) {
+		t.Fatalf("expected the legacy bootstrap data to be compressed, got %d bytes encoded with %q", len(config.Status.BootstrapData), config.Status.BootstrapDataEncoding)
+	}
+	decompressed, err := bootstrapdata.FromStatus(&config.Status)
+	if err != nil || !bytes.Equal(decompressed, data) {
+		t.Errorf("expected the bootstrap data to be decompressed, got %q, %v", decompressed, err)
+	}
+
+	s := &corev1.Secret{}
+	if err := k.Get(context.Background(), client.ObjectKey{Namespace: config.Namespace, Name: config.Name}, s); err != nil {
+		t.Fatalf("expected bootstrap data secret to exist: %v", err)
+	}
+	if !bytes.Equal(s.Data[bootstrapDataSecretKey], data) {
+		t.Error("expected the bootstrap data secret not to be compressed")
+	}
+
+	// the same data is compressed the same way, so that storing it again does not change the status
+	compressed := config.Status.BootstrapData
+	if err := k.storeBootstrapData(context.Background(), cluster, config, workerJoinConfigType, data, nil); err != nil {
+		t.Fatalf("Failed to store bootstrap data:\n %+v", err)
+	}
+	if !bytes.Equal(config.Status.BootstrapData, compressed) {
+		t.Error("expected the compressed bootstrap data to be stable")
+	}
+}
+
+func TestKubeadmConfigReconciler_StoreCompressedBootstrapData_Scripts(t *testing.T) {
+	testcases := []struct {
+		name   string
+		config func(*bootstrapv1.KubeadmConfig)
+	}{
+		{
+			name:   "join script",
+			config: func(c *bootstrapv1.KubeadmConfig) { c.Spec.Format = bootstrapv1.JoinScript },
+		},
+		{
+			name:   "json",
+			config: func(c *bootstrapv1.KubeadmConfig) { c.Spec.Format = bootstrapv1.JSON },
+		},
+		{
+			name:   "node adoption script",
+			config: func(c *bootstrapv1.KubeadmConfig) { c.Spec.AdoptExistingNode = true },
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := newCluster("cluster")
+			config := newKubeadmConfig(newMachine(cluster, "machine"), "cfg")
+			tc.config(config)
+			k := &KubeadmConfigReconciler{
+				Log:                         log.Log,
+				Client:                      newFakeClientWithScheme(setupScheme()),
+				CompressLegacyBootstrapData: true,
+			}
+			data := []byte("#!/bin/sh\n" + strings.Repeat("kubeadm join\n", 100))
+			if err := k.storeBootstrapData(context.Background(), cluster, config, workerJoinConfigType, data, nil); err != nil {
+				t.Fatalf("Failed to store bootstrap data:\n %+v", err)
+			}
+			if config.Status.BootstrapDataEncoding != "" || !bytes.Equal(config.Status.BootstrapData, data) {
+				t.Errorf("expected the bootstrap data not to be compressed, got %d bytes encoded with %q", len(config.Status.BootstrapData), config.Status.BootstrapDataEncoding)
+			}
+		})
+	}
+}
+
+func TestKubeadmConfigReconciler_MarkReady(t *testing.T) {
+	config := newKubeadmConfig(nil, "cfg")
+	config.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute))
+
+	recorder := record.NewFakeRecorder(10)
+	k := &KubeadmConfigReconciler{Log: log.Log, Recorder: recorder}
+
+	k.markReady(config, initConfigType)
+	if !config.Status.Ready || config.Status.ReadyTime == nil {
+		t.Fatalf("expected the config to be ready with a ready time, got %+v", config.Status)
+	}
+	readyTime := *config.Status.ReadyTime
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, BootstrapDataReadyReason) {
+			t.Errorf("expected a %s event, got %q", BootstrapDataReadyReason, event)
+		}
+	default:
+		t.Error("expected an event")
+	}
+
+	// regenerated bootstrap data does not change the ready time
+	k.markReady(config, initConfigType)
+	if !config.Status.ReadyTime.Equal(&readyTime) {
+		t.Errorf("expected the ready time to be kept, got %v", config.Status.ReadyTime)
+	}
+	if len(recorder.Events) != 0 {
+		t.Error("expected no event for a config already ready")
+	}
+}
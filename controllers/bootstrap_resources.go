@@ -0,0 +1,143 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// bootstrapResourcesDir is the directory the bootstrap resources are written to on the first control plane machine.
+	bootstrapResourcesDir = "/etc/kubernetes/bootstrap-resources"
+
+	// defaultBootstrapResourceNamespace is the namespace bootstrap resources are applied to by default.
+	defaultBootstrapResourceNamespace = metav1.NamespaceSystem
+)
+
+// resolveBootstrapResources returns the files holding the bootstrap resources of the config, looked up in the config
+// namespace, and the commands applying them to the workload cluster with the admin kubeconfig, one per resource.
+func (r *KubeadmConfigReconciler) resolveBootstrapResources(ctx context.Context, config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, error) {
+	var files []bootstrapv1.File
+	var commands []string
+	for i, resource := range config.Spec.BootstrapResources {
+		data, object, err := r.getBootstrapResource(ctx, config.Namespace, resource)
+		if err != nil {
+			return nil, nil, err
+		}
+		prefix := fmt.Sprintf("%02d-%s-%s", i, strings.ToLower(string(resource.Kind)), resource.Name)
+
+		var manifests []bootstrapv1.File
+		if resource.Manifests {
+			keys := make([]string, 0, len(data))
+			for k := range data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				manifests = append(manifests, bootstrapResourceFile(path.Join(bootstrapResourcesDir, prefix, k), data[k]))
+			}
+		} else {
+			manifest, err := yaml.Marshal(object)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "failed to marshal bootstrap resource %s %s/%s", resource.Kind, config.Namespace, resource.Name)
+			}
+			manifests = append(manifests, bootstrapResourceFile(path.Join(bootstrapResourcesDir, prefix+".yaml"), manifest))
+		}
+
+		args := []string{adminKubectl, "apply"}
+		for _, manifest := range manifests {
+			args = append(args, "-f", cloudinit.ShellQuote(manifest.Path))
+		}
+		files = append(files, manifests...)
+		commands = append(commands, strings.Join(args, " "))
+	}
+	return files, commands, nil
+}
+
+// getBootstrapResource returns the data of the bootstrap resource, and a copy of the resource in the namespace of
+// the workload cluster it is applied to, without the metadata of the management cluster.
+func (r *KubeadmConfigReconciler) getBootstrapResource(ctx context.Context, namespace string, resource bootstrapv1.BootstrapResource) (map[string][]byte, runtime.Object, error) {
+	key := client.ObjectKey{Namespace: namespace, Name: resource.Name}
+	meta := metav1.ObjectMeta{Namespace: resource.Namespace, Name: resource.Name}
+	if meta.Namespace == "" {
+		meta.Namespace = defaultBootstrapResourceNamespace
+	}
+
+	data := map[string][]byte{}
+	var object runtime.Object
+	switch resource.Kind {
+	case bootstrapv1.SecretBootstrapResource:
+		s := &corev1.Secret{}
+		if err := r.Get(ctx, key, s); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get secret %s for bootstrap resource", key)
+		}
+		data = s.Data
+		object = &corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: meta,
+			Type:       s.Type,
+			Data:       s.Data,
+		}
+	case bootstrapv1.ConfigMapBootstrapResource:
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, key, cm); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get config map %s for bootstrap resource", key)
+		}
+		for k, v := range cm.Data {
+			data[k] = []byte(v)
+		}
+		for k, v := range cm.BinaryData {
+			data[k] = v
+		}
+		object = &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: meta,
+			Data:       cm.Data,
+			BinaryData: cm.BinaryData,
+		}
+	default:
+		return nil, nil, errors.Errorf("unsupported bootstrap resource kind %q", resource.Kind)
+	}
+	if len(data) == 0 {
+		return nil, nil, errors.Errorf("%s %s of bootstrap resource has no data", resource.Kind, key)
+	}
+	return data, object, nil
+}
+
+// bootstrapResourceFile returns the file of a bootstrap resource manifest, readable by root only as it may hold
+// credentials.
+func bootstrapResourceFile(path string, content []byte) bootstrapv1.File {
+	return bootstrapv1.File{
+		Path:        path,
+		Owner:       "root:root",
+		Permissions: "0600",
+		Content:     string(content),
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/yaml"
+)
+
+func TestKubeadmConfigReconciler_ResolveBootstrapResources(t *testing.T) {
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "cloud-credentials",
+			Labels:    map[string]string{"management": "true"},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{"token": []byte("secret-token")},
+	}
+	cni := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "cni",
+		},
+		Data: map[string]string{
+			"2-daemonset.yaml": "kind: DaemonSet",
+			"1-namespace.yaml": "kind: Namespace",
+			"3-configmap.yaml": "kind: ConfigMap",
+		},
+	}
+	empty := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "empty",
+		},
+	}
+
+	testcases := []struct {
+		name             string
+		resources        []bootstrapv1.BootstrapResource
+		expectedPaths    []string
+		expectedCommands []string
+		expectErr        bool
+	}{
+		{
+			name: "no resources",
+		},
+		{
+			name: "resources and manifests are applied in order",
+			resources: []bootstrapv1.BootstrapResource{
+				{Kind: bootstrapv1.ConfigMapBootstrapResource, Name: "cni", Manifests: true},
+				{Kind: bootstrapv1.SecretBootstrapResource, Name: "cloud-credentials", Namespace: "cloud-system"},
+			},
+			expectedPaths: []string{
+				"/etc/kubernetes/bootstrap-resources/00-configmap-cni/1-namespace.yaml",
+				"/etc/kubernetes/bootstrap-resources/00-configmap-cni/2-daemonset.yaml",
+				"/etc/kubernetes/bootstrap-resources/00-configmap-cni/3-configmap.yaml",
+				"/etc/kubernetes/bootstrap-resources/01-secret-cloud-credentials.yaml",
+			},
+			expectedCommands: []string{
+				"kubectl --kubeconfig=/etc/kubernetes/admin.conf apply -f '/etc/kubernetes/bootstrap-resources/00-configmap-cni/1-namespace.yaml' -f '/etc/kubernetes/bootstrap-resources/00-configmap-cni/2-daemonset.yaml' -f '/etc/kubernetes/bootstrap-resources/00-configmap-cni/3-configmap.yaml'",
+				"kubectl --kubeconfig=/etc/kubernetes/admin.conf apply -f '/etc/kubernetes/bootstrap-resources/01-secret-cloud-credentials.yaml'",
+			},
+		},
+		{
+			name: "missing resource",
+			resources: []bootstrapv1.BootstrapResource{
+				{Kind: bootstrapv1.SecretBootstrapResource, Name: "missing"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "resource without data",
+			resources: []bootstrapv1.BootstrapResource{
+				{Kind: bootstrapv1.ConfigMapBootstrapResource, Name: "empty"},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKubeadmConfig(nil, "cfg")
+			config.Spec.BootstrapResources = tc.resources
+
+			k := &KubeadmConfigReconciler{
+				Log:    log.Log,
+				Client: newFakeClientWithScheme(setupScheme(), []runtime.Object{credentials, cni, empty}...),
+			}
+			files, commands, err := k.resolveBootstrapResources(context.Background(), config)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to resolve bootstrap resources:\n %+v", err)
+			}
+			if len(files) != len(tc.expectedPaths) {
+				t.Fatalf("expected %d files, got %d", len(tc.expectedPaths), len(files))
+			}
+			for i, path := range tc.expectedPaths {
+				if files[i].Path != path || files[i].Permissions != "0600" {
+					t.Errorf("expected file %s with permissions 0600, got %s with %s", path, files[i].Path, files[i].Permissions)
+				}
+			}
+			if len(commands) != len(tc.expectedCommands) {
+				t.Fatalf("expected commands %v, got %v", tc.expectedCommands, commands)
+			}
+			for i, command := range tc.expectedCommands {
+				if commands[i] != command {
+					t.Errorf("expected command %q, got %q", command, commands[i])
+				}
+			}
+		})
+	}
+
+	// the copy of a resource drops the metadata of the management cluster
+	config := newKubeadmConfig(nil, "cfg")
+	config.Spec.BootstrapResources = []bootstrapv1.BootstrapResource{{Kind: bootstrapv1.SecretBootstrapResource, Name: "cloud-credentials"}}
+	k := &KubeadmConfigReconciler{Log: log.Log, Client: newFakeClientWithScheme(setupScheme(), credentials)}
+	files, _, err := k.resolveBootstrapResources(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to resolve bootstrap resources:\n %+v", err)
+	}
+	s := &corev1.Secret{}
+	if err := yaml.Unmarshal([]byte(files[0].Content), s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Kind != "Secret" || s.Namespace != "kube-system" || s.Name != credentials.Name || len(s.Labels) != 0 || s.ResourceVersion != "" {
+		t.Errorf("unexpected secret manifest:\n%s", files[0].Content)
+	}
+	if string(s.Data["token"]) != "secret-token" || s.Type != corev1.SecretTypeOpaque {
+		t.Errorf("expected the secret data to be copied, got:\n%s", files[0].Content)
+	}
+}
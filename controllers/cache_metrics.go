@@ -0,0 +1,125 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// DefaultCacheMetricsInterval is the default interval at which the cache metrics are recorded.
+const DefaultCacheMetricsInterval = time.Minute
+
+var (
+	cacheObjectsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cabpk_cache_objects",
+			Help: "Number of objects held by the informer cache of the controller, by kind.",
+		},
+		[]string{"kind"},
+	)
+	cacheSecretDataBytesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cabpk_cache_secret_data_bytes",
+			Help: "Size of the data of the secrets held by the informer cache of the controller.",
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(cacheObjectsGauge, cacheSecretDataBytesGauge)
+}
+
+// CacheMetricsRecorder periodically records the number of objects held by the informer cache for the kinds watched
+// by the KubeadmConfigReconciler, and the size of the cached secrets, which make most of the memory of the
+// controller in large installations.
+type CacheMetricsRecorder struct {
+	// Reader reads from the informer cache.
+	Reader client.Reader
+	Log    logr.Logger
+
+	// Interval is the interval at which the metrics are recorded. Defaults to DefaultCacheMetricsInterval.
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable.
+func (r *CacheMetricsRecorder) Start(stop <-chan struct{}) error {
+	interval := r.Interval
+	if interval == 0 {
+		interval = DefaultCacheMetricsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Record(context.Background()); err != nil {
+			r.Log.Error(err, "failed to record cache metrics")
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection records the metrics of the cache of every replica, not only of the leader.
+func (r *CacheMetricsRecorder) NeedLeaderElection() bool {
+	return false
+}
+
+// Record records the cache metrics once.
+func (r *CacheMetricsRecorder) Record(ctx context.Context) error {
+	secrets := &corev1.SecretList{}
+	for _, list := range []struct {
+		kind string
+		list runtime.Object
+	}{
+		{"KubeadmConfig", &bootstrapv1.KubeadmConfigList{}},
+		{"Machine", &clusterv1.MachineList{}},
+		{"Cluster", &clusterv1.ClusterList{}},
+		{"Secret", secrets},
+	} {
+		if err := r.Reader.List(ctx, list.list); err != nil {
+			return errors.Wrapf(err, "failed to list %s objects", list.kind)
+		}
+		items, err := meta.ExtractList(list.list)
+		if err != nil {
+			return errors.Wrapf(err, "failed to extract %s objects", list.kind)
+		}
+		cacheObjectsGauge.WithLabelValues(list.kind).Set(float64(len(items)))
+	}
+
+	size := 0
+	for _, s := range secrets.Items {
+		for _, data := range s.Data {
+			size += len(data)
+		}
+	}
+	cacheSecretDataBytesGauge.Set(float64(size))
+	return nil
+}
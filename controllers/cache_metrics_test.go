@@ -0,0 +1,53 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestCacheMetricsRecorder(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newWorkerMachine(cluster)
+	config := newWorkerJoinKubeadmConfig(machine)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "secret"},
+		Data:       map[string][]byte{"a": []byte("1234"), "b": []byte("56")},
+	}
+
+	r := &CacheMetricsRecorder{
+		Reader: newFakeClientWithScheme(setupScheme(), cluster, machine, config, secret),
+		Log:    log.Log,
+	}
+	if err := r.Record(context.Background()); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	for _, kind := range []string{"KubeadmConfig", "Machine", "Cluster", "Secret"} {
+		if got := testutil.ToFloat64(cacheObjectsGauge.WithLabelValues(kind)); got != 1 {
+			t.Errorf("expected 1 cached %s, got %v", kind, got)
+		}
+	}
+	if got := testutil.ToFloat64(cacheSecretDataBytesGauge); got != 6 {
+		t.Errorf("expected 6 bytes of cached secret data, got %v", got)
+	}
+}
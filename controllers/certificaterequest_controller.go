@@ -0,0 +1,309 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/secret"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// CertificateRequestSecretType is the type of the secrets holding a certificate signing request
+	// to be signed by one of the certificate authorities of a workload cluster.
+	CertificateRequestSecretType corev1.SecretType = "bootstrap.cluster.x-k8s.io/certificate-request"
+
+	// CertificateRequestDataName is the secret key holding the PEM encoded certificate signing request.
+	CertificateRequestDataName = "tls.csr"
+
+	// CertificateAuthorityDataName is the secret key the signing certificate authority is published to.
+	CertificateAuthorityDataName = "ca.crt"
+
+	// EtcdCertificateRequestSecretType is the type of the secrets requesting a key pair for an etcd host,
+	// signed by the etcd certificate authority of a workload cluster.
+	EtcdCertificateRequestSecretType corev1.SecretType = "bootstrap.cluster.x-k8s.io/etcd-certificate-request"
+
+	// EtcdCertificateRoleAnnotation selects the kind of etcd certificate to generate: "peer", "server" or "client".
+	EtcdCertificateRoleAnnotation = "bootstrap.cluster.x-k8s.io/etcd-role"
+
+	// EtcdCertificateCommonNameAnnotation is the common name of the etcd certificate; defaults to the secret name.
+	EtcdCertificateCommonNameAnnotation = "bootstrap.cluster.x-k8s.io/etcd-common-name"
+
+	// EtcdCertificateSANsAnnotation is a comma separated list of DNS names and IP addresses for the etcd certificate.
+	EtcdCertificateSANsAnnotation = "bootstrap.cluster.x-k8s.io/etcd-sans"
+
+	// CertificateRequestSignerAnnotation selects the certificate authority signing the request:
+	// "ca" (default), "etcd" or "proxy".
+	CertificateRequestSignerAnnotation = "bootstrap.cluster.x-k8s.io/signer"
+
+	// CertificateRequestUsagesAnnotation is a comma separated list of extended key usages for the
+	// signed certificate: "client" (default) and/or "server".
+	CertificateRequestUsagesAnnotation = "bootstrap.cluster.x-k8s.io/usages"
+
+	// CertificateRequestDurationAnnotation is the validity of the signed certificate, e.g. "720h".
+	CertificateRequestDurationAnnotation = "bootstrap.cluster.x-k8s.io/duration"
+
+	// CertificateRequestErrorAnnotation is set when a request cannot be signed.
+	CertificateRequestErrorAnnotation = "bootstrap.cluster.x-k8s.io/error"
+)
+
+var (
+	// DefaultSignedCertificateDuration is the default validity of certificates signed for certificate requests.
+	DefaultSignedCertificateDuration = 365 * 24 * time.Hour
+)
+
+// CertificateRequestReconciler signs certificate requests stored as secrets in the management cluster
+// with the certificate authorities of the workload cluster they are labeled for, and publishes the
+// signed certificate into the same secret. Etcd certificate requests get a key pair generated and
+// signed by the etcd certificate authority, for etcd hosts managed outside of kubeadm.
+//
+// Anyone able to create secrets in the namespace of a cluster can obtain certificates signed by its
+// certificate authorities, so this reconciler should only be enabled where that is acceptable.
+type CertificateRequestReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// Recorder records the conflicts on the fields of the signed secrets, if not nil.
+	Recorder record.EventRecorder
+}
+
+// SetupWithManager sets up the reconciler with the Manager.
+func (r *CertificateRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Secret{}).
+		WithEventFilter(predicate.Funcs{
+			CreateFunc:  func(e event.CreateEvent) bool { return isCertificateRequest(e.Object) },
+			UpdateFunc:  func(e event.UpdateEvent) bool { return isCertificateRequest(e.ObjectNew) },
+			DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+			GenericFunc: func(e event.GenericEvent) bool { return isCertificateRequest(e.Object) },
+		}).
+		Complete(r)
+}
+
+// Reconcile handles certificate request secret events.
+func (r *CertificateRequestReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("secret", req.NamespacedName)
+
+	s := &corev1.Secret{}
+	if err := r.Client.Get(ctx, req.NamespacedName, s); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Ignore secrets that are not certificate requests or have already been signed.
+	if !isCertificateRequest(s) || len(s.Data[secret.TLSCrtDataName]) > 0 {
+		return ctrl.Result{}, nil
+	}
+
+	clusterName, ok := s.Labels[clusterv1.MachineClusterLabelName]
+	if !ok {
+		return ctrl.Result{}, r.rejectRequest(ctx, s, errors.Errorf("missing label %s", clusterv1.MachineClusterLabelName))
+	}
+
+	cluster, err := util.GetClusterByName(ctx, r.Client, s.Namespace, clusterName)
+	if err != nil {
+		if apierrors.IsNotFound(errors.Cause(err)) {
+			log.Info("Cluster does not exist yet, waiting until it is created", "cluster", clusterName)
+			return ctrl.Result{RequeueAfter: currentTunables().RequeueInterval}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	purpose := internalcluster.EtcdCA
+	var usages []x509.ExtKeyUsage
+	var duration time.Duration
+	if s.Type == CertificateRequestSecretType {
+		purpose, usages, duration, err = certificateRequestOptions(s)
+		if err != nil {
+			return ctrl.Result{}, r.rejectRequest(ctx, s, err)
+		}
+	}
+
+	certificates := internalcluster.Certificates{&internalcluster.Certificate{Purpose: purpose}}
+	if err := certsecret.Lookup(ctx, r.Client, cluster, certificates); err != nil {
+		return ctrl.Result{}, err
+	}
+	ca := certificates.GetByPurpose(purpose)
+	if ca.KeyPair == nil || len(ca.KeyPair.Key) == 0 {
+		log.Info("Certificate authority is not available yet, waiting until it is generated", "signer", purpose)
+		return ctrl.Result{RequeueAfter: currentTunables().RequeueInterval}, nil
+	}
+
+	signed := newCertificateRequestIntent(s)
+	signed.Data = map[string][]byte{}
+	if s.Type == EtcdCertificateRequestSecretType {
+		kp, err := newEtcdKeyPair(ca, s)
+		if err != nil {
+			return ctrl.Result{}, r.rejectRequest(ctx, s, err)
+		}
+		signed.Data[secret.TLSCrtDataName] = kp.Cert
+		signed.Data[secret.TLSKeyDataName] = kp.Key
+	} else {
+		cert, err := ca.SignCertificateRequest(s.Data[CertificateRequestDataName], usages, duration)
+		if err != nil {
+			return ctrl.Result{}, r.rejectRequest(ctx, s, err)
+		}
+		signed.Data[secret.TLSCrtDataName] = cert
+	}
+	signed.Data[CertificateAuthorityDataName] = ca.KeyPair.Cert
+	signed.Annotations = map[string]string{InputsHashAnnotation: certificateRequestInputsHash(s, ca.KeyPair.Cert)}
+	if err := applySecret(ctx, r.Client, r.Recorder, signed); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to publish signed certificate for secret %s/%s", s.Namespace, s.Name)
+	}
+	log.Info("Signed certificate request", "cluster", clusterName, "signer", purpose)
+	return ctrl.Result{}, nil
+}
+
+// rejectRequest records why a certificate request cannot be signed on the request itself;
+// the request is not retried until it is updated.
+func (r *CertificateRequestReconciler) rejectRequest(ctx context.Context, s *corev1.Secret, reason error) error {
+	r.Log.Info("Rejecting certificate request", "secret", s.Namespace+"/"+s.Name, "reason", reason.Error())
+	if s.Annotations[CertificateRequestErrorAnnotation] == reason.Error() {
+		return nil
+	}
+	rejected := newCertificateRequestIntent(s)
+	rejected.Annotations = map[string]string{CertificateRequestErrorAnnotation: reason.Error()}
+	return errors.Wrapf(applySecret(ctx, r.Client, r.Recorder, rejected), "failed to reject certificate request %s/%s", s.Namespace, s.Name)
+}
+
+// newCertificateRequestIntent returns the secret to be applied to a certificate request; it only holds the
+// fields managed by the reconciler, so that the request itself is left untouched.
+func newCertificateRequestIntent(s *corev1.Secret) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: s.Namespace,
+			Name:      s.Name,
+		},
+	}
+}
+
+// certificateRequestInputsHash returns the hash of the inputs of a signed certificate request: the request, its
+// signing options and the certificate of the signing certificate authority.
+func certificateRequestInputsHash(s *corev1.Secret, caCert []byte) string {
+	inputs := [][]byte{caCert, s.Data[CertificateRequestDataName]}
+	for _, annotation := range []string{
+		CertificateRequestSignerAnnotation,
+		CertificateRequestUsagesAnnotation,
+		CertificateRequestDurationAnnotation,
+		EtcdCertificateRoleAnnotation,
+		EtcdCertificateCommonNameAnnotation,
+		EtcdCertificateSANsAnnotation,
+	} {
+		inputs = append(inputs, []byte(s.Annotations[annotation]))
+	}
+	return internalcluster.InputsHash(inputs...)
+}
+
+// certificateRequestOptions parses the signing options from the certificate request annotations.
+func certificateRequestOptions(s *corev1.Secret) (internalcluster.Purpose, []x509.ExtKeyUsage, time.Duration, error) {
+	purpose := internalcluster.ClusterCA
+	switch signer := s.Annotations[CertificateRequestSignerAnnotation]; signer {
+	case "", string(internalcluster.ClusterCA):
+	case string(internalcluster.EtcdCA), string(internalcluster.FrontProxyCA):
+		purpose = internalcluster.Purpose(signer)
+	default:
+		return "", nil, 0, errors.Errorf("unsupported signer %q", signer)
+	}
+
+	usages := []x509.ExtKeyUsage{}
+	for _, usage := range strings.Split(s.Annotations[CertificateRequestUsagesAnnotation], ",") {
+		switch strings.TrimSpace(usage) {
+		case "", "client":
+			usages = append(usages, x509.ExtKeyUsageClientAuth)
+		case "server":
+			usages = append(usages, x509.ExtKeyUsageServerAuth)
+		default:
+			return "", nil, 0, errors.Errorf("unsupported usage %q", usage)
+		}
+	}
+
+	duration := currentTunables().SignedCertificateDuration
+	if d, ok := s.Annotations[CertificateRequestDurationAnnotation]; ok {
+		parsed, err := time.ParseDuration(d)
+		if err != nil || parsed <= 0 {
+			return "", nil, 0, errors.Errorf("invalid duration %q", d)
+		}
+		duration = parsed
+	}
+
+	return purpose, usages, duration, nil
+}
+
+func isCertificateRequest(o interface{}) bool {
+	s, ok := o.(*corev1.Secret)
+	return ok && (s.Type == CertificateRequestSecretType || s.Type == EtcdCertificateRequestSecretType)
+}
+
+// newEtcdKeyPair generates a key pair for an etcd host, signed by the etcd certificate authority,
+// according to the etcd certificate request annotations.
+func newEtcdKeyPair(ca *internalcluster.Certificate, s *corev1.Secret) (*certs.KeyPair, error) {
+	var usages []x509.ExtKeyUsage
+	switch role := s.Annotations[EtcdCertificateRoleAnnotation]; role {
+	case "peer", "server":
+		// Like kubeadm, etcd peer and server certificates are used both to serve and to connect to other members.
+		usages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	case "client":
+		usages = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	default:
+		return nil, errors.Errorf("unsupported etcd certificate role %q", role)
+	}
+
+	commonName := s.Annotations[EtcdCertificateCommonNameAnnotation]
+	if commonName == "" {
+		commonName = s.Name
+	}
+
+	altNames := certs.AltNames{}
+	for _, san := range strings.Split(s.Annotations[EtcdCertificateSANsAnnotation], ",") {
+		san = strings.TrimSpace(san)
+		switch {
+		case san == "":
+		case net.ParseIP(san) != nil:
+			altNames.IPs = append(altNames.IPs, net.ParseIP(san))
+		default:
+			altNames.DNSNames = append(altNames.DNSNames, san)
+		}
+	}
+
+	return ca.NewSignedKeyPair(&certs.Config{
+		CommonName: commonName,
+		AltNames:   altNames,
+		Usages:     usages,
+	})
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/secret"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func newCertificateRequestSecret(t *testing.T, cluster *clusterv1.Cluster, annotations map[string]string) *corev1.Secret {
+	key, err := certs.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "provider"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   cluster.Namespace,
+			Name:        "provider-credentials",
+			Labels:      map[string]string{clusterv1.MachineClusterLabelName: cluster.Name},
+			Annotations: annotations,
+		},
+		Type: CertificateRequestSecretType,
+		Data: map[string][]byte{
+			CertificateRequestDataName: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+		},
+	}
+}
+
+func TestCertificateRequestReconciler_Reconcile(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newControlPlaneInitKubeadmConfig(newControlPlaneMachine(cluster, "control-plane"), "control-plane-cfg")
+
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		withCAs       bool
+		expectSigned  bool
+		expectRequeue bool
+		expectUsage   x509.ExtKeyUsage
+	}{
+		{
+			name:         "signs a client certificate with the cluster CA",
+			withCAs:      true,
+			expectSigned: true,
+			expectUsage:  x509.ExtKeyUsageClientAuth,
+		},
+		{
+			name:         "signs a server certificate with the etcd CA",
+			annotations:  map[string]string{CertificateRequestSignerAnnotation: "etcd", CertificateRequestUsagesAnnotation: "server"},
+			withCAs:      true,
+			expectSigned: true,
+			expectUsage:  x509.ExtKeyUsageServerAuth,
+		},
+		{
+			name:        "rejects an unsupported signer",
+			annotations: map[string]string{CertificateRequestSignerAnnotation: "sa"},
+			withCAs:     true,
+		},
+		{
+			name:          "waits for the CA to be generated",
+			expectRequeue: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := newCertificateRequestSecret(t, cluster, tc.annotations)
+			objects := []runtime.Object{cluster, request}
+			if tc.withCAs {
+				objects = append(objects, createSecrets(t, cluster, config)...)
+			}
+			r := &CertificateRequestReconciler{
+				Client: newFakeClientWithScheme(setupScheme(), objects...),
+				Log:    log.Log,
+			}
+
+			result, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: request.Namespace, Name: request.Name}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (result.RequeueAfter > 0) != tc.expectRequeue {
+				t.Fatalf("expected requeue: %v, got %v", tc.expectRequeue, result)
+			}
+
+			updated := &corev1.Secret{}
+			if err := r.Client.Get(context.Background(), types.NamespacedName{Namespace: request.Namespace, Name: request.Name}, updated); err != nil {
+				t.Fatal(err)
+			}
+			signed := updated.Data[secret.TLSCrtDataName]
+			if (len(signed) > 0) != tc.expectSigned {
+				t.Fatalf("expected signed: %v, got secret %v", tc.expectSigned, updated)
+			}
+			if !tc.expectSigned {
+				if !tc.expectRequeue && updated.Annotations[CertificateRequestErrorAnnotation] == "" {
+					t.Errorf("expected the request to be rejected")
+				}
+				return
+			}
+
+			c, err := certs.DecodeCertPEM(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ca, err := certs.DecodeCertPEM(updated.Data[CertificateAuthorityDataName])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.CheckSignatureFrom(ca); err != nil {
+				t.Errorf("certificate is not signed by the published CA: %v", err)
+			}
+			if len(c.ExtKeyUsage) != 1 || c.ExtKeyUsage[0] != tc.expectUsage {
+				t.Errorf("expected usage %v, got %v", tc.expectUsage, c.ExtKeyUsage)
+			}
+			if hash, expected := updated.Annotations[InputsHashAnnotation], certificateRequestInputsHash(request, updated.Data[CertificateAuthorityDataName]); hash != expected {
+				t.Errorf("expected inputs hash %q, got %q", expected, hash)
+			}
+		})
+	}
+}
+
+func TestCertificateRequestReconciler_ReconcileEtcd(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newControlPlaneInitKubeadmConfig(newControlPlaneMachine(cluster, "control-plane"), "control-plane-cfg")
+	request := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      "etcd-0-peer",
+			Labels:    map[string]string{clusterv1.MachineClusterLabelName: cluster.Name},
+			Annotations: map[string]string{
+				EtcdCertificateRoleAnnotation:       "peer",
+				EtcdCertificateCommonNameAnnotation: "etcd-0",
+				EtcdCertificateSANsAnnotation:       "etcd-0.example.com, 10.0.0.10",
+			},
+		},
+		Type: EtcdCertificateRequestSecretType,
+	}
+	objects := append([]runtime.Object{cluster, request}, createSecrets(t, cluster, config)...)
+	r := &CertificateRequestReconciler{
+		Client: newFakeClientWithScheme(setupScheme(), objects...),
+		Log:    log.Log,
+	}
+
+	key := types.NamespacedName{Namespace: request.Namespace, Name: request.Name}
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := &corev1.Secret{}
+	if err := r.Client.Get(context.Background(), key, updated); err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Data[secret.TLSKeyDataName]) == 0 {
+		t.Fatal("expected a private key to be generated")
+	}
+	c, err := certs.DecodeCertPEM(updated.Data[secret.TLSCrtDataName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := certs.DecodeCertPEM(updated.Data[CertificateAuthorityDataName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("certificate is not signed by the published CA: %v", err)
+	}
+
+	etcdCA := &corev1.Secret{}
+	if err := r.Client.Get(context.Background(), types.NamespacedName{Namespace: cluster.Namespace, Name: secret.Name(cluster.Name, "etcd")}, etcdCA); err != nil {
+		t.Fatal(err)
+	}
+	if string(etcdCA.Data[secret.TLSCrtDataName]) != string(updated.Data[CertificateAuthorityDataName]) {
+		t.Error("expected the certificate to be signed by the etcd CA")
+	}
+	if c.Subject.CommonName != "etcd-0" {
+		t.Errorf("expected common name etcd-0, got %q", c.Subject.CommonName)
+	}
+	if len(c.DNSNames) != 1 || c.DNSNames[0] != "etcd-0.example.com" || len(c.IPAddresses) != 1 || c.IPAddresses[0].String() != "10.0.0.10" {
+		t.Errorf("unexpected SANs %v %v", c.DNSNames, c.IPAddresses)
+	}
+	if len(c.ExtKeyUsage) != 2 {
+		t.Errorf("expected server and client usages, got %v", c.ExtKeyUsage)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CertificatesReconciler pre-generates the certificate authorities and keys of each cluster as soon as its
+// infrastructure is ready, so that generating the bootstrap data of its first control plane machine only looks them
+// up. Certificates already present, e.g. supplied by the user, are kept. The etcd CA is still generated by the first
+// control plane machine, as it is supplied by the user for external etcd, and the CA validity of its config does not
+// apply to the pre-generated certificate authorities.
+type CertificatesReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+}
+
+// SetupWithManager sets up the reconciler with the Manager.
+func (r *CertificatesReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("certificates").
+		For(&clusterv1.Cluster{}).
+		Complete(r)
+}
+
+// Reconcile generates the missing certificates of a cluster.
+func (r *CertificatesReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("cluster", req.NamespacedName)
+
+	cluster := &clusterv1.Cluster{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !cluster.DeletionTimestamp.IsZero() || !cluster.Status.InfrastructureReady {
+		return ctrl.Result{}, nil
+	}
+	// initialized and external control planes already have, or never need, certificates generated by CABPK
+	if cluster.Status.ControlPlaneInitialized || externalControlPlane(cluster) {
+		return ctrl.Result{}, nil
+	}
+
+	certificates := internalcluster.NewCertificatesForPregeneration()
+	if err := certsecret.Lookup(ctx, r.Client, cluster, certificates); err != nil {
+		return ctrl.Result{}, err
+	}
+	// a partially written set of certificates is completed, but a mixed one cannot be repaired
+	if err := certificates.ValidateKeyPairs(); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "invalid certificates for Cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	if err := certificates.Generate(); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to generate certificates for Cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	// the certificates generated concurrently by the first control plane machine are used instead of ours
+	if err := certsecret.SaveGenerated(ctx, r.Client, cluster, nil, certificates); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to save certificates for Cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	for _, certificate := range certificates {
+		if certificate.Generated {
+			log.Info("Generated certificate", "purpose", certificate.Purpose)
+		}
+	}
+	return ctrl.Result{}, nil
+}
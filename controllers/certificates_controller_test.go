@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/cluster-api/util/secret"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestCertificatesReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	cluster := newCluster("cluster")
+	myclient := newFakeClientWithScheme(setupScheme(), cluster)
+	r := &CertificatesReconciler{Client: myclient, Log: log.Log}
+	request := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}}
+
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	if _, err := certsecret.Get(ctx, myclient, cluster, internalcluster.ClusterCA); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected no certificates before the infrastructure is ready, got %v", err)
+	}
+
+	cluster.Status.InfrastructureReady = true
+	if err := myclient.Update(ctx, cluster); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	generated := map[internalcluster.Purpose][]byte{}
+	for _, purpose := range []internalcluster.Purpose{internalcluster.ClusterCA, internalcluster.ServiceAccount, internalcluster.FrontProxyCA} {
+		s, err := certsecret.Get(ctx, myclient, cluster, purpose)
+		if err != nil {
+			t.Fatalf("expected the %s certificate to be generated: %v", purpose, err)
+		}
+		if len(s.OwnerReferences) != 1 || s.OwnerReferences[0].Kind != "Cluster" || s.OwnerReferences[0].Name != cluster.Name {
+			t.Errorf("expected the %s secret to be owned by the Cluster, got %v", purpose, s.OwnerReferences)
+		}
+		generated[purpose] = s.Data[secret.TLSCrtDataName]
+	}
+	if _, err := certsecret.Get(ctx, myclient, cluster, internalcluster.EtcdCA); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the etcd CA not to be generated, got %v", err)
+	}
+
+	// the first control plane machine only looks up the pre-generated certificates
+	certificates := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := certsecret.LookupOrGenerate(ctx, myclient, cluster, newKubeadmConfig(newControlPlaneMachine(cluster, "machine"), "cfg"), certificates); err != nil {
+		t.Fatal(err)
+	}
+	for purpose, cert := range generated {
+		if certificate := certificates.GetByPurpose(purpose); certificate.Generated || !bytes.Equal(certificate.KeyPair.Cert, cert) {
+			t.Errorf("expected the pre-generated %s certificate to be used", purpose)
+		}
+	}
+
+	// reconciling again keeps the existing certificates
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	s, err := certsecret.Get(ctx, myclient, cluster, internalcluster.ClusterCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.Data[secret.TLSCrtDataName], generated[internalcluster.ClusterCA]) {
+		t.Error("expected the cluster CA not to be regenerated")
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+const (
+	// CertificatesCAExpiryDaysAnnotation is the Machine annotation overriding Certificates.CAExpiryDays,
+	// so that control plane providers can dictate the certificates policy of the machines they manage.
+	CertificatesCAExpiryDaysAnnotation = "bootstrap.cluster.x-k8s.io/certificates-ca-expiry-days"
+
+	// CertificatesExpiryDaysAnnotation is the Machine annotation overriding Certificates.ExpiryDays.
+	CertificatesExpiryDaysAnnotation = "bootstrap.cluster.x-k8s.io/certificates-expiry-days"
+
+	// CertificatesRenewBeforeDaysAnnotation is the Machine annotation overriding Certificates.RenewBeforeDays.
+	CertificatesRenewBeforeDaysAnnotation = "bootstrap.cluster.x-k8s.io/certificates-renew-before-days"
+
+	// kubeadmCertificateValidityDays is the validity of the certificates kubeadm signs, which cannot be configured.
+	kubeadmCertificateValidityDays = 365
+
+	certificatesRenewalScriptName = "kubeadm-renew-certs.sh"
+	certificatesRenewalUnit       = "kubeadm-renew-certs"
+
+	// certificatesRenewalScript renews the kubeadm managed certificates once the API server certificate expires
+	// within the given number of seconds, and restarts the control plane containers, which the kubelet recreates
+	// from the static pod manifests with the renewed certificates.
+	certificatesRenewalScript = `#!/bin/sh
+set -e
+if openssl x509 -checkend %d -noout -in /etc/kubernetes/pki/apiserver.crt >/dev/null; then
+  exit 0
+fi
+kubeadm alpha certs renew all
+for component in kube-apiserver kube-controller-manager kube-scheduler etcd; do
+  crictl ps --name "$component" -q | xargs -r crictl stop
+done
+`
+
+	certificatesRenewalService = `[Unit]
+Description=Renew the kubeadm certificates before they expire
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`
+
+	certificatesRenewalTimer = `[Unit]
+Description=Check the expiry of the kubeadm certificates daily
+
+[Timer]
+OnCalendar=daily
+RandomizedDelaySec=1h
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`
+)
+
+// certificatesPolicy returns the certificates policy of the config, overridden field by field by the certificates
+// annotations of its Machine. The returned policy is never nil.
+func certificatesPolicy(machine *clusterv1.Machine, config *bootstrapv1.KubeadmConfig) (*bootstrapv1.CertificatesPolicy, error) {
+	policy := &bootstrapv1.CertificatesPolicy{}
+	if config.Spec.Certificates != nil {
+		policy = config.Spec.Certificates.DeepCopy()
+	}
+	for _, override := range []struct {
+		annotation string
+		field      **int32
+	}{
+		{CertificatesCAExpiryDaysAnnotation, &policy.CAExpiryDays},
+		{CertificatesExpiryDaysAnnotation, &policy.ExpiryDays},
+		{CertificatesRenewBeforeDaysAnnotation, &policy.RenewBeforeDays},
+	} {
+		value, ok := machine.Annotations[override.annotation]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || n < 1 {
+			return nil, errors.Errorf("annotation %s of Machine %s/%s must be a positive number of days, got %q", override.annotation, machine.Namespace, machine.Name, value)
+		}
+		d := int32(n)
+		*override.field = &d
+	}
+	if policy.RenewBeforeDays != nil && *policy.RenewBeforeDays >= kubeadmCertificateValidityDays {
+		return nil, errors.Errorf("renewBeforeDays must be lower than %d, the validity of the kubeadm certificates, got %d", kubeadmCertificateValidityDays, *policy.RenewBeforeDays)
+	}
+	return policy, nil
+}
+
+// days returns the duration of the given number of days, or zero if unset.
+func days(n *int32) time.Duration {
+	if n == nil {
+		return 0
+	}
+	return time.Duration(*n) * 24 * time.Hour
+}
+
+// setCAValidity sets the validity of the certificate authorities generated for the cluster.
+func setCAValidity(certificates internalcluster.Certificates, policy *bootstrapv1.CertificatesPolicy) {
+	for _, certificate := range certificates {
+		certificate.Validity = days(policy.CAExpiryDays)
+	}
+}
+
+// certificatesRenewal returns the files and the commands installing a systemd timer renewing the certificates of
+// the control plane machine of the config, or nothing if the policy does not renew certificates.
+func certificatesRenewal(config *bootstrapv1.KubeadmConfig, policy *bootstrapv1.CertificatesPolicy) ([]bootstrapv1.File, []string) {
+	if policy.RenewBeforeDays == nil {
+		return nil, nil
+	}
+	renewalScriptPath := scriptPath(config, certificatesRenewalScriptName)
+	files := []bootstrapv1.File{
+		{
+			Path:        renewalScriptPath,
+			Owner:       "root:root",
+			Permissions: "0700",
+			Content:     fmt.Sprintf(certificatesRenewalScript, int64(days(policy.RenewBeforeDays)/time.Second)),
+		},
+		{
+			Path:        "/etc/systemd/system/" + certificatesRenewalUnit + ".service",
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     fmt.Sprintf(certificatesRenewalService, renewalScriptPath),
+		},
+		{
+			Path:        "/etc/systemd/system/" + certificatesRenewalUnit + ".timer",
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     certificatesRenewalTimer,
+		},
+	}
+	commands := []string{
+		"systemctl daemon-reload",
+		"systemctl enable --now " + certificatesRenewalUnit + ".timer",
+	}
+	return files, commands
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	"sigs.k8s.io/cluster-api/util/certs"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestCertificatesPolicy(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newControlPlaneMachine(cluster, "control-plane-machine")
+	config := newControlPlaneInitKubeadmConfig(machine, "control-plane-cfg")
+
+	policy, err := certificatesPolicy(machine, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.CAExpiryDays != nil || policy.ExpiryDays != nil || policy.RenewBeforeDays != nil {
+		t.Errorf("expected an empty policy, got %+v", policy)
+	}
+
+	config.Spec.Certificates = &bootstrapv1.CertificatesPolicy{
+		CAExpiryDays: int32Ptr(1000),
+		ExpiryDays:   int32Ptr(90),
+	}
+	machine.Annotations = map[string]string{
+		CertificatesExpiryDaysAnnotation:      "30",
+		CertificatesRenewBeforeDaysAnnotation: "14",
+	}
+	policy, err = certificatesPolicy(machine, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *policy.CAExpiryDays != 1000 || *policy.ExpiryDays != 30 || *policy.RenewBeforeDays != 14 {
+		t.Errorf("expected the annotations to override the spec, got %+v", policy)
+	}
+	if *config.Spec.Certificates.ExpiryDays != 90 {
+		t.Error("expected the spec not to be modified")
+	}
+
+	for _, value := range []string{"0", "-1", "soon", "9999999999"} {
+		machine.Annotations = map[string]string{CertificatesCAExpiryDaysAnnotation: value}
+		if _, err := certificatesPolicy(machine, config); err == nil {
+			t.Errorf("expected an error for annotation value %q", value)
+		}
+	}
+
+	machine.Annotations = map[string]string{CertificatesRenewBeforeDaysAnnotation: "365"}
+	if _, err := certificatesPolicy(machine, config); err == nil {
+		t.Error("expected an error renewing certificates every day")
+	}
+}
+
+func TestCertificatesRenewal(t *testing.T) {
+	config := newKubeadmConfig(nil, "cfg")
+	if files, commands := certificatesRenewal(config, &bootstrapv1.CertificatesPolicy{}); len(files) != 0 || len(commands) != 0 {
+		t.Errorf("expected no renewal, got %+v %v", files, commands)
+	}
+
+	files, commands := certificatesRenewal(config, &bootstrapv1.CertificatesPolicy{RenewBeforeDays: int32Ptr(30)})
+	if len(files) != 3 {
+		t.Fatalf("expected the script, service and timer files, got %+v", files)
+	}
+	if files[0].Path != "/usr/local/bin/kubeadm-renew-certs.sh" || !strings.Contains(files[0].Content, "-checkend 2592000 ") {
+		t.Errorf("unexpected renewal script %+v", files[0])
+	}
+	if len(commands) != 2 || commands[1] != "systemctl enable --now kubeadm-renew-certs.timer" {
+		t.Errorf("unexpected commands %v", commands)
+	}
+}
+
+func TestKubeadmConfigReconciler_Reconcile_CertificatesPolicy(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+
+	controlPlaneInitMachine := newControlPlaneMachine(cluster, "control-plane-init-machine")
+	controlPlaneInitMachine.Annotations = map[string]string{
+		CertificatesCAExpiryDaysAnnotation:    "100",
+		CertificatesRenewBeforeDaysAnnotation: "30",
+	}
+	controlPlaneInitConfig := newControlPlaneInitKubeadmConfig(controlPlaneInitMachine, "control-plane-init-cfg")
+
+	objects := []runtime.Object{
+		cluster,
+		controlPlaneInitMachine,
+		controlPlaneInitConfig,
+	}
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	k := &KubeadmConfigReconciler{
+		Log:             log.Log,
+		Client:          myclient,
+		KubeadmInitLock: &myInitLocker{},
+	}
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "control-plane-init-cfg",
+		},
+	}
+	if _, err := k.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+
+	cfg, err := getKubeadmConfig(myclient, "control-plane-init-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Status.Ready {
+		t.Fatal("Expected status ready")
+	}
+	if !bytes.Contains(cfg.Status.BootstrapData, []byte("systemctl enable --now kubeadm-renew-certs.timer")) {
+		t.Errorf("expected the certificates renewal timer to be enabled, got:\n%s", cfg.Status.BootstrapData)
+	}
+
+	certificates := internalcluster.Certificates{&internalcluster.Certificate{Purpose: internalcluster.ClusterCA}}
+	if err := certsecret.Lookup(context.Background(), myclient, cluster, certificates); err != nil {
+		t.Fatal(err)
+	}
+	if err := certificates.EnsureAllExist(); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := certs.DecodeCertPEM(certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.NotAfter.After(time.Now().Add(100 * 24 * time.Hour)) {
+		t.Errorf("expected the cluster CA to expire within 100 days, got %v", ca.NotAfter)
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// circuitBreakerThreshold is the number of consecutive failed calls to a workload cluster after which its
+	// circuit breaker opens.
+	circuitBreakerThreshold = 5
+	// circuitBreakerBaseBackoff is the time the circuit breaker of a workload cluster stays open when it trips,
+	// doubled for every failed call made once it lets calls through again, up to circuitBreakerMaxBackoff.
+	circuitBreakerBaseBackoff = 15 * time.Second
+	circuitBreakerMaxBackoff  = 5 * time.Minute
+
+	// remoteCallAttempts is the number of attempts of a call to a workload cluster failing with a transient error.
+	remoteCallAttempts = 3
+	// remoteCallRetryBackoff is the wait before the second attempt of a call, doubled before every further attempt.
+	remoteCallRetryBackoff = 250 * time.Millisecond
+)
+
+// workloadClusterCircuits are the circuit breakers of the calls made to workload clusters.
+var workloadClusterCircuits = newCircuitBreakers()
+
+// circuitBreakers track the consecutive failed calls to each workload cluster, and fail the calls to the clusters
+// failing repeatedly fast, so that a single unreachable cluster does not hold the reconcile workers and flood the logs.
+type circuitBreakers struct {
+	mu       sync.Mutex
+	clusters map[types.NamespacedName]*circuit
+	now      func() time.Time
+}
+
+// circuit is the state of the circuit breaker of a workload cluster.
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	lastErr   string
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{clusters: map[types.NamespacedName]*circuit{}, now: time.Now}
+}
+
+// allow returns a circuitOpenError if the circuit breaker of the cluster is open. Once it has been open for its
+// backoff, calls are let through again, and the first one failing opens it again for twice as long.
+func (b *circuitBreakers) allow(cluster types.NamespacedName) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.clusters[cluster]
+	if !ok {
+		return nil
+	}
+	if remaining := c.openUntil.Sub(b.now()); remaining > 0 {
+		return &circuitOpenError{cluster: cluster, failures: c.failures, retryAfter: remaining, lastErr: c.lastErr}
+	}
+	return nil
+}
+
+// record records the outcome of a call to the cluster: a success closes its circuit breaker, and a failure opens it
+// once the cluster failed circuitBreakerThreshold calls in a row.
+func (b *circuitBreakers) record(cluster types.NamespacedName, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.clusters, cluster)
+		return
+	}
+	c, ok := b.clusters[cluster]
+	if !ok {
+		c = &circuit{}
+		b.clusters[cluster] = c
+	}
+	c.failures++
+	c.lastErr = err.Error()
+	if c.failures >= circuitBreakerThreshold {
+		c.openUntil = b.now().Add(circuitBackoff(c.failures))
+	}
+}
+
+// isOpen returns true if the calls to the cluster currently fail fast.
+func (b *circuitBreakers) isOpen(cluster types.NamespacedName) bool {
+	return b.allow(cluster) != nil
+}
+
+// circuitBackoff returns the time a circuit breaker stays open after the given number of consecutive failures.
+func circuitBackoff(failures int) time.Duration {
+	backoff := circuitBreakerBaseBackoff
+	for i := circuitBreakerThreshold; i < failures && backoff < circuitBreakerMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > circuitBreakerMaxBackoff {
+		backoff = circuitBreakerMaxBackoff
+	}
+	return backoff
+}
+
+// circuitOpenError is returned for the calls to a workload cluster whose circuit breaker is open.
+type circuitOpenError struct {
+	cluster    types.NamespacedName
+	failures   int
+	retryAfter time.Duration
+	lastErr    string
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("calls to workload cluster %s are suspended for %s after %d consecutive failures, last error: %s",
+		e.cluster, e.retryAfter.Round(time.Second), e.failures, e.lastErr)
+}
+
+// breakCircuit makes the requests sent with the configuration fail fast while the circuit breaker of the cluster is
+// open, retries them on transient errors, and records their outcome in the circuit breaker.
+func breakCircuit(circuits *circuitBreakers, cluster types.NamespacedName, config *rest.Config) {
+	wrap := config.WrapTransport
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return &circuitRoundTripper{circuits: circuits, cluster: cluster, delegate: rt}
+	}
+}
+
+// circuitRoundTripper sends the requests to a workload cluster through its circuit breaker.
+type circuitRoundTripper struct {
+	circuits *circuitBreakers
+	cluster  types.NamespacedName
+	delegate http.RoundTripper
+}
+
+func (t *circuitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.circuits.allow(t.cluster); err != nil {
+		return nil, err
+	}
+
+	backoff := remoteCallRetryBackoff
+	for attempt := 1; ; attempt++ {
+		res, err := t.delegate.RoundTrip(req)
+		failure := transientFailure(res, err)
+		if failure == nil || attempt == remoteCallAttempts || !retryable(req, err) {
+			// calls cancelled with their reconciliation say nothing about the cluster
+			if req.Context().Err() == nil {
+				t.circuits.record(t.cluster, failure)
+			}
+			return res, err
+		}
+		if res != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.WithContext(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// transientFailure returns the error of a call failing for a reason that may go away when retried: the workload
+// cluster cannot be reached, is throttling, or is unavailable. Other errors, e.g. not found, are answers.
+func transientFailure(res *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return errors.Errorf("workload cluster answered %s", res.Status)
+	}
+	return nil
+}
+
+// retryable returns true if the request can be sent again: idempotent requests always can, others only when they
+// did not reach the workload cluster, e.g. the creation of a bootstrap token on a cluster refusing connections.
+func retryable(req *http.Request, err error) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	if opErr, ok := errors.Cause(err).(*net.OpError); ok {
+		return opErr.Op == "dial"
+	}
+	return false
+}
+
+// reconcileWorkloadClusterCircuit sets the WorkloadClusterCircuitOpen condition of a config whose reconciliation failed
+// because the circuit breaker of its workload cluster is open, and requeues it once the breaker lets calls through
+// again instead of failing. The condition is cleared by the first reconciliation succeeding with the breaker closed.
+func (r *KubeadmConfigReconciler) reconcileWorkloadClusterCircuit(ctx context.Context, config *bootstrapv1.KubeadmConfig, cluster types.NamespacedName, result ctrl.Result, err error) (ctrl.Result, error) {
+	openErr := circuitOpenCause(err)
+	open := openErr != nil
+	condition := getCondition(config, bootstrapv1.WorkloadClusterCircuitOpenCondition)
+	if !open && (err != nil || condition == nil || condition.Status != corev1.ConditionTrue || workloadClusterCircuits.isOpen(cluster)) {
+		return result, err
+	}
+
+	patchHelper, patchErr := patch.NewHelper(config, r)
+	if patchErr != nil {
+		return ctrl.Result{}, patchErr
+	}
+	if !open {
+		setCondition(config, bootstrapv1.WorkloadClusterCircuitOpenCondition, corev1.ConditionFalse, WorkloadClusterCircuitClosedReason, "", metav1.Now())
+		return result, patchHelper.Patch(ctx, config)
+	}
+
+	r.Log.Info(openErr.Error(), "kubeadmconfig", types.NamespacedName{Namespace: config.Namespace, Name: config.Name})
+	message := openErr.Error()
+	if (condition == nil || condition.Status != corev1.ConditionTrue) && r.Recorder != nil {
+		r.Recorder.Event(config, corev1.EventTypeWarning, WorkloadClusterCircuitOpenReason, message)
+	}
+	setCondition(config, bootstrapv1.WorkloadClusterCircuitOpenCondition, corev1.ConditionTrue, WorkloadClusterCircuitOpenReason, message, metav1.Now())
+	result = requeueAfter(config, WorkloadClusterCircuitOpenReason, openErr.retryAfter)
+	return result, patchHelper.Patch(ctx, config)
+}
+
+// circuitOpenCause returns the circuitOpenError the error was caused by, or nil. The errors of the round trippers
+// are wrapped by net/http in a *url.Error, which client-go returns as is and which does not implement Cause.
+func circuitOpenCause(err error) *circuitOpenError {
+	cause := errors.Cause(err)
+	if urlErr, ok := cause.(*url.Error); ok {
+		cause = errors.Cause(urlErr.Err)
+	}
+	openErr, _ := cause.(*circuitOpenError)
+	return openErr
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestCircuitBreakers(t *testing.T) {
+	now := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	circuits := newCircuitBreakers()
+	circuits.now = func() time.Time { return now }
+	cluster := types.NamespacedName{Namespace: "default", Name: "cluster"}
+	failure := errors.New("connection refused")
+
+	for i := 1; i < circuitBreakerThreshold; i++ {
+		circuits.record(cluster, failure)
+	}
+	if err := circuits.allow(cluster); err != nil {
+		t.Fatalf("expected the circuit to be closed below the threshold, got %v", err)
+	}
+
+	circuits.record(cluster, failure)
+	err := circuits.allow(cluster)
+	openErr, ok := err.(*circuitOpenError)
+	if !ok || openErr.retryAfter != circuitBreakerBaseBackoff || openErr.lastErr != failure.Error() {
+		t.Fatalf("expected the circuit to open for %s at the threshold, got %v", circuitBreakerBaseBackoff, err)
+	}
+
+	// once the backoff expired a call is let through, and its failure opens the circuit for twice as long
+	now = now.Add(circuitBreakerBaseBackoff)
+	if err := circuits.allow(cluster); err != nil {
+		t.Fatalf("expected a call to be let through after the backoff, got %v", err)
+	}
+	circuits.record(cluster, failure)
+	if err, ok := circuits.allow(cluster).(*circuitOpenError); !ok || err.retryAfter != 2*circuitBreakerBaseBackoff {
+		t.Fatalf("expected the circuit to open again for %s, got %v", 2*circuitBreakerBaseBackoff, err)
+	}
+
+	// a success closes the circuit
+	now = now.Add(circuitBreakerMaxBackoff)
+	circuits.record(cluster, nil)
+	circuits.record(cluster, failure)
+	if circuits.isOpen(cluster) {
+		t.Error("expected a success to reset the consecutive failures")
+	}
+
+	if backoff := circuitBackoff(100); backoff != circuitBreakerMaxBackoff {
+		t.Errorf("expected the backoff to be capped to %s, got %s", circuitBreakerMaxBackoff, backoff)
+	}
+}
+
+func TestCircuitRoundTripper(t *testing.T) {
+	// A workload cluster API server unavailable for its first calls.
+	var calls, unavailable int32 = 0, 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.AddInt32(&unavailable, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind":"Secret","apiVersion":"v1","metadata":{"name":"bootstrap-token-abcdef"}}`))
+	}))
+	defer server.Close()
+
+	circuits := newCircuitBreakers()
+	cluster := types.NamespacedName{Namespace: "default", Name: "cluster"}
+	config := &rest.Config{Host: server.URL}
+	breakCircuit(circuits, cluster, config)
+	secretsClient, err := typedcorev1.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := secretsClient.Secrets(metav1.NamespaceSystem)
+
+	if _, err := secrets.Get("bootstrap-token-abcdef", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the call to succeed once retried, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected the call to be attempted 3 times, got %d", calls)
+	}
+
+	// creations reaching the cluster are not retried, and the circuit opens after repeated failures
+	atomic.StoreInt32(&calls, 0)
+	atomic.StoreInt32(&unavailable, 100)
+	for i := 0; i < circuitBreakerThreshold; i++ {
+		if _, err := secrets.Create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-abcdef"}}); err == nil {
+			t.Fatal("expected the creation to fail")
+		}
+	}
+	if calls != circuitBreakerThreshold {
+		t.Errorf("expected each creation to be attempted once, got %d calls", calls)
+	}
+	if !circuits.isOpen(cluster) {
+		t.Fatal("expected the circuit to be open")
+	}
+	if _, err := secrets.Get("bootstrap-token-abcdef", metav1.GetOptions{}); err == nil || calls != circuitBreakerThreshold {
+		t.Error("expected the calls to fail fast once the circuit is open")
+	}
+}
+
+func TestCircuitRoundTripperCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	circuits := newCircuitBreakers()
+	cluster := types.NamespacedName{Namespace: "default", Name: "cluster"}
+	config := &rest.Config{Host: server.URL}
+	breakCircuit(circuits, cluster, config)
+	bindContext(ctx, config)
+	secretsClient, err := typedcorev1.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < circuitBreakerThreshold; i++ {
+		secretsClient.Secrets(metav1.NamespaceSystem).Get("bootstrap-token-abcdef", metav1.GetOptions{})
+	}
+	if _, ok := circuits.clusters[cluster]; ok {
+		t.Error("expected the calls cancelled with the reconciliation not to be recorded")
+	}
+}
+
+func TestReconcileWorkloadClusterCircuit(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newWorkerMachine(cluster)
+	config := newKubeadmConfig(machine, "worker-join-cfg")
+	clusterKey := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	recorder := record.NewFakeRecorder(10)
+	k := &KubeadmConfigReconciler{
+		Log:      log.Log,
+		Client:   newFakeClientWithScheme(setupScheme(), config),
+		Recorder: recorder,
+	}
+
+	openErr := &circuitOpenError{cluster: clusterKey, failures: circuitBreakerThreshold, retryAfter: time.Minute, lastErr: "connection refused"}
+	result, err := k.reconcileWorkloadClusterCircuit(context.Background(), config, clusterKey, ctrl.Result{}, errors.Wrap(openErr, "failed to create new bootstrap token"))
+	if err != nil {
+		t.Fatalf("expected the config to be requeued instead of failing, got %v", err)
+	}
+	if result.RequeueAfter != time.Minute || config.Status.LastRequeueReason != WorkloadClusterCircuitOpenReason {
+		t.Errorf("expected the config to be requeued once the circuit lets calls through, got %+v", result)
+	}
+	if condition := getCondition(config, bootstrapv1.WorkloadClusterCircuitOpenCondition); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected the %s condition to be true, got %+v", bootstrapv1.WorkloadClusterCircuitOpenCondition, condition)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected an event to be emitted, got %d", len(recorder.Events))
+	}
+
+	// other errors are returned as is
+	if _, err := k.reconcileWorkloadClusterCircuit(context.Background(), config, clusterKey, ctrl.Result{}, errors.New("boom")); err == nil {
+		t.Error("expected other errors to be returned")
+	}
+
+	if _, err := k.reconcileWorkloadClusterCircuit(context.Background(), config, clusterKey, ctrl.Result{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if condition := getCondition(config, bootstrapv1.WorkloadClusterCircuitOpenCondition); condition.Status != corev1.ConditionFalse || condition.Reason != WorkloadClusterCircuitClosedReason {
+		t.Errorf("expected the %s condition to be false once the circuit is closed, got %+v", bootstrapv1.WorkloadClusterCircuitOpenCondition, condition)
+	}
+}
+
+func TestReconcileWorkloadClusterCircuitWithClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cluster := newCluster("cluster")
+	config := newKubeadmConfig(newWorkerMachine(cluster), "worker-join-cfg")
+	clusterKey := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	circuits := newCircuitBreakers()
+	restConfig := &rest.Config{Host: server.URL}
+	breakCircuit(circuits, clusterKey, restConfig)
+	secretsClient, err := typedcorev1.NewForConfig(restConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := secretsClient.Secrets(metav1.NamespaceSystem)
+	for i := 0; i < circuitBreakerThreshold; i++ {
+		secrets.Create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-abcdef"}})
+	}
+	_, err = secrets.Create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-abcdef"}})
+	if err == nil {
+		t.Fatal("expected the call to fail once the circuit is open")
+	}
+
+	k := &KubeadmConfigReconciler{
+		Log:    log.Log,
+		Client: newFakeClientWithScheme(setupScheme(), config),
+	}
+	result, err := k.reconcileWorkloadClusterCircuit(context.Background(), config, clusterKey, ctrl.Result{}, errors.Wrap(err, "failed to create new bootstrap token"))
+	if err != nil {
+		t.Fatalf("expected the config to be requeued instead of failing, got %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Errorf("expected the config to be requeued once the circuit lets calls through, got %+v", result)
+	}
+	if condition := getCondition(config, bootstrapv1.WorkloadClusterCircuitOpenCondition); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Errorf("expected the %s condition to be true, got %+v", bootstrapv1.WorkloadClusterCircuitOpenCondition, condition)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// ManagementClusterClient labels the metrics of the clients of the management cluster.
+	ManagementClusterClient = "management"
+	// WorkloadClusterClient labels the metrics of the clients of the workload clusters.
+	WorkloadClusterClient = "workload"
+)
+
+var (
+	// WorkloadClusterQPS and WorkloadClusterBurst limit the requests made to a workload cluster during a
+	// reconciliation.
+	WorkloadClusterQPS   float32 = rest.DefaultQPS
+	WorkloadClusterBurst         = rest.DefaultBurst
+
+	clientThrottleSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "cabpk_client_throttle_seconds",
+			Help:    "Time requests waited on the client side rate limiter before being sent.",
+			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 2, 5, 10, 30},
+		},
+		[]string{"client"},
+	)
+	clientWatchesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cabpk_client_watches_total",
+			Help: "Number of watches started.",
+		},
+		[]string{"client"},
+	)
+	clientWatchDisconnectsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cabpk_client_watch_disconnects_total",
+			Help: "Number of watches which failed to start or whose stream ended with an error.",
+		},
+		[]string{"client"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(clientThrottleSeconds, clientWatchesTotal, clientWatchDisconnectsTotal)
+}
+
+// InstrumentRESTConfig limits the requests made with the configuration to qps, with bursts of burst requests, and
+// records the time requests are throttled and the watch disconnects under the given client label. The rate limiter
+// is shared by all the clients created from the configuration.
+func InstrumentRESTConfig(config *rest.Config, client string, qps float32, burst int) {
+	config.QPS = qps
+	config.Burst = burst
+	config.RateLimiter = &meteredRateLimiter{
+		RateLimiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+		client:      client,
+	}
+	wrap := config.WrapTransport
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return &watchMonitoringRoundTripper{client: client, delegate: rt}
+	}
+}
+
+// meteredRateLimiter records the time requests wait on a rate limiter.
+type meteredRateLimiter struct {
+	flowcontrol.RateLimiter
+	client string
+}
+
+func (l *meteredRateLimiter) Accept() {
+	start := time.Now()
+	l.RateLimiter.Accept()
+	clientThrottleSeconds.WithLabelValues(l.client).Observe(time.Since(start).Seconds())
+}
+
+// watchMonitoringRoundTripper counts the watches started, and those which fail or whose stream breaks.
+type watchMonitoringRoundTripper struct {
+	client   string
+	delegate http.RoundTripper
+}
+
+func (t *watchMonitoringRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Get("watch") != "true" {
+		return t.delegate.RoundTrip(req)
+	}
+
+	clientWatchesTotal.WithLabelValues(t.client).Inc()
+	resp, err := t.delegate.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		clientWatchDisconnectsTotal.WithLabelValues(t.client).Inc()
+		return resp, err
+	}
+	resp.Body = &watchBody{ReadCloser: resp.Body, client: t.client}
+	return resp, nil
+}
+
+// watchBody counts a disconnect when reading the stream of a watch fails before the watch is stopped by the client.
+// Streams closed by the API server at the end of the watch timeout end with io.EOF and are not counted.
+type watchBody struct {
+	io.ReadCloser
+	client string
+	// done is set once the watch is stopped or a disconnect is counted.
+	done int32
+}
+
+func (b *watchBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && atomic.CompareAndSwapInt32(&b.done, 0, 1) {
+		clientWatchDisconnectsTotal.WithLabelValues(b.client).Inc()
+	}
+	return n, err
+}
+
+func (b *watchBody) Close() error {
+	atomic.StoreInt32(&b.done, 1)
+	return b.ReadCloser.Close()
+}
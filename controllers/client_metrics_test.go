@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/rest"
+)
+
+func TestInstrumentRESTConfig(t *testing.T) {
+	const client = "test"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") == "true" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	config := &rest.Config{Host: server.URL}
+	InstrumentRESTConfig(config, client, 100, 10)
+	if config.RateLimiter == nil || config.RateLimiter.QPS() != 100 {
+		t.Fatalf("expected a rate limiter with the given QPS, got %v", config.RateLimiter)
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watches := testutil.ToFloat64(clientWatchesTotal.WithLabelValues(client))
+	disconnects := testutil.ToFloat64(clientWatchDisconnectsTotal.WithLabelValues(client))
+	for _, query := range []string{"", "?watch=true", "?watch=true&fail=true"} {
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL + "/api/v1/secrets" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if got := testutil.ToFloat64(clientWatchesTotal.WithLabelValues(client)) - watches; got != 2 {
+		t.Errorf("expected 2 watches to be counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(clientWatchDisconnectsTotal.WithLabelValues(client)) - disconnects; got != 1 {
+		t.Errorf("expected the failed watch to be counted as a disconnect, got %v", got)
+	}
+}
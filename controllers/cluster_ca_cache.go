@@ -0,0 +1,110 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// clusterCAs caches the CA certificates of clusters by the key of their secret, so that the join data of workers,
+// which only needs the CA certificate, is generated without reading and decoding the CA secret for every machine. The
+// CA keys are never cached. An entry is dropped whenever its secret changes. The zero value is ready to use.
+type clusterCAs struct {
+	mu    sync.Mutex
+	certs map[client.ObjectKey][]byte
+	// revision counts the changes of all the CA secrets, so that a certificate read before a change is not cached
+	// after it. A single counter does not grow with the clusters that were deleted.
+	revision uint64
+}
+
+// Get returns the cached CA certificate of the secret, or nil along with the revision to cache it at.
+func (c *clusterCAs) Get(key client.ObjectKey) ([]byte, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.certs[key], c.revision
+}
+
+// Set caches the CA certificate of the secret read at the revision, unless a CA secret changed since.
+func (c *clusterCAs) Set(key client.ObjectKey, cert []byte, revision uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.revision != revision {
+		return
+	}
+	if c.certs == nil {
+		c.certs = map[client.ObjectKey][]byte{}
+	}
+	c.certs[key] = cert
+}
+
+// Invalidate drops the cached CA certificate of the secret, if any.
+func (c *clusterCAs) Invalidate(key client.ObjectKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.revision++
+	delete(c.certs, key)
+}
+
+// EventHandler returns the handler of secret events invalidating the cache. It does not enqueue any request.
+func (c *clusterCAs) EventHandler() handler.EventHandler {
+	invalidate := func(meta metav1.Object) {
+		// only CA secrets are tracked, the other secrets of the clusters change far more often
+		if meta != nil && strings.HasSuffix(meta.GetName(), "-"+string(secret.ClusterCA)) {
+			c.Invalidate(client.ObjectKey{Namespace: meta.GetNamespace(), Name: meta.GetName()})
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(e event.CreateEvent, _ workqueue.RateLimitingInterface) { invalidate(e.Meta) },
+		UpdateFunc: func(e event.UpdateEvent, _ workqueue.RateLimitingInterface) { invalidate(e.MetaNew) },
+		DeleteFunc: func(e event.DeleteEvent, _ workqueue.RateLimitingInterface) { invalidate(e.Meta) },
+	}
+}
+
+// workerCertificates returns the CA of the cluster worker join data is generated with. Its certificate is read from
+// its secret only if it is not cached yet, unless the CA key is needed, e.g. to sign node client certificates. A CA
+// missing its certificate or key is not cached.
+func (r *KubeadmConfigReconciler) workerCertificates(ctx context.Context, cluster *clusterv1.Cluster, caCertPath string, needsKey bool) (internalcluster.Certificates, error) {
+	certificates := internalcluster.NewCertificatesForWorker(caCertPath)
+	key := client.ObjectKey{Namespace: certsecret.PKINamespace(cluster), Name: certsecret.Name(cluster, internalcluster.ClusterCA)}
+	cert, revision := r.clusterCAs.Get(key)
+	if cert != nil && !needsKey {
+		certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair = &certs.KeyPair{Cert: cert}
+		return certificates, nil
+	}
+
+	if err := certsecret.Lookup(ctx, r.Client, cluster, certificates); err != nil {
+		return nil, err
+	}
+	if err := certificates.EnsureAllExist(); err != nil {
+		return nil, err
+	}
+	r.clusterCAs.Set(key, certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair.Cert, revision)
+	return certificates, nil
+}
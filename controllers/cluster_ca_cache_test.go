@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestWorkerCertificatesAreCached(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newKubeadmConfig(newWorkerMachine(cluster), "worker-join-cfg")
+	controlPlaneConfig := newControlPlaneInitKubeadmConfig(newControlPlaneMachine(cluster, "control-plane"), "control-plane-cfg")
+	myclient := newFakeClientWithScheme(setupScheme(), append(createSecrets(t, cluster, controlPlaneConfig), cluster, config)...)
+	k := &KubeadmConfigReconciler{Log: log.Log, Client: myclient}
+
+	certificates, err := k.workerCertificates(context.Background(), cluster, "", false)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair == nil {
+		t.Fatal("expected the cluster CA to be looked up")
+	}
+
+	// the deletion of the secret is not seen until its event is handled
+	key := client.ObjectKey{Namespace: cluster.Namespace, Name: secret.Name(cluster.Name, secret.ClusterCA)}
+	caSecret := &corev1.Secret{}
+	if err := myclient.Get(context.Background(), key, caSecret); err != nil {
+		t.Fatal(err)
+	}
+	if err := myclient.Delete(context.Background(), caSecret); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := k.workerCertificates(context.Background(), cluster, "", false)
+	if err != nil {
+		t.Fatalf("expected the cached CA to be used, got error %v", err)
+	}
+	if keyPair := cached.GetByPurpose(internalcluster.ClusterCA).KeyPair; len(keyPair.Cert) == 0 || len(keyPair.Key) != 0 {
+		t.Error("expected only the CA certificate to be cached")
+	}
+	if _, err := k.workerCertificates(context.Background(), cluster, "", true); err == nil {
+		t.Error("expected the CA to be looked up when its key is needed")
+	}
+
+	k.clusterCAs.EventHandler().Delete(event.DeleteEvent{Meta: caSecret, Object: caSecret}, nil)
+	if _, err := k.workerCertificates(context.Background(), cluster, "", false); err == nil {
+		t.Error("expected the CA to be looked up again once its secret changed")
+	}
+	if len(k.clusterCAs.certs) != 0 {
+		t.Errorf("expected no entry to remain once the secret was deleted, got %v", k.clusterCAs.certs)
+	}
+}
+
+func TestClusterCAsIgnoresStaleCertificates(t *testing.T) {
+	var cache clusterCAs
+	key := client.ObjectKey{Namespace: "default", Name: "cluster-ca"}
+
+	_, revision := cache.Get(key)
+	cache.Invalidate(key)
+	cache.Set(key, []byte("stale"), revision)
+	if cert, _ := cache.Get(key); cert != nil {
+		t.Error("expected a certificate read before a change of its secret not to be cached")
+	}
+
+	_, revision = cache.Get(key)
+	cache.Set(key, []byte("current"), revision)
+	if cert, _ := cache.Get(key); string(cert) != "current" {
+		t.Errorf("expected the certificate to be cached, got %q", cert)
+	}
+
+	// the events of other secrets are ignored
+	other := &corev1.Secret{}
+	other.Namespace, other.Name = "default", "cluster-kubeconfig"
+	cache.EventHandler().Update(event.UpdateEvent{MetaOld: other, ObjectOld: other, MetaNew: other, ObjectNew: other}, nil)
+	if cert, current := cache.Get(key); current != revision || cert == nil {
+		t.Error("expected the changes of other secrets not to be tracked")
+	}
+}
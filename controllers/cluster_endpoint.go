@@ -0,0 +1,33 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+// apiEndpointAddress returns the host:port address of an API endpoint of a Cluster, as used in kubeadm endpoints and
+// URLs. IPv6 hosts are enclosed in brackets, e.g. [fd00::1]:6443, whether or not the infrastructure provider set
+// them with brackets.
+func apiEndpointAddress(endpoint clusterv1.APIEndpoint) string {
+	host := strings.TrimSuffix(strings.TrimPrefix(endpoint.Host, "["), "]")
+	return net.JoinHostPort(host, strconv.Itoa(endpoint.Port))
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestAPIEndpointAddress(t *testing.T) {
+	testcases := []struct {
+		name     string
+		endpoint clusterv1.APIEndpoint
+		expected string
+	}{
+		{name: "ipv4", endpoint: clusterv1.APIEndpoint{Host: "10.0.0.1", Port: 6443}, expected: "10.0.0.1:6443"},
+		{name: "hostname", endpoint: clusterv1.APIEndpoint{Host: "api.example.com", Port: 443}, expected: "api.example.com:443"},
+		{name: "ipv6", endpoint: clusterv1.APIEndpoint{Host: "fd00::1", Port: 6443}, expected: "[fd00::1]:6443"},
+		{name: "bracketed ipv6", endpoint: clusterv1.APIEndpoint{Host: "[fd00::1]", Port: 6443}, expected: "[fd00::1]:6443"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if address := apiEndpointAddress(tc.endpoint); address != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, address)
+			}
+		})
+	}
+}
+
+func newIPv6Cluster() *clusterv1.Cluster {
+	cluster := newCluster("cluster")
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "fd00::1", Port: 6443}}
+	return cluster
+}
+
+func TestReconcileTopLevelObjectSettings_IPv6(t *testing.T) {
+	cluster := newIPv6Cluster()
+	machine := newControlPlaneMachine(cluster, "control-plane")
+	config := newControlPlaneInitKubeadmConfig(machine, "control-plane-cfg")
+
+	k := &KubeadmConfigReconciler{Log: log.Log}
+	k.reconcileTopLevelObjectSettings(cluster, machine, config)
+
+	if endpoint := config.Spec.ClusterConfiguration.ControlPlaneEndpoint; endpoint != "[fd00::1]:6443" {
+		t.Errorf("expected ControlPlaneEndpoint %q, got %q", "[fd00::1]:6443", endpoint)
+	}
+}
+
+func TestReconcileDiscovery_IPv6(t *testing.T) {
+	cluster := newIPv6Cluster()
+	config := newKubeadmConfig(newWorkerMachine(cluster), "worker-join-cfg")
+	config.Spec.JoinConfiguration = &kubeadmv1beta1.JoinConfiguration{
+		Discovery: kubeadmv1beta1.Discovery{
+			BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{CACertHashes: []string{"sha256:abc"}},
+		},
+	}
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               newFakeClientWithScheme(setupScheme()),
+		SecretsClientFactory: newFakeSecretFactory(),
+	}
+	if err := k.reconcileDiscovery(context.Background(), cluster, config, internalcluster.Certificates{}, nil); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if endpoint := config.Spec.JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint; endpoint != "[fd00::1]:6443" {
+		t.Errorf("expected APIServerEndpoint %q, got %q", "[fd00::1]:6443", endpoint)
+	}
+}
+
+func TestServerURLs_IPv6(t *testing.T) {
+	cluster := newIPv6Cluster()
+
+	server, err := kubeconfigServer(cluster)
+	if err != nil || server != "https://[fd00::1]:6443" {
+		t.Errorf("expected the kubeconfig server %q, got %q, %v", "https://[fd00::1]:6443", server, err)
+	}
+
+	server, err = joinServer(cluster, nil)
+	if err != nil || server != "https://[fd00::1]:6443" {
+		t.Errorf("expected the join server %q, got %q, %v", "https://[fd00::1]:6443", server, err)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterConfigMapsClientFactory supports the creation of clients for the ConfigMaps of the kube-public and kube-system
+// namespaces of workload clusters.
+type ClusterConfigMapsClientFactory struct {
+	// AllowedExecCommands are the commands exec credential plugins are allowed to run,
+	// for clusters using the ExecAuth workload cluster auth mode.
+	AllowedExecCommands []string
+}
+
+// NewConfigMapsClient returns a new client supporting ConfigMapInterface for the kube-public namespace of the cluster.
+func (f ClusterConfigMapsClientFactory) NewConfigMapsClient(ctx context.Context, client client.Client, cluster *clusterv1.Cluster) (typedcorev1.ConfigMapInterface, error) {
+	restConfig, err := workloadClusterRESTConfig(ctx, client, cluster, f.AllowedExecCommands)
+	if err != nil {
+		return nil, err
+	}
+
+	corev1Client, err := typedcorev1.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return corev1Client.ConfigMaps(metav1.NamespacePublic), nil
+}
+
+// NewKubeSystemConfigMapsClient returns a new client supporting ConfigMapInterface for the kube-system namespace of
+// the cluster.
+func (f ClusterConfigMapsClientFactory) NewKubeSystemConfigMapsClient(ctx context.Context, client client.Client, cluster *clusterv1.Cluster) (typedcorev1.ConfigMapInterface, error) {
+	restConfig, err := workloadClusterRESTConfig(ctx, client, cluster, f.AllowedExecCommands)
+	if err != nil {
+		return nil, err
+	}
+
+	corev1Client, err := typedcorev1.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return corev1Client.ConfigMaps(metav1.NamespaceSystem), nil
+}
+
+// reconcileClusterInfo checks that the cluster-info ConfigMap used for bootstrap token discovery exists and holds the
+// cluster CA and the API server endpoint, and repairs it if requested. The join data is not generated while the
+// ConfigMap is invalid, as joining machines would fail discovery.
+func (r *KubeadmConfigReconciler) reconcileClusterInfo(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, endpoint string, caCert []byte) error {
+	configMapsClient, err := r.ConfigMapsClientFactory.NewConfigMapsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+
+	cm, err := configMapsClient.Get(clusterInfoConfigMapName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		cm = nil
+	case err != nil:
+		return errors.Wrapf(err, "failed to get ConfigMap %s/%s", metav1.NamespacePublic, clusterInfoConfigMapName)
+	}
+
+	now := metav1.Now()
+	problem := clusterInfoProblem(cm, endpoint, caCert)
+	if problem == "" {
+		if condition := getCondition(config, bootstrapv1.ClusterInfoInvalidCondition); condition != nil {
+			setCondition(config, bootstrapv1.ClusterInfoInvalidCondition, corev1.ConditionFalse, ClusterInfoValidReason, "", now)
+		}
+		return nil
+	}
+
+	if config.Spec.ClusterInfoCheck != bootstrapv1.ClusterInfoRepair {
+		message := fmt.Sprintf("The %s ConfigMap of Cluster %s %s", clusterInfoConfigMapName, cluster.Name, problem)
+		condition := getCondition(config, bootstrapv1.ClusterInfoInvalidCondition)
+		if (condition == nil || condition.Status != corev1.ConditionTrue) && r.Recorder != nil {
+			r.Recorder.Event(config, corev1.EventTypeWarning, ClusterInfoInvalidReason, message)
+		}
+		setCondition(config, bootstrapv1.ClusterInfoInvalidCondition, corev1.ConditionTrue, ClusterInfoInvalidReason, message, now)
+		return errors.Wrap(&capierrors.RequeueAfterError{RequeueAfter: currentTunables().RequeueInterval}, message)
+	}
+
+	kubeconfig, err := clusterInfoKubeconfig(endpoint, caCert)
+	if err != nil {
+		return err
+	}
+	if cm == nil {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      clusterInfoConfigMapName,
+				Namespace: metav1.NamespacePublic,
+			},
+			Data: map[string]string{bootstrapapi.KubeConfigKey: kubeconfig},
+		}
+		if _, err := configMapsClient.Create(cm); err != nil {
+			return errors.Wrapf(err, "failed to create ConfigMap %s/%s", metav1.NamespacePublic, clusterInfoConfigMapName)
+		}
+	} else {
+		// the bootstrap signer signs the updated kubeconfig again for each bootstrap token
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[bootstrapapi.KubeConfigKey] = kubeconfig
+		if _, err := configMapsClient.Update(cm); err != nil {
+			return errors.Wrapf(err, "failed to update ConfigMap %s/%s", metav1.NamespacePublic, clusterInfoConfigMapName)
+		}
+	}
+
+	r.Log.Info("Repaired cluster-info ConfigMap", "cluster", cluster.Name, "problem", problem)
+	setCondition(config, bootstrapv1.ClusterInfoInvalidCondition, corev1.ConditionFalse, ClusterInfoRepairedReason, fmt.Sprintf("The %s ConfigMap %s and was repaired", clusterInfoConfigMapName, problem), now)
+	return nil
+}
+
+// clusterInfoProblem describes why the cluster-info ConfigMap cannot be used for the discovery of the cluster, or
+// returns an empty string if it is valid.
+func clusterInfoProblem(cm *corev1.ConfigMap, endpoint string, caCert []byte) string {
+	if cm == nil {
+		return "does not exist"
+	}
+	data, ok := cm.Data[bootstrapapi.KubeConfigKey]
+	if !ok {
+		return fmt.Sprintf("has no %s key", bootstrapapi.KubeConfigKey)
+	}
+	kubeconfig, err := clientcmd.Load([]byte(data))
+	if err != nil {
+		return fmt.Sprintf("holds an invalid kubeconfig: %v", err)
+	}
+	if len(kubeconfig.Clusters) != 1 {
+		return fmt.Sprintf("holds a kubeconfig with %d clusters instead of 1", len(kubeconfig.Clusters))
+	}
+	for _, c := range kubeconfig.Clusters {
+		if server := "https://" + endpoint; c.Server != server {
+			return fmt.Sprintf("targets server %s instead of %s", c.Server, server)
+		}
+		if !bytes.Equal(bytes.TrimSpace(c.CertificateAuthorityData), bytes.TrimSpace(caCert)) {
+			return "holds a CA certificate that does not match the cluster CA"
+		}
+	}
+	return ""
+}
+
+// clusterInfoKubeconfig returns the kubeconfig published in the cluster-info ConfigMap, as written by kubeadm.
+func clusterInfoKubeconfig(endpoint string, caCert []byte) (string, error) {
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters[""] = &clientcmdapi.Cluster{
+		Server:                   "https://" + endpoint,
+		CertificateAuthorityData: caCert,
+	}
+	data, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to serialize the cluster-info kubeconfig")
+	}
+	return string(data), nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+type fakeConfigMapsClientFactory struct {
+	client typedcorev1.ConfigMapInterface
+}
+
+func (f fakeConfigMapsClientFactory) NewConfigMapsClient(_ context.Context, _ client.Client, _ *clusterv1.Cluster) (typedcorev1.ConfigMapInterface, error) {
+	return f.client, nil
+}
+
+func TestReconcileClusterInfo(t *testing.T) {
+	cluster := newCluster("cluster")
+	caCert := []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")
+	endpoint := "10.0.0.1:6443"
+
+	configMaps := fakeclient.NewSimpleClientset().CoreV1().ConfigMaps(metav1.NamespacePublic)
+	r := &KubeadmConfigReconciler{
+		Log:                     log.Log,
+		ConfigMapsClientFactory: fakeConfigMapsClientFactory{client: configMaps},
+	}
+
+	config := newKubeadmConfig(nil, "cfg")
+	config.Spec.ClusterInfoCheck = bootstrapv1.ClusterInfoValidate
+	err := r.reconcileClusterInfo(context.Background(), cluster, config, endpoint, caCert)
+	if _, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); !ok {
+		t.Fatalf("expected a requeue for a missing cluster-info ConfigMap, got %v", err)
+	}
+	if condition := getCondition(config, bootstrapv1.ClusterInfoInvalidCondition); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Errorf("expected the %s condition to be true, got %+v", bootstrapv1.ClusterInfoInvalidCondition, condition)
+	}
+
+	config.Spec.ClusterInfoCheck = bootstrapv1.ClusterInfoRepair
+	if err := r.reconcileClusterInfo(context.Background(), cluster, config, endpoint, caCert); err != nil {
+		t.Fatalf("expected the cluster-info ConfigMap to be repaired, got %v", err)
+	}
+	if condition := getCondition(config, bootstrapv1.ClusterInfoInvalidCondition); condition.Status != corev1.ConditionFalse || condition.Reason != ClusterInfoRepairedReason {
+		t.Errorf("expected the %s condition to be false after repair, got %+v", bootstrapv1.ClusterInfoInvalidCondition, condition)
+	}
+	cm, err := configMaps.Get(clusterInfoConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problem := clusterInfoProblem(cm, endpoint, caCert); problem != "" {
+		t.Errorf("expected the repaired ConfigMap to be valid, got %q", problem)
+	}
+
+	cm.Data[bootstrapapi.KubeConfigKey], err = clusterInfoKubeconfig("10.0.0.2:6443", caCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problem := clusterInfoProblem(cm, endpoint, caCert); problem == "" {
+		t.Error("expected a ConfigMap targeting another endpoint to be invalid")
+	}
+	if problem := clusterInfoProblem(&corev1.ConfigMap{}, endpoint, caCert); problem == "" {
+		t.Error("expected a ConfigMap without kubeconfig to be invalid")
+	}
+}
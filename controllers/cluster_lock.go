@@ -0,0 +1,56 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// clusterLocks serializes the reconciliations of the configs of a cluster, which share its certificates, init lock and
+// bootstrap tokens, while configs of different clusters are reconciled in parallel. The zero value is ready to use.
+//
+// Only the KubeadmConfigReconciler takes these locks: the CertificatesReconciler, TokenPoolReconciler and
+// TokenSweeperReconciler bypass them, and rely on the certificate secrets being created only if absent, on the
+// conflicts of the token pool secret updates, and on the sweeper only deleting expired or orphaned tokens.
+type clusterLocks struct {
+	mu     sync.Mutex
+	locked map[types.NamespacedName]struct{}
+}
+
+// TryLock locks the cluster and returns true, or returns false if it is already locked. Reconciliations do not wait
+// for the lock, so that the workers stay available for the configs of other clusters.
+func (l *clusterLocks) TryLock(cluster types.NamespacedName) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.locked[cluster]; ok {
+		return false
+	}
+	if l.locked == nil {
+		l.locked = map[types.NamespacedName]struct{}{}
+	}
+	l.locked[cluster] = struct{}{}
+	return true
+}
+
+// Unlock unlocks the cluster.
+func (l *clusterLocks) Unlock(cluster types.NamespacedName) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.locked, cluster)
+}
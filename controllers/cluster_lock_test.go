@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestClusterLocks(t *testing.T) {
+	l := &clusterLocks{}
+	a := types.NamespacedName{Namespace: "default", Name: "a"}
+	b := types.NamespacedName{Namespace: "default", Name: "b"}
+
+	if !l.TryLock(a) {
+		t.Fatal("expected to lock cluster a")
+	}
+	if l.TryLock(a) {
+		t.Fatal("expected cluster a to be locked")
+	}
+	if !l.TryLock(b) {
+		t.Fatal("expected to lock cluster b while cluster a is locked")
+	}
+	l.Unlock(a)
+	if !l.TryLock(a) {
+		t.Fatal("expected to lock cluster a once unlocked")
+	}
+}
+
+func TestKubeadmConfigReconciler_Reconcile_ClusterBusy(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+	}
+	clusterKey := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	k.clusterLocks.TryLock(clusterKey)
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	result, err := k.Reconcile(request)
+	if err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	if !result.Requeue || result.RequeueAfter != 0 {
+		t.Fatalf("expected to requeue while another config of the cluster is reconciled, got %+v", result)
+	}
+
+	k.clusterLocks.Unlock(clusterKey)
+	if _, err := k.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	if !k.clusterLocks.TryLock(clusterKey) {
+		t.Fatal("expected the cluster to be unlocked after the reconciliation")
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cniManifestPath is the path the CNI manifest referenced by the config is written to.
+const cniManifestPath = "/etc/kubernetes/cni/manifest.yaml"
+
+// bundledCNIManifest is the release manifest of a CNI plugin.
+type bundledCNIManifest struct {
+	// url is the URL of the manifest, pinned to a release of the plugin.
+	url string
+
+	// podSubnet is the pod network of the manifest, if it has one.
+	podSubnet string
+}
+
+// bundledCNIManifests are the manifests of the bundled CNI plugins.
+var bundledCNIManifests = map[bootstrapv1.CNIPlugin]bundledCNIManifest{
+	bootstrapv1.CalicoCNIPlugin: {
+		url:       "https://docs.projectcalico.org/v3.10/manifests/calico.yaml",
+		podSubnet: "192.168.0.0/16",
+	},
+	bootstrapv1.CiliumCNIPlugin: {
+		url: "https://raw.githubusercontent.com/cilium/cilium/v1.6/install/kubernetes/quick-install.yaml",
+	},
+	bootstrapv1.FlannelCNIPlugin: {
+		url:       "https://raw.githubusercontent.com/coreos/flannel/v0.11.0/Documentation/kube-flannel.yml",
+		podSubnet: "10.244.0.0/16",
+	},
+}
+
+// resolveCNI returns the file holding the CNI manifest referenced by the config, looked up in the config namespace,
+// and the command applying the manifest to the workload cluster with the admin kubeconfig. Bundled manifests are
+// applied from their URL, and rejected if the pod network of the cluster is not theirs.
+func (r *KubeadmConfigReconciler) resolveCNI(ctx context.Context, config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, error) {
+	cni := config.Spec.CNI
+	if cni == nil {
+		return nil, nil, nil
+	}
+	if (cni.Plugin == "") == (cni.ManifestFrom == nil) {
+		return nil, nil, errors.New("cni must define exactly one of plugin or manifestFrom")
+	}
+
+	if cni.ManifestFrom != nil {
+		cm := &corev1.ConfigMap{}
+		key := client.ObjectKey{Namespace: config.Namespace, Name: cni.ManifestFrom.Name}
+		if err := r.Get(ctx, key, cm); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get config map %s for CNI manifest", key)
+		}
+		manifest, ok := cm.Data[cni.ManifestFrom.Key]
+		if !ok {
+			return nil, nil, errors.Errorf("config map %s does not contain key %q for CNI manifest", key, cni.ManifestFrom.Key)
+		}
+		file := bootstrapv1.File{
+			Path:        cniManifestPath,
+			Owner:       "root:root",
+			Permissions: "0600",
+			Content:     manifest,
+		}
+		return []bootstrapv1.File{file}, []string{adminKubectl + " apply -f " + cloudinit.ShellQuote(cniManifestPath)}, nil
+	}
+
+	bundled, ok := bundledCNIManifests[cni.Plugin]
+	if !ok {
+		return nil, nil, errors.Errorf("unsupported CNI plugin %q", cni.Plugin)
+	}
+	podSubnet := ""
+	if config.Spec.ClusterConfiguration != nil {
+		podSubnet = config.Spec.ClusterConfiguration.Networking.PodSubnet
+	}
+	if bundled.podSubnet != "" && podSubnet != "" && podSubnet != bundled.podSubnet {
+		return nil, nil, errors.Errorf("the bundled %s manifest requires the pod network %s, got %s, use cni.manifestFrom instead", cni.Plugin, bundled.podSubnet, podSubnet)
+	}
+	return nil, []string{adminKubectl + " apply -f " + cloudinit.ShellQuote(bundled.url)}, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_ResolveCNI(t *testing.T) {
+	manifest := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "cni",
+		},
+		Data: map[string]string{"calico.yaml": "kind: DaemonSet"},
+	}
+
+	testcases := []struct {
+		name            string
+		cni             *bootstrapv1.CNI
+		podSubnet       string
+		expectedFiles   int
+		expectedCommand string
+		expectErr       bool
+	}{
+		{
+			name: "no CNI",
+		},
+		{
+			name:            "bundled plugin",
+			cni:             &bootstrapv1.CNI{Plugin: bootstrapv1.FlannelCNIPlugin},
+			podSubnet:       "10.244.0.0/16",
+			expectedCommand: "kubectl --kubeconfig=/etc/kubernetes/admin.conf apply -f 'https://raw.githubusercontent.com/coreos/flannel/v0.11.0/Documentation/kube-flannel.yml'",
+		},
+		{
+			name:      "bundled plugin with another pod network",
+			cni:       &bootstrapv1.CNI{Plugin: bootstrapv1.CalicoCNIPlugin},
+			podSubnet: "10.244.0.0/16",
+			expectErr: true,
+		},
+		{
+			name:            "bundled plugin without pod network",
+			cni:             &bootstrapv1.CNI{Plugin: bootstrapv1.CiliumCNIPlugin},
+			podSubnet:       "10.0.0.0/8",
+			expectedCommand: "kubectl --kubeconfig=/etc/kubernetes/admin.conf apply -f 'https://raw.githubusercontent.com/cilium/cilium/v1.6/install/kubernetes/quick-install.yaml'",
+		},
+		{
+			name:            "manifest from config map",
+			cni:             &bootstrapv1.CNI{ManifestFrom: &bootstrapv1.ConfigMapKeyReference{Name: "cni", Key: "calico.yaml"}},
+			podSubnet:       "10.244.0.0/16",
+			expectedFiles:   1,
+			expectedCommand: "kubectl --kubeconfig=/etc/kubernetes/admin.conf apply -f '/etc/kubernetes/cni/manifest.yaml'",
+		},
+		{
+			name:      "missing config map key",
+			cni:       &bootstrapv1.CNI{ManifestFrom: &bootstrapv1.ConfigMapKeyReference{Name: "cni", Key: "missing"}},
+			expectErr: true,
+		},
+		{
+			name:      "both plugin and manifest",
+			cni:       &bootstrapv1.CNI{Plugin: bootstrapv1.CalicoCNIPlugin, ManifestFrom: &bootstrapv1.ConfigMapKeyReference{Name: "cni", Key: "calico.yaml"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKubeadmConfig(nil, "cfg")
+			config.Spec.ClusterConfiguration = &kubeadmv1beta1.ClusterConfiguration{
+				Networking: kubeadmv1beta1.Networking{PodSubnet: tc.podSubnet},
+			}
+			config.Spec.CNI = tc.cni
+
+			k := &KubeadmConfigReconciler{
+				Log:    log.Log,
+				Client: newFakeClientWithScheme(setupScheme(), manifest),
+			}
+			files, commands, err := k.resolveCNI(context.Background(), config)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to resolve CNI:\n %+v", err)
+			}
+			if len(files) != tc.expectedFiles {
+				t.Fatalf("expected %d files, got %d", tc.expectedFiles, len(files))
+			}
+			if tc.expectedFiles > 0 && files[0].Content != manifest.Data["calico.yaml"] {
+				t.Errorf("expected the manifest of the config map, got %q", files[0].Content)
+			}
+			if tc.expectedCommand == "" {
+				if len(commands) != 0 {
+					t.Errorf("expected no commands, got %v", commands)
+				}
+				return
+			}
+			if len(commands) != 1 || commands[0] != tc.expectedCommand {
+				t.Errorf("expected command %q, got %v", tc.expectedCommand, commands)
+			}
+		})
+	}
+}
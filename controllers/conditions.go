@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+const (
+	// WaitingForAPIEndpointsReason is set while the Cluster has no APIEndpoints.
+	WaitingForAPIEndpointsReason = "WaitingForAPIEndpoints"
+	// APIEndpointsTimeoutReason is set once the Cluster has had no APIEndpoints for longer than the wait threshold.
+	APIEndpointsTimeoutReason = "APIEndpointsTimeout"
+	// APIEndpointsAvailableReason is set once the Cluster APIEndpoints are available.
+	APIEndpointsAvailableReason = "APIEndpointsAvailable"
+
+	// MachineFailedReason is set while the owner Machine has a terminal error set.
+	MachineFailedReason = "MachineFailed"
+	// MachineRecoveredReason is set once the terminal error of the owner Machine has been cleared.
+	MachineRecoveredReason = "MachineRecovered"
+
+	// SpecChangedReason is set when the spec was changed after the bootstrap data was rendered.
+	SpecChangedReason = "SpecChanged"
+	// SpecUpToDateReason is set once the bootstrap data reflects the spec again.
+	SpecUpToDateReason = "SpecUpToDate"
+
+	// InitLockHeldReason is set while another machine holds the kubeadm init lock.
+	InitLockHeldReason = "InitLockHeld"
+	// InitLockAcquiredReason is set once the machine acquired the kubeadm init lock.
+	InitLockAcquiredReason = "InitLockAcquired"
+
+	// ClusterInfoInvalidReason is set while the cluster-info ConfigMap of the workload cluster is invalid.
+	ClusterInfoInvalidReason = "ClusterInfoInvalid"
+	// ClusterInfoRepairedReason is set once CABPK repaired the cluster-info ConfigMap of the workload cluster.
+	ClusterInfoRepairedReason = "ClusterInfoRepaired"
+	// ClusterInfoValidReason is set once the cluster-info ConfigMap of the workload cluster is valid again.
+	ClusterInfoValidReason = "ClusterInfoValid"
+
+	// APIServerUnreachableReason is set while the API server endpoint of the workload cluster does not answer.
+	APIServerUnreachableReason = "APIServerUnreachable"
+	// APIServerReachableReason is set once the API server endpoint of the workload cluster answers.
+	APIServerReachableReason = "APIServerReachable"
+
+	// ControlPlaneJoinIncompatibleReason is set while a control plane machine cannot join the workload cluster.
+	ControlPlaneJoinIncompatibleReason = "ControlPlaneJoinIncompatible"
+	// ControlPlaneJoinCompatibleReason is set once a control plane machine can join the workload cluster again.
+	ControlPlaneJoinCompatibleReason = "ControlPlaneJoinCompatible"
+
+	// ExternalEtcdInvalidReason is set while the certificates of the external etcd are invalid.
+	ExternalEtcdInvalidReason = "ExternalEtcdInvalid"
+	// ExternalEtcdValidReason is set once the certificates of the external etcd are valid again.
+	ExternalEtcdValidReason = "ExternalEtcdValid"
+
+	// ClusterCertificatesInvalidReason is set while the certificates of the cluster secrets cannot be used.
+	ClusterCertificatesInvalidReason = "ClusterCertificatesInvalid"
+	// ClusterCertificatesValidReason is set once the certificates of the cluster secrets can be used again.
+	ClusterCertificatesValidReason = "ClusterCertificatesValid"
+
+	// DeprecatedArgsReason is set while the extra args of the config are deprecated for the Machine version.
+	DeprecatedArgsReason = "DeprecatedArgs"
+	// DeprecatedArgsResolvedReason is set once the extra args of the config are not deprecated anymore.
+	DeprecatedArgsResolvedReason = "DeprecatedArgsResolved"
+
+	// InsecureDiscoveryReason is set while the discovery of a config skips the CA verification required by its cluster.
+	InsecureDiscoveryReason = "InsecureDiscovery"
+	// SecureDiscoveryReason is set once the discovery of a config verifies the cluster CA, or the cluster allows it not to.
+	SecureDiscoveryReason = "SecureDiscovery"
+
+	// WorkloadClusterCircuitOpenReason is set while the circuit breaker of the workload cluster is open.
+	WorkloadClusterCircuitOpenReason = "WorkloadClusterCircuitOpen"
+	// WorkloadClusterCircuitClosedReason is set once the calls to the workload cluster succeed again.
+	WorkloadClusterCircuitClosedReason = "WorkloadClusterCircuitClosed"
+
+	// WaitingForControlPlaneInitializationReason is the requeue reason of configs waiting for the control plane
+	// to be initialized by another machine.
+	WaitingForControlPlaneInitializationReason = "WaitingForControlPlaneInitialization"
+	// WaitingForDiscoveryReason is the requeue reason of joining configs whose discovery cannot be configured yet.
+	WaitingForDiscoveryReason = "WaitingForDiscovery"
+	// WaitingForDiscoverySecretReason is the requeue reason of configs of clusters with an external control plane
+	// whose discovery secret does not exist yet.
+	WaitingForDiscoverySecretReason = "WaitingForDiscoverySecret"
+
+	// BootstrapDataReadyReason is the reason of the event emitted when the bootstrap data of a config is first ready.
+	BootstrapDataReadyReason = "BootstrapDataReady"
+
+	// BootstrapFailedReason is the reason of the event emitted when a machine uploaded its bootstrap logs.
+	BootstrapFailedReason = "BootstrapFailed"
+
+	// NodeAgentUpdatePublishedReason is the reason of the event emitted when an update is published to the node agent.
+	NodeAgentUpdatePublishedReason = "NodeAgentUpdatePublished"
+)
+
+// getCondition returns the condition of the given type, or nil if the config does not have it.
+func getCondition(config *bootstrapv1.KubeadmConfig, conditionType bootstrapv1.KubeadmConfigConditionType) *bootstrapv1.KubeadmConfigCondition {
+	for i := range config.Status.Conditions {
+		if config.Status.Conditions[i].Type == conditionType {
+			return &config.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setCondition adds or updates the condition of the given type. The last transition time is only updated
+// when the status of the condition changes.
+func setCondition(config *bootstrapv1.KubeadmConfig, conditionType bootstrapv1.KubeadmConfigConditionType, status corev1.ConditionStatus, reason, message string, now metav1.Time) *bootstrapv1.KubeadmConfigCondition {
+	condition := getCondition(config, conditionType)
+	if condition == nil {
+		config.Status.Conditions = append(config.Status.Conditions, bootstrapv1.KubeadmConfigCondition{Type: conditionType})
+		condition = &config.Status.Conditions[len(config.Status.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.Status = status
+		condition.LastTransitionTime = now
+	}
+	condition.LastProbeTime = now
+	condition.Reason = reason
+	condition.Message = message
+	return condition
+}
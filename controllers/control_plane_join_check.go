@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// kubeadmConfigConfigMapName is the name of the ConfigMap kubeadm stores the cluster configuration in, in the
+	// kube-system namespace of the workload cluster.
+	kubeadmConfigConfigMapName = "kubeadm-config"
+
+	// kubeadmClusterConfigurationKey is the key of the ClusterConfiguration in the kubeadm-config ConfigMap.
+	kubeadmClusterConfigurationKey = "ClusterConfiguration"
+)
+
+// storedClusterConfiguration holds the fields of the ClusterConfiguration stored by kubeadm which are checked before
+// joining control plane machines; it is decoded independently of the kubeadm config API version.
+type storedClusterConfiguration struct {
+	KubernetesVersion    string `json:"kubernetesVersion"`
+	ControlPlaneEndpoint string `json:"controlPlaneEndpoint"`
+}
+
+// reconcileControlPlaneJoinCheck runs against the workload cluster the checks of kubeadm join --control-plane which
+// can be done from the controller, and records whether they pass on the config. The join data is not generated while
+// they fail, as the machine would fail to join.
+func (r *KubeadmConfigReconciler) reconcileControlPlaneJoinCheck(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, kubernetesVersion *string) error {
+	configMapsClient, err := r.KubeSystemConfigMapsClientFactory.NewKubeSystemConfigMapsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+
+	var problem string
+	cm, err := configMapsClient.Get(kubeadmConfigConfigMapName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		problem = fmt.Sprintf("has no %s/%s ConfigMap", metav1.NamespaceSystem, kubeadmConfigConfigMapName)
+	case err != nil:
+		return errors.Wrapf(err, "failed to get ConfigMap %s/%s", metav1.NamespaceSystem, kubeadmConfigConfigMapName)
+	default:
+		problem = controlPlaneJoinProblem(cm, kubernetesVersion)
+	}
+
+	now := metav1.Now()
+	if problem == "" {
+		if condition := getCondition(config, bootstrapv1.ControlPlaneJoinIncompatibleCondition); condition != nil {
+			setCondition(config, bootstrapv1.ControlPlaneJoinIncompatibleCondition, corev1.ConditionFalse, ControlPlaneJoinCompatibleReason, "", now)
+		}
+		return nil
+	}
+
+	message := fmt.Sprintf("Cluster %s %s", cluster.Name, problem)
+	condition := getCondition(config, bootstrapv1.ControlPlaneJoinIncompatibleCondition)
+	if (condition == nil || condition.Status != corev1.ConditionTrue) && r.Recorder != nil {
+		r.Recorder.Event(config, corev1.EventTypeWarning, ControlPlaneJoinIncompatibleReason, message)
+	}
+	setCondition(config, bootstrapv1.ControlPlaneJoinIncompatibleCondition, corev1.ConditionTrue, ControlPlaneJoinIncompatibleReason, message, now)
+	return errors.Wrap(&capierrors.RequeueAfterError{RequeueAfter: currentTunables().RequeueInterval}, message)
+}
+
+// controlPlaneJoinProblem returns why a control plane machine of the given Kubernetes version cannot join the cluster
+// whose kubeadm-config ConfigMap is given, or an empty string. kubeadm requires a controlPlaneEndpoint to join control
+// plane machines, and the machines to run the version of the cluster or, during upgrades, of its next minor release.
+func controlPlaneJoinProblem(cm *corev1.ConfigMap, kubernetesVersion *string) string {
+	data, ok := cm.Data[kubeadmClusterConfigurationKey]
+	if !ok {
+		return fmt.Sprintf("has no %s in its %s ConfigMap", kubeadmClusterConfigurationKey, kubeadmConfigConfigMapName)
+	}
+	stored := &storedClusterConfiguration{}
+	if err := yaml.Unmarshal([]byte(data), stored); err != nil {
+		return fmt.Sprintf("has an invalid %s in its %s ConfigMap: %v", kubeadmClusterConfigurationKey, kubeadmConfigConfigMapName, err)
+	}
+	if stored.ControlPlaneEndpoint == "" {
+		return "has no controlPlaneEndpoint, which is required to join control plane machines"
+	}
+
+	if kubernetesVersion == nil || *kubernetesVersion == "" {
+		return ""
+	}
+	machineVersion, err := version.ParseGeneric(*kubernetesVersion)
+	if err != nil {
+		return fmt.Sprintf("cannot be joined by a machine with the invalid version %q", *kubernetesVersion)
+	}
+	clusterVersion, err := version.ParseGeneric(stored.KubernetesVersion)
+	if err != nil {
+		return fmt.Sprintf("has the invalid kubernetesVersion %q", stored.KubernetesVersion)
+	}
+	switch {
+	case machineVersion.Major() != clusterVersion.Major():
+		return fmt.Sprintf("runs version %s, which cannot be joined by a control plane machine of version %s", stored.KubernetesVersion, *kubernetesVersion)
+	case machineVersion.Minor() < clusterVersion.Minor():
+		return fmt.Sprintf("runs version %s, which cannot be joined by a control plane machine of the older version %s", stored.KubernetesVersion, *kubernetesVersion)
+	case machineVersion.Minor() > clusterVersion.Minor()+1:
+		return fmt.Sprintf("runs version %s, which cannot be joined by a control plane machine of version %s, more than one minor version newer", stored.KubernetesVersion, *kubernetesVersion)
+	}
+	return ""
+}
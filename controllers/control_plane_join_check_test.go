@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+type fakeKubeSystemConfigMapsClientFactory struct {
+	client typedcorev1.ConfigMapInterface
+}
+
+func (f fakeKubeSystemConfigMapsClientFactory) NewKubeSystemConfigMapsClient(_ context.Context, _ client.Client, _ *clusterv1.Cluster) (typedcorev1.ConfigMapInterface, error) {
+	return f.client, nil
+}
+
+func newKubeadmConfigConfigMap(clusterConfiguration string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: kubeadmConfigConfigMapName},
+		Data:       map[string]string{kubeadmClusterConfigurationKey: clusterConfiguration},
+	}
+}
+
+func TestControlPlaneJoinProblem(t *testing.T) {
+	stored := `apiVersion: kubeadm.k8s.io/v1beta2
+kind: ClusterConfiguration
+kubernetesVersion: v1.16.2
+controlPlaneEndpoint: 10.0.0.1:6443
+`
+	tests := []struct {
+		name          string
+		configMap     *corev1.ConfigMap
+		version       string
+		expectProblem bool
+	}{
+		{
+			name:      "same version",
+			configMap: newKubeadmConfigConfigMap(stored),
+			version:   "v1.16.3",
+		},
+		{
+			name:      "next minor version",
+			configMap: newKubeadmConfigConfigMap(stored),
+			version:   "v1.17.0",
+		},
+		{
+			name:      "unknown version",
+			configMap: newKubeadmConfigConfigMap(stored),
+		},
+		{
+			name:          "older minor version",
+			configMap:     newKubeadmConfigConfigMap(stored),
+			version:       "v1.15.5",
+			expectProblem: true,
+		},
+		{
+			name:          "two minor versions newer",
+			configMap:     newKubeadmConfigConfigMap(stored),
+			version:       "v1.18.0",
+			expectProblem: true,
+		},
+		{
+			name:          "no control plane endpoint",
+			configMap:     newKubeadmConfigConfigMap("kubernetesVersion: v1.16.2\n"),
+			version:       "v1.16.2",
+			expectProblem: true,
+		},
+		{
+			name:          "no cluster configuration",
+			configMap:     &corev1.ConfigMap{},
+			version:       "v1.16.2",
+			expectProblem: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var version *string
+			if tt.version != "" {
+				version = &tt.version
+			}
+			problem := controlPlaneJoinProblem(tt.configMap, version)
+			if (problem != "") != tt.expectProblem {
+				t.Errorf("expected problem: %v, got %q", tt.expectProblem, problem)
+			}
+		})
+	}
+}
+
+func TestReconcileControlPlaneJoinCheck(t *testing.T) {
+	cluster := newCluster("cluster")
+	version := "v1.16.2"
+
+	configMaps := fakeclient.NewSimpleClientset().CoreV1().ConfigMaps(metav1.NamespaceSystem)
+	r := &KubeadmConfigReconciler{
+		Log:                               log.Log,
+		KubeSystemConfigMapsClientFactory: fakeKubeSystemConfigMapsClientFactory{client: configMaps},
+	}
+
+	config := newKubeadmConfig(nil, "cfg")
+	config.Spec.ControlPlaneJoinCheck = true
+	err := r.reconcileControlPlaneJoinCheck(context.Background(), cluster, config, &version)
+	if _, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); !ok {
+		t.Fatalf("expected a requeue for a missing kubeadm-config ConfigMap, got %v", err)
+	}
+	if condition := getCondition(config, bootstrapv1.ControlPlaneJoinIncompatibleCondition); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Errorf("expected the %s condition to be true, got %+v", bootstrapv1.ControlPlaneJoinIncompatibleCondition, condition)
+	}
+
+	if _, err := configMaps.Create(newKubeadmConfigConfigMap("kubernetesVersion: v1.16.0\ncontrolPlaneEndpoint: 10.0.0.1:6443\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reconcileControlPlaneJoinCheck(context.Background(), cluster, config, &version); err != nil {
+		t.Fatalf("expected the checks to pass, got %v", err)
+	}
+	if condition := getCondition(config, bootstrapv1.ControlPlaneJoinIncompatibleCondition); condition.Status != corev1.ConditionFalse || condition.Reason != ControlPlaneJoinCompatibleReason {
+		t.Errorf("expected the %s condition to be false, got %+v", bootstrapv1.ControlPlaneJoinIncompatibleCondition, condition)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// controlPlaneTaint is the taint kubeadm adds to control plane nodes.
+	controlPlaneTaint = "node-role.kubernetes.io/master:NoSchedule"
+
+	adminKubectl = "kubectl --kubeconfig=/etc/kubernetes/admin.conf"
+
+	// defaultNodeNameExpression evaluates to the name kubeadm registers the node with if none is set.
+	defaultNodeNameExpression = `"$(hostname | tr '[:upper:]' '[:lower:]')"`
+)
+
+// controlPlaneNodeCommands returns the commands to be run after kubeadm on control plane machines to apply the
+// control plane node policy of the config to the node registered with the given options.
+// Nodes of single node clusters are always untainted.
+// The first control plane node is untainted if requested and its Machine is the only Machine of the cluster.
+func (r *KubeadmConfigReconciler) controlPlaneNodeCommands(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions, isInit bool) ([]string, error) {
+	policy := controlPlaneNodePolicy(config)
+	if policy == nil {
+		return nil, nil
+	}
+
+	name := defaultNodeNameExpression
+	if nodeRegistration.Name != "" {
+		name = cloudinit.ShellQuote(nodeRegistration.Name)
+	}
+
+	var commands []string
+	if len(policy.Labels) > 0 {
+		keys := make([]string, 0, len(policy.Labels))
+		for k := range policy.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		args := []string{adminKubectl, "label", "node", name, "--overwrite"}
+		for _, k := range keys {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				return nil, errors.Errorf("invalid control plane node label key %q: %s", k, strings.Join(errs, ", "))
+			}
+			if errs := validation.IsValidLabelValue(policy.Labels[k]); len(errs) > 0 {
+				return nil, errors.Errorf("invalid control plane node label value %q: %s", policy.Labels[k], strings.Join(errs, ", "))
+			}
+			args = append(args, cloudinit.ShellQuote(k+"="+policy.Labels[k]))
+		}
+		commands = append(commands, strings.Join(args, " "))
+	}
+
+	untaint := policy.Untainted
+	if !untaint && policy.UntaintSingleNode && isInit {
+		machines := &clusterv1.MachineList{}
+		if err := r.List(ctx, machines, client.InNamespace(cluster.Namespace), client.MatchingLabels{clusterv1.MachineClusterLabelName: cluster.Name}); err != nil {
+			return nil, errors.Wrapf(err, "failed to list Machines of Cluster %s/%s", cluster.Namespace, cluster.Name)
+		}
+		untaint = len(machines.Items) == 1
+	}
+	if untaint {
+		// the taint may already be gone if the commands run again
+		commands = append(commands, adminKubectl+" taint node "+name+" "+controlPlaneTaint+"- || true")
+	}
+	return commands, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestControlPlaneNodeCommands(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newControlPlaneMachine(cluster, "control-plane")
+	worker := newWorkerMachine(cluster)
+
+	tests := []struct {
+		name             string
+		policy           *bootstrapv1.ControlPlaneNodePolicy
+		nodeName         string
+		isInit           bool
+		objects          []runtime.Object
+		expectedCommands []string
+		expectError      bool
+	}{
+		{
+			name: "no policy",
+		},
+		{
+			name:     "labels and untainted",
+			policy:   &bootstrapv1.ControlPlaneNodePolicy{Untainted: true, Labels: map[string]string{"node-role.kubernetes.io/control-plane": "", "zone": "a"}},
+			nodeName: "cp-0",
+			expectedCommands: []string{
+				"kubectl --kubeconfig=/etc/kubernetes/admin.conf label node 'cp-0' --overwrite 'node-role.kubernetes.io/control-plane=' 'zone=a'",
+				"kubectl --kubeconfig=/etc/kubernetes/admin.conf taint node 'cp-0' node-role.kubernetes.io/master:NoSchedule- || true",
+			},
+		},
+		{
+			name:    "single node cluster is untainted after init",
+			policy:  &bootstrapv1.ControlPlaneNodePolicy{UntaintSingleNode: true},
+			isInit:  true,
+			objects: []runtime.Object{machine},
+			expectedCommands: []string{
+				`kubectl --kubeconfig=/etc/kubernetes/admin.conf taint node "$(hostname | tr '[:upper:]' '[:lower:]')" node-role.kubernetes.io/master:NoSchedule- || true`,
+			},
+		},
+		{
+			name:    "cluster with several machines is not untainted",
+			policy:  &bootstrapv1.ControlPlaneNodePolicy{UntaintSingleNode: true},
+			isInit:  true,
+			objects: []runtime.Object{machine, worker},
+		},
+		{
+			name:    "joining control planes are not untainted as single nodes",
+			policy:  &bootstrapv1.ControlPlaneNodePolicy{UntaintSingleNode: true},
+			objects: []runtime.Object{machine},
+		},
+		{
+			name:        "invalid label",
+			policy:      &bootstrapv1.ControlPlaneNodePolicy{Labels: map[string]string{"zone": "a b"}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &KubeadmConfigReconciler{
+				Log:    log.Log,
+				Client: newFakeClientWithScheme(setupScheme(), tt.objects...),
+			}
+			config := &bootstrapv1.KubeadmConfig{Spec: bootstrapv1.KubeadmConfigSpec{ControlPlaneNodes: tt.policy}}
+			commands, err := k.controlPlaneNodeCommands(context.Background(), cluster, config, &kubeadmv1beta1.NodeRegistrationOptions{Name: tt.nodeName}, tt.isInit)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if !reflect.DeepEqual(commands, tt.expectedCommands) {
+				t.Errorf("expected commands %q, got %q", tt.expectedCommands, commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/controllerconfig"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// ControllerConfigKey is the key of the controller configuration ConfigMap holding the configuration document.
+	ControllerConfigKey = "config.yaml"
+)
+
+var (
+	// DefaultRequeueInterval is the interval at which configs waiting for the control plane to be initialized,
+	// the init lock or the cluster-info ConfigMap, and pending certificate requests are reconciled again.
+	DefaultRequeueInterval = 30 * time.Second
+
+	// Tunables holds the controller configuration loaded from the controller configuration ConfigMap.
+	// Its unset fields default to the values set by the controller flags.
+	Tunables = &controllerconfig.Store{}
+)
+
+// tunables is the current value of the controller tunables.
+type tunables struct {
+	RequeueInterval           time.Duration
+	BootstrapTokenTTL         time.Duration
+	SignedCertificateDuration time.Duration
+	NodeClientCertificateTTL  time.Duration
+	DefaultNTP                *bootstrapv1.NTP
+}
+
+// currentTunables returns the tunables of the loaded controller configuration, defaulted to the values set by the
+// controller flags.
+func currentTunables() tunables {
+	c := Tunables.Get()
+	out := tunables{
+		RequeueInterval:           DefaultRequeueInterval,
+		BootstrapTokenTTL:         DefaultTokenTTL,
+		SignedCertificateDuration: DefaultSignedCertificateDuration,
+		NodeClientCertificateTTL:  DefaultNodeClientCertificateTTL,
+		DefaultNTP:                c.DefaultNTP,
+	}
+	if c.RequeueInterval != nil {
+		out.RequeueInterval = c.RequeueInterval.Duration
+	}
+	if c.BootstrapTokenTTL != nil {
+		out.BootstrapTokenTTL = c.BootstrapTokenTTL.Duration
+	}
+	if c.SignedCertificateDuration != nil {
+		out.SignedCertificateDuration = c.SignedCertificateDuration.Duration
+	}
+	if c.NodeClientCertificateTTL != nil {
+		out.NodeClientCertificateTTL = c.NodeClientCertificateTTL.Duration
+	}
+	return out
+}
+
+// ControllerConfigReconciler loads the controller configuration from a ConfigMap into a store whenever the ConfigMap
+// changes, so that the controllers can be tuned without being restarted. Invalid configurations are logged and
+// ignored, keeping the previous configuration; deleting the ConfigMap resets the tunables to their defaults.
+type ControllerConfigReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// ConfigMap is the name of the controller configuration ConfigMap.
+	ConfigMap types.NamespacedName
+	// Store is the store the configuration is loaded into.
+	Store *controllerconfig.Store
+}
+
+// SetupWithManager sets up the reconciler with the Manager.
+func (r *ControllerConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("controllerconfig").
+		For(&corev1.ConfigMap{}).
+		WithEventFilter(predicate.Funcs{
+			CreateFunc:  func(e event.CreateEvent) bool { return r.isControllerConfig(e.Meta) },
+			UpdateFunc:  func(e event.UpdateEvent) bool { return r.isControllerConfig(e.MetaNew) },
+			DeleteFunc:  func(e event.DeleteEvent) bool { return r.isControllerConfig(e.Meta) },
+			GenericFunc: func(e event.GenericEvent) bool { return r.isControllerConfig(e.Meta) },
+		}).
+		Complete(r)
+}
+
+func (r *ControllerConfigReconciler) isControllerConfig(o metav1.Object) bool {
+	return o.GetNamespace() == r.ConfigMap.Namespace && o.GetName() == r.ConfigMap.Name
+}
+
+// Reconcile loads the controller configuration ConfigMap into the store.
+func (r *ControllerConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("configmap", req.NamespacedName)
+
+	if req.NamespacedName != r.ConfigMap {
+		return ctrl.Result{}, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("Controller configuration removed, using the defaults")
+			r.Store.Set(nil)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	c, err := controllerconfig.Parse([]byte(cm.Data[ControllerConfigKey]))
+	if err != nil {
+		// The configuration is only fixed by updating the ConfigMap, which triggers a new reconciliation.
+		log.Error(err, "Ignoring invalid controller configuration, keeping the previous one")
+		return ctrl.Result{}, nil
+	}
+	r.Store.Set(c)
+	log.Info("Loaded controller configuration", "resourceVersion", cm.ResourceVersion)
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/controllerconfig"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestControllerConfigReconciler(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cabpk-system", Name: "cabpk-config"},
+		Data: map[string]string{
+			ControllerConfigKey: "bootstrapTokenTTL: 30m\nrequeueInterval: 5s\n",
+		},
+	}
+	myclient := newFakeClientWithScheme(setupScheme(), cm)
+	store := &controllerconfig.Store{}
+	r := &ControllerConfigReconciler{
+		Client:    myclient,
+		Log:       log.Log,
+		ConfigMap: types.NamespacedName{Namespace: "cabpk-system", Name: "cabpk-config"},
+		Store:     store,
+	}
+	request := ctrl.Request{NamespacedName: r.ConfigMap}
+
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if c := store.Get(); c.BootstrapTokenTTL == nil || c.BootstrapTokenTTL.Duration != 30*time.Minute {
+		t.Fatalf("expected the configuration to be loaded, got %+v", c)
+	}
+
+	// An invalid configuration keeps the previous one.
+	cm.Data[ControllerConfigKey] = "bootstrapTokenTTL: -1m\n"
+	if err := myclient.Update(context.Background(), cm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if c := store.Get(); c.BootstrapTokenTTL == nil || c.BootstrapTokenTTL.Duration != 30*time.Minute {
+		t.Fatalf("expected the previous configuration to be kept, got %+v", c)
+	}
+
+	if err := myclient.Delete(context.Background(), cm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if c := store.Get(); c.BootstrapTokenTTL != nil {
+		t.Fatalf("expected the configuration to be reset, got %+v", c)
+	}
+}
+
+func TestCurrentTunables(t *testing.T) {
+	defer Tunables.Set(nil)
+
+	if got := currentTunables(); got.BootstrapTokenTTL != DefaultTokenTTL || got.RequeueInterval != DefaultRequeueInterval {
+		t.Fatalf("expected the flag values, got %+v", got)
+	}
+
+	c, err := controllerconfig.Parse([]byte("bootstrapTokenTTL: 30m\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Tunables.Set(c)
+	got := currentTunables()
+	if got.BootstrapTokenTTL != 30*time.Minute {
+		t.Errorf("expected a 30m bootstrap token TTL, got %s", got.BootstrapTokenTTL)
+	}
+	if got.SignedCertificateDuration != DefaultSignedCertificateDuration {
+		t.Errorf("expected the default signed certificate duration, got %s", got.SignedCertificateDuration)
+	}
+}
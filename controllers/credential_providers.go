@@ -0,0 +1,101 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+const (
+	credentialProviderConfigPath = "/etc/kubernetes/credential-providers.yaml"
+
+	// credentialProvidersFeatureGate is the kubelet feature gate of the image credential provider plugins.
+	credentialProvidersFeatureGate = "KubeletCredentialProviders"
+)
+
+var (
+	// minVersionForCredentialProviders is the first Kubernetes version whose kubelet supports image credential
+	// provider plugins.
+	minVersionForCredentialProviders = version.MustParseSemantic("v1.20.0")
+
+	// minVersionEnablingCredentialProviders is the first Kubernetes version whose kubelet enables the image credential
+	// provider plugins by default.
+	minVersionEnablingCredentialProviders = version.MustParseSemantic("v1.24.0")
+)
+
+// credentialProviderFiles returns the CredentialProviderConfig file of the kubelet credential providers of the config.
+func credentialProviderFiles(config *bootstrapv1.KubeadmConfig) []bootstrapv1.File {
+	if config.Spec.CredentialProviders == nil {
+		return nil
+	}
+	return []bootstrapv1.File{
+		{
+			Path:        credentialProviderConfigPath,
+			Owner:       "root:root",
+			Permissions: "0600",
+			Content:     config.Spec.CredentialProviders.Config,
+		},
+	}
+}
+
+// applyCredentialProvidersToNodeRegistration sets the kubelet arguments of the credential providers on the node
+// registration, enabling their feature gate for the kubelets that do not enable it by default. Unknown versions are
+// assumed to enable it.
+func applyCredentialProvidersToNodeRegistration(providers *bootstrapv1.KubeletCredentialProviders, kubernetesVersion *string, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions) error {
+	if providers == nil {
+		return nil
+	}
+
+	var v *version.Version
+	if kubernetesVersion != nil && *kubernetesVersion != "" {
+		var err error
+		if v, err = version.ParseSemantic(*kubernetesVersion); err != nil {
+			return errors.Wrapf(err, "invalid Machine version %q", *kubernetesVersion)
+		}
+		if v.LessThan(minVersionForCredentialProviders) {
+			return errors.Errorf("credentialProviders requires a Machine version of at least %s", minVersionForCredentialProviders)
+		}
+	}
+
+	if nodeRegistration.KubeletExtraArgs == nil {
+		nodeRegistration.KubeletExtraArgs = map[string]string{}
+	}
+	nodeRegistration.KubeletExtraArgs["image-credential-provider-config"] = credentialProviderConfigPath
+	nodeRegistration.KubeletExtraArgs["image-credential-provider-bin-dir"] = providers.BinDir
+	if v != nil && v.LessThan(minVersionEnablingCredentialProviders) {
+		nodeRegistration.KubeletExtraArgs["feature-gates"] = enableFeatureGate(nodeRegistration.KubeletExtraArgs["feature-gates"], credentialProvidersFeatureGate)
+	}
+	return nil
+}
+
+// enableFeatureGate adds the feature gate to the feature-gates argument, unless the argument already sets it.
+func enableFeatureGate(featureGates, name string) string {
+	if featureGates == "" {
+		return name + "=true"
+	}
+	for _, gate := range strings.Split(featureGates, ",") {
+		if strings.TrimSpace(strings.SplitN(gate, "=", 2)[0]) == name {
+			return featureGates
+		}
+	}
+	return featureGates + "," + name + "=true"
+}
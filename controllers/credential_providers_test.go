@@ -0,0 +1,110 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestApplyCredentialProvidersToNodeRegistration(t *testing.T) {
+	v119, v122, v124 := "v1.19.4", "v1.22.1", "v1.24.0"
+	providers := &bootstrapv1.KubeletCredentialProviders{Config: "kind: CredentialProviderConfig", BinDir: "/opt/credential-providers"}
+	testcases := []struct {
+		name              string
+		providers         *bootstrapv1.KubeletCredentialProviders
+		kubernetesVersion *string
+		kubeletExtraArgs  map[string]string
+		expectedArgs      map[string]string
+		expectErr         bool
+	}{
+		{
+			name: "nothing is set by default",
+		},
+		{
+			name:              "the feature gate is not needed for recent kubelets",
+			providers:         providers,
+			kubernetesVersion: &v124,
+			expectedArgs: map[string]string{
+				"image-credential-provider-config":  credentialProviderConfigPath,
+				"image-credential-provider-bin-dir": "/opt/credential-providers",
+			},
+		},
+		{
+			name:              "the feature gate is appended to the feature gates of the user",
+			providers:         providers,
+			kubernetesVersion: &v122,
+			kubeletExtraArgs:  map[string]string{"feature-gates": "RotateKubeletServerCertificate=true"},
+			expectedArgs: map[string]string{
+				"image-credential-provider-config":  credentialProviderConfigPath,
+				"image-credential-provider-bin-dir": "/opt/credential-providers",
+				"feature-gates":                     "RotateKubeletServerCertificate=true,KubeletCredentialProviders=true",
+			},
+		},
+		{
+			name:              "the feature gate set by the user is not overridden",
+			providers:         providers,
+			kubernetesVersion: &v122,
+			kubeletExtraArgs:  map[string]string{"feature-gates": "KubeletCredentialProviders=false"},
+			expectedArgs: map[string]string{
+				"image-credential-provider-config":  credentialProviderConfigPath,
+				"image-credential-provider-bin-dir": "/opt/credential-providers",
+				"feature-gates":                     "KubeletCredentialProviders=false",
+			},
+		},
+		{
+			name:      "unknown versions are assumed to enable the feature gate",
+			providers: providers,
+			expectedArgs: map[string]string{
+				"image-credential-provider-config":  credentialProviderConfigPath,
+				"image-credential-provider-bin-dir": "/opt/credential-providers",
+			},
+		},
+		{
+			name:              "kubelets without credential providers are rejected",
+			providers:         providers,
+			kubernetesVersion: &v119,
+			expectErr:         true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodeRegistration := &kubeadmv1beta1.NodeRegistrationOptions{KubeletExtraArgs: tc.kubeletExtraArgs}
+			err := applyCredentialProvidersToNodeRegistration(tc.providers, tc.kubernetesVersion, nodeRegistration)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if len(nodeRegistration.KubeletExtraArgs) != len(tc.expectedArgs) {
+				t.Fatalf("expected kubelet args %v, got %v", tc.expectedArgs, nodeRegistration.KubeletExtraArgs)
+			}
+			for k, v := range tc.expectedArgs {
+				if nodeRegistration.KubeletExtraArgs[k] != v {
+					t.Errorf("expected kubelet arg %s=%q, got %q", k, v, nodeRegistration.KubeletExtraArgs[k])
+				}
+			}
+		})
+	}
+}
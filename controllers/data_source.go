@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// noCloudMetadataKey is the key of the bootstrap data secret holding the NoCloud meta-data file.
+	noCloudMetadataKey = "meta-data"
+
+	// configDriveMetadataKey is the key of the bootstrap data secret holding the ConfigDrive meta_data.json file.
+	configDriveMetadataKey = "meta_data.json"
+)
+
+// dataSource returns the cloud-init data source the bootstrap data of the config is consumed by, if any.
+func dataSource(config *bootstrapv1.KubeadmConfig) bootstrapv1.DataSource {
+	if config.Spec.FormatOptions == nil {
+		return ""
+	}
+	return config.Spec.FormatOptions.DataSource
+}
+
+// dataSourceMetadata returns the meta data expected by the data source of the config, keyed by the bootstrap data
+// secret key it is stored under. The machine UID is used as the instance ID, and the hostname is only set if
+// generated by the node name strategy. As the data source cloud-config is not templated, configs relying on jinja
+// expressions are rejected.
+func dataSourceMetadata(config *bootstrapv1.KubeadmConfig, machine *clusterv1.Machine, nodeName *nodeName) (map[string][]byte, error) {
+	source := dataSource(config)
+	if source == "" {
+		return nil, nil
+	}
+
+	if config.Spec.NodeName != nil && config.Spec.NodeName.Strategy == bootstrapv1.CloudMetadataStrategy {
+		return nil, errors.Errorf("the %s node name strategy is not supported by the %s data source", bootstrapv1.CloudMetadataStrategy, source)
+	}
+	for _, nodeRegistration := range nodeRegistrations(config) {
+		if strings.Contains(nodeRegistration.Name, "{{") {
+			return nil, errors.Errorf("node registration name %q is a template, which is not supported by the %s data source", nodeRegistration.Name, source)
+		}
+	}
+
+	instanceID := string(machine.UID)
+	if instanceID == "" {
+		instanceID = machine.Name
+	}
+	hostname := ""
+	if nodeName != nil {
+		hostname = nodeName.Hostname
+	}
+
+	switch source {
+	case bootstrapv1.NoCloudDataSource:
+		metadata := map[string]string{"instance-id": instanceID}
+		if hostname != "" {
+			metadata["local-hostname"] = hostname
+		}
+		out, err := yaml.Marshal(metadata)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal NoCloud meta data")
+		}
+		return map[string][]byte{noCloudMetadataKey: out}, nil
+	case bootstrapv1.ConfigDriveDataSource:
+		metadata := map[string]string{"uuid": instanceID, "name": machine.Name}
+		if hostname != "" {
+			metadata["hostname"] = hostname
+		}
+		out, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal ConfigDrive meta data")
+		}
+		return map[string][]byte{configDriveMetadataKey: out}, nil
+	default:
+		return nil, errors.Errorf("unsupported data source %q", source)
+	}
+}
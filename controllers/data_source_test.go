@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+func TestDataSourceMetadata(t *testing.T) {
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine-0", UID: "1234"}}
+
+	tests := []struct {
+		name             string
+		dataSource       bootstrapv1.DataSource
+		nodeName         *nodeName
+		nodeNameSpec     *bootstrapv1.NodeName
+		registrationName string
+		expected         map[string]string
+		expectError      bool
+	}{
+		{
+			name: "no data source",
+		},
+		{
+			name:       "nocloud without hostname",
+			dataSource: bootstrapv1.NoCloudDataSource,
+			expected:   map[string]string{noCloudMetadataKey: "instance-id: \"1234\"\n"},
+		},
+		{
+			name:       "nocloud with hostname",
+			dataSource: bootstrapv1.NoCloudDataSource,
+			nodeName:   &nodeName{Name: "worker-0", Hostname: "worker-0"},
+			expected:   map[string]string{noCloudMetadataKey: "instance-id: \"1234\"\nlocal-hostname: worker-0\n"},
+		},
+		{
+			name:       "configdrive with hostname",
+			dataSource: bootstrapv1.ConfigDriveDataSource,
+			nodeName:   &nodeName{Name: "worker-0", Hostname: "worker-0"},
+			expected:   map[string]string{configDriveMetadataKey: `{"hostname":"worker-0","name":"machine-0","uuid":"1234"}`},
+		},
+		{
+			name:         "cloud metadata node names require templating",
+			dataSource:   bootstrapv1.NoCloudDataSource,
+			nodeNameSpec: &bootstrapv1.NodeName{Strategy: bootstrapv1.CloudMetadataStrategy},
+			expectError:  true,
+		},
+		{
+			name:             "templated node registration names require templating",
+			dataSource:       bootstrapv1.ConfigDriveDataSource,
+			registrationName: "{{ ds.meta_data.local_hostname }}",
+			expectError:      true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &bootstrapv1.KubeadmConfig{
+				Spec: bootstrapv1.KubeadmConfigSpec{
+					NodeName: tc.nodeNameSpec,
+					JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+						NodeRegistration: kubeadmv1beta1.NodeRegistrationOptions{Name: tc.registrationName},
+					},
+				},
+			}
+			if tc.dataSource != "" {
+				config.Spec.FormatOptions = &bootstrapv1.FormatOptions{DataSource: tc.dataSource}
+			}
+
+			metadata, err := dataSourceMetadata(config, machine, tc.nodeName)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if len(metadata) != len(tc.expected) {
+				t.Fatalf("expected meta data %v, got %v", tc.expected, metadata)
+			}
+			for k, v := range tc.expected {
+				if string(metadata[k]) != v {
+					t.Errorf("expected %s to be %q, got %q", k, v, metadata[k])
+				}
+			}
+		})
+	}
+}
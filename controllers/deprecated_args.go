@@ -0,0 +1,153 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+// deprecatedArg is an argument of a component deprecated or removed in a Kubernetes version.
+type deprecatedArg struct {
+	component string
+	name      string
+	// deprecatedIn is the first version deprecating the argument, nil if it was removed without deprecation.
+	deprecatedIn *version.Version
+	// removedIn is the first version not accepting the argument anymore, nil if it is not removed yet.
+	removedIn *version.Version
+	// replacement is the argument replacing it, if any.
+	replacement string
+}
+
+// deprecatedArgs are the known deprecated arguments of the kubelet and the control plane components.
+var deprecatedArgs = []deprecatedArg{
+	{component: "kubelet", name: "allow-privileged", removedIn: version.MustParseSemantic("v1.15.0")},
+	{component: "kubelet", name: "network-plugin", deprecatedIn: version.MustParseSemantic("v1.20.0"), removedIn: version.MustParseSemantic("v1.24.0")},
+	{component: "kubelet", name: "cni-bin-dir", deprecatedIn: version.MustParseSemantic("v1.20.0"), removedIn: version.MustParseSemantic("v1.24.0")},
+	{component: "kubelet", name: "cni-conf-dir", deprecatedIn: version.MustParseSemantic("v1.20.0"), removedIn: version.MustParseSemantic("v1.24.0")},
+	{component: "kubelet", name: "docker-endpoint", deprecatedIn: version.MustParseSemantic("v1.20.0"), removedIn: version.MustParseSemantic("v1.24.0")},
+	{component: "kubelet", name: "image-pull-progress-deadline", deprecatedIn: version.MustParseSemantic("v1.20.0"), removedIn: version.MustParseSemantic("v1.24.0")},
+	{component: "kubelet", name: "container-runtime", deprecatedIn: version.MustParseSemantic("v1.24.0"), removedIn: version.MustParseSemantic("v1.27.0")},
+	{component: "kube-apiserver", name: "admission-control", deprecatedIn: version.MustParseSemantic("v1.10.0"), replacement: "enable-admission-plugins"},
+	{component: "kube-apiserver", name: "service-account-api-audiences", deprecatedIn: version.MustParseSemantic("v1.13.0"), replacement: "api-audiences"},
+	{component: "kube-apiserver", name: "basic-auth-file", deprecatedIn: version.MustParseSemantic("v1.16.0"), removedIn: version.MustParseSemantic("v1.19.0")},
+	{component: "kube-apiserver", name: "insecure-port", deprecatedIn: version.MustParseSemantic("v1.20.0"), removedIn: version.MustParseSemantic("v1.24.0")},
+	{component: "kube-apiserver", name: "insecure-bind-address", deprecatedIn: version.MustParseSemantic("v1.20.0"), removedIn: version.MustParseSemantic("v1.24.0")},
+	{component: "kube-scheduler", name: "address", deprecatedIn: version.MustParseSemantic("v1.13.0"), replacement: "bind-address"},
+	{component: "kube-scheduler", name: "port", deprecatedIn: version.MustParseSemantic("v1.13.0")},
+	{component: "kube-controller-manager", name: "address", deprecatedIn: version.MustParseSemantic("v1.13.0"), replacement: "bind-address"},
+	{component: "kube-controller-manager", name: "port", deprecatedIn: version.MustParseSemantic("v1.13.0")},
+}
+
+// status returns whether the argument is deprecated or removed in the given version.
+func (a deprecatedArg) status(v *version.Version) (deprecated, removed bool) {
+	removed = a.removedIn != nil && v.AtLeast(a.removedIn)
+	deprecated = !removed && a.deprecatedIn != nil && v.AtLeast(a.deprecatedIn)
+	return deprecated, removed
+}
+
+// migrateDeprecatedArgs returns a description of the deprecated or removed arguments of the component for the
+// version. When migrate is true, the arguments with a replacement are renamed, unless the replacement is already
+// set, and the removed arguments without replacement are dropped.
+func migrateDeprecatedArgs(component string, args map[string]string, v *version.Version, migrate bool) []string {
+	var found []string
+	for _, arg := range deprecatedArgs {
+		value, ok := args[arg.name]
+		if arg.component != component || !ok {
+			continue
+		}
+		deprecated, removed := arg.status(v)
+		if !deprecated && !removed {
+			continue
+		}
+
+		description := fmt.Sprintf("%s --%s is deprecated since %s", component, arg.name, arg.deprecatedIn)
+		if removed {
+			description = fmt.Sprintf("%s --%s is removed since %s", component, arg.name, arg.removedIn)
+		}
+		switch {
+		case arg.replacement != "":
+			description += fmt.Sprintf(", use --%s", arg.replacement)
+			if migrate {
+				if _, ok := args[arg.replacement]; !ok {
+					args[arg.replacement] = value
+				}
+				delete(args, arg.name)
+			}
+		case removed && migrate:
+			delete(args, arg.name)
+		}
+		found = append(found, description)
+	}
+	return found
+}
+
+// reconcileDeprecatedArgs reports the kubelet and control plane extra args of the config deprecated or removed in the
+// Kubernetes version of the Machine with the DeprecatedArgs condition, and migrates them if the config asks for it.
+// The control plane args are only checked for the init configuration, as they are ignored when joining.
+// Unknown versions are not checked.
+func (r *KubeadmConfigReconciler) reconcileDeprecatedArgs(config *bootstrapv1.KubeadmConfig, kubernetesVersion *string, init bool) error {
+	if kubernetesVersion == nil || *kubernetesVersion == "" {
+		return nil
+	}
+	v, err := version.ParseSemantic(*kubernetesVersion)
+	if err != nil {
+		return errors.Wrapf(err, "invalid Machine version %q", *kubernetesVersion)
+	}
+	migrate := config.Spec.DeprecatedArgs == bootstrapv1.MigrateDeprecatedArgs
+
+	var found []string
+	if init {
+		if config.Spec.InitConfiguration != nil {
+			found = append(found, migrateDeprecatedArgs("kubelet", config.Spec.InitConfiguration.NodeRegistration.KubeletExtraArgs, v, migrate)...)
+		}
+		if clusterConfiguration := config.Spec.ClusterConfiguration; clusterConfiguration != nil {
+			found = append(found, migrateDeprecatedArgs("kube-apiserver", clusterConfiguration.APIServer.ExtraArgs, v, migrate)...)
+			found = append(found, migrateDeprecatedArgs("kube-controller-manager", clusterConfiguration.ControllerManager.ExtraArgs, v, migrate)...)
+			found = append(found, migrateDeprecatedArgs("kube-scheduler", clusterConfiguration.Scheduler.ExtraArgs, v, migrate)...)
+		}
+	} else if config.Spec.JoinConfiguration != nil {
+		found = append(found, migrateDeprecatedArgs("kubelet", config.Spec.JoinConfiguration.NodeRegistration.KubeletExtraArgs, v, migrate)...)
+	}
+
+	now := metav1.Now()
+	if len(found) == 0 {
+		if condition := getCondition(config, bootstrapv1.DeprecatedArgsCondition); condition != nil {
+			setCondition(config, bootstrapv1.DeprecatedArgsCondition, corev1.ConditionFalse, DeprecatedArgsResolvedReason, "", now)
+		}
+		return nil
+	}
+
+	sort.Strings(found)
+	message := fmt.Sprintf("Extra args deprecated for Kubernetes %s: %s", *kubernetesVersion, strings.Join(found, "; "))
+	if migrate {
+		message = fmt.Sprintf("Extra args migrated for Kubernetes %s: %s", *kubernetesVersion, strings.Join(found, "; "))
+	}
+	condition := getCondition(config, bootstrapv1.DeprecatedArgsCondition)
+	if (condition == nil || condition.Status != corev1.ConditionTrue) && r.Recorder != nil {
+		r.Recorder.Event(config, corev1.EventTypeWarning, DeprecatedArgsReason, message)
+	}
+	setCondition(config, bootstrapv1.DeprecatedArgsCondition, corev1.ConditionTrue, DeprecatedArgsReason, message, now)
+	return nil
+}
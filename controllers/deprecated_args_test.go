@@ -0,0 +1,140 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestReconcileDeprecatedArgs(t *testing.T) {
+	v116, v124 := "v1.16.3", "v1.24.0"
+	testcases := []struct {
+		name              string
+		policy            bootstrapv1.DeprecatedArgsPolicy
+		kubernetesVersion *string
+		kubeletExtraArgs  map[string]string
+		schedulerArgs     map[string]string
+		expectedKubelet   map[string]string
+		expectedScheduler map[string]string
+		expectCondition   bool
+	}{
+		{
+			name:             "unknown versions are not checked",
+			kubeletExtraArgs: map[string]string{"allow-privileged": "true"},
+			expectedKubelet:  map[string]string{"allow-privileged": "true"},
+		},
+		{
+			name:              "args deprecated in later versions are not reported",
+			kubernetesVersion: &v116,
+			kubeletExtraArgs:  map[string]string{"network-plugin": "cni"},
+			expectedKubelet:   map[string]string{"network-plugin": "cni"},
+		},
+		{
+			name:              "deprecated and removed args are reported and kept by default",
+			kubernetesVersion: &v124,
+			kubeletExtraArgs:  map[string]string{"network-plugin": "cni", "node-labels": "tier=frontend"},
+			schedulerArgs:     map[string]string{"address": "0.0.0.0"},
+			expectedKubelet:   map[string]string{"network-plugin": "cni", "node-labels": "tier=frontend"},
+			expectedScheduler: map[string]string{"address": "0.0.0.0"},
+			expectCondition:   true,
+		},
+		{
+			name:              "migrate renames deprecated args and drops removed ones",
+			policy:            bootstrapv1.MigrateDeprecatedArgs,
+			kubernetesVersion: &v124,
+			kubeletExtraArgs:  map[string]string{"network-plugin": "cni", "node-labels": "tier=frontend"},
+			schedulerArgs:     map[string]string{"address": "0.0.0.0", "port": "0"},
+			expectedKubelet:   map[string]string{"node-labels": "tier=frontend"},
+			expectedScheduler: map[string]string{"bind-address": "0.0.0.0", "port": "0"},
+			expectCondition:   true,
+		},
+		{
+			name:              "migrate keeps the replacement set by the user",
+			policy:            bootstrapv1.MigrateDeprecatedArgs,
+			kubernetesVersion: &v116,
+			schedulerArgs:     map[string]string{"address": "0.0.0.0", "bind-address": "127.0.0.1"},
+			expectedScheduler: map[string]string{"bind-address": "127.0.0.1"},
+			expectCondition:   true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := newCluster("cluster")
+			machine := newControlPlaneMachine(cluster, "control-plane-machine")
+			config := newKubeadmConfig(machine, "control-plane-cfg")
+			config.Spec.DeprecatedArgs = tc.policy
+			config.Spec.InitConfiguration = &kubeadmv1beta1.InitConfiguration{
+				NodeRegistration: kubeadmv1beta1.NodeRegistrationOptions{KubeletExtraArgs: tc.kubeletExtraArgs},
+			}
+			config.Spec.ClusterConfiguration = &kubeadmv1beta1.ClusterConfiguration{}
+			config.Spec.ClusterConfiguration.Scheduler.ExtraArgs = tc.schedulerArgs
+
+			recorder := record.NewFakeRecorder(10)
+			k := &KubeadmConfigReconciler{Log: log.Log, Recorder: recorder}
+			if err := k.reconcileDeprecatedArgs(config, tc.kubernetesVersion, true); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(config.Spec.InitConfiguration.NodeRegistration.KubeletExtraArgs, tc.expectedKubelet) {
+				t.Errorf("expected kubelet args %v, got %v", tc.expectedKubelet, config.Spec.InitConfiguration.NodeRegistration.KubeletExtraArgs)
+			}
+			if !reflect.DeepEqual(config.Spec.ClusterConfiguration.Scheduler.ExtraArgs, tc.expectedScheduler) {
+				t.Errorf("expected scheduler args %v, got %v", tc.expectedScheduler, config.Spec.ClusterConfiguration.Scheduler.ExtraArgs)
+			}
+			condition := getCondition(config, bootstrapv1.DeprecatedArgsCondition)
+			if tc.expectCondition != (condition != nil && condition.Status == corev1.ConditionTrue) {
+				t.Errorf("expected the DeprecatedArgs condition to be %v, got %v", tc.expectCondition, condition)
+			}
+			if tc.expectCondition != (len(recorder.Events) == 1) {
+				t.Errorf("expected an event to be emitted: %v, got %d", tc.expectCondition, len(recorder.Events))
+			}
+		})
+	}
+}
+
+func TestReconcileDeprecatedArgsResolved(t *testing.T) {
+	v124 := "v1.24.0"
+	cluster := newCluster("cluster")
+	machine := newWorkerMachine(cluster)
+	config := newKubeadmConfig(machine, "worker-join-cfg")
+	config.Spec.JoinConfiguration = &kubeadmv1beta1.JoinConfiguration{
+		NodeRegistration: kubeadmv1beta1.NodeRegistrationOptions{KubeletExtraArgs: map[string]string{"docker-endpoint": "unix:///var/run/docker.sock"}},
+	}
+	k := &KubeadmConfigReconciler{Log: log.Log}
+
+	if err := k.reconcileDeprecatedArgs(config, &v124, false); err != nil {
+		t.Fatal(err)
+	}
+	if condition := getCondition(config, bootstrapv1.DeprecatedArgsCondition); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected the DeprecatedArgs condition to be set, got %v", condition)
+	}
+
+	delete(config.Spec.JoinConfiguration.NodeRegistration.KubeletExtraArgs, "docker-endpoint")
+	if err := k.reconcileDeprecatedArgs(config, &v124, false); err != nil {
+		t.Fatal(err)
+	}
+	if condition := getCondition(config, bootstrapv1.DeprecatedArgsCondition); condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != DeprecatedArgsResolvedReason {
+		t.Errorf("expected the DeprecatedArgs condition to be resolved, got %v", condition)
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// diagnosticsSecretType is the type of the secrets storing the bootstrap logs of failed machines.
+	diagnosticsSecretType corev1.SecretType = "bootstrap.cluster.x-k8s.io/diagnostics"
+
+	// diagnosticsSecretKey is the key of the compressed logs in the diagnostics secrets.
+	diagnosticsSecretKey = "logs.tar.gz"
+
+	// diagnosticsPollInterval is the interval the workload cluster is checked at for uploaded diagnostics.
+	diagnosticsPollInterval = time.Minute
+
+	diagnosticsScriptName = "cabpk-bootstrap-diagnostics"
+	diagnosticsUnitName   = "cabpk-bootstrap-diagnostics.service"
+
+	// diagnosticsUnit runs once cloud-init is done executing the bootstrap data, whether kubeadm succeeded or not.
+	diagnosticsUnit = `[Unit]
+Description=Upload the bootstrap logs if kubeadm failed
+After=cloud-final.service
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`
+)
+
+// diagnosticsSecretName returns the name of the workload cluster secret the machine of the config uploads its
+// bootstrap logs to.
+func diagnosticsSecretName(config *bootstrapv1.KubeadmConfig) string {
+	return "cabpk-diagnostics-" + config.Name
+}
+
+// addBootstrapDiagnostics adds the unit and the script uploading the bootstrap logs if kubeadm fails to the user data.
+// Without an upload URL, the logs are uploaded with the bootstrap token to a workload cluster secret created in
+// advance, which only joining machines can do, and only the bootstrap token of the config can write.
+func (r *KubeadmConfigReconciler) addBootstrapDiagnostics(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, joinConfiguration *kubeadmv1beta1.JoinConfiguration, certificates internalcluster.Certificates, userData *cloudinit.BaseUserData) error {
+	diagnostics := config.Spec.Diagnostics
+	if diagnostics == nil {
+		return nil
+	}
+
+	input := &cloudinit.DiagnosticsInput{UploadURL: diagnostics.UploadURL}
+	if diagnostics.UploadURL != "" {
+		u, err := url.Parse(diagnostics.UploadURL)
+		if err != nil {
+			return errors.Wrapf(err, "invalid diagnostics upload URL %q", diagnostics.UploadURL)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Contains(diagnostics.UploadURL, "\n") {
+			return errors.Errorf("invalid diagnostics upload URL %q: must be an http or https URL", diagnostics.UploadURL)
+		}
+	} else {
+		if joinConfiguration == nil || joinConfiguration.Discovery.BootstrapToken == nil || joinConfiguration.Discovery.BootstrapToken.Token == "" {
+			return errors.New("bootstrap diagnostics require an upload URL for machines not joining with a bootstrap token")
+		}
+
+		name := diagnosticsSecretName(config)
+		if err := r.createDiagnosticsSecret(ctx, cluster, config, name); err != nil {
+			return err
+		}
+		if err := r.ensureBootstrapTokenRole(ctx, cluster, "cabpk:bootstrap-diagnostics:"+config.Name, joinConfiguration.Discovery.BootstrapToken.Token, []rbacv1.PolicyRule{
+			{
+				Verbs:         []string{"get", "update"},
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{name},
+			},
+		}); err != nil {
+			return err
+		}
+
+		input.APIServerEndpoint = joinConfiguration.Discovery.BootstrapToken.APIServerEndpoint
+		input.CACert = string(certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair.Cert)
+		input.Token = joinConfiguration.Discovery.BootstrapToken.Token
+		input.Namespace = metav1.NamespaceSystem
+		input.SecretName = name
+		input.SecretType = string(diagnosticsSecretType)
+		input.SecretKey = diagnosticsSecretKey
+	}
+
+	script, err := cloudinit.NewDiagnosticsScript(input)
+	if err != nil {
+		return err
+	}
+
+	userData.AdditionalFiles = append(userData.AdditionalFiles,
+		bootstrapv1.File{
+			Path:        scriptPath(config, diagnosticsScriptName),
+			Owner:       "root:root",
+			Permissions: "0700",
+			Content:     string(script),
+		},
+		bootstrapv1.File{
+			Path:        "/etc/systemd/system/" + diagnosticsUnitName,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     fmt.Sprintf(diagnosticsUnit, scriptPath(config, diagnosticsScriptName)),
+		},
+	)
+	// the unit waits for cloud-init to complete, so it is queued without blocking the commands
+	userData.PreKubeadmCommands = append([]string{"systemctl daemon-reload", "systemctl start --no-block " + diagnosticsUnitName}, userData.PreKubeadmCommands...)
+	return nil
+}
+
+// createDiagnosticsSecret creates the empty workload cluster secret the bootstrap logs are uploaded to, as
+// bootstrap tokens can only be allowed to update secrets with a known name. Existing secrets are left untouched.
+func (r *KubeadmConfigReconciler) createDiagnosticsSecret(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, name string) error {
+	secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: metav1.NamespaceSystem,
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: cluster.Name,
+				TokenConfigLabelName:              config.Name,
+			},
+		},
+		Type: diagnosticsSecretType,
+	}
+	if _, err := secretsClient.Create(s); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "failed to create diagnostics secret %s", name)
+	}
+	return nil
+}
+
+// reconcileBootstrapDiagnostics copies the bootstrap logs uploaded to the workload cluster by the machine of the
+// config to the management cluster, and emits a warning event. The copy is owned by the Cluster rather than the
+// config, so that it outlives failed machines that get deleted. The workload cluster is polled until the node
+// joins or the logs are copied.
+func (r *KubeadmConfigReconciler) reconcileBootstrapDiagnostics(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, machine *clusterv1.Machine) (ctrl.Result, error) {
+	if config.Spec.Diagnostics == nil || config.Spec.Diagnostics.UploadURL != "" || machine.Status.NodeRef != nil {
+		return ctrl.Result{}, nil
+	}
+
+	name := config.Name + "-bootstrap-diagnostics"
+	if err := r.Get(ctx, client.ObjectKey{Namespace: config.Namespace, Name: name}, &corev1.Secret{}); err == nil {
+		return ctrl.Result{}, nil
+	} else if !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to get diagnostics secret %s/%s", config.Namespace, name)
+	}
+
+	secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	uploaded, err := secretsClient.Get(diagnosticsSecretName(config), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// init control planes upload their logs to an upload URL
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to get diagnostics secret %s from the workload cluster", diagnosticsSecretName(config))
+	}
+	if len(uploaded.Data[diagnosticsSecretKey]) == 0 {
+		return ctrl.Result{RequeueAfter: diagnosticsPollInterval}, nil
+	}
+
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: config.Namespace,
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+				},
+			},
+		},
+		Type: diagnosticsSecretType,
+		Data: map[string][]byte{
+			diagnosticsSecretKey: uploaded.Data[diagnosticsSecretKey],
+		},
+	}
+	if err := r.Create(ctx, s); err != nil && !apierrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to create diagnostics secret %s/%s", config.Namespace, name)
+	}
+	if r.Recorder != nil {
+		r.Recorder.Eventf(config, corev1.EventTypeWarning, BootstrapFailedReason, "Machine %s failed to bootstrap, its logs are stored in secret %s", machine.Name, name)
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestAddBootstrapDiagnostics(t *testing.T) {
+	cluster := newCluster("cluster")
+	certificates := internalcluster.Certificates{
+		&internalcluster.Certificate{Purpose: internalcluster.ClusterCA, KeyPair: &certs.KeyPair{Cert: []byte("ca-cert")}},
+	}
+	joinConfiguration := &kubeadmv1beta1.JoinConfiguration{
+		Discovery: kubeadmv1beta1.Discovery{
+			BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{
+				APIServerEndpoint: "10.0.0.1:6443",
+				Token:             "abcdef.0123456789abcdef",
+			},
+		},
+	}
+	newConfig := func(diagnostics *bootstrapv1.BootstrapDiagnostics) *bootstrapv1.KubeadmConfig {
+		return &bootstrapv1.KubeadmConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"},
+			Spec:       bootstrapv1.KubeadmConfigSpec{Diagnostics: diagnostics},
+		}
+	}
+
+	tests := []struct {
+		name              string
+		diagnostics       *bootstrapv1.BootstrapDiagnostics
+		joinConfiguration *kubeadmv1beta1.JoinConfiguration
+		expectedInScript  []string
+		expectSecret      bool
+		expectError       bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:             "upload URL",
+			diagnostics:      &bootstrapv1.BootstrapDiagnostics{UploadURL: "https://bucket.example.com/logs?sig=abc"},
+			expectedInScript: []string{"curl -sSf --retry 5 -X PUT -T \"$archive\" 'https://bucket.example.com/logs?sig=abc'"},
+		},
+		{
+			name:              "workload cluster",
+			diagnostics:       &bootstrapv1.BootstrapDiagnostics{},
+			joinConfiguration: joinConfiguration,
+			expectedInScript:  []string{"--token='abcdef.0123456789abcdef' replace", "'cabpk-diagnostics-config' 'kube-system'"},
+			expectSecret:      true,
+		},
+		{
+			name:        "workload cluster without bootstrap token",
+			diagnostics: &bootstrapv1.BootstrapDiagnostics{},
+			expectError: true,
+		},
+		{
+			name:        "upload URL with an unsupported scheme",
+			diagnostics: &bootstrapv1.BootstrapDiagnostics{UploadURL: "ftp://bucket.example.com/logs"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fakeclient.NewSimpleClientset()
+			k := &KubeadmConfigReconciler{
+				Log:                  log.Log,
+				SecretsClientFactory: FakeSecretFactory{client: clientset.CoreV1().Secrets(metav1.NamespaceSystem)},
+				RBACClientFactory:    fakeRBACFactory{client: clientset.RbacV1()},
+			}
+			userData := cloudinit.BaseUserData{PreKubeadmCommands: []string{"echo pre"}}
+			err := k.addBootstrapDiagnostics(context.Background(), cluster, newConfig(tt.diagnostics), tt.joinConfiguration, certificates, &userData)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+
+			if tt.diagnostics == nil {
+				if len(userData.AdditionalFiles) != 0 || len(userData.PreKubeadmCommands) != 1 {
+					t.Errorf("expected the user data not to change, got %+v", userData)
+				}
+				return
+			}
+			if len(userData.AdditionalFiles) != 2 || userData.AdditionalFiles[0].Path != "/usr/local/bin/cabpk-bootstrap-diagnostics" {
+				t.Fatalf("expected the diagnostics script and unit, got %+v", userData.AdditionalFiles)
+			}
+			if userData.PreKubeadmCommands[1] != "systemctl start --no-block "+diagnosticsUnitName {
+				t.Errorf("expected the diagnostics unit to be started first, got %v", userData.PreKubeadmCommands)
+			}
+			script := userData.AdditionalFiles[0].Content
+			for _, s := range tt.expectedInScript {
+				if !strings.Contains(script, s) {
+					t.Errorf("expected the diagnostics script to contain %q, got:\n%s", s, script)
+				}
+			}
+
+			_, err = clientset.CoreV1().Secrets(metav1.NamespaceSystem).Get("cabpk-diagnostics-config", metav1.GetOptions{})
+			if (err == nil) != tt.expectSecret {
+				t.Errorf("expected the diagnostics secret to exist: %v, got error %v", tt.expectSecret, err)
+			}
+			if tt.expectSecret {
+				if _, err := clientset.RbacV1().Roles(metav1.NamespaceSystem).Get("cabpk:bootstrap-diagnostics:config", metav1.GetOptions{}); err != nil {
+					t.Errorf("expected the diagnostics Role to exist: %v", err)
+				}
+				binding, err := clientset.RbacV1().RoleBindings(metav1.NamespaceSystem).Get("cabpk:bootstrap-diagnostics:config", metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("expected the diagnostics RoleBinding to exist: %v", err)
+				}
+				if len(binding.Subjects) != 1 || binding.Subjects[0].Kind != rbacv1.UserKind || binding.Subjects[0].Name != "system:bootstrap:abcdef" {
+					t.Errorf("expected the diagnostics Role to be bound to the bootstrap token of the config, got %+v", binding.Subjects)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileBootstrapDiagnostics(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newWorkerMachine(cluster)
+	config := newWorkerJoinKubeadmConfig(machine)
+	config.Spec.Diagnostics = &bootstrapv1.BootstrapDiagnostics{}
+
+	secretsFactory := newFakeSecretFactory()
+	recorder := record.NewFakeRecorder(10)
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               newFakeClientWithScheme(setupScheme(), cluster, machine, config),
+		SecretsClientFactory: secretsFactory,
+		Recorder:             recorder,
+	}
+	if err := k.createDiagnosticsSecret(context.Background(), cluster, config, diagnosticsSecretName(config)); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+
+	// the workload cluster is polled until logs are uploaded
+	result, err := k.reconcileBootstrapDiagnostics(context.Background(), cluster, config, machine)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if result.RequeueAfter != diagnosticsPollInterval {
+		t.Errorf("expected requeue after %v, got %+v", diagnosticsPollInterval, result)
+	}
+
+	uploaded := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: diagnosticsSecretName(config), Namespace: metav1.NamespaceSystem},
+		Type:       diagnosticsSecretType,
+		Data:       map[string][]byte{diagnosticsSecretKey: []byte("logs")},
+	}
+	if _, err := secretsFactory.client.Update(uploaded); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+
+	result, err = k.reconcileBootstrapDiagnostics(context.Background(), cluster, config, machine)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if result.RequeueAfter != 0 {
+		t.Errorf("expected no requeue once the logs are copied, got %+v", result)
+	}
+	s := &corev1.Secret{}
+	if err := k.Get(context.Background(), client.ObjectKey{Namespace: config.Namespace, Name: config.Name + "-bootstrap-diagnostics"}, s); err != nil {
+		t.Fatalf("expected the diagnostics secret to be copied: %v", err)
+	}
+	if string(s.Data[diagnosticsSecretKey]) != "logs" || len(s.OwnerReferences) != 1 || s.OwnerReferences[0].Kind != "Cluster" {
+		t.Errorf("unexpected diagnostics secret %+v", s)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, BootstrapFailedReason) {
+			t.Errorf("expected a %s event, got %q", BootstrapFailedReason, event)
+		}
+	default:
+		t.Error("expected an event to be emitted")
+	}
+}
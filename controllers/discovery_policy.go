@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+)
+
+const (
+	// RequireCACertHashesAnnotation is set to "true" on a Cluster to forbid its machines from joining without
+	// verifying the cluster CA, i.e. with bootstrap token discovery skipping the CA verification.
+	RequireCACertHashesAnnotation = "bootstrap.cluster.x-k8s.io/require-ca-cert-hashes"
+)
+
+// requireCACertHashes returns true if the machines of the cluster must verify the cluster CA when joining, as
+// required for all clusters by the controller or for the cluster by its annotation.
+func (r *KubeadmConfigReconciler) requireCACertHashes(cluster *clusterv1.Cluster) bool {
+	return r.RequireCACertHashes || cluster.Annotations[RequireCACertHashesAnnotation] == "true"
+}
+
+// insecureDiscovery describes why the bootstrap token discovery of the config skips the verification of the
+// cluster CA, or returns an empty string if it does not.
+func insecureDiscovery(config *bootstrapv1.KubeadmConfig) string {
+	if config.Spec.JoinConfiguration == nil || config.Spec.JoinConfiguration.Discovery.BootstrapToken == nil {
+		return ""
+	}
+	token := config.Spec.JoinConfiguration.Discovery.BootstrapToken
+	switch {
+	case token.UnsafeSkipCAVerification:
+		return "JoinConfiguration.Discovery.BootstrapToken.UnsafeSkipCAVerification is set"
+	case len(token.CACertHashes) == 0:
+		return "JoinConfiguration.Discovery.BootstrapToken.CACertHashes is empty"
+	}
+	return ""
+}
+
+// reconcileInsecureDiscovery rejects the config with the InsecureDiscovery condition and a warning event if its
+// discovery skips the verification of the cluster CA while the cluster requires it. The config is requeued until it
+// is fixed or the requirement is lifted.
+func (r *KubeadmConfigReconciler) reconcileInsecureDiscovery(cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) error {
+	now := metav1.Now()
+	reason := ""
+	if r.requireCACertHashes(cluster) {
+		reason = insecureDiscovery(config)
+	}
+	if reason == "" {
+		if condition := getCondition(config, bootstrapv1.InsecureDiscoveryCondition); condition != nil {
+			setCondition(config, bootstrapv1.InsecureDiscoveryCondition, corev1.ConditionFalse, SecureDiscoveryReason, "", now)
+		}
+		return nil
+	}
+
+	message := fmt.Sprintf("Cluster %s requires the verification of the cluster CA when joining, but %s", cluster.Name, reason)
+	condition := getCondition(config, bootstrapv1.InsecureDiscoveryCondition)
+	if (condition == nil || condition.Status != corev1.ConditionTrue) && r.Recorder != nil {
+		r.Recorder.Event(config, corev1.EventTypeWarning, InsecureDiscoveryReason, message)
+	}
+	setCondition(config, bootstrapv1.InsecureDiscoveryCondition, corev1.ConditionTrue, InsecureDiscoveryReason, message, now)
+	return errors.Wrap(&capierrors.RequeueAfterError{RequeueAfter: currentTunables().RequeueInterval}, message)
+}
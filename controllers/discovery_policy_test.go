@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestReconcileInsecureDiscovery(t *testing.T) {
+	testcases := []struct {
+		name           string
+		requireFlag    bool
+		annotation     string
+		token          *kubeadmv1beta1.BootstrapTokenDiscovery
+		expectRejected bool
+	}{
+		{
+			name:  "insecure discovery is allowed by default",
+			token: &kubeadmv1beta1.BootstrapTokenDiscovery{UnsafeSkipCAVerification: true},
+		},
+		{
+			name:           "the flag forbids skipping the CA verification",
+			requireFlag:    true,
+			token:          &kubeadmv1beta1.BootstrapTokenDiscovery{CACertHashes: []string{"sha256:abc"}, UnsafeSkipCAVerification: true},
+			expectRejected: true,
+		},
+		{
+			name:           "the annotation forbids discovery without CA cert hashes",
+			annotation:     "true",
+			token:          &kubeadmv1beta1.BootstrapTokenDiscovery{},
+			expectRejected: true,
+		},
+		{
+			name:        "discovery verifying the CA is accepted",
+			requireFlag: true,
+			token:       &kubeadmv1beta1.BootstrapTokenDiscovery{CACertHashes: []string{"sha256:abc"}},
+		},
+		{
+			name:        "file discovery is accepted",
+			requireFlag: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := newCluster("cluster")
+			if tc.annotation != "" {
+				cluster.Annotations = map[string]string{RequireCACertHashesAnnotation: tc.annotation}
+			}
+			config := newKubeadmConfig(newWorkerMachine(cluster), "worker-join-cfg")
+			config.Spec.JoinConfiguration = &kubeadmv1beta1.JoinConfiguration{Discovery: kubeadmv1beta1.Discovery{BootstrapToken: tc.token}}
+			recorder := record.NewFakeRecorder(10)
+			k := &KubeadmConfigReconciler{Log: log.Log, Recorder: recorder, RequireCACertHashes: tc.requireFlag}
+
+			err := k.reconcileInsecureDiscovery(cluster, config)
+			if _, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); tc.expectRejected != ok {
+				t.Fatalf("expected the config to be rejected: %v, got %v", tc.expectRejected, err)
+			}
+			condition := getCondition(config, bootstrapv1.InsecureDiscoveryCondition)
+			if tc.expectRejected != (condition != nil && condition.Status == corev1.ConditionTrue) {
+				t.Errorf("expected the %s condition to be %v, got %+v", bootstrapv1.InsecureDiscoveryCondition, tc.expectRejected, condition)
+			}
+			if tc.expectRejected != (len(recorder.Events) == 1) {
+				t.Errorf("expected an event to be emitted: %v, got %d", tc.expectRejected, len(recorder.Events))
+			}
+		})
+	}
+}
+
+func TestReconcileDiscoveryRequireCACertHashes(t *testing.T) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "cluster",
+			Annotations: map[string]string{RequireCACertHashesAnnotation: "true"},
+		},
+		Status: clusterv1.ClusterStatus{
+			APIEndpoints: []clusterv1.APIEndpoint{{Host: "example.com", Port: 6443}},
+		},
+	}
+	config := newManualDiscoveryConfig(kubeadmv1beta1.Discovery{
+		BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{
+			APIServerEndpoint:        "lb.example.com:6443",
+			Token:                    "abcdef.0123456789abcdef",
+			UnsafeSkipCAVerification: true,
+		},
+	})
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               newFakeClientWithScheme(setupScheme()),
+		SecretsClientFactory: newFakeSecretFactory(),
+	}
+
+	err := k.reconcileDiscovery(context.Background(), cluster, config, internalcluster.Certificates{}, nil)
+	if _, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); !ok {
+		t.Fatalf("expected the insecure manual discovery to be rejected, got %v", err)
+	}
+	if reason := discoveryRequeueReason(config); reason != InsecureDiscoveryReason {
+		t.Errorf("expected the config to be requeued with reason %s, got %s", InsecureDiscoveryReason, reason)
+	}
+
+	config.Spec.JoinConfiguration.Discovery.BootstrapToken.UnsafeSkipCAVerification = false
+	config.Spec.JoinConfiguration.Discovery.BootstrapToken.CACertHashes = []string{"sha256:abc"}
+	if err := k.reconcileDiscovery(context.Background(), cluster, config, internalcluster.Certificates{}, nil); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if condition := getCondition(config, bootstrapv1.InsecureDiscoveryCondition); condition.Status != corev1.ConditionFalse || condition.Reason != SecureDiscoveryReason {
+		t.Errorf("expected the %s condition to be false once the CA is verified, got %+v", bootstrapv1.InsecureDiscoveryCondition, condition)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+const (
+	dnsResolvConfPath      = "/etc/kubernetes/resolv.conf"
+	dnsResolvedDropInPath  = "/etc/systemd/resolved.conf.d/cabpk-dns.conf"
+	resolvedUpstreamConfig = "/run/systemd/resolve/resolv.conf"
+)
+
+// dnsFiles returns the resolv.conf or the systemd-resolved drop-in configuring the DNS servers and search domains of
+// the config, along with the commands to be run before kubeadm for the machine to use them.
+func dnsFiles(config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, error) {
+	dns := config.Spec.DNS
+	if dns == nil {
+		return nil, nil, nil
+	}
+	if errs := bootstrapv1.ValidateDNS(&config.Spec, field.NewPath("spec")); len(errs) > 0 {
+		return nil, nil, errs.ToAggregate()
+	}
+
+	if dns.Resolver == bootstrapv1.SystemdResolvedResolver {
+		if len(dns.Nameservers) == 0 && len(dns.SearchDomains) == 0 {
+			return nil, nil, nil
+		}
+		var dropIn strings.Builder
+		dropIn.WriteString("[Resolve]\n")
+		if len(dns.Nameservers) > 0 {
+			fmt.Fprintf(&dropIn, "DNS=%s\n", strings.Join(dns.Nameservers, " "))
+		}
+		if len(dns.SearchDomains) > 0 {
+			fmt.Fprintf(&dropIn, "Domains=%s\n", strings.Join(dns.SearchDomains, " "))
+		}
+		files := []bootstrapv1.File{
+			{
+				Path:        dnsResolvedDropInPath,
+				Owner:       "root:root",
+				Permissions: "0644",
+				Content:     dropIn.String(),
+			},
+		}
+		return files, []string{"systemctl restart systemd-resolved"}, nil
+	}
+
+	var resolvConf strings.Builder
+	for _, nameserver := range dns.Nameservers {
+		fmt.Fprintf(&resolvConf, "nameserver %s\n", nameserver)
+	}
+	if len(dns.SearchDomains) > 0 {
+		fmt.Fprintf(&resolvConf, "search %s\n", strings.Join(dns.SearchDomains, " "))
+	}
+	files := []bootstrapv1.File{
+		{
+			Path:        dnsResolvConfPath,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     resolvConf.String(),
+		},
+	}
+	return files, []string{"ln -sf " + dnsResolvConfPath + " /etc/resolv.conf"}, nil
+}
+
+// applyDNSToNodeRegistration sets the resolv.conf the kubelet passes to pods on the node registration: the one set
+// by the config, or the one of its resolver. The local stub resolver of systemd-resolved cannot be reached from pods,
+// so its upstream servers are used.
+func applyDNSToNodeRegistration(dns *bootstrapv1.NodeDNS, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions) {
+	if dns == nil {
+		return
+	}
+	resolvConf := dns.KubeletResolvConf
+	if resolvConf == "" {
+		resolvConf = dnsResolvConfPath
+		if dns.Resolver == bootstrapv1.SystemdResolvedResolver {
+			resolvConf = resolvedUpstreamConfig
+		}
+	}
+	if nodeRegistration.KubeletExtraArgs == nil {
+		nodeRegistration.KubeletExtraArgs = map[string]string{}
+	}
+	nodeRegistration.KubeletExtraArgs["resolv-conf"] = resolvConf
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestDNSFiles(t *testing.T) {
+	testcases := []struct {
+		name             string
+		dns              *bootstrapv1.NodeDNS
+		expectedFiles    map[string]string
+		expectedCommands []string
+		expectedArgs     map[string]string
+		expectErr        bool
+	}{
+		{
+			name: "nothing is configured by default",
+		},
+		{
+			name:             "resolv.conf",
+			dns:              &bootstrapv1.NodeDNS{Nameservers: []string{"10.0.0.2", "10.0.0.3"}, SearchDomains: []string{"corp.example.com", "example.com"}},
+			expectedFiles:    map[string]string{dnsResolvConfPath: "nameserver 10.0.0.2\nnameserver 10.0.0.3\nsearch corp.example.com example.com\n"},
+			expectedCommands: []string{"ln -sf /etc/kubernetes/resolv.conf /etc/resolv.conf"},
+			expectedArgs:     map[string]string{"resolv-conf": dnsResolvConfPath},
+		},
+		{
+			name:             "systemd-resolved",
+			dns:              &bootstrapv1.NodeDNS{Resolver: bootstrapv1.SystemdResolvedResolver, Nameservers: []string{"10.0.0.2"}, SearchDomains: []string{"corp.example.com"}},
+			expectedFiles:    map[string]string{dnsResolvedDropInPath: "[Resolve]\nDNS=10.0.0.2\nDomains=corp.example.com\n"},
+			expectedCommands: []string{"systemctl restart systemd-resolved"},
+			expectedArgs:     map[string]string{"resolv-conf": resolvedUpstreamConfig},
+		},
+		{
+			name:         "systemd-resolved only configures the kubelet without nameservers",
+			dns:          &bootstrapv1.NodeDNS{Resolver: bootstrapv1.SystemdResolvedResolver, KubeletResolvConf: "/etc/kubernetes/pods-resolv.conf"},
+			expectedArgs: map[string]string{"resolv-conf": "/etc/kubernetes/pods-resolv.conf"},
+		},
+		{
+			name:      "invalid nameservers are rejected",
+			dns:       &bootstrapv1.NodeDNS{Nameservers: []string{"10.0.0.2\nnameserver 192.0.2.1"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKubeadmConfig(newWorkerMachine(newCluster("cluster")), "worker-join-cfg")
+			config.Spec.DNS = tc.dns
+			files, commands, err := dnsFiles(config)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error: %v, got %v", tc.expectErr, err)
+			}
+			if tc.expectErr {
+				return
+			}
+			var contents map[string]string
+			for _, f := range files {
+				if contents == nil {
+					contents = map[string]string{}
+				}
+				contents[f.Path] = f.Content
+			}
+			if !reflect.DeepEqual(contents, tc.expectedFiles) {
+				t.Errorf("expected files %v, got %v", tc.expectedFiles, contents)
+			}
+			if !reflect.DeepEqual(commands, tc.expectedCommands) {
+				t.Errorf("expected commands %v, got %v", tc.expectedCommands, commands)
+			}
+
+			nodeRegistration := &kubeadmv1beta1.NodeRegistrationOptions{}
+			applyDNSToNodeRegistration(tc.dns, nodeRegistration)
+			if !reflect.DeepEqual(nodeRegistration.KubeletExtraArgs, tc.expectedArgs) {
+				t.Errorf("expected kubelet args %v, got %v", tc.expectedArgs, nodeRegistration.KubeletExtraArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/patch"
+)
+
+// specHash returns the hash of the config spec, including the defaults set by the reconciler while rendering. The
+// files and commands of the node agent are excluded, as they are applied to the node after the bootstrap data.
+func specHash(spec *bootstrapv1.KubeadmConfigSpec) (string, error) {
+	if spec.NodeAgent != nil {
+		spec = spec.DeepCopy()
+		spec.NodeAgent.Files, spec.NodeAgent.Commands = nil, nil
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal spec")
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// reconcileBootstrapDataDrift records on the config whether its spec was changed after the bootstrap data was
+// rendered, and emits a warning event when a change is detected. Configs rendered before the spec hash was recorded
+// are never reported out of date. The config is only patched when the condition changes.
+func (r *KubeadmConfigReconciler) reconcileBootstrapDataDrift(ctx context.Context, config *bootstrapv1.KubeadmConfig) (bool, error) {
+	if !config.Status.Ready || config.Status.RenderedSpecHash == "" {
+		return false, nil
+	}
+
+	hash, err := specHash(&config.Spec)
+	if err != nil {
+		return false, err
+	}
+	outOfDate := hash != config.Status.RenderedSpecHash
+
+	status, reason, message := corev1.ConditionFalse, SpecUpToDateReason, ""
+	if outOfDate {
+		status, reason, message = corev1.ConditionTrue, SpecChangedReason, "The spec was changed after the bootstrap data was rendered"
+	}
+
+	condition := getCondition(config, bootstrapv1.BootstrapDataOutOfDateCondition)
+	if condition == nil && !outOfDate {
+		return false, nil
+	}
+	if condition != nil && condition.Status == status && condition.Reason == reason {
+		return outOfDate, nil
+	}
+
+	patchHelper, err := patch.NewHelper(config, r)
+	if err != nil {
+		return false, err
+	}
+	setCondition(config, bootstrapv1.BootstrapDataOutOfDateCondition, status, reason, message, metav1.Now())
+	if outOfDate && r.Recorder != nil {
+		r.Recorder.Event(config, corev1.EventTypeWarning, reason, message)
+	}
+	return outOfDate, patchHelper.Patch(ctx, config)
+}
+
+// isMachineProvisioned returns true if the bootstrap data may already have been consumed by the machine, either
+// because it was copied to the Machine or because the machine infrastructure is ready.
+func isMachineProvisioned(machine *clusterv1.Machine) bool {
+	return machine.Spec.Bootstrap.Data != nil || machine.Status.InfrastructureReady
+}
+
+// resetBootstrapData clears the bootstrap data status of the config so that it is rendered again. The config is
+// patched right away, so that the reset is not lost if the reconciliation returns before rendering the bootstrap data.
+func (r *KubeadmConfigReconciler) resetBootstrapData(ctx context.Context, config *bootstrapv1.KubeadmConfig) error {
+	patchHelper, err := patch.NewHelper(config, r)
+	if err != nil {
+		return err
+	}
+	config.Status.Ready = false
+	config.Status.DataSecretName = nil
+	config.Status.BootstrapData = nil
+	config.Status.BootstrapDataEncoding = ""
+	return patchHelper.Patch(ctx, config)
+}
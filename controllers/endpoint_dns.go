@@ -0,0 +1,155 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"strconv"
+	"text/template"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+const (
+	// SRVEndpointPlaceholder is the discovery API server endpoint of the join configuration of machines resolving it
+	// from a DNS SRV record; it is replaced on the machine before kubeadm runs.
+	SRVEndpointPlaceholder = "$(API_SERVER_ENDPOINT)"
+
+	defaultEndpointDNSPort = 6443
+
+	srvEndpointScriptName = "cabpk-resolve-api-server-endpoint"
+
+	// srvEndpointScript resolves the SRV record, retrying while the record is not published, and replaces the
+	// placeholder in the join configuration passed as its first argument.
+	srvEndpointScript = `#!/bin/sh
+# Resolves the API server endpoint from a DNS SRV record and writes it to the kubeadm join configuration.
+set -e
+record='{{ .SRVRecord }}'
+resolve() {
+  if command -v dig >/dev/null 2>&1; then
+    dig +short SRV "$record"
+  elif command -v host >/dev/null 2>&1; then
+    host -t SRV "$record" | awk '/has SRV record/ {print $(NF-3), $(NF-2), $(NF-1), $NF}'
+  else
+    echo "dig or host is required to resolve $record" >&2
+    exit 1
+  fi
+}
+endpoint=""
+attempts=0
+while [ -z "$endpoint" ]; do
+  endpoint=$(resolve | sort -k1,1n -k2,2nr | awk 'NF == 4 {sub(/\.$/, "", $4); print $4 ":" $3; exit}' || true)
+  if [ -z "$endpoint" ]; then
+    attempts=$((attempts + 1))
+    if [ "$attempts" -ge 30 ]; then
+      echo "failed to resolve the SRV record $record" >&2
+      exit 1
+    fi
+    sleep 10
+  fi
+done
+sed -i "s/\$(API_SERVER_ENDPOINT)/$endpoint/" "$1"
+`
+)
+
+var (
+	srvEndpointScriptTemplate = template.Must(template.New("SRVEndpoint").Parse(srvEndpointScript))
+
+	// dnsNameRegex matches DNS names, including the underscore prefixed labels of SRV records.
+	dnsNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9])?)*\.?$`)
+)
+
+// dnsEndpoint returns the discovery API server endpoint of the config resolved from DNS, which is a placeholder
+// replaced on the machine for SRV records.
+func dnsEndpoint(dns *bootstrapv1.APIServerEndpointDNS) string {
+	if dns.SRVRecord != "" {
+		return SRVEndpointPlaceholder
+	}
+	port := dns.Port
+	if port == 0 {
+		port = defaultEndpointDNSPort
+	}
+	return net.JoinHostPort(dns.Name, strconv.Itoa(int(port)))
+}
+
+// validateAPIServerEndpointDNS returns an error if the DNS settings of the API server endpoint of the config are
+// invalid, or conflict with discovery settings that do not use it.
+func validateAPIServerEndpointDNS(config *bootstrapv1.KubeadmConfig) error {
+	dns := config.Spec.APIServerEndpointDNS
+	if dns == nil {
+		return nil
+	}
+
+	if (dns.Name == "") == (dns.SRVRecord == "") {
+		return errors.New("apiServerEndpointDNS requires exactly one of name or srvRecord")
+	}
+	for _, name := range []string{dns.Name, dns.SRVRecord} {
+		if name != "" && (len(name) > 253 || !dnsNameRegex.MatchString(name)) {
+			return errors.Errorf("invalid apiServerEndpointDNS DNS name %q", name)
+		}
+	}
+	if dns.Port < 0 || dns.Port > 65535 {
+		return errors.Errorf("invalid apiServerEndpointDNS port %d", dns.Port)
+	}
+
+	if config.Spec.NodeClientCertificate || (config.Spec.JoinConfiguration != nil && config.Spec.JoinConfiguration.Discovery.File != nil) {
+		return errors.New("apiServerEndpointDNS requires bootstrap token discovery")
+	}
+	if config.Spec.JoinConfiguration != nil && config.Spec.JoinConfiguration.Discovery.BootstrapToken != nil {
+		if endpoint := config.Spec.JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint; endpoint != "" && endpoint != dnsEndpoint(dns) {
+			return errors.New("apiServerEndpointDNS cannot be used when JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint is set")
+		}
+	}
+	if dns.SRVRecord != "" {
+		// the endpoint is only known on the machine, so it cannot be checked by the controller
+		if config.Spec.APIServerCheck != "" {
+			return errors.New("apiServerCheck is not supported with an apiServerEndpointDNS SRV record")
+		}
+		if config.Spec.ClusterInfoCheck != "" {
+			return errors.New("clusterInfoCheck is not supported with an apiServerEndpointDNS SRV record")
+		}
+	}
+	return nil
+}
+
+// srvEndpointFiles returns the script resolving the SRV record of the config, along with the command to be run before
+// kubeadm to write the resolved endpoint to the join configuration at the given path.
+func srvEndpointFiles(config *bootstrapv1.KubeadmConfig, joinConfigurationPath string) ([]bootstrapv1.File, []string, error) {
+	dns := config.Spec.APIServerEndpointDNS
+	if dns == nil || dns.SRVRecord == "" {
+		return nil, nil, nil
+	}
+
+	var script bytes.Buffer
+	if err := srvEndpointScriptTemplate.Execute(&script, dns); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to render SRV record resolution script")
+	}
+
+	path := scriptPath(config, srvEndpointScriptName)
+	files := []bootstrapv1.File{
+		{
+			Path:        path,
+			Owner:       "root:root",
+			Permissions: "0755",
+			Content:     script.String(),
+		},
+	}
+	return files, []string{path + " " + joinConfigurationPath}, nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestValidateAPIServerEndpointDNS(t *testing.T) {
+	newConfig := func(dns *bootstrapv1.APIServerEndpointDNS, endpoint string) *bootstrapv1.KubeadmConfig {
+		config := newKubeadmConfig(nil, "cfg")
+		config.Spec.APIServerEndpointDNS = dns
+		config.Spec.JoinConfiguration = &kubeadmv1beta1.JoinConfiguration{
+			Discovery: kubeadmv1beta1.Discovery{
+				BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{APIServerEndpoint: endpoint},
+			},
+		}
+		return config
+	}
+	srv := &bootstrapv1.APIServerEndpointDNS{SRVRecord: "_kubernetes._tcp.cluster.example.com"}
+
+	withCheck := newConfig(srv, "")
+	withCheck.Spec.APIServerCheck = bootstrapv1.APIServerCheckTCP
+	withClientCertificate := newConfig(&bootstrapv1.APIServerEndpointDNS{Name: "api.example.com"}, "")
+	withClientCertificate.Spec.NodeClientCertificate = true
+
+	tests := []struct {
+		name      string
+		config    *bootstrapv1.KubeadmConfig
+		expectErr bool
+	}{
+		{
+			name:   "unset",
+			config: newConfig(nil, "10.0.0.1:6443"),
+		},
+		{
+			name:   "name",
+			config: newConfig(&bootstrapv1.APIServerEndpointDNS{Name: "api.example.com", Port: 443}, ""),
+		},
+		{
+			name:   "srv record",
+			config: newConfig(srv, ""),
+		},
+		{
+			name:   "srv record already reconciled",
+			config: newConfig(srv, SRVEndpointPlaceholder),
+		},
+		{
+			name:      "neither name nor srv record",
+			config:    newConfig(&bootstrapv1.APIServerEndpointDNS{}, ""),
+			expectErr: true,
+		},
+		{
+			name:      "both name and srv record",
+			config:    newConfig(&bootstrapv1.APIServerEndpointDNS{Name: "api.example.com", SRVRecord: srv.SRVRecord}, ""),
+			expectErr: true,
+		},
+		{
+			name:      "invalid name",
+			config:    newConfig(&bootstrapv1.APIServerEndpointDNS{Name: "api.example.com'; reboot"}, ""),
+			expectErr: true,
+		},
+		{
+			name:      "endpoint set by the user",
+			config:    newConfig(srv, "10.0.0.1:6443"),
+			expectErr: true,
+		},
+		{
+			name:      "api server check with srv record",
+			config:    withCheck,
+			expectErr: true,
+		},
+		{
+			name:      "node client certificate",
+			config:    withClientCertificate,
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAPIServerEndpointDNS(tt.config)
+			if tt.expectErr && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+		})
+	}
+}
+
+func TestSRVEndpointFiles(t *testing.T) {
+	config := newKubeadmConfig(nil, "cfg")
+	config.Spec.APIServerEndpointDNS = &bootstrapv1.APIServerEndpointDNS{SRVRecord: "_kubernetes._tcp.cluster.example.com"}
+
+	files, commands, err := srvEndpointFiles(config, cloudinit.NodeJoinConfigurationPath)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if len(files) != 1 || !strings.Contains(files[0].Content, "record='_kubernetes._tcp.cluster.example.com'") {
+		t.Errorf("expected the script to resolve the SRV record, got %+v", files)
+	}
+	expected := []string{"/usr/local/bin/cabpk-resolve-api-server-endpoint /tmp/kubeadm-node.yaml"}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected %q, got %q", expected, commands)
+	}
+
+	config.Spec.APIServerEndpointDNS = &bootstrapv1.APIServerEndpointDNS{Name: "api.example.com"}
+	if files, commands, _ := srvEndpointFiles(config, cloudinit.NodeJoinConfigurationPath); files != nil || commands != nil {
+		t.Errorf("expected no script for DNS names, got %+v and %q", files, commands)
+	}
+}
+
+func TestReconcileDiscoveryWithAPIServerEndpointDNS(t *testing.T) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+		Status: clusterv1.ClusterStatus{
+			APIEndpoints: []clusterv1.APIEndpoint{{Host: "10.0.0.1", Port: 6443}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		dns      *bootstrapv1.APIServerEndpointDNS
+		expected string
+	}{
+		{
+			name:     "name with the default port",
+			dns:      &bootstrapv1.APIServerEndpointDNS{Name: "api.example.com"},
+			expected: "api.example.com:6443",
+		},
+		{
+			name:     "srv record",
+			dns:      &bootstrapv1.APIServerEndpointDNS{SRVRecord: "_kubernetes._tcp.cluster.example.com"},
+			expected: SRVEndpointPlaceholder,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &bootstrapv1.KubeadmConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"},
+				Spec: bootstrapv1.KubeadmConfigSpec{
+					APIServerEndpointDNS: tt.dns,
+					JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+						Discovery: kubeadmv1beta1.Discovery{
+							BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{CACertHashes: []string{"sha256:abc"}},
+						},
+					},
+				},
+			}
+
+			k := &KubeadmConfigReconciler{
+				Log:                  log.Log,
+				Client:               newFakeClientWithScheme(setupScheme()),
+				SecretsClientFactory: newFakeSecretFactory(),
+			}
+			if err := k.reconcileDiscovery(context.Background(), cluster, config, internalcluster.Certificates{}, nil); err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if endpoint := config.Spec.JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint; endpoint != tt.expected {
+				t.Errorf("expected endpoint %q, got %q", tt.expected, endpoint)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+// etcdCertificateFiles generates the etcd certificates to be pre-placed on a control plane machine joining
+// a cluster with stacked etcd. Server and peer certificates are issued for the node name and the addresses
+// known for the machine, which must therefore be available before the bootstrap data is generated.
+// The certificates are valid for the given duration, or the cluster-api default if zero.
+func etcdCertificateFiles(machine *clusterv1.Machine, config *bootstrapv1.KubeadmConfig, certificates internalcluster.Certificates, validity time.Duration) ([]bootstrapv1.File, error) {
+	if len(config.Spec.PrePlacedEtcdCertificates) == 0 {
+		return nil, nil
+	}
+
+	etcdCA := certificates.GetByPurpose(internalcluster.EtcdCA)
+	if etcdCA == nil || etcdCA.KeyPair == nil || len(etcdCA.KeyPair.Key) == 0 {
+		return nil, errors.New("the etcd CA key is required to pre-place etcd certificates; is the cluster using external etcd?")
+	}
+
+	// The node name is only known in advance if it does not depend on cloud-init datasource metadata.
+	nodeName := config.Spec.JoinConfiguration.NodeRegistration.Name
+	if strings.Contains(nodeName, "{{") {
+		nodeName = ""
+	}
+	var addresses []net.IP
+	if cp := config.Spec.JoinConfiguration.ControlPlane; cp != nil {
+		if ip := net.ParseIP(cp.LocalAPIEndpoint.AdvertiseAddress); ip != nil {
+			addresses = append(addresses, ip)
+		}
+	}
+	for _, address := range machine.Status.Addresses {
+		switch address.Type {
+		case clusterv1.MachineHostName:
+			if nodeName == "" {
+				nodeName = address.Address
+			}
+		case clusterv1.MachineInternalIP, clusterv1.MachineExternalIP:
+			if ip := net.ParseIP(address.Address); ip != nil {
+				addresses = append(addresses, ip)
+			}
+		}
+	}
+
+	for _, name := range config.Spec.PrePlacedEtcdCertificates {
+		if (name == bootstrapv1.EtcdServerCertificate || name == bootstrapv1.EtcdPeerCertificate) && len(addresses) == 0 {
+			return nil, errors.Errorf("the etcd %s certificate requires the machine address; set JoinConfiguration.ControlPlane.LocalAPIEndpoint.AdvertiseAddress", name)
+		}
+	}
+
+	return internalcluster.NewEtcdCertificateFiles(etcdCA, config.Spec.PrePlacedEtcdCertificates, nodeName, addresses, validity)
+}
+
+// reconcileExternalEtcdCertificates checks that the user supplied certificates of the external etcd of the cluster
+// can be used by the API server, and records the result on the config. The bootstrap data of the first control plane
+// is not generated while they are invalid, as the API server would fail to reach etcd.
+func (r *KubeadmConfigReconciler) reconcileExternalEtcdCertificates(cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, external *kubeadmv1beta1.ExternalEtcd, certificates internalcluster.Certificates) error {
+	now := metav1.Now()
+	err := internalcluster.ValidateExternalEtcdCertificates(
+		certificates.GetByPurpose(internalcluster.EtcdCA),
+		certificates.GetByPurpose(internalcluster.APIServerEtcdClient),
+		external.Endpoints,
+	)
+	if err == nil {
+		if condition := getCondition(config, bootstrapv1.ExternalEtcdInvalidCondition); condition != nil {
+			setCondition(config, bootstrapv1.ExternalEtcdInvalidCondition, corev1.ConditionFalse, ExternalEtcdValidReason, "", now)
+		}
+		return nil
+	}
+
+	message := fmt.Sprintf("The external etcd certificates of Cluster %s are invalid: %v", cluster.Name, err)
+	condition := getCondition(config, bootstrapv1.ExternalEtcdInvalidCondition)
+	if (condition == nil || condition.Status != corev1.ConditionTrue) && r.Recorder != nil {
+		r.Recorder.Event(config, corev1.EventTypeWarning, ExternalEtcdInvalidReason, message)
+	}
+	setCondition(config, bootstrapv1.ExternalEtcdInvalidCondition, corev1.ConditionTrue, ExternalEtcdInvalidReason, message, now)
+	return errors.New(message)
+}
+
+// reconcileClusterCertificatesError records on the config whether the certificates of the cluster could be looked up,
+// given the error of their lookup. Missing certificates are generated or waited for, but a certificate authority whose
+// key is missing or does not match cannot be repaired by CABPK, so the error is surfaced with a condition and an event.
+func (r *KubeadmConfigReconciler) reconcileClusterCertificatesError(cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, err error) error {
+	now := metav1.Now()
+	if errors.Cause(err) != internalcluster.ErrInvalidKeyPair {
+		if condition := getCondition(config, bootstrapv1.ClusterCertificatesInvalidCondition); condition != nil && err == nil {
+			setCondition(config, bootstrapv1.ClusterCertificatesInvalidCondition, corev1.ConditionFalse, ClusterCertificatesValidReason, "", now)
+		}
+		return err
+	}
+
+	message := fmt.Sprintf("The certificates of Cluster %s are invalid and must be fixed or deleted: %v", cluster.Name, err)
+	condition := getCondition(config, bootstrapv1.ClusterCertificatesInvalidCondition)
+	if (condition == nil || condition.Status != corev1.ConditionTrue) && r.Recorder != nil {
+		r.Recorder.Event(config, corev1.EventTypeWarning, ClusterCertificatesInvalidReason, message)
+	}
+	setCondition(config, bootstrapv1.ClusterCertificatesInvalidCondition, corev1.ConditionTrue, ClusterCertificatesInvalidReason, message, now)
+	return errors.New(message)
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestEtcdCertificateFiles(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newControlPlaneMachine(cluster, "control-plane-1")
+	machine.Status.Addresses = clusterv1.MachineAddresses{
+		{Type: clusterv1.MachineHostName, Address: "cp-1"},
+		{Type: clusterv1.MachineInternalIP, Address: "10.0.0.11"},
+	}
+
+	certificates := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	etcdCA, err := certs.DecodeCertPEM(certificates.GetByPurpose(internalcluster.EtcdCA).KeyPair.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := newControlPlaneJoinKubeadmConfig(machine, "control-plane-1-cfg")
+	files, err := etcdCertificateFiles(machine, config, certificates, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected no files without pre-placed etcd certificates, got %d", len(files))
+	}
+
+	config.Spec.PrePlacedEtcdCertificates = []bootstrapv1.EtcdCertificateName{
+		bootstrapv1.EtcdPeerCertificate,
+		bootstrapv1.EtcdHealthcheckClientCertificate,
+	}
+	files, err = etcdCertificateFiles(machine, config, certificates, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{}
+	for _, f := range files {
+		contents[f.Path] = f.Content
+	}
+	for _, path := range []string{
+		"/etc/kubernetes/pki/etcd/peer.crt",
+		"/etc/kubernetes/pki/etcd/peer.key",
+		"/etc/kubernetes/pki/etcd/healthcheck-client.crt",
+		"/etc/kubernetes/pki/etcd/healthcheck-client.key",
+	} {
+		if contents[path] == "" {
+			t.Errorf("expected %s to be written", path)
+		}
+	}
+
+	peer, err := certs.DecodeCertPEM([]byte(contents["/etc/kubernetes/pki/etcd/peer.crt"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.CheckSignatureFrom(etcdCA); err != nil {
+		t.Errorf("peer certificate is not signed by the etcd CA: %v", err)
+	}
+	if peer.Subject.CommonName != "cp-1" {
+		t.Errorf("expected the peer certificate to be issued for the node name, got %q", peer.Subject.CommonName)
+	}
+	if err := peer.VerifyHostname("10.0.0.11"); err != nil {
+		t.Errorf("expected the peer certificate to be valid for the machine address: %v", err)
+	}
+
+	healthcheck, err := certs.DecodeCertPEM([]byte(contents["/etc/kubernetes/pki/etcd/healthcheck-client.crt"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if healthcheck.Subject.CommonName != "kube-etcd-healthcheck-client" || len(healthcheck.ExtKeyUsage) != 1 || healthcheck.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("unexpected healthcheck client certificate %v %v", healthcheck.Subject, healthcheck.ExtKeyUsage)
+	}
+
+	// Server and peer certificates cannot be generated without knowing the machine address.
+	machine.Status.Addresses = nil
+	if _, err := etcdCertificateFiles(machine, config, certificates, 0); err == nil {
+		t.Error("expected an error without machine addresses")
+	}
+	config.Spec.JoinConfiguration.NodeRegistration.Name = "cp-1"
+	config.Spec.JoinConfiguration.ControlPlane.LocalAPIEndpoint.AdvertiseAddress = "10.0.0.11"
+	if _, err := etcdCertificateFiles(machine, config, certificates, 0); err != nil {
+		t.Errorf("expected the advertise address to be used, got: %v", err)
+	}
+}
+
+func TestReconcileExternalEtcdCertificates(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newKubeadmConfig(nil, "cfg")
+	external := &kubeadmv1beta1.ExternalEtcd{
+		Endpoints: []string{"https://10.0.0.1:2379"},
+		CAFile:    "/etc/etcd/ca.crt",
+		CertFile:  "/etc/etcd/client.crt",
+		KeyFile:   "/etc/etcd/client.key",
+	}
+	certificates := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{
+		Etcd: kubeadmv1beta1.Etcd{External: external},
+	})
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &KubeadmConfigReconciler{Log: log.Log}
+	if err := r.reconcileExternalEtcdCertificates(cluster, config, external, certificates); err == nil {
+		t.Fatal("expected missing external etcd certificates to be rejected")
+	}
+	if condition := getCondition(config, bootstrapv1.ExternalEtcdInvalidCondition); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Errorf("expected the %s condition to be true, got %+v", bootstrapv1.ExternalEtcdInvalidCondition, condition)
+	}
+
+	// use the generated cluster CA as the etcd CA
+	etcdCA := certificates.GetByPurpose(internalcluster.EtcdCA)
+	etcdCA.KeyPair = certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair
+	files, err := internalcluster.NewEtcdCertificateFiles(etcdCA, []bootstrapv1.EtcdCertificateName{bootstrapv1.APIServerEtcdClientCertificate}, "", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificates.GetByPurpose(internalcluster.APIServerEtcdClient).KeyPair = &certs.KeyPair{Cert: []byte(files[0].Content), Key: []byte(files[1].Content)}
+	if err := r.reconcileExternalEtcdCertificates(cluster, config, external, certificates); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if condition := getCondition(config, bootstrapv1.ExternalEtcdInvalidCondition); condition.Status != corev1.ConditionFalse || condition.Reason != ExternalEtcdValidReason {
+		t.Errorf("expected the %s condition to be false once the certificates are valid, got %+v", bootstrapv1.ExternalEtcdInvalidCondition, condition)
+	}
+}
+
+func TestReconcileClusterCertificatesError(t *testing.T) {
+	ctx := context.Background()
+	cluster := newCluster("cluster")
+	config := newKubeadmConfig(nil, "cfg")
+	existing := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := existing.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	myclient := newFakeClientWithScheme(setupScheme(), cluster, certsecret.New(cluster, nil, existing.GetByPurpose(internalcluster.ClusterCA)))
+	r := &KubeadmConfigReconciler{Client: myclient, Log: log.Log}
+
+	// a partial set of certificates is completed
+	certificates := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := r.reconcileClusterCertificatesError(cluster, config, certsecret.LookupOrGenerate(ctx, myclient, cluster, config, certificates)); err != nil {
+		t.Fatalf("expected the missing certificates to be generated, got %v", err)
+	}
+	if ca := certificates.GetByPurpose(internalcluster.ClusterCA); ca.Generated || !bytes.Equal(ca.KeyPair.Cert, existing.GetByPurpose(internalcluster.ClusterCA).KeyPair.Cert) {
+		t.Error("expected the existing cluster CA to be used")
+	}
+	if getCondition(config, bootstrapv1.ClusterCertificatesInvalidCondition) != nil {
+		t.Error("expected no condition for valid certificates")
+	}
+
+	// certificates generated concurrently are used instead of the ones just generated
+	concurrent := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := concurrent.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := certsecret.SaveGenerated(ctx, myclient, cluster, config, concurrent); err != nil {
+		t.Fatalf("expected the existing certificates to be used, got %v", err)
+	}
+	for _, certificate := range concurrent {
+		if certificate.Generated || !bytes.Equal(certificate.KeyPair.Key, certificates.GetByPurpose(certificate.Purpose).KeyPair.Key) {
+			t.Errorf("expected the existing %s certificate to be used", certificate.Purpose)
+		}
+	}
+
+	// a certificate whose key does not match cannot be repaired
+	s, err := certsecret.Get(ctx, myclient, cluster, internalcluster.FrontProxyCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Data[secret.TLSKeyDataName] = existing.GetByPurpose(internalcluster.FrontProxyCA).KeyPair.Key
+	if err := myclient.Update(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	mixed := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := r.reconcileClusterCertificatesError(cluster, config, certsecret.LookupOrGenerate(ctx, myclient, cluster, config, mixed)); err == nil {
+		t.Fatal("expected mixed certificates to be rejected")
+	}
+	if condition := getCondition(config, bootstrapv1.ClusterCertificatesInvalidCondition); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Errorf("expected the %s condition to be true, got %+v", bootstrapv1.ClusterCertificatesInvalidCondition, condition)
+	}
+
+	if err := r.reconcileClusterCertificatesError(cluster, config, nil); err != nil {
+		t.Fatal(err)
+	}
+	if condition := getCondition(config, bootstrapv1.ClusterCertificatesInvalidCondition); condition.Status != corev1.ConditionFalse || condition.Reason != ClusterCertificatesValidReason {
+		t.Errorf("expected the %s condition to be false once the certificates are valid, got %+v", bootstrapv1.ClusterCertificatesInvalidCondition, condition)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/secret"
+)
+
+const (
+	// ExternalControlPlaneAnnotation is set to "true" on a Cluster whose control plane is managed outside of
+	// Cluster API, e.g. by a cloud provider. No machine initializes the control plane: every machine joins the
+	// cluster as a worker, using the discovery information of the external discovery secret.
+	ExternalControlPlaneAnnotation = "bootstrap.cluster.x-k8s.io/external-control-plane"
+
+	// ExternalDiscoverySecretPurpose is the purpose of the secret, named <cluster>-discovery, holding the discovery
+	// information of a cluster with an external control plane.
+	ExternalDiscoverySecretPurpose secret.Purpose = "discovery"
+	// ExternalDiscoveryEndpointKey is the key of the host:port of the API server in the external discovery secret.
+	ExternalDiscoveryEndpointKey = "endpoint"
+	// ExternalDiscoveryCACertKey is the key of the PEM encoded cluster CA certificate in the external discovery secret.
+	ExternalDiscoveryCACertKey = "ca.crt"
+)
+
+// externalControlPlane returns whether the control plane of the cluster is managed outside of Cluster API.
+func externalControlPlane(cluster *clusterv1.Cluster) bool {
+	return cluster.Annotations[ExternalControlPlaneAnnotation] == "true"
+}
+
+// reconcileExternalControlPlaneDiscovery returns the cluster CA read from the external discovery secret of a cluster
+// with an external control plane, and injects its API server endpoint in the bootstrap token discovery of the config
+// unless the endpoint is set or resolved otherwise. The CA key is not known, so CABPK cannot sign certificates.
+func (r *KubeadmConfigReconciler) reconcileExternalControlPlaneDiscovery(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) (internalcluster.Certificates, error) {
+	if config.Spec.NodeClientCertificate {
+		return nil, errors.New("nodeClientCertificate is not supported with an external control plane, as the cluster CA key is not known")
+	}
+
+	s, err := secret.Get(r.Client, cluster, ExternalDiscoverySecretPurpose)
+	if apierrors.IsNotFound(err) {
+		return nil, errors.Wrapf(&capierrors.RequeueAfterError{RequeueAfter: currentTunables().RequeueInterval},
+			"Waiting for the discovery secret %s of the external control plane", secret.Name(cluster.Name, ExternalDiscoverySecretPurpose))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the discovery secret of cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+
+	endpoint := strings.TrimSpace(string(s.Data[ExternalDiscoveryEndpointKey]))
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s of discovery secret %s", ExternalDiscoveryEndpointKey, s.Name)
+	}
+	caCert := s.Data[ExternalDiscoveryCACertKey]
+	if cert, err := certs.DecodeCertPEM(caCert); err != nil || cert == nil {
+		return nil, errors.Errorf("invalid %s of discovery secret %s", ExternalDiscoveryCACertKey, s.Name)
+	}
+
+	certificates := internalcluster.NewCertificatesForWorker(config.Spec.JoinConfiguration.CACertPath)
+	certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair = &certs.KeyPair{Cert: caCert}
+
+	// the endpoint is only injected in the bootstrap token discovery managed by CABPK
+	discovery := &config.Spec.JoinConfiguration.Discovery
+	if manualDiscovery(config) || config.Spec.TokenBackend != "" || discovery.File != nil ||
+		config.Spec.APIServerEndpointDNS != nil || config.Spec.ControlPlaneVIP != nil {
+		return certificates, nil
+	}
+	if discovery.BootstrapToken == nil {
+		discovery.BootstrapToken = &kubeadmv1beta1.BootstrapTokenDiscovery{}
+	}
+	if discovery.BootstrapToken.APIServerEndpoint == "" {
+		discovery.BootstrapToken.APIServerEndpoint = endpoint
+		r.Log.Info("Altering JoinConfiguration.Discovery.BootstrapToken", "APIServerEndpoint", endpoint)
+	}
+	return certificates, nil
+}
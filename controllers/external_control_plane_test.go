@@ -0,0 +1,155 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/secret"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func newExternalDiscoverySecret(t *testing.T, cluster *clusterv1.Cluster, endpoint string) *corev1.Secret {
+	certificates := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      secret.Name(cluster.Name, ExternalDiscoverySecretPurpose),
+		},
+		Data: map[string][]byte{
+			ExternalDiscoveryEndpointKey: []byte(endpoint),
+			ExternalDiscoveryCACertKey:   certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair.Cert,
+		},
+	}
+}
+
+func TestKubeadmConfigReconciler_Reconcile_ExternalControlPlane(t *testing.T) {
+	ctx := context.Background()
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Annotations = map[string]string{ExternalControlPlaneAnnotation: "true"}
+
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+	controlPlaneMachine := newControlPlaneMachine(cluster, "control-plane-machine")
+	controlPlaneConfig := newKubeadmConfig(controlPlaneMachine, "control-plane-cfg")
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+		controlPlaneMachine,
+		controlPlaneConfig,
+	}
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+	}
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	result, err := k.Reconcile(request)
+	if err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Fatal("expected a requeue while the discovery secret is missing")
+	}
+	cfg, err := getKubeadmConfig(myclient, "worker-join-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Status.LastRequeueReason != WaitingForDiscoverySecretReason {
+		t.Errorf("expected requeue reason %q, got %q", WaitingForDiscoverySecretReason, cfg.Status.LastRequeueReason)
+	}
+
+	if err := myclient.Create(ctx, newExternalDiscoverySecret(t, cluster, "external.example.com:443")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"worker-join-cfg", "control-plane-cfg"} {
+		request.Name = name
+		if _, err := k.Reconcile(request); err != nil {
+			t.Fatalf("Failed to reconcile %s:\n %+v", name, err)
+		}
+
+		cfg, err := getKubeadmConfig(myclient, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cfg.Status.Ready {
+			t.Fatalf("Expected status ready for %s", name)
+		}
+		if cfg.Spec.JoinConfiguration == nil || cfg.Spec.JoinConfiguration.ControlPlane != nil {
+			t.Errorf("expected %s to join as a worker, got %+v", name, cfg.Spec.JoinConfiguration)
+			continue
+		}
+		bootstrapToken := cfg.Spec.JoinConfiguration.Discovery.BootstrapToken
+		if bootstrapToken == nil || bootstrapToken.APIServerEndpoint != "external.example.com:443" || bootstrapToken.Token == "" || len(bootstrapToken.CACertHashes) != 1 {
+			t.Errorf("expected the bootstrap token discovery of %s to use the discovery secret, got %+v", name, bootstrapToken)
+		}
+	}
+}
+
+func TestReconcileExternalControlPlaneDiscovery(t *testing.T) {
+	ctx := context.Background()
+	cluster := newCluster("cluster")
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+
+	invalid := newExternalDiscoverySecret(t, cluster, "external.example.com")
+	k := &KubeadmConfigReconciler{Log: log.Log, Client: newFakeClientWithScheme(setupScheme(), invalid)}
+	if _, err := k.reconcileExternalControlPlaneDiscovery(ctx, cluster, config); err == nil {
+		t.Error("expected an error for an endpoint without port")
+	}
+
+	k.Client = newFakeClientWithScheme(setupScheme(), newExternalDiscoverySecret(t, cluster, "external.example.com:443"))
+	config.Spec.NodeClientCertificate = true
+	if _, err := k.reconcileExternalControlPlaneDiscovery(ctx, cluster, config); err == nil {
+		t.Error("expected an error with nodeClientCertificate")
+	}
+
+	config.Spec.NodeClientCertificate = false
+	config.Spec.JoinConfiguration.Discovery.BootstrapToken = &kubeadmv1beta1.BootstrapTokenDiscovery{APIServerEndpoint: "override.example.com:6443"}
+	certificates, err := k.reconcileExternalControlPlaneDiscovery(ctx, cluster, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca := certificates.GetByPurpose(internalcluster.ClusterCA); ca == nil || ca.KeyPair == nil || len(ca.KeyPair.Cert) == 0 || len(ca.KeyPair.Key) != 0 {
+		t.Errorf("expected the cluster CA certificate without key, got %+v", ca)
+	}
+	if endpoint := config.Spec.JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint; endpoint != "override.example.com:6443" {
+		t.Errorf("expected the API server endpoint set by the user to be kept, got %q", endpoint)
+	}
+}
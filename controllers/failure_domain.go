@@ -0,0 +1,159 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/version"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+const (
+	// FailureDomainAnnotation is the Machine annotation holding the failure domain the machine is placed in, e.g.
+	// its availability zone, as v1alpha2 Machines have no failure domain field.
+	FailureDomainAnnotation = "bootstrap.cluster.x-k8s.io/failure-domain"
+
+	// FailureDomainPlaceholder is replaced with the failure domain of the Machine in extra args if
+	// FailureDomain.ExtraArgs is set.
+	FailureDomainPlaceholder = "$(FAILURE_DOMAIN)"
+
+	zoneLabel     = "topology.kubernetes.io/zone"
+	betaZoneLabel = "failure-domain.beta.kubernetes.io/zone"
+)
+
+var (
+	// minVersionForZoneLabel is the first Kubernetes version whose kubelet is allowed to set the zone label.
+	minVersionForZoneLabel = version.MustParseSemantic("v1.17.0")
+)
+
+// machineFailureDomain returns the failure domain of the Machine, or an empty string if it has none or if the config
+// does not propagate it.
+func machineFailureDomain(machine *clusterv1.Machine, config *bootstrapv1.KubeadmConfig) (string, error) {
+	if config.Spec.FailureDomain == nil {
+		return "", nil
+	}
+	failureDomain := machine.Annotations[FailureDomainAnnotation]
+	if errs := validation.IsValidLabelValue(failureDomain); len(errs) > 0 {
+		return "", errors.Errorf("invalid failure domain %q of Machine %s/%s: %s", failureDomain, machine.Namespace, machine.Name, strings.Join(errs, ", "))
+	}
+	return failureDomain, nil
+}
+
+// applyFailureDomainToNodeRegistration sets the zone labels of the failure domain on the node registration, without
+// overriding the labels defined by the user, and replaces the failure domain placeholder in the kubelet arguments.
+func applyFailureDomainToNodeRegistration(policy *bootstrapv1.FailureDomainPropagation, failureDomain string, kubernetesVersion *string, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.ExtraArgs {
+		if err := replaceFailureDomainPlaceholder(nodeRegistration.KubeletExtraArgs, failureDomain); err != nil {
+			return errors.Wrap(err, "invalid kubelet extra args")
+		}
+	}
+	if !policy.NodeLabels || failureDomain == "" {
+		return nil
+	}
+
+	labels := map[string]string{betaZoneLabel: failureDomain}
+	if kubeletSetsZoneLabel(kubernetesVersion) {
+		labels[zoneLabel] = failureDomain
+	}
+	addNodeLabels(nodeRegistration, labels)
+	return nil
+}
+
+// addNodeLabels adds the labels to the node-labels kubelet argument of the node registration, in key order, except
+// the labels already set by the user.
+func addNodeLabels(nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions, labels map[string]string) {
+	nodeLabels := nodeRegistration.KubeletExtraArgs["node-labels"]
+	for _, label := range strings.Split(nodeLabels, ",") {
+		delete(labels, strings.TrimSpace(strings.SplitN(label, "=", 2)[0]))
+	}
+	if len(labels) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if nodeLabels != "" {
+			nodeLabels += ","
+		}
+		nodeLabels += k + "=" + labels[k]
+	}
+	if nodeRegistration.KubeletExtraArgs == nil {
+		nodeRegistration.KubeletExtraArgs = map[string]string{}
+	}
+	nodeRegistration.KubeletExtraArgs["node-labels"] = nodeLabels
+}
+
+// applyFailureDomainToClusterConfiguration replaces the failure domain placeholder in the extra args of the control
+// plane components and of the local etcd.
+func applyFailureDomainToClusterConfiguration(policy *bootstrapv1.FailureDomainPropagation, failureDomain string, clusterConfiguration *kubeadmv1beta1.ClusterConfiguration) error {
+	if policy == nil || !policy.ExtraArgs {
+		return nil
+	}
+	components := map[string]map[string]string{
+		"apiServer":         clusterConfiguration.APIServer.ExtraArgs,
+		"controllerManager": clusterConfiguration.ControllerManager.ExtraArgs,
+		"scheduler":         clusterConfiguration.Scheduler.ExtraArgs,
+	}
+	if clusterConfiguration.Etcd.Local != nil {
+		components["etcd"] = clusterConfiguration.Etcd.Local.ExtraArgs
+	}
+	for name, args := range components {
+		if err := replaceFailureDomainPlaceholder(args, failureDomain); err != nil {
+			return errors.Wrapf(err, "invalid %s extra args", name)
+		}
+	}
+	return nil
+}
+
+// replaceFailureDomainPlaceholder replaces the failure domain placeholder in the values of the arguments, in place.
+func replaceFailureDomainPlaceholder(args map[string]string, failureDomain string) error {
+	for k, v := range args {
+		if !strings.Contains(v, FailureDomainPlaceholder) {
+			continue
+		}
+		if failureDomain == "" {
+			return errors.Errorf("argument %q uses %s, but the Machine has no %s annotation", k, FailureDomainPlaceholder, FailureDomainAnnotation)
+		}
+		args[k] = strings.Replace(v, FailureDomainPlaceholder, failureDomain, -1)
+	}
+	return nil
+}
+
+// kubeletSetsZoneLabel returns true if the kubelet of the given Kubernetes version is allowed to set the zone label.
+// The kubelet fails to start with labels of the kubernetes.io namespaces it does not know.
+func kubeletSetsZoneLabel(kubernetesVersion *string) bool {
+	if kubernetesVersion == nil || *kubernetesVersion == "" {
+		return false
+	}
+	v, err := version.ParseSemantic(*kubernetesVersion)
+	if err != nil {
+		return false
+	}
+	return v.AtLeast(minVersionForZoneLabel)
+}
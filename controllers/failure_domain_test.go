@@ -0,0 +1,164 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestMachineFailureDomain(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newWorkerMachine(cluster)
+	machine.Annotations = map[string]string{FailureDomainAnnotation: "us-east-1a"}
+	config := newWorkerJoinKubeadmConfig(machine)
+
+	if fd, err := machineFailureDomain(machine, config); err != nil || fd != "" {
+		t.Errorf("expected no failure domain without propagation, got %q, %v", fd, err)
+	}
+
+	config.Spec.FailureDomain = &bootstrapv1.FailureDomainPropagation{NodeLabels: true}
+	if fd, err := machineFailureDomain(machine, config); err != nil || fd != "us-east-1a" {
+		t.Errorf("expected the failure domain of the Machine, got %q, %v", fd, err)
+	}
+
+	machine.Annotations[FailureDomainAnnotation] = "zone a"
+	if _, err := machineFailureDomain(machine, config); err == nil {
+		t.Error("expected an invalid failure domain to be rejected")
+	}
+}
+
+func TestApplyFailureDomainToNodeRegistration(t *testing.T) {
+	v116, v117 := "v1.16.3", "v1.17.0"
+	testcases := []struct {
+		name              string
+		policy            *bootstrapv1.FailureDomainPropagation
+		failureDomain     string
+		kubernetesVersion *string
+		kubeletExtraArgs  map[string]string
+		expectedArgs      map[string]string
+		expectErr         bool
+	}{
+		{
+			name:          "nothing is propagated by default",
+			failureDomain: "zone-a",
+		},
+		{
+			name:              "only the beta label is set for kubelets not knowing the zone label",
+			policy:            &bootstrapv1.FailureDomainPropagation{NodeLabels: true},
+			failureDomain:     "zone-a",
+			kubernetesVersion: &v116,
+			expectedArgs:      map[string]string{"node-labels": "failure-domain.beta.kubernetes.io/zone=zone-a"},
+		},
+		{
+			name:              "both zone labels are appended to the labels of the user",
+			policy:            &bootstrapv1.FailureDomainPropagation{NodeLabels: true},
+			failureDomain:     "zone-a",
+			kubernetesVersion: &v117,
+			kubeletExtraArgs:  map[string]string{"node-labels": "role=worker"},
+			expectedArgs:      map[string]string{"node-labels": "role=worker,failure-domain.beta.kubernetes.io/zone=zone-a,topology.kubernetes.io/zone=zone-a"},
+		},
+		{
+			name:              "the labels of the user are not overridden",
+			policy:            &bootstrapv1.FailureDomainPropagation{NodeLabels: true},
+			failureDomain:     "zone-a",
+			kubernetesVersion: &v117,
+			kubeletExtraArgs:  map[string]string{"node-labels": "topology.kubernetes.io/zone=custom"},
+			expectedArgs:      map[string]string{"node-labels": "topology.kubernetes.io/zone=custom,failure-domain.beta.kubernetes.io/zone=zone-a"},
+		},
+		{
+			name:   "no labels are set without a failure domain",
+			policy: &bootstrapv1.FailureDomainPropagation{NodeLabels: true},
+		},
+		{
+			name:             "the placeholder is replaced in the kubelet args",
+			policy:           &bootstrapv1.FailureDomainPropagation{ExtraArgs: true},
+			failureDomain:    "zone-a",
+			kubeletExtraArgs: map[string]string{"provider-id": "cloud://$(FAILURE_DOMAIN)/node"},
+			expectedArgs:     map[string]string{"provider-id": "cloud://zone-a/node"},
+		},
+		{
+			name:             "the placeholder requires a failure domain",
+			policy:           &bootstrapv1.FailureDomainPropagation{ExtraArgs: true},
+			kubeletExtraArgs: map[string]string{"provider-id": "cloud://$(FAILURE_DOMAIN)/node"},
+			expectErr:        true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodeRegistration := &kubeadmv1beta1.NodeRegistrationOptions{KubeletExtraArgs: tc.kubeletExtraArgs}
+			err := applyFailureDomainToNodeRegistration(tc.policy, tc.failureDomain, tc.kubernetesVersion, nodeRegistration)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if len(nodeRegistration.KubeletExtraArgs) != len(tc.expectedArgs) {
+				t.Fatalf("expected kubelet args %v, got %v", tc.expectedArgs, nodeRegistration.KubeletExtraArgs)
+			}
+			for k, v := range tc.expectedArgs {
+				if nodeRegistration.KubeletExtraArgs[k] != v {
+					t.Errorf("expected kubelet arg %s=%q, got %q", k, v, nodeRegistration.KubeletExtraArgs[k])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyFailureDomainToClusterConfiguration(t *testing.T) {
+	newClusterConfiguration := func() *kubeadmv1beta1.ClusterConfiguration {
+		clusterConfiguration := &kubeadmv1beta1.ClusterConfiguration{
+			Etcd: kubeadmv1beta1.Etcd{
+				Local: &kubeadmv1beta1.LocalEtcd{
+					ExtraArgs: map[string]string{"log-outputs": "/var/log/etcd-$(FAILURE_DOMAIN).log"},
+				},
+			},
+		}
+		clusterConfiguration.APIServer.ExtraArgs = map[string]string{"audit-log-path": "/var/log/audit-$(FAILURE_DOMAIN).log"}
+		return clusterConfiguration
+	}
+
+	clusterConfiguration := newClusterConfiguration()
+	if err := applyFailureDomainToClusterConfiguration(&bootstrapv1.FailureDomainPropagation{NodeLabels: true}, "zone-a", clusterConfiguration); err != nil {
+		t.Fatal(err)
+	}
+	if clusterConfiguration.APIServer.ExtraArgs["audit-log-path"] != "/var/log/audit-$(FAILURE_DOMAIN).log" {
+		t.Errorf("expected the placeholder to be left as is, got %v", clusterConfiguration.APIServer.ExtraArgs)
+	}
+
+	policy := &bootstrapv1.FailureDomainPropagation{ExtraArgs: true}
+	if err := applyFailureDomainToClusterConfiguration(policy, "zone-a", clusterConfiguration); err != nil {
+		t.Fatal(err)
+	}
+	if clusterConfiguration.APIServer.ExtraArgs["audit-log-path"] != "/var/log/audit-zone-a.log" {
+		t.Errorf("expected the placeholder to be replaced in the API server args, got %v", clusterConfiguration.APIServer.ExtraArgs)
+	}
+	if clusterConfiguration.Etcd.Local.ExtraArgs["log-outputs"] != "/var/log/etcd-zone-a.log" {
+		t.Errorf("expected the placeholder to be replaced in the etcd args, got %v", clusterConfiguration.Etcd.Local.ExtraArgs)
+	}
+
+	if err := applyFailureDomainToClusterConfiguration(policy, "", newClusterConfiguration()); err == nil {
+		t.Error("expected the placeholder to require a failure domain")
+	}
+}
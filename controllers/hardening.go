@@ -0,0 +1,213 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+const (
+	auditPolicyPath = "/etc/kubernetes/audit-policy.yaml"
+	auditLogDir     = "/var/log/kubernetes/audit"
+
+	// kubeletSysctlPath holds the kernel settings the kubelet expects when protecting kernel defaults.
+	kubeletSysctlPath = "/etc/sysctl.d/90-kubelet.conf"
+
+	cisAuditPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+  - RequestReceived
+rules:
+  - level: None
+    resources:
+      - group: ""
+        resources: ["events"]
+  - level: Metadata
+    resources:
+      - group: ""
+        resources: ["secrets", "configmaps"]
+      - group: "authentication.k8s.io"
+        resources: ["tokenreviews"]
+  - level: Request
+    verbs: ["create", "update", "patch", "delete"]
+  - level: Metadata
+`
+
+	cisKubeletSysctl = `vm.overcommit_memory=1
+vm.panic_on_oom=0
+kernel.panic=10
+kernel.panic_on_oops=1
+`
+)
+
+var (
+	cisAPIServerArgs = map[string]string{
+		"anonymous-auth":           "false",
+		"profiling":                "false",
+		"enable-admission-plugins": "NodeRestriction,AlwaysPullImages",
+		"audit-policy-file":        auditPolicyPath,
+		"audit-log-path":           auditLogDir + "/audit.log",
+		"audit-log-maxage":         "30",
+		"audit-log-maxbackup":      "10",
+		"audit-log-maxsize":        "100",
+	}
+
+	cisControllerManagerArgs = map[string]string{
+		"profiling":                   "false",
+		"terminated-pod-gc-threshold": "10",
+	}
+
+	cisSchedulerArgs = map[string]string{
+		"profiling": "false",
+	}
+
+	cisKubeletArgs = map[string]string{
+		"anonymous-auth":                    "false",
+		"read-only-port":                    "0",
+		"protect-kernel-defaults":           "true",
+		"event-qps":                         "0",
+		"streaming-connection-idle-timeout": "5m",
+		"make-iptables-util-chains":         "true",
+	}
+
+	cisAPIServerVolumes = []kubeadmv1beta1.HostPathMount{
+		{
+			Name:      "audit-policy",
+			HostPath:  auditPolicyPath,
+			MountPath: auditPolicyPath,
+			ReadOnly:  true,
+			PathType:  corev1.HostPathFile,
+		},
+		{
+			Name:      "audit-log",
+			HostPath:  auditLogDir,
+			MountPath: auditLogDir,
+			PathType:  corev1.HostPathDirectoryOrCreate,
+		},
+	}
+
+	// cisControlPlanePermissions tighten the files kubeadm writes on control plane machines.
+	cisControlPlanePermissions = []string{
+		"chmod 600 /etc/kubernetes/manifests/*.yaml",
+		"chmod 600 /etc/kubernetes/admin.conf /etc/kubernetes/scheduler.conf /etc/kubernetes/controller-manager.conf",
+		"chmod 600 /etc/kubernetes/pki/*.key",
+		"test ! -d /var/lib/etcd || chmod 700 /var/lib/etcd",
+	}
+
+	// cisNodePermissions tighten the files kubeadm writes on every machine.
+	cisNodePermissions = []string{
+		"chmod 600 /etc/kubernetes/kubelet.conf /var/lib/kubelet/config.yaml",
+		"chmod 644 /etc/kubernetes/pki/ca.crt",
+	}
+)
+
+// applyHardeningToClusterConfiguration sets the control plane arguments and volumes of the hardening preset
+// on the cluster configuration, without overriding the arguments and volumes defined by the user.
+func applyHardeningToClusterConfiguration(preset bootstrapv1.HardeningPreset, clusterConfiguration *kubeadmv1beta1.ClusterConfiguration) error {
+	switch preset {
+	case "":
+		return nil
+	case bootstrapv1.CISHardening:
+	default:
+		return errors.Errorf("unsupported hardening preset %q", preset)
+	}
+
+	apiServer := &clusterConfiguration.APIServer.ControlPlaneComponent
+	apiServer.ExtraArgs = mergeArgs(apiServer.ExtraArgs, cisAPIServerArgs)
+	for _, volume := range cisAPIServerVolumes {
+		if !hasHostPathMount(apiServer.ExtraVolumes, volume.Name) {
+			apiServer.ExtraVolumes = append(apiServer.ExtraVolumes, volume)
+		}
+	}
+	clusterConfiguration.ControllerManager.ExtraArgs = mergeArgs(clusterConfiguration.ControllerManager.ExtraArgs, cisControllerManagerArgs)
+	clusterConfiguration.Scheduler.ExtraArgs = mergeArgs(clusterConfiguration.Scheduler.ExtraArgs, cisSchedulerArgs)
+	return nil
+}
+
+// applyHardeningToNodeRegistration sets the kubelet arguments of the hardening preset on the node registration,
+// without overriding the arguments defined by the user.
+func applyHardeningToNodeRegistration(preset bootstrapv1.HardeningPreset, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions) error {
+	switch preset {
+	case "":
+		return nil
+	case bootstrapv1.CISHardening:
+	default:
+		return errors.Errorf("unsupported hardening preset %q", preset)
+	}
+
+	nodeRegistration.KubeletExtraArgs = mergeArgs(nodeRegistration.KubeletExtraArgs, cisKubeletArgs)
+	return nil
+}
+
+// hardeningFiles returns the files required by the hardening preset, along with the commands to be run
+// before and after kubeadm to apply them.
+func hardeningFiles(preset bootstrapv1.HardeningPreset, isControlPlane bool) ([]bootstrapv1.File, []string, []string, error) {
+	switch preset {
+	case "":
+		return nil, nil, nil, nil
+	case bootstrapv1.CISHardening:
+	default:
+		return nil, nil, nil, errors.Errorf("unsupported hardening preset %q", preset)
+	}
+
+	files := []bootstrapv1.File{
+		{
+			Path:        kubeletSysctlPath,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     cisKubeletSysctl,
+		},
+	}
+	preCommands := []string{"sysctl --system"}
+	postCommands := append([]string{}, cisNodePermissions...)
+
+	if isControlPlane {
+		files = append(files, bootstrapv1.File{
+			Path:        auditPolicyPath,
+			Owner:       "root:root",
+			Permissions: "0600",
+			Content:     cisAuditPolicy,
+		})
+		postCommands = append(postCommands, cisControlPlanePermissions...)
+	}
+	return files, preCommands, postCommands, nil
+}
+
+// mergeArgs returns args with the defaults that are not already set.
+func mergeArgs(args, defaults map[string]string) map[string]string {
+	if args == nil {
+		args = map[string]string{}
+	}
+	for k, v := range defaults {
+		if _, ok := args[k]; !ok {
+			args[k] = v
+		}
+	}
+	return args
+}
+
+func hasHostPathMount(mounts []kubeadmv1beta1.HostPathMount, name string) bool {
+	for _, m := range mounts {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestApplyHardeningToClusterConfiguration(t *testing.T) {
+	clusterConfiguration := &kubeadmv1beta1.ClusterConfiguration{}
+	clusterConfiguration.APIServer.ExtraArgs = map[string]string{"enable-admission-plugins": "NodeRestriction,PodSecurityPolicy"}
+	clusterConfiguration.APIServer.ExtraVolumes = []kubeadmv1beta1.HostPathMount{{Name: "audit-log", HostPath: "/data/audit", MountPath: auditLogDir}}
+
+	if err := applyHardeningToClusterConfiguration(bootstrapv1.CISHardening, clusterConfiguration); err != nil {
+		t.Fatal(err)
+	}
+
+	args := clusterConfiguration.APIServer.ExtraArgs
+	if args["enable-admission-plugins"] != "NodeRestriction,PodSecurityPolicy" {
+		t.Errorf("expected user admission plugins to be preserved, got %q", args["enable-admission-plugins"])
+	}
+	if args["anonymous-auth"] != "false" || args["audit-policy-file"] != auditPolicyPath {
+		t.Errorf("expected hardened api server args, got %v", args)
+	}
+	if len(clusterConfiguration.APIServer.ExtraVolumes) != 2 || clusterConfiguration.APIServer.ExtraVolumes[0].HostPath != "/data/audit" {
+		t.Errorf("expected the audit policy volume to be added next to the user audit log volume, got %v", clusterConfiguration.APIServer.ExtraVolumes)
+	}
+	if clusterConfiguration.ControllerManager.ExtraArgs["profiling"] != "false" || clusterConfiguration.Scheduler.ExtraArgs["profiling"] != "false" {
+		t.Error("expected profiling to be disabled on the controller manager and the scheduler")
+	}
+
+	if err := applyHardeningToClusterConfiguration("unknown", clusterConfiguration); err == nil {
+		t.Error("expected an unsupported preset to fail")
+	}
+}
+
+func TestApplyHardeningToNodeRegistration(t *testing.T) {
+	nodeRegistration := &kubeadmv1beta1.NodeRegistrationOptions{KubeletExtraArgs: map[string]string{"read-only-port": "10255"}}
+	if err := applyHardeningToNodeRegistration("", nodeRegistration); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeRegistration.KubeletExtraArgs) != 1 {
+		t.Fatalf("expected no kubelet args to be added without a preset, got %v", nodeRegistration.KubeletExtraArgs)
+	}
+
+	if err := applyHardeningToNodeRegistration(bootstrapv1.CISHardening, nodeRegistration); err != nil {
+		t.Fatal(err)
+	}
+	if nodeRegistration.KubeletExtraArgs["read-only-port"] != "10255" {
+		t.Errorf("expected the user read-only-port to be preserved, got %q", nodeRegistration.KubeletExtraArgs["read-only-port"])
+	}
+	if nodeRegistration.KubeletExtraArgs["protect-kernel-defaults"] != "true" {
+		t.Errorf("expected kernel defaults to be protected, got %v", nodeRegistration.KubeletExtraArgs)
+	}
+}
+
+func TestHardeningFiles(t *testing.T) {
+	files, preCommands, postCommands, err := hardeningFiles(bootstrapv1.CISHardening, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != kubeletSysctlPath || len(preCommands) != 1 || len(postCommands) != len(cisNodePermissions) {
+		t.Errorf("unexpected worker hardening files %v, commands %v %v", files, preCommands, postCommands)
+	}
+
+	files, _, postCommands, err = hardeningFiles(bootstrapv1.CISHardening, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[1].Path != auditPolicyPath || len(postCommands) != len(cisNodePermissions)+len(cisControlPlanePermissions) {
+		t.Errorf("unexpected control plane hardening files %v, commands %v", files, postCommands)
+	}
+}
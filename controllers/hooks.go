@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+)
+
+// PreRenderHook is invoked before bootstrap data is rendered, allowing integrators to mutate the user data,
+// e.g. to inject additional files or commands.
+type PreRenderHook interface {
+	// PreRender mutates the user data that will be rendered for the given config.
+	PreRender(ctx context.Context, config *bootstrapv1.KubeadmConfig, userData *cloudinit.BaseUserData) error
+}
+
+// PostRenderHook is invoked after bootstrap data is rendered, allowing integrators to mutate the final payload.
+type PostRenderHook interface {
+	// PostRender returns the bootstrap data to be used for the given config.
+	PostRender(ctx context.Context, config *bootstrapv1.KubeadmConfig, bootstrapData []byte) ([]byte, error)
+}
+
+// PreRenderHookFunc is a function implementing PreRenderHook.
+type PreRenderHookFunc func(ctx context.Context, config *bootstrapv1.KubeadmConfig, userData *cloudinit.BaseUserData) error
+
+// PreRender implements PreRenderHook.
+func (f PreRenderHookFunc) PreRender(ctx context.Context, config *bootstrapv1.KubeadmConfig, userData *cloudinit.BaseUserData) error {
+	return f(ctx, config, userData)
+}
+
+// PostRenderHookFunc is a function implementing PostRenderHook.
+type PostRenderHookFunc func(ctx context.Context, config *bootstrapv1.KubeadmConfig, bootstrapData []byte) ([]byte, error)
+
+// PostRender implements PostRenderHook.
+func (f PostRenderHookFunc) PostRender(ctx context.Context, config *bootstrapv1.KubeadmConfig, bootstrapData []byte) ([]byte, error) {
+	return f(ctx, config, bootstrapData)
+}
+
+func (r *KubeadmConfigReconciler) runPreRenderHooks(ctx context.Context, config *bootstrapv1.KubeadmConfig, userData *cloudinit.BaseUserData) error {
+	for i, hook := range r.PreRenderHooks {
+		if err := hook.PreRender(ctx, config, userData); err != nil {
+			return errors.Wrapf(err, "pre render hook %d failed", i)
+		}
+	}
+	return nil
+}
+
+func (r *KubeadmConfigReconciler) runPostRenderHooks(ctx context.Context, config *bootstrapv1.KubeadmConfig, bootstrapData []byte) ([]byte, error) {
+	for i, hook := range r.PostRenderHooks {
+		out, err := hook.PostRender(ctx, config, bootstrapData)
+		if err != nil {
+			return nil, errors.Wrapf(err, "post render hook %d failed", i)
+		}
+		bootstrapData = out
+	}
+	return bootstrapData, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_RenderHooks(t *testing.T) {
+	config := newKubeadmConfig(nil, "cfg")
+	config.Spec.PreKubeadmCommands = []string{"echo hello"}
+
+	k := &KubeadmConfigReconciler{
+		Log: log.Log,
+		PreRenderHooks: []PreRenderHook{
+			PreRenderHookFunc(func(_ context.Context, _ *bootstrapv1.KubeadmConfig, userData *cloudinit.BaseUserData) error {
+				userData.PreKubeadmCommands = append(userData.PreKubeadmCommands, "install-agent.sh")
+				return nil
+			}),
+		},
+		PostRenderHooks: []PostRenderHook{
+			PostRenderHookFunc(func(_ context.Context, _ *bootstrapv1.KubeadmConfig, data []byte) ([]byte, error) {
+				return bytes.Replace(data, []byte("k8s.gcr.io"), []byte("mirror.example.com"), -1), nil
+			}),
+		},
+	}
+
+	userData, err := k.newBaseUserData(context.Background(), config, false, nil)
+	if err != nil {
+		t.Fatalf("Failed to generate user data:\n %+v", err)
+	}
+	if len(userData.PreKubeadmCommands) != 2 || userData.PreKubeadmCommands[1] != "install-agent.sh" {
+		t.Fatalf("expected the pre render hook to add a command, got %v", userData.PreKubeadmCommands)
+	}
+	if len(config.Spec.PreKubeadmCommands) != 1 {
+		t.Fatalf("did not expect the pre render hook to mutate the config spec, got %v", config.Spec.PreKubeadmCommands)
+	}
+
+	out, err := k.runPostRenderHooks(context.Background(), config, []byte("image: k8s.gcr.io/pause"))
+	if err != nil {
+		t.Fatalf("Failed to run post render hooks:\n %+v", err)
+	}
+	if string(out) != "image: mirror.example.com/pause" {
+		t.Fatalf("unexpected bootstrap data: %s", out)
+	}
+
+	k.PostRenderHooks = append(k.PostRenderHooks, PostRenderHookFunc(func(_ context.Context, _ *bootstrapv1.KubeadmConfig, _ []byte) ([]byte, error) {
+		return nil, errors.New("boom")
+	}))
+	if _, err := k.runPostRenderHooks(context.Background(), config, []byte("data")); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	initLockWaitSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "cabpk_init_lock_wait_seconds",
+			Help:    "Time a control plane config waited on the kubeadm init lock before acquiring it.",
+			Buckets: []float64{0, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+		},
+		[]string{"namespace", "cluster"},
+	)
+	initLockFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cabpk_init_lock_acquisition_failures_total",
+			Help: "Number of failed attempts to acquire the kubeadm init lock.",
+		},
+		[]string{"namespace", "cluster"},
+	)
+	initLockHolderGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cabpk_init_lock_holder",
+			Help: "Set to 1 for the machine holding the kubeadm init lock of a cluster.",
+		},
+		[]string{"namespace", "cluster", "machine"},
+	)
+
+	initLockHolders = &lockHolders{machines: map[types.NamespacedName]string{}}
+)
+
+func init() {
+	metrics.Registry.MustRegister(initLockWaitSeconds, initLockFailuresTotal, initLockHolderGauge)
+}
+
+// lockInspector reports which machine holds the init lock of a cluster. It is optionally implemented by InitLockers.
+type lockInspector interface {
+	Holder(ctx context.Context, cluster *clusterv1.Cluster) (string, error)
+}
+
+// lockHolders keeps track of the last known holder of the init lock of each cluster, so that the holder gauge
+// is reset when the lock changes hands or is released.
+type lockHolders struct {
+	sync.Mutex
+	machines map[types.NamespacedName]string
+}
+
+// set records the machine as the holder of the init lock of the cluster.
+func (h *lockHolders) set(cluster *clusterv1.Cluster, machine string) {
+	h.Lock()
+	defer h.Unlock()
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	if previous, ok := h.machines[key]; ok {
+		if previous == machine {
+			return
+		}
+		initLockHolderGauge.DeleteLabelValues(cluster.Namespace, cluster.Name, previous)
+	}
+	h.machines[key] = machine
+	initLockHolderGauge.WithLabelValues(cluster.Namespace, cluster.Name, machine).Set(1)
+}
+
+// clear records that the init lock of the cluster is not held.
+func (h *lockHolders) clear(cluster *clusterv1.Cluster) {
+	h.Lock()
+	defer h.Unlock()
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	if previous, ok := h.machines[key]; ok {
+		initLockHolderGauge.DeleteLabelValues(cluster.Namespace, cluster.Name, previous)
+		delete(h.machines, key)
+	}
+}
+
+// lockInit attempts to acquire the init lock for the machine, recording the wait on the config and in metrics.
+func (r *KubeadmConfigReconciler) lockInit(ctx context.Context, cluster *clusterv1.Cluster, machine *clusterv1.Machine, config *bootstrapv1.KubeadmConfig) bool {
+	now := v1.Now()
+	condition := getCondition(config, bootstrapv1.WaitingForInitLockCondition)
+
+	if !r.KubeadmInitLock.Lock(ctx, cluster, machine) {
+		initLockFailuresTotal.WithLabelValues(cluster.Namespace, cluster.Name).Inc()
+		message := fmt.Sprintf("Waiting for another machine to initialize Cluster %s", cluster.Name)
+		if holder := r.initLockHolder(ctx, cluster); holder != "" {
+			initLockHolders.set(cluster, holder)
+			message = fmt.Sprintf("Waiting for Machine %s to initialize Cluster %s", holder, cluster.Name)
+		}
+		setCondition(config, bootstrapv1.WaitingForInitLockCondition, corev1.ConditionTrue, InitLockHeldReason, message, now)
+		return false
+	}
+
+	initLockHolders.set(cluster, machine.Name)
+	// the lock is acquired again by its holder on each reconcile, the wait is only observed once
+	if condition != nil && condition.Status == corev1.ConditionFalse {
+		return true
+	}
+	var waited float64
+	if condition != nil {
+		waited = now.Sub(condition.LastTransitionTime.Time).Seconds()
+	}
+	initLockWaitSeconds.WithLabelValues(cluster.Namespace, cluster.Name).Observe(waited)
+	setCondition(config, bootstrapv1.WaitingForInitLockCondition, corev1.ConditionFalse, InitLockAcquiredReason, "", now)
+	return true
+}
+
+// unlockInit releases the init lock of the cluster.
+func (r *KubeadmConfigReconciler) unlockInit(ctx context.Context, cluster *clusterv1.Cluster) {
+	if r.KubeadmInitLock.Unlock(ctx, cluster) {
+		initLockHolders.clear(cluster)
+	}
+}
+
+// initLockHolder returns the machine holding the init lock of the cluster, or an empty string if unknown.
+func (r *KubeadmConfigReconciler) initLockHolder(ctx context.Context, cluster *clusterv1.Cluster) string {
+	inspector, ok := r.KubeadmInitLock.(lockInspector)
+	if !ok {
+		return ""
+	}
+	holder, err := inspector.Holder(ctx, cluster)
+	if err != nil {
+		r.Log.Error(err, "failed to get the holder of the init lock", "cluster", cluster.Name)
+		return ""
+	}
+	return holder
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/locking"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_Reconcile_InitLockContention(t *testing.T) {
+	cluster := newCluster("lock-cluster")
+	cluster.Status.InfrastructureReady = true
+
+	firstMachine := newControlPlaneMachine(cluster, "control-plane-first")
+	firstConfig := newControlPlaneInitKubeadmConfig(firstMachine, "control-plane-first-cfg")
+	secondMachine := newControlPlaneMachine(cluster, "control-plane-second")
+	secondConfig := newControlPlaneInitKubeadmConfig(secondMachine, "control-plane-second-cfg")
+
+	myclient := newFakeClientWithScheme(setupScheme(), []runtime.Object{
+		cluster,
+		firstMachine,
+		firstConfig,
+		secondMachine,
+		secondConfig,
+	}...)
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      locking.NewControlPlaneInitMutex(log.Log, myclient),
+	}
+
+	failures := testutil.ToFloat64(initLockFailuresTotal.WithLabelValues(cluster.Namespace, cluster.Name))
+	for _, name := range []string{firstConfig.Name, secondConfig.Name} {
+		if _, err := k.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}); err != nil {
+			t.Fatalf("Failed to reconcile %s: %v", name, err)
+		}
+	}
+
+	if got := testutil.ToFloat64(initLockFailuresTotal.WithLabelValues(cluster.Namespace, cluster.Name)) - failures; got != 1 {
+		t.Errorf("expected 1 lock acquisition failure, got %v", got)
+	}
+	if got := testutil.ToFloat64(initLockHolderGauge.WithLabelValues(cluster.Namespace, cluster.Name, firstMachine.Name)); got != 1 {
+		t.Errorf("expected %s to be reported as the lock holder, got %v", firstMachine.Name, got)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		status corev1.ConditionStatus
+		reason string
+	}{
+		{name: firstConfig.Name, status: corev1.ConditionFalse, reason: InitLockAcquiredReason},
+		{name: secondConfig.Name, status: corev1.ConditionTrue, reason: InitLockHeldReason},
+	} {
+		config := &bootstrapv1.KubeadmConfig{}
+		if err := myclient.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: tc.name}, config); err != nil {
+			t.Fatalf("failed to get config %s: %v", tc.name, err)
+		}
+		condition := getCondition(config, bootstrapv1.WaitingForInitLockCondition)
+		if condition == nil {
+			t.Fatalf("expected config %s to have the %s condition", tc.name, bootstrapv1.WaitingForInitLockCondition)
+		}
+		if condition.Status != tc.status || condition.Reason != tc.reason {
+			t.Errorf("expected config %s condition %s/%s, got %s/%s", tc.name, tc.status, tc.reason, condition.Status, condition.Reason)
+		}
+	}
+}
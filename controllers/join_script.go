@@ -0,0 +1,103 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+// newJoinScript generates the join script of a worker node from the join configuration, in which discovery has been reconciled.
+// Settings requiring files to be written or differing between instances are not supported by the join script format.
+func newJoinScript(config *bootstrapv1.KubeadmConfig, joinConfiguration *kubeadmv1beta1.JoinConfiguration) ([]byte, error) {
+	if err := validateJoinScriptConfig(config); err != nil {
+		return nil, err
+	}
+
+	bootstrapToken := joinConfiguration.Discovery.BootstrapToken
+	if bootstrapToken == nil {
+		return nil, errors.New("the join-script format requires bootstrap token discovery")
+	}
+	return cloudinit.NewJoinScript(&cloudinit.JoinScriptInput{
+		PreKubeadmCommands:       config.Spec.PreKubeadmCommands,
+		PostKubeadmCommands:      config.Spec.PostKubeadmCommands,
+		IdempotentCommands:       config.Spec.IdempotentCommands,
+		APIServerEndpoint:        bootstrapToken.APIServerEndpoint,
+		Token:                    bootstrapToken.Token,
+		CACertHashes:             bootstrapToken.CACertHashes,
+		UnsafeSkipCAVerification: bootstrapToken.UnsafeSkipCAVerification,
+		CRISocket:                joinConfiguration.NodeRegistration.CRISocket,
+	})
+}
+
+// validateJoinScriptConfig checks that the config only uses settings supported by the join script format.
+func validateJoinScriptConfig(config *bootstrapv1.KubeadmConfig) error {
+	if field := unsupportedScriptSetting(config); field != "" {
+		return errors.Errorf("%s is not supported by the %s format", field, bootstrapv1.JoinScript)
+	}
+	return nil
+}
+
+// unsupportedScriptSetting returns the first setting of the config which cannot be honored by the plain shell
+// scripts of the join script format and of node adoption, or an empty string.
+func unsupportedScriptSetting(config *bootstrapv1.KubeadmConfig) string {
+	spec := config.Spec
+	for _, setting := range []struct {
+		field string
+		set   bool
+	}{
+		{"files", len(spec.Files) > 0},
+		{"staticPodManifests", len(spec.StaticPodManifests) > 0},
+		{"users", len(spec.Users) > 0},
+		{"ntp", spec.NTP != nil},
+		{"registryMirrors", len(spec.RegistryMirrors) > 0},
+		{"resetBeforeJoin", spec.ResetBeforeJoin},
+		{"nodeName", spec.NodeName != nil},
+		{"hardening", spec.Hardening != ""},
+		{"additionalTrustBundles", len(spec.AdditionalTrustBundles) > 0},
+		{"additionalKubeadmConfigDocuments", len(spec.AdditionalKubeadmConfigDocuments) > 0},
+		{"nodeClientCertificate", spec.NodeClientCertificate},
+		{"tokenBackend", spec.TokenBackend != ""},
+		{"nodeIP", spec.NodeIP != nil},
+		{"formatOptions", spec.FormatOptions != nil},
+		{"selinux", spec.SELinux != nil},
+		{"disableSwap", spec.DisableSwap},
+		{"systemdUnits", len(spec.SystemdUnits) > 0},
+		{"apiServerEndpointDNS.srvRecord", spec.APIServerEndpointDNS != nil && spec.APIServerEndpointDNS.SRVRecord != ""},
+		{"diagnostics", spec.Diagnostics != nil},
+		{"singleNode", spec.SingleNode},
+		{"failureDomain", spec.FailureDomain != nil},
+		{"nodeGroup", spec.NodeGroup != nil},
+		{"credentialProviders", spec.CredentialProviders != nil},
+		{"templates", spec.Templates != nil},
+		{"dns", spec.DNS != nil},
+		{"prerequisites", len(spec.Prerequisites) > 0},
+		{"nodeAgent", spec.NodeAgent != nil},
+		{"addons", spec.Addons != nil},
+		{"kubeletServingCertificate", spec.KubeletServingCertificate != nil},
+		{"joinConfiguration.nodeRegistration.name", spec.JoinConfiguration.NodeRegistration.Name != ""},
+		{"joinConfiguration.nodeRegistration.taints", len(spec.JoinConfiguration.NodeRegistration.Taints) > 0},
+		{"joinConfiguration.nodeRegistration.kubeletExtraArgs", len(spec.JoinConfiguration.NodeRegistration.KubeletExtraArgs) > 0},
+	} {
+		if setting.set {
+			return setting.field
+		}
+	}
+	return ""
+}
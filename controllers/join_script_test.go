@@ -0,0 +1,117 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_Reconcile_JoinScript(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Status.ControlPlaneInitialized = true
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+	workerJoinConfig.Spec.Format = bootstrapv1.JoinScript
+	workerJoinConfig.Spec.PreKubeadmCommands = []string{"echo pre-kubeadm"}
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	objects = append(objects, createSecrets(t, cluster, workerJoinConfig)...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+	}
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	if _, err := k.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+
+	cfg, err := getKubeadmConfig(myclient, "worker-join-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Status.Ready {
+		t.Fatal("Expected status ready")
+	}
+	if !bytes.HasPrefix(cfg.Status.BootstrapData, []byte("#!/bin/sh\n")) {
+		t.Fatalf("expected a shell script, got:\n%s", cfg.Status.BootstrapData)
+	}
+	for _, expected := range []string{
+		"echo pre-kubeadm\n",
+		"kubeadm join '100.105.150.1:6443' --token '" + cfg.Spec.JoinConfiguration.Discovery.BootstrapToken.Token + "'",
+	} {
+		if !bytes.Contains(cfg.Status.BootstrapData, []byte(expected)) {
+			t.Errorf("%s\ndid not contain\n%s", cfg.Status.BootstrapData, expected)
+		}
+	}
+
+	// The token of a join script is refreshed even after the machine is ready, as other instances may still use it.
+	workerMachine.Status.InfrastructureReady = true
+	if err := myclient.Update(context.Background(), workerMachine); err != nil {
+		t.Fatal(err)
+	}
+	result, err := k.Reconcile(request)
+	if err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	if result.RequeueAfter != DefaultTokenTTL/2 {
+		t.Fatalf("expected to requeue to refresh the token, got %+v", result)
+	}
+}
+
+func TestValidateJoinScriptConfig(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+	if err := validateJoinScriptConfig(config); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+
+	config.Spec.Files = []bootstrapv1.File{{Path: "/etc/file", Content: "content"}}
+	if err := validateJoinScriptConfig(config); err == nil {
+		t.Fatal("expected files to be rejected")
+	}
+
+	config = newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+	config.Spec.JoinConfiguration.NodeRegistration.KubeletExtraArgs = map[string]string{"node-labels": "role=worker"}
+	if err := validateJoinScriptConfig(config); err == nil {
+		t.Fatal("expected kubelet extra args to be rejected")
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+)
+
+// formatBootstrapData converts the rendered cloud-config to the output format of the config.
+// The cloud-config is returned as is unless the JSON format is used.
+func formatBootstrapData(config *bootstrapv1.KubeadmConfig, userData []byte) ([]byte, error) {
+	if config.Spec.Format != bootstrapv1.JSON {
+		return userData, nil
+	}
+	if err := validateJSONFormatConfig(config); err != nil {
+		return nil, err
+	}
+	return cloudinit.ToJSON(userData)
+}
+
+// validateJSONFormatConfig checks that the config does not rely on cloud-init, as the JSON document is consumed
+// by agents which neither render jinja expressions nor read cloud-init data sources.
+func validateJSONFormatConfig(config *bootstrapv1.KubeadmConfig) error {
+	if source := dataSource(config); source != "" {
+		return errors.Errorf("the %s data source is not supported by the %s format", source, bootstrapv1.JSON)
+	}
+	if config.Spec.NodeName != nil && config.Spec.NodeName.Strategy == bootstrapv1.CloudMetadataStrategy {
+		return errors.Errorf("the %s node name strategy is not supported by the %s format", bootstrapv1.CloudMetadataStrategy, bootstrapv1.JSON)
+	}
+	for _, nodeRegistration := range nodeRegistrations(config) {
+		if strings.Contains(nodeRegistration.Name, "{{") {
+			return errors.Errorf("node registration name %q is a template, which is not supported by the %s format", nodeRegistration.Name, bootstrapv1.JSON)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_Reconcile_JSONFormat(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Status.ControlPlaneInitialized = true
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+	workerJoinConfig.Spec.Format = bootstrapv1.JSON
+	workerJoinConfig.Spec.PreKubeadmCommands = []string{"echo pre-kubeadm"}
+	workerJoinConfig.Spec.Files = []bootstrapv1.File{{Path: "/etc/file", Content: "content"}}
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	objects = append(objects, createSecrets(t, cluster, workerJoinConfig)...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+	}
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	if _, err := k.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+
+	cfg, err := getKubeadmConfig(myclient, "worker-join-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Status.Ready {
+		t.Fatal("Expected status ready")
+	}
+	doc := cloudinit.Document{}
+	if err := json.Unmarshal(cfg.Status.BootstrapData, &doc); err != nil {
+		t.Fatalf("expected a JSON document, got %v:\n%s", err, cfg.Status.BootstrapData)
+	}
+	if len(doc.Files) == 0 || doc.Files[0].Path != "/etc/file" {
+		t.Errorf("expected /etc/file to be written first, got %+v", doc.Files)
+	}
+	if len(doc.Commands) != 2 || doc.Commands[0] != "echo pre-kubeadm" || !strings.Contains(doc.Commands[1], "kubeadm join") {
+		t.Errorf("unexpected commands %v", doc.Commands)
+	}
+}
+
+func TestValidateJSONFormatConfig(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+	config.Spec.Format = bootstrapv1.JSON
+	if err := validateJSONFormatConfig(config); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+
+	config.Spec.FormatOptions = &bootstrapv1.FormatOptions{DataSource: bootstrapv1.NoCloudDataSource}
+	if err := validateJSONFormatConfig(config); err == nil {
+		t.Fatal("expected data sources to be rejected")
+	}
+
+	config.Spec.FormatOptions = nil
+	config.Spec.NodeName = &bootstrapv1.NodeName{Strategy: bootstrapv1.CloudMetadataStrategy}
+	if err := validateJSONFormatConfig(config); err == nil {
+		t.Fatal("expected the cloud metadata node name strategy to be rejected")
+	}
+}
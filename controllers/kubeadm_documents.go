@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// allowedKubeadmConfigDocumentKinds are the kinds kubeadm accepts in its config file besides the
+	// configurations generated by CABPK.
+	allowedKubeadmConfigDocumentKinds = map[schema.GroupKind]bool{
+		{Group: "kubelet.config.k8s.io", Kind: "KubeletConfiguration"}:     true,
+		{Group: "kubeproxy.config.k8s.io", Kind: "KubeProxyConfiguration"}: true,
+	}
+
+	yamlDocumentSeparator = regexp.MustCompile(`(?m)^---`)
+)
+
+// kubeadmConfigDocuments validates the additional kubeadm config documents, and returns them trimmed of
+// leading document separators and surrounding whitespace. Each entry must hold a single document of an allowed kind.
+func kubeadmConfigDocuments(documents []string) ([]string, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+
+	out := make([]string, 0, len(documents))
+	for i, document := range documents {
+		document = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(document), "---"))
+		if document == "" {
+			return nil, errors.Errorf("additional kubeadm config document %d is empty", i)
+		}
+		if yamlDocumentSeparator.MatchString(document) {
+			return nil, errors.Errorf("additional kubeadm config document %d must contain a single YAML document", i)
+		}
+
+		typeMeta := metav1.TypeMeta{}
+		if err := yaml.Unmarshal([]byte(document), &typeMeta); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse additional kubeadm config document %d", i)
+		}
+		if typeMeta.APIVersion == "" || typeMeta.Kind == "" {
+			return nil, errors.Errorf("additional kubeadm config document %d must define apiVersion and kind", i)
+		}
+		gv, err := schema.ParseGroupVersion(typeMeta.APIVersion)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid apiVersion in additional kubeadm config document %d", i)
+		}
+		if gk := gv.WithKind(typeMeta.Kind).GroupKind(); !allowedKubeadmConfigDocumentKinds[gk] {
+			return nil, errors.Errorf("kind %s of additional kubeadm config document %d is not supported", gk, i)
+		}
+		out = append(out, document)
+	}
+	return out, nil
+}
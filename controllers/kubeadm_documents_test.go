@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKubeadmConfigDocuments(t *testing.T) {
+	kubelet := "apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\ncgroupDriver: systemd"
+	kubeProxy := "apiVersion: kubeproxy.config.k8s.io/v1alpha1\nkind: KubeProxyConfiguration\nmode: ipvs"
+
+	testcases := []struct {
+		name      string
+		documents []string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name: "no documents",
+		},
+		{
+			name:      "keep the order and trim separators",
+			documents: []string{"---\n" + kubeProxy + "\n", kubelet},
+			expected:  []string{kubeProxy, kubelet},
+		},
+		{
+			name:      "reject configurations generated by CABPK",
+			documents: []string{"apiVersion: kubeadm.k8s.io/v1beta1\nkind: ClusterConfiguration"},
+			expectErr: true,
+		},
+		{
+			name:      "reject documents without kind",
+			documents: []string{"apiVersion: kubelet.config.k8s.io/v1beta1\ncgroupDriver: systemd"},
+			expectErr: true,
+		},
+		{
+			name:      "reject multiple documents in one entry",
+			documents: []string{kubelet + "\n---\n" + kubeProxy},
+			expectErr: true,
+		},
+		{
+			name:      "reject invalid YAML",
+			documents: []string{"kind: [KubeletConfiguration"},
+			expectErr: true,
+		},
+		{
+			name:      "reject empty documents",
+			documents: []string{"---\n"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			documents, err := kubeadmConfigDocuments(tc.documents)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if !reflect.DeepEqual(documents, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, documents)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/feature"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	kubeadmv1beta2 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta2"
+)
+
+var (
+	// minVersionForV1Beta2 is the first Kubernetes version whose kubeadm supports the v1beta2 config API.
+	minVersionForV1Beta2 = version.MustParseSemantic("v1.15.0")
+)
+
+// kubeadmConfigurationToYAML marshals the InitConfiguration, ClusterConfiguration or JoinConfiguration using the
+// kubeadm config API version best suited for the given Kubernetes version, so that the configuration documents of a
+// machine share the same version. When the version is not known, the v1beta1 API is used because it is understood by
+// all the kubeadm versions supported by CABPK.
+func kubeadmConfigurationToYAML(configuration runtime.Object, kubernetesVersion *string) (string, error) {
+	if !useKubeadmV1Beta2(kubernetesVersion) {
+		return kubeadmv1beta1.ConfigurationToYAML(configuration)
+	}
+
+	var out runtime.Object
+	switch configuration.(type) {
+	case *kubeadmv1beta1.InitConfiguration:
+		out = &kubeadmv1beta2.InitConfiguration{}
+	case *kubeadmv1beta1.ClusterConfiguration:
+		out = &kubeadmv1beta2.ClusterConfiguration{}
+	case *kubeadmv1beta1.JoinConfiguration:
+		out = &kubeadmv1beta2.JoinConfiguration{}
+	default:
+		return "", errors.Errorf("unsupported kubeadm configuration %T", configuration)
+	}
+
+	// v1beta2 is a superset of v1beta1, so the conversion can be done by serialization.
+	b, err := json.Marshal(configuration)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to convert %T", configuration)
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return "", errors.Wrapf(err, "failed to convert %T", configuration)
+	}
+	return kubeadmv1beta2.ConfigurationToYAML(out)
+}
+
+// kubeadmConfigAPIVersion returns the kubeadm config API version kubeadmConfigurationToYAML marshals the
+// configurations with for the given Kubernetes version.
+func kubeadmConfigAPIVersion(kubernetesVersion *string) schema.GroupVersion {
+	if useKubeadmV1Beta2(kubernetesVersion) {
+		return kubeadmv1beta2.GroupVersion
+	}
+	return kubeadmv1beta1.GroupVersion
+}
+
+// useKubeadmV1Beta2 returns true if the kubeadm shipped with the given Kubernetes version supports the v1beta2 config API
+// and the KubeadmV1Beta2 feature is enabled.
+func useKubeadmV1Beta2(kubernetesVersion *string) bool {
+	if !feature.Gates.Enabled(feature.KubeadmV1Beta2) {
+		return false
+	}
+	if kubernetesVersion == nil || *kubernetesVersion == "" {
+		return false
+	}
+	v, err := version.ParseSemantic(*kubernetesVersion)
+	if err != nil {
+		return false
+	}
+	return v.AtLeast(minVersionForV1Beta2)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestKubeadmConfigurationToYAML(t *testing.T) {
+	testcases := []struct {
+		name               string
+		version            *string
+		expectedAPIVersion string
+	}{
+		{
+			name:               "no version",
+			expectedAPIVersion: "apiVersion: kubeadm.k8s.io/v1beta1",
+		},
+		{
+			name:               "invalid version",
+			version:            stringPtr("latest"),
+			expectedAPIVersion: "apiVersion: kubeadm.k8s.io/v1beta1",
+		},
+		{
+			name:               "version before v1beta2",
+			version:            stringPtr("v1.14.3"),
+			expectedAPIVersion: "apiVersion: kubeadm.k8s.io/v1beta1",
+		},
+		{
+			name:               "version supporting v1beta2",
+			version:            stringPtr("v1.16.2"),
+			expectedAPIVersion: "apiVersion: kubeadm.k8s.io/v1beta2",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			configurations := []struct {
+				configuration runtime.Object
+				expected      string
+			}{
+				{
+					configuration: &kubeadmv1beta1.JoinConfiguration{
+						Discovery: kubeadmv1beta1.Discovery{
+							BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{
+								APIServerEndpoint: "example.com:6443",
+								Token:             "abcdef.0123456789abcdef",
+							},
+						},
+					},
+					expected: "apiServerEndpoint: example.com:6443",
+				},
+				{
+					configuration: &kubeadmv1beta1.InitConfiguration{
+						NodeRegistration: kubeadmv1beta1.NodeRegistrationOptions{Name: "control-plane-0"},
+					},
+					expected: "name: control-plane-0",
+				},
+				{
+					// the API version set by the reconciler is replaced
+					configuration: &kubeadmv1beta1.ClusterConfiguration{
+						TypeMeta:             metav1.TypeMeta{APIVersion: "kubeadm.k8s.io/v1beta1", Kind: "ClusterConfiguration"},
+						ControlPlaneEndpoint: "example.com:6443",
+					},
+					expected: "controlPlaneEndpoint: example.com:6443",
+				},
+			}
+			for _, c := range configurations {
+				out, err := kubeadmConfigurationToYAML(c.configuration, tc.version)
+				if err != nil {
+					t.Fatalf("Failed to marshal %T:\n %+v", c.configuration, err)
+				}
+				if !strings.Contains(out, tc.expectedAPIVersion) || strings.Count(out, "apiVersion:") != 1 {
+					t.Errorf("%s\ndid not contain\n%s", out, tc.expectedAPIVersion)
+				}
+				if !strings.Contains(out, c.expected) {
+					t.Errorf("%s\ndid not contain\n%s", out, c.expected)
+				}
+			}
+			if apiVersion := "apiVersion: " + kubeadmConfigAPIVersion(tc.version).String(); apiVersion != tc.expectedAPIVersion {
+				t.Errorf("expected the recorded API version to be %q, got %q", tc.expectedAPIVersion, apiVersion)
+			}
+		})
+	}
+}
@@ -18,30 +18,48 @@ package controllers
 
 import (
 	"context"
+	"crypto"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	typedrbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	"k8s.io/client-go/tools/record"
 	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
 	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
 	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/envelope"
 	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
 	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/patch"
-	"sigs.k8s.io/cluster-api/util/secret"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+const (
+	// DefaultClusterEndpointWaitThreshold is the default time a joining machine waits for the Cluster APIEndpoints
+	// before a warning event is emitted.
+	DefaultClusterEndpointWaitThreshold = 5 * time.Minute
+
+	// DefaultReconcileTimeout is the default deadline of a reconciliation, including the calls made to workload clusters.
+	DefaultReconcileTimeout = 2 * time.Minute
+)
+
 // InitLocker is a lock that is used around kubeadm init
 type InitLocker interface {
 	Lock(ctx context.Context, cluster *clusterv1.Cluster, machine *clusterv1.Machine) bool
@@ -51,7 +69,46 @@ type InitLocker interface {
 // SecretsClientFactory define behaviour for creating a secrets client
 type SecretsClientFactory interface {
 	// NewSecretsClient returns a new client supporting SecretInterface
-	NewSecretsClient(client.Client, *clusterv1.Cluster) (typedcorev1.SecretInterface, error)
+	NewSecretsClient(context.Context, client.Client, *clusterv1.Cluster) (typedcorev1.SecretInterface, error)
+}
+
+// RBACClientFactory define behaviour for creating a rbac client
+type RBACClientFactory interface {
+	// NewRBACClient returns a new client supporting RbacV1Interface
+	NewRBACClient(context.Context, client.Client, *clusterv1.Cluster) (typedrbacv1.RbacV1Interface, error)
+}
+
+// ConfigMapsClientFactory define behaviour for creating a config maps client
+type ConfigMapsClientFactory interface {
+	// NewConfigMapsClient returns a new client supporting ConfigMapInterface for the kube-public namespace
+	NewConfigMapsClient(context.Context, client.Client, *clusterv1.Cluster) (typedcorev1.ConfigMapInterface, error)
+}
+
+// KubeSystemConfigMapsClientFactory define behaviour for creating a kube-system config maps client
+type KubeSystemConfigMapsClientFactory interface {
+	// NewKubeSystemConfigMapsClient returns a new client supporting ConfigMapInterface for the kube-system namespace
+	NewKubeSystemConfigMapsClient(context.Context, client.Client, *clusterv1.Cluster) (typedcorev1.ConfigMapInterface, error)
+}
+
+// APIServerProber define behaviour for probing the API server endpoint of workload clusters
+type APIServerProber interface {
+	// Probe returns an error if the API server endpoint does not answer the probe of the given mode. The cluster CA
+	// is used to verify the TLS connections.
+	Probe(ctx context.Context, mode bootstrapv1.APIServerCheckMode, endpoint string, caCert []byte) error
+}
+
+// TokenProvider define behaviour for issuing the join credentials of machines instead of bootstrap tokens,
+// e.g. from the cloud identity of the machines
+type TokenProvider interface {
+	// Discovery sets the discovery of the join configuration of the config. It is called on every reconciliation
+	// until the bootstrap data is generated, so it must keep the discovery it has already set.
+	Discovery(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) error
+	// JoinFiles returns the files and the commands run before kubeadm which provide the join credentials to the
+	// machine, for joining the API server at the given URL verified with the cluster CA.
+	JoinFiles(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, server string, caCert []byte) ([]bootstrapv1.File, []string, error)
+	// Refresh keeps the join credentials of the config valid until its machine consumes the bootstrap data, and
+	// returns the delay until the next refresh. Credentials which do not expire are never refreshed if zero.
+	Refresh(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) (time.Duration, error)
 }
 
 // +kubebuilder:rbac:groups=bootstrap.cluster.x-k8s.io,resources=kubeadmconfigs;kubeadmconfigs/status,verbs=get;list;watch;create;update;patch;delete
@@ -62,8 +119,70 @@ type SecretsClientFactory interface {
 type KubeadmConfigReconciler struct {
 	client.Client
 	SecretsClientFactory SecretsClientFactory
+	RBACClientFactory    RBACClientFactory
 	KubeadmInitLock      InitLocker
 	Log                  logr.Logger
+
+	// DisableLegacyBootstrapData disables storing bootstrap data in the KubeadmConfig status,
+	// which is required by the v1alpha2 Machine contract.
+	DisableLegacyBootstrapData bool
+	// CompressLegacyBootstrapData compresses the bootstrap data stored in the KubeadmConfig status with gzip, and sets
+	// its BootstrapDataEncoding, to reduce the size of the configs in etcd. cloud-init decompresses gzip user data, so
+	// only the bootstrap data in the cloud-config format is compressed.
+	CompressLegacyBootstrapData bool
+
+	// PreRenderHooks are invoked in order before rendering bootstrap data.
+	PreRenderHooks []PreRenderHook
+	// PostRenderHooks are invoked in order after rendering bootstrap data.
+	PostRenderHooks []PostRenderHook
+
+	// Recorder is used to emit events about the reconciled configs, if set.
+	Recorder record.EventRecorder
+	// ClusterEndpointWaitThreshold is how long a joining machine waits for the Cluster APIEndpoints before a
+	// warning event is emitted. Defaults to DefaultClusterEndpointWaitThreshold.
+	ClusterEndpointWaitThreshold time.Duration
+	// RegenerateOutOfDateBootstrapData enables rendering the bootstrap data again when the spec of a config is changed
+	// before its machine is provisioned.
+	RegenerateOutOfDateBootstrapData bool
+	// RequireCACertHashes forbids the machines of all clusters from joining without verifying the cluster CA, as the
+	// RequireCACertHashesAnnotation does for a single cluster.
+	RequireCACertHashes bool
+	// InlineFilesSizeBudget is the maximum size in bytes of the additional files written from the bootstrap data.
+	// The largest files of joining machines are fetched from the workload cluster to fit in the budget. Disabled if zero.
+	InlineFilesSizeBudget int
+	// BootstrapDataKeyWrapper enables the envelope encryption of the bootstrap data stored in secrets, with a data key
+	// per cluster wrapped by the key encryption key of the wrapper. Bootstrap data is never stored in the config
+	// status when enabled.
+	BootstrapDataKeyWrapper envelope.KeyWrapper
+	// BootstrapDataSigner signs the bootstrap data with a controller key, so that machines can verify it was not
+	// tampered with in the provider metadata path. Signing is disabled if nil.
+	BootstrapDataSigner crypto.Signer
+	// BootstrapDataSignatureVerifier adds a boot command verifying the signature of the cloud-config bootstrap data
+	// to it with the public key baked in the machine image, which stops the bootstrap of machines before kubeadm runs
+	// if the key is missing or the signature is invalid. It requires the BootstrapDataSigner.
+	BootstrapDataSignatureVerifier bool
+	// ConfigMapsClientFactory is used to check the cluster-info ConfigMap of workload clusters for configs requesting it.
+	ConfigMapsClientFactory ConfigMapsClientFactory
+	// KubeSystemConfigMapsClientFactory is used to check the kubeadm-config ConfigMap of workload clusters before
+	// joining control plane machines, for configs requesting it.
+	KubeSystemConfigMapsClientFactory KubeSystemConfigMapsClientFactory
+	// APIServerProber is used to probe the API server endpoint of workload clusters for configs requesting it.
+	// Defaults to a NetAPIServerProber.
+	APIServerProber APIServerProber
+	// TokenProviders are the token backends configs may select by name to join instead of with bootstrap tokens.
+	TokenProviders map[string]TokenProvider
+	// PrerequisiteModules are the prerequisite modules configs may select by name, in addition to the
+	// DefaultPrerequisiteModules, which they override.
+	PrerequisiteModules map[string]PrerequisiteModule
+	// ReconcileTimeout is the deadline of a reconciliation, after which the pending client and workload cluster calls
+	// are cancelled and the config is requeued. Defaults to DefaultReconcileTimeout.
+	ReconcileTimeout time.Duration
+	// MaxConcurrentReconciles is the number of configs reconciled in parallel. The configs of a cluster are always
+	// reconciled one at a time. Defaults to 1.
+	MaxConcurrentReconciles int
+
+	clusterLocks clusterLocks
+	clusterCAs   clusterCAs
 }
 
 // SetupWithManager sets up the reconciler with the Manager.
@@ -82,12 +201,27 @@ func (r *KubeadmConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				ToRequests: handler.ToRequestsFunc(r.ClusterToKubeadmConfigs),
 			},
 		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			r.clusterCAs.EventHandler(),
+		).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
 
+// reconcileContext returns the context of a reconciliation, cancelled after the timeout, or after
+// DefaultReconcileTimeout if unset.
+func reconcileContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultReconcileTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
 // Reconcile handles KubeadmConfig events
-func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, rerr error) {
-	ctx := context.Background()
+func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (res ctrl.Result, rerr error) {
+	ctx, cancel := reconcileContext(r.ReconcileTimeout)
+	defer cancel()
 	log := r.Log.WithValues("kubeadmconfig", req.NamespacedName)
 
 	// Lookup the kubeadm config
@@ -112,6 +246,17 @@ func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 	}
 	log = log.WithValues("machine-name", machine.Name)
 
+	// Configs owned by failed machines are not reconciled until the failure is cleared, as their bootstrap data
+	// will never be consumed; the Machine watch enqueues the config again when the Machine is updated.
+	if err := r.reconcileOwnerMachineFailure(ctx, config, machine); err != nil {
+		log.Error(err, "failed to update owner machine failure condition")
+		return ctrl.Result{}, err
+	}
+	if isMachineFailed(machine) {
+		log.Info("Machine has failed, pausing reconciliation until the failure is cleared")
+		return ctrl.Result{}, nil
+	}
+
 	// Lookup the cluster the machine is associated with
 	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, machine.ObjectMeta)
 	if err != nil {
@@ -128,18 +273,54 @@ func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 		return ctrl.Result{}, err
 	}
 
+	// Configs of the same cluster are reconciled one at a time, as they race on its certificates, init lock and tokens.
+	// Busy configs are requeued with the backoff of the rate limiter of the queue, so that large clusters do not spin.
+	clusterKey := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	if !r.clusterLocks.TryLock(clusterKey) {
+		log.V(1).Info("Another config of the cluster is being reconciled, requeueing")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	defer r.clusterLocks.Unlock(clusterKey)
+
+	// Configs failing on the open circuit breaker of their workload cluster are requeued once it lets calls through again
+	defer func() {
+		res, rerr = r.reconcileWorkloadClusterCircuit(ctx, config, clusterKey, res, rerr)
+	}()
+
+	// Detect spec changes made after the bootstrap data was rendered, and render it again if it was not consumed yet
+	outOfDate, err := r.reconcileBootstrapDataDrift(ctx, config)
+	if err != nil {
+		log.Error(err, "failed to update bootstrap data out of date condition")
+		return ctrl.Result{}, err
+	}
+	if outOfDate && r.RegenerateOutOfDateBootstrapData && !isMachineProvisioned(machine) {
+		log.Info("Spec changed before the machine was provisioned, regenerating bootstrap data")
+		if err := r.resetBootstrapData(ctx, config); err != nil {
+			log.Error(err, "failed to reset bootstrap data")
+			return ctrl.Result{}, err
+		}
+	}
+
 	switch {
 	// Wait patiently for the infrastructure to be ready
 	case !cluster.Status.InfrastructureReady:
 		log.Info("Infrastructure is not ready, waiting until ready.")
 		return ctrl.Result{}, nil
-	// bail super early if it's already ready
-	case config.Status.Ready && machine.Status.InfrastructureReady:
+	// bail super early if it's already ready; join scripts are reused by other instances, so their token is kept refreshed
+	case config.Status.Ready && machine.Status.InfrastructureReady && config.Spec.Format != bootstrapv1.JoinScript:
 		log.Info("ignoring config for an already ready machine")
-		return ctrl.Result{}, nil
+		if err := r.reconcileNodeAgent(ctx, cluster, config, machine); err != nil {
+			log.Error(err, "failed to publish node agent update")
+			return ctrl.Result{}, err
+		}
+		return r.reconcileBootstrapDiagnostics(ctx, cluster, config, machine)
 	// Reconcile status for machines that have already copied bootstrap data
-	case machine.Spec.Bootstrap.Data != nil && !config.Status.Ready:
+	case hasBootstrapData(machine, config) && !config.Status.Ready:
 		config.Status.Ready = true
+		if config.Status.ReadyTime == nil {
+			now := v1.Now()
+			config.Status.ReadyTime = &now
+		}
 		// Initialize the patch helper
 		patchHelper, err := patch.NewHelper(config, r)
 		if err != nil {
@@ -147,12 +328,27 @@ func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 		}
 		err = patchHelper.Patch(ctx, config)
 		return ctrl.Result{}, err
-	// If we've already embedded a time-limited join token into a config, but are still waiting for the token to be used, refresh it
-	case config.Status.Ready && (config.Spec.JoinConfiguration != nil && config.Spec.JoinConfiguration.Discovery.BootstrapToken != nil):
-		token := config.Spec.JoinConfiguration.Discovery.BootstrapToken.Token
+	// join credentials issued by a token backend are kept valid by the backend until the infrastructure consumes them
+	case config.Status.Ready && config.Spec.JoinConfiguration != nil && config.Spec.TokenBackend != "" && !manualDiscovery(config):
+		provider, err := r.tokenProvider(config)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		after, err := provider.Refresh(ctx, cluster, config)
+		if err != nil {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to refresh the join credentials of token backend %q", config.Spec.TokenBackend)
+		}
+		return ctrl.Result{RequeueAfter: after}, nil
+	// If we've already embedded a time-limited join token into a config, but are still waiting for the token to be used, refresh it;
+	// tokens of configs using manual discovery are managed by external tooling.
+	case config.Status.Ready && (config.Spec.JoinConfiguration != nil && config.Spec.JoinConfiguration.Discovery.BootstrapToken != nil) && !manualDiscovery(config):
+		token, err := r.bootstrapToken(ctx, config)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 
 		// gets the remote secret interface client for the current cluster
-		secretsClient, err := r.SecretsClientFactory.NewSecretsClient(r.Client, cluster)
+		secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
@@ -165,7 +361,7 @@ func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 		}
 		// NB: this may not be sufficient to keep the token live if we don't see it before it expires, but when we generate a config we will set the status to "ready" which should generate an update event
 		return ctrl.Result{
-			RequeueAfter: DefaultTokenTTL / 2,
+			RequeueAfter: currentTunables().BootstrapTokenTTL / 2,
 		}, nil
 	}
 
@@ -174,6 +370,8 @@ func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	config.Status.ObservedGeneration = config.Generation
+	config.Status.LastRequeueReason = ""
 	// Attempt to Patch the KubeadmConfig object and status after each reconciliation if no error occurs.
 	defer func() {
 		if rerr == nil {
@@ -183,30 +381,75 @@ func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 		}
 	}()
 
-	if !cluster.Status.ControlPlaneInitialized {
+	nodeName, err := resolveNodeName(cluster, machine, config)
+	if err != nil {
+		log.Error(err, "failed to generate node name")
+		return ctrl.Result{}, err
+	}
+
+	if err := validateSingleNode(cluster, machine, config); err != nil {
+		log.Error(err, "invalid single node configuration")
+		return ctrl.Result{}, err
+	}
+
+	if err := validateOSFamily(config, util.IsControlPlaneMachine(machine)); err != nil {
+		log.Error(err, "invalid OS family configuration")
+		return ctrl.Result{}, err
+	}
+
+	if err := validateNodeAdoption(config, util.IsControlPlaneMachine(machine)); err != nil {
+		log.Error(err, "invalid node adoption configuration")
+		return ctrl.Result{}, err
+	}
+
+	if err := validateNodeGroup(cluster, machine, config); err != nil {
+		log.Error(err, "invalid node group configuration")
+		return ctrl.Result{}, err
+	}
+
+	metadata, err := dataSourceMetadata(config, machine, nodeName)
+	if err != nil {
+		log.Error(err, "failed to generate data source meta data")
+		return ctrl.Result{}, err
+	}
+
+	certPolicy, err := certificatesPolicy(machine, config)
+	if err != nil {
+		log.Error(err, "invalid certificates policy")
+		return ctrl.Result{}, err
+	}
+
+	failureDomain, err := machineFailureDomain(machine, config)
+	if err != nil {
+		log.Error(err, "invalid failure domain")
+		return ctrl.Result{}, err
+	}
+
+	// clusters with an external control plane are never initialized by a machine
+	if !cluster.Status.ControlPlaneInitialized && !externalControlPlane(cluster) {
 		// if it's NOT a control plane machine, requeue
 		if !util.IsControlPlaneMachine(machine) {
 			log.Info(fmt.Sprintf("Machine is not a control plane. If it should be a control plane, add `%s: true` as a label to the Machine", clusterv1.MachineControlPlaneLabelName))
-			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+			return requeueAfter(config, WaitingForControlPlaneInitializationReason, currentTunables().RequeueInterval), nil
 		}
 
 		// if the machine has not ClusterConfiguration and InitConfiguration, requeue
 		if config.Spec.InitConfiguration == nil && config.Spec.ClusterConfiguration == nil {
 			log.Info("Control plane is not ready, requeing joining control planes until ready.")
-			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+			return requeueAfter(config, WaitingForControlPlaneInitializationReason, currentTunables().RequeueInterval), nil
 		}
 
 		// acquire the init lock so that only the first machine configured
 		// as control plane get processed here
 		// if not the first, requeue
-		if !r.KubeadmInitLock.Lock(ctx, cluster, machine) {
+		if !r.lockInit(ctx, cluster, machine, config) {
 			log.Info("A control plane is already being initialized, requeing until control plane is ready")
-			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+			return requeueAfter(config, InitLockHeldReason, currentTunables().RequeueInterval), nil
 		}
 
 		defer func() {
 			if rerr != nil {
-				r.KubeadmInitLock.Unlock(ctx, cluster)
+				r.unlockInit(ctx, cluster)
 			}
 		}()
 
@@ -226,11 +469,37 @@ func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 				},
 			}
 		}
-		initdata, err := kubeadmv1beta1.ConfigurationToYAML(config.Spec.InitConfiguration)
+		setNodeRegistrationName(&config.Spec.InitConfiguration.NodeRegistration, nodeName)
+		var apiServerArgs map[string]string
+		if config.Spec.ClusterConfiguration != nil {
+			apiServerArgs = config.Spec.ClusterConfiguration.APIServer.ExtraArgs
+		}
+		defaultAdvertiseAddress(machine, apiServerArgs, &config.Spec.InitConfiguration.LocalAPIEndpoint)
+		if err := applyHardeningToNodeRegistration(config.Spec.Hardening, &config.Spec.InitConfiguration.NodeRegistration); err != nil {
+			log.Error(err, "failed to apply hardening to init configuration")
+			return ctrl.Result{}, err
+		}
+		if err := applyFailureDomainToNodeRegistration(config.Spec.FailureDomain, failureDomain, machine.Spec.Version, &config.Spec.InitConfiguration.NodeRegistration); err != nil {
+			log.Error(err, "failed to apply failure domain to init configuration")
+			return ctrl.Result{}, err
+		}
+		if err := applyCredentialProvidersToNodeRegistration(config.Spec.CredentialProviders, machine.Spec.Version, &config.Spec.InitConfiguration.NodeRegistration); err != nil {
+			log.Error(err, "failed to apply credential providers to init configuration")
+			return ctrl.Result{}, err
+		}
+		applyDNSToNodeRegistration(config.Spec.DNS, &config.Spec.InitConfiguration.NodeRegistration)
+		applyAddonsToNodeRegistration(config.Spec.Addons, &config.Spec.InitConfiguration.NodeRegistration)
+		applyKubeletServingCertificateToNodeRegistration(config.Spec.KubeletServingCertificate, &config.Spec.InitConfiguration.NodeRegistration)
+		if err := r.reconcileDeprecatedArgs(config, machine.Spec.Version, true); err != nil {
+			log.Error(err, "failed to reconcile deprecated args of init configuration")
+			return ctrl.Result{}, err
+		}
+		initdata, err := kubeadmConfigurationToYAML(config.Spec.InitConfiguration, machine.Spec.Version)
 		if err != nil {
 			log.Error(err, "failed to marshal init configuration")
 			return ctrl.Result{}, err
 		}
+		config.Status.KubeadmConfigAPIVersion = kubeadmConfigAPIVersion(machine.Spec.Version).String()
 
 		if config.Spec.ClusterConfiguration == nil {
 			config.Spec.ClusterConfiguration = &kubeadmv1beta1.ClusterConfiguration{
@@ -244,37 +513,133 @@ func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 		// injects into config.ClusterConfiguration values from top level object
 		r.reconcileTopLevelObjectSettings(cluster, machine, config)
 
-		clusterdata, err := kubeadmv1beta1.ConfigurationToYAML(config.Spec.ClusterConfiguration)
+		// the webhook may be disabled, and cannot see the settings injected from the Cluster
+		if errs := bootstrapv1.ValidateExtraArgs(&config.Spec, field.NewPath("spec")); len(errs) > 0 {
+			err := errs.ToAggregate()
+			log.Error(err, "control plane extra args conflict with the cluster configuration")
+			return ctrl.Result{}, err
+		}
+		if errs := bootstrapv1.ValidateExternalEtcd(&config.Spec, field.NewPath("spec")); len(errs) > 0 {
+			err := errs.ToAggregate()
+			log.Error(err, "invalid external etcd configuration")
+			return ctrl.Result{}, err
+		}
+
+		if err := applyHardeningToClusterConfiguration(config.Spec.Hardening, config.Spec.ClusterConfiguration); err != nil {
+			log.Error(err, "failed to apply hardening to cluster configuration")
+			return ctrl.Result{}, err
+		}
+		if err := applyFailureDomainToClusterConfiguration(config.Spec.FailureDomain, failureDomain, config.Spec.ClusterConfiguration); err != nil {
+			log.Error(err, "failed to apply failure domain to cluster configuration")
+			return ctrl.Result{}, err
+		}
+
+		clusterdata, err := kubeadmConfigurationToYAML(config.Spec.ClusterConfiguration, machine.Spec.Version)
 		if err != nil {
 			log.Error(err, "failed to marshal cluster configuration")
 			return ctrl.Result{}, err
 		}
 
 		certificates := internalcluster.NewCertificatesForInitialControlPlane(config.Spec.ClusterConfiguration)
-		if err := certificates.LookupOrGenerate(ctx, r.Client, cluster, config); err != nil {
+		setCAValidity(certificates, certPolicy)
+		if err := r.reconcileClusterCertificatesError(cluster, config, certsecret.LookupOrGenerate(ctx, r.Client, cluster, config, certificates)); err != nil {
 			log.Error(err, "unable to lookup or create cluster certificates")
 			return ctrl.Result{}, err
 		}
+		if external := config.Spec.ClusterConfiguration.Etcd.External; external != nil && external.CAFile != "" {
+			if err := r.reconcileExternalEtcdCertificates(cluster, config, external, certificates); err != nil {
+				log.Error(err, "invalid external etcd certificates")
+				return ctrl.Result{}, err
+			}
+		}
+
+		baseUserData, err := r.newBaseUserData(ctx, config, true, nodeName)
+		if err != nil {
+			log.Error(err, "failed to generate user data for bootstrap control plane")
+			return ctrl.Result{}, err
+		}
+		controlPlaneCommands, err := r.controlPlaneNodeCommands(ctx, cluster, config, &config.Spec.InitConfiguration.NodeRegistration, true)
+		if err != nil {
+			log.Error(err, "failed to apply control plane node policy")
+			return ctrl.Result{}, err
+		}
+		resourceFiles, resourceCommands, err := r.resolveBootstrapResources(ctx, config)
+		if err != nil {
+			log.Error(err, "failed to resolve bootstrap resources")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, resourceFiles...)
+		controlPlaneCommands = append(controlPlaneCommands, resourceCommands...)
+		cniFiles, cniCommands, err := r.resolveCNI(ctx, config)
+		if err != nil {
+			log.Error(err, "failed to resolve CNI manifest")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, cniFiles...)
+		controlPlaneCommands = append(controlPlaneCommands, cniCommands...)
+		approverFiles, approverCommands, err := r.resolveKubeletServingApprover(ctx, config)
+		if err != nil {
+			log.Error(err, "failed to resolve kubelet serving certificate approver manifest")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, approverFiles...)
+		controlPlaneCommands = append(controlPlaneCommands, approverCommands...)
+		baseUserData.PostKubeadmCommands = append(controlPlaneCommands, baseUserData.PostKubeadmCommands...)
+		renewalFiles, renewalCommands := certificatesRenewal(config, certPolicy)
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, renewalFiles...)
+		baseUserData.PostKubeadmCommands = append(baseUserData.PostKubeadmCommands, renewalCommands...)
+		sshFiles, sshCommands, err := r.sshHostFiles(ctx, cluster, config, &config.Spec.InitConfiguration.NodeRegistration, nodeName, days(certPolicy.ExpiryDays))
+		if err != nil {
+			log.Error(err, "failed to generate SSH host certificate")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, sshFiles...)
+		baseUserData.PreKubeadmCommands = append(baseUserData.PreKubeadmCommands, sshCommands...)
+		if err := r.addBootstrapDiagnostics(ctx, cluster, config, nil, certificates, &baseUserData); err != nil {
+			log.Error(err, "failed to add bootstrap diagnostics")
+			return ctrl.Result{}, err
+		}
+		if err := r.offloadLargeFiles(ctx, cluster, config, nil, certificates, &baseUserData); err != nil {
+			log.Error(err, "failed to offload large files")
+			return ctrl.Result{}, err
+		}
+
+		var certificateKey string
+		if config.Spec.UploadCerts {
+			if certificateKey, err = r.lookupOrCreateCertificateKey(ctx, cluster); err != nil {
+				log.Error(err, "failed to get the certificate key")
+				return ctrl.Result{}, err
+			}
+		}
 
 		cloudInitData, err := cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInput{
-			BaseUserData: cloudinit.BaseUserData{
-				AdditionalFiles:     config.Spec.Files,
-				NTP:                 config.Spec.NTP,
-				PreKubeadmCommands:  config.Spec.PreKubeadmCommands,
-				PostKubeadmCommands: config.Spec.PostKubeadmCommands,
-				Users:               config.Spec.Users,
-			},
+			BaseUserData:         baseUserData,
 			InitConfiguration:    initdata,
 			ClusterConfiguration: clusterdata,
 			Certificates:         certificates,
+			CertificateKey:       certificateKey,
 		})
 		if err != nil {
 			log.Error(err, "failed to generate cloud init for bootstrap control plane")
 			return ctrl.Result{}, err
 		}
 
-		config.Status.BootstrapData = cloudInitData
-		config.Status.Ready = true
+		cloudInitData, err = formatBootstrapData(config, cloudInitData)
+		if err != nil {
+			log.Error(err, "failed to format bootstrap data")
+			return ctrl.Result{}, err
+		}
+
+		cloudInitData, err = r.runPostRenderHooks(ctx, config, cloudInitData)
+		if err != nil {
+			log.Error(err, "failed to run post render hooks")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.storeBootstrapData(ctx, cluster, config, initConfigType, cloudInitData, metadata); err != nil {
+			log.Error(err, "failed to store bootstrap data")
+			return ctrl.Result{}, err
+		}
 
 		return ctrl.Result{}, nil
 	}
@@ -283,117 +648,453 @@ func (r *KubeadmConfigReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 	// Nb. in this case ClusterConfiguration and InitConfiguration should not be defined by users, but in case of misconfigurations, CABPK simply ignore them
 
 	// Unlock any locks that might have been set during init process
-	r.KubeadmInitLock.Unlock(ctx, cluster)
+	r.unlockInit(ctx, cluster)
 
 	// if the JoinConfiguration is missing, create a default one
 	if config.Spec.JoinConfiguration == nil {
 		log.Info("Creating default JoinConfiguration")
 		config.Spec.JoinConfiguration = &kubeadmv1beta1.JoinConfiguration{}
 	}
+	setNodeRegistrationName(&config.Spec.JoinConfiguration.NodeRegistration, nodeName)
+	if err := applyHardeningToNodeRegistration(config.Spec.Hardening, &config.Spec.JoinConfiguration.NodeRegistration); err != nil {
+		log.Error(err, "failed to apply hardening to join configuration")
+		return ctrl.Result{}, err
+	}
+	if err := applyFailureDomainToNodeRegistration(config.Spec.FailureDomain, failureDomain, machine.Spec.Version, &config.Spec.JoinConfiguration.NodeRegistration); err != nil {
+		log.Error(err, "failed to apply failure domain to join configuration")
+		return ctrl.Result{}, err
+	}
+	if err := applyNodeGroupToNodeRegistration(config.Spec.NodeGroup, machine.Spec.Version, &config.Spec.JoinConfiguration.NodeRegistration); err != nil {
+		log.Error(err, "failed to apply node group to join configuration")
+		return ctrl.Result{}, err
+	}
+	if err := applyCredentialProvidersToNodeRegistration(config.Spec.CredentialProviders, machine.Spec.Version, &config.Spec.JoinConfiguration.NodeRegistration); err != nil {
+		log.Error(err, "failed to apply credential providers to join configuration")
+		return ctrl.Result{}, err
+	}
+	applyDNSToNodeRegistration(config.Spec.DNS, &config.Spec.JoinConfiguration.NodeRegistration)
+	applyAddonsToNodeRegistration(config.Spec.Addons, &config.Spec.JoinConfiguration.NodeRegistration)
+	applyKubeletServingCertificateToNodeRegistration(config.Spec.KubeletServingCertificate, &config.Spec.JoinConfiguration.NodeRegistration)
+	if err := r.reconcileDeprecatedArgs(config, machine.Spec.Version, false); err != nil {
+		log.Error(err, "failed to reconcile deprecated args of join configuration")
+		return ctrl.Result{}, err
+	}
 
 	// it's a control plane join
-	if util.IsControlPlaneMachine(machine) {
+	if util.IsControlPlaneMachine(machine) && !externalControlPlane(cluster) {
 		if config.Spec.JoinConfiguration.ControlPlane == nil {
 			config.Spec.JoinConfiguration.ControlPlane = &kubeadmv1beta1.JoinControlPlane{}
 		}
+		defaultAdvertiseAddress(machine, nil, &config.Spec.JoinConfiguration.ControlPlane.LocalAPIEndpoint)
 
 		certificates := internalcluster.NewCertificatesForJoiningControlPlane()
-		if err := certificates.Lookup(ctx, r.Client, cluster); err != nil {
+		if err := certsecret.Lookup(ctx, r.Client, cluster, certificates); err != nil {
 			log.Error(err, "unable to lookup cluster certificates")
 			return ctrl.Result{}, err
 		}
 		if err := certificates.EnsureAllExist(); err != nil {
 			return ctrl.Result{}, err
 		}
+		if err := r.reconcileClusterCertificatesError(cluster, config, certificates.ValidateKeyPairs()); err != nil {
+			log.Error(err, "invalid cluster certificates")
+			return ctrl.Result{}, err
+		}
+
+		// if requested, ensure kubeadm would accept the machine before issuing a bootstrap token for it
+		if config.Spec.ControlPlaneJoinCheck {
+			if err := r.reconcileControlPlaneJoinCheck(ctx, cluster, config, machine.Spec.Version); err != nil {
+				if requeueErr, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); ok {
+					log.Info(err.Error())
+					return requeueAfter(config, ControlPlaneJoinIncompatibleReason, requeueErr.GetRequeueAfter()), nil
+				}
+				return ctrl.Result{}, err
+			}
+		}
 
 		// ensure that joinConfiguration.Discovery is properly set for joining node on the current cluster
-		if err := r.reconcileDiscovery(cluster, config, certificates); err != nil {
+		if err := r.reconcileDiscovery(ctx, cluster, config, certificates, machine.Spec.Version); err != nil {
 			if requeueErr, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); ok {
 				log.Info(err.Error())
-				return ctrl.Result{RequeueAfter: requeueErr.GetRequeueAfter()}, nil
+				return requeueAfter(config, discoveryRequeueReason(config), requeueErr.GetRequeueAfter()), nil
 			}
 			return ctrl.Result{}, err
 		}
 
-		joinData, err := kubeadmv1beta1.ConfigurationToYAML(config.Spec.JoinConfiguration)
+		joinConfiguration, err := r.joinConfigurationWithToken(ctx, config)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		joinData, err := kubeadmConfigurationToYAML(joinConfiguration, machine.Spec.Version)
 		if err != nil {
 			log.Error(err, "failed to marshal join configuration")
 			return ctrl.Result{}, err
 		}
+		config.Status.KubeadmConfigAPIVersion = kubeadmConfigAPIVersion(machine.Spec.Version).String()
+
+		etcdCertificates, err := etcdCertificateFiles(machine, config, certificates, days(certPolicy.ExpiryDays))
+		if err != nil {
+			log.Error(err, "failed to generate etcd certificates")
+			return ctrl.Result{}, err
+		}
+
+		baseUserData, err := r.newBaseUserData(ctx, config, true, nodeName)
+		if err != nil {
+			log.Error(err, "failed to generate user data for join control plane")
+			return ctrl.Result{}, err
+		}
+		controlPlaneCommands, err := r.controlPlaneNodeCommands(ctx, cluster, config, &config.Spec.JoinConfiguration.NodeRegistration, false)
+		if err != nil {
+			log.Error(err, "failed to apply control plane node policy")
+			return ctrl.Result{}, err
+		}
+		baseUserData.PostKubeadmCommands = append(controlPlaneCommands, baseUserData.PostKubeadmCommands...)
+		renewalFiles, renewalCommands := certificatesRenewal(config, certPolicy)
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, renewalFiles...)
+		baseUserData.PostKubeadmCommands = append(baseUserData.PostKubeadmCommands, renewalCommands...)
+		sshFiles, sshCommands, err := r.sshHostFiles(ctx, cluster, config, &config.Spec.JoinConfiguration.NodeRegistration, nodeName, days(certPolicy.ExpiryDays))
+		if err != nil {
+			log.Error(err, "failed to generate SSH host certificate")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, sshFiles...)
+		baseUserData.PreKubeadmCommands = append(baseUserData.PreKubeadmCommands, sshCommands...)
+		srvFiles, srvCommands, err := srvEndpointFiles(config, cloudinit.ControlPlaneJoinConfigurationPath)
+		if err != nil {
+			log.Error(err, "failed to generate SRV record resolution")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, srvFiles...)
+		baseUserData.PreKubeadmCommands = append(baseUserData.PreKubeadmCommands, srvCommands...)
+		tokenFiles, tokenCommands, err := r.tokenBackendFiles(ctx, cluster, config, certificates)
+		if err != nil {
+			log.Error(err, "failed to generate token backend join credentials")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, tokenFiles...)
+		baseUserData.PreKubeadmCommands = append(baseUserData.PreKubeadmCommands, tokenCommands...)
+
+		nodeClientFiles, err := r.nodeClientCertificateFiles(ctx, cluster, config, certificates)
+		if err != nil {
+			log.Error(err, "failed to generate node client certificate")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(nodeClientFiles, baseUserData.AdditionalFiles...)
+		if err := r.addBootstrapDiagnostics(ctx, cluster, config, joinConfiguration, certificates, &baseUserData); err != nil {
+			log.Error(err, "failed to add bootstrap diagnostics")
+			return ctrl.Result{}, err
+		}
+		if err := r.offloadLargeFiles(ctx, cluster, config, joinConfiguration, certificates, &baseUserData); err != nil {
+			log.Error(err, "failed to offload large files")
+			return ctrl.Result{}, err
+		}
+
+		// certificates uploaded by kubeadm init are downloaded by kubeadm join instead of being written to the machine
+		joinCertificates := certificates
+		certificateKey, err := getCertificateKey(ctx, r.Client, cluster)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if certificateKey != "" {
+			if err := r.ensureKubeadmCerts(ctx, cluster, certificateKey, certificates); err != nil {
+				log.Error(err, "failed to upload control plane certificates")
+				return ctrl.Result{}, err
+			}
+			joinCertificates = nil
+		}
 
 		log.Info("Creating BootstrapData for the join control plane")
 		cloudJoinData, err := cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
 			JoinConfiguration: joinData,
-			Certificates:      certificates,
-			BaseUserData: cloudinit.BaseUserData{
-				AdditionalFiles:     config.Spec.Files,
-				NTP:                 config.Spec.NTP,
-				PreKubeadmCommands:  config.Spec.PreKubeadmCommands,
-				PostKubeadmCommands: config.Spec.PostKubeadmCommands,
-				Users:               config.Spec.Users,
-			},
+			Certificates:      joinCertificates,
+			EtcdCertificates:  etcdCertificates,
+			BaseUserData:      baseUserData,
+			CertificateKey:    certificateKey,
 		})
 		if err != nil {
 			log.Error(err, "failed to create a control plane join configuration")
 			return ctrl.Result{}, err
 		}
 
-		config.Status.BootstrapData = cloudJoinData
-		config.Status.Ready = true
+		cloudJoinData, err = formatBootstrapData(config, cloudJoinData)
+		if err != nil {
+			log.Error(err, "failed to format bootstrap data")
+			return ctrl.Result{}, err
+		}
+
+		cloudJoinData, err = r.runPostRenderHooks(ctx, config, cloudJoinData)
+		if err != nil {
+			log.Error(err, "failed to run post render hooks")
+			return ctrl.Result{}, err
+		}
+
+		if err := r.storeBootstrapData(ctx, cluster, config, controlPlaneJoinConfigType, cloudJoinData, metadata); err != nil {
+			log.Error(err, "failed to store bootstrap data")
+			return ctrl.Result{}, err
+		}
 		return ctrl.Result{}, nil
 	}
 
-	// It's a worker join
-	certificates := internalcluster.NewCertificatesForWorker(config.Spec.JoinConfiguration.CACertPath)
-	if err := certificates.Lookup(ctx, r.Client, cluster); err != nil {
-		log.Error(err, "unable to lookup cluster certificates")
-		return ctrl.Result{}, err
-	}
-	if err := certificates.EnsureAllExist(); err != nil {
-		log.Error(err, "Missing certificates")
-		return ctrl.Result{}, err
+	// It's a worker join; all the machines of a cluster with an external control plane join as workers
+	var certificates internalcluster.Certificates
+	if externalControlPlane(cluster) {
+		certificates, err = r.reconcileExternalControlPlaneDiscovery(ctx, cluster, config)
+		if err != nil {
+			if requeueErr, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); ok {
+				log.Info(err.Error())
+				return requeueAfter(config, WaitingForDiscoverySecretReason, requeueErr.GetRequeueAfter()), nil
+			}
+			return ctrl.Result{}, err
+		}
+	} else {
+		certificates, err = r.workerCertificates(ctx, cluster, config.Spec.JoinConfiguration.CACertPath, config.Spec.NodeClientCertificate)
+		if err != nil {
+			log.Error(err, "unable to lookup cluster certificates")
+			return ctrl.Result{}, err
+		}
 	}
 
 	// ensure that joinConfiguration.Discovery is properly set for joining node on the current cluster
-	if err := r.reconcileDiscovery(cluster, config, certificates); err != nil {
+	if err := r.reconcileDiscovery(ctx, cluster, config, certificates, machine.Spec.Version); err != nil {
 		if requeueErr, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); ok {
 			log.Info(err.Error())
-			return ctrl.Result{RequeueAfter: requeueErr.GetRequeueAfter()}, nil
+			return requeueAfter(config, discoveryRequeueReason(config), requeueErr.GetRequeueAfter()), nil
 		}
 		return ctrl.Result{}, err
 	}
 
-	joinData, err := kubeadmv1beta1.ConfigurationToYAML(config.Spec.JoinConfiguration)
+	joinConfiguration, err := r.joinConfigurationWithToken(ctx, config)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	joinData, err := kubeadmConfigurationToYAML(joinConfiguration, machine.Spec.Version)
 	if err != nil {
 		log.Error(err, "failed to marshal join configuration")
 		return ctrl.Result{}, err
 	}
+	config.Status.KubeadmConfigAPIVersion = kubeadmConfigAPIVersion(machine.Spec.Version).String()
 
 	if config.Spec.JoinConfiguration.ControlPlane != nil {
 		return ctrl.Result{}, errors.New("Machine is a Worker, but JoinConfiguration.ControlPlane is set in the KubeadmConfig object")
 	}
 
-	log.Info("Creating BootstrapData for the worker node")
+	var cloudJoinData []byte
+	switch {
+	case config.Spec.AdoptExistingNode:
+		log.Info("Creating node adoption BootstrapData for the worker node")
 
-	cloudJoinData, err := cloudinit.NewNode(&cloudinit.NodeInput{
-		BaseUserData: cloudinit.BaseUserData{
-			AdditionalFiles:     config.Spec.Files,
-			NTP:                 config.Spec.NTP,
-			PreKubeadmCommands:  config.Spec.PreKubeadmCommands,
-			PostKubeadmCommands: config.Spec.PostKubeadmCommands,
-			Users:               config.Spec.Users,
-		},
-		JoinConfiguration: joinData,
-	})
+		cloudJoinData, err = newAdoptNodeScript(config, joinConfiguration, certificates)
+		if err != nil {
+			log.Error(err, "failed to create a node adoption script")
+			return ctrl.Result{}, err
+		}
+	case config.Spec.Format == bootstrapv1.JoinScript:
+		log.Info("Creating join script BootstrapData for the worker node")
+
+		cloudJoinData, err = newJoinScript(config, joinConfiguration)
+		if err != nil {
+			log.Error(err, "failed to create a worker join script")
+			return ctrl.Result{}, err
+		}
+	default:
+		baseUserData, err := r.newBaseUserData(ctx, config, false, nodeName)
+		if err != nil {
+			log.Error(err, "failed to generate user data for worker node")
+			return ctrl.Result{}, err
+		}
+		sshFiles, sshCommands, err := r.sshHostFiles(ctx, cluster, config, &config.Spec.JoinConfiguration.NodeRegistration, nodeName, days(certPolicy.ExpiryDays))
+		if err != nil {
+			log.Error(err, "failed to generate SSH host certificate")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, sshFiles...)
+		baseUserData.PreKubeadmCommands = append(baseUserData.PreKubeadmCommands, sshCommands...)
+		srvFiles, srvCommands, err := srvEndpointFiles(config, cloudinit.NodeJoinConfigurationPath)
+		if err != nil {
+			log.Error(err, "failed to generate SRV record resolution")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, srvFiles...)
+		baseUserData.PreKubeadmCommands = append(baseUserData.PreKubeadmCommands, srvCommands...)
+		tokenFiles, tokenCommands, err := r.tokenBackendFiles(ctx, cluster, config, certificates)
+		if err != nil {
+			log.Error(err, "failed to generate token backend join credentials")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(baseUserData.AdditionalFiles, tokenFiles...)
+		baseUserData.PreKubeadmCommands = append(baseUserData.PreKubeadmCommands, tokenCommands...)
+
+		nodeClientFiles, err := r.nodeClientCertificateFiles(ctx, cluster, config, certificates)
+		if err != nil {
+			log.Error(err, "failed to generate node client certificate")
+			return ctrl.Result{}, err
+		}
+		baseUserData.AdditionalFiles = append(nodeClientFiles, baseUserData.AdditionalFiles...)
+		if err := r.addBootstrapDiagnostics(ctx, cluster, config, joinConfiguration, certificates, &baseUserData); err != nil {
+			log.Error(err, "failed to add bootstrap diagnostics")
+			return ctrl.Result{}, err
+		}
+		if err := r.offloadLargeFiles(ctx, cluster, config, joinConfiguration, certificates, &baseUserData); err != nil {
+			log.Error(err, "failed to offload large files")
+			return ctrl.Result{}, err
+		}
+
+		log.Info("Creating BootstrapData for the worker node")
+
+		cloudJoinData, err = cloudinit.NewNode(&cloudinit.NodeInput{
+			BaseUserData:      baseUserData,
+			JoinConfiguration: joinData,
+		})
+		if err != nil {
+			log.Error(err, "failed to create a worker join configuration")
+			return ctrl.Result{}, err
+		}
+
+		cloudJoinData, err = formatBootstrapData(config, cloudJoinData)
+		if err != nil {
+			log.Error(err, "failed to format bootstrap data")
+			return ctrl.Result{}, err
+		}
+	}
+
+	cloudJoinData, err = r.runPostRenderHooks(ctx, config, cloudJoinData)
 	if err != nil {
-		log.Error(err, "failed to create a worker join configuration")
+		log.Error(err, "failed to run post render hooks")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.storeBootstrapData(ctx, cluster, config, workerJoinConfigType, cloudJoinData, metadata); err != nil {
+		log.Error(err, "failed to store bootstrap data")
 		return ctrl.Result{}, err
 	}
-	config.Status.BootstrapData = cloudJoinData
-	config.Status.Ready = true
 	return ctrl.Result{}, nil
 }
 
+// newBaseUserData returns the user data shared by all the kinds of bootstrap data for the given config.
+// Static pods managing the control plane VIP are only included for control plane machines.
+// The hostname of the machine is configured if a node name was generated.
+// The default NTP configuration of the controller is used if the config does not specify one.
+// Registered pre render hooks are invoked on the returned user data.
+func (r *KubeadmConfigReconciler) newBaseUserData(ctx context.Context, config *bootstrapv1.KubeadmConfig, isControlPlane bool, nodeName *nodeName) (cloudinit.BaseUserData, error) {
+	staticPodManifests, err := r.resolveStaticPodManifests(ctx, config)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to resolve static pod manifests")
+	}
+
+	if isControlPlane {
+		vipManifest, err := r.resolveControlPlaneVIP(ctx, config)
+		if err != nil {
+			return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to generate control plane VIP manifest")
+		}
+		if vipManifest != nil {
+			staticPodManifests = append(staticPodManifests, *vipManifest)
+		}
+	}
+
+	mirrorFiles, mirrorCommands, err := registryMirrorFiles(config.Spec.RegistryMirrors)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to render registry mirrors")
+	}
+
+	trustFiles, trustCommands, err := r.resolveTrustBundles(ctx, config)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to resolve trust bundles")
+	}
+
+	hardenedFiles, hardeningPreCommands, hardeningPostCommands, err := hardeningFiles(config.Spec.Hardening, isControlPlane)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to render hardening files")
+	}
+
+	nodeIPFiles, nodeIPCommands, err := nodeIPDetectionFiles(config)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to render node IP detection")
+	}
+
+	dnsConfigFiles, dnsCommands, err := dnsFiles(config)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to render DNS configuration")
+	}
+
+	addonPrerequisiteFiles, addonCommands, err := addonFiles(config)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to render addon prerequisites")
+	}
+
+	systemdFiles, systemdPreCommands, systemdPostCommands, err := systemdUnitFiles(config)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to render systemd units")
+	}
+
+	prerequisiteFiles, prerequisiteCommands, err := r.prerequisiteFiles(config)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to render prerequisites")
+	}
+
+	agentFiles, agentCommands, err := nodeAgentFiles(config)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to render node agent")
+	}
+
+	kubeadmDocuments, err := kubeadmConfigDocuments(config.Spec.AdditionalKubeadmConfigDocuments)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "invalid additional kubeadm config documents")
+	}
+
+	files, userPreKubeadmCommands, userPostKubeadmCommands, err := r.renderTemplates(ctx, config, nodeName)
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "failed to render templates")
+	}
+
+	var additionalFiles []bootstrapv1.File
+	for _, f := range [][]bootstrapv1.File{mirrorFiles, trustFiles, hardenedFiles, nodeIPFiles, dnsConfigFiles, addonPrerequisiteFiles, systemdFiles, prerequisiteFiles, credentialProviderFiles(config), agentFiles} {
+		additionalFiles = append(additionalFiles, f...)
+	}
+	additionalFiles = append(additionalFiles, files...)
+
+	selinuxPreCommands, err := selinuxCommands(config.Spec.SELinux, append(append([]bootstrapv1.File{}, additionalFiles...), staticPodManifests...))
+	if err != nil {
+		return cloudinit.BaseUserData{}, errors.Wrap(err, "invalid SELinux settings")
+	}
+
+	var preKubeadmCommands []string
+	for _, c := range [][]string{selinuxPreCommands, swapCommands(config), dnsCommands, mirrorCommands, trustCommands, hardeningPreCommands, nodeIPCommands, addonCommands, singleNodeCommands(config), systemdPreCommands, prerequisiteCommands} {
+		preKubeadmCommands = append(preKubeadmCommands, c...)
+	}
+	postKubeadmCommands := append(append(append([]string{}, hardeningPostCommands...), systemdPostCommands...), agentCommands...)
+
+	ntp := config.Spec.NTP
+	if ntp == nil {
+		ntp = currentTunables().DefaultNTP
+	}
+
+	userData := cloudinit.BaseUserData{
+		AdditionalFiles:     additionalFiles,
+		StaticPodManifests:  staticPodManifests,
+		NTP:                 ntp,
+		PreKubeadmCommands:  append(preKubeadmCommands, userPreKubeadmCommands...),
+		PostKubeadmCommands: append(postKubeadmCommands, userPostKubeadmCommands...),
+		Users:               config.Spec.Users,
+		ResetBeforeJoin:     config.Spec.ResetBeforeJoin,
+		IdempotentCommands:  config.Spec.IdempotentCommands,
+
+		AdditionalKubeadmConfigDocuments: kubeadmDocuments,
+		DisableTemplating:                dataSource(config) != "" || config.Spec.Format == bootstrapv1.JSON,
+		Windows:                          config.Spec.OSFamily == bootstrapv1.Windows,
+		VerifySignature:                  r.verifiesSignature(config),
+	}
+	if nodeName != nil {
+		userData.Hostname = nodeName.Hostname
+		userData.FQDN = nodeName.FQDN
+	}
+
+	if err := r.runPreRenderHooks(ctx, config, &userData); err != nil {
+		return cloudinit.BaseUserData{}, err
+	}
+	return userData, nil
+}
+
 // ClusterToKubeadmConfigs is a handler.ToRequestsFunc to be used to enqeue
 // requests for reconciliation of KubeadmConfigs.
 func (r *KubeadmConfigReconciler) ClusterToKubeadmConfigs(o handler.MapObject) []ctrl.Request {
@@ -449,9 +1150,32 @@ func (r *KubeadmConfigReconciler) MachineToBootstrapMapFunc(o handler.MapObject)
 // The implementation func respect user provided discovery configurations, but in case some of them are missing, a valid BootstrapToken object
 // is automatically injected into config.JoinConfiguration.Discovery.
 // This allows to simplify configuration UX, by providing the option to delegate to CABPK the configuration of kubeadm join discovery.
-func (r *KubeadmConfigReconciler) reconcileDiscovery(cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, certificates internalcluster.Certificates) error {
+// Bootstrap tokens and their RBAC rules follow the bootstrap token schema of the given Kubernetes version of the machine.
+func (r *KubeadmConfigReconciler) reconcileDiscovery(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, certificates internalcluster.Certificates, kubernetesVersion *string) error {
 	log := r.Log.WithValues("kubeadmconfig", fmt.Sprintf("%s/%s", config.Namespace, config.Name))
 
+	// if discovery is managed by external tooling, never alter it, but refuse incomplete discovery settings
+	if manualDiscovery(config) {
+		if err := validateManualDiscovery(config); err != nil {
+			return err
+		}
+		return r.reconcileInsecureDiscovery(cluster, config)
+	}
+
+	if err := validateAPIServerEndpointDNS(config); err != nil {
+		return err
+	}
+
+	// if requested, join with the credentials issued by a token backend instead of a bootstrap token
+	if config.Spec.TokenBackend != "" {
+		return r.reconcileTokenBackendDiscovery(ctx, cluster, config)
+	}
+
+	// if requested, join with a pre-signed node client certificate instead of a bootstrap token
+	if config.Spec.NodeClientCertificate {
+		return r.reconcileNodeClientCertificateDiscovery(ctx, cluster, config)
+	}
+
 	// if config already contains a file discovery configuration, respect it without further validations
 	if config.Spec.JoinConfiguration.Discovery.File != nil {
 		return nil
@@ -464,7 +1188,7 @@ func (r *KubeadmConfigReconciler) reconcileDiscovery(cluster *clusterv1.Cluster,
 
 	// calculate the ca cert hashes if they are not already set
 	if len(config.Spec.JoinConfiguration.Discovery.BootstrapToken.CACertHashes) == 0 {
-		hashes, err := certificates.GetByPurpose(secret.ClusterCA).Hashes()
+		hashes, err := certificates.GetByPurpose(internalcluster.ClusterCA).Hashes()
 		if err != nil {
 			log.Error(err, "Unable to generate Cluster CA certificate hashes")
 			return err
@@ -474,41 +1198,218 @@ func (r *KubeadmConfigReconciler) reconcileDiscovery(cluster *clusterv1.Cluster,
 
 	// if BootstrapToken already contains an APIServerEndpoint, respect it; otherwise inject the APIServerEndpoint endpoint defined in cluster status
 	apiServerEndpoint := config.Spec.JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint
+	if apiServerEndpoint == "" && config.Spec.APIServerEndpointDNS != nil {
+		apiServerEndpoint = dnsEndpoint(config.Spec.APIServerEndpointDNS)
+		config.Spec.JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint = apiServerEndpoint
+		log.Info("Altering JoinConfiguration.Discovery.BootstrapToken", "APIServerEndpoint", apiServerEndpoint)
+	}
+	if apiServerEndpoint == "" {
+		vip, err := r.clusterControlPlaneVIP(ctx, cluster, config)
+		if err != nil {
+			return err
+		}
+		if vip != nil {
+			apiServerEndpoint = vipEndpoint(vip)
+			config.Spec.JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint = apiServerEndpoint
+			log.Info("Altering JoinConfiguration.Discovery.BootstrapToken", "APIServerEndpoint", apiServerEndpoint)
+		}
+	}
 	if apiServerEndpoint == "" {
 		if len(cluster.Status.APIEndpoints) == 0 {
+			r.markWaitingForClusterEndpoint(cluster, config)
 			return errors.Wrap(&capierrors.RequeueAfterError{RequeueAfter: 10 * time.Second}, "Waiting for Cluster Controller to set cluster.Status.APIEndpoints")
 		}
 
+		if condition := getCondition(config, bootstrapv1.WaitingForClusterEndpointCondition); condition != nil {
+			setCondition(config, bootstrapv1.WaitingForClusterEndpointCondition, corev1.ConditionFalse, APIEndpointsAvailableReason, "", v1.Now())
+		}
+
 		// NB. CABPK only uses the first APIServerEndpoint defined in cluster status if there are multiple defined.
-		apiServerEndpoint = fmt.Sprintf("%s:%d", cluster.Status.APIEndpoints[0].Host, cluster.Status.APIEndpoints[0].Port)
+		apiServerEndpoint = apiEndpointAddress(cluster.Status.APIEndpoints[0])
 		config.Spec.JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint = apiServerEndpoint
 		log.Info("Altering JoinConfiguration.Discovery.BootstrapToken", "APIServerEndpoint", apiServerEndpoint)
 	}
 
-	// if BootstrapToken already contains a token, respect it; otherwise create a new bootstrap token for the node to join
-	if config.Spec.JoinConfiguration.Discovery.BootstrapToken.Token == "" {
+	// if requested, wait for the API server endpoint to answer before generating the join data
+	if config.Spec.APIServerCheck != "" {
+		if err := r.reconcileAPIServerReachability(ctx, cluster, config, apiServerEndpoint, certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair.Cert); err != nil {
+			return err
+		}
+	}
+
+	// if requested, ensure the workload cluster contains the RBAC rules required for joining nodes with bootstrap tokens
+	if config.Spec.EnsureBootstrapTokenRBAC {
+		rbacClient, err := r.RBACClientFactory.NewRBACClient(ctx, r.Client, cluster)
+		if err != nil {
+			return err
+		}
+
+		if err := ensureBootstrapTokenRBAC(rbacClient, kubernetesVersion); err != nil {
+			return errors.Wrapf(err, "failed to ensure bootstrap token RBAC rules")
+		}
+	}
+
+	// if requested, ensure the cluster-info ConfigMap used for discovery is valid before generating the join data
+	if config.Spec.ClusterInfoCheck != "" {
+		if err := r.reconcileClusterInfo(ctx, cluster, config, apiServerEndpoint, certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair.Cert); err != nil {
+			return err
+		}
+	}
+
+	// if BootstrapToken references a token provided by the user, ensure it exists in the workload cluster;
+	// the token is only resolved when generating the bootstrap data, so it is never stored in the config.
+	if tokenFrom := config.Spec.JoinConfiguration.Discovery.BootstrapToken.TokenFrom; tokenFrom != nil {
+		if config.Spec.JoinConfiguration.Discovery.BootstrapToken.Token != "" {
+			return errors.New("JoinConfiguration.Discovery.BootstrapToken must define only one of token or tokenFrom")
+		}
+
+		token, err := r.resolveBootstrapToken(ctx, config.Namespace, tokenFrom)
+		if err != nil {
+			return err
+		}
+
 		// gets the remote secret interface client for the current cluster
-		secretsClient, err := r.SecretsClientFactory.NewSecretsClient(r.Client, cluster)
+		secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
 		if err != nil {
 			return err
 		}
 
-		token, err := createToken(secretsClient)
+		if err := ensureToken(secretsClient, cluster, token, kubernetesVersion); err != nil {
+			return errors.Wrapf(err, "failed to ensure bootstrap token")
+		}
+	}
+
+	// a token set by the user is used as is, and must be valid
+	if token := config.Spec.JoinConfiguration.Discovery.BootstrapToken.Token; token != "" {
+		if err := validateBootstrapToken(token); err != nil {
+			return errors.Wrap(err, "invalid JoinConfiguration.Discovery.BootstrapToken.Token")
+		}
+	}
+
+	// if BootstrapToken already contains a token, respect it; otherwise create a new bootstrap token for the node to join
+	if config.Spec.JoinConfiguration.Discovery.BootstrapToken.Token == "" && config.Spec.JoinConfiguration.Discovery.BootstrapToken.TokenFrom == nil {
+		// a token pre-created in the pool of the MachineDeployment of the machine saves the workload cluster calls
+		token, err := r.claimPooledToken(ctx, config)
 		if err != nil {
-			return errors.Wrapf(err, "failed to create new bootstrap token")
+			return errors.Wrapf(err, "failed to claim a pooled bootstrap token")
+		}
+		if token == "" {
+			// gets the remote secret interface client for the current cluster
+			secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
+			if err != nil {
+				return err
+			}
+
+			token, err = createToken(secretsClient, cluster, config, kubernetesVersion)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create new bootstrap token")
+			}
+		}
+		if err := recordTokenIssued(ctx, r.Client, cluster, config, token); err != nil {
+			return errors.Wrapf(err, "failed to record the issuance of the bootstrap token")
 		}
 
 		config.Spec.JoinConfiguration.Discovery.BootstrapToken.Token = token
 		log.Info("Altering JoinConfiguration.Discovery.BootstrapToken", "Token", token)
 	}
 
-	// If the BootstrapToken does not contain any CACertHashes then force skip CA Verification
-	if len(config.Spec.JoinConfiguration.Discovery.BootstrapToken.CACertHashes) == 0 {
+	// If the BootstrapToken does not contain any CACertHashes then force skip CA Verification, unless the cluster requires it
+	if len(config.Spec.JoinConfiguration.Discovery.BootstrapToken.CACertHashes) == 0 && !r.requireCACertHashes(cluster) {
 		log.Info("No CAs were provided. Falling back to insecure discover method by skipping CA Cert validation")
 		config.Spec.JoinConfiguration.Discovery.BootstrapToken.UnsafeSkipCAVerification = true
 	}
 
-	return nil
+	return r.reconcileInsecureDiscovery(cluster, config)
+}
+
+// markWaitingForClusterEndpoint records on the config that its bootstrap data is blocked on the Cluster APIEndpoints,
+// and emits a warning event once it has been waiting for longer than the wait threshold.
+func (r *KubeadmConfigReconciler) markWaitingForClusterEndpoint(cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) {
+	threshold := r.ClusterEndpointWaitThreshold
+	if threshold == 0 {
+		threshold = DefaultClusterEndpointWaitThreshold
+	}
+
+	now := v1.Now()
+	reason := WaitingForAPIEndpointsReason
+	message := fmt.Sprintf("Waiting for the Cluster controller to set the APIEndpoints of Cluster %s", cluster.Name)
+	condition := getCondition(config, bootstrapv1.WaitingForClusterEndpointCondition)
+	if condition != nil && condition.Status == corev1.ConditionTrue {
+		if waited := now.Sub(condition.LastTransitionTime.Time); waited > threshold {
+			reason = APIEndpointsTimeoutReason
+			message = fmt.Sprintf("Cluster %s has had no APIEndpoints for %s, check the infrastructure provider", cluster.Name, waited.Round(time.Second))
+			if condition.Reason != APIEndpointsTimeoutReason && r.Recorder != nil {
+				r.Recorder.Event(config, corev1.EventTypeWarning, reason, message)
+			}
+		}
+	}
+	setCondition(config, bootstrapv1.WaitingForClusterEndpointCondition, corev1.ConditionTrue, reason, message, now)
+}
+
+// requeueAfter records on the config why its bootstrap data is not generated yet, and requeues it after the given duration.
+func requeueAfter(config *bootstrapv1.KubeadmConfig, reason string, after time.Duration) ctrl.Result {
+	config.Status.LastRequeueReason = reason
+	return ctrl.Result{RequeueAfter: after}
+}
+
+// discoveryRequeueReason returns the reason of the condition blocking the discovery configuration of the config.
+func discoveryRequeueReason(config *bootstrapv1.KubeadmConfig) string {
+	for _, conditionType := range []bootstrapv1.KubeadmConfigConditionType{
+		bootstrapv1.WaitingForClusterEndpointCondition,
+		bootstrapv1.APIServerUnreachableCondition,
+		bootstrapv1.ClusterInfoInvalidCondition,
+		bootstrapv1.InsecureDiscoveryCondition,
+	} {
+		if condition := getCondition(config, conditionType); condition != nil && condition.Status == corev1.ConditionTrue {
+			return condition.Reason
+		}
+	}
+	return WaitingForDiscoveryReason
+}
+
+// reconcileOwnerMachineFailure records on the config whether its owner Machine has failed, and emits a warning event
+// when the Machine fails. The config is only patched when the condition changes, to keep the load on the API server
+// low for failed machines.
+func (r *KubeadmConfigReconciler) reconcileOwnerMachineFailure(ctx context.Context, config *bootstrapv1.KubeadmConfig, machine *clusterv1.Machine) error {
+	status, reason, message := corev1.ConditionFalse, MachineRecoveredReason, ""
+	if isMachineFailed(machine) {
+		status, reason, message = corev1.ConditionTrue, MachineFailedReason, machineFailureMessage(machine)
+	}
+
+	condition := getCondition(config, bootstrapv1.OwnerMachineFailedCondition)
+	if condition == nil && status == corev1.ConditionFalse {
+		return nil
+	}
+	if condition != nil && condition.Status == status && condition.Reason == reason && condition.Message == message {
+		return nil
+	}
+
+	patchHelper, err := patch.NewHelper(config, r)
+	if err != nil {
+		return err
+	}
+	setCondition(config, bootstrapv1.OwnerMachineFailedCondition, status, reason, message, v1.Now())
+	if status == corev1.ConditionTrue && r.Recorder != nil {
+		r.Recorder.Event(config, corev1.EventTypeWarning, reason, message)
+	}
+	return patchHelper.Patch(ctx, config)
+}
+
+// isMachineFailed returns true if the Machine has a terminal error set.
+func isMachineFailed(machine *clusterv1.Machine) bool {
+	return machine.Status.ErrorReason != nil || machine.Status.ErrorMessage != nil
+}
+
+// machineFailureMessage describes the terminal error of the Machine.
+func machineFailureMessage(machine *clusterv1.Machine) string {
+	message := fmt.Sprintf("Machine %s has failed", machine.Name)
+	if machine.Status.ErrorReason != nil {
+		message = fmt.Sprintf("%s with reason %s", message, *machine.Status.ErrorReason)
+	}
+	if machine.Status.ErrorMessage != nil {
+		message = fmt.Sprintf("%s: %s", message, *machine.Status.ErrorMessage)
+	}
+	return message
 }
 
 // reconcileTopLevelObjectSettings injects into config.ClusterConfiguration values from top level objects like cluster and machine.
@@ -516,11 +1417,32 @@ func (r *KubeadmConfigReconciler) reconcileDiscovery(cluster *clusterv1.Cluster,
 func (r *KubeadmConfigReconciler) reconcileTopLevelObjectSettings(cluster *clusterv1.Cluster, machine *clusterv1.Machine, config *bootstrapv1.KubeadmConfig) {
 	log := r.Log.WithValues("kubeadmconfig", fmt.Sprintf("%s/%s", config.Namespace, config.Name))
 
+	// If there is a control plane VIP managed by CABPK, it is used as a control plane endpoint for the K8s cluster
+	// and it is added to the API server certificate SANs.
+	if vip := config.Spec.ControlPlaneVIP; vip != nil {
+		if config.Spec.ClusterConfiguration.ControlPlaneEndpoint == "" {
+			config.Spec.ClusterConfiguration.ControlPlaneEndpoint = vipEndpoint(vip)
+			log.Info("Altering ClusterConfiguration", "ControlPlaneEndpoint", config.Spec.ClusterConfiguration.ControlPlaneEndpoint)
+		}
+		if !containsString(config.Spec.ClusterConfiguration.APIServer.CertSANs, vip.Address) {
+			config.Spec.ClusterConfiguration.APIServer.CertSANs = append(config.Spec.ClusterConfiguration.APIServer.CertSANs, vip.Address)
+			log.Info("Altering ClusterConfiguration", "CertSANs", config.Spec.ClusterConfiguration.APIServer.CertSANs)
+		}
+	}
+
+	// If the kubeconfig of the cluster targets an endpoint override, it is added to the API server certificate SANs.
+	if endpoint, ok := cluster.Annotations[KubeconfigEndpointAnnotation]; ok {
+		if host, _, err := net.SplitHostPort(endpoint); err == nil && !containsString(config.Spec.ClusterConfiguration.APIServer.CertSANs, host) {
+			config.Spec.ClusterConfiguration.APIServer.CertSANs = append(config.Spec.ClusterConfiguration.APIServer.CertSANs, host)
+			log.Info("Altering ClusterConfiguration", "CertSANs", config.Spec.ClusterConfiguration.APIServer.CertSANs)
+		}
+	}
+
 	// If there are no ControlPlaneEndpoint defined in ClusterConfiguration but there are APIEndpoints defined at cluster level (e.g. the load balancer endpoint),
 	// then use cluster APIEndpoints as a control plane endpoint for the K8s cluster
 	if config.Spec.ClusterConfiguration.ControlPlaneEndpoint == "" && len(cluster.Status.APIEndpoints) > 0 {
 		// NB. CABPK only uses the first APIServerEndpoint defined in cluster status if there are multiple defined.
-		config.Spec.ClusterConfiguration.ControlPlaneEndpoint = fmt.Sprintf("%s:%d", cluster.Status.APIEndpoints[0].Host, cluster.Status.APIEndpoints[0].Port)
+		config.Spec.ClusterConfiguration.ControlPlaneEndpoint = apiEndpointAddress(cluster.Status.APIEndpoints[0])
 		log.Info("Altering ClusterConfiguration", "ControlPlaneEndpoint", config.Spec.ClusterConfiguration.ControlPlaneEndpoint)
 	}
 
@@ -556,3 +1478,12 @@ func (r *KubeadmConfigReconciler) reconcileTopLevelObjectSettings(cluster *clust
 		log.Info("Altering ClusterConfiguration", "KubernetesVersion", config.Spec.ClusterConfiguration.KubernetesVersion)
 	}
 }
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -31,16 +32,18 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	fakeclient "k8s.io/client-go/kubernetes/fake"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
 	"k8s.io/klog/klogr"
 	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
 	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
 	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util/secret"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
 )
@@ -77,7 +80,7 @@ func TestKubeadmConfigReconciler_MachineToBootstrapMapFuncReturn(t *testing.T) {
 		}
 		machineObjs = append(machineObjs, m)
 	}
-	fakeClient := fake.NewFakeClientWithScheme(setupScheme(), objs...)
+	fakeClient := newFakeClientWithScheme(setupScheme(), objs...)
 	reconciler := &KubeadmConfigReconciler{
 		Log:    log.Log,
 		Client: fakeClient,
@@ -107,7 +110,7 @@ func TestKubeadmConfigReconciler_Reconcile_ReturnEarlyIfKubeadmConfigIsReady(t *
 	objects := []runtime.Object{
 		config,
 	}
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 
 	k := &KubeadmConfigReconciler{
 		Log:    log.Log,
@@ -141,7 +144,7 @@ func TestKubeadmConfigReconciler_Reconcile_ReturnErrorIfReferencedMachineIsNotFo
 		// intentionally omitting machine
 		config,
 	}
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 
 	k := &KubeadmConfigReconciler{
 		Log:    log.Log,
@@ -170,7 +173,7 @@ func TestKubeadmConfigReconciler_Reconcile_ReturnEarlyIfMachineHasBootstrapData(
 		machine,
 		config,
 	}
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 
 	k := &KubeadmConfigReconciler{
 		Log:    log.Log,
@@ -204,7 +207,7 @@ func TestKubeadmConfigReconciler_Reconcile_ReturnEarlyIfMachineHasNoCluster(t *t
 		machine,
 		config,
 	}
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 
 	k := &KubeadmConfigReconciler{
 		Log:    log.Log,
@@ -232,7 +235,7 @@ func TestKubeadmConfigReconciler_Reconcile_ReturnNilIfMachineDoesNotHaveAssociat
 		machine,
 		config,
 	}
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 
 	k := &KubeadmConfigReconciler{
 		Log:    log.Log,
@@ -262,7 +265,7 @@ func TestKubeadmConfigReconciler_Reconcile_ReturnNilIfAssociatedClusterIsNotFoun
 		machine,
 		config,
 	}
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 
 	k := &KubeadmConfigReconciler{
 		Log:    log.Log,
@@ -328,7 +331,7 @@ func TestKubeadmConfigReconciler_Reconcile_RequeueJoiningNodesIfControlPlaneNotI
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			myclient := fake.NewFakeClientWithScheme(setupScheme(), tc.objects...)
+			myclient := newFakeClientWithScheme(setupScheme(), tc.objects...)
 
 			k := &KubeadmConfigReconciler{
 				Log:             log.Log,
@@ -346,6 +349,17 @@ func TestKubeadmConfigReconciler_Reconcile_RequeueJoiningNodesIfControlPlaneNotI
 			if result.RequeueAfter != 30*time.Second {
 				t.Fatal("expected to requeue after 30s")
 			}
+
+			config := &bootstrapv1.KubeadmConfig{}
+			if err := myclient.Get(context.Background(), tc.request.NamespacedName, config); err != nil {
+				t.Fatal(err)
+			}
+			if config.Status.LastRequeueReason != WaitingForControlPlaneInitializationReason {
+				t.Errorf("expected requeue reason %q, got %q", WaitingForControlPlaneInitializationReason, config.Status.LastRequeueReason)
+			}
+			if config.Status.ObservedGeneration != config.Generation {
+				t.Errorf("expected observed generation %d, got %d", config.Generation, config.Status.ObservedGeneration)
+			}
 		})
 	}
 }
@@ -365,7 +379,7 @@ func TestKubeadmConfigReconciler_Reconcile_GenerateCloudConfigData(t *testing.T)
 	}
 	objects = append(objects, createSecrets(t, cluster, controlPlaneInitConfig)...)
 
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 
 	k := &KubeadmConfigReconciler{
 		Log:             log.Log,
@@ -428,7 +442,7 @@ func TestKubeadmConfigReconciler_Reconcile_ErrorIfJoiningControlPlaneHasInvalidC
 		controlPlaneJoinConfig,
 	}
 	objects = append(objects, createSecrets(t, cluster, controlPlaneInitConfig)...)
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 
 	k := &KubeadmConfigReconciler{
 		Log:                  log.Log,
@@ -467,7 +481,7 @@ func TestKubeadmConfigReconciler_Reconcile_RequeueIfControlPlaneIsMissingAPIEndp
 	}
 	objects = append(objects, createSecrets(t, cluster, controlPlaneInitConfig)...)
 
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 
 	k := &KubeadmConfigReconciler{
 		Log:             log.Log,
@@ -493,6 +507,288 @@ func TestKubeadmConfigReconciler_Reconcile_RequeueIfControlPlaneIsMissingAPIEndp
 	}
 }
 
+func TestKubeadmConfigReconciler_Reconcile_WaitingForClusterEndpointCondition(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Status.ControlPlaneInitialized = true
+	controlPlaneInitMachine := newControlPlaneMachine(cluster, "control-plane-init-machine")
+	controlPlaneInitConfig := newControlPlaneInitKubeadmConfig(controlPlaneInitMachine, "control-plane-init-cfg")
+
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	objects = append(objects, createSecrets(t, cluster, controlPlaneInitConfig)...)
+
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+	recorder := record.NewFakeRecorder(10)
+
+	k := &KubeadmConfigReconciler{
+		Log:                          log.Log,
+		Client:                       myclient,
+		SecretsClientFactory:         newFakeSecretFactory(),
+		KubeadmInitLock:              &myInitLocker{},
+		Recorder:                     recorder,
+		ClusterEndpointWaitThreshold: time.Minute,
+	}
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	reconcileAndGetCondition := func() *bootstrapv1.KubeadmConfigCondition {
+		if _, err := k.Reconcile(request); err != nil {
+			t.Fatalf("Failed to reconcile:\n %+v", err)
+		}
+		cfg := &bootstrapv1.KubeadmConfig{}
+		if err := myclient.Get(context.Background(), request.NamespacedName, cfg); err != nil {
+			t.Fatal(err)
+		}
+		condition := getCondition(cfg, bootstrapv1.WaitingForClusterEndpointCondition)
+		if condition == nil {
+			t.Fatal("expected the WaitingForClusterEndpoint condition to be set")
+		}
+		return condition
+	}
+
+	condition := reconcileAndGetCondition()
+	if condition.Status != corev1.ConditionTrue || condition.Reason != WaitingForAPIEndpointsReason {
+		t.Fatalf("expected the config to be waiting for the cluster endpoint, got %+v", condition)
+	}
+	if len(recorder.Events) != 0 {
+		t.Fatal("did not expect an event before the wait threshold")
+	}
+
+	// Pretend the config has been waiting for longer than the threshold.
+	cfg := &bootstrapv1.KubeadmConfig{}
+	if err := myclient.Get(context.Background(), request.NamespacedName, cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-time.Hour))
+	if err := myclient.Update(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	condition = reconcileAndGetCondition()
+	if condition.Reason != APIEndpointsTimeoutReason {
+		t.Fatalf("expected the wait to time out, got %+v", condition)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected one warning event, got %d", len(recorder.Events))
+	}
+	reconcileAndGetCondition()
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected the warning event to be emitted only once, got %d", len(recorder.Events))
+	}
+
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+	if err := myclient.Update(context.Background(), cluster); err != nil {
+		t.Fatal(err)
+	}
+	condition = reconcileAndGetCondition()
+	if condition.Status != corev1.ConditionFalse || condition.Reason != APIEndpointsAvailableReason {
+		t.Fatalf("expected the cluster endpoint to be available, got %+v", condition)
+	}
+}
+
+func TestKubeadmConfigReconciler_Reconcile_PausesForFailedMachines(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Status.ControlPlaneInitialized = true
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+
+	workerMachine := newWorkerMachine(cluster)
+	reason := capierrors.InvalidConfigurationMachineError
+	workerMachine.Status.ErrorReason = &reason
+	workerMachine.Status.ErrorMessage = stringPtr("instance terminated")
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	objects = append(objects, createSecrets(t, cluster, workerJoinConfig)...)
+
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+	recorder := record.NewFakeRecorder(10)
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+		Recorder:             recorder,
+	}
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	reconcileAndGetConfig := func() *bootstrapv1.KubeadmConfig {
+		result, err := k.Reconcile(request)
+		if err != nil {
+			t.Fatalf("Failed to reconcile:\n %+v", err)
+		}
+		if result.Requeue || result.RequeueAfter != 0 {
+			t.Fatalf("did not expect to requeue, got %+v", result)
+		}
+		cfg := &bootstrapv1.KubeadmConfig{}
+		if err := myclient.Get(context.Background(), request.NamespacedName, cfg); err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	cfg := reconcileAndGetConfig()
+	condition := getCondition(cfg, bootstrapv1.OwnerMachineFailedCondition)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != MachineFailedReason {
+		t.Fatalf("expected the owner machine to be reported as failed, got %+v", condition)
+	}
+	if cfg.Status.Ready {
+		t.Fatal("did not expect bootstrap data to be generated for a failed machine")
+	}
+	reconcileAndGetConfig()
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected one warning event, got %d", len(recorder.Events))
+	}
+
+	workerMachine.Status.ErrorReason = nil
+	workerMachine.Status.ErrorMessage = nil
+	if err := myclient.Update(context.Background(), workerMachine); err != nil {
+		t.Fatal(err)
+	}
+	cfg = reconcileAndGetConfig()
+	condition = getCondition(cfg, bootstrapv1.OwnerMachineFailedCondition)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != MachineRecoveredReason {
+		t.Fatalf("expected the owner machine to be reported as recovered, got %+v", condition)
+	}
+	if !cfg.Status.Ready {
+		t.Fatal("expected bootstrap data to be generated once the machine recovered")
+	}
+}
+
+func TestKubeadmConfigReconciler_Reconcile_BootstrapDataOutOfDate(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Status.ControlPlaneInitialized = true
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	objects = append(objects, createSecrets(t, cluster, workerJoinConfig)...)
+
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+	recorder := record.NewFakeRecorder(10)
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+		Recorder:             recorder,
+	}
+
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	reconcileAndGetConfig := func() *bootstrapv1.KubeadmConfig {
+		if _, err := k.Reconcile(request); err != nil {
+			t.Fatalf("Failed to reconcile:\n %+v", err)
+		}
+		cfg := &bootstrapv1.KubeadmConfig{}
+		if err := myclient.Get(context.Background(), request.NamespacedName, cfg); err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	cfg := reconcileAndGetConfig()
+	if !cfg.Status.Ready || cfg.Status.RenderedSpecHash == "" {
+		t.Fatalf("expected bootstrap data to be rendered with a spec hash, got %+v", cfg.Status)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, BootstrapDataReadyReason) {
+			t.Fatalf("expected a %s event, got %q", BootstrapDataReadyReason, event)
+		}
+	default:
+		t.Fatal("expected an event")
+	}
+	cfg = reconcileAndGetConfig()
+	if condition := getCondition(cfg, bootstrapv1.BootstrapDataOutOfDateCondition); condition != nil {
+		t.Fatalf("did not expect the bootstrap data to be reported out of date, got %+v", condition)
+	}
+
+	cfg.Spec.PostKubeadmCommands = append(cfg.Spec.PostKubeadmCommands, "echo changed")
+	if err := myclient.Update(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg = reconcileAndGetConfig()
+	condition := getCondition(cfg, bootstrapv1.BootstrapDataOutOfDateCondition)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != SpecChangedReason {
+		t.Fatalf("expected the bootstrap data to be reported out of date, got %+v", condition)
+	}
+	if strings.Contains(string(cfg.Status.BootstrapData), "echo changed") {
+		t.Fatal("did not expect the bootstrap data to be regenerated")
+	}
+	reconcileAndGetConfig()
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected one warning event, got %d", len(recorder.Events))
+	}
+
+	// the reset is persisted even if the bootstrap data cannot be rendered yet
+	k.RegenerateOutOfDateBootstrapData = true
+	if err := myclient.Get(context.Background(), types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster); err != nil {
+		t.Fatal(err)
+	}
+	cluster.Status.InfrastructureReady = false
+	if err := myclient.Update(context.Background(), cluster); err != nil {
+		t.Fatal(err)
+	}
+	cfg = reconcileAndGetConfig()
+	if cfg.Status.Ready || cfg.Status.DataSecretName != nil || cfg.Status.BootstrapData != nil {
+		t.Fatalf("expected the bootstrap data to be reset, got %+v", cfg.Status)
+	}
+
+	cluster.Status.InfrastructureReady = true
+	if err := myclient.Update(context.Background(), cluster); err != nil {
+		t.Fatal(err)
+	}
+	cfg = reconcileAndGetConfig()
+	condition = getCondition(cfg, bootstrapv1.BootstrapDataOutOfDateCondition)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != SpecUpToDateReason {
+		t.Fatalf("expected the bootstrap data to be reported up to date, got %+v", condition)
+	}
+	if !cfg.Status.Ready || !strings.Contains(string(cfg.Status.BootstrapData), "echo changed") {
+		t.Fatal("expected the bootstrap data to be regenerated")
+	}
+	hash, err := specHash(&cfg.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Status.RenderedSpecHash != hash {
+		t.Fatal("expected the spec hash to be updated")
+	}
+}
+
 func TestReconcileIfJoinNodesAndControlPlaneIsReady(t *testing.T) {
 	cluster := newCluster("cluster")
 	cluster.Status.InfrastructureReady = true
@@ -544,7 +840,7 @@ func TestReconcileIfJoinNodesAndControlPlaneIsReady(t *testing.T) {
 				config,
 			}
 			objects = append(objects, createSecrets(t, cluster, config)...)
-			myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+			myclient := newFakeClientWithScheme(setupScheme(), objects...)
 			k := &KubeadmConfigReconciler{
 				Log:                  log.Log,
 				Client:               myclient,
@@ -582,7 +878,7 @@ func TestReconcileIfJoinNodesAndControlPlaneIsReady(t *testing.T) {
 				t.Fatal("Expected status ready")
 			}
 
-			myremoteclient, _ := k.SecretsClientFactory.NewSecretsClient(nil, nil)
+			myremoteclient, _ := k.SecretsClientFactory.NewSecretsClient(context.Background(), nil, nil)
 			l, err := myremoteclient.List(metav1.ListOptions{})
 			if err != nil {
 				t.Fatal(fmt.Sprintf("Failed to get secrets after reconcile:\n %+v", err))
@@ -617,7 +913,7 @@ func TestBootstrapTokenTTLExtension(t *testing.T) {
 	}
 
 	objects = append(objects, createSecrets(t, cluster, initConfig)...)
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 	k := &KubeadmConfigReconciler{
 		Log:                  log.Log,
 		Client:               myclient,
@@ -677,7 +973,7 @@ func TestBootstrapTokenTTLExtension(t *testing.T) {
 		t.Fatal("Expected status ready")
 	}
 
-	myremoteclient, _ := k.SecretsClientFactory.NewSecretsClient(nil, nil)
+	myremoteclient, _ := k.SecretsClientFactory.NewSecretsClient(context.Background(), nil, nil)
 	l, err := myremoteclient.List(metav1.ListOptions{})
 	if err != nil {
 		t.Fatalf("Failed to read secrets:\n %+v", err)
@@ -798,7 +1094,7 @@ func TestBootstrapTokenTTLExtension(t *testing.T) {
 func TestKubeadmConfigReconciler_Reconcile_DisocveryReconcileBehaviors(t *testing.T) {
 	k := &KubeadmConfigReconciler{
 		Log:                  log.Log,
-		Client:               nil,
+		Client:               newFakeClientWithScheme(setupScheme()),
 		SecretsClientFactory: newFakeSecretFactory(),
 		KubeadmInitLock:      &myInitLocker{},
 	}
@@ -944,7 +1240,7 @@ func TestKubeadmConfigReconciler_Reconcile_DisocveryReconcileBehaviors(t *testin
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := k.reconcileDiscovery(tc.cluster, tc.config, internalcluster.Certificates{})
+			err := k.reconcileDiscovery(context.Background(), tc.cluster, tc.config, internalcluster.Certificates{}, nil)
 			if err != nil {
 				t.Errorf("expected nil, got error %v", err)
 			}
@@ -960,7 +1256,7 @@ func TestKubeadmConfigReconciler_Reconcile_DisocveryReconcileBehaviors(t *testin
 func TestKubeadmConfigReconciler_Reconcile_DisocveryReconcileFailureBehaviors(t *testing.T) {
 	k := &KubeadmConfigReconciler{
 		Log:    log.Log,
-		Client: nil,
+		Client: newFakeClientWithScheme(setupScheme()),
 	}
 
 	testcases := []struct {
@@ -983,11 +1279,31 @@ func TestKubeadmConfigReconciler_Reconcile_DisocveryReconcileFailureBehaviors(t
 				},
 			},
 		},
+		{
+			name: "Fail if the bootstrap token set by the user is invalid",
+			cluster: &clusterv1.Cluster{
+				Status: clusterv1.ClusterStatus{
+					APIEndpoints: []clusterv1.APIEndpoint{{Host: "example.com", Port: 6443}},
+				},
+			},
+			config: &bootstrapv1.KubeadmConfig{
+				Spec: bootstrapv1.KubeadmConfigSpec{
+					JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+						Discovery: kubeadmv1beta1.Discovery{
+							BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{
+								CACertHashes: []string{"item"},
+								Token:        "ABCDEF.0123456789abcdef",
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := k.reconcileDiscovery(tc.cluster, tc.config, internalcluster.Certificates{})
+			err := k.reconcileDiscovery(context.Background(), tc.cluster, tc.config, internalcluster.Certificates{}, nil)
 			if err == nil {
 				t.Error("expected error, got nil")
 			}
@@ -1160,7 +1476,7 @@ func TestKubeadmConfigReconciler_Reconcile_AlwaysCheckCAVerificationUnlessReques
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+			myclient := newFakeClientWithScheme(setupScheme(), objects...)
 			reconciler := KubeadmConfigReconciler{
 				Client:               myclient,
 				SecretsClientFactory: newFakeSecretFactory(),
@@ -1202,7 +1518,7 @@ func TestKubeadmConfigReconciler_ClusterToKubeadmConfigs(t *testing.T) {
 		expectedNames = append(expectedNames, configName)
 		objs = append(objs, m, c)
 	}
-	fakeClient := fake.NewFakeClientWithScheme(setupScheme(), objs...)
+	fakeClient := newFakeClientWithScheme(setupScheme(), objs...)
 	reconciler := &KubeadmConfigReconciler{
 		Log:    log.Log,
 		Client: fakeClient,
@@ -1236,17 +1552,12 @@ func TestKubeadmConfigReconciler_Reconcile_DoesNotFailIfCASecretsAlreadyExist(t
 	m := newControlPlaneMachine(cluster, "control-plane-machine")
 	configName := "my-config"
 	c := newControlPlaneInitKubeadmConfig(m, configName)
-	scrt := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-%s", cluster.Name, internalcluster.EtcdCA),
-			Namespace: "default",
-		},
-		Data: map[string][]byte{
-			"tls.crt": []byte("hello world"),
-			"tls.key": []byte("hello world"),
-		},
+	certificates := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
 	}
-	fakec := fake.NewFakeClientWithScheme(setupScheme(), []runtime.Object{cluster, m, c, scrt}...)
+	scrt := certsecret.New(cluster, nil, certificates.GetByPurpose(internalcluster.EtcdCA))
+	fakec := newFakeClientWithScheme(setupScheme(), []runtime.Object{cluster, m, c, scrt}...)
 	reconciler := &KubeadmConfigReconciler{
 		Log:             log.Log,
 		Client:          fakec,
@@ -1278,7 +1589,7 @@ func TestKubeadmConfigReconciler_Reconcile_ExactlyOneControlPlaneMachineInitiali
 		controlPlaneInitMachineSecond,
 		controlPlaneInitConfigSecond,
 	}
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 	k := &KubeadmConfigReconciler{
 		Log:                  log.Log,
 		Client:               myclient,
@@ -1345,7 +1656,7 @@ func TestKubeadmConfigReconciler_Reconcile_DoNotPatchWhenErrorOccurred(t *testin
 		objects = append(objects, s)
 	}
 
-	myclient := fake.NewFakeClientWithScheme(setupScheme(), objects...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
 	k := &KubeadmConfigReconciler{
 		Log:                  log.Log,
 		Client:               myclient,
@@ -1496,7 +1807,7 @@ func createSecrets(t *testing.T, cluster *clusterv1.Cluster, owner *bootstrapv1.
 		t.Fatal(err)
 	}
 	for _, certificate := range certificates {
-		out = append(out, certificate.AsSecret(cluster, owner))
+		out = append(out, certsecret.New(cluster, owner, certificate))
 	}
 	return out
 }
@@ -1517,7 +1828,7 @@ type FakeSecretFactory struct {
 	client typedcorev1.SecretInterface
 }
 
-func (f FakeSecretFactory) NewSecretsClient(client client.Client, cluster *clusterv1.Cluster) (typedcorev1.SecretInterface, error) {
+func (f FakeSecretFactory) NewSecretsClient(_ context.Context, client client.Client, cluster *clusterv1.Cluster) (typedcorev1.SecretInterface, error) {
 	return f.client, nil
 }
 
@@ -0,0 +1,282 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+	"sigs.k8s.io/cluster-api/util/secret"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// KubeconfigErrorAnnotation is set on the kubeconfig secret of a cluster when it is invalid
+	// and cannot be regenerated.
+	KubeconfigErrorAnnotation = "bootstrap.cluster.x-k8s.io/kubeconfig-error"
+
+	// KubeconfigEndpointAnnotation is set on a Cluster to override, with a host:port, the server of its kubeconfig,
+	// e.g. to point the admin kubeconfig at a public DNS name while nodes use the internal load balancer.
+	// The host is added to the API server certificate SANs.
+	KubeconfigEndpointAnnotation = "bootstrap.cluster.x-k8s.io/kubeconfig-endpoint"
+
+	// KubeconfigRegenerateAnnotation is set on a Cluster to force the regeneration of its kubeconfig with a new client
+	// certificate, e.g. when the kubeconfig leaked. The kubeconfig is regenerated once per distinct value, so the
+	// annotation can be set to a timestamp to trigger further regenerations.
+	KubeconfigRegenerateAnnotation = "bootstrap.cluster.x-k8s.io/regenerate-kubeconfig"
+
+	// KubeconfigRegeneratedAnnotation is set on the kubeconfig secret of a cluster to the value of the
+	// KubeconfigRegenerateAnnotation the kubeconfig was last regenerated for.
+	KubeconfigRegeneratedAnnotation = "bootstrap.cluster.x-k8s.io/kubeconfig-regenerated"
+
+	// InputsHashAnnotation is set on the secrets generated or validated by CABPK to a hash of their inputs: the
+	// certificate of certificate authority secrets, the server and cluster CA of valid kubeconfig secrets, and the
+	// request and signing certificate authority of signed certificate requests. It is removed from invalid
+	// kubeconfig secrets, so that external reconcilers can detect secrets to be regenerated by comparing hashes.
+	InputsHashAnnotation = internalcluster.InputsHashAnnotation
+)
+
+// KubeconfigReconciler periodically validates the kubeconfig secret of each cluster: it must parse, its
+// client certificate must chain to the stored cluster CA and its server must match the cluster API endpoint.
+// Invalid kubeconfigs are regenerated from the cluster CA, or flagged if that is not possible. Valid kubeconfigs are
+// regenerated as well when requested with the KubeconfigRegenerateAnnotation.
+type KubeconfigReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// CheckInterval is the interval at which kubeconfig secrets are validated.
+	CheckInterval time.Duration
+
+	// Recorder records the conflicts on the fields of the kubeconfig secrets, if not nil.
+	Recorder record.EventRecorder
+}
+
+// SetupWithManager sets up the reconciler with the Manager.
+func (r *KubeconfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("kubeconfig").
+		For(&clusterv1.Cluster{}).
+		Complete(r)
+}
+
+// Reconcile validates the kubeconfig secret of a cluster.
+func (r *KubeconfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("cluster", req.NamespacedName)
+	result := ctrl.Result{RequeueAfter: r.CheckInterval}
+
+	cluster := &clusterv1.Cluster{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !cluster.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	// The kubeconfig secret is created by the cluster controller once the API endpoint is known.
+	kubeconfigSecret, err := secret.Get(r.Client, cluster, secret.Kubeconfig)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return result, nil
+		}
+		return ctrl.Result{}, err
+	}
+	caSecret, err := certsecret.Get(ctx, r.Client, cluster, internalcluster.ClusterCA)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return result, nil
+		}
+		return ctrl.Result{}, err
+	}
+	caCert, err := certs.DecodeCertPEM(caSecret.Data[secret.TLSCrtDataName])
+	if err != nil || caCert == nil {
+		return result, r.flagKubeconfig(ctx, kubeconfigSecret, errors.New("failed to decode the cluster CA certificate"), "")
+	}
+
+	server, err := kubeconfigServer(cluster)
+	if err != nil {
+		return result, r.flagKubeconfig(ctx, kubeconfigSecret, err, "")
+	}
+
+	inputsHash := kubeconfigInputsHash(server, caCert)
+
+	requested, regenerate := cluster.Annotations[KubeconfigRegenerateAnnotation]
+	if regenerate && requested == kubeconfigSecret.Annotations[KubeconfigRegeneratedAnnotation] {
+		regenerate = false
+	}
+
+	validationErr := validateKubeconfig(kubeconfigSecret.Data[secret.KubeconfigDataName], caCert, server, time.Now())
+	switch {
+	case validationErr == nil && !regenerate:
+		return result, r.flagKubeconfig(ctx, kubeconfigSecret, nil, inputsHash)
+	case validationErr == nil:
+		log.Info("Kubeconfig secret regeneration requested", "request", requested)
+		validationErr = errors.New("regeneration requested")
+	default:
+		log.Info("Kubeconfig secret is invalid", "reason", validationErr.Error())
+	}
+
+	caKey, err := certs.DecodePrivateKeyPEM(caSecret.Data[secret.TLSKeyDataName])
+	if err != nil || caKey == nil || server == "" {
+		return result, r.flagKubeconfig(ctx, kubeconfigSecret, errors.Wrap(validationErr, "unable to regenerate kubeconfig"), "")
+	}
+
+	cfg, err := kubeconfig.New(cluster.Name, server, caCert, caKey)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to generate a kubeconfig")
+	}
+	out, err := clientcmd.Write(*cfg)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to serialize kubeconfig")
+	}
+
+	if regenerate {
+		kubeconfigSecret = kubeconfigSecret.DeepCopy()
+		if kubeconfigSecret.Annotations == nil {
+			kubeconfigSecret.Annotations = map[string]string{}
+		}
+		kubeconfigSecret.Annotations[KubeconfigRegeneratedAnnotation] = requested
+	}
+	if err := r.applyKubeconfig(ctx, kubeconfigSecret, out, nil, inputsHash); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.Info("Regenerated kubeconfig secret")
+	return result, nil
+}
+
+// kubeconfigServer returns the server the kubeconfig of the cluster must target: the endpoint override if any, otherwise
+// the first cluster API endpoint. An empty string is returned if neither is known yet.
+func kubeconfigServer(cluster *clusterv1.Cluster) (string, error) {
+	if endpoint, ok := cluster.Annotations[KubeconfigEndpointAnnotation]; ok {
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			return "", errors.Wrapf(err, "invalid %s annotation %q, expected host:port", KubeconfigEndpointAnnotation, endpoint)
+		}
+		return "https://" + endpoint, nil
+	}
+	if len(cluster.Status.APIEndpoints) > 0 {
+		return "https://" + apiEndpointAddress(cluster.Status.APIEndpoints[0]), nil
+	}
+	return "", nil
+}
+
+// flagKubeconfig records the reason a kubeconfig secret is invalid, removing the hash of its inputs, or clears it if
+// reason is nil and records the given hash of the inputs of the valid kubeconfig.
+func (r *KubeconfigReconciler) flagKubeconfig(ctx context.Context, s *corev1.Secret, reason error, inputsHash string) error {
+	current, flagged := s.Annotations[KubeconfigErrorAnnotation]
+	_, hashed := s.Annotations[InputsHashAnnotation]
+	switch {
+	case reason == nil && !flagged && s.Annotations[InputsHashAnnotation] == inputsHash:
+		return nil
+	case reason != nil && current == reason.Error() && !hashed:
+		return nil
+	}
+	return r.applyKubeconfig(ctx, s, s.Data[secret.KubeconfigDataName], reason, inputsHash)
+}
+
+// kubeconfigInputsHash returns the hash of the inputs of a kubeconfig: its server and the cluster CA certificate.
+func kubeconfigInputsHash(server string, caCert *x509.Certificate) string {
+	return internalcluster.InputsHash([]byte(server), caCert.Raw)
+}
+
+// applyKubeconfig applies the kubeconfig data to the kubeconfig secret, along with the reason it is invalid if any,
+// or the hash of its inputs if any. The regeneration request the current secret was last regenerated for is preserved.
+func (r *KubeconfigReconciler) applyKubeconfig(ctx context.Context, current *corev1.Secret, data []byte, reason error, inputsHash string) error {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   current.Namespace,
+			Name:        current.Name,
+			Annotations: map[string]string{},
+		},
+		Data: map[string][]byte{
+			secret.KubeconfigDataName: data,
+		},
+	}
+	if reason != nil {
+		s.Annotations[KubeconfigErrorAnnotation] = reason.Error()
+	}
+	if inputsHash != "" {
+		s.Annotations[InputsHashAnnotation] = inputsHash
+	}
+	if requested, ok := current.Annotations[KubeconfigRegeneratedAnnotation]; ok {
+		s.Annotations[KubeconfigRegeneratedAnnotation] = requested
+	}
+	return errors.Wrapf(applySecret(ctx, r.Client, r.Recorder, s), "failed to apply kubeconfig secret %s/%s", s.Namespace, s.Name)
+}
+
+// validateKubeconfig checks that the kubeconfig parses, that the current context trusts the cluster CA and
+// authenticates with a valid client certificate signed by it, and that it targets the given server, if any.
+func validateKubeconfig(data []byte, caCert *x509.Certificate, server string, now time.Time) error {
+	cfg, err := clientcmd.Load(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse kubeconfig")
+	}
+
+	kubeContext, ok := cfg.Contexts[cfg.CurrentContext]
+	if !ok {
+		return errors.Errorf("current context %q not found", cfg.CurrentContext)
+	}
+	kubeCluster, ok := cfg.Clusters[kubeContext.Cluster]
+	if !ok {
+		return errors.Errorf("cluster %q not found", kubeContext.Cluster)
+	}
+	authInfo, ok := cfg.AuthInfos[kubeContext.AuthInfo]
+	if !ok {
+		return errors.Errorf("user %q not found", kubeContext.AuthInfo)
+	}
+
+	if server != "" && kubeCluster.Server != server {
+		return errors.Errorf("server %q does not match the cluster API endpoint %q", kubeCluster.Server, server)
+	}
+
+	ca, err := certs.DecodeCertPEM(kubeCluster.CertificateAuthorityData)
+	if err != nil || ca == nil || !ca.Equal(caCert) {
+		return errors.New("certificate authority data does not match the cluster CA")
+	}
+
+	clientCert, err := certs.DecodeCertPEM(authInfo.ClientCertificateData)
+	if err != nil || clientCert == nil {
+		return errors.New("failed to decode the client certificate")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	if _, err := clientCert.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return errors.Wrap(err, "client certificate does not validate against the cluster CA")
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+	"sigs.k8s.io/cluster-api/util/secret"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeconfigReconciler_Reconcile(t *testing.T) {
+	tests := []struct {
+		name           string
+		mutate         func(t *testing.T, c client.Client, cluster *clusterv1.Cluster)
+		expectChanged  bool
+		expectFlagged  bool
+		expectedServer string
+		// expectedRegenerated is the regeneration request the kubeconfig secret is expected to be annotated with.
+		expectedRegenerated string
+	}{
+		{
+			name:           "leaves a valid kubeconfig untouched",
+			expectedServer: "https://10.0.0.1:6443",
+		},
+		{
+			name: "regenerates a kubeconfig pointing to a stale endpoint",
+			mutate: func(t *testing.T, c client.Client, cluster *clusterv1.Cluster) {
+				cluster.Status.APIEndpoints[0].Host = "10.0.0.2"
+				if err := c.Update(context.Background(), cluster); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectChanged:  true,
+			expectedServer: "https://10.0.0.2:6443",
+		},
+		{
+			name: "regenerates a kubeconfig that does not parse",
+			mutate: func(t *testing.T, c client.Client, cluster *clusterv1.Cluster) {
+				updateSecretData(t, c, cluster, secret.Kubeconfig, secret.KubeconfigDataName, []byte("not a kubeconfig"))
+			},
+			expectChanged:  true,
+			expectedServer: "https://10.0.0.1:6443",
+		},
+		{
+			name: "regenerates a kubeconfig pointing to the endpoint override",
+			mutate: func(t *testing.T, c client.Client, cluster *clusterv1.Cluster) {
+				cluster.Annotations = map[string]string{KubeconfigEndpointAnnotation: "api.example.com:443"}
+				if err := c.Update(context.Background(), cluster); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectChanged:  true,
+			expectedServer: "https://api.example.com:443",
+		},
+		{
+			name: "regenerates a valid kubeconfig on request",
+			mutate: func(t *testing.T, c client.Client, cluster *clusterv1.Cluster) {
+				cluster.Annotations = map[string]string{KubeconfigRegenerateAnnotation: "2019-12-01T00:00:00Z"}
+				if err := c.Update(context.Background(), cluster); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectChanged:       true,
+			expectedServer:      "https://10.0.0.1:6443",
+			expectedRegenerated: "2019-12-01T00:00:00Z",
+		},
+		{
+			name: "regenerates a kubeconfig only once per request",
+			mutate: func(t *testing.T, c client.Client, cluster *clusterv1.Cluster) {
+				cluster.Annotations = map[string]string{KubeconfigRegenerateAnnotation: "2019-12-01T00:00:00Z"}
+				if err := c.Update(context.Background(), cluster); err != nil {
+					t.Fatal(err)
+				}
+				s, err := secret.Get(c, cluster, secret.Kubeconfig)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.Annotations = map[string]string{KubeconfigRegeneratedAnnotation: "2019-12-01T00:00:00Z"}
+				if err := c.Update(context.Background(), s); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectedServer:      "https://10.0.0.1:6443",
+			expectedRegenerated: "2019-12-01T00:00:00Z",
+		},
+		{
+			name: "flags a kubeconfig if the endpoint override is invalid",
+			mutate: func(t *testing.T, c client.Client, cluster *clusterv1.Cluster) {
+				cluster.Annotations = map[string]string{KubeconfigEndpointAnnotation: "api.example.com"}
+				if err := c.Update(context.Background(), cluster); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectFlagged: true,
+		},
+		{
+			name: "flags an invalid kubeconfig if the CA key is not available",
+			mutate: func(t *testing.T, c client.Client, cluster *clusterv1.Cluster) {
+				updateSecretData(t, c, cluster, secret.Kubeconfig, secret.KubeconfigDataName, []byte("not a kubeconfig"))
+				updateSecretData(t, c, cluster, secret.ClusterCA, secret.TLSKeyDataName, nil)
+			},
+			expectFlagged: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := newCluster("cluster")
+			cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "10.0.0.1", Port: 6443}}
+			config := newControlPlaneInitKubeadmConfig(newControlPlaneMachine(cluster, "control-plane"), "control-plane-cfg")
+			objects := append([]runtime.Object{cluster}, createSecrets(t, cluster, config)...)
+			c := newFakeClientWithScheme(setupScheme(), objects...)
+			if err := kubeconfig.CreateSecret(context.Background(), c, cluster); err != nil {
+				t.Fatal(err)
+			}
+			before, err := kubeconfig.FromSecret(c, cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.mutate != nil {
+				tc.mutate(t, c, cluster)
+				before, _ = kubeconfig.FromSecret(c, cluster)
+			}
+
+			r := &KubeconfigReconciler{Client: c, Log: log.Log, CheckInterval: time.Minute}
+			result, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.RequeueAfter != time.Minute {
+				t.Errorf("expected the kubeconfig to be checked again after %v, got %v", time.Minute, result)
+			}
+
+			s, err := secret.Get(c, cluster, secret.Kubeconfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := s.Data[secret.KubeconfigDataName]
+			if changed := !bytes.Equal(before, after); changed != tc.expectChanged {
+				t.Fatalf("expected kubeconfig changed: %v, got %v", tc.expectChanged, changed)
+			}
+			if _, flagged := s.Annotations[KubeconfigErrorAnnotation]; flagged != tc.expectFlagged {
+				t.Fatalf("expected kubeconfig flagged: %v, got annotations %v", tc.expectFlagged, s.Annotations)
+			}
+			if regenerated := s.Annotations[KubeconfigRegeneratedAnnotation]; regenerated != tc.expectedRegenerated {
+				t.Fatalf("expected kubeconfig regenerated for %q, got %q", tc.expectedRegenerated, regenerated)
+			}
+			if tc.expectFlagged {
+				if hash, ok := s.Annotations[InputsHashAnnotation]; ok {
+					t.Errorf("expected no inputs hash on a flagged kubeconfig, got %q", hash)
+				}
+				return
+			}
+
+			ca, err := secret.Get(c, cluster, secret.ClusterCA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			caCert, err := certs.DecodeCertPEM(ca.Data[secret.TLSCrtDataName])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validateKubeconfig(after, caCert, tc.expectedServer, time.Now()); err != nil {
+				t.Errorf("expected a valid kubeconfig, got: %v", err)
+			}
+			if hash, expected := s.Annotations[InputsHashAnnotation], kubeconfigInputsHash(tc.expectedServer, caCert); hash != expected {
+				t.Errorf("expected inputs hash %q, got %q", expected, hash)
+			}
+		})
+	}
+}
+
+func TestValidateKubeconfig_ExpiredClientCertificate(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "10.0.0.1", Port: 6443}}
+	config := newControlPlaneInitKubeadmConfig(newControlPlaneMachine(cluster, "control-plane"), "control-plane-cfg")
+	c := newFakeClientWithScheme(setupScheme(), append([]runtime.Object{cluster}, createSecrets(t, cluster, config)...)...)
+	if err := kubeconfig.CreateSecret(context.Background(), c, cluster); err != nil {
+		t.Fatal(err)
+	}
+	data, err := kubeconfig.FromSecret(c, cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := secret.Get(c, cluster, secret.ClusterCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := certs.DecodeCertPEM(ca.Data[secret.TLSCrtDataName])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateKubeconfig(data, caCert, "", time.Now().Add(2*certs.DefaultCertDuration)); err == nil {
+		t.Error("expected an expired client certificate to be invalid")
+	}
+}
+
+func updateSecretData(t *testing.T, c client.Client, cluster *clusterv1.Cluster, purpose secret.Purpose, key string, value []byte) {
+	s := &corev1.Secret{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: cluster.Namespace, Name: secret.Name(cluster.Name, purpose)}, s); err != nil {
+		t.Fatal(err)
+	}
+	if value == nil {
+		delete(s.Data, key)
+	} else {
+		s.Data[key] = value
+	}
+	if err := c.Update(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconcileTopLevelObjectSettings_KubeconfigEndpoint(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Annotations = map[string]string{KubeconfigEndpointAnnotation: "api.example.com:443"}
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "10.0.0.1", Port: 6443}}
+	machine := newControlPlaneMachine(cluster, "control-plane")
+	config := newControlPlaneInitKubeadmConfig(machine, "control-plane-cfg")
+
+	k := &KubeadmConfigReconciler{Log: log.Log}
+	k.reconcileTopLevelObjectSettings(cluster, machine, config)
+	k.reconcileTopLevelObjectSettings(cluster, machine, config)
+
+	if sans := config.Spec.ClusterConfiguration.APIServer.CertSANs; len(sans) != 1 || sans[0] != "api.example.com" {
+		t.Errorf("expected ClusterConfiguration.APIServer.CertSANs to only contain %q, got %v", "api.example.com", sans)
+	}
+	if endpoint := config.Spec.ClusterConfiguration.ControlPlaneEndpoint; endpoint != "10.0.0.1:6443" {
+		t.Errorf("expected nodes to keep using the cluster API endpoint, got %q", endpoint)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// kubeletServingApproverManifestPath is the path the manifest of the approver of the kubelet serving certificate
+// signing requests is written to.
+const kubeletServingApproverManifestPath = "/etc/kubernetes/kubelet-serving-approver/manifest.yaml"
+
+// applyKubeletServingCertificateToNodeRegistration makes the kubelet of the node registration bootstrap and rotate its
+// serving certificate. The argument is set on every node, as the KubeletConfiguration of kubeadm is shared by the
+// whole cluster.
+func applyKubeletServingCertificateToNodeRegistration(serving *bootstrapv1.KubeletServingCertificate, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions) {
+	if serving == nil {
+		return
+	}
+	if nodeRegistration.KubeletExtraArgs == nil {
+		nodeRegistration.KubeletExtraArgs = map[string]string{}
+	}
+	nodeRegistration.KubeletExtraArgs["rotate-server-certificates"] = "true"
+}
+
+// resolveKubeletServingApprover returns the file holding the manifest of the approver of the kubelet serving
+// certificate signing requests referenced by the config, looked up in the config namespace, and the command applying
+// it to the workload cluster with the admin kubeconfig.
+func (r *KubeadmConfigReconciler) resolveKubeletServingApprover(ctx context.Context, config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, error) {
+	serving := config.Spec.KubeletServingCertificate
+	if serving == nil || serving.ApproverManifestFrom == nil {
+		return nil, nil, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: config.Namespace, Name: serving.ApproverManifestFrom.Name}
+	if err := r.Get(ctx, key, cm); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get config map %s for kubelet serving certificate approver manifest", key)
+	}
+	manifest, ok := cm.Data[serving.ApproverManifestFrom.Key]
+	if !ok {
+		return nil, nil, errors.Errorf("config map %s does not contain key %q for kubelet serving certificate approver manifest", key, serving.ApproverManifestFrom.Key)
+	}
+	file := bootstrapv1.File{
+		Path:        kubeletServingApproverManifestPath,
+		Owner:       "root:root",
+		Permissions: "0600",
+		Content:     manifest,
+	}
+	return []bootstrapv1.File{file}, []string{adminKubectl + " apply -f " + cloudinit.ShellQuote(kubeletServingApproverManifestPath)}, nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestApplyKubeletServingCertificateToNodeRegistration(t *testing.T) {
+	nodeRegistration := &kubeadmv1beta1.NodeRegistrationOptions{}
+	applyKubeletServingCertificateToNodeRegistration(nil, nodeRegistration)
+	if nodeRegistration.KubeletExtraArgs != nil {
+		t.Errorf("expected no kubelet args, got %v", nodeRegistration.KubeletExtraArgs)
+	}
+
+	nodeRegistration.KubeletExtraArgs = map[string]string{"node-labels": "role=worker"}
+	applyKubeletServingCertificateToNodeRegistration(&bootstrapv1.KubeletServingCertificate{}, nodeRegistration)
+	expected := map[string]string{"node-labels": "role=worker", "rotate-server-certificates": "true"}
+	if !reflect.DeepEqual(nodeRegistration.KubeletExtraArgs, expected) {
+		t.Errorf("expected kubelet args %v, got %v", expected, nodeRegistration.KubeletExtraArgs)
+	}
+}
+
+func TestKubeadmConfigReconciler_ResolveKubeletServingApprover(t *testing.T) {
+	manifest := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "approver",
+		},
+		Data: map[string]string{"manifest.yaml": "kind: Deployment"},
+	}
+	k := &KubeadmConfigReconciler{
+		Log:    log.Log,
+		Client: newFakeClientWithScheme(setupScheme(), manifest),
+	}
+
+	config := newKubeadmConfig(nil, "cfg")
+	config.Spec.KubeletServingCertificate = &bootstrapv1.KubeletServingCertificate{}
+	if files, commands, err := k.resolveKubeletServingApprover(context.Background(), config); err != nil || files != nil || commands != nil {
+		t.Fatalf("expected no approver, got %v, %v, %v", files, commands, err)
+	}
+
+	config.Spec.KubeletServingCertificate.ApproverManifestFrom = &bootstrapv1.ConfigMapKeyReference{Name: "approver", Key: "manifest.yaml"}
+	files, commands, err := k.resolveKubeletServingApprover(context.Background(), config)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if len(files) != 1 || files[0].Path != kubeletServingApproverManifestPath || files[0].Content != "kind: Deployment" {
+		t.Errorf("expected the manifest of the config map, got %+v", files)
+	}
+	expected := []string{"kubectl --kubeconfig=/etc/kubernetes/admin.conf apply -f '/etc/kubernetes/kubelet-serving-approver/manifest.yaml'"}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected commands %v, got %v", expected, commands)
+	}
+
+	config.Spec.KubeletServingCertificate.ApproverManifestFrom.Key = "missing"
+	if _, _, err := k.resolveKubeletServingApprover(context.Background(), config); err == nil {
+		t.Error("expected an error for a missing config map key")
+	}
+}
@@ -0,0 +1,336 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	typedrbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+const (
+	// bootstrapFileSecretType is the type of the workload cluster secrets storing chunks of the files offloaded from
+	// bootstrap data.
+	bootstrapFileSecretType corev1.SecretType = "bootstrap.cluster.x-k8s.io/file-chunk"
+
+	// bootstrapFileSecretKey is the key of the chunk in the file chunk secrets.
+	bootstrapFileSecretKey = "content"
+
+	// maxFileChunkSize keeps file chunk secrets well below the size limit of secrets.
+	maxFileChunkSize = 512 * 1024
+
+	fetchFilesScriptName = "cabpk-fetch-files"
+)
+
+// offloadLargeFiles moves the largest additional files out of the user data until the size of the inline files fits
+// in the inline files size budget. The offloaded files are stored in chunks in secrets of the workload cluster,
+// readable with bootstrap tokens, and fetched by a script run before the other pre kubeadm commands.
+// Files can only be offloaded by machines joining with a bootstrap token.
+func (r *KubeadmConfigReconciler) offloadLargeFiles(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, joinConfiguration *kubeadmv1beta1.JoinConfiguration, certificates internalcluster.Certificates, userData *cloudinit.BaseUserData) error {
+	if r.InlineFilesSizeBudget <= 0 {
+		return nil
+	}
+
+	files := userData.AdditionalFiles
+	size := 0
+	for _, f := range files {
+		size += len(f.Content)
+	}
+	if size <= r.InlineFilesSizeBudget {
+		// the files of machines joining with a bootstrap token may have been offloaded by a previous render
+		if joinConfiguration != nil && joinConfiguration.Discovery.BootstrapToken != nil && joinConfiguration.Discovery.BootstrapToken.Token != "" {
+			return r.deleteStaleFileChunks(ctx, cluster, config, nil)
+		}
+		return nil
+	}
+
+	if joinConfiguration == nil || joinConfiguration.Discovery.BootstrapToken == nil || joinConfiguration.Discovery.BootstrapToken.Token == "" {
+		return errors.Errorf("files exceed the inline size budget of %d bytes, and can only be offloaded by machines joining with a bootstrap token", r.InlineFilesSizeBudget)
+	}
+	if config.Spec.OSFamily == bootstrapv1.Windows {
+		return errors.Errorf("files exceed the inline size budget of %d bytes, and cannot be offloaded by %s machines", r.InlineFilesSizeBudget, bootstrapv1.Windows)
+	}
+
+	// offload the largest files first, so that as few files as possible are fetched
+	order := make([]int, len(files))
+	for i := range files {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(files[order[i]].Content) > len(files[order[j]].Content)
+	})
+	offloaded := map[int]bool{}
+	for _, i := range order {
+		if size <= r.InlineFilesSizeBudget {
+			break
+		}
+		offloaded[i] = true
+		size -= len(files[i].Content)
+	}
+
+	secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+
+	var inline []bootstrapv1.File
+	var fetched []cloudinit.FetchedFile
+	var secretNames []string
+	for i, f := range files {
+		if !offloaded[i] {
+			inline = append(inline, f)
+			continue
+		}
+
+		fetchedFile := cloudinit.FetchedFile{File: f}
+		fetchedFile.Content = ""
+		for _, chunk := range chunkString(f.Content, maxFileChunkSize) {
+			name := fmt.Sprintf("cabpk-file-%s-%d", config.Name, len(secretNames))
+			if err := applyFileChunkSecret(secretsClient, cluster, config, name, chunk); err != nil {
+				return err
+			}
+			fetchedFile.Secrets = append(fetchedFile.Secrets, name)
+			secretNames = append(secretNames, name)
+		}
+		fetched = append(fetched, fetchedFile)
+	}
+
+	if err := r.ensureFileChunkRBAC(ctx, cluster, config, joinConfiguration.Discovery.BootstrapToken.Token, secretNames); err != nil {
+		return err
+	}
+	if err := r.deleteStaleFileChunks(ctx, cluster, config, secretNames); err != nil {
+		return err
+	}
+
+	script, err := cloudinit.NewFetchFilesScript(&cloudinit.FetchFilesInput{
+		APIServerEndpoint: joinConfiguration.Discovery.BootstrapToken.APIServerEndpoint,
+		CACert:            string(certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair.Cert),
+		Token:             joinConfiguration.Discovery.BootstrapToken.Token,
+		Namespace:         metav1.NamespaceSystem,
+		SecretKey:         bootstrapFileSecretKey,
+		Files:             fetched,
+	})
+	if err != nil {
+		return err
+	}
+
+	fetchFilesScriptPath := scriptPath(config, fetchFilesScriptName)
+	userData.AdditionalFiles = append(inline, bootstrapv1.File{
+		Path:        fetchFilesScriptPath,
+		Owner:       "root:root",
+		Permissions: "0700",
+		Content:     string(script),
+	})
+	userData.PreKubeadmCommands = append([]string{fetchFilesScriptPath}, userData.PreKubeadmCommands...)
+	return nil
+}
+
+// applyFileChunkSecret creates or updates the workload cluster secret storing a file chunk.
+func applyFileChunkSecret(client typedcorev1.SecretInterface, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, name, chunk string) error {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: metav1.NamespaceSystem,
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: cluster.Name,
+				TokenConfigLabelName:              config.Name,
+			},
+		},
+		Type: bootstrapFileSecretType,
+		Data: map[string][]byte{
+			bootstrapFileSecretKey: []byte(chunk),
+		},
+	}
+	if _, err := client.Create(s); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "failed to create file chunk secret %s", name)
+		}
+		if _, err := client.Update(s); err != nil {
+			return errors.Wrapf(err, "failed to update file chunk secret %s", name)
+		}
+	}
+	return nil
+}
+
+// deleteStaleFileChunks deletes the file chunk secrets of the config that were not written by the last render, e.g.
+// when the files shrank to fewer chunks or fit in the budget again, and its Role if no chunk is left.
+func (r *KubeadmConfigReconciler) deleteStaleFileChunks(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, keep []string) error {
+	secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+	rbacClient, err := r.RBACClientFactory.NewRBACClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+	return deleteFileChunks(secretsClient, rbacClient, cluster, config.Name, keep)
+}
+
+// deleteFileChunks deletes the file chunk secrets of the named config that are not kept, and the Role allowing its
+// bootstrap token to read them once no chunk is kept.
+func deleteFileChunks(secretsClient typedcorev1.SecretInterface, rbacClient typedrbacv1.RbacV1Interface, cluster *clusterv1.Cluster, configName string, keep []string) error {
+	secrets, err := secretsClient.List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			clusterv1.MachineClusterLabelName: cluster.Name,
+			TokenConfigLabelName:              configName,
+		}).String(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list file chunk secrets of KubeadmConfig %s", configName)
+	}
+	kept := map[string]bool{}
+	for _, name := range keep {
+		kept[name] = true
+	}
+	for i := range secrets.Items {
+		s := &secrets.Items[i]
+		if s.Type != bootstrapFileSecretType || kept[s.Name] {
+			continue
+		}
+		if err := secretsClient.Delete(s.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete file chunk secret %s", s.Name)
+		}
+	}
+	if len(keep) > 0 {
+		return nil
+	}
+	return deleteRole(rbacClient, fileChunkRoleName(configName))
+}
+
+// fileChunkRoleName returns the name of the Role allowing the bootstrap token of the named config to read its file
+// chunk secrets.
+func fileChunkRoleName(configName string) string {
+	return "cabpk:bootstrap-files:" + configName
+}
+
+// ensureFileChunkRBAC allows the bootstrap token of the config to read its file chunk secrets.
+func (r *KubeadmConfigReconciler) ensureFileChunkRBAC(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, token string, secretNames []string) error {
+	return r.ensureBootstrapTokenRole(ctx, cluster, fileChunkRoleName(config.Name), token, []rbacv1.PolicyRule{
+		{
+			Verbs:         []string{"get"},
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: secretNames,
+		},
+	})
+}
+
+// ensureBootstrapTokenRole creates or updates a Role of the kube-system namespace of the workload cluster with the
+// given rules, and binds it to the user of the bootstrap token, so that the tokens of other configs cannot use it.
+func (r *KubeadmConfigReconciler) ensureBootstrapTokenRole(ctx context.Context, cluster *clusterv1.Cluster, name, token string, rules []rbacv1.PolicyRule) error {
+	tokenID := strings.SplitN(token, ".", 2)[0]
+	return r.ensureRole(ctx, cluster, name, rules, rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: bootstrapapi.BootstrapUserPrefix + tokenID})
+}
+
+// ensureRole creates or updates a Role of the kube-system namespace of the workload cluster with the given rules, and
+// binds it to the subject.
+func (r *KubeadmConfigReconciler) ensureRole(ctx context.Context, cluster *clusterv1.Cluster, name string, rules []rbacv1.PolicyRule, subject rbacv1.Subject) error {
+	rbacClient, err := r.RBACClientFactory.NewRBACClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+	return applyRole(rbacClient, name, rules, subject)
+}
+
+// applyRole creates or updates a Role of the kube-system namespace with the given rules, and binds it to the subject.
+// The subject of an existing binding is replaced, e.g. when the bootstrap token of a config was regenerated.
+func applyRole(rbacClient typedrbacv1.RbacV1Interface, name string, rules []rbacv1.PolicyRule, subject rbacv1.Subject) error {
+	role, err := rbacClient.Roles(metav1.NamespaceSystem).Get(name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		role = &rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceSystem},
+			Rules:      rules,
+		}
+		if _, err := rbacClient.Roles(metav1.NamespaceSystem).Create(role); err != nil {
+			return errors.Wrapf(err, "failed to create Role %q", name)
+		}
+	case err != nil:
+		return errors.Wrapf(err, "failed to get Role %q", name)
+	default:
+		role.Rules = rules
+		if _, err := rbacClient.Roles(metav1.NamespaceSystem).Update(role); err != nil {
+			return errors.Wrapf(err, "failed to update Role %q", name)
+		}
+	}
+
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceSystem},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     name,
+		},
+		Subjects: []rbacv1.Subject{subject},
+	}
+	_, err = rbacClient.RoleBindings(metav1.NamespaceSystem).Create(roleBinding)
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "failed to create RoleBinding %q", name)
+	}
+	existing, err := rbacClient.RoleBindings(metav1.NamespaceSystem).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get RoleBinding %q", name)
+	}
+	if len(existing.Subjects) == 1 && existing.Subjects[0] == subject {
+		return nil
+	}
+	existing.Subjects = roleBinding.Subjects
+	if _, err := rbacClient.RoleBindings(metav1.NamespaceSystem).Update(existing); err != nil {
+		return errors.Wrapf(err, "failed to update RoleBinding %q", name)
+	}
+	return nil
+}
+
+// deleteRole deletes a Role of the kube-system namespace and its RoleBinding, if they exist.
+func deleteRole(rbacClient typedrbacv1.RbacV1Interface, name string) error {
+	if err := rbacClient.RoleBindings(metav1.NamespaceSystem).Delete(name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete RoleBinding %q", name)
+	}
+	if err := rbacClient.Roles(metav1.NamespaceSystem).Delete(name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete Role %q", name)
+	}
+	return nil
+}
+
+// chunkString splits the string in chunks of at most size bytes.
+func chunkString(s string, size int) []string {
+	var chunks []string
+	for len(s) > size {
+		chunks = append(chunks, s[:size])
+		s = s[size:]
+	}
+	return append(chunks, s)
+}
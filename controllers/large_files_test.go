@@ -0,0 +1,211 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	typedrbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+type fakeRBACFactory struct {
+	client typedrbacv1.RbacV1Interface
+}
+
+func (f fakeRBACFactory) NewRBACClient(context.Context, client.Client, *clusterv1.Cluster) (typedrbacv1.RbacV1Interface, error) {
+	return f.client, nil
+}
+
+func TestOffloadLargeFiles(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := &bootstrapv1.KubeadmConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"}}
+	certificates := internalcluster.Certificates{
+		&internalcluster.Certificate{Purpose: internalcluster.ClusterCA, KeyPair: &certs.KeyPair{Cert: []byte("ca-cert")}},
+	}
+	joinConfiguration := &kubeadmv1beta1.JoinConfiguration{
+		Discovery: kubeadmv1beta1.Discovery{
+			BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{
+				APIServerEndpoint: "10.0.0.1:6443",
+				Token:             "abcdef.0123456789abcdef",
+			},
+		},
+	}
+	newUserData := func() cloudinit.BaseUserData {
+		return cloudinit.BaseUserData{
+			AdditionalFiles: []bootstrapv1.File{
+				{Path: "/etc/small", Content: "small"},
+				{Path: "/opt/bin/large", Content: strings.Repeat("a", maxFileChunkSize+10), Permissions: "0755"},
+				{Path: "/etc/medium", Content: strings.Repeat("b", 100)},
+			},
+			PreKubeadmCommands: []string{"echo pre"},
+		}
+	}
+
+	t.Run("files fitting in the budget are kept inline", func(t *testing.T) {
+		clientset := fakeclient.NewSimpleClientset()
+		k := &KubeadmConfigReconciler{
+			Log:                   log.Log,
+			SecretsClientFactory:  FakeSecretFactory{client: clientset.CoreV1().Secrets(metav1.NamespaceSystem)},
+			RBACClientFactory:     fakeRBACFactory{client: clientset.RbacV1()},
+			InlineFilesSizeBudget: 2 * maxFileChunkSize,
+		}
+		userData := newUserData()
+		if err := k.offloadLargeFiles(context.Background(), cluster, config, joinConfiguration, certificates, &userData); err != nil {
+			t.Fatalf("expected nil, got error %v", err)
+		}
+		if len(userData.AdditionalFiles) != 3 || len(userData.PreKubeadmCommands) != 1 {
+			t.Fatalf("expected the user data not to change, got %+v", userData)
+		}
+	})
+
+	t.Run("the largest files are offloaded", func(t *testing.T) {
+		clientset := fakeclient.NewSimpleClientset()
+		secretsFactory := FakeSecretFactory{client: clientset.CoreV1().Secrets(metav1.NamespaceSystem)}
+		k := &KubeadmConfigReconciler{
+			Log:                   log.Log,
+			SecretsClientFactory:  secretsFactory,
+			RBACClientFactory:     fakeRBACFactory{client: clientset.RbacV1()},
+			InlineFilesSizeBudget: 200,
+		}
+
+		// offload twice to verify the operation is idempotent
+		var userData cloudinit.BaseUserData
+		for i := 0; i < 2; i++ {
+			userData = newUserData()
+			if err := k.offloadLargeFiles(context.Background(), cluster, config, joinConfiguration, certificates, &userData); err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+		}
+
+		paths := []string{}
+		for _, f := range userData.AdditionalFiles {
+			paths = append(paths, f.Path)
+		}
+		if strings.Join(paths, ",") != "/etc/small,/etc/medium,/usr/local/bin/cabpk-fetch-files" {
+			t.Fatalf("expected the large file to be replaced by the fetch script, got %v", paths)
+		}
+		if userData.PreKubeadmCommands[0] != "/usr/local/bin/cabpk-fetch-files" {
+			t.Errorf("expected the fetch script to run first, got %v", userData.PreKubeadmCommands)
+		}
+		script := userData.AdditionalFiles[2].Content
+		for _, s := range []string{"fetch 'cabpk-file-config-0'", "fetch 'cabpk-file-config-1'", "chmod '0755' '/opt/bin/large'", "--token='abcdef.0123456789abcdef'"} {
+			if !strings.Contains(script, s) {
+				t.Errorf("expected the fetch script to contain %q, got:\n%s", s, script)
+			}
+		}
+
+		content := ""
+		for _, name := range []string{"cabpk-file-config-0", "cabpk-file-config-1"} {
+			s, err := secretsFactory.client.Get(name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected file chunk secret %s to exist: %v", name, err)
+			}
+			if s.Type != bootstrapFileSecretType || s.Labels[TokenConfigLabelName] != config.Name {
+				t.Errorf("unexpected file chunk secret %+v", s.ObjectMeta)
+			}
+			content += string(s.Data[bootstrapFileSecretKey])
+		}
+		if content != newUserData().AdditionalFiles[1].Content {
+			t.Error("expected the file chunks to hold the file content")
+		}
+
+		role, err := clientset.RbacV1().Roles(metav1.NamespaceSystem).Get("cabpk:bootstrap-files:config", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected the Role to exist: %v", err)
+		}
+		if len(role.Rules) != 1 || strings.Join(role.Rules[0].ResourceNames, ",") != "cabpk-file-config-0,cabpk-file-config-1" {
+			t.Errorf("expected the Role to allow reading the file chunks, got %+v", role.Rules)
+		}
+		binding, err := clientset.RbacV1().RoleBindings(metav1.NamespaceSystem).Get("cabpk:bootstrap-files:config", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected the RoleBinding to exist: %v", err)
+		}
+		if len(binding.Subjects) != 1 || binding.Subjects[0].Kind != rbacv1.UserKind || binding.Subjects[0].Name != "system:bootstrap:abcdef" {
+			t.Errorf("expected the Role to be bound to the bootstrap token of the config, got %+v", binding.Subjects)
+		}
+
+		// a regenerated bootstrap token replaces the subject of the binding
+		regenerated := joinConfiguration.DeepCopy()
+		regenerated.Discovery.BootstrapToken.Token = "ghijkl.0123456789abcdef"
+		userData = newUserData()
+		if err := k.offloadLargeFiles(context.Background(), cluster, config, regenerated, certificates, &userData); err != nil {
+			t.Fatalf("expected nil, got error %v", err)
+		}
+		binding, err = clientset.RbacV1().RoleBindings(metav1.NamespaceSystem).Get("cabpk:bootstrap-files:config", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(binding.Subjects) != 1 || binding.Subjects[0].Name != "system:bootstrap:ghijkl" {
+			t.Errorf("expected the Role to be bound to the regenerated bootstrap token, got %+v", binding.Subjects)
+		}
+
+		// files shrinking to fewer chunks leave no stale chunk
+		userData = newUserData()
+		userData.AdditionalFiles[1].Content = strings.Repeat("a", 300)
+		if err := k.offloadLargeFiles(context.Background(), cluster, config, regenerated, certificates, &userData); err != nil {
+			t.Fatalf("expected nil, got error %v", err)
+		}
+		if _, err := secretsFactory.client.Get("cabpk-file-config-0", metav1.GetOptions{}); err != nil {
+			t.Errorf("expected file chunk secret cabpk-file-config-0 to exist: %v", err)
+		}
+		if _, err := secretsFactory.client.Get("cabpk-file-config-1", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected the stale file chunk secret cabpk-file-config-1 to be deleted, got %v", err)
+		}
+
+		// files fitting in the budget again leave no chunk nor Role
+		userData = newUserData()
+		userData.AdditionalFiles[1].Content = "large no more"
+		if err := k.offloadLargeFiles(context.Background(), cluster, config, regenerated, certificates, &userData); err != nil {
+			t.Fatalf("expected nil, got error %v", err)
+		}
+		secrets, err := secretsFactory.client.List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(secrets.Items) != 0 {
+			t.Errorf("expected the file chunk secrets to be deleted, got %d", len(secrets.Items))
+		}
+		if _, err := clientset.RbacV1().Roles(metav1.NamespaceSystem).Get("cabpk:bootstrap-files:config", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected the Role to be deleted, got %v", err)
+		}
+		if _, err := clientset.RbacV1().RoleBindings(metav1.NamespaceSystem).Get("cabpk:bootstrap-files:config", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected the RoleBinding to be deleted, got %v", err)
+		}
+	})
+
+	t.Run("files cannot be offloaded without a bootstrap token", func(t *testing.T) {
+		k := &KubeadmConfigReconciler{Log: log.Log, InlineFilesSizeBudget: 200}
+		userData := newUserData()
+		if err := k.offloadLargeFiles(context.Background(), cluster, config, nil, certificates, &userData); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net"
+
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+// defaultAdvertiseAddress sets the advertise address of the local API endpoint of a control plane machine to the first
+// internal IP address of the Machine, so that kubeadm does not pick the address of the default route on multi-homed
+// hosts. The endpoint is left unset while the Machine has no internal IP address, and when the advertise-address
+// argument of the API server is set.
+func defaultAdvertiseAddress(machine *clusterv1.Machine, apiServerArgs map[string]string, endpoint *kubeadmv1beta1.APIEndpoint) {
+	if endpoint.AdvertiseAddress != "" {
+		return
+	}
+	if _, ok := apiServerArgs["advertise-address"]; ok {
+		return
+	}
+	for _, address := range machine.Status.Addresses {
+		if address.Type == clusterv1.MachineInternalIP && net.ParseIP(address.Address) != nil {
+			endpoint.AdvertiseAddress = address.Address
+			return
+		}
+	}
+}
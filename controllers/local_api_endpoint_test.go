@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+func TestDefaultAdvertiseAddress(t *testing.T) {
+	addresses := []clusterv1.MachineAddress{
+		{Type: clusterv1.MachineExternalIP, Address: "203.0.113.10"},
+		{Type: clusterv1.MachineInternalIP, Address: "10.0.0.10"},
+		{Type: clusterv1.MachineInternalIP, Address: "192.168.0.10"},
+	}
+	testcases := []struct {
+		name            string
+		addresses       []clusterv1.MachineAddress
+		apiServerArgs   map[string]string
+		advertise       string
+		expectedAddress string
+	}{
+		{
+			name: "the address is left unset while the Machine has no address",
+		},
+		{
+			name:            "the first internal IP address of the Machine is used",
+			addresses:       addresses,
+			expectedAddress: "10.0.0.10",
+		},
+		{
+			name:            "the address of the user is kept",
+			addresses:       addresses,
+			advertise:       "192.168.0.10",
+			expectedAddress: "192.168.0.10",
+		},
+		{
+			name:          "the advertise-address argument of the user is kept",
+			addresses:     addresses,
+			apiServerArgs: map[string]string{"advertise-address": "192.168.0.10"},
+		},
+		{
+			name:      "invalid addresses are ignored",
+			addresses: []clusterv1.MachineAddress{{Type: clusterv1.MachineInternalIP, Address: "ip-10-0-0-10"}},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			machine := newControlPlaneMachine(newCluster("cluster"), "control-plane-machine")
+			machine.Status.Addresses = tc.addresses
+			endpoint := &kubeadmv1beta1.APIEndpoint{AdvertiseAddress: tc.advertise}
+			defaultAdvertiseAddress(machine, tc.apiServerArgs, endpoint)
+			if endpoint.AdvertiseAddress != tc.expectedAddress {
+				t.Errorf("expected the advertise address %q, got %q", tc.expectedAddress, endpoint.AdvertiseAddress)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+// manualDiscovery returns true if the discovery settings of the join configuration of the config are managed by
+// external tooling and must be left untouched.
+func manualDiscovery(config *bootstrapv1.KubeadmConfig) bool {
+	return config.Spec.Discovery != nil && config.Spec.Discovery.Manual
+}
+
+// validateManualDiscovery returns an error if the join configuration of a config using manual discovery does not
+// define complete discovery settings, or if the config enables a feature which relies on CABPK managing them.
+func validateManualDiscovery(config *bootstrapv1.KubeadmConfig) error {
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"nodeClientCertificate", config.Spec.NodeClientCertificate},
+		{"ensureBootstrapTokenRBAC", config.Spec.EnsureBootstrapTokenRBAC},
+		{"clusterInfoCheck", config.Spec.ClusterInfoCheck != ""},
+		{"apiServerCheck", config.Spec.APIServerCheck != ""},
+		{"apiServerEndpointDNS", config.Spec.APIServerEndpointDNS != nil},
+		{"tokenBackend", config.Spec.TokenBackend != ""},
+	} {
+		if setting.set {
+			return errors.Errorf("%s is not supported with manual discovery", setting.name)
+		}
+	}
+
+	discovery := config.Spec.JoinConfiguration.Discovery
+	if discovery.File != nil {
+		if discovery.File.KubeConfigPath == "" {
+			return errors.New("manual discovery requires JoinConfiguration.Discovery.File.KubeConfigPath")
+		}
+		return nil
+	}
+
+	token := discovery.BootstrapToken
+	if token == nil {
+		return errors.New("manual discovery requires JoinConfiguration.Discovery.BootstrapToken or JoinConfiguration.Discovery.File")
+	}
+	if token.TokenFrom != nil {
+		return errors.New("JoinConfiguration.Discovery.BootstrapToken.TokenFrom is not supported with manual discovery")
+	}
+	if token.APIServerEndpoint == "" {
+		return errors.New("manual discovery requires JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint")
+	}
+	if token.Token == "" {
+		return errors.New("manual discovery requires JoinConfiguration.Discovery.BootstrapToken.Token")
+	}
+	if err := validateBootstrapToken(token.Token); err != nil {
+		return errors.Wrap(err, "invalid JoinConfiguration.Discovery.BootstrapToken.Token")
+	}
+	if len(token.CACertHashes) == 0 && !token.UnsafeSkipCAVerification {
+		return errors.New("manual discovery requires JoinConfiguration.Discovery.BootstrapToken.CACertHashes or UnsafeSkipCAVerification")
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func newManualDiscoveryConfig(discovery kubeadmv1beta1.Discovery) *bootstrapv1.KubeadmConfig {
+	return &bootstrapv1.KubeadmConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"},
+		Spec: bootstrapv1.KubeadmConfigSpec{
+			Discovery:         &bootstrapv1.DiscoveryPolicy{Manual: true},
+			JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{Discovery: discovery},
+		},
+	}
+}
+
+func TestValidateManualDiscovery(t *testing.T) {
+	complete := func() *kubeadmv1beta1.BootstrapTokenDiscovery {
+		return &kubeadmv1beta1.BootstrapTokenDiscovery{
+			APIServerEndpoint: "lb.example.com:6443",
+			Token:             "abcdef.0123456789abcdef",
+			CACertHashes:      []string{"sha256:abc"},
+		}
+	}
+
+	withRBAC := newManualDiscoveryConfig(kubeadmv1beta1.Discovery{BootstrapToken: complete()})
+	withRBAC.Spec.EnsureBootstrapTokenRBAC = true
+
+	noEndpoint := complete()
+	noEndpoint.APIServerEndpoint = ""
+	noToken := complete()
+	noToken.Token = ""
+	invalidToken := complete()
+	invalidToken.Token = "not-a-token"
+	tokenFrom := complete()
+	tokenFrom.Token = ""
+	tokenFrom.TokenFrom = &kubeadmv1beta1.BootstrapTokenSource{}
+	noHashes := complete()
+	noHashes.CACertHashes = nil
+	skipVerification := complete()
+	skipVerification.CACertHashes = nil
+	skipVerification.UnsafeSkipCAVerification = true
+
+	testcases := []struct {
+		name      string
+		config    *bootstrapv1.KubeadmConfig
+		expectErr bool
+	}{
+		{
+			name:   "accept complete bootstrap token discovery",
+			config: newManualDiscoveryConfig(kubeadmv1beta1.Discovery{BootstrapToken: complete()}),
+		},
+		{
+			name:   "accept an explicit skip of the CA verification",
+			config: newManualDiscoveryConfig(kubeadmv1beta1.Discovery{BootstrapToken: skipVerification}),
+		},
+		{
+			name:   "accept file discovery",
+			config: newManualDiscoveryConfig(kubeadmv1beta1.Discovery{File: &kubeadmv1beta1.FileDiscovery{KubeConfigPath: "/etc/kubernetes/discovery.conf"}}),
+		},
+		{
+			name:      "fail without kubeconfig path",
+			config:    newManualDiscoveryConfig(kubeadmv1beta1.Discovery{File: &kubeadmv1beta1.FileDiscovery{}}),
+			expectErr: true,
+		},
+		{
+			name:      "fail without discovery",
+			config:    newManualDiscoveryConfig(kubeadmv1beta1.Discovery{}),
+			expectErr: true,
+		},
+		{
+			name:      "fail without API server endpoint",
+			config:    newManualDiscoveryConfig(kubeadmv1beta1.Discovery{BootstrapToken: noEndpoint}),
+			expectErr: true,
+		},
+		{
+			name:      "fail without token",
+			config:    newManualDiscoveryConfig(kubeadmv1beta1.Discovery{BootstrapToken: noToken}),
+			expectErr: true,
+		},
+		{
+			name:      "fail with an invalid token",
+			config:    newManualDiscoveryConfig(kubeadmv1beta1.Discovery{BootstrapToken: invalidToken}),
+			expectErr: true,
+		},
+		{
+			name:      "fail with tokenFrom",
+			config:    newManualDiscoveryConfig(kubeadmv1beta1.Discovery{BootstrapToken: tokenFrom}),
+			expectErr: true,
+		},
+		{
+			name:      "fail without CA cert hashes",
+			config:    newManualDiscoveryConfig(kubeadmv1beta1.Discovery{BootstrapToken: noHashes}),
+			expectErr: true,
+		},
+		{
+			name:      "fail with features managing discovery",
+			config:    withRBAC,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateManualDiscovery(tc.config)
+			if tc.expectErr && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+		})
+	}
+}
+
+func TestReconcileDiscoveryManual(t *testing.T) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+		Status: clusterv1.ClusterStatus{
+			APIEndpoints: []clusterv1.APIEndpoint{{Host: "example.com", Port: 6443}},
+		},
+	}
+	config := newManualDiscoveryConfig(kubeadmv1beta1.Discovery{
+		BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{
+			APIServerEndpoint:        "lb.example.com:6443",
+			Token:                    "abcdef.0123456789abcdef",
+			UnsafeSkipCAVerification: true,
+		},
+	})
+	expected := config.Spec.JoinConfiguration.DeepCopy()
+
+	secretFactory := newFakeSecretFactory()
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               newFakeClientWithScheme(setupScheme()),
+		SecretsClientFactory: secretFactory,
+	}
+
+	if err := k.reconcileDiscovery(context.Background(), cluster, config, internalcluster.Certificates{}, nil); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if !reflect.DeepEqual(config.Spec.JoinConfiguration, expected) {
+		t.Errorf("expected the join configuration to be left untouched, got %+v", config.Spec.JoinConfiguration.Discovery.BootstrapToken)
+	}
+	if _, err := secretFactory.client.Get("bootstrap-token-abcdef", metav1.GetOptions{}); err == nil {
+		t.Error("expected no token secret to be created in the workload cluster")
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/patch"
+)
+
+const (
+	// NodeAgentRevisionAnnotation is set by the node agent on its node to the revision of the last update it applied.
+	NodeAgentRevisionAnnotation = "bootstrap.cluster.x-k8s.io/node-agent-revision"
+
+	// nodeAgentSecretType is the type of the workload cluster secrets the node agent reads its updates from.
+	nodeAgentSecretType corev1.SecretType = "bootstrap.cluster.x-k8s.io/node-agent"
+
+	// defaultNodeAgentIntervalSeconds is the interval the node agent checks for updates at by default.
+	defaultNodeAgentIntervalSeconds = 60
+
+	nodeAgentScriptName  = "cabpk-node-agent"
+	nodeAgentServiceName = "cabpk-node-agent.service"
+	nodeAgentTimerName   = "cabpk-node-agent.timer"
+
+	nodeAgentService = `[Unit]
+Description=Apply the node configuration updates of the management cluster
+After=kubelet.service
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`
+
+	nodeAgentTimer = `[Unit]
+Description=Check for node configuration updates of the management cluster
+
+[Timer]
+OnBootSec=%[1]ds
+OnUnitActiveSec=%[1]ds
+
+[Install]
+WantedBy=timers.target
+`
+)
+
+// nodeAgentSecretName returns the name of the workload cluster secret the node agent of the config reads its updates
+// from.
+func nodeAgentSecretName(config *bootstrapv1.KubeadmConfig) string {
+	return "cabpk-node-agent-" + config.Name
+}
+
+// nodeAgentFiles returns the script, service and timer of the node agent of the config, along with the commands to be
+// run after kubeadm to start the timer. The files and commands of the agent are not part of the bootstrap data: they
+// are published to the workload cluster once the node has joined.
+func nodeAgentFiles(config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, error) {
+	agent := config.Spec.NodeAgent
+	if agent == nil {
+		return nil, nil, nil
+	}
+
+	interval := agent.IntervalSeconds
+	if interval == 0 {
+		interval = defaultNodeAgentIntervalSeconds
+	}
+	if interval < 10 {
+		return nil, nil, errors.Errorf("invalid node agent interval %ds, must be at least 10s", interval)
+	}
+
+	script, err := cloudinit.NewNodeAgentScript(&cloudinit.NodeAgentInput{
+		Namespace:          metav1.NamespaceSystem,
+		SecretName:         nodeAgentSecretName(config),
+		RevisionAnnotation: NodeAgentRevisionAnnotation,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := []bootstrapv1.File{
+		{
+			Path:        scriptPath(config, nodeAgentScriptName),
+			Owner:       "root:root",
+			Permissions: "0700",
+			Content:     string(script),
+		},
+		{
+			Path:        path.Join(systemdUnitDir, nodeAgentServiceName),
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     fmt.Sprintf(nodeAgentService, scriptPath(config, nodeAgentScriptName)),
+		},
+		{
+			Path:        path.Join(systemdUnitDir, nodeAgentTimerName),
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     fmt.Sprintf(nodeAgentTimer, interval),
+		},
+	}
+	return files, []string{"systemctl daemon-reload", "systemctl enable --now " + nodeAgentTimerName}, nil
+}
+
+// nodeAgentUpdate returns the update script of the node agent of the config and its revision.
+func nodeAgentUpdate(agent *bootstrapv1.NodeAgent) ([]byte, string, error) {
+	for _, f := range agent.Files {
+		if !path.IsAbs(f.Path) {
+			return nil, "", errors.Errorf("invalid node agent file path %q, must be absolute", f.Path)
+		}
+	}
+
+	script, err := cloudinit.NewNodeAgentUpdateScript(&cloudinit.NodeAgentUpdateInput{
+		Files:    agent.Files,
+		Commands: agent.Commands,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(script)
+	return script, hex.EncodeToString(sum[:]), nil
+}
+
+// reconcileNodeAgent publishes the files and commands of the node agent of the config to the workload cluster once
+// the node of the machine has joined, and whenever they change. The update is stored in a kube-system secret only
+// readable by the node, through a Role bound to its kubelet user, and its revision is recorded in the status of the
+// config.
+func (r *KubeadmConfigReconciler) reconcileNodeAgent(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, machine *clusterv1.Machine) error {
+	if config.Spec.NodeAgent == nil || machine.Status.NodeRef == nil {
+		return nil
+	}
+
+	script, revision, err := nodeAgentUpdate(config.Spec.NodeAgent)
+	if err != nil {
+		return err
+	}
+	if revision == config.Status.NodeAgentRevision {
+		return nil
+	}
+
+	nodeName := machine.Status.NodeRef.Name
+	secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+	name := nodeAgentSecretName(config)
+	data := map[string][]byte{
+		cloudinit.NodeAgentRevisionKey: []byte(revision),
+		cloudinit.NodeAgentScriptKey:   script,
+		cloudinit.NodeAgentNodeKey:     []byte(nodeName),
+	}
+	s, err := secretsClient.Get(name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		s = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: metav1.NamespaceSystem,
+				Labels: map[string]string{
+					clusterv1.MachineClusterLabelName: cluster.Name,
+					TokenConfigLabelName:              config.Name,
+				},
+			},
+			Type: nodeAgentSecretType,
+			Data: data,
+		}
+		if _, err := secretsClient.Create(s); err != nil {
+			return errors.Wrapf(err, "failed to create node agent secret %s", name)
+		}
+	case err != nil:
+		return errors.Wrapf(err, "failed to get node agent secret %s", name)
+	default:
+		s.Data = data
+		if _, err := secretsClient.Update(s); err != nil {
+			return errors.Wrapf(err, "failed to update node agent secret %s", name)
+		}
+	}
+
+	if err := r.ensureRole(ctx, cluster, "cabpk:node-agent:"+config.Name, []rbacv1.PolicyRule{
+		{
+			Verbs:         []string{"get"},
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: []string{name},
+		},
+	}, rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: "system:node:" + nodeName}); err != nil {
+		return err
+	}
+
+	patchHelper, err := patch.NewHelper(config, r)
+	if err != nil {
+		return err
+	}
+	config.Status.NodeAgentRevision = revision
+	if err := patchHelper.Patch(ctx, config); err != nil {
+		return err
+	}
+	r.Log.Info("Published node agent update", "kubeadmconfig", config.Namespace+"/"+config.Name, "revision", revision)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(config, corev1.EventTypeNormal, NodeAgentUpdatePublishedReason, "Published node agent update %s to node %s", revision, nodeName)
+	}
+	return nil
+}
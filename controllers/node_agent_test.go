@@ -0,0 +1,190 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestNodeAgentFiles(t *testing.T) {
+	config := newKubeadmConfig(nil, "worker-join-cfg")
+	if files, commands, err := nodeAgentFiles(config); err != nil || files != nil || commands != nil {
+		t.Fatalf("expected no node agent, got %v, %v, %v", files, commands, err)
+	}
+
+	config.Spec.NodeAgent = &bootstrapv1.NodeAgent{Files: []bootstrapv1.File{{Path: "/etc/motd", Content: "hello"}}}
+	files, commands, err := nodeAgentFiles(config)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if len(files) != 3 || files[0].Path != "/usr/local/bin/cabpk-node-agent" || files[0].Permissions != "0700" {
+		t.Fatalf("expected the node agent script, service and timer, got %+v", files)
+	}
+	if !strings.Contains(files[0].Content, "get secret 'cabpk-node-agent-worker-join-cfg'") {
+		t.Errorf("expected the agent to read its secret, got:\n%s", files[0].Content)
+	}
+	if strings.Contains(files[0].Content, "hello") {
+		t.Error("expected the files of the agent not to be part of the bootstrap data")
+	}
+	if !strings.Contains(files[2].Content, "OnUnitActiveSec=60s") {
+		t.Errorf("expected the timer to run every 60s by default, got:\n%s", files[2].Content)
+	}
+	if len(commands) != 2 || commands[1] != "systemctl enable --now "+nodeAgentTimerName {
+		t.Errorf("expected the timer to be started, got %v", commands)
+	}
+
+	config.Spec.NodeAgent.IntervalSeconds = 5
+	if _, _, err := nodeAgentFiles(config); err == nil {
+		t.Error("expected an interval below 10s to be rejected")
+	}
+}
+
+func TestNodeAgentUpdate(t *testing.T) {
+	agent := &bootstrapv1.NodeAgent{
+		Files: []bootstrapv1.File{
+			{Path: "/etc/containerd/certs.d/docker.io/hosts.toml", Owner: "root:root", Permissions: "0644", Content: "server = 'https://mirror'"},
+			{Path: "/etc/kubernetes/extra.conf", Encoding: bootstrapv1.Base64, Content: "aGVsbG8="},
+		},
+		Commands: []string{"systemctl restart containerd"},
+	}
+	script, revision, err := nodeAgentUpdate(agent)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	for _, s := range []string{
+		"mv '/etc/containerd/certs.d/docker.io/hosts.toml'.cabpk-tmp '/etc/containerd/certs.d/docker.io/hosts.toml'",
+		"chmod '0644' '/etc/containerd/certs.d/docker.io/hosts.toml'.cabpk-tmp",
+		"base64 -d | base64 -d > '/etc/kubernetes/extra.conf'.cabpk-tmp",
+		"\nsystemctl restart containerd\n",
+	} {
+		if !strings.Contains(string(script), s) {
+			t.Errorf("expected the update script to contain %q, got:\n%s", s, script)
+		}
+	}
+
+	agent.Commands = append(agent.Commands, "systemctl restart kubelet")
+	if _, changed, _ := nodeAgentUpdate(agent); changed == revision {
+		t.Error("expected the revision to change with the commands")
+	}
+
+	agent.Files[0].Path = "relative"
+	if _, _, err := nodeAgentUpdate(agent); err == nil {
+		t.Error("expected a relative path to be rejected")
+	}
+}
+
+func TestReconcileNodeAgent(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newWorkerMachine(cluster)
+	config := newKubeadmConfig(machine, "worker-join-cfg")
+	config.Spec.NodeAgent = &bootstrapv1.NodeAgent{Commands: []string{"systemctl restart kubelet"}}
+
+	clientset := fakeclient.NewSimpleClientset()
+	recorder := record.NewFakeRecorder(10)
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               newFakeClientWithScheme(setupScheme(), config),
+		Recorder:             recorder,
+		SecretsClientFactory: FakeSecretFactory{client: clientset.CoreV1().Secrets(metav1.NamespaceSystem)},
+		RBACClientFactory:    fakeRBACFactory{client: clientset.RbacV1()},
+	}
+
+	// nothing is published until the node has joined
+	if err := k.reconcileNodeAgent(context.Background(), cluster, config, machine); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if config.Status.NodeAgentRevision != "" {
+		t.Fatalf("expected no update to be published before the node joined, got revision %s", config.Status.NodeAgentRevision)
+	}
+
+	machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: "worker-0"}
+	if err := k.reconcileNodeAgent(context.Background(), cluster, config, machine); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	s, err := clientset.CoreV1().Secrets(metav1.NamespaceSystem).Get("cabpk-node-agent-worker-join-cfg", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the node agent secret to exist: %v", err)
+	}
+	if revision := string(s.Data[cloudinit.NodeAgentRevisionKey]); revision == "" || revision != config.Status.NodeAgentRevision {
+		t.Errorf("expected the published revision %q to be recorded, got %q", revision, config.Status.NodeAgentRevision)
+	}
+	if node := string(s.Data[cloudinit.NodeAgentNodeKey]); node != "worker-0" {
+		t.Errorf("expected the node name worker-0, got %q", node)
+	}
+	binding, err := clientset.RbacV1().RoleBindings(metav1.NamespaceSystem).Get("cabpk:node-agent:worker-join-cfg", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the node agent RoleBinding to exist: %v", err)
+	}
+	if len(binding.Subjects) != 1 || binding.Subjects[0].Name != "system:node:worker-0" {
+		t.Errorf("expected the Role to be bound to the node, got %+v", binding.Subjects)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected an event to be emitted, got %d", len(recorder.Events))
+	}
+
+	// unchanged updates are not published again
+	published := config.Status.NodeAgentRevision
+	if err := k.reconcileNodeAgent(context.Background(), cluster, config, machine); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected no new event, got %d", len(recorder.Events))
+	}
+
+	config.Spec.NodeAgent.Commands = []string{"systemctl restart containerd"}
+	if err := k.reconcileNodeAgent(context.Background(), cluster, config, machine); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	s, _ = clientset.CoreV1().Secrets(metav1.NamespaceSystem).Get("cabpk-node-agent-worker-join-cfg", metav1.GetOptions{})
+	if revision := string(s.Data[cloudinit.NodeAgentRevisionKey]); revision == published || revision != config.Status.NodeAgentRevision {
+		t.Errorf("expected a new revision to be published, got %q", revision)
+	}
+	if !strings.Contains(string(s.Data[cloudinit.NodeAgentScriptKey]), "systemctl restart containerd") {
+		t.Errorf("expected the updated script to be published, got:\n%s", s.Data[cloudinit.NodeAgentScriptKey])
+	}
+}
+
+func TestSpecHashIgnoresNodeAgentUpdates(t *testing.T) {
+	spec := &bootstrapv1.KubeadmConfigSpec{NodeAgent: &bootstrapv1.NodeAgent{Commands: []string{"systemctl restart kubelet"}}}
+	before, err := specHash(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec.NodeAgent.Commands = []string{"systemctl restart containerd"}
+	if after, _ := specHash(spec); after != before {
+		t.Error("expected the commands of the node agent not to change the spec hash")
+	}
+	if len(spec.NodeAgent.Commands) != 1 {
+		t.Error("expected the spec not to be modified")
+	}
+
+	spec.NodeAgent.IntervalSeconds = 30
+	if after, _ := specHash(spec); after == before {
+		t.Error("expected the interval of the node agent to change the spec hash")
+	}
+}
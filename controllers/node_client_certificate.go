@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+)
+
+const (
+	// NodeClientKubeconfigPath is the path of the kubeconfig holding the pre-signed kubelet client certificate.
+	// kubeadm uses it for file discovery and, as it contains credentials, for the kubelet TLS bootstrap.
+	NodeClientKubeconfigPath = "/etc/kubernetes/node-client.conf"
+)
+
+var (
+	// DefaultNodeClientCertificateTTL is the validity of pre-signed kubelet client certificates. The kubelet
+	// only uses them to request its own rotating client certificate, so they just need to outlive the boot of the machine.
+	DefaultNodeClientCertificateTTL = 24 * time.Hour
+)
+
+// reconcileNodeClientCertificateDiscovery configures the join discovery to use the kubeconfig holding the
+// pre-signed kubelet client certificate, instead of a bootstrap token.
+func (r *KubeadmConfigReconciler) reconcileNodeClientCertificateDiscovery(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) error {
+	discovery := &config.Spec.JoinConfiguration.Discovery
+	if discovery.BootstrapToken != nil {
+		return errors.New("JoinConfiguration.Discovery.BootstrapToken must not be set when using a node client certificate")
+	}
+	if discovery.File != nil && discovery.File.KubeConfigPath != NodeClientKubeconfigPath {
+		return errors.New("JoinConfiguration.Discovery.File must not be set when using a node client certificate")
+	}
+	if _, err := nodeClientName(config); err != nil {
+		return err
+	}
+	vip, err := r.clusterControlPlaneVIP(ctx, cluster, config)
+	if err != nil {
+		return err
+	}
+	if vip == nil && len(cluster.Status.APIEndpoints) == 0 {
+		r.markWaitingForClusterEndpoint(cluster, config)
+		return errors.Wrap(&capierrors.RequeueAfterError{RequeueAfter: 10 * time.Second}, "Waiting for Cluster Controller to set cluster.Status.APIEndpoints")
+	}
+
+	discovery.File = &kubeadmv1beta1.FileDiscovery{KubeConfigPath: NodeClientKubeconfigPath}
+	return nil
+}
+
+// nodeClientCertificateFiles signs a kubelet client certificate for the node with the cluster CA, and returns the
+// kubeconfig file using it to join the cluster.
+func (r *KubeadmConfigReconciler) nodeClientCertificateFiles(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, certificates internalcluster.Certificates) ([]bootstrapv1.File, error) {
+	if !config.Spec.NodeClientCertificate {
+		return nil, nil
+	}
+
+	name, err := nodeClientName(config)
+	if err != nil {
+		return nil, err
+	}
+	ca := certificates.GetByPurpose(internalcluster.ClusterCA)
+	if ca == nil || ca.KeyPair == nil {
+		return nil, errors.New("the cluster CA is required to sign node client certificates")
+	}
+	keyPair, err := ca.NewSignedClientKeyPair(pkix.Name{CommonName: "system:node:" + name, Organization: []string{nodesGroup}}, currentTunables().NodeClientCertificateTTL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to sign client certificate for node %q", name)
+	}
+
+	vip, err := r.clusterControlPlaneVIP(ctx, cluster, config)
+	if err != nil {
+		return nil, err
+	}
+	server, err := joinServer(cluster, vip)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := clientKubeconfig(cluster.Name, server, ca.KeyPair.Cert, "system:node:"+name, keyPair)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate node client kubeconfig")
+	}
+
+	return []bootstrapv1.File{
+		{
+			Path:        NodeClientKubeconfigPath,
+			Owner:       "root:root",
+			Permissions: "0600",
+			Content:     string(out),
+		},
+	}, nil
+}
+
+// nodeClientName returns the name of the node the client certificate is signed for, which must be known in advance.
+func nodeClientName(config *bootstrapv1.KubeadmConfig) (string, error) {
+	name := config.Spec.JoinConfiguration.NodeRegistration.Name
+	if name == "" || strings.Contains(name, "{{") {
+		return "", errors.New("a node client certificate requires the node name to be known in advance; set NodeName or JoinConfiguration.NodeRegistration.Name")
+	}
+	return name, nil
+}
+
+// joinServer returns the URL of the API server that joining machines using file discovery connect to, preferring
+// the control plane virtual IP if any.
+func joinServer(cluster *clusterv1.Cluster, vip *bootstrapv1.ControlPlaneVIP) (string, error) {
+	if vip != nil {
+		return "https://" + vipEndpoint(vip), nil
+	}
+	if len(cluster.Status.APIEndpoints) > 0 {
+		return "https://" + apiEndpointAddress(cluster.Status.APIEndpoints[0]), nil
+	}
+	return "", errors.Errorf("cluster %s/%s has no APIEndpoints", cluster.Namespace, cluster.Name)
+}
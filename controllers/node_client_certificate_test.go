@@ -0,0 +1,137 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_Reconcile_NodeClientCertificate(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Status.ControlPlaneInitialized = true
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+	workerJoinConfig.Spec.NodeClientCertificate = true
+	workerJoinConfig.Spec.JoinConfiguration.NodeRegistration.Name = "worker-0"
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	objects = append(objects, createSecrets(t, cluster, workerJoinConfig)...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+	}
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	if _, err := k.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+
+	cfg, err := getKubeadmConfig(myclient, "worker-join-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Status.Ready {
+		t.Fatal("Expected status ready")
+	}
+	discovery := cfg.Spec.JoinConfiguration.Discovery
+	if discovery.BootstrapToken != nil || discovery.File == nil || discovery.File.KubeConfigPath != NodeClientKubeconfigPath {
+		t.Fatalf("expected file discovery with the node client kubeconfig, got %+v", discovery)
+	}
+	if !bytes.Contains(cfg.Status.BootstrapData, []byte("path: "+NodeClientKubeconfigPath)) {
+		t.Errorf("expected the node client kubeconfig to be written, got:\n%s", cfg.Status.BootstrapData)
+	}
+
+	myremoteclient, _ := k.SecretsClientFactory.NewSecretsClient(context.Background(), nil, nil)
+	l, err := myremoteclient.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Items) != 0 {
+		t.Errorf("expected no bootstrap token to be created, got %d", len(l.Items))
+	}
+}
+
+func TestNodeClientCertificateFiles(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+	config.Spec.NodeClientCertificate = true
+
+	c := newFakeClientWithScheme(setupScheme(), createSecrets(t, cluster, config)...)
+	certificates := internalcluster.NewCertificatesForWorker("")
+	if err := certsecret.Lookup(context.Background(), c, cluster, certificates); err != nil {
+		t.Fatal(err)
+	}
+
+	k := &KubeadmConfigReconciler{Log: log.Log, Client: c}
+	if _, err := k.nodeClientCertificateFiles(context.Background(), cluster, config, certificates); err == nil {
+		t.Fatal("expected an error without node name")
+	}
+
+	config.Spec.JoinConfiguration.NodeRegistration.Name = "worker-0"
+	files, err := k.nodeClientCertificateFiles(context.Background(), cluster, config, certificates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != NodeClientKubeconfigPath || files[0].Permissions != "0600" {
+		t.Fatalf("unexpected files %+v", files)
+	}
+
+	kubeconfig, err := clientcmd.Load([]byte(files[0].Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeContext := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if server := kubeconfig.Clusters[kubeContext.Cluster].Server; server != "https://100.105.150.1:6443" {
+		t.Errorf("unexpected server %q", server)
+	}
+	cert, err := certs.DecodeCertPEM(kubeconfig.AuthInfos[kubeContext.AuthInfo].ClientCertificateData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "system:node:worker-0" || len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != "system:nodes" {
+		t.Errorf("unexpected subject %v", cert.Subject)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util"
+)
+
+const (
+	// NodeRoleLabelPrefix prefixes the role label of worker nodes with a node group role.
+	NodeRoleLabelPrefix = "node-role.kubernetes.io/"
+
+	// NodeGroupLabel is the label of worker nodes with a node group name.
+	NodeGroupLabel = "node.kubernetes.io/instance-group"
+)
+
+var (
+	// minVersionRejectingNodeRoleLabel is the first Kubernetes version whose kubelet refuses to set node role labels.
+	minVersionRejectingNodeRoleLabel = version.MustParseSemantic("v1.16.0")
+)
+
+// validateNodeGroup returns an error if the config labels the node of a control plane machine with a node group.
+// All the machines of a cluster with an external control plane join as workers.
+func validateNodeGroup(cluster *clusterv1.Cluster, machine *clusterv1.Machine, config *bootstrapv1.KubeadmConfig) error {
+	if config.Spec.NodeGroup == nil || !util.IsControlPlaneMachine(machine) || externalControlPlane(cluster) {
+		return nil
+	}
+	return errors.Errorf("nodeGroup is not supported by control plane Machine %s/%s, use controlPlaneNodes.labels instead", machine.Namespace, machine.Name)
+}
+
+// applyNodeGroupToNodeRegistration adds the role and node group labels of the node group to the node-labels kubelet
+// argument, without overriding the labels defined by the user.
+func applyNodeGroupToNodeRegistration(nodeGroup *bootstrapv1.NodeGroupLabels, kubernetesVersion *string, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions) error {
+	if nodeGroup == nil {
+		return nil
+	}
+
+	labels := map[string]string{}
+	if nodeGroup.Role != "" {
+		if !kubeletSetsNodeRoleLabel(kubernetesVersion) {
+			return errors.Errorf("nodeGroup.role requires a Machine version below %s, whose kubelet sets %s labels", minVersionRejectingNodeRoleLabel, NodeRoleLabelPrefix)
+		}
+		labels[NodeRoleLabelPrefix+nodeGroup.Role] = ""
+	}
+	if nodeGroup.Name != "" {
+		labels[NodeGroupLabel] = nodeGroup.Name
+	}
+	addNodeLabels(nodeRegistration, labels)
+	return nil
+}
+
+// kubeletSetsNodeRoleLabel returns true if the kubelet of the given Kubernetes version is allowed to set node role
+// labels. Unknown versions are assumed not to be.
+func kubeletSetsNodeRoleLabel(kubernetesVersion *string) bool {
+	if kubernetesVersion == nil || *kubernetesVersion == "" {
+		return false
+	}
+	v, err := version.ParseSemantic(*kubernetesVersion)
+	if err != nil {
+		return false
+	}
+	return v.LessThan(minVersionRejectingNodeRoleLabel)
+}
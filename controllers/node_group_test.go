@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestValidateNodeGroup(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newControlPlaneMachine(cluster, "control-plane-machine")
+	config := newKubeadmConfig(machine, "control-plane-cfg")
+
+	if err := validateNodeGroup(cluster, machine, config); err != nil {
+		t.Errorf("expected no error without node group, got %v", err)
+	}
+
+	config.Spec.NodeGroup = &bootstrapv1.NodeGroupLabels{Name: "md-0"}
+	if err := validateNodeGroup(cluster, machine, config); err == nil {
+		t.Error("expected a node group to be rejected for a control plane machine")
+	}
+
+	cluster.Annotations = map[string]string{ExternalControlPlaneAnnotation: "true"}
+	if err := validateNodeGroup(cluster, machine, config); err != nil {
+		t.Errorf("expected a node group to be accepted with an external control plane, got %v", err)
+	}
+}
+
+func TestApplyNodeGroupToNodeRegistration(t *testing.T) {
+	v115, v116 := "v1.15.5", "v1.16.3"
+	testcases := []struct {
+		name              string
+		nodeGroup         *bootstrapv1.NodeGroupLabels
+		kubernetesVersion *string
+		kubeletExtraArgs  map[string]string
+		expectedArgs      map[string]string
+		expectErr         bool
+	}{
+		{
+			name: "nothing is labeled by default",
+		},
+		{
+			name:              "the node group label is set for any version",
+			nodeGroup:         &bootstrapv1.NodeGroupLabels{Name: "md-0"},
+			kubernetesVersion: &v116,
+			expectedArgs:      map[string]string{"node-labels": "node.kubernetes.io/instance-group=md-0"},
+		},
+		{
+			name:              "the role label is appended to the labels of the user",
+			nodeGroup:         &bootstrapv1.NodeGroupLabels{Role: "worker", Name: "md-0"},
+			kubernetesVersion: &v115,
+			kubeletExtraArgs:  map[string]string{"node-labels": "tier=frontend"},
+			expectedArgs:      map[string]string{"node-labels": "tier=frontend,node-role.kubernetes.io/worker=,node.kubernetes.io/instance-group=md-0"},
+		},
+		{
+			name:              "the labels of the user are not overridden",
+			nodeGroup:         &bootstrapv1.NodeGroupLabels{Name: "md-0"},
+			kubernetesVersion: &v116,
+			kubeletExtraArgs:  map[string]string{"node-labels": "node.kubernetes.io/instance-group=custom"},
+			expectedArgs:      map[string]string{"node-labels": "node.kubernetes.io/instance-group=custom"},
+		},
+		{
+			name:              "the role label is rejected for kubelets refusing it",
+			nodeGroup:         &bootstrapv1.NodeGroupLabels{Role: "worker"},
+			kubernetesVersion: &v116,
+			expectErr:         true,
+		},
+		{
+			name:      "the role label is rejected for unknown versions",
+			nodeGroup: &bootstrapv1.NodeGroupLabels{Role: "worker"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodeRegistration := &kubeadmv1beta1.NodeRegistrationOptions{KubeletExtraArgs: tc.kubeletExtraArgs}
+			err := applyNodeGroupToNodeRegistration(tc.nodeGroup, tc.kubernetesVersion, nodeRegistration)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if len(nodeRegistration.KubeletExtraArgs) != len(tc.expectedArgs) {
+				t.Fatalf("expected kubelet args %v, got %v", tc.expectedArgs, nodeRegistration.KubeletExtraArgs)
+			}
+			for k, v := range tc.expectedArgs {
+				if nodeRegistration.KubeletExtraArgs[k] != v {
+					t.Errorf("expected kubelet arg %s=%q, got %q", k, v, nodeRegistration.KubeletExtraArgs[k])
+				}
+			}
+		})
+	}
+}
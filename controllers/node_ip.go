@@ -0,0 +1,137 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+const (
+	nodeIPScriptName  = "cabpk-detect-node-ip"
+	nodeIPDropInPath  = "/etc/systemd/system/kubelet.service.d/20-node-ip.conf"
+	nodeIPEnvFileDir  = "/run/cabpk"
+	nodeIPEnvFilePath = nodeIPEnvFileDir + "/kubelet-node-ip.env"
+
+	// nodeIPDropIn runs the detection script before every kubelet start, and appends the detected --node-ip to the
+	// command line of the kubeadm kubelet drop-in so that the arguments set by kubeadm and the user are preserved.
+	// It is formatted with the paths of the script and of the kubelet.
+	nodeIPDropIn = `[Service]
+ExecStartPre=%s
+EnvironmentFile=-` + nodeIPEnvFilePath + `
+ExecStart=
+ExecStart=%s $KUBELET_KUBECONFIG_ARGS $KUBELET_CONFIG_ARGS $KUBELET_KUBEADM_ARGS $KUBELET_EXTRA_ARGS $KUBELET_NODE_IP_ARGS
+`
+
+	nodeIPScript = `#!/bin/sh
+# Detects the IP address of the machine and passes it to the kubelet with --node-ip.
+set -e
+node_ip=""
+{{- if .MetadataURL }}
+node_ip=$(curl -sSf --retry 5 '{{ .MetadataURL }}' || true)
+{{- end }}
+if [ -z "$node_ip" ]; then
+  iface='{{ .Interface }}'
+  if [ -z "$iface" ]; then
+    iface=$(ip -4 route show default | awk '{print $5; exit}')
+  fi
+  node_ip=$(ip -4 -o addr show dev "$iface" scope global | awk '{split($4, a, "/"); print a[1]; exit}')
+fi
+if [ -z "$node_ip" ]; then
+  echo "failed to detect the node IP address" >&2
+  exit 1
+fi
+mkdir -p ` + nodeIPEnvFileDir + `
+echo "KUBELET_NODE_IP_ARGS=--node-ip=$node_ip" > ` + nodeIPEnvFilePath + `
+`
+)
+
+var (
+	nodeIPScriptTemplate = template.Must(template.New("NodeIP").Parse(nodeIPScript))
+
+	// interfaceNameRegex matches the names of Linux network interfaces.
+	interfaceNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.:@-]{1,15}$`)
+)
+
+// nodeIPDetectionFiles returns the kubelet drop-in and the script detecting the node IP address, along with the commands
+// to be run before kubeadm for systemd to load the drop-in.
+func nodeIPDetectionFiles(config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, error) {
+	detection := config.Spec.NodeIP
+	if detection == nil {
+		return nil, nil, nil
+	}
+
+	if detection.MetadataURL != "" {
+		u, err := url.Parse(detection.MetadataURL)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid node IP metadata URL %q", detection.MetadataURL)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(detection.MetadataURL, "'\n") {
+			return nil, nil, errors.Errorf("invalid node IP metadata URL %q: must be an http or https URL", detection.MetadataURL)
+		}
+	}
+	if detection.Interface != "" && !interfaceNameRegex.MatchString(detection.Interface) {
+		return nil, nil, errors.Errorf("invalid node IP interface %q", detection.Interface)
+	}
+	for _, nodeRegistration := range nodeRegistrations(config) {
+		if _, ok := nodeRegistration.KubeletExtraArgs["node-ip"]; ok {
+			return nil, nil, errors.New("nodeIP cannot be used when the node-ip kubelet argument is set")
+		}
+	}
+
+	var script bytes.Buffer
+	if err := nodeIPScriptTemplate.Execute(&script, detection); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to render node IP detection script")
+	}
+
+	nodeIPScriptPath := scriptPath(config, nodeIPScriptName)
+	files := []bootstrapv1.File{
+		{
+			Path:        nodeIPScriptPath,
+			Owner:       "root:root",
+			Permissions: "0755",
+			Content:     script.String(),
+		},
+		{
+			Path:        nodeIPDropInPath,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     fmt.Sprintf(nodeIPDropIn, nodeIPScriptPath, osProfile(config).kubeletPath),
+		},
+	}
+	return files, []string{"systemctl daemon-reload"}, nil
+}
+
+// nodeRegistrations returns the node registration options defined in the config.
+func nodeRegistrations(config *bootstrapv1.KubeadmConfig) []*kubeadmv1beta1.NodeRegistrationOptions {
+	var out []*kubeadmv1beta1.NodeRegistrationOptions
+	if config.Spec.InitConfiguration != nil {
+		out = append(out, &config.Spec.InitConfiguration.NodeRegistration)
+	}
+	if config.Spec.JoinConfiguration != nil {
+		out = append(out, &config.Spec.JoinConfiguration.NodeRegistration)
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestNodeIPDetectionFiles(t *testing.T) {
+	tests := []struct {
+		name             string
+		detection        *bootstrapv1.NodeIPDetection
+		kubeletArgs      map[string]string
+		expectedInScript []string
+		expectFiles      bool
+		expectError      bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:             "default route interface",
+			detection:        &bootstrapv1.NodeIPDetection{},
+			expectedInScript: []string{"iface=''", "ip -4 route show default"},
+			expectFiles:      true,
+		},
+		{
+			name: "metadata URL and interface",
+			detection: &bootstrapv1.NodeIPDetection{
+				MetadataURL: "http://169.254.169.254/latest/meta-data/local-ipv4",
+				Interface:   "eth1",
+			},
+			expectedInScript: []string{"curl -sSf --retry 5 'http://169.254.169.254/latest/meta-data/local-ipv4'", "iface='eth1'"},
+			expectFiles:      true,
+		},
+		{
+			name:        "metadata URL with an unsupported scheme",
+			detection:   &bootstrapv1.NodeIPDetection{MetadataURL: "file:///etc/ip"},
+			expectError: true,
+		},
+		{
+			name:        "metadata URL breaking the quoting",
+			detection:   &bootstrapv1.NodeIPDetection{MetadataURL: "http://example.com/'; reboot; '"},
+			expectError: true,
+		},
+		{
+			name:        "invalid interface",
+			detection:   &bootstrapv1.NodeIPDetection{Interface: "eth0; reboot"},
+			expectError: true,
+		},
+		{
+			name:        "conflicting kubelet argument",
+			detection:   &bootstrapv1.NodeIPDetection{},
+			kubeletArgs: map[string]string{"node-ip": "10.0.0.1"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &bootstrapv1.KubeadmConfig{
+				Spec: bootstrapv1.KubeadmConfigSpec{
+					NodeIP: tc.detection,
+					JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+						NodeRegistration: kubeadmv1beta1.NodeRegistrationOptions{KubeletExtraArgs: tc.kubeletArgs},
+					},
+				},
+			}
+			files, commands, err := nodeIPDetectionFiles(config)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if !tc.expectFiles {
+				if len(files) != 0 || len(commands) != 0 {
+					t.Fatalf("expected no files and commands, got %v and %v", files, commands)
+				}
+				return
+			}
+
+			if len(files) != 2 || files[0].Path != "/usr/local/bin/cabpk-detect-node-ip" || files[1].Path != nodeIPDropInPath {
+				t.Fatalf("expected the detection script and the kubelet drop-in, got %v", files)
+			}
+			for _, s := range tc.expectedInScript {
+				if !strings.Contains(files[0].Content, s) {
+					t.Errorf("expected the script to contain %q, got:\n%s", s, files[0].Content)
+				}
+			}
+			if !strings.Contains(files[1].Content, "$KUBELET_NODE_IP_ARGS") {
+				t.Errorf("expected the drop-in to pass the node IP to the kubelet, got:\n%s", files[1].Content)
+			}
+			if len(commands) != 1 || commands[0] != "systemctl daemon-reload" {
+				t.Errorf("expected systemd to be reloaded, got %v", commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+)
+
+const (
+	// cloudMetadataHostname is the cloud-init jinja expression resolving to the hostname reported by the datasource.
+	cloudMetadataHostname = "{{ ds.meta_data.local_hostname }}"
+)
+
+// nodeName is the name of a node, along with the hostname settings to be configured on its machine.
+type nodeName struct {
+	// Name is the name the node is registered with.
+	Name string
+	// Hostname and FQDN are configured by cloud-init if set.
+	Hostname string
+	FQDN     string
+}
+
+// resolveNodeName generates the node name for the machine according to the config node name strategy.
+// It returns nil if no strategy is set.
+func resolveNodeName(cluster *clusterv1.Cluster, machine *clusterv1.Machine, config *bootstrapv1.KubeadmConfig) (*nodeName, error) {
+	spec := config.Spec.NodeName
+	if spec == nil {
+		return nil, nil
+	}
+
+	var name string
+	switch spec.Strategy {
+	case bootstrapv1.CloudMetadataStrategy:
+		return &nodeName{Name: cloudMetadataHostname}, nil
+	case bootstrapv1.MachineNameStrategy:
+		name = machine.Name
+	case bootstrapv1.TemplateStrategy:
+		tpl, err := template.New("nodeName").Option("missingkey=error").Parse(spec.Template)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse node name template")
+		}
+		var out bytes.Buffer
+		if err := tpl.Execute(&out, map[string]string{
+			"MachineName": machine.Name,
+			"ClusterName": cluster.Name,
+			"Namespace":   machine.Namespace,
+		}); err != nil {
+			return nil, errors.Wrap(err, "failed to generate node name from template")
+		}
+		name = strings.TrimSpace(out.String())
+	default:
+		return nil, errors.Errorf("unsupported node name strategy %q", spec.Strategy)
+	}
+
+	fqdn := ""
+	if spec.Domain != "" {
+		fqdn = name + "." + spec.Domain
+	}
+	for _, n := range []string{name, fqdn} {
+		if errs := validation.IsDNS1123Subdomain(n); n != "" && len(errs) > 0 {
+			return nil, errors.Errorf("invalid node name %q: %s", n, strings.Join(errs, ", "))
+		}
+	}
+	if name == "" {
+		return nil, errors.New("node name must not be empty")
+	}
+
+	return &nodeName{Name: name, Hostname: name, FQDN: fqdn}, nil
+}
+
+// setNodeRegistrationName registers the node with the generated name, unless a name is already set.
+func setNodeRegistrationName(nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions, n *nodeName) {
+	if n != nil && nodeRegistration.Name == "" {
+		nodeRegistration.Name = n.Name
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestResolveNodeName(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newWorkerMachine(cluster)
+
+	tests := []struct {
+		name        string
+		spec        *bootstrapv1.NodeName
+		expected    *nodeName
+		expectError bool
+	}{
+		{
+			name: "no strategy",
+		},
+		{
+			name:     "machine name",
+			spec:     &bootstrapv1.NodeName{Strategy: bootstrapv1.MachineNameStrategy},
+			expected: &nodeName{Name: "worker-machine", Hostname: "worker-machine"},
+		},
+		{
+			name:     "machine name with domain",
+			spec:     &bootstrapv1.NodeName{Strategy: bootstrapv1.MachineNameStrategy, Domain: "example.com"},
+			expected: &nodeName{Name: "worker-machine", Hostname: "worker-machine", FQDN: "worker-machine.example.com"},
+		},
+		{
+			name:     "cloud metadata",
+			spec:     &bootstrapv1.NodeName{Strategy: bootstrapv1.CloudMetadataStrategy, Domain: "ignored.com"},
+			expected: &nodeName{Name: "{{ ds.meta_data.local_hostname }}"},
+		},
+		{
+			name:     "template",
+			spec:     &bootstrapv1.NodeName{Strategy: bootstrapv1.TemplateStrategy, Template: "{{ .ClusterName }}-{{ .MachineName }}"},
+			expected: &nodeName{Name: "cluster-worker-machine", Hostname: "cluster-worker-machine"},
+		},
+		{
+			name:        "template with unknown key",
+			spec:        &bootstrapv1.NodeName{Strategy: bootstrapv1.TemplateStrategy, Template: "{{ .Unknown }}"},
+			expectError: true,
+		},
+		{
+			name:        "template generating an invalid name",
+			spec:        &bootstrapv1.NodeName{Strategy: bootstrapv1.TemplateStrategy, Template: "Not_Valid"},
+			expectError: true,
+		},
+		{
+			name:        "unknown strategy",
+			spec:        &bootstrapv1.NodeName{Strategy: "Random"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newWorkerJoinKubeadmConfig(machine)
+			config.Spec.NodeName = tc.spec
+
+			n, err := resolveNodeName(cluster, machine, config)
+			if tc.expectError != (err != nil) {
+				t.Fatalf("expected error: %v, got: %v", tc.expectError, err)
+			}
+			if (n == nil) != (tc.expected == nil) || (n != nil && *n != *tc.expected) {
+				t.Fatalf("expected %+v, got %+v", tc.expected, n)
+			}
+		})
+	}
+}
+
+func TestSetNodeRegistrationName(t *testing.T) {
+	n := &nodeName{Name: "generated"}
+
+	nodeRegistration := &kubeadmv1beta1.NodeRegistrationOptions{}
+	setNodeRegistrationName(nodeRegistration, n)
+	if nodeRegistration.Name != "generated" {
+		t.Errorf("expected the generated name, got %q", nodeRegistration.Name)
+	}
+
+	nodeRegistration = &kubeadmv1beta1.NodeRegistrationOptions{Name: "explicit"}
+	setNodeRegistrationName(nodeRegistration, n)
+	if nodeRegistration.Name != "explicit" {
+		t.Errorf("expected the explicit name to take precedence, got %q", nodeRegistration.Name)
+	}
+}
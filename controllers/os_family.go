@@ -0,0 +1,169 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+const (
+	// debianTrustDir is the directory update-ca-certificates reads additional CAs from on Debian based distributions.
+	debianTrustDir = "/usr/local/share/ca-certificates"
+	// redHatTrustDir is the directory update-ca-trust reads additional CAs from on Red Hat based distributions.
+	redHatTrustDir = "/etc/pki/ca-trust/source/anchors"
+	// suseTrustDir is the directory update-ca-certificates reads additional CAs from on SUSE based distributions.
+	suseTrustDir = "/etc/pki/trust/anchors"
+	// flatcarTrustDir is the directory update-ca-certificates reads additional CAs from on Flatcar, as .pem files.
+	flatcarTrustDir = "/etc/ssl/certs"
+
+	// zramToolsUnit is the zram swap service of zram-tools on Debian, and of systemd-zram-service on SUSE.
+	zramToolsUnit = "zramswap.service"
+	// zramConfigUnit is the zram swap service of zram-config on Ubuntu.
+	zramConfigUnit = "zram-config.service"
+	// zramGeneratorUnit is the zram swap service created by zram-generator, as on Fedora, RHEL 9 and Flatcar.
+	zramGeneratorUnit = "systemd-zram-setup@zram0.service"
+)
+
+// osFamilyProfile holds the paths and commands of the bootstrap data which differ between operating system families.
+type osFamilyProfile struct {
+	// scriptDir is the directory the scripts of the bootstrap data are written to.
+	scriptDir string
+	// kubeletPath is the path of the kubelet binary.
+	kubeletPath string
+	// trustDirs are the directories trust bundles are written to, as files with the trustExtension extension.
+	trustDirs      []string
+	trustExtension string
+	// updateTrustCommand rebuilds the trust store from the trust directories.
+	updateTrustCommand string
+	// restartSSHCommand restarts sshd.
+	restartSSHCommand string
+	// zramSwapUnits are the systemd units setting up zram swap devices.
+	zramSwapUnits []string
+}
+
+var osFamilyProfiles = map[bootstrapv1.OSFamily]osFamilyProfile{
+	// without an OS family, the files and commands of both Debian and Red Hat based distributions are used
+	"": {
+		scriptDir:      "/usr/local/bin",
+		kubeletPath:    "/usr/bin/kubelet",
+		trustDirs:      []string{debianTrustDir, redHatTrustDir},
+		trustExtension: ".crt",
+		updateTrustCommand: "if command -v update-ca-certificates >/dev/null; then update-ca-certificates; " +
+			"elif command -v update-ca-trust >/dev/null; then update-ca-trust extract; fi",
+		restartSSHCommand: "systemctl restart sshd || systemctl restart ssh",
+		zramSwapUnits:     []string{zramToolsUnit, zramConfigUnit, zramGeneratorUnit},
+	},
+	bootstrapv1.Debian: {
+		scriptDir:          "/usr/local/bin",
+		kubeletPath:        "/usr/bin/kubelet",
+		trustDirs:          []string{debianTrustDir},
+		trustExtension:     ".crt",
+		updateTrustCommand: "update-ca-certificates",
+		restartSSHCommand:  "systemctl restart ssh",
+		zramSwapUnits:      []string{zramToolsUnit, zramConfigUnit},
+	},
+	bootstrapv1.RHEL: {
+		scriptDir:          "/usr/local/bin",
+		kubeletPath:        "/usr/bin/kubelet",
+		trustDirs:          []string{redHatTrustDir},
+		trustExtension:     ".crt",
+		updateTrustCommand: "update-ca-trust extract",
+		restartSSHCommand:  "systemctl restart sshd",
+		zramSwapUnits:      []string{zramGeneratorUnit},
+	},
+	bootstrapv1.SLES: {
+		scriptDir:          "/usr/local/bin",
+		kubeletPath:        "/usr/bin/kubelet",
+		trustDirs:          []string{suseTrustDir},
+		trustExtension:     ".crt",
+		updateTrustCommand: "update-ca-certificates",
+		restartSSHCommand:  "systemctl restart sshd",
+		zramSwapUnits:      []string{zramToolsUnit},
+	},
+	// /usr is read-only on Flatcar, binaries and scripts live in /opt/bin
+	bootstrapv1.Flatcar: {
+		scriptDir:          "/opt/bin",
+		kubeletPath:        "/opt/bin/kubelet",
+		trustDirs:          []string{flatcarTrustDir},
+		trustExtension:     ".pem",
+		updateTrustCommand: "update-ca-certificates",
+		restartSSHCommand:  "systemctl restart sshd",
+		zramSwapUnits:      []string{zramGeneratorUnit},
+	},
+	// the Linux specific features are rejected for Windows machines, see validateOSFamily
+	bootstrapv1.Windows: {},
+}
+
+// osProfile returns the profile of the operating system family of the config.
+func osProfile(config *bootstrapv1.KubeadmConfig) osFamilyProfile {
+	return osFamilyProfiles[config.Spec.OSFamily]
+}
+
+// scriptPath returns the path a script of the bootstrap data is written to on the machine of the config.
+func scriptPath(config *bootstrapv1.KubeadmConfig, name string) string {
+	return path.Join(osProfile(config).scriptDir, name)
+}
+
+// validateOSFamily checks that the features of the config are supported by its operating system family. Windows
+// machines can only join as workers, and do not support the features relying on shell scripts, systemd or
+// cloud-init modules.
+func validateOSFamily(config *bootstrapv1.KubeadmConfig, isControlPlane bool) error {
+	if config.Spec.OSFamily != bootstrapv1.Windows {
+		return nil
+	}
+	if isControlPlane {
+		return errors.Errorf("the %s OS family is only supported for worker machines", bootstrapv1.Windows)
+	}
+	spec := config.Spec
+	for _, feature := range []struct {
+		name string
+		set  bool
+	}{
+		{"format " + string(bootstrapv1.JoinScript), spec.Format == bootstrapv1.JoinScript},
+		{"formatOptions.dataSource", dataSource(config) != ""},
+		{"nodeName", spec.NodeName != nil},
+		{"nodeIP", spec.NodeIP != nil},
+		{"nodeClientCertificate", spec.NodeClientCertificate},
+		{"tokenBackend", spec.TokenBackend != ""},
+		{"registryMirrors", len(spec.RegistryMirrors) > 0},
+		{"additionalTrustBundles", len(spec.AdditionalTrustBundles) > 0},
+		{"selinux", spec.SELinux != nil},
+		{"hardening", spec.Hardening != ""},
+		{"diagnostics", spec.Diagnostics != nil},
+		{"ssh", spec.SSH != nil},
+		{"staticPodManifests", len(spec.StaticPodManifests) > 0},
+		{"ntp", spec.NTP != nil},
+		{"resetBeforeJoin", spec.ResetBeforeJoin},
+		{"idempotentCommands", spec.IdempotentCommands},
+		{"adoptExistingNode", spec.AdoptExistingNode},
+		{"disableSwap", spec.DisableSwap},
+		{"systemdUnits", len(spec.SystemdUnits) > 0},
+		{"apiServerEndpointDNS.srvRecord", spec.APIServerEndpointDNS != nil && spec.APIServerEndpointDNS.SRVRecord != ""},
+		{"dns", spec.DNS != nil},
+		{"prerequisites", len(spec.Prerequisites) > 0},
+		{"nodeAgent", spec.NodeAgent != nil},
+		{"addons", spec.Addons != nil},
+	} {
+		if feature.set {
+			return errors.Errorf("%s is not supported by the %s OS family", feature.name, bootstrapv1.Windows)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestOSFamilyProfiles(t *testing.T) {
+	for _, family := range []bootstrapv1.OSFamily{"", bootstrapv1.Debian, bootstrapv1.RHEL, bootstrapv1.Flatcar, bootstrapv1.SLES, bootstrapv1.Windows} {
+		if _, ok := osFamilyProfiles[family]; !ok {
+			t.Errorf("missing profile for OS family %q", family)
+		}
+	}
+
+	config := newKubeadmConfig(nil, "cfg")
+	config.Spec.OSFamily = bootstrapv1.Flatcar
+	config.Spec.NodeIP = &bootstrapv1.NodeIPDetection{}
+	files, _, err := nodeIPDetectionFiles(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].Path != "/opt/bin/cabpk-detect-node-ip" {
+		t.Errorf("expected the script in /opt/bin, got %s", files[0].Path)
+	}
+	if !strings.Contains(files[1].Content, "ExecStartPre=/opt/bin/cabpk-detect-node-ip\n") || !strings.Contains(files[1].Content, "ExecStart=/opt/bin/kubelet ") {
+		t.Errorf("expected the drop-in to use the Flatcar paths, got:\n%s", files[1].Content)
+	}
+
+	config = newKubeadmConfig(nil, "cfg")
+	config.Spec.OSFamily = bootstrapv1.RHEL
+	config.Spec.AdditionalTrustBundles = []bootstrapv1.TrustBundle{{Name: "corp", Content: newTestCABundle(t)}}
+	k := &KubeadmConfigReconciler{Log: log.Log, Client: newFakeClientWithScheme(setupScheme())}
+	files, commands, err := k.resolveTrustBundles(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "/etc/pki/ca-trust/source/anchors/corp.crt" {
+		t.Errorf("expected a single file in the Red Hat trust store, got %+v", files)
+	}
+	if commands[0] != "update-ca-trust extract" {
+		t.Errorf("expected the Red Hat trust store to be updated, got %v", commands)
+	}
+}
+
+func TestValidateOSFamily(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+	config.Spec.NTP = &bootstrapv1.NTP{Servers: []string{"pool.ntp.org"}}
+	if err := validateOSFamily(config, true); err != nil {
+		t.Fatalf("expected Linux configs not to be validated, got %v", err)
+	}
+
+	config.Spec.OSFamily = bootstrapv1.Windows
+	if err := validateOSFamily(config, false); err == nil {
+		t.Error("expected NTP to be rejected for Windows machines")
+	}
+
+	config.Spec.NTP = nil
+	if err := validateOSFamily(config, false); err != nil {
+		t.Errorf("expected nil, got error %v", err)
+	}
+	if err := validateOSFamily(config, true); err == nil {
+		t.Error("expected Windows control plane machines to be rejected")
+	}
+
+	config.Spec.Format = bootstrapv1.JoinScript
+	if err := validateOSFamily(config, false); err == nil {
+		t.Error("expected the join script format to be rejected for Windows machines")
+	}
+}
+
+func TestKubeadmConfigReconciler_Reconcile_WindowsWorker(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Status.ControlPlaneInitialized = true
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+	workerJoinConfig.Spec.OSFamily = bootstrapv1.Windows
+	workerJoinConfig.Spec.PreKubeadmCommands = []string{"echo pre-kubeadm"}
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	objects = append(objects, createSecrets(t, cluster, workerJoinConfig)...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+	}
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	if _, err := k.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+
+	cfg, err := getKubeadmConfig(myclient, "worker-join-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Status.Ready {
+		t.Fatal("Expected status ready")
+	}
+	for _, expected := range []string{
+		"path: C:\\k\\kubeadm-node.yaml\n",
+		"  - \"echo pre-kubeadm\"\n",
+		"  - 'kubeadm join --config C:\\k\\kubeadm-node.yaml'\n",
+	} {
+		if !bytes.Contains(cfg.Status.BootstrapData, []byte(expected)) {
+			t.Errorf("%s\ndid not contain\n%s", cfg.Status.BootstrapData, expected)
+		}
+	}
+	if !bytes.HasPrefix(cfg.Status.BootstrapData, []byte("#cloud-config\n")) {
+		t.Errorf("expected cloudbase-init user data without templating, got:\n%s", cfg.Status.BootstrapData)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"text/template"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+// PrerequisiteModule expands into the files and commands installing a prerequisite of a machine before kubeadm runs,
+// e.g. a GPU driver. Modules are selected by name in the prerequisites of configs.
+type PrerequisiteModule interface {
+	// Expand returns the files and the commands of the module for the config, with the given parameters.
+	Expand(config *bootstrapv1.KubeadmConfig, parameters map[string]string) ([]bootstrapv1.File, []string, error)
+}
+
+// PrerequisiteModuleFunc is a function implementing PrerequisiteModule.
+type PrerequisiteModuleFunc func(config *bootstrapv1.KubeadmConfig, parameters map[string]string) ([]bootstrapv1.File, []string, error)
+
+// Expand implements PrerequisiteModule.
+func (f PrerequisiteModuleFunc) Expand(config *bootstrapv1.KubeadmConfig, parameters map[string]string) ([]bootstrapv1.File, []string, error) {
+	return f(config, parameters)
+}
+
+const (
+	// NvidiaDriverPrerequisite installs the NVIDIA driver of the version parameter, e.g. 535, from the packages of
+	// Ubuntu, or from the NVIDIA CUDA repository on Red Hat based distributions.
+	NvidiaDriverPrerequisite = "nvidia-driver"
+
+	// ContainerdNvidiaRuntimePrerequisite installs the NVIDIA container toolkit from the NVIDIA repository and
+	// configures it as a containerd runtime, the default one unless the setAsDefault parameter is false.
+	ContainerdNvidiaRuntimePrerequisite = "containerd-nvidia-runtime"
+
+	nvidiaDriverScript = `#!/bin/sh
+# Installs the NVIDIA driver, unless it is already loaded.
+set -e
+if command -v nvidia-smi >/dev/null && nvidia-smi >/dev/null 2>&1; then
+  exit 0
+fi
+if command -v apt-get >/dev/null; then
+  export DEBIAN_FRONTEND=noninteractive
+  apt-get update
+  apt-get install -y "linux-headers-$(uname -r)" nvidia-driver-{{ .Version }}-server
+elif command -v dnf >/dev/null; then
+  . /etc/os-release
+  dnf config-manager --add-repo "https://developer.download.nvidia.com/compute/cuda/repos/rhel${VERSION_ID%%.*}/$(uname -m)/cuda-rhel${VERSION_ID%%.*}.repo"
+  dnf install -y "kernel-devel-$(uname -r)" "kernel-headers-$(uname -r)"
+  dnf module install -y nvidia-driver:{{ .Version }}-dkms
+else
+  echo "no supported package manager to install the NVIDIA driver" >&2
+  exit 1
+fi
+modprobe nvidia
+`
+
+	containerdNvidiaRuntimeScript = `#!/bin/sh
+# Installs the NVIDIA container toolkit and configures it as a containerd runtime.
+set -e
+if ! command -v nvidia-ctk >/dev/null; then
+  if command -v apt-get >/dev/null; then
+    curl -fsSL https://nvidia.github.io/libnvidia-container/gpgkey | gpg --dearmor --yes -o /usr/share/keyrings/nvidia-container-toolkit-keyring.gpg
+    curl -fsSL https://nvidia.github.io/libnvidia-container/stable/deb/nvidia-container-toolkit.list | \
+      sed 's#deb https://#deb [signed-by=/usr/share/keyrings/nvidia-container-toolkit-keyring.gpg] https://#g' > /etc/apt/sources.list.d/nvidia-container-toolkit.list
+    apt-get update
+    DEBIAN_FRONTEND=noninteractive apt-get install -y nvidia-container-toolkit
+  elif command -v dnf >/dev/null; then
+    curl -fsSL https://nvidia.github.io/libnvidia-container/stable/rpm/nvidia-container-toolkit.repo -o /etc/yum.repos.d/nvidia-container-toolkit.repo
+    dnf install -y nvidia-container-toolkit
+  else
+    echo "no supported package manager to install the NVIDIA container toolkit" >&2
+    exit 1
+  fi
+fi
+nvidia-ctk runtime configure --runtime=containerd{{ if .SetAsDefault }} --set-as-default{{ end }}
+systemctl restart containerd
+`
+)
+
+var (
+	nvidiaDriverScriptTemplate            = template.Must(template.New("NvidiaDriver").Parse(nvidiaDriverScript))
+	containerdNvidiaRuntimeScriptTemplate = template.Must(template.New("ContainerdNvidiaRuntime").Parse(containerdNvidiaRuntimeScript))
+
+	// nvidiaDriverVersionRegex matches the NVIDIA driver branches, e.g. 535.
+	nvidiaDriverVersionRegex = regexp.MustCompile(`^[0-9]{3}$`)
+
+	// DefaultPrerequisiteModules are the prerequisite modules bundled with CABPK.
+	DefaultPrerequisiteModules = map[string]PrerequisiteModule{
+		NvidiaDriverPrerequisite:            PrerequisiteModuleFunc(nvidiaDriverModule),
+		ContainerdNvidiaRuntimePrerequisite: PrerequisiteModuleFunc(containerdNvidiaRuntimeModule),
+	}
+)
+
+// prerequisiteFiles returns the files and the commands of the prerequisites of the config, in order. The modules
+// registered with the reconciler take precedence over the DefaultPrerequisiteModules of the same name.
+func (r *KubeadmConfigReconciler) prerequisiteFiles(config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, error) {
+	var files []bootstrapv1.File
+	var commands []string
+	for _, prerequisite := range config.Spec.Prerequisites {
+		module, ok := r.PrerequisiteModules[prerequisite.Name]
+		if !ok {
+			module, ok = DefaultPrerequisiteModules[prerequisite.Name]
+		}
+		if !ok {
+			return nil, nil, errors.Errorf("unknown prerequisite module %q", prerequisite.Name)
+		}
+		moduleFiles, moduleCommands, err := module.Expand(config, prerequisite.Parameters)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid prerequisite %s", prerequisite.Name)
+		}
+		files = append(files, moduleFiles...)
+		commands = append(commands, moduleCommands...)
+	}
+	return files, commands, nil
+}
+
+// prerequisiteScript returns the file and the command of a prerequisite script rendered with the given data.
+func prerequisiteScript(config *bootstrapv1.KubeadmConfig, name string, tmpl *template.Template, data interface{}) ([]bootstrapv1.File, []string, error) {
+	if config.Spec.OSFamily == bootstrapv1.Flatcar {
+		return nil, nil, errors.Errorf("the %s OS family has no package manager", bootstrapv1.Flatcar)
+	}
+	var script bytes.Buffer
+	if err := tmpl.Execute(&script, data); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to render script")
+	}
+	path := scriptPath(config, "cabpk-prerequisite-"+name)
+	files := []bootstrapv1.File{
+		{
+			Path:        path,
+			Owner:       "root:root",
+			Permissions: "0755",
+			Content:     script.String(),
+		},
+	}
+	return files, []string{path}, nil
+}
+
+// unknownParameter returns an error if a parameter is not one of the known ones.
+func unknownParameter(parameters map[string]string, known ...string) error {
+	for name := range parameters {
+		isKnown := false
+		for _, k := range known {
+			isKnown = isKnown || name == k
+		}
+		if !isKnown {
+			return errors.Errorf("unknown parameter %q", name)
+		}
+	}
+	return nil
+}
+
+func nvidiaDriverModule(config *bootstrapv1.KubeadmConfig, parameters map[string]string) ([]bootstrapv1.File, []string, error) {
+	if err := unknownParameter(parameters, "version"); err != nil {
+		return nil, nil, err
+	}
+	version := parameters["version"]
+	if !nvidiaDriverVersionRegex.MatchString(version) {
+		return nil, nil, errors.Errorf("invalid version %q, expected a driver branch, e.g. 535", version)
+	}
+	return prerequisiteScript(config, NvidiaDriverPrerequisite, nvidiaDriverScriptTemplate, struct{ Version string }{version})
+}
+
+func containerdNvidiaRuntimeModule(config *bootstrapv1.KubeadmConfig, parameters map[string]string) ([]bootstrapv1.File, []string, error) {
+	if err := unknownParameter(parameters, "setAsDefault"); err != nil {
+		return nil, nil, err
+	}
+	setAsDefault := true
+	if value, ok := parameters["setAsDefault"]; ok {
+		var err error
+		if setAsDefault, err = strconv.ParseBool(value); err != nil {
+			return nil, nil, errors.Errorf("invalid setAsDefault %q, expected true or false", value)
+		}
+	}
+	return prerequisiteScript(config, ContainerdNvidiaRuntimePrerequisite, containerdNvidiaRuntimeScriptTemplate, struct{ SetAsDefault bool }{setAsDefault})
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestPrerequisiteFiles(t *testing.T) {
+	custom := PrerequisiteModuleFunc(func(config *bootstrapv1.KubeadmConfig, parameters map[string]string) ([]bootstrapv1.File, []string, error) {
+		return nil, []string{"echo " + parameters["message"]}, nil
+	})
+	testcases := []struct {
+		name             string
+		prerequisites    []bootstrapv1.Prerequisite
+		osFamily         bootstrapv1.OSFamily
+		expectedCommands []string
+		expectedContent  []string
+		expectErr        bool
+	}{
+		{
+			name: "nothing is installed by default",
+		},
+		{
+			name: "modules are expanded in order",
+			prerequisites: []bootstrapv1.Prerequisite{
+				{Name: NvidiaDriverPrerequisite, Parameters: map[string]string{"version": "535"}},
+				{Name: ContainerdNvidiaRuntimePrerequisite},
+			},
+			expectedCommands: []string{"/usr/local/bin/cabpk-prerequisite-nvidia-driver", "/usr/local/bin/cabpk-prerequisite-containerd-nvidia-runtime"},
+			expectedContent:  []string{"nvidia-driver-535-server", "nvidia-ctk runtime configure --runtime=containerd --set-as-default"},
+		},
+		{
+			name:             "the containerd runtime is not set as default if asked",
+			prerequisites:    []bootstrapv1.Prerequisite{{Name: ContainerdNvidiaRuntimePrerequisite, Parameters: map[string]string{"setAsDefault": "false"}}},
+			expectedCommands: []string{"/usr/local/bin/cabpk-prerequisite-containerd-nvidia-runtime"},
+			expectedContent:  []string{"nvidia-ctk runtime configure --runtime=containerd\n"},
+		},
+		{
+			name:             "registered modules are selected by name",
+			prerequisites:    []bootstrapv1.Prerequisite{{Name: "custom", Parameters: map[string]string{"message": "hello"}}},
+			expectedCommands: []string{"echo hello"},
+		},
+		{
+			name:          "unknown modules are rejected",
+			prerequisites: []bootstrapv1.Prerequisite{{Name: "amd-driver"}},
+			expectErr:     true,
+		},
+		{
+			name:          "invalid driver versions are rejected",
+			prerequisites: []bootstrapv1.Prerequisite{{Name: NvidiaDriverPrerequisite, Parameters: map[string]string{"version": "535; reboot"}}},
+			expectErr:     true,
+		},
+		{
+			name:          "unknown parameters are rejected",
+			prerequisites: []bootstrapv1.Prerequisite{{Name: NvidiaDriverPrerequisite, Parameters: map[string]string{"version": "535", "branch": "server"}}},
+			expectErr:     true,
+		},
+		{
+			name:          "Flatcar is not supported by the bundled modules",
+			prerequisites: []bootstrapv1.Prerequisite{{Name: ContainerdNvidiaRuntimePrerequisite}},
+			osFamily:      bootstrapv1.Flatcar,
+			expectErr:     true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKubeadmConfig(newWorkerMachine(newCluster("cluster")), "worker-join-cfg")
+			config.Spec.Prerequisites = tc.prerequisites
+			config.Spec.OSFamily = tc.osFamily
+			k := &KubeadmConfigReconciler{Log: log.Log, PrerequisiteModules: map[string]PrerequisiteModule{"custom": custom}}
+
+			files, commands, err := k.prerequisiteFiles(config)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error: %v, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(commands, tc.expectedCommands) {
+				t.Errorf("expected commands %v, got %v", tc.expectedCommands, commands)
+			}
+			for i, content := range tc.expectedContent {
+				if i >= len(files) || !strings.Contains(files[i].Content, content) {
+					t.Errorf("expected file %d to contain %q, got %v", i, content, files)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedrbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// nodeBootstrapTokenAuthGroup is the group bootstrap tokens created by CABPK authenticate as.
+	nodeBootstrapTokenAuthGroup = "system:bootstrappers:kubeadm:default-node-token"
+	nodesGroup                  = "system:nodes"
+	clusterInfoConfigMapName    = "cluster-info"
+	clusterInfoRoleName         = "kubeadm:bootstrap-signer-clusterinfo"
+	getNodesClusterRoleName     = "kubeadm:get-nodes"
+)
+
+// ClusterRBACClientFactory support creation of rbac clients for clusters
+type ClusterRBACClientFactory struct {
+	// AllowedExecCommands are the commands exec credential plugins are allowed to run,
+	// for clusters using the ExecAuth workload cluster auth mode.
+	AllowedExecCommands []string
+}
+
+// NewRBACClient returns a new client supporting RbacV1Interface for the cluster
+func (f ClusterRBACClientFactory) NewRBACClient(ctx context.Context, client client.Client, cluster *clusterv1.Cluster) (typedrbacv1.RbacV1Interface, error) {
+	restConfig, err := workloadClusterRESTConfig(ctx, client, cluster, f.AllowedExecCommands)
+	if err != nil {
+		return nil, err
+	}
+
+	return typedrbacv1.NewForConfig(restConfig)
+}
+
+// ensureBootstrapTokenRBAC ensures the RBAC rules usually created by the kubeadm init bootstrap-token phase of the
+// given Kubernetes version exist, so nodes can join with a bootstrap token and have their client certificates
+// automatically approved and rotated.
+func ensureBootstrapTokenRBAC(client typedrbacv1.RbacV1Interface, kubernetesVersion *string) error {
+	clusterRoleBindings := []*rbacv1.ClusterRoleBinding{
+		newGroupClusterRoleBinding("kubeadm:kubelet-bootstrap", "system:node-bootstrapper", nodeBootstrapTokenAuthGroup),
+		newGroupClusterRoleBinding("kubeadm:node-autoapprove-bootstrap", "system:certificates.k8s.io:certificatesigningrequests:nodeclient", nodeBootstrapTokenAuthGroup),
+		newGroupClusterRoleBinding("kubeadm:node-autoapprove-certificate-rotation", "system:certificates.k8s.io:certificatesigningrequests:selfnodeclient", nodesGroup),
+	}
+	if bootstrapTokenSchemaFor(kubernetesVersion).getNodes {
+		clusterRole := &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: getNodesClusterRoleName,
+			},
+			Rules: []rbacv1.PolicyRule{
+				{
+					Verbs:     []string{"get"},
+					APIGroups: []string{""},
+					Resources: []string{"nodes"},
+				},
+			},
+		}
+		if _, err := client.ClusterRoles().Create(clusterRole); err != nil && !apierrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "failed to create ClusterRole %q", clusterRole.Name)
+		}
+		clusterRoleBindings = append(clusterRoleBindings, newGroupClusterRoleBinding(getNodesClusterRoleName, getNodesClusterRoleName, nodeBootstrapTokenAuthGroup))
+	}
+	for _, crb := range clusterRoleBindings {
+		if _, err := client.ClusterRoleBindings().Create(crb); err != nil && !apierrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "failed to create ClusterRoleBinding %q", crb.Name)
+		}
+	}
+
+	// allow anonymous users to read the cluster-info ConfigMap, which is used for bootstrap token discovery
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterInfoRoleName,
+			Namespace: metav1.NamespacePublic,
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				Verbs:         []string{"get"},
+				APIGroups:     []string{""},
+				Resources:     []string{"configmaps"},
+				ResourceNames: []string{clusterInfoConfigMapName},
+			},
+		},
+	}
+	if _, err := client.Roles(metav1.NamespacePublic).Create(role); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "failed to create Role %q", role.Name)
+	}
+
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterInfoRoleName,
+			Namespace: metav1.NamespacePublic,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     clusterInfoRoleName,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind: rbacv1.UserKind,
+				Name: "system:anonymous",
+			},
+		},
+	}
+	if _, err := client.RoleBindings(metav1.NamespacePublic).Create(roleBinding); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "failed to create RoleBinding %q", roleBinding.Name)
+	}
+
+	return nil
+}
+
+func newGroupClusterRoleBinding(name, clusterRole, group string) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     clusterRole,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind: rbacv1.GroupKind,
+				Name: group,
+			},
+		},
+	}
+}
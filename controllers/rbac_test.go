@@ -0,0 +1,80 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEnsureBootstrapTokenRBAC(t *testing.T) {
+	client := fakeclient.NewSimpleClientset().RbacV1()
+
+	// ensure twice to verify the operation is idempotent
+	for i := 0; i < 2; i++ {
+		if err := ensureBootstrapTokenRBAC(client, nil); err != nil {
+			t.Fatalf("Failed to ensure bootstrap token RBAC:\n %+v", err)
+		}
+	}
+
+	expectedClusterRoleBindings := map[string]string{
+		"kubeadm:kubelet-bootstrap":                     nodeBootstrapTokenAuthGroup,
+		"kubeadm:node-autoapprove-bootstrap":            nodeBootstrapTokenAuthGroup,
+		"kubeadm:node-autoapprove-certificate-rotation": nodesGroup,
+	}
+	for name, group := range expectedClusterRoleBindings {
+		crb, err := client.ClusterRoleBindings().Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected ClusterRoleBinding %q to exist: %v", name, err)
+		}
+		if len(crb.Subjects) != 1 || crb.Subjects[0].Name != group {
+			t.Fatalf("expected ClusterRoleBinding %q to bind group %q, got %v", name, group, crb.Subjects)
+		}
+	}
+
+	if _, err := client.ClusterRoleBindings().Get(getNodesClusterRoleName, metav1.GetOptions{}); err == nil {
+		t.Fatalf("expected ClusterRoleBinding %q not to exist for an unknown Kubernetes version", getNodesClusterRoleName)
+	}
+
+	if _, err := client.Roles(metav1.NamespacePublic).Get(clusterInfoRoleName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected Role %q to exist: %v", clusterInfoRoleName, err)
+	}
+	if _, err := client.RoleBindings(metav1.NamespacePublic).Get(clusterInfoRoleName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected RoleBinding %q to exist: %v", clusterInfoRoleName, err)
+	}
+}
+
+func TestEnsureBootstrapTokenRBACGetNodes(t *testing.T) {
+	client := fakeclient.NewSimpleClientset().RbacV1()
+	kubernetesVersion := "v1.24.3"
+
+	if err := ensureBootstrapTokenRBAC(client, &kubernetesVersion); err != nil {
+		t.Fatalf("Failed to ensure bootstrap token RBAC:\n %+v", err)
+	}
+	if _, err := client.ClusterRoles().Get(getNodesClusterRoleName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected ClusterRole %q to exist: %v", getNodesClusterRoleName, err)
+	}
+	crb, err := client.ClusterRoleBindings().Get(getNodesClusterRoleName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected ClusterRoleBinding %q to exist: %v", getNodesClusterRoleName, err)
+	}
+	if len(crb.Subjects) != 1 || crb.Subjects[0].Name != nodeBootstrapTokenAuthGroup {
+		t.Fatalf("expected ClusterRoleBinding %q to bind group %q, got %v", getNodesClusterRoleName, nodeBootstrapTokenAuthGroup, crb.Subjects)
+	}
+}
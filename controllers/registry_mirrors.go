@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+const (
+	containerdConfigPath = "/etc/containerd/config.toml"
+	dockerDaemonPath     = "/etc/docker/daemon.json"
+
+	// dockerHubRegistry is the only registry docker supports mirrors for.
+	dockerHubRegistry = "docker.io"
+)
+
+// registryMirrorFiles renders the registry mirrors defined in the config into container runtime
+// configuration files, along with the commands required to reload the runtimes that are already running.
+func registryMirrorFiles(mirrors map[string][]string) ([]bootstrapv1.File, []string, error) {
+	if len(mirrors) == 0 {
+		return nil, nil, nil
+	}
+
+	registries := make([]string, 0, len(mirrors))
+	for registry, endpoints := range mirrors {
+		if registry == "" {
+			return nil, nil, errors.New("registry mirror host must not be empty")
+		}
+		if len(endpoints) == 0 {
+			return nil, nil, errors.Errorf("registry %q must define at least one mirror endpoint", registry)
+		}
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+
+	var containerd strings.Builder
+	for i, registry := range registries {
+		if i > 0 {
+			containerd.WriteString("\n")
+		}
+		quoted := make([]string, 0, len(mirrors[registry]))
+		for _, endpoint := range mirrors[registry] {
+			quoted = append(quoted, fmt.Sprintf("%q", endpoint))
+		}
+		fmt.Fprintf(&containerd, "[plugins.cri.registry.mirrors.%q]\n", registry)
+		fmt.Fprintf(&containerd, "  endpoint = [%s]\n", strings.Join(quoted, ", "))
+	}
+
+	files := []bootstrapv1.File{
+		{
+			Path:        containerdConfigPath,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     containerd.String(),
+		},
+	}
+	commands := []string{"systemctl try-restart containerd"}
+
+	if endpoints, ok := mirrors[dockerHubRegistry]; ok {
+		daemon, err := json.MarshalIndent(map[string][]string{"registry-mirrors": endpoints}, "", "  ")
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to render docker daemon configuration")
+		}
+		files = append(files, bootstrapv1.File{
+			Path:        dockerDaemonPath,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     string(daemon) + "\n",
+		})
+		commands = append(commands, "systemctl try-restart docker")
+	}
+
+	return files, commands, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+)
+
+func TestRegistryMirrorFiles(t *testing.T) {
+	tests := []struct {
+		name               string
+		mirrors            map[string][]string
+		expectedContainerd string
+		expectedDocker     string
+		expectedCommands   int
+		expectError        bool
+	}{
+		{
+			name: "no mirrors",
+		},
+		{
+			name: "containerd only",
+			mirrors: map[string][]string{
+				"k8s.gcr.io":  {"https://mirror.example.com"},
+				"quay.io":     {"https://quay-a.example.com", "https://quay-b.example.com"},
+				"registry.io": {"https://registry.example.com"},
+			},
+			expectedContainerd: `[plugins.cri.registry.mirrors."k8s.gcr.io"]
+  endpoint = ["https://mirror.example.com"]
+
+[plugins.cri.registry.mirrors."quay.io"]
+  endpoint = ["https://quay-a.example.com", "https://quay-b.example.com"]
+
+[plugins.cri.registry.mirrors."registry.io"]
+  endpoint = ["https://registry.example.com"]
+`,
+			expectedCommands: 1,
+		},
+		{
+			name: "docker hub",
+			mirrors: map[string][]string{
+				"docker.io": {"https://hub.example.com"},
+			},
+			expectedContainerd: `[plugins.cri.registry.mirrors."docker.io"]
+  endpoint = ["https://hub.example.com"]
+`,
+			expectedDocker: `{
+  "registry-mirrors": [
+    "https://hub.example.com"
+  ]
+}
+`,
+			expectedCommands: 2,
+		},
+		{
+			name: "registry without endpoints",
+			mirrors: map[string][]string{
+				"k8s.gcr.io": {},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			files, commands, err := registryMirrorFiles(tc.mirrors)
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(commands) != tc.expectedCommands {
+				t.Fatalf("expected %d commands, got %v", tc.expectedCommands, commands)
+			}
+
+			contents := map[string]string{}
+			for _, f := range files {
+				contents[f.Path] = f.Content
+			}
+			if contents[containerdConfigPath] != tc.expectedContainerd {
+				t.Errorf("unexpected containerd config:\n%s\nexpected:\n%s", contents[containerdConfigPath], tc.expectedContainerd)
+			}
+			if contents[dockerDaemonPath] != tc.expectedDocker {
+				t.Errorf("unexpected docker daemon config:\n%s\nexpected:\n%s", contents[dockerDaemonPath], tc.expectedDocker)
+			}
+		})
+	}
+}
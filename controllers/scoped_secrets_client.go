@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	typedrbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ScopedSecretsUser is the user scoped secrets clients create secrets in workload clusters as. It is only allowed
+	// to create the secrets of the kube-system namespace, by the Role of the same name.
+	ScopedSecretsUser = "cabpk:secrets-manager"
+
+	// scopedSecretsCertificateTTL is the validity of the client certificates of scoped secrets clients. They are
+	// renewed once half of it has passed.
+	scopedSecretsCertificateTTL = time.Hour
+)
+
+// scopedSecretsRules are the rules of the Role of the ScopedSecretsUser. Listing or reading the secrets of
+// kube-system, which hold the service account tokens of the controllers of the cluster, would be equivalent to
+// cluster-admin, and the names of the secrets CABPK manages are not known in advance, so the user may only create
+// them; RBAC cannot restrict the creation of secrets by name or type.
+var scopedSecretsRules = []rbacv1.PolicyRule{
+	{
+		Verbs:     []string{"create"},
+		APIGroups: []string{""},
+		Resources: []string{"secrets"},
+	},
+}
+
+// scopedSecretsClient creates secrets with the client of the ScopedSecretsUser, and makes the other calls, e.g. the
+// sweeping and refresh of bootstrap tokens, with the admin client of the cluster.
+type scopedSecretsClient struct {
+	typedcorev1.SecretInterface
+	scoped typedcorev1.SecretInterface
+}
+
+// Create creates the secret with the client of the ScopedSecretsUser.
+func (c scopedSecretsClient) Create(s *corev1.Secret) (*corev1.Secret, error) {
+	return c.scoped.Create(s)
+}
+
+// scopedCredentials caches the client certificates of the scoped secrets clients by cluster UID, so that a key is not
+// generated for every reconciliation. A cluster has an entry once the Role of the ScopedSecretsUser was applied.
+var scopedCredentials = &scopedCredentialCache{keyPairs: map[types.UID]*scopedKeyPair{}}
+
+type scopedKeyPair struct {
+	keyPair   *certs.KeyPair
+	expiresAt time.Time
+}
+
+type scopedCredentialCache struct {
+	sync.Mutex
+	keyPairs map[types.UID]*scopedKeyPair
+}
+
+// scopedSecretsRESTConfig returns a copy of the admin configuration of the workload cluster authenticating as the
+// ScopedSecretsUser with a client certificate signed by the cluster CA. The admin configuration is only used to apply
+// the Role of the user the first time a cluster is seen. The CA key of the cluster is required.
+//
+// The cache is not locked during the calls to the clusters, so that an unresponsive cluster does not block the
+// reconciliations of the other ones; concurrent reconciliations of a cluster may both sign a certificate, and the last
+// one is kept.
+func scopedSecretsRESTConfig(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, admin *rest.Config) (*rest.Config, error) {
+	scopedCredentials.Lock()
+	cached := scopedCredentials.keyPairs[cluster.UID]
+	scopedCredentials.Unlock()
+
+	if cached == nil {
+		rbacClient, err := typedrbacv1.NewForConfig(admin)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyRole(rbacClient, ScopedSecretsUser, scopedSecretsRules, rbacv1.Subject{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: ScopedSecretsUser}); err != nil {
+			return nil, errors.Wrap(err, "failed to apply the Role of the scoped secrets client")
+		}
+	}
+	if cached == nil || time.Until(cached.expiresAt) < scopedSecretsCertificateTTL/2 {
+		certificates := internalcluster.Certificates{&internalcluster.Certificate{Purpose: internalcluster.ClusterCA}}
+		if err := certsecret.Lookup(ctx, c, cluster, certificates); err != nil {
+			return nil, errors.Wrap(err, "failed to look up the cluster CA")
+		}
+		if err := certificates.EnsureAllExist(); err != nil {
+			return nil, errors.Wrap(err, "the cluster CA and its key are required by the scoped secrets client")
+		}
+		keyPair, err := certificates.GetByPurpose(internalcluster.ClusterCA).NewSignedClientKeyPair(pkix.Name{CommonName: ScopedSecretsUser}, scopedSecretsCertificateTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to sign client certificate for %q", ScopedSecretsUser)
+		}
+		cached = &scopedKeyPair{keyPair: keyPair, expiresAt: time.Now().Add(scopedSecretsCertificateTTL)}
+
+		scopedCredentials.Lock()
+		scopedCredentials.keyPairs[cluster.UID] = cached
+		scopedCredentials.Unlock()
+	}
+
+	// the transport, rate limiting and circuit breaker of the admin configuration are kept, but none of its credentials
+	config := rest.CopyConfig(admin)
+	config.BearerToken, config.BearerTokenFile, config.Username, config.Password = "", "", "", ""
+	config.AuthProvider, config.AuthConfigPersister, config.ExecProvider = nil, nil, nil
+	config.Impersonate = rest.ImpersonationConfig{}
+	config.TLSClientConfig.CertFile, config.TLSClientConfig.KeyFile = "", ""
+	config.TLSClientConfig.CertData, config.TLSClientConfig.KeyData = cached.keyPair.Cert, cached.keyPair.Key
+	return config, nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+// rbacServer is a fake API server recording the Roles and RoleBindings created with it. Nothing exists beforehand.
+type rbacServer struct {
+	sync.Mutex
+	created []string
+}
+
+func (s *rbacServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+		return
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	s.Lock()
+	s.created = append(s.created, req.URL.Path)
+	s.Unlock()
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(body)
+}
+
+func TestScopedSecretsRESTConfig(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.UID = types.UID("scoped-secrets-cluster")
+	defer func() {
+		scopedCredentials.Lock()
+		delete(scopedCredentials.keyPairs, cluster.UID)
+		scopedCredentials.Unlock()
+	}()
+	config := newControlPlaneInitKubeadmConfig(newControlPlaneMachine(cluster, "control-plane"), "control-plane-cfg")
+	myclient := newFakeClientWithScheme(setupScheme(), append(createSecrets(t, cluster, config), cluster)...)
+
+	server := &rbacServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	admin := &rest.Config{Host: ts.URL, BearerToken: "admin-token"}
+
+	scoped, err := scopedSecretsRESTConfig(context.Background(), myclient, cluster, admin)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if len(server.created) != 2 {
+		t.Errorf("expected the Role and RoleBinding of the scoped user to be created, got %v", server.created)
+	}
+	if scoped.BearerToken != "" || scoped.Host != ts.URL || admin.BearerToken != "admin-token" {
+		t.Errorf("expected the admin credentials to be replaced in a copy, got %+v", scoped)
+	}
+	clientCert, err := certs.DecodeCertPEM(scoped.TLSClientConfig.CertData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clientCert.Subject.CommonName != ScopedSecretsUser || len(clientCert.Subject.Organization) != 0 {
+		t.Errorf("expected a certificate of the scoped user without groups, got %v", clientCert.Subject)
+	}
+
+	again, err := scopedSecretsRESTConfig(context.Background(), myclient, cluster, admin)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if !bytes.Equal(again.TLSClientConfig.CertData, scoped.TLSClientConfig.CertData) || len(server.created) != 2 {
+		t.Error("expected the certificate and the Role to be reused")
+	}
+}
+
+func TestScopedSecretsRESTConfigRequiresCAKey(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.UID = types.UID("scoped-secrets-external-cluster")
+	defer func() {
+		scopedCredentials.Lock()
+		delete(scopedCredentials.keyPairs, cluster.UID)
+		scopedCredentials.Unlock()
+	}()
+
+	ts := httptest.NewServer(&rbacServer{})
+	defer ts.Close()
+	if _, err := scopedSecretsRESTConfig(context.Background(), newFakeClientWithScheme(setupScheme(), cluster), cluster, &rest.Config{Host: ts.URL}); err == nil {
+		t.Error("expected an error without the cluster CA")
+	}
+}
+
+func TestScopedSecretsRulesOnlyCreate(t *testing.T) {
+	for _, rule := range scopedSecretsRules {
+		if len(rule.Verbs) != 1 || rule.Verbs[0] != "create" {
+			t.Errorf("expected the scoped user to only create secrets, got %v", rule.Verbs)
+		}
+	}
+}
+
+func TestScopedSecretsClient(t *testing.T) {
+	admin := fakeclient.NewSimpleClientset().CoreV1().Secrets(metav1.NamespaceSystem)
+	scoped := fakeclient.NewSimpleClientset().CoreV1().Secrets(metav1.NamespaceSystem)
+	secrets := scopedSecretsClient{SecretInterface: admin, scoped: scoped}
+
+	if _, err := secrets.Create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-abcdef"}}); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if _, err := scoped.Get("bootstrap-token-abcdef", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the secret to be created with the scoped client, got %v", err)
+	}
+	if err := secrets.Delete("bootstrap-token-abcdef", nil); err == nil {
+		t.Error("expected the secret to be deleted with the admin client")
+	}
+}
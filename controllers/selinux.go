@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+)
+
+const selinuxConfigPath = "/etc/selinux/config"
+
+// selinuxRelabelDirs are the directories written by kubeadm, the kubelet and the container runtime whose default
+// SELinux contexts are restored when relabeling.
+var selinuxRelabelDirs = []string{
+	"/etc/kubernetes",
+	"/var/lib/kubelet",
+	"/var/lib/etcd",
+	"/etc/cni",
+	"/opt/cni",
+}
+
+// selinuxCommands returns the commands to be run before kubeadm to set the SELinux mode and restore the default
+// SELinux contexts of the given files, as cloud-init writes files without relabeling them.
+// The commands are no-ops on machines without SELinux.
+func selinuxCommands(selinux *bootstrapv1.SELinux, files []bootstrapv1.File) ([]string, error) {
+	if selinux == nil {
+		return nil, nil
+	}
+
+	var commands []string
+	switch selinux.Mode {
+	case "":
+	case bootstrapv1.SELinuxEnforcing:
+		commands = append(commands, "if selinuxenabled; then setenforce 1; fi")
+	case bootstrapv1.SELinuxPermissive, bootstrapv1.SELinuxDisabled:
+		commands = append(commands, "if selinuxenabled; then setenforce 0; fi")
+	default:
+		return nil, errors.Errorf("unsupported SELinux mode %q", selinux.Mode)
+	}
+	if selinux.Mode != "" {
+		commands = append(commands, "if [ -f "+selinuxConfigPath+" ]; then sed -i 's/^SELINUX=.*/SELINUX="+string(selinux.Mode)+"/' "+selinuxConfigPath+"; fi")
+	}
+
+	if !selinux.Relabel {
+		if len(selinux.RelabelPaths) > 0 {
+			return nil, errors.New("SELinux relabel paths require relabel to be enabled")
+		}
+		return commands, nil
+	}
+
+	paths := append([]string{}, selinuxRelabelDirs...)
+	for _, p := range selinux.RelabelPaths {
+		if !path.IsAbs(p) || strings.Contains(p, "\n") {
+			return nil, errors.Errorf("invalid SELinux relabel path %q: must be an absolute path", p)
+		}
+		paths = append(paths, p)
+	}
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+
+	seen := map[string]bool{}
+	args := []string{"restorecon", "-R", "-i"}
+	for _, p := range paths {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		args = append(args, cloudinit.ShellQuote(p))
+	}
+	commands = append(commands, "if selinuxenabled; then "+strings.Join(args, " ")+"; fi")
+	return commands, nil
+}
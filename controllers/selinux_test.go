@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+func TestSELinuxCommands(t *testing.T) {
+	files := []bootstrapv1.File{
+		{Path: "/etc/kubernetes/pki/ca.crt"},
+		{Path: "/opt/my file"},
+	}
+	tests := []struct {
+		name        string
+		selinux     *bootstrapv1.SELinux
+		expected    []string
+		expectError bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:    "enforcing",
+			selinux: &bootstrapv1.SELinux{Mode: bootstrapv1.SELinuxEnforcing},
+			expected: []string{
+				"if selinuxenabled; then setenforce 1; fi",
+				"if [ -f /etc/selinux/config ]; then sed -i 's/^SELINUX=.*/SELINUX=enforcing/' /etc/selinux/config; fi",
+			},
+		},
+		{
+			name:    "disabled",
+			selinux: &bootstrapv1.SELinux{Mode: bootstrapv1.SELinuxDisabled},
+			expected: []string{
+				"if selinuxenabled; then setenforce 0; fi",
+				"if [ -f /etc/selinux/config ]; then sed -i 's/^SELINUX=.*/SELINUX=disabled/' /etc/selinux/config; fi",
+			},
+		},
+		{
+			name:    "relabel",
+			selinux: &bootstrapv1.SELinux{Relabel: true, RelabelPaths: []string{"/srv/data", "/var/lib/kubelet"}},
+			expected: []string{
+				"if selinuxenabled; then restorecon -R -i '/etc/kubernetes' '/var/lib/kubelet' '/var/lib/etcd' '/etc/cni' '/opt/cni' '/srv/data' '/etc/kubernetes/pki/ca.crt' '/opt/my file'; fi",
+			},
+		},
+		{
+			name:        "unsupported mode",
+			selinux:     &bootstrapv1.SELinux{Mode: "strict"},
+			expectError: true,
+		},
+		{
+			name:        "relative relabel path",
+			selinux:     &bootstrapv1.SELinux{Relabel: true, RelabelPaths: []string{"srv"}},
+			expectError: true,
+		},
+		{
+			name:        "relabel paths without relabel",
+			selinux:     &bootstrapv1.SELinux{RelabelPaths: []string{"/srv"}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands, err := selinuxCommands(tt.selinux, files)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if !reflect.DeepEqual(commands, tt.expected) {
+				t.Errorf("expected commands %q, got %q", tt.expected, commands)
+			}
+		})
+	}
+}
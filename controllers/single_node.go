@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util"
+)
+
+// localPathProvisionerDir is the default directory the local-path storage provisioner creates volumes in.
+const localPathProvisionerDir = "/opt/local-path-provisioner"
+
+// validateSingleNode returns an error if the config is in single node mode but its Machine would not initialize
+// the control plane, as it would otherwise wait for a control plane that will never exist.
+func validateSingleNode(cluster *clusterv1.Cluster, machine *clusterv1.Machine, config *bootstrapv1.KubeadmConfig) error {
+	if !config.Spec.SingleNode {
+		return nil
+	}
+	if !util.IsControlPlaneMachine(machine) {
+		return errors.Errorf("single node mode requires Machine %s/%s to be a control plane machine", machine.Namespace, machine.Name)
+	}
+	if externalControlPlane(cluster) {
+		return errors.Errorf("single node mode is not supported for Cluster %s/%s, as its control plane is external", cluster.Namespace, cluster.Name)
+	}
+	if cluster.Status.ControlPlaneInitialized {
+		return errors.Errorf("single node mode requires Machine %s/%s to initialize the control plane, but Cluster %s/%s is already initialized", machine.Namespace, machine.Name, cluster.Namespace, cluster.Name)
+	}
+	return nil
+}
+
+// controlPlaneNodePolicy returns the control plane node policy of the config, untainting the node in single node mode.
+func controlPlaneNodePolicy(config *bootstrapv1.KubeadmConfig) *bootstrapv1.ControlPlaneNodePolicy {
+	if !config.Spec.SingleNode {
+		return config.Spec.ControlPlaneNodes
+	}
+	policy := &bootstrapv1.ControlPlaneNodePolicy{}
+	if config.Spec.ControlPlaneNodes != nil {
+		policy = config.Spec.ControlPlaneNodes.DeepCopy()
+	}
+	policy.Untainted = true
+	return policy
+}
+
+// singleNodeCommands returns the commands to be run before kubeadm to create the prerequisites of single node clusters.
+func singleNodeCommands(config *bootstrapv1.KubeadmConfig) []string {
+	if !config.Spec.SingleNode {
+		return nil
+	}
+	return []string{"mkdir -p " + localPathProvisionerDir}
+}
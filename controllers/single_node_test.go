@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+func TestValidateSingleNode(t *testing.T) {
+	cluster := newCluster("cluster")
+	initializedCluster := newCluster("cluster")
+	initializedCluster.Status.ControlPlaneInitialized = true
+
+	controlPlane := newControlPlaneMachine(cluster, "control-plane")
+	worker := newWorkerMachine(cluster)
+
+	singleNode := &bootstrapv1.KubeadmConfig{Spec: bootstrapv1.KubeadmConfigSpec{SingleNode: true}}
+
+	if err := validateSingleNode(cluster, worker, &bootstrapv1.KubeadmConfig{}); err != nil {
+		t.Errorf("expected nil without single node mode, got error %v", err)
+	}
+	if err := validateSingleNode(cluster, controlPlane, singleNode); err != nil {
+		t.Errorf("expected nil for the first control plane machine, got error %v", err)
+	}
+	if err := validateSingleNode(cluster, worker, singleNode); err == nil {
+		t.Error("expected error for a worker machine, got nil")
+	}
+	if err := validateSingleNode(initializedCluster, controlPlane, singleNode); err == nil {
+		t.Error("expected error for an initialized cluster, got nil")
+	}
+}
+
+func TestControlPlaneNodePolicySingleNode(t *testing.T) {
+	config := &bootstrapv1.KubeadmConfig{
+		Spec: bootstrapv1.KubeadmConfigSpec{
+			SingleNode:        true,
+			ControlPlaneNodes: &bootstrapv1.ControlPlaneNodePolicy{Labels: map[string]string{"zone": "a"}},
+		},
+	}
+
+	policy := controlPlaneNodePolicy(config)
+	if !policy.Untainted || policy.Labels["zone"] != "a" {
+		t.Errorf("expected single node clusters to be untainted and keep their labels, got %+v", policy)
+	}
+	if config.Spec.ControlPlaneNodes.Untainted {
+		t.Error("expected the config not to be modified")
+	}
+	if commands := singleNodeCommands(config); len(commands) != 1 || commands[0] != "mkdir -p "+localPathProvisionerDir {
+		t.Errorf("expected the local-path provisioner directory to be created, got %v", commands)
+	}
+}
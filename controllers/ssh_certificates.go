@@ -0,0 +1,176 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultSSHUserCertificateTTL is the default validity of signed SSH user certificates.
+	DefaultSSHUserCertificateTTL = time.Hour
+
+	// MaxSSHUserCertificateTTL is the maximum validity of signed SSH user certificates, which cannot be revoked.
+	MaxSSHUserCertificateTTL = 24 * time.Hour
+
+	// DefaultSSHHostCertificateValidity is the validity of SSH host certificates if Certificates.ExpiryDays is unset.
+	DefaultSSHHostCertificateValidity = 365 * 24 * time.Hour
+
+	// The host key is written outside of the /etc/ssh/ssh_host_*key* files, which cloud-init deletes and regenerates
+	// on first boot after the files are written.
+	sshDir                 = "/etc/ssh/cabpk"
+	sshHostKeyPath         = sshDir + "/ssh_host_ecdsa_key"
+	sshHostCertificatePath = sshHostKeyPath + "-cert.pub"
+	sshUserCAPath          = sshDir + "/user_ca.pub"
+	sshdConfigPath         = sshDir + "/sshd_config"
+
+	// sshdConfig is prepended to the sshd configuration, as the first value of an option wins and HostKey is not
+	// allowed in the Match blocks possibly ending it. sshd only loads the listed host keys once one is listed.
+	sshdConfig = "HostKey " + sshHostKeyPath + "\n" +
+		"HostCertificate " + sshHostCertificatePath + "\n" +
+		"TrustedUserCAKeys " + sshUserCAPath + "\n"
+)
+
+// sshHostFiles signs a host key for the machine with the SSH certificate authority of the cluster, generating the
+// certificate authority if needed, and returns the files and commands configuring sshd to use it and to trust user
+// certificates signed by the certificate authority.
+func (r *KubeadmConfigReconciler) sshHostFiles(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions, name *nodeName, validity time.Duration) ([]bootstrapv1.File, []string, error) {
+	if config.Spec.SSH == nil {
+		return nil, nil, nil
+	}
+
+	principals := sshHostPrincipals(config.Spec.SSH, nodeRegistration, name)
+	if len(principals) == 0 {
+		return nil, nil, errors.New("SSH host certificates require the node name to be known in advance or SSH.HostPrincipals to be set")
+	}
+
+	certificates := internalcluster.NewSSHCertificates()
+	if err := certsecret.LookupOrGenerate(ctx, r.Client, cluster, config, certificates); err != nil {
+		return nil, nil, errors.Wrap(err, "unable to lookup or create the SSH certificate authority")
+	}
+	ca := certificates.GetByPurpose(internalcluster.SSHCA)
+
+	if validity == 0 {
+		validity = DefaultSSHHostCertificateValidity
+	}
+	hostKey, err := ca.NewSignedSSHHostKey(principals, validity)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to sign SSH host key")
+	}
+
+	files := []bootstrapv1.File{
+		{
+			Path:        sshHostKeyPath,
+			Owner:       "root:root",
+			Permissions: "0600",
+			Content:     string(hostKey.Key),
+		},
+		{
+			Path:        sshHostCertificatePath,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     string(hostKey.Cert),
+		},
+		{
+			Path:        sshUserCAPath,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     string(ca.KeyPair.Cert),
+		},
+		{
+			Path:        sshdConfigPath,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     sshdConfig,
+		},
+	}
+	commands := []string{
+		"grep -q '^HostCertificate " + sshHostCertificatePath + "$' /etc/ssh/sshd_config || { cat " + sshdConfigPath + " /etc/ssh/sshd_config > /etc/ssh/sshd_config.cabpk && mv /etc/ssh/sshd_config.cabpk /etc/ssh/sshd_config; }",
+		osProfile(config).restartSSHCommand,
+	}
+	return files, commands, nil
+}
+
+// sshHostPrincipals returns the names the host certificate of the machine is valid for: the node name, hostname and
+// FQDN of the machine if they are known in advance, then the configured principals.
+func sshHostPrincipals(spec *bootstrapv1.SSHCertificates, nodeRegistration *kubeadmv1beta1.NodeRegistrationOptions, name *nodeName) []string {
+	candidates := []string{nodeRegistration.Name}
+	if name != nil {
+		candidates = append(candidates, name.Name, name.Hostname, name.FQDN)
+	}
+	candidates = append(candidates, spec.HostPrincipals...)
+
+	var principals []string
+	seen := map[string]bool{}
+	for _, p := range candidates {
+		// names rendered by cloud-init from its data source are only known on the machine
+		if p == "" || strings.Contains(p, "{{") || seen[p] {
+			continue
+		}
+		seen[p] = true
+		principals = append(principals, p)
+	}
+	return principals
+}
+
+// SSHUserCertificateOptions are the options of a signed SSH user certificate.
+type SSHUserCertificateOptions struct {
+	// PublicKey is the public key to sign, in authorized_keys format.
+	PublicKey []byte
+	// KeyID identifies the certificate in the sshd logs, e.g. the name of the person requesting it.
+	KeyID string
+	// Principals are the users the certificate can log in as.
+	Principals []string
+	// TTL is the validity of the certificate. Defaults to DefaultSSHUserCertificateTTL.
+	TTL time.Duration
+}
+
+// SignSSHUserCertificate signs a short-lived SSH user certificate with the SSH certificate authority of the cluster,
+// accepted by the machines bootstrapped with SSH set.
+func SignSSHUserCertificate(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, opts SSHUserCertificateOptions) ([]byte, error) {
+	if opts.KeyID == "" {
+		return nil, errors.New("a key ID is required")
+	}
+	if len(opts.Principals) == 0 {
+		return nil, errors.New("at least one principal is required")
+	}
+	if opts.TTL == 0 {
+		opts.TTL = DefaultSSHUserCertificateTTL
+	}
+	if opts.TTL < 0 || opts.TTL > MaxSSHUserCertificateTTL {
+		return nil, errors.Errorf("the TTL must be positive and at most %s, got %s", MaxSSHUserCertificateTTL, opts.TTL)
+	}
+
+	certificates := internalcluster.NewSSHCertificates()
+	if err := certsecret.Lookup(ctx, c, cluster, certificates); err != nil {
+		return nil, errors.Wrap(err, "failed to look up the SSH certificate authority")
+	}
+	if err := certificates.EnsureAllExist(); err != nil {
+		return nil, errors.Wrapf(err, "cluster %s/%s has no SSH certificate authority", cluster.Namespace, cluster.Name)
+	}
+	return certificates.GetByPurpose(internalcluster.SSHCA).SignSSHUserKey(opts.PublicKey, opts.KeyID, opts.Principals, opts.TTL)
+}
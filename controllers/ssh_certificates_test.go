@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestSSHHostPrincipals(t *testing.T) {
+	spec := &bootstrapv1.SSHCertificates{HostPrincipals: []string{"worker-0.example.com", "10.0.0.1"}}
+
+	principals := sshHostPrincipals(spec, &kubeadmv1beta1.NodeRegistrationOptions{Name: "{{ ds.meta_data.hostname }}"}, nil)
+	if expected := []string{"worker-0.example.com", "10.0.0.1"}; !reflect.DeepEqual(principals, expected) {
+		t.Errorf("expected %v, got %v", expected, principals)
+	}
+
+	name := &nodeName{Name: "worker-0", Hostname: "worker-0", FQDN: "worker-0.example.com"}
+	principals = sshHostPrincipals(spec, &kubeadmv1beta1.NodeRegistrationOptions{Name: "worker-0"}, name)
+	if expected := []string{"worker-0", "worker-0.example.com", "10.0.0.1"}; !reflect.DeepEqual(principals, expected) {
+		t.Errorf("expected %v, got %v", expected, principals)
+	}
+}
+
+func TestSSHHostFiles(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+	myclient := newFakeClientWithScheme(setupScheme(), cluster, config)
+	k := &KubeadmConfigReconciler{Log: log.Log, Client: myclient}
+	ctx := context.Background()
+
+	files, commands, err := k.sshHostFiles(ctx, cluster, config, &config.Spec.JoinConfiguration.NodeRegistration, nil, 0)
+	if err != nil || len(files) != 0 || len(commands) != 0 {
+		t.Fatalf("expected nothing without SSH, got %+v %v %v", files, commands, err)
+	}
+
+	config.Spec.SSH = &bootstrapv1.SSHCertificates{}
+	if _, _, err := k.sshHostFiles(ctx, cluster, config, &config.Spec.JoinConfiguration.NodeRegistration, nil, 0); err == nil {
+		t.Fatal("expected an error without principals")
+	}
+
+	config.Spec.JoinConfiguration.NodeRegistration.Name = "worker-0"
+	files, commands, err = k.sshHostFiles(ctx, cluster, config, &config.Spec.JoinConfiguration.NodeRegistration, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 || files[0].Path != sshHostKeyPath || files[0].Permissions != "0600" {
+		t.Fatalf("unexpected files %+v", files)
+	}
+	if len(commands) != 2 || !strings.Contains(commands[0], sshdConfigPath) {
+		t.Errorf("unexpected commands %v", commands)
+	}
+
+	// the certificate authority is generated once and shared by the machines of the cluster
+	certificates := internalcluster.NewSSHCertificates()
+	if err := certsecret.Lookup(ctx, myclient, cluster, certificates); err != nil {
+		t.Fatal(err)
+	}
+	if err := certificates.EnsureAllExist(); err != nil {
+		t.Fatalf("expected the SSH CA secret to be created: %v", err)
+	}
+	if files[2].Content != string(certificates.GetByPurpose(internalcluster.SSHCA).KeyPair.Cert) {
+		t.Error("expected the user CA file to hold the SSH CA public key")
+	}
+	if _, _, err := k.sshHostFiles(ctx, cluster, config, &config.Spec.JoinConfiguration.NodeRegistration, nil, 0); err != nil {
+		t.Fatalf("expected the existing SSH CA to be reused: %v", err)
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(files[1].Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, ok := pub.(*ssh.Certificate); !ok || cert.CertType != ssh.HostCert || !reflect.DeepEqual(cert.ValidPrincipals, []string{"worker-0"}) {
+		t.Errorf("unexpected host certificate %+v", pub)
+	}
+}
+
+func TestSignSSHUserCertificate(t *testing.T) {
+	cluster := newCluster("cluster")
+	myclient := newFakeClientWithScheme(setupScheme(), cluster)
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := SSHUserCertificateOptions{
+		PublicKey:  ssh.MarshalAuthorizedKey(publicKey),
+		KeyID:      "alice",
+		Principals: []string{"root"},
+	}
+	if _, err := SignSSHUserCertificate(ctx, myclient, cluster, opts); err == nil {
+		t.Fatal("expected an error without SSH CA")
+	}
+
+	certificates := internalcluster.NewSSHCertificates()
+	if err := certsecret.LookupOrGenerate(ctx, myclient, cluster, newWorkerJoinKubeadmConfig(newWorkerMachine(cluster)), certificates); err != nil {
+		t.Fatal(err)
+	}
+	out, err := SignSSHUserCertificate(ctx, myclient, cluster, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, ok := pub.(*ssh.Certificate); !ok || cert.CertType != ssh.UserCert || cert.KeyId != "alice" {
+		t.Errorf("unexpected user certificate %+v", pub)
+	}
+
+	opts.TTL = 2 * MaxSSHUserCertificateTTL
+	if _, err := SignSSHUserCertificate(ctx, myclient, cluster, opts); err == nil {
+		t.Error("expected an error with a TTL over the maximum")
+	}
+}
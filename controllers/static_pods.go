@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// staticPodManifestsDir is the directory the kubelet watches for static pod manifests.
+	staticPodManifestsDir = "/etc/kubernetes/manifests"
+)
+
+// resolveStaticPodManifests converts the static pod manifests defined in the config into files to be written
+// into the static pod manifest directory. Manifests referencing a secret are looked up in the config namespace.
+func (r *KubeadmConfigReconciler) resolveStaticPodManifests(ctx context.Context, config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, error) {
+	files := make([]bootstrapv1.File, 0, len(config.Spec.StaticPodManifests))
+	for _, manifest := range config.Spec.StaticPodManifests {
+		if manifest.Name == "" {
+			return nil, errors.New("static pod manifest name must not be empty")
+		}
+		// the name is a path segment of the static pod manifest directory, it must not contain / or ..
+		if errs := validation.IsDNS1123Subdomain(manifest.Name); len(errs) > 0 {
+			return nil, errors.Errorf("invalid static pod manifest name %q: %s", manifest.Name, strings.Join(errs, ", "))
+		}
+		if (manifest.Content != "") == (manifest.ContentFrom != nil) {
+			return nil, errors.Errorf("static pod manifest %q must define exactly one of content or contentFrom", manifest.Name)
+		}
+
+		content := manifest.Content
+		if manifest.ContentFrom != nil {
+			s := &corev1.Secret{}
+			key := client.ObjectKey{Namespace: config.Namespace, Name: manifest.ContentFrom.Name}
+			if err := r.Get(ctx, key, s); err != nil {
+				return nil, errors.Wrapf(err, "failed to get secret %s for static pod manifest %q", key, manifest.Name)
+			}
+			data, ok := s.Data[manifest.ContentFrom.Key]
+			if !ok {
+				return nil, errors.Errorf("secret %s does not contain key %q for static pod manifest %q", key, manifest.ContentFrom.Key, manifest.Name)
+			}
+			content = string(data)
+		}
+
+		files = append(files, bootstrapv1.File{
+			Path:        filepath.Join(staticPodManifestsDir, manifest.Name+".yaml"),
+			Owner:       "root:root",
+			Permissions: "0600",
+			Content:     content,
+		})
+	}
+	return files, nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_ResolveStaticPodManifests(t *testing.T) {
+	manifestSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "haproxy-manifest",
+		},
+		Data: map[string][]byte{
+			"haproxy.yaml": []byte("kind: Pod"),
+		},
+	}
+
+	testcases := []struct {
+		name      string
+		manifests []bootstrapv1.StaticPodManifest
+		expected  []bootstrapv1.File
+		expectErr bool
+	}{
+		{
+			name: "inline manifest",
+			manifests: []bootstrapv1.StaticPodManifest{
+				{Name: "keepalived", Content: "kind: Pod"},
+			},
+			expected: []bootstrapv1.File{
+				{Path: "/etc/kubernetes/manifests/keepalived.yaml", Owner: "root:root", Permissions: "0600", Content: "kind: Pod"},
+			},
+		},
+		{
+			name: "manifest from secret",
+			manifests: []bootstrapv1.StaticPodManifest{
+				{Name: "haproxy", ContentFrom: &bootstrapv1.SecretKeyReference{Name: "haproxy-manifest", Key: "haproxy.yaml"}},
+			},
+			expected: []bootstrapv1.File{
+				{Path: "/etc/kubernetes/manifests/haproxy.yaml", Owner: "root:root", Permissions: "0600", Content: "kind: Pod"},
+			},
+		},
+		{
+			name: "missing secret key",
+			manifests: []bootstrapv1.StaticPodManifest{
+				{Name: "haproxy", ContentFrom: &bootstrapv1.SecretKeyReference{Name: "haproxy-manifest", Key: "missing"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "name escaping the manifest directory",
+			manifests: []bootstrapv1.StaticPodManifest{
+				{Name: "../../systemd/system/evil", Content: "kind: Pod"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "name with a path separator",
+			manifests: []bootstrapv1.StaticPodManifest{
+				{Name: "sub/haproxy", Content: "kind: Pod"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "neither content nor contentFrom",
+			manifests: []bootstrapv1.StaticPodManifest{
+				{Name: "haproxy"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "both content and contentFrom",
+			manifests: []bootstrapv1.StaticPodManifest{
+				{Name: "haproxy", Content: "kind: Pod", ContentFrom: &bootstrapv1.SecretKeyReference{Name: "haproxy-manifest", Key: "haproxy.yaml"}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKubeadmConfig(nil, "cfg")
+			config.Spec.StaticPodManifests = tc.manifests
+
+			k := &KubeadmConfigReconciler{
+				Log:    log.Log,
+				Client: newFakeClientWithScheme(setupScheme(), []runtime.Object{manifestSecret}...),
+			}
+			files, err := k.resolveStaticPodManifests(context.Background(), config)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to resolve static pod manifests:\n %+v", err)
+			}
+			if len(files) != len(tc.expected) {
+				t.Fatalf("expected %d files, got %d", len(tc.expected), len(files))
+			}
+			for i := range files {
+				if files[i] != tc.expected[i] {
+					t.Fatalf("expected %+v, got %+v", tc.expected[i], files[i])
+				}
+			}
+		})
+	}
+}
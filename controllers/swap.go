@@ -0,0 +1,43 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+// fstabSwapEntryExpression matches the uncommented swap entries of /etc/fstab.
+const fstabSwapEntryExpression = `^[^#[:space:]][^[:space:]]*[[:space:]]+[^[:space:]]+[[:space:]]+swap[[:space:]]`
+
+// swapCommands returns the commands to be run before kubeadm to disable swap on the machine of the config, and to
+// keep it disabled after a reboot by commenting out the swap entries of /etc/fstab and masking the zram swap units of
+// its OS family.
+func swapCommands(config *bootstrapv1.KubeadmConfig) []string {
+	if !config.Spec.DisableSwap {
+		return nil
+	}
+	var commands []string
+	if units := osProfile(config).zramSwapUnits; len(units) > 0 {
+		commands = append(commands, "systemctl mask --now "+strings.Join(units, " ")+" || true")
+	}
+	return append(commands,
+		"swapoff -a",
+		"if [ -f /etc/fstab ]; then sed -i -E '/"+fstabSwapEntryExpression+"/s/^/#/' /etc/fstab; fi",
+	)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+func TestSwapCommands(t *testing.T) {
+	fstab := "if [ -f /etc/fstab ]; then sed -i -E '/" + fstabSwapEntryExpression + "/s/^/#/' /etc/fstab; fi"
+	tests := []struct {
+		name        string
+		osFamily    bootstrapv1.OSFamily
+		disableSwap bool
+		expected    []string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:        "debian",
+			osFamily:    bootstrapv1.Debian,
+			disableSwap: true,
+			expected: []string{
+				"systemctl mask --now zramswap.service zram-config.service || true",
+				"swapoff -a",
+				fstab,
+			},
+		},
+		{
+			name:        "rhel",
+			osFamily:    bootstrapv1.RHEL,
+			disableSwap: true,
+			expected: []string{
+				"systemctl mask --now systemd-zram-setup@zram0.service || true",
+				"swapoff -a",
+				fstab,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newKubeadmConfig(nil, "cfg")
+			config.Spec.OSFamily = tt.osFamily
+			config.Spec.DisableSwap = tt.disableSwap
+			if commands := swapCommands(config); !reflect.DeepEqual(commands, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, commands)
+			}
+		})
+	}
+}
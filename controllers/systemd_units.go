@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"path"
+	"regexp"
+
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+// systemdUnitDir is the directory the units and drop-ins of the config are written to.
+const systemdUnitDir = "/etc/systemd/system"
+
+var (
+	// systemdUnitNameRegex matches the names of systemd units, including template instances.
+	systemdUnitNameRegex = regexp.MustCompile(`^[a-zA-Z0-9:_.@-]+\.(service|socket|device|mount|automount|swap|target|path|timer|slice|scope)$`)
+
+	// systemdDropInNameRegex matches the names of systemd drop-in files.
+	systemdDropInNameRegex = regexp.MustCompile(`^[a-zA-Z0-9:_.@-]+\.conf$`)
+)
+
+// systemdUnitFiles returns the unit files and drop-ins of the config, along with the commands to be run before kubeadm
+// for systemd to load them and to enable and start the units of the PreKubeadm phase, and the commands to be run after
+// kubeadm to enable and start the units of the PostKubeadm phase.
+func systemdUnitFiles(config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, []string, error) {
+	units := config.Spec.SystemdUnits
+	if len(units) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	var files []bootstrapv1.File
+	preCommands := []string{"systemctl daemon-reload"}
+	var postCommands []string
+	names := map[string]bool{}
+	for _, unit := range units {
+		if !systemdUnitNameRegex.MatchString(unit.Name) {
+			return nil, nil, nil, errors.Errorf("invalid systemd unit name %q", unit.Name)
+		}
+		if names[unit.Name] {
+			return nil, nil, nil, errors.Errorf("duplicate systemd unit %q", unit.Name)
+		}
+		names[unit.Name] = true
+
+		if unit.Contents != "" {
+			files = append(files, bootstrapv1.File{
+				Path:        path.Join(systemdUnitDir, unit.Name),
+				Owner:       "root:root",
+				Permissions: "0644",
+				Content:     unit.Contents,
+			})
+		}
+
+		dropIns := map[string]bool{}
+		for _, dropIn := range unit.DropIns {
+			if !systemdDropInNameRegex.MatchString(dropIn.Name) {
+				return nil, nil, nil, errors.Errorf("invalid drop-in name %q of systemd unit %q", dropIn.Name, unit.Name)
+			}
+			if dropIns[dropIn.Name] {
+				return nil, nil, nil, errors.Errorf("duplicate drop-in %q of systemd unit %q", dropIn.Name, unit.Name)
+			}
+			dropIns[dropIn.Name] = true
+
+			files = append(files, bootstrapv1.File{
+				Path:        path.Join(systemdUnitDir, unit.Name+".d", dropIn.Name),
+				Owner:       "root:root",
+				Permissions: "0644",
+				Content:     dropIn.Contents,
+			})
+		}
+
+		var commands []string
+		if unit.Enable {
+			commands = append(commands, "systemctl enable "+unit.Name)
+		}
+		if unit.Start {
+			// restart rather than start, so that units already running pick up their drop-ins
+			commands = append(commands, "systemctl restart "+unit.Name)
+		}
+
+		switch unit.Phase {
+		case "", bootstrapv1.PreKubeadmPhase:
+			preCommands = append(preCommands, commands...)
+		case bootstrapv1.PostKubeadmPhase:
+			postCommands = append(postCommands, commands...)
+		default:
+			return nil, nil, nil, errors.Errorf("invalid phase %q of systemd unit %q", unit.Phase, unit.Name)
+		}
+	}
+	return files, preCommands, postCommands, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+)
+
+func TestSystemdUnitFiles(t *testing.T) {
+	config := newKubeadmConfig(nil, "cfg")
+	config.Spec.SystemdUnits = []bootstrapv1.SystemdUnit{
+		{
+			Name:     "node-problem-detector.service",
+			Contents: "[Service]\nExecStart=/usr/local/bin/node-problem-detector\n",
+			Enable:   true,
+			Start:    true,
+			Phase:    bootstrapv1.PostKubeadmPhase,
+		},
+		{
+			Name:    "containerd.service",
+			DropIns: []bootstrapv1.SystemdDropIn{{Name: "10-proxy.conf", Contents: "[Service]\nEnvironment=HTTP_PROXY=http://proxy:3128\n"}},
+			Start:   true,
+		},
+		{
+			Name:     "fluent-bit.service",
+			Contents: "[Service]\nExecStart=/usr/bin/fluent-bit\n",
+			Enable:   true,
+		},
+	}
+
+	files, preCommands, postCommands, err := systemdUnitFiles(config)
+	if err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	expectedPaths := []string{
+		"/etc/systemd/system/node-problem-detector.service",
+		"/etc/systemd/system/containerd.service.d/10-proxy.conf",
+		"/etc/systemd/system/fluent-bit.service",
+	}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("expected files %q, got %q", expectedPaths, paths)
+	}
+
+	expectedPreCommands := []string{
+		"systemctl daemon-reload",
+		"systemctl restart containerd.service",
+		"systemctl enable fluent-bit.service",
+	}
+	if !reflect.DeepEqual(preCommands, expectedPreCommands) {
+		t.Errorf("expected pre kubeadm commands %q, got %q", expectedPreCommands, preCommands)
+	}
+
+	expectedPostCommands := []string{
+		"systemctl enable node-problem-detector.service",
+		"systemctl restart node-problem-detector.service",
+	}
+	if !reflect.DeepEqual(postCommands, expectedPostCommands) {
+		t.Errorf("expected post kubeadm commands %q, got %q", expectedPostCommands, postCommands)
+	}
+}
+
+func TestSystemdUnitFilesInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		units []bootstrapv1.SystemdUnit
+	}{
+		{
+			name:  "missing type suffix",
+			units: []bootstrapv1.SystemdUnit{{Name: "agent"}},
+		},
+		{
+			name:  "path in name",
+			units: []bootstrapv1.SystemdUnit{{Name: "../agent.service"}},
+		},
+		{
+			name:  "duplicate unit",
+			units: []bootstrapv1.SystemdUnit{{Name: "agent.service"}, {Name: "agent.service"}},
+		},
+		{
+			name:  "invalid drop-in name",
+			units: []bootstrapv1.SystemdUnit{{Name: "agent.service", DropIns: []bootstrapv1.SystemdDropIn{{Name: "override"}}}},
+		},
+		{
+			name:  "duplicate drop-in",
+			units: []bootstrapv1.SystemdUnit{{Name: "agent.service", DropIns: []bootstrapv1.SystemdDropIn{{Name: "a.conf"}, {Name: "a.conf"}}}},
+		},
+		{
+			name:  "invalid phase",
+			units: []bootstrapv1.SystemdUnit{{Name: "agent.service", Phase: "Later"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newKubeadmConfig(nil, "cfg")
+			config.Spec.SystemdUnits = tt.units
+			if _, _, _, err := systemdUnitFiles(config); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// templateLeftDelim and templateRightDelim delimit the actions of the templates of a config. They differ from the
+	// Go template defaults, which are also the delimiters of the jinja templating of cloud-init.
+	templateLeftDelim  = "<%"
+	templateRightDelim = "%>"
+)
+
+// templateData is the data the templates of a config are executed with.
+type templateData struct {
+	// Namespace and ConfigName are the namespace and the name of the config.
+	Namespace  string
+	ConfigName string
+	// MachineName is the name of the Machine owning the config.
+	MachineName string
+	// NodeName is the name generated for the node, if the config sets a node name strategy.
+	NodeName string
+}
+
+// renderTemplates returns the files and the pre and post kubeadm commands of the config, rendered as templates if the
+// config enables them. Files with an encoding are never rendered.
+func (r *KubeadmConfigReconciler) renderTemplates(ctx context.Context, config *bootstrapv1.KubeadmConfig, nodeName *nodeName) ([]bootstrapv1.File, []string, []string, error) {
+	if config.Spec.Templates == nil {
+		return config.Spec.Files, config.Spec.PreKubeadmCommands, config.Spec.PostKubeadmCommands, nil
+	}
+
+	data := templateData{
+		Namespace:   config.Namespace,
+		ConfigName:  config.Name,
+		MachineName: ownerName(config.OwnerReferences, "Machine"),
+	}
+	if nodeName != nil {
+		data.NodeName = nodeName.Name
+	}
+	funcs := r.templateFuncs(ctx, config)
+	render := func(name, text string) (string, error) {
+		tmpl, err := template.New(name).Delims(templateLeftDelim, templateRightDelim).Option("missingkey=error").Funcs(funcs).Parse(text)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid template %s", name)
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return "", errors.Wrapf(err, "failed to render template %s", name)
+		}
+		return out.String(), nil
+	}
+
+	files := make([]bootstrapv1.File, len(config.Spec.Files))
+	for i, file := range config.Spec.Files {
+		files[i] = file
+		if file.Encoding != "" {
+			continue
+		}
+		content, err := render(file.Path, file.Content)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		files[i].Content = content
+	}
+	renderCommands := func(name string, commands []string) ([]string, error) {
+		var out []string
+		for i, command := range commands {
+			rendered, err := render(fmt.Sprintf("%s[%d]", name, i), command)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, rendered)
+		}
+		return out, nil
+	}
+	preKubeadmCommands, err := renderCommands("preKubeadmCommands", config.Spec.PreKubeadmCommands)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	postKubeadmCommands, err := renderCommands("postKubeadmCommands", config.Spec.PostKubeadmCommands)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return files, preKubeadmCommands, postKubeadmCommands, nil
+}
+
+// templateFuncs returns the functions available to the templates of the config. They have no side effects, and lookup
+// only reads the config maps allowed by the config, from the config namespace.
+func (r *KubeadmConfigReconciler) templateFuncs(ctx context.Context, config *bootstrapv1.KubeadmConfig) template.FuncMap {
+	configMaps := map[string]*corev1.ConfigMap{}
+	return template.FuncMap{
+		"b64enc": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"b64dec": func(s string) (string, error) {
+			out, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return "", errors.Wrap(err, "invalid base64")
+			}
+			return string(out), nil
+		},
+		"indent": indent,
+		"nindent": func(spaces int, s string) string {
+			return "\n" + indent(spaces, s)
+		},
+		"lookup": func(name, key string) (string, error) {
+			allowed := false
+			for _, n := range config.Spec.Templates.ConfigMaps {
+				allowed = allowed || n == name
+			}
+			if !allowed {
+				return "", errors.Errorf("config map %q is not listed in templates.configMaps", name)
+			}
+			cm, ok := configMaps[name]
+			if !ok {
+				cm = &corev1.ConfigMap{}
+				objKey := client.ObjectKey{Namespace: config.Namespace, Name: name}
+				if err := r.Get(ctx, objKey, cm); err != nil {
+					return "", errors.Wrapf(err, "failed to get config map %s for templates", objKey)
+				}
+				configMaps[name] = cm
+			}
+			value, ok := cm.Data[key]
+			if !ok {
+				return "", errors.Errorf("config map %s/%s does not contain key %q", config.Namespace, name, key)
+			}
+			return value, nil
+		},
+	}
+}
+
+// indent prefixes every line of s with the given number of spaces.
+func indent(spaces int, s string) string {
+	prefix := strings.Repeat(" ", spaces)
+	return prefix + strings.Replace(s, "\n", "\n"+prefix, -1)
+}
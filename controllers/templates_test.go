@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	cluster := newCluster("cluster")
+	machine := newWorkerMachine(cluster)
+	config := newKubeadmConfig(machine, "cfg")
+	config.Spec.Files = []bootstrapv1.File{
+		{
+			Path:    "/etc/node/config.yaml",
+			Content: "machine: <% .MachineName %>\nregistry:<% lookup \"node-settings\" \"registry\" | nindent 2 %>\ntoken: <% \"secret\" | b64enc %>\n",
+		},
+		{
+			Path:     "/etc/node/encoded",
+			Encoding: bootstrapv1.Base64,
+			Content:  "PCUgLk1hY2hpbmVOYW1lICU+",
+		},
+	}
+	config.Spec.PreKubeadmCommands = []string{"echo '<% \"aGVsbG8=\" | b64dec %>' > /tmp/hello", "echo {{ ds.meta_data.local_hostname }}"}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: config.Namespace, Name: "node-settings"},
+		Data:       map[string]string{"registry": "mirror: registry.example.com\ninsecure: false"},
+	}
+	secretSettings := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: config.Namespace, Name: "other-settings"},
+		Data:       map[string]string{"password": "hunter2"},
+	}
+	r := &KubeadmConfigReconciler{Client: newFakeClientWithScheme(setupScheme(), configMap, secretSettings), Log: log.Log}
+
+	// templates are only rendered if enabled
+	files, preKubeadmCommands, _, err := r.renderTemplates(context.Background(), config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].Content != config.Spec.Files[0].Content || preKubeadmCommands[0] != config.Spec.PreKubeadmCommands[0] {
+		t.Error("expected the files and commands to be left as is without templates")
+	}
+
+	config.Spec.Templates = &bootstrapv1.TemplatesPolicy{ConfigMaps: []string{"node-settings"}}
+	files, preKubeadmCommands, _, err = r.renderTemplates(context.Background(), config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "machine: " + machine.Name + "\nregistry:\n  mirror: registry.example.com\n  insecure: false\ntoken: c2VjcmV0\n"
+	if files[0].Content != expected {
+		t.Errorf("expected the file to be rendered as %q, got %q", expected, files[0].Content)
+	}
+	if files[1].Content != config.Spec.Files[1].Content {
+		t.Error("expected encoded files not to be rendered")
+	}
+	if preKubeadmCommands[0] != "echo 'hello' > /tmp/hello" || preKubeadmCommands[1] != "echo {{ ds.meta_data.local_hostname }}" {
+		t.Errorf("expected the commands to be rendered without touching jinja templates, got %v", preKubeadmCommands)
+	}
+	if config.Spec.Files[0].Content == files[0].Content {
+		t.Error("expected the spec not to be modified")
+	}
+
+	// config maps not listed in the config cannot be read
+	config.Spec.PostKubeadmCommands = []string{"echo <% lookup \"other-settings\" \"password\" %>"}
+	if _, _, _, err := r.renderTemplates(context.Background(), config, nil); err == nil {
+		t.Error("expected the lookup of a config map not listed in the config to fail")
+	}
+	config.Spec.PostKubeadmCommands = []string{"echo <% lookup \"node-settings\" \"missing\" %>"}
+	if _, _, _, err := r.renderTemplates(context.Background(), config, nil); err == nil {
+		t.Error("expected the lookup of a missing key to fail")
+	}
+}
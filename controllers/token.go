@@ -17,87 +17,278 @@ limitations under the License.
 package controllers
 
 import (
+	"bytes"
+	"context"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
 	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
-	capiremote "sigs.k8s.io/cluster-api/controllers/remote"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// TokenConfigLabelName is the label set on the bootstrap token secrets created in workload clusters
+	// with the name of the KubeadmConfig the token was created for.
+	TokenConfigLabelName = "bootstrap.cluster.x-k8s.io/kubeadm-config"
+)
+
 var (
 	// DefaultTokenTTL is the amount of time a bootstrap token (and therefore a KubeadmConfig) will be valid
 	DefaultTokenTTL = 15 * time.Minute
+
+	// bootstrapTokenSchemas are the bootstrap token schemas of the Kubernetes versions supported by CABPK, sorted by
+	// increasing minimum version.
+	bootstrapTokenSchemas = []bootstrapTokenSchema{
+		{
+			minVersion:  version.MustParseSemantic("v1.13.0"),
+			usages:      []string{bootstrapapi.BootstrapTokenUsageSigningKey, bootstrapapi.BootstrapTokenUsageAuthentication},
+			extraGroups: []string{nodeBootstrapTokenAuthGroup},
+		},
+		{
+			// kubeadm join reads the Node object of the joining machine with the bootstrap token from v1.24 on,
+			// to fail early if a node with the same name already exists.
+			minVersion:  version.MustParseSemantic("v1.24.0"),
+			usages:      []string{bootstrapapi.BootstrapTokenUsageSigningKey, bootstrapapi.BootstrapTokenUsageAuthentication},
+			extraGroups: []string{nodeBootstrapTokenAuthGroup},
+			getNodes:    true,
+		},
+	}
 )
 
+// bootstrapTokenSchema describes the bootstrap token secrets, and the permissions of their groups, expected by the
+// kubeadm of a range of Kubernetes versions.
+type bootstrapTokenSchema struct {
+	// minVersion is the first Kubernetes version the schema applies to.
+	minVersion *version.Version
+	// usages are the usage keys set to true in the token secrets.
+	usages []string
+	// extraGroups are the groups the tokens authenticate as, in addition to system:bootstrappers.
+	extraGroups []string
+	// getNodes is true if the groups of the tokens must be allowed to get nodes.
+	getNodes bool
+}
+
+// bootstrapTokenSchemaFor returns the bootstrap token schema of the given Kubernetes version. The schema of the oldest
+// supported version is returned if the version is unknown or invalid, as it is understood by all the supported versions.
+func bootstrapTokenSchemaFor(kubernetesVersion *string) bootstrapTokenSchema {
+	schema := bootstrapTokenSchemas[0]
+	if kubernetesVersion == nil || *kubernetesVersion == "" {
+		return schema
+	}
+	v, err := version.ParseSemantic(*kubernetesVersion)
+	if err != nil {
+		return schema
+	}
+	for _, s := range bootstrapTokenSchemas {
+		if v.AtLeast(s.minVersion) {
+			schema = s
+		}
+	}
+	return schema
+}
+
+// validateBootstrapToken checks that the token is strictly of the form [a-z0-9]{6}.[a-z0-9]{16}. The token itself is
+// never included in the error.
+func validateBootstrapToken(token string) error {
+	_, _, err := parseBootstrapToken(token)
+	return err
+}
+
+// parseBootstrapToken returns the ID and the secret of the token, which must be strictly of the form
+// [a-z0-9]{6}.[a-z0-9]{16}, without surrounding whitespace.
+func parseBootstrapToken(token string) (string, string, error) {
+	substrs := bootstraputil.BootstrapTokenRegexp.FindStringSubmatch(token)
+	if len(substrs) != 3 {
+		return "", "", errors.Errorf("the bootstrap token is not of the form %q", bootstrapapi.BootstrapTokenPattern)
+	}
+	return substrs[1], substrs[2], nil
+}
+
 // ClusterSecretsClientFactory support creation of secrets client for clusters
-type ClusterSecretsClientFactory struct{}
+type ClusterSecretsClientFactory struct {
+	// AllowedExecCommands are the commands exec credential plugins are allowed to run,
+	// for clusters using the ExecAuth workload cluster auth mode.
+	AllowedExecCommands []string
+
+	// Scoped makes the clients of clusters using the KubeconfigAuth workload cluster auth mode create secrets as the
+	// ScopedSecretsUser, only allowed to create the secrets of the kube-system namespace, instead of with the admin
+	// kubeconfig of the cluster. The other calls still use the admin kubeconfig.
+	Scoped bool
+}
 
 // NewSecretsClient returns a new client supporting SecretInterface for the cluster
-func (f ClusterSecretsClientFactory) NewSecretsClient(client client.Client, cluster *clusterv1.Cluster) (corev1.SecretInterface, error) {
-	remoteClient, err := capiremote.NewClusterClient(client, cluster)
+func (f ClusterSecretsClientFactory) NewSecretsClient(ctx context.Context, client client.Client, cluster *clusterv1.Cluster) (corev1.SecretInterface, error) {
+	restConfig, err := workloadClusterRESTConfig(ctx, client, cluster, f.AllowedExecCommands)
 	if err != nil {
 		return nil, err
 	}
-
-	corev1Client, err := remoteClient.CoreV1()
+	corev1Client, err := corev1.NewForConfig(restConfig)
 	if err != nil {
 		return nil, err
 	}
+	secrets := corev1Client.Secrets(metav1.NamespaceSystem)
 
-	return corev1Client.Secrets(metav1.NamespaceSystem), nil
+	if mode := cluster.Annotations[WorkloadClusterAuthAnnotation]; f.Scoped && (mode == "" || mode == KubeconfigAuth) {
+		scopedConfig, err := scopedSecretsRESTConfig(ctx, client, cluster, restConfig)
+		if err != nil {
+			return nil, err
+		}
+		scopedClient, err := corev1.NewForConfig(scopedConfig)
+		if err != nil {
+			return nil, err
+		}
+		return scopedSecretsClient{SecretInterface: secrets, scoped: scopedClient.Secrets(metav1.NamespaceSystem)}, nil
+	}
+	return secrets, nil
 }
 
-// createToken attempts to create a token with the given ID.
-func createToken(client corev1.SecretInterface) (string, error) {
+// createToken attempts to create a token with the given ID, for a machine of the given Kubernetes version.
+// The token secret is labeled with the cluster and config it is created for, so it can be garbage collected.
+func createToken(client corev1.SecretInterface, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, kubernetesVersion *string) (string, error) {
 	token, err := bootstraputil.GenerateBootstrapToken()
 	if err != nil {
 		return "", errors.Wrap(err, "unable to generate bootstrap token")
 	}
 
-	substrs := bootstraputil.BootstrapTokenRegexp.FindStringSubmatch(token)
-	if len(substrs) != 3 {
-		return "", errors.Errorf("the bootstrap token %q was not of the form %q", token, bootstrapapi.BootstrapTokenPattern)
+	secretToken, err := newBootstrapTokenSecret(token, "token generated by cluster-api-bootstrap-provider-kubeadm", kubernetesVersion)
+	if err != nil {
+		return "", err
+	}
+	secretToken.Labels = map[string]string{
+		clusterv1.MachineClusterLabelName: cluster.Name,
+		TokenConfigLabelName:              config.Name,
 	}
-	tokenID := substrs[1]
-	tokenSecret := substrs[2]
 
-	secretName := bootstraputil.BootstrapTokenSecretName(tokenID)
-	secretToken := &v1.Secret{
+	if _, err = client.Create(secretToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ensureToken creates the secret of a token provided by the user if it does not exist yet, and otherwise checks
+// that the existing secret matches the token.
+// The token secret is only labeled with the cluster, as the token may be shared by several configs.
+func ensureToken(client corev1.SecretInterface, cluster *clusterv1.Cluster, token string, kubernetesVersion *string) error {
+	secretToken, err := newBootstrapTokenSecret(token, "token provided to cluster-api-bootstrap-provider-kubeadm", kubernetesVersion)
+	if err != nil {
+		return err
+	}
+
+	existing, err := client.Get(secretToken.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		secretToken.Labels = map[string]string{
+			clusterv1.MachineClusterLabelName: cluster.Name,
+		}
+		_, err = client.Create(secretToken)
+		return err
+	case err != nil:
+		return err
+	}
+
+	if existing.Type != bootstrapapi.SecretTypeBootstrapToken ||
+		!bytes.Equal(existing.Data[bootstrapapi.BootstrapTokenSecretKey], secretToken.Data[bootstrapapi.BootstrapTokenSecretKey]) {
+		return errors.Errorf("bootstrap token secret %q already exists and does not match the provided token", secretToken.Name)
+	}
+	return nil
+}
+
+// newBootstrapTokenSecret returns the secret backing the given token in the workload cluster, following the bootstrap
+// token schema of the given Kubernetes version.
+func newBootstrapTokenSecret(token, description string, kubernetesVersion *string) (*v1.Secret, error) {
+	tokenID, tokenSecret, err := parseBootstrapToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := bootstrapTokenSchemaFor(kubernetesVersion)
+	data := map[string][]byte{
+		bootstrapapi.BootstrapTokenIDKey:          []byte(tokenID),
+		bootstrapapi.BootstrapTokenSecretKey:      []byte(tokenSecret),
+		bootstrapapi.BootstrapTokenExpirationKey:  []byte(time.Now().UTC().Add(currentTunables().BootstrapTokenTTL).Format(time.RFC3339)),
+		bootstrapapi.BootstrapTokenExtraGroupsKey: []byte(strings.Join(schema.extraGroups, ",")),
+		bootstrapapi.BootstrapTokenDescriptionKey: []byte(description),
+	}
+	for _, usage := range schema.usages {
+		data[usage] = []byte("true")
+	}
+
+	return &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      secretName,
+			Name:      bootstraputil.BootstrapTokenSecretName(tokenID),
 			Namespace: metav1.NamespaceSystem,
 		},
 		Type: bootstrapapi.SecretTypeBootstrapToken,
-		Data: map[string][]byte{
-			bootstrapapi.BootstrapTokenIDKey:               []byte(tokenID),
-			bootstrapapi.BootstrapTokenSecretKey:           []byte(tokenSecret),
-			bootstrapapi.BootstrapTokenExpirationKey:       []byte(time.Now().UTC().Add(DefaultTokenTTL).Format(time.RFC3339)),
-			bootstrapapi.BootstrapTokenUsageSigningKey:     []byte("true"),
-			bootstrapapi.BootstrapTokenUsageAuthentication: []byte("true"),
-			bootstrapapi.BootstrapTokenExtraGroupsKey:      []byte("system:bootstrappers:kubeadm:default-node-token"),
-			bootstrapapi.BootstrapTokenDescriptionKey:      []byte("token generated by cluster-api-bootstrap-provider-kubeadm"),
-		},
+		Data: data,
+	}, nil
+}
+
+// resolveBootstrapToken reads the bootstrap token referenced by the token source from a secret in the given namespace.
+func (r *KubeadmConfigReconciler) resolveBootstrapToken(ctx context.Context, namespace string, source *kubeadmv1beta1.BootstrapTokenSource) (string, error) {
+	if source.SecretKeyRef == nil {
+		return "", errors.New("tokenFrom must define a secretKeyRef")
 	}
 
-	if _, err = client.Create(secretToken); err != nil {
-		return "", err
+	s := &v1.Secret{}
+	key := client.ObjectKey{Namespace: namespace, Name: source.SecretKeyRef.Name}
+	if err := r.Get(ctx, key, s); err != nil {
+		return "", errors.Wrapf(err, "failed to get bootstrap token secret %s", key)
+	}
+	data, ok := s.Data[source.SecretKeyRef.Key]
+	if !ok {
+		return "", errors.Errorf("secret %s does not contain key %q", key, source.SecretKeyRef.Key)
+	}
+	token := strings.TrimSpace(string(data))
+	if err := validateBootstrapToken(token); err != nil {
+		return "", errors.Wrapf(err, "invalid key %q of secret %s", source.SecretKeyRef.Key, key)
 	}
 	return token, nil
 }
 
+// bootstrapToken returns the bootstrap token used by the join configuration of the config,
+// resolving it if it is referenced rather than set.
+func (r *KubeadmConfigReconciler) bootstrapToken(ctx context.Context, config *bootstrapv1.KubeadmConfig) (string, error) {
+	bootstrapToken := config.Spec.JoinConfiguration.Discovery.BootstrapToken
+	if bootstrapToken.TokenFrom == nil {
+		return bootstrapToken.Token, nil
+	}
+	return r.resolveBootstrapToken(ctx, config.Namespace, bootstrapToken.TokenFrom)
+}
+
+// joinConfigurationWithToken returns the join configuration to be written in the bootstrap data. A referenced bootstrap token
+// is resolved into a copy of the join configuration, so that its value is never stored in the config.
+func (r *KubeadmConfigReconciler) joinConfigurationWithToken(ctx context.Context, config *bootstrapv1.KubeadmConfig) (*kubeadmv1beta1.JoinConfiguration, error) {
+	bootstrapToken := config.Spec.JoinConfiguration.Discovery.BootstrapToken
+	if bootstrapToken == nil || bootstrapToken.TokenFrom == nil {
+		return config.Spec.JoinConfiguration, nil
+	}
+
+	token, err := r.bootstrapToken(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	joinConfiguration := config.Spec.JoinConfiguration.DeepCopy()
+	joinConfiguration.Discovery.BootstrapToken.Token = token
+	joinConfiguration.Discovery.BootstrapToken.TokenFrom = nil
+	return joinConfiguration, nil
+}
+
 // refreshToken extends the TTL for an existing token
 func refreshToken(client corev1.SecretInterface, token string) error {
-	substrs := bootstraputil.BootstrapTokenRegexp.FindStringSubmatch(token)
-	if len(substrs) != 3 {
-		return errors.Errorf("the bootstrap token %q was not of the form %q", token, bootstrapapi.BootstrapTokenPattern)
+	tokenID, _, err := parseBootstrapToken(token)
+	if err != nil {
+		return err
 	}
-	tokenID := substrs[1]
 
 	secretName := bootstraputil.BootstrapTokenSecretName(tokenID)
 	secret, err := client.Get(secretName, metav1.GetOptions{})
@@ -108,7 +299,7 @@ func refreshToken(client corev1.SecretInterface, token string) error {
 	if secret.Data == nil {
 		return errors.Errorf("Invalid bootstrap secret %q, remove the token from the kubadm config to re-create", secretName)
 	}
-	secret.Data[bootstrapapi.BootstrapTokenExpirationKey] = []byte(time.Now().UTC().Add(DefaultTokenTTL).Format(time.RFC3339))
+	secret.Data[bootstrapapi.BootstrapTokenExpirationKey] = []byte(time.Now().UTC().Add(currentTunables().BootstrapTokenTTL).Format(time.RFC3339))
 
 	_, err = client.Update(secret)
 	return err
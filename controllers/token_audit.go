@@ -0,0 +1,227 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// tokenExpiredReason is the removal reason of the tokens removed after their expiration.
+	tokenExpiredReason = "expired"
+	// tokenOrphanedReason is the removal reason of the tokens revoked because their KubeadmConfig no longer exists.
+	tokenOrphanedReason = "orphaned"
+	// tokenDeletedReason is the removal reason of the tokens deleted from the workload cluster before their expiration
+	// by someone else than CABPK.
+	tokenDeletedReason = "deleted"
+)
+
+var (
+	// TokenAuditRetention is how long the audit records of the bootstrap tokens removed from a workload cluster are kept.
+	TokenAuditRetention = 30 * 24 * time.Hour
+)
+
+// tokenAuditRecord is the audit record of a bootstrap token issued by CABPK. The records of a cluster are stored in
+// JSON in its token audit ConfigMap, keyed by token ID.
+type tokenAuditRecord struct {
+	// Config and Machine are the KubeadmConfig and Machine the token was issued for.
+	Config  string `json:"config"`
+	Machine string `json:"machine,omitempty"`
+
+	IssuedAt  metav1.Time  `json:"issuedAt"`
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// UsedAt is when the Machine was first seen with a node, i.e. after it joined with the token.
+	UsedAt *metav1.Time `json:"usedAt,omitempty"`
+	Node   string       `json:"node,omitempty"`
+
+	// RemovedAt is when the token was seen removed from the workload cluster, for the RemovalReason.
+	RemovedAt     *metav1.Time `json:"removedAt,omitempty"`
+	RemovalReason string       `json:"removalReason,omitempty"`
+}
+
+// tokenAuditConfigMapName returns the name of the ConfigMap holding the token audit records of the cluster.
+func tokenAuditConfigMapName(cluster *clusterv1.Cluster) string {
+	return cluster.Name + "-bootstrap-token-audit"
+}
+
+// tokenID returns the ID of the bootstrap token, or an empty string if the token is invalid.
+func tokenID(token string) string {
+	id, _, err := parseBootstrapToken(token)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// ownerMachineName returns the name of the Machine owning the config, if any.
+func ownerMachineName(config *bootstrapv1.KubeadmConfig) string {
+	for _, ref := range config.OwnerReferences {
+		if ref.Kind == "Machine" {
+			return ref.Name
+		}
+	}
+	return ""
+}
+
+// recordTokenIssued adds the audit record of a token issued for the config.
+func recordTokenIssued(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, token string) error {
+	id := tokenID(token)
+	if id == "" {
+		return errors.New("cannot audit an invalid bootstrap token")
+	}
+	now := time.Now()
+	expiresAt := metav1.NewTime(now.Add(currentTunables().BootstrapTokenTTL))
+	return updateTokenAudit(ctx, c, cluster, func(records map[string]*tokenAuditRecord) bool {
+		records[id] = &tokenAuditRecord{
+			Config:    config.Name,
+			Machine:   ownerMachineName(config),
+			IssuedAt:  metav1.NewTime(now),
+			ExpiresAt: &expiresAt,
+		}
+		return true
+	})
+}
+
+// updateTokenAudit applies the update to the token audit records of the cluster, and stores them if the update
+// reports a change. The ConfigMap is owned by the Cluster, and created with the first record.
+func updateTokenAudit(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, update func(records map[string]*tokenAuditRecord) bool) error {
+	key := client.ObjectKey{Namespace: cluster.Namespace, Name: tokenAuditConfigMapName(cluster)}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm := &corev1.ConfigMap{}
+		err := c.Get(ctx, key, cm)
+		exists := !apierrors.IsNotFound(err)
+		if err != nil && exists {
+			return errors.Wrapf(err, "failed to get token audit ConfigMap %s", key)
+		}
+
+		records := map[string]*tokenAuditRecord{}
+		for id, data := range cm.Data {
+			record := &tokenAuditRecord{}
+			if err := json.Unmarshal([]byte(data), record); err != nil {
+				return errors.Wrapf(err, "failed to parse the audit record of bootstrap token %q in ConfigMap %s", id, key)
+			}
+			records[id] = record
+		}
+		if !update(records) {
+			return nil
+		}
+
+		cm.Data = make(map[string]string, len(records))
+		for id, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return errors.Wrapf(err, "failed to marshal the audit record of bootstrap token %q", id)
+			}
+			cm.Data[id] = string(data)
+		}
+		if exists {
+			return c.Update(ctx, cm)
+		}
+
+		cm.ObjectMeta = metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+				},
+			},
+		}
+		return c.Create(ctx, cm)
+	})
+}
+
+// auditTokens updates the token audit records of the cluster after a sweep: the tokens whose machine has a node are
+// marked used, and the tokens removed from the workload cluster are marked removed. present holds the expiration of
+// the tokens found in the workload cluster when the sweep listed them at listedAt, and removed the reason of the
+// tokens deleted by the sweep. The records of the tokens removed for longer than TokenAuditRetention are dropped.
+func (r *TokenSweeperReconciler) auditTokens(ctx context.Context, cluster *clusterv1.Cluster, present map[string]string, removed map[string]string, listedAt time.Time) error {
+	machines := &clusterv1.MachineList{}
+	if err := r.Client.List(ctx, machines, client.InNamespace(cluster.Namespace), client.MatchingLabels{
+		clusterv1.MachineClusterLabelName: cluster.Name,
+	}); err != nil {
+		return errors.Wrapf(err, "failed to list machines of Cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	nodes := map[string]string{}
+	for i := range machines.Items {
+		if nodeRef := machines.Items[i].Status.NodeRef; nodeRef != nil {
+			nodes[machines.Items[i].Name] = nodeRef.Name
+		}
+	}
+
+	now := metav1.Now()
+	return updateTokenAudit(ctx, r.Client, cluster, func(records map[string]*tokenAuditRecord) bool {
+		changed := false
+		for id, record := range records {
+			if record.RemovedAt != nil {
+				if now.Sub(record.RemovedAt.Time) > TokenAuditRetention {
+					delete(records, id)
+					changed = true
+				}
+				continue
+			}
+
+			if node, ok := nodes[record.Machine]; ok && record.UsedAt == nil {
+				record.UsedAt = &now
+				record.Node = node
+				changed = true
+			}
+
+			if reason, ok := removed[id]; ok {
+				record.RemovedAt = &now
+				record.RemovalReason = reason
+				changed = true
+				continue
+			}
+			if expiration, ok := present[id]; ok {
+				if expiresAt, err := time.Parse(time.RFC3339, expiration); err == nil && (record.ExpiresAt == nil || !expiresAt.Equal(record.ExpiresAt.Time)) {
+					record.ExpiresAt = &metav1.Time{Time: expiresAt}
+					changed = true
+				}
+				continue
+			}
+			// a token issued after the listing is not missing
+			if record.IssuedAt.Time.Before(listedAt) {
+				record.RemovedAt = &now
+				record.RemovalReason = tokenDeletedReason
+				if record.ExpiresAt != nil && record.ExpiresAt.Time.Before(now.Time) {
+					record.RemovalReason = tokenExpiredReason
+				}
+				changed = true
+			}
+		}
+		return changed
+	})
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func getTokenAuditRecords(t *testing.T, c client.Client, cluster string) map[string]*tokenAuditRecord {
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: cluster + "-bootstrap-token-audit"}, cm); err != nil {
+		t.Fatal(err)
+	}
+	records := map[string]*tokenAuditRecord{}
+	for id, data := range cm.Data {
+		record := &tokenAuditRecord{}
+		if err := json.Unmarshal([]byte(data), record); err != nil {
+			t.Fatal(err)
+		}
+		records[id] = record
+	}
+	return records
+}
+
+func TestTokenAudit(t *testing.T) {
+	cluster := newCluster("cluster")
+	joined := newMachine(cluster, "joined")
+	pending := newMachine(cluster, "pending")
+	c := newFakeClientWithScheme(setupScheme(), []runtime.Object{cluster, joined, pending}...)
+
+	for token, machine := range map[string]string{
+		"aaaaaa.0123456789abcdef": "joined",
+		"bbbbbb.0123456789abcdef": "pending",
+		"cccccc.0123456789abcdef": "pending",
+		"dddddd.0123456789abcdef": "pending",
+	} {
+		config := newKubeadmConfig(newMachine(cluster, machine), machine+"-config")
+		if err := recordTokenIssued(context.Background(), c, cluster, config, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records := getTokenAuditRecords(t, c, cluster.Name)
+	if len(records) != 4 || records["aaaaaa"].Machine != "joined" || records["aaaaaa"].Config != "joined-config" {
+		t.Fatalf("expected the issued tokens to be recorded with their machine and config, got %v", records)
+	}
+
+	joined.Status.NodeRef = &corev1.ObjectReference{Name: "joined-node"}
+	if err := c.Update(context.Background(), joined); err != nil {
+		t.Fatal(err)
+	}
+	r := &TokenSweeperReconciler{Client: c, Log: log.Log}
+	present := map[string]string{
+		"aaaaaa": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		"bbbbbb": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	}
+	removed := map[string]string{"cccccc": tokenOrphanedReason}
+	if err := r.auditTokens(context.Background(), cluster, present, removed, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	records = getTokenAuditRecords(t, c, cluster.Name)
+	if record := records["aaaaaa"]; record.UsedAt == nil || record.Node != "joined-node" || record.RemovedAt != nil {
+		t.Errorf("expected the token of the joined machine to be marked used, got %+v", record)
+	}
+	if record := records["bbbbbb"]; record.UsedAt != nil || record.RemovedAt != nil {
+		t.Errorf("expected the token of the pending machine to be unused, got %+v", record)
+	}
+	if record := records["cccccc"]; record.RemovedAt == nil || record.RemovalReason != tokenOrphanedReason {
+		t.Errorf("expected the swept token to be marked orphaned, got %+v", record)
+	}
+	if record := records["dddddd"]; record.RemovedAt == nil || record.RemovalReason != tokenDeletedReason {
+		t.Errorf("expected the missing token to be marked deleted, got %+v", record)
+	}
+
+	defer func(retention time.Duration) { TokenAuditRetention = retention }(TokenAuditRetention)
+	TokenAuditRetention = 0
+	if err := r.auditTokens(context.Background(), cluster, present, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	records = getTokenAuditRecords(t, c, cluster.Name)
+	if len(records) != 2 || records["cccccc"] != nil || records["dddddd"] != nil {
+		t.Errorf("expected the records of the removed tokens to be dropped after the retention, got %v", records)
+	}
+}
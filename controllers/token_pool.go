@@ -0,0 +1,432 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// TokenPoolLabelName is the label set on the bootstrap token secrets created in workload clusters for a token
+	// pool, with the name of the MachineDeployment of the pool.
+	TokenPoolLabelName = "bootstrap.cluster.x-k8s.io/token-pool"
+
+	// tokenPoolSecretType is the type of the secrets holding the unused tokens of a token pool.
+	tokenPoolSecretType corev1.SecretType = "bootstrap.cluster.x-k8s.io/token-pool"
+
+	// minPooledTokenLifetime is the minimum remaining validity of a pooled token claimed by a config, which leaves
+	// time for the config to be reconciled again and the token to be refreshed.
+	minPooledTokenLifetime = time.Minute
+)
+
+var (
+	tokenPoolGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cabpk_token_pool_tokens",
+			Help: "Number of unused bootstrap tokens in the token pool of a MachineDeployment after the last refill.",
+		},
+		[]string{"namespace", "machine_deployment"},
+	)
+	tokenPoolClaimsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cabpk_token_pool_claims_total",
+			Help: "Total number of bootstrap tokens requested from token pools, by result: hit if a pooled token was claimed, miss if the pool was empty and a token was created.",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(tokenPoolGauge, tokenPoolClaimsCounter)
+}
+
+// pooledToken is an unused token of a token pool.
+type pooledToken struct {
+	Token     string      `json:"token"`
+	ExpiresAt metav1.Time `json:"expiresAt"`
+}
+
+// tokenPoolSecretName returns the name of the secret holding the token pool of the MachineDeployment.
+func tokenPoolSecretName(deploymentName string) string {
+	return deploymentName + "-token-pool"
+}
+
+// TokenPoolReconciler keeps the token pool of each MachineDeployment whose KubeadmConfigTemplate defines one filled
+// with unused bootstrap tokens created in the workload cluster. The tokens are held by a secret of the management
+// cluster owned by the MachineDeployment, from which the KubeadmConfigReconciler claims them without any call to the
+// workload cluster. Tokens are replaced once half of their validity has passed, and expire in the workload cluster
+// if they are never claimed.
+type TokenPoolReconciler struct {
+	Client               client.Client
+	SecretsClientFactory SecretsClientFactory
+	Log                  logr.Logger
+
+	// ReconcileTimeout is the deadline of a refill, after which the pending workload cluster calls are cancelled.
+	// Defaults to DefaultReconcileTimeout.
+	ReconcileTimeout time.Duration
+}
+
+// SetupWithManager sets up the reconciler with the Manager.
+func (r *TokenPoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("bootstrap-token-pool").
+		For(&clusterv1.MachineDeployment{}).
+		Owns(&corev1.Secret{}).
+		Complete(r)
+}
+
+// Reconcile refills the token pool of a MachineDeployment.
+func (r *TokenPoolReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := reconcileContext(r.ReconcileTimeout)
+	defer cancel()
+	log := r.Log.WithValues("machinedeployment", req.NamespacedName)
+
+	deployment := &clusterv1.MachineDeployment{}
+	if err := r.Client.Get(ctx, req.NamespacedName, deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			tokenPoolGauge.DeleteLabelValues(req.Namespace, req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !deployment.DeletionTimestamp.IsZero() {
+		tokenPoolGauge.DeleteLabelValues(deployment.Namespace, deployment.Name)
+		return ctrl.Result{}, nil
+	}
+
+	policy, err := r.tokenPoolPolicy(ctx, deployment)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	poolKey := client.ObjectKey{Namespace: deployment.Namespace, Name: tokenPoolSecretName(deployment.Name)}
+	if policy == nil {
+		// the pooled tokens left in the workload cluster expire on their own
+		tokenPoolGauge.DeleteLabelValues(deployment.Namespace, deployment.Name)
+		pool := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: poolKey.Namespace, Name: poolKey.Name}}
+		if err := r.Client.Delete(ctx, pool); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to delete token pool secret %s", poolKey)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, deployment.ObjectMeta)
+	if err != nil {
+		if errors.Cause(err) == util.ErrNoCluster {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !cluster.Status.ControlPlaneInitialized && !externalControlPlane(cluster) {
+		log.Info("Waiting for the control plane to be initialized")
+		return ctrl.Result{RequeueAfter: currentTunables().RequeueInterval}, nil
+	}
+
+	ttl := currentTunables().BootstrapTokenTTL
+	if policy.TTLMinutes != nil {
+		ttl = time.Duration(*policy.TTLMinutes) * time.Minute
+	}
+	if err := r.ensureTokenPoolSecret(ctx, deployment, poolKey); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// remove the tokens past half of their validity from the pool first, so that they are never deleted from the
+	// workload cluster once claimed
+	now := time.Now()
+	var stale []string
+	size := 0
+	err = updateTokenPool(ctx, r.Client, poolKey, func(tokens map[string]*pooledToken) bool {
+		stale = nil
+		for id, t := range tokens {
+			if t.ExpiresAt.Sub(now) < ttl/2 {
+				stale = append(stale, id)
+				delete(tokens, id)
+			}
+		}
+		size = len(tokens)
+		return len(stale) > 0
+	})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, id := range stale {
+		if err := secretsClient.Delete(bootstraputil.BootstrapTokenSecretName(id), &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to delete pooled bootstrap token %q", id)
+		}
+	}
+
+	created := map[string]*pooledToken{}
+	for i := size; i < int(policy.Size); i++ {
+		token, err := createPooledToken(secretsClient, cluster, deployment, ttl)
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to create pooled bootstrap token")
+		}
+		created[tokenID(token.Token)] = token
+	}
+	err = updateTokenPool(ctx, r.Client, poolKey, func(tokens map[string]*pooledToken) bool {
+		for id, t := range created {
+			tokens[id] = t
+		}
+		size = len(tokens)
+		return len(created) > 0
+	})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(created) > 0 || len(stale) > 0 {
+		log.Info("Refilled token pool", "created", len(created), "removed", len(stale), "size", size)
+	}
+
+	tokenPoolGauge.WithLabelValues(deployment.Namespace, deployment.Name).Set(float64(size))
+	return ctrl.Result{RequeueAfter: ttl / 4}, nil
+}
+
+// tokenPoolPolicy returns the token pool policy of the KubeadmConfigTemplate of the MachineDeployment, or nil if the
+// MachineDeployment has no such template, or if its machines join with a token of the user, a token backend or
+// without bootstrap token.
+func (r *TokenPoolReconciler) tokenPoolPolicy(ctx context.Context, deployment *clusterv1.MachineDeployment) (*bootstrapv1.TokenPoolPolicy, error) {
+	ref := deployment.Spec.Template.Spec.Bootstrap.ConfigRef
+	if ref == nil || ref.Kind != "KubeadmConfigTemplate" {
+		return nil, nil
+	}
+	if gv, err := schema.ParseGroupVersion(ref.APIVersion); err != nil || gv.Group != bootstrapv1.GroupVersion.Group {
+		return nil, nil
+	}
+
+	template := &bootstrapv1.KubeadmConfigTemplate{}
+	key := client.ObjectKey{Namespace: deployment.Namespace, Name: ref.Name}
+	if err := r.Client.Get(ctx, key, template); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get KubeadmConfigTemplate %s", key)
+	}
+
+	config := &bootstrapv1.KubeadmConfig{Spec: template.Spec.Template.Spec}
+	if !tokenPoolEligible(config) {
+		return nil, nil
+	}
+	return config.Spec.TokenPool, nil
+}
+
+// ensureTokenPoolSecret creates the empty token pool secret of the MachineDeployment if it does not exist yet. The
+// secret is owned by the MachineDeployment, so that claiming a token triggers a refill.
+func (r *TokenPoolReconciler) ensureTokenPoolSecret(ctx context.Context, deployment *clusterv1.MachineDeployment, key client.ObjectKey) error {
+	pool := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: deployment.Labels[clusterv1.MachineClusterLabelName],
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(deployment, clusterv1.GroupVersion.WithKind("MachineDeployment")),
+			},
+		},
+		Type: tokenPoolSecretType,
+	}
+	if err := r.Client.Create(ctx, pool); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "failed to create token pool secret %s", key)
+	}
+	return nil
+}
+
+// createPooledToken creates a token of the pool of the MachineDeployment, valid for the given TTL. The token secret
+// is labeled with the cluster and the MachineDeployment rather than a config, as it is not claimed yet.
+func createPooledToken(client typedcorev1.SecretInterface, cluster *clusterv1.Cluster, deployment *clusterv1.MachineDeployment, ttl time.Duration) (*pooledToken, error) {
+	token, err := bootstraputil.GenerateBootstrapToken()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to generate bootstrap token")
+	}
+
+	secretToken, err := newBootstrapTokenSecret(token, "pooled token generated by cluster-api-bootstrap-provider-kubeadm", deployment.Spec.Template.Spec.Version)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := metav1.NewTime(time.Now().Add(ttl))
+	secretToken.Data[bootstrapapi.BootstrapTokenExpirationKey] = []byte(expiresAt.UTC().Format(time.RFC3339))
+	secretToken.Labels = map[string]string{
+		clusterv1.MachineClusterLabelName: cluster.Name,
+		TokenPoolLabelName:                deployment.Name,
+	}
+
+	if _, err = client.Create(secretToken); err != nil {
+		return nil, err
+	}
+	return &pooledToken{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// updateTokenPool applies the update to the unused tokens of the token pool secret, and stores them if the update
+// reports a change.
+func updateTokenPool(ctx context.Context, c client.Client, key client.ObjectKey, update func(tokens map[string]*pooledToken) bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pool := &corev1.Secret{}
+		if err := c.Get(ctx, key, pool); err != nil {
+			return errors.Wrapf(err, "failed to get token pool secret %s", key)
+		}
+
+		tokens := map[string]*pooledToken{}
+		for id, data := range pool.Data {
+			token := &pooledToken{}
+			if err := json.Unmarshal(data, token); err != nil {
+				return errors.Wrapf(err, "failed to parse pooled bootstrap token %q of secret %s", id, key)
+			}
+			tokens[id] = token
+		}
+		if !update(tokens) {
+			return nil
+		}
+
+		pool.Data = make(map[string][]byte, len(tokens))
+		for id, token := range tokens {
+			data, err := json.Marshal(token)
+			if err != nil {
+				return err
+			}
+			pool.Data[id] = data
+		}
+		return c.Update(ctx, pool)
+	})
+}
+
+// tokenPoolEligible returns true if the machines of the config join with a bootstrap token created by CABPK, which
+// may then be taken from a token pool.
+func tokenPoolEligible(config *bootstrapv1.KubeadmConfig) bool {
+	if config.Spec.TokenPool == nil || config.Spec.TokenBackend != "" || config.Spec.NodeClientCertificate || manualDiscovery(config) {
+		return false
+	}
+	if joinConfiguration := config.Spec.JoinConfiguration; joinConfiguration != nil {
+		if joinConfiguration.ControlPlane != nil {
+			return false
+		}
+		if bootstrapToken := joinConfiguration.Discovery.BootstrapToken; bootstrapToken != nil && (bootstrapToken.Token != "" || bootstrapToken.TokenFrom != nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// claimPooledToken removes an unused token from the token pool of the MachineDeployment owning the Machine of the
+// config, and returns it, or returns an empty string if the config has no pool or its pool is empty. The token
+// expiring first is claimed, provided it is valid for long enough to be refreshed.
+func (r *KubeadmConfigReconciler) claimPooledToken(ctx context.Context, config *bootstrapv1.KubeadmConfig) (string, error) {
+	if !tokenPoolEligible(config) {
+		return "", nil
+	}
+	deploymentName, err := r.ownerMachineDeploymentName(ctx, config)
+	if err != nil || deploymentName == "" {
+		return "", err
+	}
+
+	token := ""
+	now := time.Now()
+	key := client.ObjectKey{Namespace: config.Namespace, Name: tokenPoolSecretName(deploymentName)}
+	err = updateTokenPool(ctx, r.Client, key, func(tokens map[string]*pooledToken) bool {
+		token = ""
+		var claimed string
+		for id, t := range tokens {
+			if t.ExpiresAt.Sub(now) < minPooledTokenLifetime {
+				continue
+			}
+			if claimed == "" || t.ExpiresAt.Before(&tokens[claimed].ExpiresAt) {
+				claimed = id
+			}
+		}
+		if claimed == "" {
+			return false
+		}
+		token = tokens[claimed].Token
+		delete(tokens, claimed)
+		return true
+	})
+	if err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+		return "", err
+	}
+	if token == "" {
+		tokenPoolClaimsCounter.WithLabelValues("miss").Inc()
+		return "", nil
+	}
+	tokenPoolClaimsCounter.WithLabelValues("hit").Inc()
+	return token, nil
+}
+
+// ownerMachineDeploymentName returns the name of the MachineDeployment owning the MachineSet of the worker Machine
+// owning the config, or an empty string if there is none.
+func (r *KubeadmConfigReconciler) ownerMachineDeploymentName(ctx context.Context, config *bootstrapv1.KubeadmConfig) (string, error) {
+	machineName := ownerMachineName(config)
+	if machineName == "" {
+		return "", nil
+	}
+	machine := &clusterv1.Machine{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: config.Namespace, Name: machineName}, machine); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if util.IsControlPlaneMachine(machine) {
+		return "", nil
+	}
+
+	machineSetName := ownerName(machine.OwnerReferences, "MachineSet")
+	if machineSetName == "" {
+		return "", nil
+	}
+	machineSet := &clusterv1.MachineSet{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: config.Namespace, Name: machineSetName}, machineSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return ownerName(machineSet.OwnerReferences, "MachineDeployment"), nil
+}
+
+// ownerName returns the name of the owner of the given kind of the Cluster API group, if any.
+func ownerName(refs []metav1.OwnerReference, kind string) string {
+	for _, ref := range refs {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err == nil && gv.Group == clusterv1.GroupVersion.Group && ref.Kind == kind {
+			return ref.Name
+		}
+	}
+	return ""
+}
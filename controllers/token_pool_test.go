@@ -0,0 +1,173 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestTokenPool(t *testing.T) {
+	ctx := context.Background()
+	cluster := newCluster("cluster")
+	cluster.Status.ControlPlaneInitialized = true
+
+	template := &bootstrapv1.KubeadmConfigTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "md-0"},
+	}
+	template.Spec.Template.Spec.TokenPool = &bootstrapv1.TokenPoolPolicy{Size: 2}
+	deployment := &clusterv1.MachineDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "md-0",
+			Labels:    map[string]string{clusterv1.MachineClusterLabelName: cluster.Name},
+		},
+	}
+	deployment.Spec.Template.Spec.Bootstrap.ConfigRef = &corev1.ObjectReference{
+		APIVersion: bootstrapv1.GroupVersion.String(),
+		Kind:       "KubeadmConfigTemplate",
+		Name:       template.Name,
+	}
+	machineSet := &clusterv1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "md-0-abcde",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: clusterv1.GroupVersion.String(), Kind: "MachineDeployment", Name: deployment.Name}},
+		},
+	}
+	machine := newWorkerMachine(cluster)
+	machine.OwnerReferences = []metav1.OwnerReference{{APIVersion: clusterv1.GroupVersion.String(), Kind: "MachineSet", Name: machineSet.Name}}
+	config := newWorkerJoinKubeadmConfig(machine)
+	config.Spec.TokenPool = template.Spec.Template.Spec.TokenPool
+
+	myclient := newFakeClientWithScheme(setupScheme(), cluster, template, deployment, machineSet, machine, config)
+	secretFactory := newFakeSecretFactory()
+	r := &TokenPoolReconciler{Client: myclient, SecretsClientFactory: secretFactory, Log: log.Log}
+	k := &KubeadmConfigReconciler{Client: myclient, Log: log.Log}
+	request := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: deployment.Namespace, Name: deployment.Name}}
+	poolKey := client.ObjectKey{Namespace: deployment.Namespace, Name: tokenPoolSecretName(deployment.Name)}
+
+	pooledTokens := func() map[string]*pooledToken {
+		var tokens map[string]*pooledToken
+		if err := updateTokenPool(ctx, myclient, poolKey, func(t map[string]*pooledToken) bool {
+			tokens = t
+			return false
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return tokens
+	}
+
+	result, err := r.Reconcile(request)
+	if err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	if result.RequeueAfter != DefaultTokenTTL/4 {
+		t.Errorf("expected the pool to be refilled after %v, got %v", DefaultTokenTTL/4, result)
+	}
+	tokens := pooledTokens()
+	if len(tokens) != 2 {
+		t.Fatalf("expected 2 pooled tokens, got %d", len(tokens))
+	}
+	for id := range tokens {
+		s, err := secretFactory.client.Get(bootstraputil.BootstrapTokenSecretName(id), metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected the pooled token %q to exist in the workload cluster: %v", id, err)
+		}
+		if s.Labels[TokenPoolLabelName] != deployment.Name || s.Labels[TokenConfigLabelName] != "" {
+			t.Errorf("expected the pooled token to be labeled with its pool only, got %v", s.Labels)
+		}
+	}
+	if count := testutil.ToFloat64(tokenPoolGauge.WithLabelValues(deployment.Namespace, deployment.Name)); count != 2 {
+		t.Errorf("expected the gauge to report 2 tokens, got %v", count)
+	}
+
+	// a config of the MachineDeployment claims a pooled token
+	token, err := k.claimPooledToken(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tokens[tokenID(token)]; !ok {
+		t.Fatalf("expected a pooled token to be claimed, got %q", token)
+	}
+	if _, ok := pooledTokens()[tokenID(token)]; ok || len(pooledTokens()) != 1 {
+		t.Error("expected the claimed token to be removed from the pool")
+	}
+
+	// the pool is refilled, and tokens past half of their validity are replaced
+	if err := updateTokenPool(ctx, myclient, poolKey, func(t map[string]*pooledToken) bool {
+		for _, token := range t {
+			token.ExpiresAt = metav1.NewTime(time.Now().Add(time.Minute))
+		}
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	refilled := pooledTokens()
+	if len(refilled) != 2 {
+		t.Fatalf("expected the pool to be refilled with 2 tokens, got %d", len(refilled))
+	}
+	for id := range tokens {
+		if tokenID(token) == id {
+			continue
+		}
+		if _, ok := refilled[id]; ok {
+			t.Errorf("expected the stale token %q to be removed from the pool", id)
+		}
+		if _, err := secretFactory.client.Get(bootstraputil.BootstrapTokenSecretName(id), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected the stale token %q to be deleted from the workload cluster, got %v", id, err)
+		}
+	}
+	if _, err := secretFactory.client.Get(bootstraputil.BootstrapTokenSecretName(tokenID(token)), metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the claimed token to be kept: %v", err)
+	}
+
+	// control plane machines never claim pooled tokens
+	controlPlaneConfig := newControlPlaneJoinKubeadmConfig(machine, "control-plane-cfg")
+	controlPlaneConfig.Spec.TokenPool = template.Spec.Template.Spec.TokenPool
+	if token, err := k.claimPooledToken(ctx, controlPlaneConfig); err != nil || token != "" {
+		t.Errorf("expected no pooled token for a control plane machine, got %q, %v", token, err)
+	}
+
+	// the pool is removed with its policy
+	template.Spec.Template.Spec.TokenPool = nil
+	if err := myclient.Update(ctx, template); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	if err := myclient.Get(ctx, poolKey, &corev1.Secret{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the token pool secret to be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+)
+
+const (
+	// ExecTokenBackend is the name of the token backend of the ExecTokenProvider.
+	ExecTokenBackend = "Exec"
+
+	// ExecBootstrapKubeconfigPath is the path of the kubeconfig running the exec credential plugin of the Exec token
+	// backend. kubeadm uses it for file discovery and, as it provides credentials, for the kubelet TLS bootstrap.
+	ExecBootstrapKubeconfigPath = "/etc/kubernetes/bootstrap-exec.conf"
+
+	// ClusterNamePlaceholder is replaced by the name of the cluster in the arguments and environment of exec
+	// credential plugins, e.g. for the cluster ID of aws-iam-authenticator.
+	ClusterNamePlaceholder = "$(CLUSTER_NAME)"
+
+	execCredentialAPIVersion = "client.authentication.k8s.io/v1beta1"
+)
+
+// tokenProvider returns the provider registered for the token backend of the config.
+func (r *KubeadmConfigReconciler) tokenProvider(config *bootstrapv1.KubeadmConfig) (TokenProvider, error) {
+	provider, ok := r.TokenProviders[config.Spec.TokenBackend]
+	if !ok {
+		return nil, errors.Errorf("unknown token backend %q", config.Spec.TokenBackend)
+	}
+	return provider, nil
+}
+
+// reconcileTokenBackendDiscovery lets the token backend of the config set its join discovery, once the API server
+// endpoint of the cluster is known. Features relying on bootstrap tokens managed by CABPK are refused.
+func (r *KubeadmConfigReconciler) reconcileTokenBackendDiscovery(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) error {
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"nodeClientCertificate", config.Spec.NodeClientCertificate},
+		{"ensureBootstrapTokenRBAC", config.Spec.EnsureBootstrapTokenRBAC},
+		{"clusterInfoCheck", config.Spec.ClusterInfoCheck != ""},
+		{"apiServerCheck", config.Spec.APIServerCheck != ""},
+		{"apiServerEndpointDNS", config.Spec.APIServerEndpointDNS != nil},
+	} {
+		if setting.set {
+			return errors.Errorf("%s is not supported with token backend %q", setting.name, config.Spec.TokenBackend)
+		}
+	}
+
+	provider, err := r.tokenProvider(config)
+	if err != nil {
+		return err
+	}
+	vip, err := r.clusterControlPlaneVIP(ctx, cluster, config)
+	if err != nil {
+		return err
+	}
+	if vip == nil && len(cluster.Status.APIEndpoints) == 0 {
+		r.markWaitingForClusterEndpoint(cluster, config)
+		return errors.Wrap(&capierrors.RequeueAfterError{RequeueAfter: 10 * time.Second}, "Waiting for Cluster Controller to set cluster.Status.APIEndpoints")
+	}
+	return provider.Discovery(ctx, cluster, config)
+}
+
+// tokenBackendFiles returns the files and commands providing the join credentials of the token backend of the config
+// to the machine, if any.
+func (r *KubeadmConfigReconciler) tokenBackendFiles(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, certificates internalcluster.Certificates) ([]bootstrapv1.File, []string, error) {
+	if config.Spec.TokenBackend == "" {
+		return nil, nil, nil
+	}
+
+	provider, err := r.tokenProvider(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca := certificates.GetByPurpose(internalcluster.ClusterCA)
+	if ca == nil || ca.KeyPair == nil {
+		return nil, nil, errors.New("the cluster CA is required to join with a token backend")
+	}
+	vip, err := r.clusterControlPlaneVIP(ctx, cluster, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	server, err := joinServer(cluster, vip)
+	if err != nil {
+		return nil, nil, err
+	}
+	return provider.JoinFiles(ctx, cluster, config, server, ca.KeyPair.Cert)
+}
+
+// ExecTokenProvider joins machines with the credentials of an exec credential plugin run on the machine by kubeadm
+// and the kubelet, e.g. aws-iam-authenticator issuing tokens from the IAM role of the instance. The plugin must be
+// installed on the machines, and the API server must map the identities it authenticates to the system:bootstrappers
+// group.
+type ExecTokenProvider struct {
+	// Command is the exec credential plugin.
+	Command string
+	// Args are the arguments of the plugin. ClusterNamePlaceholder is replaced by the name of the cluster.
+	Args []string
+	// Env are the environment variables of the plugin. ClusterNamePlaceholder is replaced by the name of the cluster.
+	Env map[string]string
+}
+
+// Discovery sets the file discovery of the config to the kubeconfig running the plugin.
+func (p ExecTokenProvider) Discovery(_ context.Context, _ *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) error {
+	if p.Command == "" {
+		return errors.New("the Exec token backend requires a command")
+	}
+
+	discovery := &config.Spec.JoinConfiguration.Discovery
+	if discovery.BootstrapToken != nil {
+		return errors.New("JoinConfiguration.Discovery.BootstrapToken must not be set when using the Exec token backend")
+	}
+	if discovery.File != nil && discovery.File.KubeConfigPath != ExecBootstrapKubeconfigPath {
+		return errors.New("JoinConfiguration.Discovery.File must not be set when using the Exec token backend")
+	}
+	discovery.File = &kubeadmv1beta1.FileDiscovery{KubeConfigPath: ExecBootstrapKubeconfigPath}
+	return nil
+}
+
+// JoinFiles returns the kubeconfig running the plugin to authenticate to the API server.
+func (p ExecTokenProvider) JoinFiles(_ context.Context, cluster *clusterv1.Cluster, _ *bootstrapv1.KubeadmConfig, server string, caCert []byte) ([]bootstrapv1.File, []string, error) {
+	expand := func(s string) string {
+		return strings.Replace(s, ClusterNamePlaceholder, cluster.Name, -1)
+	}
+
+	exec := &clientcmdapi.ExecConfig{
+		Command:    p.Command,
+		APIVersion: execCredentialAPIVersion,
+	}
+	for _, arg := range p.Args {
+		exec.Args = append(exec.Args, expand(arg))
+	}
+	names := make([]string, 0, len(p.Env))
+	for name := range p.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		exec.Env = append(exec.Env, clientcmdapi.ExecEnvVar{Name: name, Value: expand(p.Env[name])})
+	}
+
+	user := "kubelet-bootstrap"
+	kubeconfig := clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			cluster.Name: {
+				Server:                   server,
+				CertificateAuthorityData: caCert,
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			user: {Exec: exec},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			user + "@" + cluster.Name: {
+				Cluster:  cluster.Name,
+				AuthInfo: user,
+			},
+		},
+		CurrentContext: user + "@" + cluster.Name,
+	}
+	out, err := clientcmd.Write(kubeconfig)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to serialize exec kubeconfig")
+	}
+
+	return []bootstrapv1.File{
+		{
+			Path:        ExecBootstrapKubeconfigPath,
+			Owner:       "root:root",
+			Permissions: "0600",
+			Content:     string(out),
+		},
+	}, nil, nil
+}
+
+// Refresh does nothing, as the plugin issues fresh credentials whenever they are used.
+func (p ExecTokenProvider) Refresh(context.Context, *clusterv1.Cluster, *bootstrapv1.KubeadmConfig) (time.Duration, error) {
+	return 0, nil
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+type fakeTokenProvider struct {
+	refreshes int
+}
+
+func (p *fakeTokenProvider) Discovery(_ context.Context, _ *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) error {
+	config.Spec.JoinConfiguration.Discovery.File = &kubeadmv1beta1.FileDiscovery{KubeConfigPath: "/etc/kubernetes/fake.conf"}
+	return nil
+}
+
+func (p *fakeTokenProvider) JoinFiles(_ context.Context, _ *clusterv1.Cluster, _ *bootstrapv1.KubeadmConfig, server string, _ []byte) ([]bootstrapv1.File, []string, error) {
+	return []bootstrapv1.File{{Path: "/etc/kubernetes/fake.conf", Content: server}}, []string{"fake-attest"}, nil
+}
+
+func (p *fakeTokenProvider) Refresh(context.Context, *clusterv1.Cluster, *bootstrapv1.KubeadmConfig) (time.Duration, error) {
+	p.refreshes++
+	return time.Minute, nil
+}
+
+func TestKubeadmConfigReconciler_Reconcile_TokenBackend(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.InfrastructureReady = true
+	cluster.Status.ControlPlaneInitialized = true
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+
+	workerMachine := newWorkerMachine(cluster)
+	workerJoinConfig := newWorkerJoinKubeadmConfig(workerMachine)
+	workerJoinConfig.Spec.TokenBackend = "fake"
+
+	objects := []runtime.Object{
+		cluster,
+		workerMachine,
+		workerJoinConfig,
+	}
+	objects = append(objects, createSecrets(t, cluster, workerJoinConfig)...)
+	myclient := newFakeClientWithScheme(setupScheme(), objects...)
+
+	provider := &fakeTokenProvider{}
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               myclient,
+		SecretsClientFactory: newFakeSecretFactory(),
+		KubeadmInitLock:      &myInitLocker{},
+		TokenProviders:       map[string]TokenProvider{"fake": provider},
+	}
+	request := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "worker-join-cfg",
+		},
+	}
+	if _, err := k.Reconcile(request); err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+
+	cfg, err := getKubeadmConfig(myclient, "worker-join-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Status.Ready {
+		t.Fatal("Expected status ready")
+	}
+	discovery := cfg.Spec.JoinConfiguration.Discovery
+	if discovery.BootstrapToken != nil || discovery.File == nil || discovery.File.KubeConfigPath != "/etc/kubernetes/fake.conf" {
+		t.Fatalf("expected the discovery of the token backend, got %+v", discovery)
+	}
+	for _, expected := range []string{"path: /etc/kubernetes/fake.conf", "https://100.105.150.1:6443", "fake-attest"} {
+		if !bytes.Contains(cfg.Status.BootstrapData, []byte(expected)) {
+			t.Errorf("expected bootstrap data to contain %q, got:\n%s", expected, cfg.Status.BootstrapData)
+		}
+	}
+
+	myremoteclient, _ := k.SecretsClientFactory.NewSecretsClient(context.Background(), nil, nil)
+	l, err := myremoteclient.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Items) != 0 {
+		t.Errorf("expected no bootstrap token to be created, got %d", len(l.Items))
+	}
+
+	result, err := k.Reconcile(request)
+	if err != nil {
+		t.Fatalf("Failed to reconcile:\n %+v", err)
+	}
+	if provider.refreshes != 1 || result.RequeueAfter != time.Minute {
+		t.Errorf("expected the join credentials to be refreshed by the token backend, got %d refreshes and %+v", provider.refreshes, result)
+	}
+}
+
+func TestReconcileTokenBackendDiscovery(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "100.105.150.1", Port: 6443}}
+	k := &KubeadmConfigReconciler{
+		Log:            log.Log,
+		Client:         newFakeClientWithScheme(setupScheme()),
+		TokenProviders: map[string]TokenProvider{"fake": &fakeTokenProvider{}},
+	}
+
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+	config.Spec.TokenBackend = "unknown"
+	if err := k.reconcileTokenBackendDiscovery(context.Background(), cluster, config); err == nil {
+		t.Error("expected an error for an unknown token backend")
+	}
+
+	config.Spec.TokenBackend = "fake"
+	config.Spec.EnsureBootstrapTokenRBAC = true
+	if err := k.reconcileTokenBackendDiscovery(context.Background(), cluster, config); err == nil {
+		t.Error("expected an error with ensureBootstrapTokenRBAC")
+	}
+
+	config.Spec.EnsureBootstrapTokenRBAC = false
+	if err := k.reconcileTokenBackendDiscovery(context.Background(), cluster, config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Spec.JoinConfiguration.Discovery.File == nil {
+		t.Error("expected the token backend to set the discovery")
+	}
+}
+
+func TestExecTokenProvider(t *testing.T) {
+	cluster := newCluster("cluster")
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+	p := ExecTokenProvider{
+		Command: "aws-iam-authenticator",
+		Args:    []string{"token", "-i", ClusterNamePlaceholder},
+		Env:     map[string]string{"AWS_PROFILE": "nodes"},
+	}
+
+	config.Spec.JoinConfiguration.Discovery.BootstrapToken = &kubeadmv1beta1.BootstrapTokenDiscovery{Token: "abcdef.0123456789abcdef"}
+	if err := p.Discovery(context.Background(), cluster, config); err == nil {
+		t.Error("expected an error with bootstrap token discovery")
+	}
+	config.Spec.JoinConfiguration.Discovery.BootstrapToken = nil
+	if err := p.Discovery(context.Background(), cluster, config); err != nil {
+		t.Fatal(err)
+	}
+	if file := config.Spec.JoinConfiguration.Discovery.File; file == nil || file.KubeConfigPath != ExecBootstrapKubeconfigPath {
+		t.Fatalf("expected file discovery with the exec kubeconfig, got %+v", config.Spec.JoinConfiguration.Discovery)
+	}
+	if err := p.Discovery(context.Background(), cluster, config); err != nil {
+		t.Errorf("expected the discovery to be kept, got %v", err)
+	}
+
+	files, commands, err := p.JoinFiles(context.Background(), cluster, config, "https://100.105.150.1:6443", []byte("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != ExecBootstrapKubeconfigPath || len(commands) != 0 {
+		t.Fatalf("unexpected files %+v and commands %v", files, commands)
+	}
+	kubeconfig, err := clientcmd.Load([]byte(files[0].Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeContext := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if server := kubeconfig.Clusters[kubeContext.Cluster].Server; server != "https://100.105.150.1:6443" {
+		t.Errorf("unexpected server %q", server)
+	}
+	exec := kubeconfig.AuthInfos[kubeContext.AuthInfo].Exec
+	if exec == nil || exec.Command != "aws-iam-authenticator" || len(exec.Args) != 3 || exec.Args[2] != "cluster" {
+		t.Fatalf("unexpected exec config %+v", exec)
+	}
+	if len(exec.Env) != 1 || exec.Env[0].Name != "AWS_PROFILE" || exec.Env[0].Value != "nodes" {
+		t.Errorf("unexpected exec environment %+v", exec.Env)
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	bootstrapTokensGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cabpk_bootstrap_tokens",
+			Help: "Number of bootstrap token secrets created by CABPK that remain in a workload cluster after the last sweep.",
+		},
+		[]string{"namespace", "cluster"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(bootstrapTokensGauge)
+}
+
+// TokenSweeperReconciler periodically removes the bootstrap token secrets CABPK created in a workload cluster
+// once they are expired, or once the KubeadmConfig they were created for no longer exists. The file chunk secrets,
+// and the Role allowing them to be read, of the KubeadmConfigs that no longer exist or whose bootstrap token was
+// removed are removed as well.
+type TokenSweeperReconciler struct {
+	Client               client.Client
+	SecretsClientFactory SecretsClientFactory
+	RBACClientFactory    RBACClientFactory
+	Log                  logr.Logger
+
+	// SweepInterval is the interval at which the token secrets of each cluster are swept.
+	SweepInterval time.Duration
+	// ReconcileTimeout is the deadline of a sweep, after which the pending workload cluster calls are cancelled.
+	// Defaults to DefaultReconcileTimeout.
+	ReconcileTimeout time.Duration
+}
+
+// SetupWithManager sets up the reconciler with the Manager.
+func (r *TokenSweeperReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("bootstrap-token-sweeper").
+		For(&clusterv1.Cluster{}).
+		Complete(r)
+}
+
+// Reconcile sweeps the bootstrap token secrets of a cluster.
+func (r *TokenSweeperReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := reconcileContext(r.ReconcileTimeout)
+	defer cancel()
+	log := r.Log.WithValues("cluster", req.NamespacedName)
+
+	cluster := &clusterv1.Cluster{}
+	if err := r.Client.Get(ctx, req.NamespacedName, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			bootstrapTokensGauge.DeleteLabelValues(req.Namespace, req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !cluster.DeletionTimestamp.IsZero() {
+		bootstrapTokensGauge.DeleteLabelValues(cluster.Namespace, cluster.Name)
+		return ctrl.Result{}, nil
+	}
+	if !cluster.Status.ControlPlaneInitialized && !externalControlPlane(cluster) {
+		return ctrl.Result{RequeueAfter: r.SweepInterval}, nil
+	}
+
+	secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	now := time.Now()
+	secrets, err := secretsClient.List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{clusterv1.MachineClusterLabelName: cluster.Name}).String(),
+	})
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to list bootstrap token secrets")
+	}
+
+	remaining := 0
+	present, removed := map[string]string{}, map[string]string{}
+	// the configs whose file chunks are no longer readable: the config was deleted, or its bootstrap token removed
+	orphanedFiles, removedTokens := map[string]bool{}, map[string]string{}
+	for i := range secrets.Items {
+		s := &secrets.Items[i]
+		if s.Type != bootstrapapi.SecretTypeBootstrapToken && s.Type != bootstrapFileSecretType && s.Type != nodeAgentSecretType {
+			continue
+		}
+		id := string(s.Data[bootstrapapi.BootstrapTokenIDKey])
+
+		reason, err := r.sweepReason(ctx, cluster, s.Labels[TokenConfigLabelName], s.Data[bootstrapapi.BootstrapTokenExpirationKey], now)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if reason == "" {
+			if s.Type == bootstrapapi.SecretTypeBootstrapToken {
+				remaining++
+				present[id] = string(s.Data[bootstrapapi.BootstrapTokenExpirationKey])
+			}
+			continue
+		}
+
+		if err := secretsClient.Delete(s.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to delete secret %s", s.Name)
+		}
+		log.Info("Deleted bootstrap secret", "secret", s.Name, "type", s.Type, "reason", reason)
+		if s.Type == bootstrapapi.SecretTypeBootstrapToken {
+			removed[id] = reason
+		}
+		if configName := s.Labels[TokenConfigLabelName]; configName != "" {
+			switch {
+			case reason == tokenOrphanedReason:
+				orphanedFiles[configName] = true
+			case s.Type == bootstrapapi.SecretTypeBootstrapToken:
+				removedTokens[configName] = id
+			}
+		}
+	}
+
+	if err := r.sweepFileChunks(ctx, cluster, secretsClient, orphanedFiles, removedTokens); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.auditTokens(ctx, cluster, present, removed, now); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.sweepKubeadmCerts(ctx, cluster, secretsClient); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	bootstrapTokensGauge.WithLabelValues(cluster.Namespace, cluster.Name).Set(float64(remaining))
+	return ctrl.Result{RequeueAfter: r.SweepInterval}, nil
+}
+
+// sweepFileChunks deletes the file chunk secrets and the Role of the configs that no longer exist, and of the configs
+// whose removed bootstrap token is still the one allowed to read them; the chunks of a config that was rendered again
+// with a new token are kept.
+func (r *TokenSweeperReconciler) sweepFileChunks(ctx context.Context, cluster *clusterv1.Cluster, secretsClient typedcorev1.SecretInterface, orphaned map[string]bool, removedTokens map[string]string) error {
+	if len(orphaned) == 0 && len(removedTokens) == 0 {
+		return nil
+	}
+	rbacClient, err := r.RBACClientFactory.NewRBACClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+
+	for configName, tokenID := range removedTokens {
+		if orphaned[configName] {
+			continue
+		}
+		binding, err := rbacClient.RoleBindings(metav1.NamespaceSystem).Get(fileChunkRoleName(configName), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to get RoleBinding %q", fileChunkRoleName(configName))
+		}
+		if len(binding.Subjects) != 1 || binding.Subjects[0].Name != bootstrapapi.BootstrapUserPrefix+tokenID {
+			continue
+		}
+		orphaned[configName] = true
+	}
+
+	for configName := range orphaned {
+		if err := deleteFileChunks(secretsClient, rbacClient, cluster, configName, nil); err != nil {
+			return err
+		}
+		r.Log.Info("Deleted bootstrap files", "cluster", cluster.Name, "kubeadmconfig", configName)
+	}
+	return nil
+}
+
+// sweepReason returns why a token secret should be deleted, or an empty string if it should be kept.
+func (r *TokenSweeperReconciler) sweepReason(ctx context.Context, cluster *clusterv1.Cluster, configName string, expiration []byte, now time.Time) (string, error) {
+	if len(expiration) > 0 {
+		expiresAt, err := time.Parse(time.RFC3339, string(expiration))
+		if err != nil || expiresAt.Before(now) {
+			return tokenExpiredReason, nil
+		}
+	}
+
+	if configName == "" {
+		return "", nil
+	}
+	config := &bootstrapv1.KubeadmConfig{}
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: configName}, config)
+	switch {
+	case apierrors.IsNotFound(err):
+		return tokenOrphanedReason, nil
+	case err != nil:
+		return "", errors.Wrapf(err, "failed to get KubeadmConfig %s/%s", cluster.Namespace, configName)
+	}
+	return "", nil
+}
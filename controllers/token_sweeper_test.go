@@ -0,0 +1,188 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclient "k8s.io/client-go/kubernetes/fake"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func newTokenSecret(name, clusterName, configName string, expiration time.Time) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: metav1.NamespaceSystem,
+			Name:      name,
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: clusterName,
+				TokenConfigLabelName:              configName,
+			},
+		},
+		Type: bootstrapapi.SecretTypeBootstrapToken,
+		Data: map[string][]byte{
+			bootstrapapi.BootstrapTokenExpirationKey: []byte(expiration.UTC().Format(time.RFC3339)),
+		},
+	}
+}
+
+func newFileChunkSecret(name, clusterName, configName string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: metav1.NamespaceSystem,
+			Name:      name,
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: clusterName,
+				TokenConfigLabelName:              configName,
+			},
+		},
+		Type: bootstrapFileSecretType,
+	}
+}
+
+func TestTokenSweeperReconciler_Reconcile(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.ControlPlaneInitialized = true
+	config := newWorkerJoinKubeadmConfig(newWorkerMachine(cluster))
+
+	secretFactory := newFakeSecretFactory()
+	now := time.Now()
+	for _, s := range []*corev1.Secret{
+		newTokenSecret("bootstrap-token-valid", cluster.Name, config.Name, now.Add(time.Hour)),
+		newTokenSecret("bootstrap-token-expired", cluster.Name, config.Name, now.Add(-time.Hour)),
+		newTokenSecret("bootstrap-token-orphaned", cluster.Name, "deleted-config", now.Add(time.Hour)),
+		newTokenSecret("bootstrap-token-other", "other-cluster", "deleted-config", now.Add(-time.Hour)),
+		newFileChunkSecret("cabpk-file-valid-0", cluster.Name, config.Name),
+		newFileChunkSecret("cabpk-file-orphaned-0", cluster.Name, "deleted-config"),
+	} {
+		if _, err := secretFactory.client.Create(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rbacClient := fakeclient.NewSimpleClientset().RbacV1()
+	if err := applyRole(rbacClient, fileChunkRoleName("deleted-config"), nil, rbacv1.Subject{Kind: rbacv1.UserKind, Name: "system:bootstrap:abcdef"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &TokenSweeperReconciler{
+		Client:               newFakeClientWithScheme(setupScheme(), []runtime.Object{cluster, config}...),
+		SecretsClientFactory: secretFactory,
+		RBACClientFactory:    fakeRBACFactory{client: rbacClient},
+		Log:                  log.Log,
+		SweepInterval:        time.Minute,
+	}
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("expected the tokens to be swept again after %v, got %v", time.Minute, result)
+	}
+
+	secrets, err := secretFactory.client.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := map[string]bool{}
+	for _, s := range secrets.Items {
+		remaining[s.Name] = true
+	}
+	expected := map[string]bool{"bootstrap-token-valid": true, "bootstrap-token-other": true, "cabpk-file-valid-0": true}
+	if len(remaining) != len(expected) {
+		t.Fatalf("expected secrets %v to remain, got %v", expected, remaining)
+	}
+	for name := range expected {
+		if !remaining[name] {
+			t.Errorf("expected secret %s to remain", name)
+		}
+	}
+
+	if count := testutil.ToFloat64(bootstrapTokensGauge.WithLabelValues(cluster.Namespace, cluster.Name)); count != 1 {
+		t.Errorf("expected the gauge to report 1 token, got %v", count)
+	}
+	if _, err := rbacClient.Roles(metav1.NamespaceSystem).Get(fileChunkRoleName("deleted-config"), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the file chunk Role of the deleted config to be deleted, got %v", err)
+	}
+}
+
+func TestTokenSweeperReconciler_SweepFileChunksOfRemovedTokens(t *testing.T) {
+	cluster := newCluster("cluster")
+	cluster.Status.ControlPlaneInitialized = true
+	swept := newKubeadmConfig(newWorkerMachine(cluster), "swept-cfg")
+	renderedAgain := newKubeadmConfig(newMachine(cluster, "other-machine"), "rendered-again-cfg")
+
+	secretFactory := newFakeSecretFactory()
+	expired := newTokenSecret("bootstrap-token-abcdef", cluster.Name, swept.Name, time.Now().Add(-time.Hour))
+	expired.Data[bootstrapapi.BootstrapTokenIDKey] = []byte("abcdef")
+	otherExpired := newTokenSecret("bootstrap-token-ghijkl", cluster.Name, renderedAgain.Name, time.Now().Add(-time.Hour))
+	otherExpired.Data[bootstrapapi.BootstrapTokenIDKey] = []byte("ghijkl")
+	for _, s := range []*corev1.Secret{
+		expired,
+		otherExpired,
+		newFileChunkSecret("cabpk-file-swept-cfg-0", cluster.Name, swept.Name),
+		newFileChunkSecret("cabpk-file-rendered-again-cfg-0", cluster.Name, renderedAgain.Name),
+	} {
+		if _, err := secretFactory.client.Create(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rbacClient := fakeclient.NewSimpleClientset().RbacV1()
+	if err := applyRole(rbacClient, fileChunkRoleName(swept.Name), nil, rbacv1.Subject{Kind: rbacv1.UserKind, Name: "system:bootstrap:abcdef"}); err != nil {
+		t.Fatal(err)
+	}
+	// the config was rendered again with a new token, which is still allowed to read its files
+	if err := applyRole(rbacClient, fileChunkRoleName(renderedAgain.Name), nil, rbacv1.Subject{Kind: rbacv1.UserKind, Name: "system:bootstrap:mnopqr"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &TokenSweeperReconciler{
+		Client:               newFakeClientWithScheme(setupScheme(), []runtime.Object{cluster, swept, renderedAgain}...),
+		SecretsClientFactory: secretFactory,
+		RBACClientFactory:    fakeRBACFactory{client: rbacClient},
+		Log:                  log.Log,
+		SweepInterval:        time.Minute,
+	}
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := secretFactory.client.Get("cabpk-file-swept-cfg-0", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the file chunks of the removed token to be deleted, got %v", err)
+	}
+	if _, err := rbacClient.Roles(metav1.NamespaceSystem).Get(fileChunkRoleName(swept.Name), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the file chunk Role of the removed token to be deleted, got %v", err)
+	}
+	if _, err := secretFactory.client.Get("cabpk-file-rendered-again-cfg-0", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the file chunks readable with a newer token to be kept: %v", err)
+	}
+	if _, err := rbacClient.Roles(metav1.NamespaceSystem).Get(fileChunkRoleName(renderedAgain.Name), metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the file chunk Role bound to a newer token to be kept: %v", err)
+	}
+}
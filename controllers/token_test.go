@@ -0,0 +1,259 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstraputil "k8s.io/cluster-bootstrap/token/util"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestReconcileDiscoveryWithTokenFrom(t *testing.T) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+		Status: clusterv1.ClusterStatus{
+			APIEndpoints: []clusterv1.APIEndpoint{{Host: "example.com", Port: 6443}},
+		},
+	}
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "join-token"},
+		Data: map[string][]byte{
+			"token":   []byte("abcdef.0123456789abcdef\n"),
+			"invalid": []byte("not-a-token"),
+		},
+	}
+	newConfig := func(token, key string) *bootstrapv1.KubeadmConfig {
+		return &bootstrapv1.KubeadmConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "config"},
+			Spec: bootstrapv1.KubeadmConfigSpec{
+				JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+					Discovery: kubeadmv1beta1.Discovery{
+						BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{
+							CACertHashes: []string{"sha256:abc"},
+							Token:        token,
+							TokenFrom: &kubeadmv1beta1.BootstrapTokenSource{
+								SecretKeyRef: &corev1.SecretKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{Name: tokenSecret.Name},
+									Key:                  key,
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	testcases := []struct {
+		name           string
+		config         *bootstrapv1.KubeadmConfig
+		existingSecret []byte
+		expectErr      bool
+	}{
+		{
+			name:   "create the token secret in the workload cluster",
+			config: newConfig("", "token"),
+		},
+		{
+			name:           "accept an existing token secret matching the token",
+			config:         newConfig("", "token"),
+			existingSecret: []byte("0123456789abcdef"),
+		},
+		{
+			name:           "fail if an existing token secret does not match the token",
+			config:         newConfig("", "token"),
+			existingSecret: []byte("fedcba9876543210"),
+			expectErr:      true,
+		},
+		{
+			name:      "fail if both token and tokenFrom are set",
+			config:    newConfig("abcdef.0123456789abcdef", "token"),
+			expectErr: true,
+		},
+		{
+			name:      "fail if the referenced key is missing",
+			config:    newConfig("", "missing"),
+			expectErr: true,
+		},
+		{
+			name:      "fail if the referenced key is not a bootstrap token",
+			config:    newConfig("", "invalid"),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			secretFactory := newFakeSecretFactory()
+			if tc.existingSecret != nil {
+				existing := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: "bootstrap-token-abcdef"},
+					Type:       bootstrapapi.SecretTypeBootstrapToken,
+					Data: map[string][]byte{
+						bootstrapapi.BootstrapTokenIDKey:     []byte("abcdef"),
+						bootstrapapi.BootstrapTokenSecretKey: tc.existingSecret,
+					},
+				}
+				if _, err := secretFactory.client.Create(existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			k := &KubeadmConfigReconciler{
+				Log:                  log.Log,
+				Client:               newFakeClientWithScheme(setupScheme(), tokenSecret),
+				SecretsClientFactory: secretFactory,
+			}
+
+			err := k.reconcileDiscovery(context.Background(), cluster, tc.config, internalcluster.Certificates{}, nil)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+
+			if token := tc.config.Spec.JoinConfiguration.Discovery.BootstrapToken.Token; token != "" {
+				t.Errorf("expected the token not to be stored in the config, got %q", token)
+			}
+
+			s, err := secretFactory.client.Get("bootstrap-token-abcdef", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected the token secret to exist in the workload cluster, got error %v", err)
+			}
+			if tc.existingSecret == nil {
+				if s.Labels[clusterv1.MachineClusterLabelName] != cluster.Name {
+					t.Errorf("expected the token secret to be labeled with the cluster, got labels %v", s.Labels)
+				}
+				if _, ok := s.Labels[TokenConfigLabelName]; ok {
+					t.Errorf("expected the token secret not to be labeled with the config, got labels %v", s.Labels)
+				}
+			}
+
+			joinConfiguration, err := k.joinConfigurationWithToken(context.Background(), tc.config)
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			if joinConfiguration.Discovery.BootstrapToken.Token != "abcdef.0123456789abcdef" {
+				t.Errorf("expected the rendered token to be resolved, got %q", joinConfiguration.Discovery.BootstrapToken.Token)
+			}
+			if joinConfiguration.Discovery.BootstrapToken.TokenFrom != nil {
+				t.Error("expected tokenFrom not to be rendered")
+			}
+			if tc.config.Spec.JoinConfiguration.Discovery.BootstrapToken.Token != "" {
+				t.Error("expected rendering not to alter the config")
+			}
+		})
+	}
+}
+
+func TestValidateBootstrapToken(t *testing.T) {
+	for _, token := range []string{"abcdef.0123456789abcdef", "0a1b2c.3d4e5f6a7b8c9d0e"} {
+		if err := validateBootstrapToken(token); err != nil {
+			t.Errorf("expected token %q to be valid, got error %v", token, err)
+		}
+	}
+	for _, token := range []string{
+		"",
+		"ABCDEF.0123456789abcdef",
+		"abcdef.0123456789abcde",
+		"abcdefg.0123456789abcdef",
+		"abcdef:0123456789abcdef",
+		" abcdef.0123456789abcdef",
+		"abcdef.0123456789abcdef\n",
+	} {
+		err := validateBootstrapToken(token)
+		if err == nil {
+			t.Errorf("expected token %q to be invalid", token)
+			continue
+		}
+		if token != "" && strings.Contains(err.Error(), strings.TrimSpace(token)) {
+			t.Errorf("expected the error not to contain the token, got %v", err)
+		}
+	}
+}
+
+func TestBootstrapTokenSchemaFor(t *testing.T) {
+	for _, schema := range bootstrapTokenSchemas {
+		for _, group := range schema.extraGroups {
+			if err := bootstraputil.ValidateBootstrapGroupName(group); err != nil {
+				t.Errorf("invalid group %q in the schema of %s: %v", group, schema.minVersion, err)
+			}
+		}
+	}
+
+	version := func(v string) *string { return &v }
+	testcases := []struct {
+		kubernetesVersion *string
+		expectGetNodes    bool
+	}{
+		{kubernetesVersion: nil},
+		{kubernetesVersion: version("")},
+		{kubernetesVersion: version("not-a-version")},
+		{kubernetesVersion: version("v1.16.2")},
+		{kubernetesVersion: version("v1.24.0"), expectGetNodes: true},
+		{kubernetesVersion: version("1.25.1"), expectGetNodes: true},
+	}
+	for _, tc := range testcases {
+		if schema := bootstrapTokenSchemaFor(tc.kubernetesVersion); schema.getNodes != tc.expectGetNodes {
+			t.Errorf("expected getNodes %t for version %v, got %t", tc.expectGetNodes, tc.kubernetesVersion, schema.getNodes)
+		}
+	}
+}
+
+func TestNewBootstrapTokenSecret(t *testing.T) {
+	if _, err := newBootstrapTokenSecret("ABCDEF.0123456789abcdef", "description", nil); err == nil {
+		t.Fatal("expected an invalid token to be rejected")
+	}
+
+	kubernetesVersion := "v1.24.0"
+	s, err := newBootstrapTokenSecret("abcdef.0123456789abcdef", "description", &kubernetesVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "bootstrap-token-abcdef" || s.Namespace != metav1.NamespaceSystem || s.Type != bootstrapapi.SecretTypeBootstrapToken {
+		t.Errorf("unexpected token secret %s/%s of type %s", s.Namespace, s.Name, s.Type)
+	}
+	for key, value := range map[string]string{
+		bootstrapapi.BootstrapTokenIDKey:               "abcdef",
+		bootstrapapi.BootstrapTokenSecretKey:           "0123456789abcdef",
+		bootstrapapi.BootstrapTokenUsageSigningKey:     "true",
+		bootstrapapi.BootstrapTokenUsageAuthentication: "true",
+		bootstrapapi.BootstrapTokenExtraGroupsKey:      nodeBootstrapTokenAuthGroup,
+		bootstrapapi.BootstrapTokenDescriptionKey:      "description",
+	} {
+		if string(s.Data[key]) != value {
+			t.Errorf("expected %s to be %q, got %q", key, value, s.Data[key])
+		}
+	}
+	if _, ok := s.Data[bootstrapapi.BootstrapTokenExpirationKey]; !ok {
+		t.Error("expected the token to expire")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// restartRuntimesCommand restarts the container runtimes once the trust store is updated, so that they pick up the
+// new CAs.
+const restartRuntimesCommand = "systemctl try-restart containerd docker"
+
+// resolveTrustBundles converts the trust bundles defined in the config into files to be written in the trust store
+// directories of the OS family of the config, or of both Debian and Red Hat based distributions if unset, along with
+// the commands updating the trust store. Bundles referencing a config map are looked up in the config namespace.
+func (r *KubeadmConfigReconciler) resolveTrustBundles(ctx context.Context, config *bootstrapv1.KubeadmConfig) ([]bootstrapv1.File, []string, error) {
+	if len(config.Spec.AdditionalTrustBundles) == 0 {
+		return nil, nil, nil
+	}
+
+	profile := osProfile(config)
+	files := make([]bootstrapv1.File, 0, len(profile.trustDirs)*len(config.Spec.AdditionalTrustBundles))
+	for _, bundle := range config.Spec.AdditionalTrustBundles {
+		if bundle.Name == "" {
+			return nil, nil, errors.New("trust bundle name must not be empty")
+		}
+		if bundle.Content != "" && bundle.ContentFrom != nil {
+			return nil, nil, errors.Errorf("trust bundle %q must define only one of content or contentFrom", bundle.Name)
+		}
+
+		content := bundle.Content
+		if bundle.ContentFrom != nil {
+			cm := &corev1.ConfigMap{}
+			key := client.ObjectKey{Namespace: config.Namespace, Name: bundle.ContentFrom.Name}
+			if err := r.Get(ctx, key, cm); err != nil {
+				return nil, nil, errors.Wrapf(err, "failed to get config map %s for trust bundle %q", key, bundle.Name)
+			}
+			data, ok := cm.Data[bundle.ContentFrom.Key]
+			if !ok {
+				return nil, nil, errors.Errorf("config map %s does not contain key %q for trust bundle %q", key, bundle.ContentFrom.Key, bundle.Name)
+			}
+			content = data
+		}
+
+		if err := validateTrustBundle([]byte(content)); err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid trust bundle %q", bundle.Name)
+		}
+
+		for _, dir := range profile.trustDirs {
+			files = append(files, bootstrapv1.File{
+				Path:        filepath.Join(dir, bundle.Name+profile.trustExtension),
+				Owner:       "root:root",
+				Permissions: "0644",
+				Content:     content,
+			})
+		}
+	}
+	return files, []string{profile.updateTrustCommand, restartRuntimesCommand}, nil
+}
+
+// validateTrustBundle checks that the bundle contains only PEM encoded certificates, and at least one.
+func validateTrustBundle(data []byte) error {
+	count := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return errors.Errorf("unexpected PEM block of type %q", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return errors.Wrap(err, "failed to parse certificate")
+		}
+		count++
+	}
+	if count == 0 {
+		return errors.New("no PEM encoded certificate found")
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_ResolveTrustBundles(t *testing.T) {
+	bundle := newTestCABundle(t)
+	bundleConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "registry-ca",
+		},
+		Data: map[string]string{
+			"ca.crt":  bundle,
+			"invalid": "not a certificate",
+		},
+	}
+
+	testcases := []struct {
+		name          string
+		bundles       []bootstrapv1.TrustBundle
+		expectedFiles int
+		expectErr     bool
+	}{
+		{
+			name: "no bundles",
+		},
+		{
+			name: "inline bundle",
+			bundles: []bootstrapv1.TrustBundle{
+				{Name: "proxy", Content: bundle},
+			},
+			expectedFiles: 2,
+		},
+		{
+			name: "bundles from inline content and config map",
+			bundles: []bootstrapv1.TrustBundle{
+				{Name: "proxy", Content: bundle + bundle},
+				{Name: "registry", ContentFrom: &bootstrapv1.ConfigMapKeyReference{Name: "registry-ca", Key: "ca.crt"}},
+			},
+			expectedFiles: 4,
+		},
+		{
+			name: "missing config map key",
+			bundles: []bootstrapv1.TrustBundle{
+				{Name: "registry", ContentFrom: &bootstrapv1.ConfigMapKeyReference{Name: "registry-ca", Key: "missing"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid bundle",
+			bundles: []bootstrapv1.TrustBundle{
+				{Name: "registry", ContentFrom: &bootstrapv1.ConfigMapKeyReference{Name: "registry-ca", Key: "invalid"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "both content and contentFrom",
+			bundles: []bootstrapv1.TrustBundle{
+				{Name: "registry", Content: bundle, ContentFrom: &bootstrapv1.ConfigMapKeyReference{Name: "registry-ca", Key: "ca.crt"}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKubeadmConfig(nil, "cfg")
+			config.Spec.AdditionalTrustBundles = tc.bundles
+
+			k := &KubeadmConfigReconciler{
+				Log:    log.Log,
+				Client: newFakeClientWithScheme(setupScheme(), []runtime.Object{bundleConfigMap}...),
+			}
+			files, commands, err := k.resolveTrustBundles(context.Background(), config)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to resolve trust bundles:\n %+v", err)
+			}
+			if len(files) != tc.expectedFiles {
+				t.Fatalf("expected %d files, got %d", tc.expectedFiles, len(files))
+			}
+			if len(files) > 0 && len(commands) == 0 {
+				t.Error("expected commands updating the trust store")
+			}
+			for i, bundle := range tc.bundles {
+				if files[2*i].Path != "/usr/local/share/ca-certificates/"+bundle.Name+".crt" || files[2*i+1].Path != "/etc/pki/ca-trust/source/anchors/"+bundle.Name+".crt" {
+					t.Errorf("unexpected paths for trust bundle %q: %s, %s", bundle.Name, files[2*i].Path, files[2*i+1].Path)
+				}
+			}
+		})
+	}
+}
+
+func newTestCABundle(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
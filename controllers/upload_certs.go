@@ -0,0 +1,206 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/envelope"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// kubeadmCertsSecretName is the name of the secret kubeadm uploads the control plane certificates to in the
+	// kube-system namespace of the workload cluster.
+	kubeadmCertsSecretName = "kubeadm-certs"
+
+	// certificateKeySecretType is the type of the secrets holding the certificate keys of clusters.
+	certificateKeySecretType corev1.SecretType = "bootstrap.cluster.x-k8s.io/certificate-key"
+
+	// certificateKeySecretKey is the key of the certificate key in the certificate key secrets.
+	certificateKeySecretKey = "key"
+)
+
+// kubeadmCertsSecretKeys are the keys of the certificates and private keys in the kubeadm-certs secret, by purpose.
+var kubeadmCertsSecretKeys = map[internalcluster.Purpose][2]string{
+	internalcluster.ClusterCA:      {"ca.crt", "ca.key"},
+	internalcluster.ServiceAccount: {"sa.pub", "sa.key"},
+	internalcluster.FrontProxyCA:   {"front-proxy-ca.crt", "front-proxy-ca.key"},
+	internalcluster.EtcdCA:         {"etcd-ca.crt", "etcd-ca.key"},
+}
+
+// certificateKeySecretName returns the name of the secret holding the certificate key of the cluster.
+func certificateKeySecretName(cluster *clusterv1.Cluster) string {
+	return cluster.Name + "-kubeadm-certificate-key"
+}
+
+// lookupOrCreateCertificateKey returns the certificate key of the cluster, generating it if absent. The secret is owned
+// by the Cluster, so that joining control plane machines find out the control plane was initialized with
+// uploaded certificates.
+func (r *KubeadmConfigReconciler) lookupOrCreateCertificateKey(ctx context.Context, cluster *clusterv1.Cluster) (string, error) {
+	key, err := getCertificateKey(ctx, r.Client, cluster)
+	if err != nil || key != "" {
+		return key, err
+	}
+
+	dataKey, err := envelope.NewDataKey()
+	if err != nil {
+		return "", err
+	}
+	key = hex.EncodeToString(dataKey)
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      certificateKeySecretName(cluster),
+			Namespace: cluster.Namespace,
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+				},
+			},
+		},
+		Type: certificateKeySecretType,
+		Data: map[string][]byte{
+			certificateKeySecretKey: []byte(key),
+		},
+	}
+	if err := r.Create(ctx, s); err != nil {
+		return "", errors.Wrapf(err, "failed to create certificate key secret %s/%s", cluster.Namespace, s.Name)
+	}
+	return key, nil
+}
+
+// getCertificateKey returns the certificate key of the cluster, or an empty string if the control plane was not
+// initialized with uploaded certificates.
+func getCertificateKey(ctx context.Context, c client.Client, cluster *clusterv1.Cluster) (string, error) {
+	s := &corev1.Secret{}
+	name := certificateKeySecretName(cluster)
+	err := c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: name}, s)
+	switch {
+	case apierrors.IsNotFound(err):
+		return "", nil
+	case err != nil:
+		return "", errors.Wrapf(err, "failed to get certificate key secret %s/%s", cluster.Namespace, name)
+	}
+	return string(s.Data[certificateKeySecretKey]), nil
+}
+
+// ensureKubeadmCerts uploads the control plane certificates to the kubeadm-certs secret of the workload cluster if it
+// does not exist, e.g. because it expired before a control plane machine joined. The certificates are encrypted
+// with the certificate key the way kubeadm does.
+func (r *KubeadmConfigReconciler) ensureKubeadmCerts(ctx context.Context, cluster *clusterv1.Cluster, certificateKey string, certificates internalcluster.Certificates) error {
+	secretsClient, err := r.SecretsClientFactory.NewSecretsClient(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+	_, err = secretsClient.Get(kubeadmCertsSecretName, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to get secret %s", kubeadmCertsSecretName)
+	}
+
+	s, err := newKubeadmCertsSecret(certificateKey, certificates)
+	if err != nil {
+		return err
+	}
+	if _, err := secretsClient.Create(s); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "failed to create secret %s", kubeadmCertsSecretName)
+	}
+	r.Log.Info("Uploaded control plane certificates", "cluster", cluster.Name, "secret", kubeadmCertsSecretName)
+	return nil
+}
+
+// newKubeadmCertsSecret returns the kubeadm-certs secret holding the certificates encrypted with the certificate key.
+func newKubeadmCertsSecret(certificateKey string, certificates internalcluster.Certificates) (*corev1.Secret, error) {
+	key, err := hex.DecodeString(certificateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid certificate key")
+	}
+
+	data := map[string][]byte{}
+	for _, certificate := range certificates {
+		keys, ok := kubeadmCertsSecretKeys[certificate.Purpose]
+		if !ok || certificate.KeyPair == nil {
+			continue
+		}
+		for i, content := range [][]byte{certificate.KeyPair.Cert, certificate.KeyPair.Key} {
+			if len(content) == 0 {
+				continue
+			}
+			encrypted, err := envelope.Seal(key, content)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to encrypt %s", keys[i])
+			}
+			data[keys[i]] = encrypted
+		}
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kubeadmCertsSecretName,
+			Namespace: metav1.NamespaceSystem,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}, nil
+}
+
+// sweepKubeadmCerts deletes the kubeadm-certs secret of the workload cluster once all control plane machines of a
+// cluster initialized with uploaded certificates have joined.
+func (r *TokenSweeperReconciler) sweepKubeadmCerts(ctx context.Context, cluster *clusterv1.Cluster, secretsClient typedcorev1.SecretInterface) error {
+	key, err := getCertificateKey(ctx, r.Client, cluster)
+	if err != nil || key == "" {
+		return err
+	}
+
+	machines := &clusterv1.MachineList{}
+	if err := r.Client.List(ctx, machines, client.InNamespace(cluster.Namespace), client.MatchingLabels{
+		clusterv1.MachineClusterLabelName:      cluster.Name,
+		clusterv1.MachineControlPlaneLabelName: "true",
+	}); err != nil {
+		return errors.Wrapf(err, "failed to list control plane machines of Cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	for i := range machines.Items {
+		if machines.Items[i].DeletionTimestamp.IsZero() && machines.Items[i].Status.NodeRef == nil {
+			return nil
+		}
+	}
+
+	if err := secretsClient.Delete(kubeadmCertsSecretName, &metav1.DeleteOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to delete secret %s", kubeadmCertsSecretName)
+	}
+	r.Log.Info("Deleted uploaded control plane certificates", "cluster", cluster.Name, "secret", kubeadmCertsSecretName)
+	return nil
+}
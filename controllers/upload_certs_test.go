@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/envelope"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestEnsureKubeadmCerts(t *testing.T) {
+	cluster := newCluster("cluster")
+	certificates := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	secretFactory := newFakeSecretFactory()
+	r := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               newFakeClientWithScheme(setupScheme(), cluster),
+		SecretsClientFactory: secretFactory,
+	}
+	key, err := r.lookupOrCreateCertificateKey(context.Background(), cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := r.lookupOrCreateCertificateKey(context.Background(), cluster); err != nil || again != key {
+		t.Fatalf("expected the certificate key %q to be reused, got %q and error %v", key, again, err)
+	}
+
+	if err := r.ensureKubeadmCerts(context.Background(), cluster, key, certificates); err != nil {
+		t.Fatal(err)
+	}
+	s, err := secretFactory.client.Get(kubeadmCertsSecretName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Data) != 8 {
+		t.Errorf("expected 8 certificates and keys to be uploaded, got %d", len(s.Data))
+	}
+	dataKey, err := hex.DecodeString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := envelope.Open(dataKey, s.Data["ca.key"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(caKey) != string(certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair.Key) {
+		t.Error("expected the uploaded CA key to match the cluster CA key")
+	}
+}
+
+func TestTokenSweeperReconciler_SweepKubeadmCerts(t *testing.T) {
+	cluster := newCluster("cluster")
+	joined := newControlPlaneMachine(cluster, "control-plane-joined")
+	joined.Status.NodeRef = &corev1.ObjectReference{Name: "control-plane-joined"}
+	pending := newControlPlaneMachine(cluster, "control-plane-pending")
+	keySecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: cluster.Namespace, Name: certificateKeySecretName(cluster)},
+		Data:       map[string][]byte{certificateKeySecretKey: []byte("key")},
+	}
+
+	secretFactory := newFakeSecretFactory()
+	if _, err := secretFactory.client.Create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: kubeadmCertsSecretName}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &TokenSweeperReconciler{
+		Client:               newFakeClientWithScheme(setupScheme(), []runtime.Object{cluster, joined, pending, keySecret}...),
+		SecretsClientFactory: secretFactory,
+		Log:                  log.Log,
+	}
+	if err := r.sweepKubeadmCerts(context.Background(), cluster, secretFactory.client); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secretFactory.client.Get(kubeadmCertsSecretName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the certificates to be kept while a control plane machine is joining, got %v", err)
+	}
+
+	if err := r.Client.Delete(context.Background(), pending); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.sweepKubeadmCerts(context.Background(), cluster, secretFactory.client); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secretFactory.client.Get(kubeadmCertsSecretName, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the certificates to be deleted once all control plane machines joined, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"text/template"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultVIPPort            = 6443
+	defaultVIPVirtualRouterID = 51
+	defaultKubeVIPImage       = "plndr/kube-vip:0.1.8"
+	defaultKeepalivedImage    = "osixia/keepalived:2.0.17"
+
+	kubeVIPManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-vip
+  namespace: kube-system
+spec:
+  hostNetwork: true
+  containers:
+  - name: kube-vip
+    image: {{ .Image }}
+    args:
+    - start
+    env:
+    - name: vip_arp
+      value: "true"
+    - name: vip_leaderelection
+      value: "true"
+    - name: vip_interface
+      value: {{ printf "%q" .Interface }}
+    - name: vip_address
+      value: {{ printf "%q" .Address }}
+    - name: port
+      value: "{{ .Port }}"
+    securityContext:
+      capabilities:
+        add:
+        - NET_ADMIN
+        - SYS_TIME
+    volumeMounts:
+    - mountPath: /etc/kubernetes/admin.conf
+      name: kubeconfig
+  volumes:
+  - hostPath:
+      path: /etc/kubernetes/admin.conf
+      type: FileOrCreate
+    name: kubeconfig
+`
+
+	keepalivedManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: keepalived
+  namespace: kube-system
+spec:
+  hostNetwork: true
+  containers:
+  - name: keepalived
+    image: {{ .Image }}
+    env:
+    - name: KEEPALIVED_INTERFACE
+      value: {{ printf "%q" .Interface }}
+    - name: KEEPALIVED_VIRTUAL_IPS
+      value: {{ printf "%q" .Address }}
+    - name: KEEPALIVED_ROUTER_ID
+      value: "{{ .VirtualRouterID }}"
+    - name: KEEPALIVED_STATE
+      value: BACKUP
+    {{- if .Password }}
+    - name: KEEPALIVED_PASSWORD
+      value: {{ printf "%q" .Password }}
+    {{- end }}
+    securityContext:
+      capabilities:
+        add:
+        - NET_ADMIN
+        - NET_BROADCAST
+        - NET_RAW
+`
+)
+
+// vipManifestInput is the input used to render the static pod manifest managing the control plane virtual IP.
+type vipManifestInput struct {
+	Image           string
+	Interface       string
+	Address         string
+	Port            int32
+	VirtualRouterID int32
+	Password        string
+}
+
+// resolveControlPlaneVIP renders the static pod manifest managing the control plane virtual IP, if one is configured.
+func (r *KubeadmConfigReconciler) resolveControlPlaneVIP(ctx context.Context, config *bootstrapv1.KubeadmConfig) (*bootstrapv1.File, error) {
+	vip := config.Spec.ControlPlaneVIP
+	if vip == nil {
+		return nil, nil
+	}
+	if vip.Address == "" || vip.Interface == "" {
+		return nil, errors.New("control plane VIP requires both address and interface to be set")
+	}
+
+	input := &vipManifestInput{
+		Image:           vip.Image,
+		Interface:       vip.Interface,
+		Address:         vip.Address,
+		Port:            vipPort(vip),
+		VirtualRouterID: vip.VirtualRouterID,
+	}
+	if input.VirtualRouterID == 0 {
+		input.VirtualRouterID = defaultVIPVirtualRouterID
+	}
+
+	var tpl string
+	switch vip.Provider {
+	case bootstrapv1.KubeVIP:
+		tpl = kubeVIPManifest
+		if input.Image == "" {
+			input.Image = defaultKubeVIPImage
+		}
+	case bootstrapv1.Keepalived:
+		tpl = keepalivedManifest
+		if input.Image == "" {
+			input.Image = defaultKeepalivedImage
+		}
+		if vip.CredentialsFrom != nil {
+			s := &corev1.Secret{}
+			key := client.ObjectKey{Namespace: config.Namespace, Name: vip.CredentialsFrom.Name}
+			if err := r.Get(ctx, key, s); err != nil {
+				return nil, errors.Wrapf(err, "failed to get secret %s for control plane VIP credentials", key)
+			}
+			password, ok := s.Data[vip.CredentialsFrom.Key]
+			if !ok {
+				return nil, errors.Errorf("secret %s does not contain key %q for control plane VIP credentials", key, vip.CredentialsFrom.Key)
+			}
+			input.Password = string(password)
+		}
+	default:
+		return nil, errors.Errorf("unsupported control plane VIP provider %q", vip.Provider)
+	}
+
+	t, err := template.New(string(vip.Provider)).Parse(tpl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s manifest template", vip.Provider)
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, input); err != nil {
+		return nil, errors.Wrapf(err, "failed to generate %s manifest", vip.Provider)
+	}
+
+	return &bootstrapv1.File{
+		Path:        filepath.Join(staticPodManifestsDir, string(vip.Provider)+".yaml"),
+		Owner:       "root:root",
+		Permissions: "0600",
+		Content:     out.String(),
+	}, nil
+}
+
+// clusterControlPlaneVIP returns the control plane virtual IP joining machines connect to: the one of the config if
+// set, otherwise the one configured on a control plane machine of the cluster, so that worker templates do not have
+// to repeat it. It returns nil if the cluster has no control plane virtual IP.
+func (r *KubeadmConfigReconciler) clusterControlPlaneVIP(ctx context.Context, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) (*bootstrapv1.ControlPlaneVIP, error) {
+	if config.Spec.ControlPlaneVIP != nil {
+		return config.Spec.ControlPlaneVIP, nil
+	}
+
+	machines := &clusterv1.MachineList{}
+	if err := r.List(ctx, machines, client.InNamespace(cluster.Namespace), client.MatchingLabels{
+		clusterv1.MachineClusterLabelName:      cluster.Name,
+		clusterv1.MachineControlPlaneLabelName: "true",
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list control plane machines of Cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	for _, m := range machines.Items {
+		if m.Spec.Bootstrap.ConfigRef == nil ||
+			m.Spec.Bootstrap.ConfigRef.GroupVersionKind() != bootstrapv1.GroupVersion.WithKind("KubeadmConfig") {
+			continue
+		}
+		controlPlaneConfig := &bootstrapv1.KubeadmConfig{}
+		key := client.ObjectKey{Namespace: m.Namespace, Name: m.Spec.Bootstrap.ConfigRef.Name}
+		if err := r.Get(ctx, key, controlPlaneConfig); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to get KubeadmConfig %s", key)
+		}
+		if controlPlaneConfig.Spec.ControlPlaneVIP != nil {
+			return controlPlaneConfig.Spec.ControlPlaneVIP, nil
+		}
+	}
+	return nil, nil
+}
+
+// vipEndpoint returns the control plane endpoint served by the virtual IP.
+func vipEndpoint(vip *bootstrapv1.ControlPlaneVIP) string {
+	return net.JoinHostPort(vip.Address, strconv.Itoa(int(vipPort(vip))))
+}
+
+func vipPort(vip *bootstrapv1.ControlPlaneVIP) int32 {
+	if vip.Port == 0 {
+		return defaultVIPPort
+	}
+	return vip.Port
+}
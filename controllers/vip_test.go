@@ -0,0 +1,180 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestKubeadmConfigReconciler_ResolveControlPlaneVIP(t *testing.T) {
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "vip-credentials",
+		},
+		Data: map[string][]byte{
+			"password": []byte("s3cr3t"),
+		},
+	}
+
+	testcases := []struct {
+		name         string
+		vip          *bootstrapv1.ControlPlaneVIP
+		expectedPath string
+		expected     []string
+		expectErr    bool
+	}{
+		{
+			name: "no vip",
+		},
+		{
+			name: "kube-vip with defaults",
+			vip: &bootstrapv1.ControlPlaneVIP{
+				Provider:  bootstrapv1.KubeVIP,
+				Address:   "10.0.0.100",
+				Interface: "eth0",
+			},
+			expectedPath: "/etc/kubernetes/manifests/kube-vip.yaml",
+			expected:     []string{"image: " + defaultKubeVIPImage, `value: "10.0.0.100"`, `value: "eth0"`, `value: "6443"`},
+		},
+		{
+			name: "keepalived with credentials",
+			vip: &bootstrapv1.ControlPlaneVIP{
+				Provider:        bootstrapv1.Keepalived,
+				Address:         "10.0.0.100",
+				Interface:       "eth1",
+				VirtualRouterID: 10,
+				CredentialsFrom: &bootstrapv1.SecretKeyReference{Name: "vip-credentials", Key: "password"},
+			},
+			expectedPath: "/etc/kubernetes/manifests/keepalived.yaml",
+			expected:     []string{"image: " + defaultKeepalivedImage, `value: "10.0.0.100"`, `value: "eth1"`, `value: "10"`, `value: "s3cr3t"`},
+		},
+		{
+			name: "missing interface",
+			vip: &bootstrapv1.ControlPlaneVIP{
+				Provider: bootstrapv1.KubeVIP,
+				Address:  "10.0.0.100",
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := newKubeadmConfig(nil, "cfg")
+			config.Spec.ControlPlaneVIP = tc.vip
+
+			k := &KubeadmConfigReconciler{
+				Log:    log.Log,
+				Client: newFakeClientWithScheme(setupScheme(), []runtime.Object{credentials}...),
+			}
+			manifest, err := k.resolveControlPlaneVIP(context.Background(), config)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to resolve control plane VIP:\n %+v", err)
+			}
+			if tc.vip == nil {
+				if manifest != nil {
+					t.Fatalf("did not expect a manifest, got %+v", manifest)
+				}
+				return
+			}
+			if manifest.Path != tc.expectedPath {
+				t.Fatalf("expected path %q, got %q", tc.expectedPath, manifest.Path)
+			}
+			for _, e := range tc.expected {
+				if !strings.Contains(manifest.Content, e) {
+					t.Errorf("%s\ndid not contain\n%s", manifest.Content, e)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeadmConfigReconciler_ReconcileTopLevelObjectSettings_ControlPlaneVIP(t *testing.T) {
+	cluster := newCluster("mycluster")
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "myControlPlaneEndpoint", Port: 6443}}
+	machine := newControlPlaneMachine(cluster, "control-plane-machine")
+	config := newControlPlaneInitKubeadmConfig(machine, "cfg")
+	config.Spec.ClusterConfiguration = &kubeadmv1beta1.ClusterConfiguration{}
+	config.Spec.ControlPlaneVIP = &bootstrapv1.ControlPlaneVIP{
+		Provider:  bootstrapv1.KubeVIP,
+		Address:   "10.0.0.100",
+		Interface: "eth0",
+		Port:      8443,
+	}
+
+	k := &KubeadmConfigReconciler{
+		Log: log.Log,
+	}
+	k.reconcileTopLevelObjectSettings(cluster, machine, config)
+
+	if config.Spec.ClusterConfiguration.ControlPlaneEndpoint != "10.0.0.100:8443" {
+		t.Errorf("expected ClusterConfiguration.ControlPlaneEndpoint %q, got %q", "10.0.0.100:8443", config.Spec.ClusterConfiguration.ControlPlaneEndpoint)
+	}
+	if !containsString(config.Spec.ClusterConfiguration.APIServer.CertSANs, "10.0.0.100") {
+		t.Errorf("expected ClusterConfiguration.APIServer.CertSANs to contain %q, got %v", "10.0.0.100", config.Spec.ClusterConfiguration.APIServer.CertSANs)
+	}
+}
+
+func TestKubeadmConfigReconciler_ReconcileDiscovery_ClusterControlPlaneVIP(t *testing.T) {
+	cluster := newCluster("mycluster")
+	cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "myControlPlaneEndpoint", Port: 6443}}
+	controlPlaneMachine := newControlPlaneMachine(cluster, "control-plane-machine")
+	controlPlaneConfig := newControlPlaneInitKubeadmConfig(controlPlaneMachine, "control-plane-cfg")
+	controlPlaneConfig.Spec.ControlPlaneVIP = &bootstrapv1.ControlPlaneVIP{
+		Provider:  bootstrapv1.KubeVIP,
+		Address:   "10.0.0.100",
+		Interface: "eth0",
+		Port:      8443,
+	}
+	workerMachine := newWorkerMachine(cluster)
+	workerConfig := newWorkerJoinKubeadmConfig(workerMachine)
+	workerConfig.Spec.JoinConfiguration.Discovery.BootstrapToken = &kubeadmv1beta1.BootstrapTokenDiscovery{CACertHashes: []string{"sha256:abc"}}
+
+	k := &KubeadmConfigReconciler{
+		Log:                  log.Log,
+		Client:               newFakeClientWithScheme(setupScheme(), cluster, controlPlaneMachine, controlPlaneConfig, workerMachine, workerConfig),
+		SecretsClientFactory: newFakeSecretFactory(),
+	}
+	if err := k.reconcileDiscovery(context.Background(), cluster, workerConfig, internalcluster.Certificates{}, nil); err != nil {
+		t.Fatalf("expected nil, got error %v", err)
+	}
+	if endpoint := workerConfig.Spec.JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint; endpoint != "10.0.0.100:8443" {
+		t.Errorf("expected APIServerEndpoint %q, got %q", "10.0.0.100:8443", endpoint)
+	}
+	if workerConfig.Spec.ControlPlaneVIP != nil {
+		t.Errorf("expected the worker config not to manage the control plane VIP, got %+v", workerConfig.Spec.ControlPlaneVIP)
+	}
+}
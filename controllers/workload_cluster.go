@@ -0,0 +1,211 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	capiremote "sigs.k8s.io/cluster-api/controllers/remote"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// WorkloadClusterAuthAnnotation is set on a Cluster to select how CABPK authenticates to its workload cluster.
+	// Defaults to KubeconfigAuth.
+	WorkloadClusterAuthAnnotation = "bootstrap.cluster.x-k8s.io/workload-cluster-auth"
+
+	// KubeconfigAuth uses the admin kubeconfig secret of the cluster.
+	KubeconfigAuth = "kubeconfig"
+	// ServiceAccountTokenAuth uses the bearer token of a service account provisioned in the workload cluster,
+	// stored in the WorkloadAuthTokenKey of the workload auth secret.
+	ServiceAccountTokenAuth = "service-account-token"
+	// ExecAuth uses a client-go exec credential plugin, whose JSON configuration is stored in the WorkloadAuthExecKey
+	// of the workload auth secret. The plugin command must be allowed by the controller.
+	ExecAuth = "exec"
+
+	// WorkloadAuthSecretPurpose is the purpose of the secret, named <cluster>-workload-auth, holding the
+	// credentials for the non-kubeconfig auth modes.
+	WorkloadAuthSecretPurpose secret.Purpose = "workload-auth"
+	// WorkloadAuthTokenKey is the key of the service account token in the workload auth secret.
+	WorkloadAuthTokenKey = "token"
+	// WorkloadAuthExecKey is the key of the exec plugin configuration in the workload auth secret.
+	WorkloadAuthExecKey = "exec"
+	// WorkloadAuthKonnectivityProxyKey is the optional key of the host:port of a konnectivity server in
+	// HTTP CONNECT mode, through which the connections to the workload cluster are tunneled.
+	WorkloadAuthKonnectivityProxyKey = "konnectivity-proxy"
+)
+
+// workloadClusterRESTConfig returns the configuration to access the workload cluster, using the auth mode set on the cluster.
+// Exec plugins are only allowed to run the given commands. The requests made with the configuration are rate limited
+// with WorkloadClusterQPS and WorkloadClusterBurst, bound to the context, so that they are cancelled with it, and go
+// through the circuit breaker of the cluster, which fails them fast while the cluster fails repeatedly.
+func workloadClusterRESTConfig(ctx context.Context, c client.Client, cluster *clusterv1.Cluster, allowedExecCommands []string) (*rest.Config, error) {
+	clusterKey := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+	if err := workloadClusterCircuits.allow(clusterKey); err != nil {
+		return nil, err
+	}
+
+	mode := cluster.Annotations[WorkloadClusterAuthAnnotation]
+	if mode == "" || mode == KubeconfigAuth {
+		remoteClient, err := capiremote.NewClusterClient(c, cluster)
+		if err != nil {
+			return nil, err
+		}
+		config := rest.CopyConfig(remoteClient.RESTConfig())
+		auth, err := secret.Get(c, cluster, WorkloadAuthSecretPurpose)
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return nil, errors.Wrapf(err, "failed to get workload auth secret for cluster %s/%s", cluster.Namespace, cluster.Name)
+		default:
+			configureKonnectivity(config, auth)
+		}
+		InstrumentRESTConfig(config, WorkloadClusterClient, WorkloadClusterQPS, WorkloadClusterBurst)
+		breakCircuit(workloadClusterCircuits, clusterKey, config)
+		bindContext(ctx, config)
+		return config, nil
+	}
+
+	if len(cluster.Status.APIEndpoints) == 0 {
+		return nil, errors.Errorf("cluster %s/%s has no APIEndpoints", cluster.Namespace, cluster.Name)
+	}
+	ca, err := certsecret.Get(ctx, c, cluster, internalcluster.ClusterCA)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get CA secret for cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	auth, err := secret.Get(c, cluster, WorkloadAuthSecretPurpose)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get workload auth secret for cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+
+	config := &rest.Config{
+		Host: "https://" + apiEndpointAddress(cluster.Status.APIEndpoints[0]),
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData: ca.Data[secret.TLSCrtDataName],
+		},
+	}
+
+	switch mode {
+	case ServiceAccountTokenAuth:
+		token := auth.Data[WorkloadAuthTokenKey]
+		if len(token) == 0 {
+			return nil, errors.Errorf("workload auth secret %s has no %q key", auth.Name, WorkloadAuthTokenKey)
+		}
+		config.BearerToken = string(token)
+	case ExecAuth:
+		exec := &clientcmdapi.ExecConfig{}
+		if err := json.Unmarshal(auth.Data[WorkloadAuthExecKey], exec); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the %q key of workload auth secret %s", WorkloadAuthExecKey, auth.Name)
+		}
+		if !containsString(allowedExecCommands, exec.Command) {
+			return nil, errors.Errorf("exec plugin command %q is not allowed", exec.Command)
+		}
+		config.ExecProvider = exec
+	default:
+		return nil, errors.Errorf("unsupported workload cluster auth mode %q", mode)
+	}
+
+	configureKonnectivity(config, auth)
+	InstrumentRESTConfig(config, WorkloadClusterClient, WorkloadClusterQPS, WorkloadClusterBurst)
+	breakCircuit(workloadClusterCircuits, clusterKey, config)
+	bindContext(ctx, config)
+	return config, nil
+}
+
+// bindContext binds the requests made with the configuration to the context, so that a remote call cannot outlive
+// the reconciliation it is made for.
+func bindContext(ctx context.Context, config *rest.Config) {
+	wrap := config.WrapTransport
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return &contextRoundTripper{ctx: ctx, delegate: rt}
+	}
+}
+
+// contextRoundTripper sends the requests with its context.
+type contextRoundTripper struct {
+	ctx      context.Context
+	delegate http.RoundTripper
+}
+
+func (t *contextRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.delegate.RoundTrip(req.WithContext(t.ctx))
+}
+
+// configureKonnectivity tunnels the connections to the workload cluster through a konnectivity server,
+// if one is set in the workload auth secret.
+func configureKonnectivity(config *rest.Config, auth *corev1.Secret) {
+	if proxy := string(auth.Data[WorkloadAuthKonnectivityProxyKey]); proxy != "" {
+		config.Dial = httpConnectDialer(proxy)
+	}
+}
+
+// httpConnectDialer returns a dial function opening connections through an HTTP CONNECT proxy.
+func httpConnectDialer(proxyAddress string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", proxyAddress)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to dial konnectivity server %s", proxyAddress)
+		}
+
+		if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", address, address); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "failed to send CONNECT request")
+		}
+		br := bufio.NewReader(conn)
+		res, err := http.ReadResponse(br, nil)
+		if err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "failed to read CONNECT response")
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			conn.Close()
+			return nil, errors.Errorf("konnectivity server %s refused to tunnel to %s: %s", proxyAddress, address, res.Status)
+		}
+		return &bufferedConn{Conn: conn, reader: br}, nil
+	}
+}
+
+// bufferedConn is a connection whose reads go through a buffered reader, which may already hold
+// data sent through the tunnel right after the CONNECT response.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
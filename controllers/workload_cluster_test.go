@@ -0,0 +1,235 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+	"sigs.k8s.io/cluster-api/util/secret"
+)
+
+func TestWorkloadClusterRESTConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		mode             string
+		authData         map[string][]byte
+		expectErr        bool
+		expectToken      string
+		expectExec       string
+		expectTunnel     bool
+		expectKubeconfig bool
+	}{
+		{
+			name:             "kubeconfig by default",
+			expectKubeconfig: true,
+		},
+		{
+			name:             "kubeconfig through a konnectivity server",
+			mode:             KubeconfigAuth,
+			authData:         map[string][]byte{WorkloadAuthKonnectivityProxyKey: []byte("konnectivity:8090")},
+			expectKubeconfig: true,
+			expectTunnel:     true,
+		},
+		{
+			name:        "service account token",
+			mode:        ServiceAccountTokenAuth,
+			authData:    map[string][]byte{WorkloadAuthTokenKey: []byte("sa-token")},
+			expectToken: "sa-token",
+		},
+		{
+			name:      "service account token without token",
+			mode:      ServiceAccountTokenAuth,
+			authData:  map[string][]byte{},
+			expectErr: true,
+		},
+		{
+			name:      "service account token without auth secret",
+			mode:      ServiceAccountTokenAuth,
+			expectErr: true,
+		},
+		{
+			name:         "allowed exec plugin through a konnectivity server",
+			mode:         ExecAuth,
+			authData:     map[string][]byte{WorkloadAuthExecKey: []byte(`{"command": "aws-iam-authenticator", "args": ["token"]}`), WorkloadAuthKonnectivityProxyKey: []byte("konnectivity:8090")},
+			expectExec:   "aws-iam-authenticator",
+			expectTunnel: true,
+		},
+		{
+			name:      "exec plugin not allowed",
+			mode:      ExecAuth,
+			authData:  map[string][]byte{WorkloadAuthExecKey: []byte(`{"command": "sh", "args": ["-c", "id"]}`)},
+			expectErr: true,
+		},
+		{
+			name:      "unsupported mode",
+			mode:      "unknown",
+			authData:  map[string][]byte{},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := newCluster("cluster")
+			cluster.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "10.0.0.1", Port: 6443}}
+			if tc.mode != "" {
+				cluster.Annotations = map[string]string{WorkloadClusterAuthAnnotation: tc.mode}
+			}
+			config := newControlPlaneInitKubeadmConfig(newControlPlaneMachine(cluster, "control-plane"), "control-plane-cfg")
+			objects := append([]runtime.Object{cluster}, createSecrets(t, cluster, config)...)
+			if tc.authData != nil {
+				objects = append(objects, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: cluster.Namespace, Name: secret.Name(cluster.Name, WorkloadAuthSecretPurpose)},
+					Data:       tc.authData,
+				})
+			}
+			c := newFakeClientWithScheme(setupScheme(), objects...)
+			if err := kubeconfig.CreateSecret(context.Background(), c, cluster); err != nil {
+				t.Fatal(err)
+			}
+
+			restConfig, err := workloadClusterRESTConfig(context.Background(), c, cluster, []string{"aws-iam-authenticator"})
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if restConfig.Host != "https://10.0.0.1:6443" {
+				t.Errorf("expected host https://10.0.0.1:6443, got %q", restConfig.Host)
+			}
+			if len(restConfig.CAData) == 0 {
+				t.Error("expected the cluster CA to be trusted")
+			}
+			if hasClientCert := len(restConfig.CertData) > 0; hasClientCert != tc.expectKubeconfig {
+				t.Errorf("expected client certificate from kubeconfig: %v, got %v", tc.expectKubeconfig, hasClientCert)
+			}
+			if restConfig.BearerToken != tc.expectToken {
+				t.Errorf("expected bearer token %q, got %q", tc.expectToken, restConfig.BearerToken)
+			}
+			if tc.expectExec != "" && (restConfig.ExecProvider == nil || restConfig.ExecProvider.Command != tc.expectExec) {
+				t.Errorf("expected exec plugin %q, got %v", tc.expectExec, restConfig.ExecProvider)
+			}
+			if tunneled := restConfig.Dial != nil; tunneled != tc.expectTunnel {
+				t.Errorf("expected tunnel: %v, got %v", tc.expectTunnel, tunneled)
+			}
+		})
+	}
+}
+
+func TestHTTPConnectDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// A minimal konnectivity server, accepting tunnels to 10.0.0.1:6443 only and answering "pong" through them.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				if req.Method != http.MethodConnect || req.Host != "10.0.0.1:6443" {
+					conn.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
+					return
+				}
+				conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+				conn.Write([]byte("pong"))
+			}(conn)
+		}
+	}()
+
+	dial := httpConnectDialer(listener.Addr().String())
+	conn, err := dial(context.Background(), "tcp", "10.0.0.1:6443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(conn)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "pong" {
+		t.Errorf("expected to read through the tunnel, got %q", data)
+	}
+
+	if _, err := dial(context.Background(), "tcp", "10.0.0.2:6443"); err == nil {
+		t.Error("expected a refused tunnel to fail")
+	}
+}
+
+func TestBindContext(t *testing.T) {
+	// A workload cluster API server that never answers.
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	config := &rest.Config{Host: server.URL}
+	bindContext(ctx, config)
+	secretsClient, err := typedcorev1.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := secretsClient.Secrets(metav1.NamespaceSystem).Create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-abcdef"}})
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("expected the request to fail once the context is done")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the request to be cancelled with the context")
+	}
+}
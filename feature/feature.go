@@ -0,0 +1,172 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package feature implements the feature gates used to ship experimental CABPK behaviors disabled by default.
+package feature
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Feature is the name of a feature gate.
+type Feature string
+
+const (
+	// KubeadmV1Beta2 enables rendering the kubeadm configuration with the v1beta2 API for Kubernetes versions
+	// supporting it.
+	//
+	// beta: v0.1
+	KubeadmV1Beta2 Feature = "KubeadmV1Beta2"
+)
+
+// PreRelease is the maturity stage of a feature.
+type PreRelease string
+
+const (
+	// Alpha features are disabled by default and may change or be removed without notice.
+	Alpha = PreRelease("ALPHA")
+	// Beta features are enabled by default and well tested.
+	Beta = PreRelease("BETA")
+	// GA features are always enabled.
+	GA = PreRelease("")
+)
+
+// Spec describes the default state and maturity of a feature.
+type Spec struct {
+	Default    bool
+	PreRelease PreRelease
+}
+
+// defaultFeatureGates consists of all known CABPK feature keys.
+// To add a new feature, define a key for it above and add it here.
+var defaultFeatureGates = map[Feature]Spec{
+	KubeadmV1Beta2: {Default: true, PreRelease: Beta},
+}
+
+// Gates is the feature gate set used by the manager. It is configured with the --feature-gates flag.
+var Gates = NewGates(defaultFeatureGates)
+
+// FeatureGate tracks the enabled state of a set of known features.
+// It implements flag.Value so that it can be set from the command line as a comma separated list of
+// key=value pairs, e.g. "KubeadmV1Beta2=false".
+type FeatureGate struct {
+	lock    sync.RWMutex
+	known   map[Feature]Spec
+	enabled map[Feature]bool
+}
+
+// NewGates returns a FeatureGate for the given features, using their default state.
+func NewGates(known map[Feature]Spec) *FeatureGate {
+	f := &FeatureGate{
+		known:   map[Feature]Spec{},
+		enabled: map[Feature]bool{},
+	}
+	for k, v := range known {
+		f.known[k] = v
+	}
+	return f
+}
+
+// Enabled returns true if the feature is enabled. Unknown features are never enabled.
+func (f *FeatureGate) Enabled(key Feature) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if v, ok := f.enabled[key]; ok {
+		return v
+	}
+	return f.known[key].Default
+}
+
+// SetFromMap sets the state of the given features. GA features cannot be disabled.
+func (f *FeatureGate) SetFromMap(m map[string]bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	enabled := map[Feature]bool{}
+	for k, v := range f.enabled {
+		enabled[k] = v
+	}
+	for k, v := range m {
+		key := Feature(k)
+		spec, ok := f.known[key]
+		if !ok {
+			return errors.Errorf("unrecognized feature gate: %s", k)
+		}
+		if spec.PreRelease == GA && !v {
+			return errors.Errorf("cannot disable feature gate %s: the feature is GA", k)
+		}
+		enabled[key] = v
+	}
+	f.enabled = enabled
+	return nil
+}
+
+// Set parses a comma separated list of key=value pairs and sets the state of the given features.
+func (f *FeatureGate) Set(value string) error {
+	m := map[string]bool{}
+	for _, s := range strings.Split(value, ",") {
+		if len(s) == 0 {
+			continue
+		}
+		arr := strings.SplitN(s, "=", 2)
+		k := strings.TrimSpace(arr[0])
+		if len(arr) != 2 {
+			return errors.Errorf("missing bool value for feature gate %s", k)
+		}
+		v, err := strconv.ParseBool(strings.TrimSpace(arr[1]))
+		if err != nil {
+			return errors.Wrapf(err, "invalid value of %s=%s", k, arr[1])
+		}
+		m[k] = v
+	}
+	return f.SetFromMap(m)
+}
+
+// String returns the features explicitly set, in the format accepted by Set.
+func (f *FeatureGate) String() string {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	pairs := []string{}
+	for k, v := range f.enabled {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// KnownFeatures returns a sorted description of the known features, suitable for flag usage.
+func (f *FeatureGate) KnownFeatures() []string {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	known := []string{}
+	for k, v := range f.known {
+		if v.PreRelease == GA {
+			continue
+		}
+		known = append(known, fmt.Sprintf("%s=true|false (%s - default=%t)", k, v.PreRelease, v.Default))
+	}
+	sort.Strings(known)
+	return known
+}
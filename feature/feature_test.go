@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package feature
+
+import (
+	"testing"
+)
+
+func TestFeatureGateSet(t *testing.T) {
+	const (
+		alphaFeature Feature = "AlphaFeature"
+		betaFeature  Feature = "BetaFeature"
+		gaFeature    Feature = "GAFeature"
+	)
+	known := map[Feature]Spec{
+		alphaFeature: {Default: false, PreRelease: Alpha},
+		betaFeature:  {Default: true, PreRelease: Beta},
+		gaFeature:    {Default: true, PreRelease: GA},
+	}
+
+	testcases := []struct {
+		name      string
+		value     string
+		expected  map[Feature]bool
+		expectErr bool
+	}{
+		{
+			name:     "use the defaults when empty",
+			value:    "",
+			expected: map[Feature]bool{alphaFeature: false, betaFeature: true, gaFeature: true},
+		},
+		{
+			name:     "enable an alpha feature and disable a beta feature",
+			value:    "AlphaFeature=true, BetaFeature=false",
+			expected: map[Feature]bool{alphaFeature: true, betaFeature: false, gaFeature: true},
+		},
+		{
+			name:     "unknown features are never enabled",
+			value:    "",
+			expected: map[Feature]bool{Feature("Unknown"): false},
+		},
+		{
+			name:      "fail on an unknown feature",
+			value:     "Unknown=true",
+			expectErr: true,
+		},
+		{
+			name:      "fail on a missing value",
+			value:     "AlphaFeature",
+			expectErr: true,
+		},
+		{
+			name:      "fail on an invalid value",
+			value:     "AlphaFeature=yes please",
+			expectErr: true,
+		},
+		{
+			name:      "fail disabling a GA feature",
+			value:     "GAFeature=false",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			gates := NewGates(known)
+			err := gates.Set(tc.value)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				if s := gates.String(); s != "" {
+					t.Errorf("expected a failed set not to change the gates, got %q", s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got error %v", err)
+			}
+			for f, enabled := range tc.expected {
+				if gates.Enabled(f) != enabled {
+					t.Errorf("expected %s enabled to be %t", f, enabled)
+				}
+			}
+		})
+	}
+}
+
+func TestFeatureGateString(t *testing.T) {
+	gates := NewGates(map[Feature]Spec{
+		Feature("AlphaFeature"): {Default: false, PreRelease: Alpha},
+		Feature("BetaFeature"):  {Default: true, PreRelease: Beta},
+	})
+	if err := gates.Set("BetaFeature=false,AlphaFeature=true"); err != nil {
+		t.Fatal(err)
+	}
+	if s := gates.String(); s != "AlphaFeature=true,BetaFeature=false" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
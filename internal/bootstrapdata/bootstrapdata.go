@@ -0,0 +1,200 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bootstrapdata fetches the bootstrap data of KubeadmConfigs and splits it into its files and commands,
+// for review.
+package bootstrapdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// secretKey is the key of the bootstrap data in the bootstrap data secrets.
+	secretKey = "value"
+	// encryptionAnnotation is set by the controller on the secrets holding encrypted bootstrap data.
+	encryptionAnnotation = "bootstrap.cluster.x-k8s.io/encryption"
+)
+
+// Fetch returns the bootstrap data of the config, read from its bootstrap data secret, or from its status for configs
+// without one, decompressed if needed. Encrypted bootstrap data cannot be decoded without the data key of the
+// cluster, and is rejected.
+func Fetch(ctx context.Context, c client.Client, key types.NamespacedName) ([]byte, error) {
+	config := &bootstrapv1.KubeadmConfig{}
+	if err := c.Get(ctx, key, config); err != nil {
+		return nil, errors.Wrapf(err, "unable to get KubeadmConfig %s", key)
+	}
+
+	if config.Status.DataSecretName == nil {
+		if len(config.Status.BootstrapData) == 0 {
+			return nil, errors.Errorf("KubeadmConfig %s has no bootstrap data yet", key)
+		}
+		return FromStatus(&config.Status)
+	}
+
+	secretKeyName := types.NamespacedName{Namespace: config.Namespace, Name: *config.Status.DataSecretName}
+	s := &corev1.Secret{}
+	if err := c.Get(ctx, secretKeyName, s); err != nil {
+		return nil, errors.Wrapf(err, "unable to get bootstrap data secret %s", secretKeyName)
+	}
+	if algorithm := s.Annotations[encryptionAnnotation]; algorithm != "" {
+		return nil, errors.Errorf("the bootstrap data of secret %s is encrypted with %s", secretKeyName, algorithm)
+	}
+	data, ok := s.Data[secretKey]
+	if !ok {
+		return nil, errors.Errorf("bootstrap data secret %s has no %q key", secretKeyName, secretKey)
+	}
+	return data, nil
+}
+
+// FromStatus returns the bootstrap data stored in the status of a config, decompressed according to its
+// BootstrapDataEncoding.
+func FromStatus(status *bootstrapv1.KubeadmConfigStatus) ([]byte, error) {
+	switch status.BootstrapDataEncoding {
+	case "":
+		return status.BootstrapData, nil
+	case bootstrapv1.GzipBootstrapDataEncoding:
+		data, err := decodeContent(string(status.BootstrapData), "gzip")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decompress bootstrap data")
+		}
+		return []byte(data), nil
+	default:
+		return nil, errors.Errorf("unsupported bootstrap data encoding %q", status.BootstrapDataEncoding)
+	}
+}
+
+// Split parses the bootstrap data into a Document: JSON documents as is, cloud-configs converted like for the JSON
+// format, and scripts, e.g. join scripts, as a single command. The content of the files is decoded.
+func Split(data []byte) (*cloudinit.Document, error) {
+	doc := &cloudinit.Document{}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("#!")):
+		doc.Commands = []string{string(data)}
+		return doc, nil
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		if err := json.Unmarshal(data, doc); err != nil {
+			return nil, errors.Wrap(err, "failed to parse JSON bootstrap data")
+		}
+	default:
+		converted, err := cloudinit.ToJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(converted, doc); err != nil {
+			return nil, errors.Wrap(err, "failed to parse JSON bootstrap data")
+		}
+	}
+
+	for i := range doc.Files {
+		content, err := decodeContent(doc.Files[i].Content, string(doc.Files[i].Encoding))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode file %s", doc.Files[i].Path)
+		}
+		doc.Files[i].Content = content
+		doc.Files[i].Encoding = ""
+	}
+	return doc, nil
+}
+
+// decodeContent decodes the content of a file with one of the encodings supported by cloud-init.
+func decodeContent(content, encoding string) (string, error) {
+	data := []byte(content)
+	switch encoding {
+	case "":
+		return content, nil
+	case "b64", "base64", "gz+b64", "gz+base64", "gzip+b64", "gzip+base64":
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+		if err != nil {
+			return "", err
+		}
+		data = decoded
+	case "gz", "gzip":
+	default:
+		return "", errors.Errorf("unsupported encoding %q", encoding)
+	}
+
+	if strings.HasPrefix(encoding, "gz") {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return "", err
+		}
+	}
+	return string(data), nil
+}
+
+// Write writes the document to the directory for review: the files under files/ at their path, the boot commands
+// and the commands in bootcmd.sh and runcmd.sh, and the rest of the document, with the file contents elided, in
+// document.yaml. Bootstrap data holds private keys and tokens, so everything is only readable by the current user.
+func Write(dir string, doc *cloudinit.Document) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	index := *doc
+	index.Files = make([]bootstrapv1.File, len(doc.Files))
+	for i, f := range doc.Files {
+		target := filepath.Join(dir, "files", filepath.Clean("/"+f.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, []byte(f.Content), 0600); err != nil {
+			return err
+		}
+		f.Content = ""
+		index.Files[i] = f
+	}
+
+	for name, commands := range map[string][]string{"bootcmd.sh": doc.BootCommands, "runcmd.sh": doc.Commands} {
+		if len(commands) == 0 {
+			continue
+		}
+		script := strings.Join(commands, "\n") + "\n"
+		if !strings.HasPrefix(script, "#!") {
+			script = "#!/bin/sh\n" + script
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0600); err != nil {
+			return err
+		}
+	}
+
+	out, err := yaml.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the document")
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "document.yaml"), out, 0600)
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrapdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const cloudConfig = `## template: jinja
+#cloud-config
+
+write_files:
+-   path: /etc/kubernetes/pki/ca.crt
+    encoding: "gzip+base64"
+    owner: root:root
+    permissions: '0640'
+    content: |
+      %s
+-   path: /tmp/kubeadm.yaml
+    content: |
+      kind: InitConfiguration
+runcmd:
+  - 'kubeadm init --config /tmp/kubeadm.yaml'
+`
+
+func gzipBase64(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestFetch(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = bootstrapv1.AddToScheme(scheme)
+	secretName, encryptedName := "secret-cfg", "encrypted-cfg"
+	compressed, err := base64.StdEncoding.DecodeString(gzipBase64(t, "legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := []runtime.Object{
+		&bootstrapv1.KubeadmConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "secret-cfg"},
+			Status:     bootstrapv1.KubeadmConfigStatus{DataSecretName: &secretName, BootstrapData: []byte("legacy")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: secretName},
+			Data:       map[string][]byte{secretKey: []byte("#cloud-config\n")},
+		},
+		&bootstrapv1.KubeadmConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "legacy-cfg"},
+			Status:     bootstrapv1.KubeadmConfigStatus{BootstrapData: []byte("legacy")},
+		},
+		&bootstrapv1.KubeadmConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "compressed-cfg"},
+			Status:     bootstrapv1.KubeadmConfigStatus{BootstrapData: compressed, BootstrapDataEncoding: bootstrapv1.GzipBootstrapDataEncoding},
+		},
+		&bootstrapv1.KubeadmConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "unknown-encoding-cfg"},
+			Status:     bootstrapv1.KubeadmConfigStatus{BootstrapData: compressed, BootstrapDataEncoding: "zstd"},
+		},
+		&bootstrapv1.KubeadmConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pending-cfg"},
+		},
+		&bootstrapv1.KubeadmConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: encryptedName},
+			Status:     bootstrapv1.KubeadmConfigStatus{DataSecretName: &encryptedName},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: encryptedName, Annotations: map[string]string{encryptionAnnotation: "AES-256-GCM"}},
+			Data:       map[string][]byte{secretKey: []byte("ciphertext")},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme, objects...)
+
+	testcases := []struct {
+		name        string
+		expected    string
+		expectError bool
+	}{
+		{name: "secret-cfg", expected: "#cloud-config\n"},
+		{name: "legacy-cfg", expected: "legacy"},
+		{name: "compressed-cfg", expected: "legacy"},
+		{name: "unknown-encoding-cfg", expectError: true},
+		{name: "pending-cfg", expectError: true},
+		{name: encryptedName, expectError: true},
+		{name: "missing-cfg", expectError: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := Fetch(context.Background(), c, types.NamespacedName{Namespace: "default", Name: tc.name})
+			if tc.expectError != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.expectError, err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, data)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	ca := "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	doc, err := Split([]byte(strings.Replace(cloudConfig, "%s", gzipBase64(t, ca), 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Files) != 2 || doc.Files[0].Content != ca || doc.Files[0].Encoding != "" || doc.Files[0].Permissions != "0640" {
+		t.Errorf("expected the files with their content decoded, got %+v", doc.Files)
+	}
+	if len(doc.Commands) != 1 || doc.Commands[0] != "kubeadm init --config /tmp/kubeadm.yaml" {
+		t.Errorf("expected the commands of the cloud-config, got %v", doc.Commands)
+	}
+
+	doc, err = Split([]byte(`{"files":[{"path":"/etc/motd","content":"aGVsbG8=","encoding":"base64"}],"commands":["kubeadm join"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Files) != 1 || doc.Files[0].Content != "hello" || len(doc.Commands) != 1 {
+		t.Errorf("expected the JSON document with its content decoded, got %+v", doc)
+	}
+
+	script := "#!/bin/sh\nkubeadm join --token abcdef.0123456789abcdef\n"
+	if doc, err = Split([]byte(script)); err != nil || len(doc.Files) != 0 || len(doc.Commands) != 1 || doc.Commands[0] != script {
+		t.Errorf("expected a script to be a single command, got %+v, %v", doc, err)
+	}
+
+	if _, err := Split([]byte(`{"files":[{"path":"/etc/motd","content":"hello","encoding":"zstd"}]}`)); err == nil {
+		t.Error("expected an unsupported encoding to be rejected")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootstrapdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	doc := &cloudinit.Document{
+		Files: []bootstrapv1.File{
+			{Path: "/etc/kubernetes/pki/ca.key", Owner: "root:root", Permissions: "0600", Content: "key"},
+			{Path: "../../escape", Content: "contained"},
+		},
+		BootCommands: []string{"mkdir -p /run/kubeadm"},
+		Commands:     []string{"kubeadm init", "touch /run/cluster-api/bootstrap-success.complete"},
+	}
+	if err := Write(dir, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		"files/etc/kubernetes/pki/ca.key": "key",
+		"files/escape":                    "contained",
+		"bootcmd.sh":                      "#!/bin/sh\nmkdir -p /run/kubeadm\n",
+		"runcmd.sh":                       "#!/bin/sh\nkubeadm init\ntouch /run/cluster-api/bootstrap-success.complete\n",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected %s to be %q, got %q", path, expected, data)
+		}
+	}
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "document.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "path: /etc/kubernetes/pki/ca.key") || strings.Contains(string(index), "contained") {
+		t.Errorf("expected the document to list the files without their content, got:\n%s", index)
+	}
+	if doc.Files[0].Content != "key" {
+		t.Error("expected the document not to be modified")
+	}
+}
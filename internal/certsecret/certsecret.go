@@ -0,0 +1,171 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package certsecret stores the cluster certificates as secrets of the management cluster. The certificates
+// themselves are generated by the internal cluster package, which does not depend on a client, so that they can
+// also be read from and written to a local directory, e.g. by the standalone package.
+package certsecret
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Lookup looks up each certificate from secrets and populates the certificate with the secret data.
+func Lookup(ctx context.Context, ctrlclient client.Client, cluster *clusterv1.Cluster, certificates internalcluster.Certificates) error {
+	// Look up each certificate as a secret and populate the certificate/key
+	for _, certificate := range certificates {
+		s, err := Get(ctx, ctrlclient, cluster, certificate.Purpose)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		// If a user has a badly formatted secret it will prevent the cluster from working.
+		kp, err := toKeyPair(s)
+		if err != nil {
+			return err
+		}
+		certificate.KeyPair = kp
+	}
+	return nil
+}
+
+// SaveGenerated will save any certificates that have been generated as Kubernetes secrets.
+// Secrets are created rather than applied, so that an existing certificate authority, e.g. one generated
+// by a concurrent reconcile, is never replaced: the existing certificate is used instead of the generated one,
+// and the other missing certificates are still saved.
+// Certificates generated without config are owned by the Cluster.
+func SaveGenerated(ctx context.Context, ctrlclient client.Client, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, certificates internalcluster.Certificates) error {
+	for _, certificate := range certificates {
+		if !certificate.Generated {
+			continue
+		}
+		s := New(cluster, config, certificate)
+		err := ctrlclient.Create(ctx, s)
+		if err == nil {
+			continue
+		}
+		if !apierrors.IsAlreadyExists(err) {
+			return errors.WithStack(err)
+		}
+		existing, err := Get(ctx, ctrlclient, cluster, certificate.Purpose)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		kp, err := toKeyPair(existing)
+		if err != nil {
+			return err
+		}
+		certificate.KeyPair = kp
+		certificate.Generated = false
+	}
+	return certificates.ValidateKeyPairs()
+}
+
+// LookupOrGenerate is a convenience function that wraps cluster bootstrap certificate behavior.
+func LookupOrGenerate(ctx context.Context, ctrlclient client.Client, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, certificates internalcluster.Certificates) error {
+	// Find the certificates that exist, and ensure they can be used with the ones to generate
+	if err := Lookup(ctx, ctrlclient, cluster, certificates); err != nil {
+		return err
+	}
+	if err := certificates.ValidateKeyPairs(); err != nil {
+		return err
+	}
+
+	// Generate the certificates that don't exist
+	if err := certificates.Generate(); err != nil {
+		return err
+	}
+
+	// Save any certificates that have been generated
+	if err := SaveGenerated(ctx, ctrlclient, cluster, config, certificates); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// New converts a single certificate into a Kubernetes secret, annotated with the hash of its certificate.
+// Generated certificates are owned by the config, or by the Cluster if config is nil.
+func New(cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig, certificate *internalcluster.Certificate) *corev1.Secret {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: PKINamespace(cluster),
+			Name:      Name(cluster, certificate.Purpose),
+			Labels: map[string]string{
+				clusterv1.MachineClusterLabelName: cluster.Name,
+			},
+			Annotations: map[string]string{
+				internalcluster.InputsHashAnnotation: internalcluster.InputsHash(certificate.KeyPair.Cert),
+			},
+		},
+		Data: map[string][]byte{
+			secret.TLSKeyDataName: certificate.KeyPair.Key,
+			secret.TLSCrtDataName: certificate.KeyPair.Cert,
+		},
+	}
+
+	// owner references cannot cross namespaces, secrets stored in another namespace outlive their cluster
+	if certificate.Generated && s.Namespace == cluster.Namespace {
+		owner := metav1.OwnerReference{
+			APIVersion: clusterv1.GroupVersion.String(),
+			Kind:       "Cluster",
+			Name:       cluster.Name,
+			UID:        cluster.UID,
+		}
+		if config != nil {
+			owner = metav1.OwnerReference{
+				APIVersion: bootstrapv1.GroupVersion.String(),
+				Kind:       "KubeadmConfig",
+				Name:       config.Name,
+				UID:        config.UID,
+			}
+		}
+		s.OwnerReferences = []metav1.OwnerReference{owner}
+	}
+	return s
+}
+
+func toKeyPair(s *corev1.Secret) (*certs.KeyPair, error) {
+	c, exists := s.Data[secret.TLSCrtDataName]
+	if !exists {
+		return nil, errors.Errorf("missing data for key %s", secret.TLSCrtDataName)
+	}
+
+	// In some cases (external etcd) it's ok if the etcd.key does not exist.
+	// TODO: some other function should ensure that the certificates we need exist.
+	key, exists := s.Data[secret.TLSKeyDataName]
+	if !exists {
+		key = []byte("")
+	}
+
+	return &certs.KeyPair{
+		Cert: c,
+		Key:  key,
+	}, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certsecret
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newClusterCA returns a generated cluster CA key pair.
+func newClusterCA(t *testing.T) *certs.KeyPair {
+	certificates := internalcluster.NewCertificatesForWorker("")
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair
+}
+
+func TestNew(t *testing.T) {
+	kp := newClusterCA(t)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}}
+	certificate := &internalcluster.Certificate{Purpose: internalcluster.ClusterCA, KeyPair: kp, Generated: true}
+	s := New(cluster, &bootstrapv1.KubeadmConfig{ObjectMeta: metav1.ObjectMeta{Name: "config"}}, certificate)
+	if s.Namespace != "default" || s.Name != "cluster-ca" {
+		t.Errorf("expected the secret to be named after the cluster, got %s/%s", s.Namespace, s.Name)
+	}
+	if hash := s.Annotations[internalcluster.InputsHashAnnotation]; hash != internalcluster.InputsHash(kp.Cert) {
+		t.Errorf("expected the secret to be annotated with the hash of its certificate, got %q", hash)
+	}
+	if len(s.OwnerReferences) != 1 || s.OwnerReferences[0].Kind != "KubeadmConfig" {
+		t.Errorf("expected the generated secret to be owned by the config, got %v", s.OwnerReferences)
+	}
+}
+
+func TestLookupOrGenerate(t *testing.T) {
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}}
+	ctrlclient := fake.NewFakeClientWithScheme(scheme.Scheme)
+
+	certificates := internalcluster.NewCertificatesForWorker("")
+	if err := LookupOrGenerate(context.Background(), ctrlclient, cluster, nil, certificates); err != nil {
+		t.Fatal(err)
+	}
+	generated := certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair
+
+	again := internalcluster.NewCertificatesForWorker("")
+	if err := LookupOrGenerate(context.Background(), ctrlclient, cluster, nil, again); err != nil {
+		t.Fatal(err)
+	}
+	if ca := again.GetByPurpose(internalcluster.ClusterCA); ca.Generated || string(ca.KeyPair.Cert) != string(generated.Cert) {
+		t.Error("expected the saved cluster CA to be looked up instead of generated again")
+	}
+}
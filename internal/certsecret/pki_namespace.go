@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certsecret
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PKINamespaceAnnotation is set on a Cluster to store its certificate secrets in another namespace than the Cluster,
+// e.g. a namespace cluster operators cannot read secrets from. It is only honored for the AllowedPKINamespaces.
+const PKINamespaceAnnotation = "bootstrap.cluster.x-k8s.io/pki-namespace"
+
+// DefaultPKINamespace is the namespace the certificate secrets of clusters without the PKINamespaceAnnotation are
+// stored in. They are stored in the namespace of the Cluster if empty.
+var DefaultPKINamespace string
+
+// AllowedPKINamespaces are the namespaces the PKINamespaceAnnotation of a Cluster may select. The annotation is
+// ignored for any other namespace, so that editing a Cluster does not give access to the CAs of other clusters.
+var AllowedPKINamespaces []string
+
+// PKINamespace returns the namespace the certificate secrets of the cluster are stored in.
+func PKINamespace(cluster *clusterv1.Cluster) string {
+	if ns := cluster.Annotations[PKINamespaceAnnotation]; ns != "" && allowedPKINamespace(ns) {
+		return ns
+	}
+	if DefaultPKINamespace != "" {
+		return DefaultPKINamespace
+	}
+	return cluster.Namespace
+}
+
+func allowedPKINamespace(ns string) bool {
+	for _, allowed := range AllowedPKINamespaces {
+		if ns == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the name of the certificate secret of the cluster with the given purpose. Secrets stored in a PKI
+// namespace shared by several Cluster namespaces are prefixed with the namespace of the Cluster, so that clusters
+// with the same name do not share their certificates; namespaces cannot contain dots.
+func Name(cluster *clusterv1.Cluster, purpose internalcluster.Purpose) string {
+	name := secret.Name(cluster.Name, secret.Purpose(purpose))
+	if PKINamespace(cluster) != cluster.Namespace {
+		return cluster.Namespace + "." + name
+	}
+	return name
+}
+
+// Get returns the certificate secret of the cluster with the given purpose from its PKI namespace.
+func Get(ctx context.Context, ctrlclient client.Client, cluster *clusterv1.Cluster, purpose internalcluster.Purpose) (*corev1.Secret, error) {
+	s := &corev1.Secret{}
+	key := client.ObjectKey{
+		Namespace: PKINamespace(cluster),
+		Name:      Name(cluster, purpose),
+	}
+	if err := ctrlclient.Get(ctx, key, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certsecret
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPKINamespace(t *testing.T) {
+	defer func(ns string, allowed []string) {
+		DefaultPKINamespace, AllowedPKINamespaces = ns, allowed
+	}(DefaultPKINamespace, AllowedPKINamespaces)
+	AllowedPKINamespaces = []string{"pki-cluster"}
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "clusters", Name: "cluster"}}
+	annotated := cluster.DeepCopy()
+	annotated.Annotations = map[string]string{PKINamespaceAnnotation: "pki-cluster"}
+
+	DefaultPKINamespace = ""
+	if ns := PKINamespace(cluster); ns != "clusters" {
+		t.Errorf("expected the Cluster namespace by default, got %q", ns)
+	}
+	DefaultPKINamespace = "pki"
+	if ns := PKINamespace(cluster); ns != "pki" {
+		t.Errorf("expected the default PKI namespace, got %q", ns)
+	}
+	if ns := PKINamespace(annotated); ns != "pki-cluster" {
+		t.Errorf("expected the annotation to take precedence, got %q", ns)
+	}
+
+	kp := newClusterCA(t)
+	certificate := &internalcluster.Certificate{Purpose: internalcluster.ClusterCA, KeyPair: kp, Generated: true}
+	config := &bootstrapv1.KubeadmConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "clusters", Name: "config"}}
+	s := New(cluster, config, certificate)
+	if s.Namespace != "pki" {
+		t.Errorf("expected the secret to be stored in the PKI namespace, got %q", s.Namespace)
+	}
+	if s.Name != "clusters.cluster-ca" {
+		t.Errorf("expected the secret name to be prefixed with the Cluster namespace, got %q", s.Name)
+	}
+	if len(s.OwnerReferences) != 0 {
+		t.Errorf("expected no owner reference across namespaces, got %v", s.OwnerReferences)
+	}
+}
+
+func TestPKINamespace_HostileAnnotation(t *testing.T) {
+	defer func(ns string, allowed []string) {
+		DefaultPKINamespace, AllowedPKINamespaces = ns, allowed
+	}(DefaultPKINamespace, AllowedPKINamespaces)
+	AllowedPKINamespaces = []string{"pki-cluster"}
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "clusters",
+		Name:        "cluster",
+		Annotations: map[string]string{PKINamespaceAnnotation: "other-tenant"},
+	}}
+
+	DefaultPKINamespace = ""
+	if ns := PKINamespace(cluster); ns != "clusters" {
+		t.Errorf("expected an annotation outside the allowed namespaces to be ignored, got %q", ns)
+	}
+	if name := Name(cluster, internalcluster.ClusterCA); name != "cluster-ca" {
+		t.Errorf("expected the secret name of the Cluster namespace, got %q", name)
+	}
+	DefaultPKINamespace = "pki"
+	if ns := PKINamespace(cluster); ns != "pki" {
+		t.Errorf("expected an annotation outside the allowed namespaces to be ignored, got %q", ns)
+	}
+
+	kp := newClusterCA(t)
+	victim := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "other-tenant", Name: "cluster"}}
+	ctrlclient := fake.NewFakeClientWithScheme(scheme.Scheme,
+		New(victim, nil, &internalcluster.Certificate{Purpose: internalcluster.ClusterCA, KeyPair: kp}))
+
+	certificates := internalcluster.NewCertificatesForWorker("")
+	if err := Lookup(context.Background(), ctrlclient, cluster, certificates); err != nil {
+		t.Fatal(err)
+	}
+	if certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair != nil {
+		t.Error("expected the CA of the namespace set by the annotation not to be read")
+	}
+}
+
+func TestPKINamespace_SameNamedClusters(t *testing.T) {
+	defer func(ns string) { DefaultPKINamespace = ns }(DefaultPKINamespace)
+	DefaultPKINamespace = "pki"
+
+	foo := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "foo"}}
+	otherFoo := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "foo"}}
+
+	kp := newClusterCA(t)
+	ctrlclient := fake.NewFakeClientWithScheme(scheme.Scheme)
+	certificates := internalcluster.NewCertificatesForWorker("")
+	certificates.GetByPurpose(internalcluster.ClusterCA).KeyPair = kp
+	certificates.GetByPurpose(internalcluster.ClusterCA).Generated = true
+	if err := SaveGenerated(context.Background(), ctrlclient, foo, nil, certificates); err != nil {
+		t.Fatal(err)
+	}
+
+	other := internalcluster.NewCertificatesForWorker("")
+	if err := Lookup(context.Background(), ctrlclient, otherFoo, other); err != nil {
+		t.Fatal(err)
+	}
+	if ca := other.GetByPurpose(internalcluster.ClusterCA).KeyPair; ca != nil && bytes.Equal(ca.Cert, kp.Cert) {
+		t.Error("expected a Cluster with the same name in another namespace not to share the CA")
+	}
+
+	same := internalcluster.NewCertificatesForWorker("")
+	if err := Lookup(context.Background(), ctrlclient, foo, same); err != nil {
+		t.Fatal(err)
+	}
+	if ca := same.GetByPurpose(internalcluster.ClusterCA).KeyPair; ca == nil || !bytes.Equal(ca.Cert, kp.Cert) {
+		t.Error("expected the CA of the Cluster to be found in the PKI namespace")
+	}
+}
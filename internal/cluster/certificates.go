@@ -17,12 +17,15 @@ limitations under the License.
 package cluster
 
 import (
-	"context"
+	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/binary"
 	"encoding/hex"
 	"math/big"
 	"path/filepath"
@@ -30,34 +33,44 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
-	corev1 "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
 	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
 	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
-	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
 	"sigs.k8s.io/cluster-api/util/certs"
-	"sigs.k8s.io/cluster-api/util/secret"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// Purpose is the name to append to the secret generated for a cluster. It has the values of the Purpose of the
+// cluster-api secret package, which is not used here as it depends on controller-runtime.
+type Purpose string
+
 const (
 	rootOwnerValue = "root:root"
 
+	// ClusterCA is the secret name suffix for APIServer CA.
+	ClusterCA Purpose = "ca"
+
 	// EtcdCA is the secret name suffix for the Etcd CA
-	EtcdCA secret.Purpose = "etcd"
+	EtcdCA Purpose = "etcd"
 
 	// ServiceAccount is the secret name suffix for the Service Account keys
-	ServiceAccount secret.Purpose = "sa"
+	ServiceAccount Purpose = "sa"
 
 	// FrontProxyCA is the secret name suffix for Front Proxy CA
-	FrontProxyCA secret.Purpose = "proxy"
+	FrontProxyCA Purpose = "proxy"
 
 	// APIServerEtcdClient is the secret name of user-supplied secret containing the apiserver-etcd-client key/cert
-	APIServerEtcdClient secret.Purpose = "apiserver-etcd-client"
+	APIServerEtcdClient Purpose = "apiserver-etcd-client"
 
 	defaultCertificatesDir = "/etc/kubernetes/pki"
+
+	// DefaultCAValidity is the validity of generated certificate authorities, like the kubeadm ones.
+	DefaultCAValidity = time.Hour * 24 * 365 * 10
+
+	// InputsHashAnnotation is set on the secrets generated by CABPK to a hash of the inputs they were generated from,
+	// e.g. the certificate of a certificate authority, so that changes requiring their regeneration can be detected
+	// without decoding their content.
+	InputsHashAnnotation = "bootstrap.cluster.x-k8s.io/inputs-hash"
 )
 
 var (
@@ -69,6 +82,9 @@ var (
 
 	// ErrMissingKey is an error indicating the key file is missing from the certificate
 	ErrMissingKey = errors.New("missing key data")
+
+	// ErrInvalidKeyPair is an error indicating the crt and key of a certificate do not belong together
+	ErrInvalidKeyPair = errors.New("invalid key pair")
 )
 
 // Certificates are the certificates necessary to bootstrap a cluster.
@@ -82,7 +98,7 @@ func NewCertificatesForInitialControlPlane(config *v1beta1.ClusterConfiguration)
 
 	certificates := Certificates{
 		&Certificate{
-			Purpose:  secret.ClusterCA,
+			Purpose:  ClusterCA,
 			CertFile: filepath.Join(config.CertificatesDir, "ca.crt"),
 			KeyFile:  filepath.Join(config.CertificatesDir, "ca.key"),
 		},
@@ -126,7 +142,7 @@ func NewCertificatesForInitialControlPlane(config *v1beta1.ClusterConfiguration)
 func NewCertificatesForJoiningControlPlane() Certificates {
 	return Certificates{
 		&Certificate{
-			Purpose:  secret.ClusterCA,
+			Purpose:  ClusterCA,
 			CertFile: filepath.Join(defaultCertificatesDir, "ca.crt"),
 			KeyFile:  filepath.Join(defaultCertificatesDir, "ca.key"),
 		},
@@ -148,6 +164,17 @@ func NewCertificatesForJoiningControlPlane() Certificates {
 	}
 }
 
+// NewCertificatesForPregeneration returns an empty set of the certificate authorities and keys of a cluster that do
+// not depend on its kubeadm configuration, so that they can be generated before its first control plane machine.
+// The etcd CA is excluded, as it is supplied by the user for external etcd.
+func NewCertificatesForPregeneration() Certificates {
+	return Certificates{
+		&Certificate{Purpose: ClusterCA},
+		&Certificate{Purpose: ServiceAccount},
+		&Certificate{Purpose: FrontProxyCA},
+	}
+}
+
 // NewCertificatesForWorker return an initialized but empty set of CA certificates needed to bootstrap a cluster.
 func NewCertificatesForWorker(caCertPath string) Certificates {
 	if caCertPath == "" {
@@ -156,7 +183,7 @@ func NewCertificatesForWorker(caCertPath string) Certificates {
 
 	return Certificates{
 		&Certificate{
-			Purpose:  secret.ClusterCA,
+			Purpose:  ClusterCA,
 			CertFile: caCertPath,
 		},
 	}
@@ -164,7 +191,7 @@ func NewCertificatesForWorker(caCertPath string) Certificates {
 
 // GetByPurpose returns a certificate by the given name.
 // This could be removed if we use a map instead of a slice to hold certificates, however other code becomes more complex.
-func (c Certificates) GetByPurpose(purpose secret.Purpose) *Certificate {
+func (c Certificates) GetByPurpose(purpose Purpose) *Certificate {
 	for _, certificate := range c {
 		if certificate.Purpose == purpose {
 			return certificate
@@ -173,47 +200,80 @@ func (c Certificates) GetByPurpose(purpose secret.Purpose) *Certificate {
 	return nil
 }
 
-// Lookup looks up each certificate from secrets and populates the certificate with the secret data.
-func (c Certificates) Lookup(ctx context.Context, ctrlclient client.Client, cluster *clusterv1.Cluster) error {
-	// Look up each certificate as a secret and populate the certificate/key
+// EnsureAllExist ensure that there is some data present for every certificate
+func (c Certificates) EnsureAllExist() error {
 	for _, certificate := range c {
-		s := &corev1.Secret{}
-		key := client.ObjectKey{
-			Name:      secret.Name(cluster.Name, certificate.Purpose),
-			Namespace: cluster.Namespace,
+		if certificate.KeyPair == nil {
+			return ErrMissingCertificate
 		}
-		if err := ctrlclient.Get(ctx, key, s); err != nil {
-			if apierrors.IsNotFound(err) {
-				continue
-			}
-			return errors.WithStack(err)
+		if len(certificate.KeyPair.Cert) == 0 {
+			return errors.Wrapf(ErrMissingCrt, "for certificate: %s", certificate.Purpose)
 		}
-		// If a user has a badly formatted secret it will prevent the cluster from working.
-		kp, err := secretToKeyPair(s)
-		if err != nil {
-			return err
+		if len(certificate.KeyPair.Key) == 0 {
+			return errors.Wrapf(ErrMissingKey, "for certificate: %s", certificate.Purpose)
 		}
-		certificate.KeyPair = kp
 	}
 	return nil
 }
 
-// EnsureAllExist ensure that there is some data present for every certificate
-func (c Certificates) EnsureAllExist() error {
+// ValidateKeyPairs ensures that the certificates holding data have a key matching their crt, so that a partially
+// written or mixed set of certificates is detected rather than used. The user supplied certificates of an external
+// etcd, which have no key, are not validated.
+func (c Certificates) ValidateKeyPairs() error {
 	for _, certificate := range c {
-		if certificate.KeyPair == nil {
-			return ErrMissingCertificate
+		if certificate.KeyPair == nil || len(certificate.KeyPair.Cert) == 0 {
+			continue
 		}
-		if len(certificate.KeyPair.Cert) == 0 {
-			return errors.Wrapf(ErrMissingCrt, "for certificate: %s", certificate.Purpose)
+		switch certificate.Purpose {
+		case ClusterCA, FrontProxyCA, EtcdCA, ServiceAccount:
+		default:
+			continue
+		}
+		if certificate.Purpose == EtcdCA && certificate.KeyFile == "" {
+			continue
 		}
 		if len(certificate.KeyPair.Key) == 0 {
-			return errors.Wrapf(ErrMissingKey, "for certificate: %s", certificate.Purpose)
+			return errors.Wrapf(ErrInvalidKeyPair, "the %s certificate has no key", certificate.Purpose)
+		}
+		if err := validateKeyPair(certificate); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// validateKeyPair ensures that the key of a certificate matches its crt, or its public key for the service account.
+func validateKeyPair(certificate *Certificate) error {
+	if certificate.Purpose != ServiceAccount {
+		if _, err := tls.X509KeyPair(certificate.KeyPair.Cert, certificate.KeyPair.Key); err != nil {
+			return errors.Wrapf(ErrInvalidKeyPair, "the %s certificate does not match its key: %v", certificate.Purpose, err)
+		}
+		return nil
+	}
+
+	key, err := keyutil.ParsePrivateKeyPEM(certificate.KeyPair.Key)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidKeyPair, "the %s key cannot be parsed: %v", certificate.Purpose, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return errors.Wrapf(ErrInvalidKeyPair, "the %s key is not a private key", certificate.Purpose)
+	}
+	publicKeys, err := keyutil.ParsePublicKeysPEM(certificate.KeyPair.Cert)
+	if err != nil || len(publicKeys) != 1 {
+		return errors.Wrapf(ErrInvalidKeyPair, "the %s public key cannot be parsed: %v", certificate.Purpose, err)
+	}
+	expected, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return errors.Wrapf(ErrInvalidKeyPair, "the %s key cannot be marshalled: %v", certificate.Purpose, err)
+	}
+	actual, err := x509.MarshalPKIXPublicKey(publicKeys[0])
+	if err != nil || !bytes.Equal(expected, actual) {
+		return errors.Wrapf(ErrInvalidKeyPair, "the %s public key does not match its key", certificate.Purpose)
+	}
+	return nil
+}
+
 // TODO: consider moving a generating function into the Certificate object itself?
 type certGenerator func() (*certs.KeyPair, error)
 
@@ -221,14 +281,21 @@ type certGenerator func() (*certs.KeyPair, error)
 func (c Certificates) Generate() error {
 	for _, certificate := range c {
 		if certificate.KeyPair == nil {
+			// Do not generate the CA of an external etcd, which has no key file. It is user supplied
+			if certificate.Purpose == EtcdCA && certificate.KeyFile == "" {
+				continue
+			}
 			var generator certGenerator
 			switch certificate.Purpose {
 			case APIServerEtcdClient: // Do not generate the APIServerEtcdClient key pair. It is user supplied
 				continue
 			case ServiceAccount:
 				generator = generateServiceAccountKeys
+			case SSHCA:
+				generator = generateSSHCA
 			default:
-				generator = generateCACert
+				validity := certificate.Validity
+				generator = func() (*certs.KeyPair, error) { return generateCACert(validity) }
 			}
 
 			kp, err := generator()
@@ -242,46 +309,14 @@ func (c Certificates) Generate() error {
 	return nil
 }
 
-// SaveGenerated will save any certificates that have been generated as Kubernetes secrets.
-func (c Certificates) SaveGenerated(ctx context.Context, ctrlclient client.Client, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) error {
-	for _, certificate := range c {
-		if !certificate.Generated {
-			continue
-		}
-		s := certificate.AsSecret(cluster, config)
-		if err := ctrlclient.Create(ctx, s); err != nil {
-			return errors.WithStack(err)
-		}
-	}
-	return nil
-}
-
-// LookupOrGenerate is a convenience function that wraps cluster bootstrap certificate behavior.
-func (c Certificates) LookupOrGenerate(ctx context.Context, ctrlclient client.Client, cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) error {
-	// Find the certificates that exist
-	if err := c.Lookup(ctx, ctrlclient, cluster); err != nil {
-		return err
-	}
-
-	// Generate the certificates that don't exist
-	if err := c.Generate(); err != nil {
-		return err
-	}
-
-	// Save any certificates that have been generated
-	if err := c.SaveGenerated(ctx, ctrlclient, cluster, config); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // Certificate represents a single certificate CA.
 type Certificate struct {
 	Generated         bool
-	Purpose           secret.Purpose
+	Purpose           Purpose
 	KeyPair           *certs.KeyPair
 	CertFile, KeyFile string
+	// Validity is the validity of the certificate authority if it is generated. Defaults to DefaultCAValidity.
+	Validity time.Duration
 }
 
 // Hashes hashes all the certificates stored in a CA certificate.
@@ -297,39 +332,38 @@ func (c *Certificate) Hashes() ([]string, error) {
 	return out, nil
 }
 
+// Expiry returns the earliest expiration time of the certificates stored in a CA certificate.
+func (c *Certificate) Expiry() (time.Time, error) {
+	certificates, err := cert.ParseCertsPEM(c.KeyPair.Cert)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "unable to parse %s certificate", c.Purpose)
+	}
+	var expiry time.Time
+	for _, c := range certificates {
+		if expiry.IsZero() || c.NotAfter.Before(expiry) {
+			expiry = c.NotAfter
+		}
+	}
+	return expiry, nil
+}
+
 // hashCert calculates the sha256 of certificate.
 func hashCert(certificate *x509.Certificate) string {
 	spkiHash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
 	return "sha256:" + strings.ToLower(hex.EncodeToString(spkiHash[:]))
 }
 
-// AsSecret converts a single certificate into a Kubernetes secret.
-func (c *Certificate) AsSecret(cluster *clusterv1.Cluster, config *bootstrapv1.KubeadmConfig) *corev1.Secret {
-	s := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: cluster.Namespace,
-			Name:      secret.Name(cluster.Name, c.Purpose),
-			Labels: map[string]string{
-				clusterv1.MachineClusterLabelName: cluster.Name,
-			},
-		},
-		Data: map[string][]byte{
-			secret.TLSKeyDataName: c.KeyPair.Key,
-			secret.TLSCrtDataName: c.KeyPair.Cert,
-		},
-	}
-
-	if c.Generated {
-		s.OwnerReferences = []metav1.OwnerReference{
-			{
-				APIVersion: bootstrapv1.GroupVersion.String(),
-				Kind:       "KubeadmConfig",
-				Name:       config.Name,
-				UID:        config.UID,
-			},
-		}
-	}
-	return s
+// InputsHash returns the hash of the given inputs, as stored in the InputsHashAnnotation. Inputs are length
+// prefixed, so that moving bytes from one input to the next changes the hash.
+func InputsHash(inputs ...[]byte) string {
+	h := sha256.New()
+	for _, input := range inputs {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(input)))
+		h.Write(length[:])
+		h.Write(input)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
 }
 
 // AsFiles converts the certificate to a slice of Files that may have 0, 1 or 2 Files.
@@ -356,7 +390,7 @@ func (c *Certificate) AsFiles() []bootstrapv1.File {
 
 // AsFiles converts a slice of certificates into bootstrap files.
 func (c Certificates) AsFiles() []bootstrapv1.File {
-	clusterCA := c.GetByPurpose(secret.ClusterCA)
+	clusterCA := c.GetByPurpose(ClusterCA)
 	etcdCA := c.GetByPurpose(EtcdCA)
 	frontProxyCA := c.GetByPurpose(FrontProxyCA)
 	serviceAccountKey := c.GetByPurpose(ServiceAccount)
@@ -365,7 +399,8 @@ func (c Certificates) AsFiles() []bootstrapv1.File {
 	if clusterCA != nil {
 		certFiles = append(certFiles, clusterCA.AsFiles()...)
 	}
-	if etcdCA != nil {
+	// the CA of an external etcd is not set if it does not use TLS
+	if etcdCA != nil && etcdCA.KeyPair != nil {
 		certFiles = append(certFiles, etcdCA.AsFiles()...)
 	}
 	if frontProxyCA != nil {
@@ -377,34 +412,15 @@ func (c Certificates) AsFiles() []bootstrapv1.File {
 
 	// these will only exist if external etcd was defined and supplied by the user
 	apiserverEtcdClientCert := c.GetByPurpose(APIServerEtcdClient)
-	if apiserverEtcdClientCert != nil {
+	if apiserverEtcdClientCert != nil && apiserverEtcdClientCert.KeyPair != nil {
 		certFiles = append(certFiles, apiserverEtcdClientCert.AsFiles()...)
 	}
 
 	return certFiles
 }
 
-func secretToKeyPair(s *corev1.Secret) (*certs.KeyPair, error) {
-	c, exists := s.Data[secret.TLSCrtDataName]
-	if !exists {
-		return nil, errors.Errorf("missing data for key %s", secret.TLSCrtDataName)
-	}
-
-	// In some cases (external etcd) it's ok if the etcd.key does not exist.
-	// TODO: some other function should ensure that the certificates we need exist.
-	key, exists := s.Data[secret.TLSKeyDataName]
-	if !exists {
-		key = []byte("")
-	}
-
-	return &certs.KeyPair{
-		Cert: c,
-		Key:  key,
-	}, nil
-}
-
-func generateCACert() (*certs.KeyPair, error) {
-	x509Cert, privKey, err := newCertificateAuthority()
+func generateCACert(validity time.Duration) (*certs.KeyPair, error) {
+	x509Cert, privKey, err := newCertificateAuthority(validity)
 	if err != nil {
 		return nil, err
 	}
@@ -430,13 +446,13 @@ func generateServiceAccountKeys() (*certs.KeyPair, error) {
 }
 
 // newCertificateAuthority creates new certificate and private key for the certificate authority
-func newCertificateAuthority() (*x509.Certificate, *rsa.PrivateKey, error) {
+func newCertificateAuthority(validity time.Duration) (*x509.Certificate, *rsa.PrivateKey, error) {
 	key, err := certs.NewPrivateKey()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	c, err := newSelfSignedCACert(key)
+	c, err := newSelfSignedCACert(key, validity)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -444,8 +460,12 @@ func newCertificateAuthority() (*x509.Certificate, *rsa.PrivateKey, error) {
 	return c, key, nil
 }
 
-// newSelfSignedCACert creates a CA certificate.
-func newSelfSignedCACert(key *rsa.PrivateKey) (*x509.Certificate, error) {
+// newSelfSignedCACert creates a CA certificate valid for the given duration, or DefaultCAValidity if zero.
+func newSelfSignedCACert(key *rsa.PrivateKey, validity time.Duration) (*x509.Certificate, error) {
+	if validity <= 0 {
+		validity = DefaultCAValidity
+	}
+
 	cfg := certs.Config{
 		CommonName: "kubernetes",
 	}
@@ -459,7 +479,7 @@ func newSelfSignedCACert(key *rsa.PrivateKey) (*x509.Certificate, error) {
 			Organization: cfg.Organization,
 		},
 		NotBefore:             now.Add(time.Minute * -5),
-		NotAfter:              now.Add(time.Hour * 24 * 365 * 10), // 10 years
+		NotAfter:              now.Add(validity),
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 		MaxPathLenZero:        true,
 		BasicConstraintsValid: true,
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+// certificateDirFiles are the certificate and key file names of the certificates in a certificates directory,
+// laid out like the kubeadm certificates directory.
+var certificateDirFiles = map[Purpose][2]string{
+	ClusterCA:           {"ca.crt", "ca.key"},
+	ServiceAccount:      {"sa.pub", "sa.key"},
+	FrontProxyCA:        {"front-proxy-ca.crt", "front-proxy-ca.key"},
+	EtcdCA:              {filepath.Join("etcd", "ca.crt"), filepath.Join("etcd", "ca.key")},
+	APIServerEtcdClient: {"apiserver-etcd-client.crt", "apiserver-etcd-client.key"},
+}
+
+// LookupDir looks up each certificate from the files of a certificates directory laid out like the kubeadm
+// certificates directory, e.g. ca.crt and ca.key for the cluster CA, and populates the certificate with their data.
+// Certificates without certificate file are left empty, and keys are optional, as for secrets.
+func (c Certificates) LookupDir(dir string) error {
+	for _, certificate := range c {
+		names, ok := certificateDirFiles[certificate.Purpose]
+		if !ok {
+			continue
+		}
+		cert, err := ioutil.ReadFile(filepath.Join(dir, names[0]))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to read the %s certificate", certificate.Purpose)
+		}
+		key, err := ioutil.ReadFile(filepath.Join(dir, names[1]))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to read the %s key", certificate.Purpose)
+		}
+		certificate.KeyPair = &certs.KeyPair{Cert: cert, Key: key}
+	}
+	return nil
+}
+
+// SaveGeneratedDir writes the certificates that have been generated to a certificates directory laid out like the
+// kubeadm certificates directory. Existing files are never replaced.
+func (c Certificates) SaveGeneratedDir(dir string) error {
+	for _, certificate := range c {
+		names, ok := certificateDirFiles[certificate.Purpose]
+		if !certificate.Generated || !ok {
+			continue
+		}
+		for _, f := range []struct {
+			name        string
+			data        []byte
+			permissions os.FileMode
+		}{
+			{names[0], certificate.KeyPair.Cert, 0644},
+			{names[1], certificate.KeyPair.Key, 0600},
+		} {
+			path := filepath.Join(dir, f.name)
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				return errors.Wrapf(err, "failed to create the directory of %s", path)
+			}
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, f.permissions)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create %s", path)
+			}
+			_, err = file.Write(f.data)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to write %s", path)
+			}
+		}
+	}
+	return nil
+}
@@ -17,9 +17,18 @@ limitations under the License.
 package cluster
 
 import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
 	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	"sigs.k8s.io/cluster-api/util/certs"
 )
 
 func TestNewCertificatesForControlPlane_Stacked(t *testing.T) {
@@ -42,3 +51,177 @@ func TestNewCertificatesForControlPlane_External(t *testing.T) {
 		t.Fatal("control planes with external etcd must *not* define the etcd key file")
 	}
 }
+
+func TestCertificate_Expiry(t *testing.T) {
+	kp, err := generateCACert(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Certificate{Purpose: ClusterCA, KeyPair: kp}
+	expiry, err := c.Expiry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiry.After(time.Now()) {
+		t.Fatalf("expected expiry %v to be in the future", expiry)
+	}
+
+	c.KeyPair.Cert = []byte("not a certificate")
+	if _, err := c.Expiry(); err == nil {
+		t.Fatal("expected an error parsing an invalid certificate")
+	}
+}
+
+func TestInputsHash(t *testing.T) {
+	if InputsHash([]byte("ab"), []byte("c")) == InputsHash([]byte("a"), []byte("bc")) {
+		t.Error("expected the hash to depend on the boundaries of the inputs")
+	}
+	if InputsHash([]byte("a")) != InputsHash([]byte("a")) {
+		t.Error("expected the hash to be stable")
+	}
+}
+
+func TestGenerate_ExternalEtcdCA(t *testing.T) {
+	config := &v1beta1.ClusterConfiguration{
+		Etcd: v1beta1.Etcd{
+			External: &v1beta1.ExternalEtcd{CAFile: "/etc/etcd/ca.crt"},
+		},
+	}
+
+	certificates := NewCertificatesForInitialControlPlane(config)
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if certificates.GetByPurpose(EtcdCA).KeyPair != nil {
+		t.Error("the CA of an external etcd must not be generated")
+	}
+	for _, file := range certificates.AsFiles() {
+		if file.Path == "/etc/etcd/ca.crt" {
+			t.Error("expected no file for a missing external etcd CA")
+		}
+	}
+}
+
+func TestValidateExternalEtcdCertificates(t *testing.T) {
+	newCA := func() *Certificate {
+		kp, err := generateCACert(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Certificate{Purpose: EtcdCA, KeyPair: kp}
+	}
+	newClient := func(ca *Certificate, name bootstrapv1.EtcdCertificateName) *Certificate {
+		files, err := NewEtcdCertificateFiles(ca, []bootstrapv1.EtcdCertificateName{name}, "etcd-0", []net.IP{net.ParseIP("10.0.0.1")}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Certificate{Purpose: APIServerEtcdClient, KeyPair: &certs.KeyPair{Cert: []byte(files[0].Content), Key: []byte(files[1].Content)}}
+	}
+
+	oldCA, newerCA := newCA(), newCA()
+	bundle := &Certificate{Purpose: EtcdCA, KeyPair: &certs.KeyPair{Cert: append(append([]byte{}, oldCA.KeyPair.Cert...), newerCA.KeyPair.Cert...)}}
+	client := newClient(newerCA, bootstrapv1.APIServerEtcdClientCertificate)
+	endpoints := []string{"https://etcd.example.com:2379"}
+
+	if err := ValidateExternalEtcdCertificates(bundle, client, endpoints); err != nil {
+		t.Errorf("expected a client certificate signed by a CA of the bundle to be valid, got %v", err)
+	}
+	if err := ValidateExternalEtcdCertificates(oldCA, client, endpoints); err == nil {
+		t.Error("expected a client certificate signed by another CA to be rejected")
+	}
+	if err := ValidateExternalEtcdCertificates(bundle, nil, endpoints); err == nil {
+		t.Error("expected a missing client certificate to be rejected")
+	}
+	mismatched := &Certificate{Purpose: APIServerEtcdClient, KeyPair: &certs.KeyPair{Cert: client.KeyPair.Cert, Key: newClient(newerCA, bootstrapv1.APIServerEtcdClientCertificate).KeyPair.Key}}
+	if err := ValidateExternalEtcdCertificates(bundle, mismatched, endpoints); err == nil {
+		t.Error("expected a client certificate not matching its key to be rejected")
+	}
+
+	// server certificates reused as client certificates hold SANs, which must cover the endpoints
+	serverClient := newClient(newerCA, bootstrapv1.EtcdServerCertificate)
+	if err := ValidateExternalEtcdCertificates(bundle, serverClient, []string{"https://etcd-0:2379", "https://10.0.0.1:2379"}); err != nil {
+		t.Errorf("expected the endpoints to be covered, got %v", err)
+	}
+	if err := ValidateExternalEtcdCertificates(bundle, serverClient, endpoints); err == nil {
+		t.Error("expected an endpoint not covered by the SANs of the client certificate to be rejected")
+	}
+}
+
+func TestCertificatesDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certificates := NewCertificatesForInitialControlPlane(&v1beta1.ClusterConfiguration{})
+	if err := certificates.LookupDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := certificates.SaveGeneratedDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "etcd", "ca.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected keys to be written with 0600, got %v", info.Mode().Perm())
+	}
+
+	found := NewCertificatesForInitialControlPlane(&v1beta1.ClusterConfiguration{})
+	if err := found.LookupDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, certificate := range certificates {
+		keyPair := found.GetByPurpose(certificate.Purpose).KeyPair
+		if keyPair == nil || !bytes.Equal(keyPair.Cert, certificate.KeyPair.Cert) || !bytes.Equal(keyPair.Key, certificate.KeyPair.Key) {
+			t.Errorf("expected the %s certificate to be read back from the directory", certificate.Purpose)
+		}
+	}
+
+	// generated certificates never replace existing files
+	if err := certificates.SaveGeneratedDir(dir); err == nil {
+		t.Error("expected existing certificates not to be replaced")
+	}
+}
+
+func TestValidateKeyPairs(t *testing.T) {
+	certificates := NewCertificatesForInitialControlPlane(&v1beta1.ClusterConfiguration{})
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := certificates.ValidateKeyPairs(); err != nil {
+		t.Fatalf("expected generated certificates to be valid, got %v", err)
+	}
+
+	other := NewCertificatesForInitialControlPlane(&v1beta1.ClusterConfiguration{})
+	if err := other.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, purpose := range []Purpose{ClusterCA, ServiceAccount} {
+		certificate := certificates.GetByPurpose(purpose)
+		keyPair := certificate.KeyPair
+		certificate.KeyPair = &certs.KeyPair{Cert: keyPair.Cert, Key: other.GetByPurpose(purpose).KeyPair.Key}
+		if err := certificates.ValidateKeyPairs(); errors.Cause(err) != ErrInvalidKeyPair {
+			t.Errorf("expected a mismatched %s key to be rejected, got %v", purpose, err)
+		}
+		certificate.KeyPair = &certs.KeyPair{Cert: keyPair.Cert}
+		if err := certificates.ValidateKeyPairs(); errors.Cause(err) != ErrInvalidKeyPair {
+			t.Errorf("expected a missing %s key to be rejected, got %v", purpose, err)
+		}
+		certificate.KeyPair = keyPair
+	}
+
+	// the CA of an external etcd has no key
+	external := NewCertificatesForInitialControlPlane(&v1beta1.ClusterConfiguration{
+		Etcd: v1beta1.Etcd{External: &v1beta1.ExternalEtcd{CAFile: "/etc/etcd/ca.crt"}},
+	})
+	external.GetByPurpose(EtcdCA).KeyPair = &certs.KeyPair{Cert: certificates.GetByPurpose(EtcdCA).KeyPair.Cert}
+	if err := external.ValidateKeyPairs(); err != nil {
+		t.Errorf("expected the CA of an external etcd to be valid without key, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/cert"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+// etcdCertificateSpecs mirrors the etcd certificates kubeadm generates for stacked etcd.
+var etcdCertificateSpecs = map[bootstrapv1.EtcdCertificateName]struct {
+	// baseName is the path of the certificate relative to the certificates dir, without extension.
+	baseName string
+	// commonName is the fixed common name of client certificates; server certificates use the node name.
+	commonName   string
+	organization []string
+	usages       []x509.ExtKeyUsage
+}{
+	bootstrapv1.EtcdServerCertificate: {
+		baseName: "etcd/server",
+		usages:   []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	},
+	bootstrapv1.EtcdPeerCertificate: {
+		baseName: "etcd/peer",
+		usages:   []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	},
+	bootstrapv1.EtcdHealthcheckClientCertificate: {
+		baseName:     "etcd/healthcheck-client",
+		commonName:   "kube-etcd-healthcheck-client",
+		organization: []string{"system:masters"},
+		usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	},
+	bootstrapv1.APIServerEtcdClientCertificate: {
+		baseName:     "apiserver-etcd-client",
+		commonName:   "kube-apiserver-etcd-client",
+		organization: []string{"system:masters"},
+		usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	},
+}
+
+// NewEtcdCertificateFiles generates the named etcd certificates with the etcd CA, like kubeadm does for stacked
+// etcd, and returns them as files to be written in the default certificates dir. Server and peer certificates
+// are issued for the node name and the given addresses, in addition to localhost. The certificates are valid for
+// the given duration, or the cluster-api default if zero.
+func NewEtcdCertificateFiles(etcdCA *Certificate, names []bootstrapv1.EtcdCertificateName, nodeName string, addresses []net.IP, validity time.Duration) ([]bootstrapv1.File, error) {
+	files := make([]bootstrapv1.File, 0, 2*len(names))
+	for _, name := range names {
+		spec, ok := etcdCertificateSpecs[name]
+		if !ok {
+			return nil, errors.Errorf("unsupported etcd certificate %q", name)
+		}
+
+		cfg := &certs.Config{
+			CommonName:   spec.commonName,
+			Organization: spec.organization,
+			Usages:       spec.usages,
+		}
+		if cfg.CommonName == "" {
+			if nodeName == "" {
+				return nil, errors.Errorf("a node name is required to generate the etcd %s certificate", name)
+			}
+			cfg.CommonName = nodeName
+			cfg.AltNames = certs.AltNames{
+				DNSNames: []string{nodeName, "localhost"},
+				IPs:      append([]net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}, addresses...),
+			}
+		}
+
+		var kp *certs.KeyPair
+		var err error
+		if validity > 0 {
+			kp, err = etcdCA.NewSignedKeyPairWithDuration(cfg, validity)
+		} else {
+			kp, err = etcdCA.NewSignedKeyPair(cfg)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate etcd %s certificate", name)
+		}
+
+		files = append(files,
+			bootstrapv1.File{
+				Path:        filepath.Join(defaultCertificatesDir, spec.baseName+".crt"),
+				Owner:       rootOwnerValue,
+				Permissions: "0640",
+				Content:     string(kp.Cert),
+			},
+			bootstrapv1.File{
+				Path:        filepath.Join(defaultCertificatesDir, spec.baseName+".key"),
+				Owner:       rootOwnerValue,
+				Permissions: "0600",
+				Content:     string(kp.Key),
+			},
+		)
+	}
+	return files, nil
+}
+
+// ValidateExternalEtcdCertificates checks that the user supplied certificates of an external etcd can be used by the
+// API server to reach the given endpoints. The etcd CA may be a bundle of several certificates, e.g. during a CA
+// rotation, and the apiserver-etcd-client certificate must match its key and be signed by one of them for client
+// authentication. Client certificates holding SANs, e.g. when etcd server certificates are reused as client
+// certificates, must also cover the host of each endpoint.
+func ValidateExternalEtcdCertificates(etcdCA, client *Certificate, endpoints []string) error {
+	if etcdCA == nil || etcdCA.KeyPair == nil || len(etcdCA.KeyPair.Cert) == 0 {
+		return errors.Wrapf(ErrMissingCrt, "for certificate: %s", EtcdCA)
+	}
+	roots, err := cert.ParseCertsPEM(etcdCA.KeyPair.Cert)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse %s certificate bundle", EtcdCA)
+	}
+	rootPool := x509.NewCertPool()
+	for _, root := range roots {
+		rootPool.AddCert(root)
+	}
+
+	if client == nil || client.KeyPair == nil || len(client.KeyPair.Cert) == 0 {
+		return errors.Wrapf(ErrMissingCrt, "for certificate: %s", APIServerEtcdClient)
+	}
+	if len(client.KeyPair.Key) == 0 {
+		return errors.Wrapf(ErrMissingKey, "for certificate: %s", APIServerEtcdClient)
+	}
+	keyPair, err := tls.X509KeyPair(client.KeyPair.Cert, client.KeyPair.Key)
+	if err != nil {
+		return errors.Wrapf(err, "the %s certificate does not match its key", APIServerEtcdClient)
+	}
+	chain := make([]*x509.Certificate, 0, len(keyPair.Certificate))
+	for _, der := range keyPair.Certificate {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return errors.Wrapf(err, "unable to parse %s certificate", APIServerEtcdClient)
+		}
+		chain = append(chain, c)
+	}
+	intermediatePool := x509.NewCertPool()
+	for _, intermediate := range chain[1:] {
+		intermediatePool.AddCert(intermediate)
+	}
+	leaf := chain[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediatePool,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return errors.Wrapf(err, "the %s certificate is not valid for the %s CA bundle", APIServerEtcdClient, EtcdCA)
+	}
+
+	if len(leaf.DNSNames) == 0 && len(leaf.IPAddresses) == 0 {
+		return nil
+	}
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return errors.Wrapf(err, "invalid etcd endpoint %q", endpoint)
+		}
+		if err := leaf.VerifyHostname(u.Hostname()); err != nil {
+			return errors.Wrapf(err, "the %s certificate does not cover the etcd endpoint %s", APIServerEtcdClient, endpoint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+const (
+	certificateRequestBlockType = "CERTIFICATE REQUEST"
+)
+
+var (
+	// ErrMissingCAKey occurs when a certificate authority cannot sign because its key is not available.
+	ErrMissingCAKey = errors.New("missing certificate authority key")
+)
+
+// SignCertificateRequest signs a PEM encoded certificate signing request with the certificate authority
+// and returns the PEM encoded certificate. The certificate is valid for the given duration, but never
+// longer than the certificate authority itself.
+func (c *Certificate) SignCertificateRequest(csrPEM []byte, usages []x509.ExtKeyUsage, duration time.Duration) ([]byte, error) {
+	if c.KeyPair == nil || len(c.KeyPair.Key) == 0 {
+		return nil, errors.Wrapf(ErrMissingCAKey, "for certificate: %s", c.Purpose)
+	}
+	if len(usages) == 0 {
+		return nil, errors.New("must specify at least one ExtKeyUsage")
+	}
+
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != certificateRequestBlockType {
+		return nil, errors.New("failed to decode PEM encoded certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse certificate request")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errors.Wrap(err, "invalid certificate request signature")
+	}
+	if csr.Subject.CommonName == "" {
+		return nil, errors.New("certificate request must specify a CommonName")
+	}
+
+	caCert, err := certs.DecodeCertPEM(c.KeyPair.Cert)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s certificate", c.Purpose)
+	}
+	caKey, err := certs.DecodePrivateKeyPEM(c.KeyPair.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s key", c.Purpose)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate random integer for signed certificate")
+	}
+
+	now := time.Now().UTC()
+	notAfter := now.Add(duration)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+
+	tmpl := x509.Certificate{
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		IPAddresses:  csr.IPAddresses,
+		SerialNumber: serial,
+		NotBefore:    now.Add(time.Minute * -5),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usages,
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, &tmpl, caCert, csr.PublicKey, caKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to sign certificate request for %q", csr.Subject.CommonName)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b}), nil
+}
+
+// NewSignedKeyPair generates a new private key and a certificate for it signed by the certificate authority.
+func (c *Certificate) NewSignedKeyPair(cfg *certs.Config) (*certs.KeyPair, error) {
+	if c.KeyPair == nil || len(c.KeyPair.Key) == 0 {
+		return nil, errors.Wrapf(ErrMissingCAKey, "for certificate: %s", c.Purpose)
+	}
+
+	caCert, err := certs.DecodeCertPEM(c.KeyPair.Cert)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s certificate", c.Purpose)
+	}
+	caKey, err := certs.DecodePrivateKeyPEM(c.KeyPair.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s key", c.Purpose)
+	}
+
+	key, err := certs.NewPrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate private key")
+	}
+	cert, err := cfg.NewSignedCert(key, caCert, caKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to sign certificate for %q", cfg.CommonName)
+	}
+
+	return &certs.KeyPair{
+		Cert: certs.EncodeCertPEM(cert),
+		Key:  certs.EncodePrivateKeyPEM(key),
+	}, nil
+}
+
+// NewSignedKeyPairWithDuration generates a new private key and a certificate for it signed by the certificate authority,
+// like NewSignedKeyPair, but valid for the given duration instead of the cluster-api default. The certificate is never
+// valid longer than the certificate authority itself.
+func (c *Certificate) NewSignedKeyPairWithDuration(cfg *certs.Config, duration time.Duration) (*certs.KeyPair, error) {
+	key, err := certs.NewPrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate private key")
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: cfg.CommonName, Organization: cfg.Organization},
+		DNSNames:    cfg.AltNames.DNSNames,
+		IPAddresses: cfg.AltNames.IPs,
+	}, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create certificate request for %q", cfg.CommonName)
+	}
+
+	cert, err := c.SignCertificateRequest(pem.EncodeToMemory(&pem.Block{Type: certificateRequestBlockType, Bytes: csr}), cfg.Usages, duration)
+	if err != nil {
+		return nil, err
+	}
+	return &certs.KeyPair{
+		Cert: cert,
+		Key:  certs.EncodePrivateKeyPEM(key),
+	}, nil
+}
+
+// NewSignedClientKeyPair generates a new private key and a client certificate for the given subject, signed by the
+// certificate authority. The certificate is valid for the given duration, but never longer than the certificate authority itself.
+func (c *Certificate) NewSignedClientKeyPair(subject pkix.Name, duration time.Duration) (*certs.KeyPair, error) {
+	key, err := certs.NewPrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate private key")
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: subject}, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create certificate request for %q", subject.CommonName)
+	}
+
+	cert, err := c.SignCertificateRequest(pem.EncodeToMemory(&pem.Block{Type: certificateRequestBlockType, Bytes: csr}), []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, duration)
+	if err != nil {
+		return nil, err
+	}
+	return &certs.KeyPair{
+		Cert: cert,
+		Key:  certs.EncodePrivateKeyPEM(key),
+	}, nil
+}
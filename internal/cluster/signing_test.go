@@ -0,0 +1,259 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+func newCertificateRequestPEM(t *testing.T, commonName string) []byte {
+	key, err := certs.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName, Organization: []string{"system:masters"}},
+		DNSNames: []string{"example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: certificateRequestBlockType, Bytes: der})
+}
+
+func TestSignCertificateRequest(t *testing.T) {
+	kp, err := generateCACert(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &Certificate{Purpose: ClusterCA, KeyPair: kp}
+	caCert, err := certs.DecodeCertPEM(kp.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := ca.SignCertificateRequest(newCertificateRequestPEM(t, "provider"), []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := certs.DecodeCertPEM(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject.CommonName != "provider" || len(c.Subject.Organization) != 1 || c.Subject.Organization[0] != "system:masters" {
+		t.Errorf("unexpected subject %v", c.Subject)
+	}
+	if len(c.DNSNames) != 1 || c.DNSNames[0] != "example.com" {
+		t.Errorf("unexpected DNS names %v", c.DNSNames)
+	}
+	if err := c.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("certificate is not signed by the CA: %v", err)
+	}
+	if c.NotAfter.After(time.Now().Add(time.Hour)) {
+		t.Errorf("certificate expires at %v, after the requested duration", c.NotAfter)
+	}
+
+	// The certificate must not outlive the CA.
+	signed, err = ca.SignCertificateRequest(newCertificateRequestPEM(t, "provider"), []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, 100*365*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = certs.DecodeCertPEM(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.NotAfter.After(caCert.NotAfter) {
+		t.Errorf("certificate expires at %v, after the CA expires at %v", c.NotAfter, caCert.NotAfter)
+	}
+}
+
+func TestSignCertificateRequest_Errors(t *testing.T) {
+	kp, err := generateCACert(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usages := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	tests := []struct {
+		name   string
+		ca     *Certificate
+		csr    []byte
+		usages []x509.ExtKeyUsage
+	}{
+		{
+			name:   "missing CA key",
+			ca:     &Certificate{Purpose: ClusterCA, KeyPair: &certs.KeyPair{Cert: kp.Cert}},
+			csr:    newCertificateRequestPEM(t, "provider"),
+			usages: usages,
+		},
+		{
+			name:   "no usages",
+			ca:     &Certificate{Purpose: ClusterCA, KeyPair: kp},
+			csr:    newCertificateRequestPEM(t, "provider"),
+			usages: nil,
+		},
+		{
+			name:   "invalid request",
+			ca:     &Certificate{Purpose: ClusterCA, KeyPair: kp},
+			csr:    []byte("not a request"),
+			usages: usages,
+		},
+		{
+			name:   "no common name",
+			ca:     &Certificate{Purpose: ClusterCA, KeyPair: kp},
+			csr:    newCertificateRequestPEM(t, ""),
+			usages: usages,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.ca.SignCertificateRequest(tc.csr, tc.usages, time.Hour); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestNewSignedKeyPair(t *testing.T) {
+	kp, err := generateCACert(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &Certificate{Purpose: EtcdCA, KeyPair: kp}
+	caCert, err := certs.DecodeCertPEM(kp.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := ca.NewSignedKeyPair(&certs.Config{
+		CommonName: "etcd-0",
+		AltNames:   certs.AltNames{DNSNames: []string{"etcd-0.example.com"}},
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := certs.DecodeCertPEM(signed.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("certificate is not signed by the CA: %v", err)
+	}
+	key, err := certs.DecodePrivateKeyPEM(signed.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.PublicKey.N.Cmp(c.PublicKey.(*rsa.PublicKey).N) != 0 {
+		t.Error("certificate does not match the generated key")
+	}
+
+	if _, err := (&Certificate{Purpose: EtcdCA, KeyPair: &certs.KeyPair{Cert: kp.Cert}}).NewSignedKeyPair(&certs.Config{CommonName: "etcd-0"}); err == nil {
+		t.Error("expected an error signing without the CA key")
+	}
+}
+
+func TestNewSignedClientKeyPair(t *testing.T) {
+	kp, err := generateCACert(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &Certificate{Purpose: ClusterCA, KeyPair: kp}
+	caCert, err := certs.DecodeCertPEM(kp.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := pkix.Name{CommonName: "system:node:worker-0", Organization: []string{"system:nodes"}}
+	signed, err := ca.NewSignedClientKeyPair(subject, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := certs.DecodeCertPEM(signed.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("certificate is not signed by the CA: %v", err)
+	}
+	if c.Subject.CommonName != subject.CommonName || len(c.Subject.Organization) != 1 || c.Subject.Organization[0] != "system:nodes" {
+		t.Errorf("unexpected subject %v", c.Subject)
+	}
+	if len(c.ExtKeyUsage) != 1 || c.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("expected a client certificate, got usages %v", c.ExtKeyUsage)
+	}
+	if c.NotAfter.After(time.Now().Add(time.Hour)) {
+		t.Errorf("expected the certificate to expire within an hour, got %v", c.NotAfter)
+	}
+}
+
+func TestNewSignedKeyPairWithDuration(t *testing.T) {
+	kp, err := generateCACert(48 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &Certificate{Purpose: EtcdCA, KeyPair: kp}
+	caCert, err := certs.DecodeCertPEM(kp.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caCert.NotAfter.After(time.Now().Add(48 * time.Hour)) {
+		t.Errorf("expected the CA to expire within 48 hours, got %v", caCert.NotAfter)
+	}
+
+	signed, err := ca.NewSignedKeyPairWithDuration(&certs.Config{
+		CommonName: "etcd-0",
+		AltNames:   certs.AltNames{DNSNames: []string{"etcd-0", "localhost"}},
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := certs.DecodeCertPEM(signed.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("certificate is not signed by the CA: %v", err)
+	}
+	if c.Subject.CommonName != "etcd-0" || len(c.DNSNames) != 2 || len(c.ExtKeyUsage) != 2 {
+		t.Errorf("unexpected certificate %v %v %v", c.Subject, c.DNSNames, c.ExtKeyUsage)
+	}
+	if c.NotAfter.After(time.Now().Add(time.Hour)) {
+		t.Errorf("expected the certificate to expire within an hour, got %v", c.NotAfter)
+	}
+
+	// the certificate never outlives the CA
+	signed, err = ca.NewSignedKeyPairWithDuration(&certs.Config{CommonName: "etcd-0", Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, 365*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err = certs.DecodeCertPEM(signed.Cert); err != nil {
+		t.Fatal(err)
+	}
+	if c.NotAfter.After(caCert.NotAfter) {
+		t.Errorf("expected the certificate to expire with the CA at %v, got %v", caCert.NotAfter, c.NotAfter)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+const (
+	// SSHCA is the secret name suffix for the SSH certificate authority. The certificate of its key pair is the
+	// public key in authorized_keys format, e.g. for @cert-authority lines of known_hosts files.
+	SSHCA Purpose = "ssh-ca"
+
+	ecPrivateKeyBlockType = "EC PRIVATE KEY"
+)
+
+// NewSSHCertificates returns the SSH certificate authority of a cluster.
+func NewSSHCertificates() Certificates {
+	return Certificates{&Certificate{Purpose: SSHCA}}
+}
+
+// generateSSHCA generates an ECDSA SSH certificate authority, whose signatures are accepted by all OpenSSH versions
+// supporting certificates, unlike the SHA-1 signatures of RSA keys.
+func generateSSHCA() (*certs.KeyPair, error) {
+	key, pub, err := newSSHKey()
+	if err != nil {
+		return nil, err
+	}
+	return &certs.KeyPair{
+		Cert: ssh.MarshalAuthorizedKey(pub),
+		Key:  key,
+	}, nil
+}
+
+// newSSHKey generates an ECDSA private key, returned PEM encoded, and its SSH public key.
+func newSSHKey() ([]byte, ssh.PublicKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate SSH key")
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to marshal SSH key")
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to convert SSH public key")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: ecPrivateKeyBlockType, Bytes: der}), pub, nil
+}
+
+// NewSignedSSHHostKey generates a new host key and a host certificate for it, valid for the given principals and
+// duration, signed by the SSH certificate authority. The certificate of the returned key pair is in the format of
+// the HostCertificate files of sshd.
+func (c *Certificate) NewSignedSSHHostKey(principals []string, duration time.Duration) (*certs.KeyPair, error) {
+	if len(principals) == 0 {
+		return nil, errors.New("SSH host certificates require at least one principal")
+	}
+	key, pub, err := newSSHKey()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := c.signSSHCertificate(pub, ssh.HostCert, principals[0], principals, duration)
+	if err != nil {
+		return nil, err
+	}
+	return &certs.KeyPair{
+		Cert: cert,
+		Key:  key,
+	}, nil
+}
+
+// SignSSHUserKey signs a user certificate for the given public key in authorized_keys format, valid for the given
+// principals, i.e. the users it can log in as, and duration. The key ID is recorded in the sshd logs.
+func (c *Certificate) SignSSHUserKey(authorizedKey []byte, keyID string, principals []string, duration time.Duration) ([]byte, error) {
+	if len(principals) == 0 {
+		return nil, errors.New("SSH user certificates require at least one principal")
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(authorizedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse SSH public key")
+	}
+	return c.signSSHCertificate(pub, ssh.UserCert, keyID, principals, duration)
+}
+
+func (c *Certificate) signSSHCertificate(pub ssh.PublicKey, certType uint32, keyID string, principals []string, duration time.Duration) ([]byte, error) {
+	if c.KeyPair == nil || len(c.KeyPair.Key) == 0 {
+		return nil, errors.Wrapf(ErrMissingCAKey, "for certificate: %s", c.Purpose)
+	}
+	signer, err := ssh.ParsePrivateKey(c.KeyPair.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s key", c.Purpose)
+	}
+
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, errors.Wrap(err, "failed to generate SSH certificate serial")
+	}
+	now := time.Now().UTC()
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        certType,
+		KeyId:           keyID,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(time.Minute * -5).Unix()),
+		ValidBefore:     uint64(now.Add(duration).Unix()),
+	}
+	if certType == ssh.UserCert {
+		cert.Permissions.Extensions = map[string]string{
+			"permit-agent-forwarding": "",
+			"permit-port-forwarding":  "",
+			"permit-pty":              "",
+		}
+	}
+	if err := cert.SignCert(rand.Reader, signer); err != nil {
+		return nil, errors.Wrapf(err, "failed to sign SSH certificate for %q", keyID)
+	}
+	return ssh.MarshalAuthorizedKey(cert), nil
+}
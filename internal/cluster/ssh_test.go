@@ -0,0 +1,100 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"sigs.k8s.io/cluster-api/util/certs"
+)
+
+func parseSSHCertificate(t *testing.T, data []byte) *ssh.Certificate {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		t.Fatalf("expected an SSH certificate, got %T", pub)
+	}
+	return cert
+}
+
+func TestSSHCertificates(t *testing.T) {
+	certificates := NewSSHCertificates()
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	ca := certificates.GetByPurpose(SSHCA)
+	caKey, _, _, _, err := ssh.ParseAuthorizedKey(ca.KeyPair.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, _ string) bool { return bytes.Equal(auth.Marshal(), caKey.Marshal()) },
+		IsUserAuthority: func(auth ssh.PublicKey) bool { return bytes.Equal(auth.Marshal(), caKey.Marshal()) },
+	}
+
+	hostKey, err := ca.NewSignedSSHHostKey([]string{"worker-0", "worker-0.example.com"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssh.ParsePrivateKey(hostKey.Key); err != nil {
+		t.Errorf("invalid host key: %v", err)
+	}
+	hostCert := parseSSHCertificate(t, hostKey.Cert)
+	if hostCert.CertType != ssh.HostCert {
+		t.Errorf("expected a host certificate, got type %d", hostCert.CertType)
+	}
+	if err := checker.CheckCert("worker-0.example.com", hostCert); err != nil {
+		t.Errorf("host certificate rejected: %v", err)
+	}
+	if err := checker.CheckCert("worker-1", hostCert); err == nil {
+		t.Error("expected the host certificate to be rejected for another host")
+	}
+	if _, err := ca.NewSignedSSHHostKey(nil, time.Hour); err == nil {
+		t.Error("expected an error without principals")
+	}
+
+	_, userKey, err := newSSHKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := ca.SignSSHUserKey(ssh.MarshalAuthorizedKey(userKey), "alice", []string{"root"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userCert := parseSSHCertificate(t, signed)
+	if userCert.CertType != ssh.UserCert || userCert.KeyId != "alice" {
+		t.Errorf("unexpected user certificate %+v", userCert)
+	}
+	if err := checker.CheckCert("root", userCert); err != nil {
+		t.Errorf("user certificate rejected: %v", err)
+	}
+	if time.Unix(int64(userCert.ValidBefore), 0).After(time.Now().Add(time.Hour)) {
+		t.Errorf("expected the user certificate to expire within an hour, got %v", userCert.ValidBefore)
+	}
+	if _, err := ca.SignSSHUserKey([]byte("not a key"), "alice", []string{"root"}, time.Hour); err == nil {
+		t.Error("expected an error signing an invalid public key")
+	}
+	if _, err := (&Certificate{Purpose: SSHCA, KeyPair: &certs.KeyPair{Cert: ca.KeyPair.Cert}}).SignSSHUserKey(ssh.MarshalAuthorizedKey(userKey), "alice", []string{"root"}, time.Hour); err == nil {
+		t.Error("expected an error signing without the CA key")
+	}
+}
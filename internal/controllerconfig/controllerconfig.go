@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controllerconfig holds the tunables of the controllers, which can be changed at runtime.
+package controllerconfig
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the API version of the controller configuration document.
+	APIVersion = "controller.bootstrap.cluster.x-k8s.io/v1alpha1"
+
+	// Kind is the kind of the controller configuration document.
+	Kind = "ControllerConfiguration"
+
+	// minBootstrapTokenTTL is the minimum validity of bootstrap tokens, leaving time for machines to join.
+	minBootstrapTokenTTL = time.Minute
+)
+
+// Configuration is the ComponentConfig-style document holding the tunables of the controllers.
+// Unset fields keep the value set by the controller flags.
+type Configuration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// RequeueInterval is the interval at which configs waiting for the control plane to be initialized,
+	// the init lock or the cluster-info ConfigMap, and pending certificate requests are reconciled again.
+	// +optional
+	RequeueInterval *metav1.Duration `json:"requeueInterval,omitempty"`
+
+	// BootstrapTokenTTL is the validity of the bootstrap tokens created or refreshed.
+	// +optional
+	BootstrapTokenTTL *metav1.Duration `json:"bootstrapTokenTTL,omitempty"`
+
+	// SignedCertificateDuration is the validity of certificates signed for certificate requests
+	// not specifying a duration.
+	// +optional
+	SignedCertificateDuration *metav1.Duration `json:"signedCertificateDuration,omitempty"`
+
+	// NodeClientCertificateTTL is the validity of pre-signed kubelet client certificates.
+	// +optional
+	NodeClientCertificateTTL *metav1.Duration `json:"nodeClientCertificateTTL,omitempty"`
+
+	// DefaultNTP is the NTP configuration of configs which do not specify one.
+	// +optional
+	DefaultNTP *bootstrapv1.NTP `json:"defaultNTP,omitempty"`
+}
+
+// Parse decodes and validates a controller configuration document. Unknown fields are rejected, so that
+// typos are not silently ignored.
+func Parse(data []byte) (*Configuration, error) {
+	c := &Configuration{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, errors.Wrap(err, "failed to parse controller configuration")
+	}
+	if err := c.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid controller configuration")
+	}
+	return c, nil
+}
+
+func (c *Configuration) validate() error {
+	if c.APIVersion != "" && c.APIVersion != APIVersion {
+		return errors.Errorf("unsupported apiVersion %q, expected %q", c.APIVersion, APIVersion)
+	}
+	if c.Kind != "" && c.Kind != Kind {
+		return errors.Errorf("unsupported kind %q, expected %q", c.Kind, Kind)
+	}
+	for _, d := range []struct {
+		field string
+		value *metav1.Duration
+	}{
+		{"requeueInterval", c.RequeueInterval},
+		{"bootstrapTokenTTL", c.BootstrapTokenTTL},
+		{"signedCertificateDuration", c.SignedCertificateDuration},
+		{"nodeClientCertificateTTL", c.NodeClientCertificateTTL},
+	} {
+		if d.value != nil && d.value.Duration <= 0 {
+			return errors.Errorf("%s must be positive, got %s", d.field, d.value.Duration)
+		}
+	}
+	if c.BootstrapTokenTTL != nil && c.BootstrapTokenTTL.Duration < minBootstrapTokenTTL {
+		return errors.Errorf("bootstrapTokenTTL must be at least %s, got %s", minBootstrapTokenTTL, c.BootstrapTokenTTL.Duration)
+	}
+	return nil
+}
+
+// Store holds the current controller configuration. It is safe for concurrent use.
+type Store struct {
+	mu     sync.RWMutex
+	config Configuration
+}
+
+// Get returns a copy of the current controller configuration.
+func (s *Store) Get() Configuration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := s.config
+	if out.DefaultNTP != nil {
+		out.DefaultNTP = out.DefaultNTP.DeepCopy()
+	}
+	return out
+}
+
+// Set replaces the current controller configuration. A nil configuration resets all the tunables
+// to the values set by the controller flags.
+func (s *Store) Set(c *Configuration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c == nil {
+		s.config = Configuration{}
+		return
+	}
+	s.config = *c
+	if c.DefaultNTP != nil {
+		s.config.DefaultNTP = c.DefaultNTP.DeepCopy()
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerconfig
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(`apiVersion: controller.bootstrap.cluster.x-k8s.io/v1alpha1
+kind: ControllerConfiguration
+requeueInterval: 10s
+bootstrapTokenTTL: 30m
+defaultNTP:
+  enabled: true
+  servers:
+  - time.example.com
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RequeueInterval == nil || c.RequeueInterval.Duration != 10*time.Second {
+		t.Errorf("expected a 10s requeue interval, got %v", c.RequeueInterval)
+	}
+	if c.BootstrapTokenTTL == nil || c.BootstrapTokenTTL.Duration != 30*time.Minute {
+		t.Errorf("expected a 30m bootstrap token TTL, got %v", c.BootstrapTokenTTL)
+	}
+	if c.SignedCertificateDuration != nil {
+		t.Errorf("expected no signed certificate duration, got %v", c.SignedCertificateDuration)
+	}
+	if c.DefaultNTP == nil || len(c.DefaultNTP.Servers) != 1 {
+		t.Errorf("expected a default NTP server, got %+v", c.DefaultNTP)
+	}
+
+	for _, invalid := range []string{
+		"kind: KubeletConfiguration",
+		"requeueInterval: -1s",
+		"bootstrapTokenTTL: 10s",
+		"bootstrapTokenTimeout: 30m",
+	} {
+		if _, err := Parse([]byte(invalid)); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := &Store{}
+	if c := s.Get(); c.BootstrapTokenTTL != nil {
+		t.Fatalf("expected an empty configuration, got %+v", c)
+	}
+
+	c, err := Parse([]byte("bootstrapTokenTTL: 30m\ndefaultNTP:\n  servers:\n  - time.example.com\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(c)
+	got := s.Get()
+	if got.BootstrapTokenTTL == nil || got.BootstrapTokenTTL.Duration != 30*time.Minute {
+		t.Errorf("expected a 30m bootstrap token TTL, got %v", got.BootstrapTokenTTL)
+	}
+	got.DefaultNTP.Servers[0] = "changed"
+	if s.Get().DefaultNTP.Servers[0] != "time.example.com" {
+		t.Error("expected the stored configuration not to be modified through a copy")
+	}
+
+	s.Set(nil)
+	if c := s.Get(); c.BootstrapTokenTTL != nil || c.DefaultNTP != nil {
+		t.Errorf("expected the configuration to be reset, got %+v", c)
+	}
+}
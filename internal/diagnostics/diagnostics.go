@@ -0,0 +1,227 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package diagnostics serves a summary of the bootstrap state of every cluster managed by the controller.
+package diagnostics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Path is the HTTP path the bootstrap state summary is served on.
+	Path = "/bootstrap-status"
+
+	requestTimeout  = 30 * time.Second
+	shutdownTimeout = 5 * time.Second
+)
+
+// LockInspector reports which machine holds the control plane init lock of a cluster.
+type LockInspector interface {
+	Holder(ctx context.Context, cluster *clusterv1.Cluster) (string, error)
+}
+
+// ClusterSummary is the bootstrap state of a single cluster.
+type ClusterSummary struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// InitLockHolder is the name of the machine holding the control plane init lock, if any.
+	InitLockHolder string `json:"initLockHolder,omitempty"`
+
+	// ConfigsPending is the number of KubeadmConfigs that do not have bootstrap data yet.
+	ConfigsPending int `json:"configsPending"`
+
+	// ConfigsReady is the number of KubeadmConfigs that have bootstrap data.
+	ConfigsReady int `json:"configsReady"`
+
+	// TokensOutstanding is the number of bootstrap tokens handed out to machines that have not joined yet.
+	TokensOutstanding int `json:"tokensOutstanding"`
+
+	// CertificateExpiry maps each cluster certificate authority to its expiration time.
+	CertificateExpiry map[string]time.Time `json:"certificateExpiry,omitempty"`
+
+	// Errors lists the problems encountered while building the summary.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Server serves the bootstrap state of every cluster as JSON.
+type Server struct {
+	Client        client.Client
+	LockInspector LockInspector
+	Log           logr.Logger
+
+	// Address is the address the server binds to when started by the manager.
+	Address string
+}
+
+// Start serves requests on Address until the stop channel is closed.
+func (s *Server) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, s)
+	srv := &http.Server{Addr: s.Address, Handler: mux}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.Log.Info("Serving diagnostics", "address", s.Address, "path", Path)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return errors.Wrap(err, "diagnostics server failed")
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	}
+}
+
+// NeedLeaderElection allows every replica to serve diagnostics, not only the leader.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), requestTimeout)
+	defer cancel()
+
+	summaries, err := s.Summarize(ctx, req.URL.Query().Get("namespace"))
+	if err != nil {
+		s.Log.Error(err, "failed to summarize bootstrap state")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(summaries); err != nil {
+		s.Log.Error(err, "failed to write bootstrap state")
+	}
+}
+
+// Summarize returns the bootstrap state of every cluster in the given namespace, or in all namespaces if empty.
+func (s *Server) Summarize(ctx context.Context, namespace string) ([]ClusterSummary, error) {
+	clusters := &clusterv1.ClusterList{}
+	if err := s.Client.List(ctx, clusters, client.InNamespace(namespace)); err != nil {
+		return nil, errors.Wrap(err, "failed to list clusters")
+	}
+	machines := &clusterv1.MachineList{}
+	if err := s.Client.List(ctx, machines, client.InNamespace(namespace)); err != nil {
+		return nil, errors.Wrap(err, "failed to list machines")
+	}
+	configs := &bootstrapv1.KubeadmConfigList{}
+	if err := s.Client.List(ctx, configs, client.InNamespace(namespace)); err != nil {
+		return nil, errors.Wrap(err, "failed to list kubeadm configs")
+	}
+
+	configsByKey := make(map[client.ObjectKey]*bootstrapv1.KubeadmConfig, len(configs.Items))
+	for i := range configs.Items {
+		c := &configs.Items[i]
+		configsByKey[client.ObjectKey{Namespace: c.Namespace, Name: c.Name}] = c
+	}
+
+	summaries := make([]ClusterSummary, 0, len(clusters.Items))
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		summary := ClusterSummary{
+			Namespace: cluster.Namespace,
+			Name:      cluster.Name,
+		}
+
+		for j := range machines.Items {
+			machine := &machines.Items[j]
+			if machine.Namespace != cluster.Namespace || machine.Labels[clusterv1.MachineClusterLabelName] != cluster.Name {
+				continue
+			}
+			ref := machine.Spec.Bootstrap.ConfigRef
+			if ref == nil || ref.Kind != "KubeadmConfig" {
+				continue
+			}
+			config, ok := configsByKey[client.ObjectKey{Namespace: machine.Namespace, Name: ref.Name}]
+			if !ok {
+				continue
+			}
+			if !config.Status.Ready {
+				summary.ConfigsPending++
+				continue
+			}
+			summary.ConfigsReady++
+			if hasBootstrapToken(config) && machine.Status.NodeRef == nil {
+				summary.TokensOutstanding++
+			}
+		}
+
+		if s.LockInspector != nil {
+			holder, err := s.LockInspector.Holder(ctx, cluster)
+			if err != nil {
+				summary.Errors = append(summary.Errors, err.Error())
+			}
+			summary.InitLockHolder = holder
+		}
+
+		expiry, err := s.certificateExpiry(ctx, cluster)
+		if err != nil {
+			summary.Errors = append(summary.Errors, err.Error())
+		}
+		summary.CertificateExpiry = expiry
+
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// certificateExpiry returns the expiration time of each certificate authority stored for the cluster.
+func (s *Server) certificateExpiry(ctx context.Context, cluster *clusterv1.Cluster) (map[string]time.Time, error) {
+	certificates := internalcluster.NewCertificatesForJoiningControlPlane()
+	if err := certsecret.Lookup(ctx, s.Client, cluster, certificates); err != nil {
+		return nil, errors.Wrap(err, "failed to look up cluster certificates")
+	}
+
+	var expiry map[string]time.Time
+	for _, certificate := range certificates {
+		// The service account key pair is not a certificate.
+		if certificate.KeyPair == nil || certificate.Purpose == internalcluster.ServiceAccount {
+			continue
+		}
+		notAfter, err := certificate.Expiry()
+		if err != nil {
+			return expiry, err
+		}
+		if expiry == nil {
+			expiry = map[string]time.Time{}
+		}
+		expiry[string(certificate.Purpose)] = notAfter
+	}
+	return expiry, nil
+}
+
+func hasBootstrapToken(config *bootstrapv1.KubeadmConfig) bool {
+	return config.Spec.JoinConfiguration != nil && config.Spec.JoinConfiguration.Discovery.BootstrapToken != nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diagnostics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+type fakeLockInspector map[string]string
+
+func (f fakeLockInspector) Holder(_ context.Context, cluster *clusterv1.Cluster) (string, error) {
+	return f[cluster.Name], nil
+}
+
+func newMachineWithConfig(cluster *clusterv1.Cluster, name string, ready, joined bool, join *bootstrapv1.KubeadmConfig) []runtime.Object {
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      name,
+			Labels:    map[string]string{clusterv1.MachineClusterLabelName: cluster.Name},
+		},
+		Spec: clusterv1.MachineSpec{
+			Bootstrap: clusterv1.Bootstrap{
+				ConfigRef: &corev1.ObjectReference{Kind: "KubeadmConfig", Name: name},
+			},
+		},
+	}
+	if joined {
+		machine.Status.NodeRef = &corev1.ObjectReference{Name: name}
+	}
+	config := join
+	if config == nil {
+		config = &bootstrapv1.KubeadmConfig{}
+	}
+	config.ObjectMeta = metav1.ObjectMeta{Namespace: cluster.Namespace, Name: name}
+	config.Status.Ready = ready
+	return []runtime.Object{machine, config}
+}
+
+func TestSummarize(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := bootstrapv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}}
+	other := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "cluster"}}
+	tokenJoin := func() *bootstrapv1.KubeadmConfig {
+		return &bootstrapv1.KubeadmConfig{
+			Spec: bootstrapv1.KubeadmConfigSpec{
+				JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+					Discovery: kubeadmv1beta1.Discovery{
+						BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{Token: "abcdef.0123456789abcdef"},
+					},
+				},
+			},
+		}
+	}
+
+	objects := []runtime.Object{cluster, other}
+	objects = append(objects, newMachineWithConfig(cluster, "init", true, true, nil)...)
+	objects = append(objects, newMachineWithConfig(cluster, "pending", false, false, nil)...)
+	objects = append(objects, newMachineWithConfig(cluster, "joining", true, false, tokenJoin())...)
+	objects = append(objects, newMachineWithConfig(cluster, "joined", true, true, tokenJoin())...)
+
+	certificates := internalcluster.NewCertificatesForInitialControlPlane(&kubeadmv1beta1.ClusterConfiguration{})
+	if err := certificates.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	owner := &bootstrapv1.KubeadmConfig{}
+	for _, certificate := range certificates {
+		objects = append(objects, certsecret.New(cluster, owner, certificate))
+	}
+
+	s := &Server{
+		Client:        fake.NewFakeClientWithScheme(scheme, objects...),
+		LockInspector: fakeLockInspector{"cluster": "init"},
+		Log:           log.Log,
+	}
+
+	summaries, err := s.Summarize(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("expected 1 summary, got %d", len(summaries))
+	}
+	summary := summaries[0]
+	if summary.InitLockHolder != "init" {
+		t.Errorf("expected init lock holder %q, got %q", "init", summary.InitLockHolder)
+	}
+	if summary.ConfigsPending != 1 {
+		t.Errorf("expected 1 pending config, got %d", summary.ConfigsPending)
+	}
+	if summary.ConfigsReady != 3 {
+		t.Errorf("expected 3 ready configs, got %d", summary.ConfigsReady)
+	}
+	if summary.TokensOutstanding != 1 {
+		t.Errorf("expected 1 outstanding token, got %d", summary.TokensOutstanding)
+	}
+	if len(summary.Errors) != 0 {
+		t.Errorf("expected no errors, got %v", summary.Errors)
+	}
+	for _, purpose := range []internalcluster.Purpose{internalcluster.ClusterCA, internalcluster.EtcdCA, internalcluster.FrontProxyCA} {
+		if summary.CertificateExpiry[string(purpose)].IsZero() {
+			t.Errorf("expected an expiry for the %s certificate", purpose)
+		}
+	}
+	if _, ok := summary.CertificateExpiry[string(internalcluster.ServiceAccount)]; ok {
+		t.Errorf("did not expect an expiry for the service account key pair")
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	all := []ClusterSummary{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected 2 summaries across all namespaces, got %d", len(all))
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package envelope implements the envelope encryption of bootstrap data: the data is encrypted with a data key,
+// which is itself encrypted, or wrapped, with a key encryption key kept outside of the management cluster.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Algorithm identifies the encryption of the data and of the data keys: AES-GCM, with the random nonce
+	// prepended to the ciphertext.
+	Algorithm = "aes-gcm"
+
+	// DataKeySize is the size of the generated data keys, selecting AES-256.
+	DataKeySize = 32
+)
+
+// KeyWrapper encrypts and decrypts data keys with a key encryption key, e.g. held by a KMS.
+type KeyWrapper interface {
+	// KeyID identifies the key encryption key, so that data keys wrapped with another key can be detected.
+	KeyID() string
+	// WrapKey encrypts a data key.
+	WrapKey(dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key.
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// AESKeyWrapper wraps data keys with a local AES key encryption key.
+type AESKeyWrapper struct {
+	key []byte
+	id  string
+}
+
+var _ KeyWrapper = &AESKeyWrapper{}
+
+// NewAESKeyWrapper returns a KeyWrapper using the given 16, 24 or 32 bytes AES key.
+func NewAESKeyWrapper(key []byte) (*AESKeyWrapper, error) {
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, errors.Wrap(err, "invalid key encryption key")
+	}
+	sum := sha256.Sum256(key)
+	return &AESKeyWrapper{key: key, id: hex.EncodeToString(sum[:8])}, nil
+}
+
+// KeyID returns a fingerprint of the key encryption key.
+func (w *AESKeyWrapper) KeyID() string {
+	return w.id
+}
+
+// WrapKey encrypts the data key with the key encryption key.
+func (w *AESKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	return Seal(w.key, dataKey)
+}
+
+// UnwrapKey decrypts the data key with the key encryption key.
+func (w *AESKeyWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return Open(w.key, wrapped)
+}
+
+// NewDataKey returns a random data key.
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Wrap(err, "failed to generate data key")
+	}
+	return key, nil
+}
+
+// Seal encrypts the plaintext with AES-GCM and returns the random nonce followed by the ciphertext.
+func Seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts data encrypted by Seal.
+func Open(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt data")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid AES key")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create AES-GCM cipher")
+	}
+	return gcm, nil
+}
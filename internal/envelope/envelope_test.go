@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envelope
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	wrapper, err := NewAESKeyWrapper(bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped, err := wrapper.WrapKey(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(wrapped, dataKey) {
+		t.Error("expected the data key to be encrypted")
+	}
+	unwrapped, err := wrapper.UnwrapKey(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Error("expected the unwrapped data key to match the data key")
+	}
+
+	encrypted, err := Seal(dataKey, []byte("bootstrap data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := Open(unwrapped, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != "bootstrap data" {
+		t.Errorf("expected the decrypted data to match, got %q", decrypted)
+	}
+
+	other, err := NewAESKeyWrapper(bytes.Repeat([]byte("o"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.KeyID() == wrapper.KeyID() {
+		t.Error("expected different keys to have different IDs")
+	}
+	if _, err := other.UnwrapKey(wrapped); err == nil {
+		t.Error("expected unwrapping with another key to fail")
+	}
+	if _, err := NewAESKeyWrapper([]byte("short")); err == nil {
+		t.Error("expected an invalid key size to be rejected")
+	}
+}
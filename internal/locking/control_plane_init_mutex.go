@@ -124,6 +124,27 @@ func (c *ControlPlaneInitMutex) Unlock(ctx context.Context, cluster *clusterv1.C
 	}
 }
 
+// Holder returns the name of the machine holding the lock, or an empty string if the lock is not held.
+func (c *ControlPlaneInitMutex) Holder(ctx context.Context, cluster *clusterv1.Cluster) (string, error) {
+	sema := newSemaphore()
+	err := c.client.Get(ctx, client.ObjectKey{
+		Namespace: cluster.Namespace,
+		Name:      configMapName(cluster.Name),
+	}, sema.ConfigMap)
+	switch {
+	case apierrors.IsNotFound(err):
+		return "", nil
+	case err != nil:
+		return "", errors.Wrap(err, "failed to get the control plane init lock")
+	}
+
+	info, err := sema.information()
+	if err != nil {
+		return "", err
+	}
+	return info.MachineName, nil
+}
+
 type information struct {
 	MachineName string `json:"machineName"`
 }
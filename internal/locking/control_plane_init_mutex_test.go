@@ -278,6 +278,80 @@ func TestInfoLines_Lock(t *testing.T) {
 	}
 }
 
+func TestControlPlaneInitMutex_Holder(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(information{MachineName: "my-control-plane"})
+	if err != nil {
+		t.Fatal("failed to marshal info")
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName(clusterName),
+			Namespace: clusterNamespace,
+		},
+		Data: map[string]string{semaphoreInformationKey: string(b)},
+	}
+	tests := []struct {
+		name        string
+		client      client.Client
+		expected    string
+		expectError bool
+	}{
+		{
+			name: "should return the machine holding the lock",
+			client: &fakeClient{
+				Client: fake.NewFakeClientWithScheme(scheme, configMap),
+			},
+			expected: "my-control-plane",
+		},
+		{
+			name: "should return an empty name if the lock is not held",
+			client: &fakeClient{
+				Client: fake.NewFakeClientWithScheme(scheme),
+			},
+		},
+		{
+			name: "should return an error if the config map cannot be read",
+			client: &fakeClient{
+				Client:   fake.NewFakeClientWithScheme(scheme),
+				getError: errors.New("get error"),
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			l := &ControlPlaneInitMutex{
+				log:    log.Log,
+				client: tc.client,
+			}
+
+			cluster := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: clusterNamespace,
+					Name:      clusterName,
+				},
+			}
+
+			holder, err := l.Holder(context.Background(), cluster)
+			if tc.expectError != (err != nil) {
+				t.Fatalf("expected error: %v, got: %v", tc.expectError, err)
+			}
+			if holder != tc.expected {
+				t.Fatalf("holder was %q, but it should be %q", holder, tc.expected)
+			}
+		})
+	}
+}
+
 type fakeClient struct {
 	client.Client
 	getError    error
@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rbac generates the namespaced Roles of the controller, for management clusters that do not grant it
+// cluster-wide access to secrets.
+package rbac
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultRoleName is the name of the generated Roles and RoleBindings.
+const DefaultRoleName = "cabpk-manager-role"
+
+var allVerbs = []string{"create", "delete", "get", "list", "patch", "update", "watch"}
+
+// ManagerRules are the rules of the manager ClusterRole of config/rbac/role.yaml, which the controller needs in every
+// namespace it watches.
+var ManagerRules = []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"configmaps", "events", "secrets"},
+		Verbs:     allVerbs,
+	},
+	{
+		APIGroups: []string{"bootstrap.cluster.x-k8s.io"},
+		Resources: []string{"kubeadmconfigs", "kubeadmconfigs/status"},
+		Verbs:     allVerbs,
+	},
+	{
+		APIGroups: []string{"bootstrap.cluster.x-k8s.io"},
+		Resources: []string{"kubeadmconfigtemplates"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"cluster.x-k8s.io"},
+		Resources: []string{"clusters", "clusters/status", "machinedeployments", "machines", "machines/status", "machinesets"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+}
+
+// ParseNamespaces parses a comma separated list of namespaces, dropping duplicates.
+func ParseNamespaces(s string) ([]string, error) {
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, ns := range strings.Split(s, ",") {
+		ns = strings.TrimSpace(ns)
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return nil, errors.Errorf("invalid namespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+		if !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces, nil
+}
+
+// NamespacedManifests returns the YAML manifests of a Role with the ManagerRules and of a RoleBinding granting it to
+// the service account, both with the given name, for each namespace.
+func NamespacedManifests(namespaces []string, serviceAccount types.NamespacedName, name string) ([]byte, error) {
+	if len(namespaces) == 0 {
+		return nil, errors.New("at least one namespace is required")
+	}
+	if serviceAccount.Namespace == "" || serviceAccount.Name == "" {
+		return nil, errors.New("the namespace and name of the service account are required")
+	}
+
+	var out bytes.Buffer
+	for _, ns := range namespaces {
+		role := &rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Rules:      ManagerRules,
+		}
+		binding := &rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+			Subjects: []rbacv1.Subject{
+				{Kind: rbacv1.ServiceAccountKind, Namespace: serviceAccount.Namespace, Name: serviceAccount.Name},
+			},
+		}
+		for _, obj := range []interface{}{role, binding} {
+			data, err := yaml.Marshal(obj)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to marshal the RBAC manifests of namespace %s", ns)
+			}
+			out.WriteString("---\n")
+			out.Write(data)
+		}
+	}
+	return out.Bytes(), nil
+}
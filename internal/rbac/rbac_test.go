@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbac
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+func TestManagerRulesMatchClusterRole(t *testing.T) {
+	data, err := ioutil.ReadFile("../../config/rbac/role.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role := &rbacv1.ClusterRole{}
+	if err := yaml.Unmarshal(data, role); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(role.Rules, ManagerRules) {
+		t.Errorf("expected the manager rules to match config/rbac/role.yaml, got %v", role.Rules)
+	}
+}
+
+func TestParseNamespaces(t *testing.T) {
+	namespaces, err := ParseNamespaces("team-a, team-b,team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(namespaces, []string{"team-a", "team-b"}) {
+		t.Errorf("expected the namespaces without duplicates, got %v", namespaces)
+	}
+	for _, s := range []string{"", "team-a,", "Team_A"} {
+		if _, err := ParseNamespaces(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestNamespacedManifests(t *testing.T) {
+	serviceAccount := types.NamespacedName{Namespace: "cabpk-system", Name: "default"}
+	out, err := NamespacedManifests([]string{"team-a", "team-b"}, serviceAccount, DefaultRoleName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := strings.Split(strings.TrimPrefix(string(out), "---\n"), "---\n")
+	if len(docs) != 4 {
+		t.Fatalf("expected a Role and a RoleBinding per namespace, got %d documents", len(docs))
+	}
+	for i, ns := range []string{"team-a", "team-b"} {
+		role := &rbacv1.Role{}
+		if err := yaml.UnmarshalStrict([]byte(docs[2*i]), role); err != nil {
+			t.Fatal(err)
+		}
+		if role.Kind != "Role" || role.Namespace != ns || !reflect.DeepEqual(role.Rules, ManagerRules) {
+			t.Errorf("expected a Role with the manager rules in %s, got %+v", ns, role)
+		}
+		binding := &rbacv1.RoleBinding{}
+		if err := yaml.UnmarshalStrict([]byte(docs[2*i+1]), binding); err != nil {
+			t.Fatal(err)
+		}
+		if binding.Kind != "RoleBinding" || binding.Namespace != ns || binding.RoleRef.Name != DefaultRoleName ||
+			len(binding.Subjects) != 1 || binding.Subjects[0].Namespace != "cabpk-system" || binding.Subjects[0].Name != "default" {
+			t.Errorf("expected a RoleBinding to the service account in %s, got %+v", ns, binding)
+		}
+	}
+
+	if _, err := NamespacedManifests(nil, serviceAccount, DefaultRoleName); err == nil {
+		t.Error("expected an error without namespaces")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package signing implements the signing of bootstrap data: the SHA-256 digest of the data is signed with a controller
+// key, and the signature is embedded as a trailing comment line, so that machines can verify the data with the public
+// key, e.g. with openssl dgst -sha256 -verify.
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// SignatureLinePrefix prefixes the base64 encoded signature embedded as the last line of signed data. The line is a
+// comment in cloud-config documents and shell scripts.
+const SignatureLinePrefix = "# bootstrap-data-signature: "
+
+// ParsePrivateKey returns the signer of a PEM encoded ECDSA or RSA private key, in PKCS#1, SEC 1 or PKCS#8 form.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *ecdsa.PrivateKey:
+			return key, nil
+		case *rsa.PrivateKey:
+			return key, nil
+		}
+		return nil, errors.Errorf("unsupported private key type %T", key)
+	}
+	return nil, errors.Errorf("unsupported PEM block type %q", block.Type)
+}
+
+// KeyID returns a fingerprint of the public key, so that the key a signature was made with can be identified.
+func KeyID(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal public key")
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// Sign returns the signature of the SHA-256 digest of the data: ASN.1 encoded for ECDSA keys, PKCS#1 v1.5 for RSA keys.
+func Sign(signer crypto.Signer, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign data")
+	}
+	return signature, nil
+}
+
+// SignEmbedded signs the data, terminated by a newline, and returns it followed by the signature line, along with the
+// signature.
+func SignEmbedded(signer crypto.Signer, data []byte) ([]byte, []byte, error) {
+	payload := data
+	if len(payload) == 0 || payload[len(payload)-1] != '\n' {
+		payload = append(append([]byte{}, data...), '\n')
+	}
+	signature, err := Sign(signer, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	signed := append(append([]byte{}, payload...), SignatureLinePrefix+base64.StdEncoding.EncodeToString(signature)+"\n"...)
+	return signed, signature, nil
+}
+
+// VerifyEmbedded verifies the signature line of data signed by SignEmbedded with the public key.
+func VerifyEmbedded(publicKey crypto.PublicKey, signed []byte) error {
+	i := bytes.LastIndex(signed, []byte("\n"+SignatureLinePrefix))
+	if i < 0 {
+		return errors.New("no embedded signature found")
+	}
+	payload := signed[:i+1]
+	signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signed[i+1+len(SignatureLinePrefix):])))
+	if err != nil {
+		return errors.Wrap(err, "invalid embedded signature")
+	}
+	return Verify(publicKey, payload, signature)
+}
+
+// Verify verifies the signature of the data made by Sign with the public key.
+func Verify(publicKey crypto.PublicKey, data, signature []byte) error {
+	digest := sha256.Sum256(data)
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		var sig struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+			return errors.Wrap(err, "invalid ECDSA signature")
+		}
+		if !ecdsa.Verify(key, digest[:], sig.R, sig.S) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return errors.Errorf("unsupported public key type %T", publicKey)
+}
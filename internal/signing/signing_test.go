@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signing
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestSigning(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, keyPEM := range map[string][]byte{
+		"ecdsa": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}),
+		"rsa":   pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			signer, err := ParsePrivateKey(keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signed, signature, err := SignEmbedded(signer, []byte("#cloud-config\nruncmd: []"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(signed, []byte("#cloud-config\nruncmd: []\n"+SignatureLinePrefix)) || !bytes.HasSuffix(signed, []byte("\n")) {
+				t.Errorf("expected the signature line to follow the data, got %q", signed)
+			}
+			if err := Verify(signer.Public(), []byte("#cloud-config\nruncmd: []\n"), signature); err != nil {
+				t.Errorf("expected the signature to be valid, got %v", err)
+			}
+			if err := VerifyEmbedded(signer.Public(), signed); err != nil {
+				t.Errorf("expected the embedded signature to be valid, got %v", err)
+			}
+
+			tampered := bytes.Replace(signed, []byte("[]"), []byte("[reboot]"), 1)
+			if err := VerifyEmbedded(signer.Public(), tampered); err == nil {
+				t.Error("expected tampered data to fail verification")
+			}
+		})
+	}
+
+	if _, err := ParsePrivateKey([]byte("not a key")); err == nil {
+		t.Error("expected an error for data without private key")
+	}
+	ecID, err := KeyID(ecKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaID, err := KeyID(rsaKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ecID == rsaID {
+		t.Error("expected different keys to have different IDs")
+	}
+}
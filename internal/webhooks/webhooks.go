@@ -0,0 +1,95 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhooks registers the validating webhooks of the bootstrap API types with the manager. It is kept out of
+// the API package, so that the API types and their validation do not depend on controller-runtime.
+package webhooks
+
+import (
+	"context"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-bootstrap-cluster-x-k8s-io-v1alpha2-kubeadmconfig,mutating=false,failurePolicy=fail,groups=bootstrap.cluster.x-k8s.io,resources=kubeadmconfigs,versions=v1alpha2,name=validation.kubeadmconfig.bootstrap.cluster.x-k8s.io
+// +kubebuilder:webhook:verbs=create;update,path=/validate-bootstrap-cluster-x-k8s-io-v1alpha2-kubeadmconfigtemplate,mutating=false,failurePolicy=fail,groups=bootstrap.cluster.x-k8s.io,resources=kubeadmconfigtemplates,versions=v1alpha2,name=validation.kubeadmconfigtemplate.bootstrap.cluster.x-k8s.io
+
+var _ webhook.Validator = &bootstrapv1.KubeadmConfig{}
+var _ webhook.Validator = &bootstrapv1.KubeadmConfigTemplate{}
+
+// SetupKubeadmConfigWebhookWithManager registers the validating webhook of KubeadmConfigs, which also rejects the
+// unknown fields of their kubeadm configurations.
+func SetupKubeadmConfigWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register("/validate-bootstrap-cluster-x-k8s-io-v1alpha2-kubeadmconfig", &webhook.Admission{
+		Handler: &strictValidatingHandler{
+			Handler:   admission.ValidatingWebhookFor(&bootstrapv1.KubeadmConfig{}).Handler,
+			groupKind: bootstrapv1.GroupVersion.WithKind("KubeadmConfig").GroupKind(),
+			specPath:  []string{"spec"},
+		},
+	})
+	return nil
+}
+
+// SetupKubeadmConfigTemplateWebhookWithManager registers the validating webhook of KubeadmConfigTemplates, which also
+// rejects the unknown fields of their kubeadm configurations.
+func SetupKubeadmConfigTemplateWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register("/validate-bootstrap-cluster-x-k8s-io-v1alpha2-kubeadmconfigtemplate", &webhook.Admission{
+		Handler: &strictValidatingHandler{
+			Handler:   admission.ValidatingWebhookFor(&bootstrapv1.KubeadmConfigTemplate{}).Handler,
+			groupKind: bootstrapv1.GroupVersion.WithKind("KubeadmConfigTemplate").GroupKind(),
+			specPath:  []string{"spec", "template", "spec"},
+		},
+	})
+	return nil
+}
+
+// strictValidatingHandler rejects the objects whose kubeadm configurations do not decode strictly, before validating
+// them with the validating handler of their type.
+type strictValidatingHandler struct {
+	admission.Handler
+	groupKind schema.GroupKind
+	specPath  []string
+}
+
+// Handle implements admission.Handler.
+func (h *strictValidatingHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	path := field.NewPath(h.specPath[0], h.specPath[1:]...)
+	var allErrs field.ErrorList
+	switch req.Operation {
+	case admissionv1beta1.Create:
+		allErrs = bootstrapv1.ValidateStrictDecoding(req.Object.Raw, path, h.specPath...)
+	case admissionv1beta1.Update:
+		// unknown fields stored before the webhook was enabled must not block the updates of the object
+		allErrs = bootstrapv1.ValidateStrictDecodingUpdate(req.Object.Raw, req.OldObject.Raw, path, h.specPath...)
+	}
+	if len(allErrs) > 0 {
+		return admission.Denied(apierrors.NewInvalid(h.groupKind, req.Name, allErrs).Error())
+	}
+	return h.Handler.Handle(ctx, req)
+}
+
+// InjectDecoder injects the decoder into the validating handler of the type.
+func (h *strictValidatingHandler) InjectDecoder(d *admission.Decoder) error {
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
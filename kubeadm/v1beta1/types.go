@@ -388,7 +388,13 @@ type Discovery struct {
 type BootstrapTokenDiscovery struct {
 	// Token is a token used to validate cluster information
 	// fetched from the control-plane.
-	Token string `json:"token"`
+	// +optional
+	Token string `json:"token,omitempty"`
+
+	// TokenFrom references the source of the token, so that its value is not stored in the configuration.
+	// Token and TokenFrom are mutually exclusive.
+	// +optional
+	TokenFrom *BootstrapTokenSource `json:"tokenFrom,omitempty"`
 
 	// APIServerEndpoint is an IP or domain name to the API server from which info will be fetched.
 	APIServerEndpoint string `json:"apiServerEndpoint,omitempty"`
@@ -409,6 +415,12 @@ type BootstrapTokenDiscovery struct {
 	UnsafeSkipCAVerification bool `json:"unsafeSkipCAVerification"`
 }
 
+// BootstrapTokenSource is the source of a bootstrap token.
+type BootstrapTokenSource struct {
+	// SecretKeyRef selects a key of a secret in the namespace of the configuration holding the token.
+	SecretKeyRef *v1.SecretKeySelector `json:"secretKeyRef"`
+}
+
 // FileDiscovery is used to specify a file or URL to a kubeconfig file from which to load cluster information
 type FileDiscovery struct {
 	// KubeConfigPath is used to specify the actual file path or URL to the kubeconfig file from which to load cluster information
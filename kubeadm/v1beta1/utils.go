@@ -18,22 +18,18 @@ package v1beta1
 
 import (
 	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
-	"sigs.k8s.io/controller-runtime/pkg/scheme"
 )
 
 // GetCodecs returns a type that can be used to deserialize most kubeadm
 // configuration types.
 func GetCodecs() serializer.CodecFactory {
-	sb := &scheme.Builder{GroupVersion: GroupVersion}
-
-	sb.Register(&JoinConfiguration{}, &InitConfiguration{}, &ClusterConfiguration{})
-	kubeadmScheme, err := sb.Build()
-	if err != nil {
-		panic(err)
-	}
+	kubeadmScheme := runtime.NewScheme()
+	kubeadmScheme.AddKnownTypes(GroupVersion, &JoinConfiguration{}, &InitConfiguration{}, &ClusterConfiguration{})
+	metav1.AddToGroupVersion(kubeadmScheme, GroupVersion)
 	return serializer.NewCodecFactory(kubeadmScheme)
 }
 
@@ -112,6 +112,11 @@ func (in *BootstrapToken) DeepCopy() *BootstrapToken {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BootstrapTokenDiscovery) DeepCopyInto(out *BootstrapTokenDiscovery) {
 	*out = *in
+	if in.TokenFrom != nil {
+		in, out := &in.TokenFrom, &out.TokenFrom
+		*out = new(BootstrapTokenSource)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.CACertHashes != nil {
 		in, out := &in.CACertHashes, &out.CACertHashes
 		*out = make([]string, len(*in))
@@ -130,6 +135,27 @@ func (in *BootstrapTokenDiscovery) DeepCopy() *BootstrapTokenDiscovery {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BootstrapTokenSource) DeepCopyInto(out *BootstrapTokenSource) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BootstrapTokenSource.
+func (in *BootstrapTokenSource) DeepCopy() *BootstrapTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(BootstrapTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BootstrapTokenString) DeepCopyInto(out *BootstrapTokenString) {
 	*out = *in
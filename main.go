@@ -17,22 +17,39 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"crypto"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"k8s.io/klog"
 	"k8s.io/klog/klogr"
 	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
 	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/controllers"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/feature"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/certsecret"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/diagnostics"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/envelope"
 	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/locking"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/rbac"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/signing"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/webhooks"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -49,6 +66,17 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case mintKubeconfigCommand:
+			os.Exit(mintKubeconfig(os.Args[2:]))
+		case signSSHKeyCommand:
+			os.Exit(signSSHKey(os.Args[2:]))
+		case rbacManifestsCommand:
+			os.Exit(rbacManifests(os.Args[2:]))
+		}
+	}
+
 	klog.InitFlags(nil)
 
 	var (
@@ -56,7 +84,34 @@ func main() {
 		enableLeaderElection bool
 		syncPeriod           time.Duration
 		watchNamespace       string
+		watchNamespaces      string
+		allowedPKINamespaces string
 		profilerAddress      string
+		disableLegacyData    bool
+		compressLegacyData   bool
+		diagnosticsAddress   string
+		enableCertSigner     bool
+		pregenerateCerts     bool
+		kubeconfigInterval   time.Duration
+		tokenSweepInterval   time.Duration
+		execCommands         string
+		regenerateOutOfDate  bool
+		requireCACertHashes  bool
+		scopedSecretsClient  bool
+		inlineFilesBudget    int
+		webhookPort          int
+		encryptionKeyFile    string
+		signingKeyFile       string
+		verifySignature      bool
+		reconcileTimeout     time.Duration
+		controllerConfigMap  string
+		concurrency          int
+		kubeAPIQPS           float64
+		kubeAPIBurst         int
+		workloadAPIQPS       float64
+		cacheMetricsInterval time.Duration
+		execTokenCommand     string
+		execTokenArgs        string
 	)
 
 	flag.StringVar(
@@ -94,6 +149,27 @@ func main() {
 		"Namespace that the controller watches to reconcile cluster-api objects. If unspecified, the controller watches for cluster-api objects across all namespaces.",
 	)
 
+	flag.StringVar(
+		&watchNamespaces,
+		"namespaces",
+		"",
+		"Comma separated list of the namespaces that the controller watches, so that it only requires the namespaced Roles printed by the "+rbacManifestsCommand+" command instead of the cluster-wide manager role. Mutually exclusive with --namespace. The PKI namespaces and the namespace of the controller config map must be listed.",
+	)
+
+	flag.StringVar(
+		&certsecret.DefaultPKINamespace,
+		"pki-namespace",
+		"",
+		"Namespace the certificate secrets of clusters are stored in, unless overridden by the "+certsecret.PKINamespaceAnnotation+" annotation of the Cluster. If unspecified, they are stored in the Cluster namespace. Requires watching all namespaces.",
+	)
+
+	flag.StringVar(
+		&allowedPKINamespaces,
+		"allowed-pki-namespaces",
+		"",
+		"Comma separated list of the namespaces the "+certsecret.PKINamespaceAnnotation+" annotation of Clusters may select. The annotation is ignored for any other namespace.",
+	)
+
 	flag.StringVar(
 		&profilerAddress,
 		"profiler-address",
@@ -101,6 +177,194 @@ func main() {
 		"Bind address to expose the pprof profiler (e.g. localhost:6060)",
 	)
 
+	flag.BoolVar(
+		&disableLegacyData,
+		"disable-legacy-bootstrap-data",
+		false,
+		"Disable storing bootstrap data in KubeadmConfig.Status.BootstrapData. Only enable this if the Machine controller consumes Status.DataSecretName.",
+	)
+
+	flag.BoolVar(
+		&compressLegacyData,
+		"compress-legacy-bootstrap-data",
+		false,
+		"Compress the bootstrap data in the cloud-config format stored in KubeadmConfig.Status.BootstrapData with gzip. Only enable this if the user data of the machines is decompressed, e.g. by cloud-init. Mutually exclusive with --bootstrap-data-signature-verifier.",
+	)
+
+	flag.StringVar(
+		&diagnosticsAddress,
+		"diagnostics-address",
+		"",
+		"Bind address to expose a per-cluster bootstrap state summary on /bootstrap-status (e.g. localhost:9440)",
+	)
+
+	flag.BoolVar(
+		&enableCertSigner,
+		"enable-certificate-signer",
+		false,
+		"Sign certificate request secrets with the workload cluster certificate authorities. Anyone able to create secrets in a cluster namespace can obtain certificates for that cluster.",
+	)
+
+	flag.BoolVar(
+		&pregenerateCerts,
+		"pregenerate-certificates",
+		false,
+		"Generate the cluster CA, front proxy CA and service account keys of clusters as soon as their infrastructure is ready, instead of when the bootstrap data of their first control plane machine is generated. User supplied certificates must be created before the infrastructure is ready.",
+	)
+
+	flag.DurationVar(
+		&kubeconfigInterval,
+		"kubeconfig-check-interval",
+		0,
+		"The interval at which cluster kubeconfig secrets are validated and regenerated if invalid (e.g. 10m). Disabled if zero.",
+	)
+
+	flag.DurationVar(
+		&reconcileTimeout,
+		"reconcile-timeout",
+		controllers.DefaultReconcileTimeout,
+		"The deadline of a reconciliation, after which pending calls to the management and workload clusters are cancelled (e.g. 2m).",
+	)
+
+	flag.IntVar(
+		&concurrency,
+		"kubeadmconfig-concurrency",
+		10,
+		"The number of KubeadmConfigs reconciled in parallel. The KubeadmConfigs of a cluster are always reconciled one at a time.",
+	)
+
+	flag.Float64Var(
+		&kubeAPIQPS,
+		"kube-api-qps",
+		20,
+		"The maximum number of queries per second sent to the management cluster, shared by all the clients of the controller.",
+	)
+
+	flag.IntVar(
+		&kubeAPIBurst,
+		"kube-api-burst",
+		30,
+		"The maximum burst of queries sent to the management cluster.",
+	)
+
+	flag.Float64Var(
+		&workloadAPIQPS,
+		"workload-cluster-api-qps",
+		float64(controllers.WorkloadClusterQPS),
+		"The maximum number of queries per second sent to a workload cluster during a reconciliation.",
+	)
+
+	flag.IntVar(
+		&controllers.WorkloadClusterBurst,
+		"workload-cluster-api-burst",
+		controllers.WorkloadClusterBurst,
+		"The maximum burst of queries sent to a workload cluster during a reconciliation.",
+	)
+
+	flag.DurationVar(
+		&cacheMetricsInterval,
+		"cache-metrics-interval",
+		controllers.DefaultCacheMetricsInterval,
+		"The interval at which the number of cached objects and the size of the cached secrets are recorded in the metrics. Disabled if zero.",
+	)
+
+	flag.DurationVar(
+		&tokenSweepInterval,
+		"bootstrap-token-sweep-interval",
+		10*time.Minute,
+		"The interval at which expired or orphaned bootstrap tokens are removed from workload clusters. Disabled if zero.",
+	)
+
+	flag.StringVar(
+		&execCommands,
+		"workload-auth-exec-commands",
+		"",
+		"Comma separated list of the exec credential plugin commands allowed for clusters using the exec workload cluster auth mode.",
+	)
+
+	flag.BoolVar(
+		&regenerateOutOfDate,
+		"regenerate-out-of-date-bootstrap-data",
+		false,
+		"Render the bootstrap data again when the spec of a KubeadmConfig is changed before its machine is provisioned.",
+	)
+
+	flag.BoolVar(
+		&requireCACertHashes,
+		"require-ca-cert-hashes",
+		false,
+		"Reject the KubeadmConfigs of joining machines whose discovery skips the verification of the cluster CA, for all clusters.",
+	)
+
+	flag.BoolVar(
+		&scopedSecretsClient,
+		"scoped-secrets-client",
+		false,
+		"Manage the bootstrap token secrets of workload clusters accessed with their admin kubeconfig with a short-lived client certificate only allowed to manage the secrets of the kube-system namespace.",
+	)
+
+	flag.IntVar(
+		&inlineFilesBudget,
+		"inline-files-size-budget",
+		0,
+		"The maximum size in bytes of the files written from the bootstrap data. The largest files of joining machines are stored in workload cluster secrets and fetched with the bootstrap token instead. Disabled if zero.",
+	)
+
+	flag.IntVar(
+		&webhookPort,
+		"webhook-port",
+		0,
+		"The port the validating webhook server binds to. Disabled if zero.",
+	)
+
+	flag.StringVar(
+		&encryptionKeyFile,
+		"bootstrap-data-encryption-key-file",
+		"",
+		"Path to a 16, 24 or 32 bytes AES key encrypting the per cluster keys used for the envelope encryption of bootstrap data secrets. Requires --disable-legacy-bootstrap-data.",
+	)
+
+	flag.StringVar(
+		&signingKeyFile,
+		"bootstrap-data-signing-key-file",
+		"",
+		"Path to a PEM encoded ECDSA or RSA private key signing the bootstrap data. The signature is embedded as the last line of cloud-config and join-script bootstrap data, and recorded in the "+controllers.BootstrapDataSignatureAnnotation+" annotation of bootstrap data secrets.",
+	)
+
+	flag.BoolVar(
+		&verifySignature,
+		"bootstrap-data-signature-verifier",
+		false,
+		"Add a boot command verifying the signature of cloud-config bootstrap data to it with the public key baked in the machine image at "+cloudinit.SigningPublicKeyFile+", which stops the bootstrap before kubeadm runs if the key is missing or the signature is invalid. Requires --bootstrap-data-signing-key-file.",
+	)
+
+	flag.StringVar(
+		&controllerConfigMap,
+		"controller-config-map",
+		"",
+		"The namespace/name of a ConfigMap holding, under its "+controllers.ControllerConfigKey+" key, a ControllerConfiguration overriding the requeue interval, bootstrap token TTL, certificate durations and default NTP settings. Changes are applied without restarting the controller. The namespace must be watched.",
+	)
+
+	flag.StringVar(
+		&execTokenCommand,
+		"exec-token-backend-command",
+		"",
+		"The exec credential plugin run on machines of configs using the "+controllers.ExecTokenBackend+" token backend to join instead of bootstrap tokens (e.g. aws-iam-authenticator). The backend is disabled if empty.",
+	)
+
+	flag.StringVar(
+		&execTokenArgs,
+		"exec-token-backend-args",
+		"",
+		"Space separated arguments of the exec credential plugin of the "+controllers.ExecTokenBackend+" token backend; "+controllers.ClusterNamePlaceholder+" is replaced by the name of the cluster (e.g. \"token -i "+controllers.ClusterNamePlaceholder+"\").",
+	)
+
+	flag.Var(
+		feature.Gates,
+		"feature-gates",
+		"A set of key=value pairs that describe feature gates for experimental features. Options are:\n"+strings.Join(feature.Gates.KnownFeatures(), "\n"),
+	)
+
 	flag.Parse()
 
 	ctrl.SetLogger(klogr.New())
@@ -116,33 +380,458 @@ func main() {
 		setupLog.Info("warning: the sync interval is close to the configured token TTL, tokens may expire temporarily before being refreshed")
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	var keyWrapper envelope.KeyWrapper
+	if encryptionKeyFile != "" {
+		if !disableLegacyData {
+			setupLog.Error(errors.New("--bootstrap-data-encryption-key-file requires --disable-legacy-bootstrap-data"), "invalid flags")
+			os.Exit(1)
+		}
+		key, err := ioutil.ReadFile(encryptionKeyFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read bootstrap data encryption key")
+			os.Exit(1)
+		}
+		aesKeyWrapper, err := envelope.NewAESKeyWrapper(key)
+		if err != nil {
+			setupLog.Error(err, "invalid bootstrap data encryption key")
+			os.Exit(1)
+		}
+		keyWrapper = aesKeyWrapper
+	}
+
+	var signer crypto.Signer
+	if err := validateSignatureVerifierFlags(verifySignature, signingKeyFile, compressLegacyData); err != nil {
+		setupLog.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+	if signingKeyFile != "" {
+		key, err := ioutil.ReadFile(signingKeyFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read bootstrap data signing key")
+			os.Exit(1)
+		}
+		signer, err = signing.ParsePrivateKey(key)
+		if err != nil {
+			setupLog.Error(err, "invalid bootstrap data signing key")
+			os.Exit(1)
+		}
+	}
+
+	if allowedPKINamespaces != "" {
+		namespaces, err := rbac.ParseNamespaces(allowedPKINamespaces)
+		if err != nil {
+			setupLog.Error(err, "invalid --allowed-pki-namespaces flag")
+			os.Exit(1)
+		}
+		certsecret.AllowedPKINamespaces = namespaces
+	}
+
+	var newCache cache.NewCacheFunc
+	if watchNamespaces != "" {
+		namespaces, err := validateWatchNamespaces(watchNamespaces, watchNamespace, controllerConfigMap)
+		if err != nil {
+			setupLog.Error(err, "invalid --namespaces flag")
+			os.Exit(1)
+		}
+		newCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+
+	controllers.WorkloadClusterQPS = float32(workloadAPIQPS)
+	restConfig := ctrl.GetConfigOrDie()
+	controllers.InstrumentRESTConfig(restConfig, controllers.ManagementClusterClient, float32(kubeAPIQPS), kubeAPIBurst)
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		LeaderElection:     enableLeaderElection,
 		LeaderElectionID:   "controller-leader-election-cabpk",
 		Namespace:          watchNamespace,
+		NewCache:           newCache,
 		SyncPeriod:         &syncPeriod,
+		Port:               webhookPort,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	// all the writes of the controllers are attributed to the same field manager
+	mgrClient := controllers.WithFieldManager(mgr.GetClient())
+
+	var allowedExecCommands []string
+	if execCommands != "" {
+		allowedExecCommands = strings.Split(execCommands, ",")
+	}
+
+	tokenProviders := map[string]controllers.TokenProvider{}
+	if execTokenCommand != "" {
+		tokenProviders[controllers.ExecTokenBackend] = controllers.ExecTokenProvider{
+			Command: execTokenCommand,
+			Args:    strings.Fields(execTokenArgs),
+		}
+	}
+
+	if controllerConfigMap != "" {
+		parts := strings.Split(controllerConfigMap, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			setupLog.Error(errors.Errorf("expected namespace/name, got %q", controllerConfigMap), "invalid --controller-config-map flag")
+			os.Exit(1)
+		}
+		if err := (&controllers.ControllerConfigReconciler{
+			Client:    mgrClient,
+			Log:       ctrl.Log.WithName("ControllerConfigReconciler"),
+			ConfigMap: types.NamespacedName{Namespace: parts[0], Name: parts[1]},
+			Store:     controllers.Tunables,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ControllerConfigReconciler")
+			os.Exit(1)
+		}
+	}
+
+	initLock := locking.NewControlPlaneInitMutex(ctrl.Log.WithName("init-locker"), mgrClient)
+
 	if err := (&controllers.KubeadmConfigReconciler{
-		Client:               mgr.GetClient(),
-		SecretsClientFactory: controllers.ClusterSecretsClientFactory{},
-		Log:                  ctrl.Log.WithName("KubeadmConfigReconciler"),
-		KubeadmInitLock:      locking.NewControlPlaneInitMutex(ctrl.Log.WithName("init-locker"), mgr.GetClient()),
+		Client:                      mgrClient,
+		SecretsClientFactory:        controllers.ClusterSecretsClientFactory{AllowedExecCommands: allowedExecCommands, Scoped: scopedSecretsClient},
+		RBACClientFactory:           controllers.ClusterRBACClientFactory{AllowedExecCommands: allowedExecCommands},
+		Log:                         ctrl.Log.WithName("KubeadmConfigReconciler"),
+		KubeadmInitLock:             initLock,
+		DisableLegacyBootstrapData:  disableLegacyData,
+		CompressLegacyBootstrapData: compressLegacyData,
+		Recorder:                    mgr.GetEventRecorderFor("kubeadmconfig-controller"),
+
+		RegenerateOutOfDateBootstrapData:  regenerateOutOfDate,
+		RequireCACertHashes:               requireCACertHashes,
+		InlineFilesSizeBudget:             inlineFilesBudget,
+		BootstrapDataKeyWrapper:           keyWrapper,
+		BootstrapDataSigner:               signer,
+		BootstrapDataSignatureVerifier:    verifySignature,
+		ConfigMapsClientFactory:           controllers.ClusterConfigMapsClientFactory{AllowedExecCommands: allowedExecCommands},
+		KubeSystemConfigMapsClientFactory: controllers.ClusterConfigMapsClientFactory{AllowedExecCommands: allowedExecCommands},
+		TokenProviders:                    tokenProviders,
+		ReconcileTimeout:                  reconcileTimeout,
+		MaxConcurrentReconciles:           concurrency,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KubeadmConfigReconciler")
 		os.Exit(1)
 	}
+	if enableCertSigner {
+		if err := (&controllers.CertificateRequestReconciler{
+			Client:   mgrClient,
+			Log:      ctrl.Log.WithName("CertificateRequestReconciler"),
+			Recorder: mgr.GetEventRecorderFor("certificaterequest-controller"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CertificateRequestReconciler")
+			os.Exit(1)
+		}
+	}
+	if pregenerateCerts {
+		if err := (&controllers.CertificatesReconciler{
+			Client: mgrClient,
+			Log:    ctrl.Log.WithName("CertificatesReconciler"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CertificatesReconciler")
+			os.Exit(1)
+		}
+	}
+	if kubeconfigInterval > 0 {
+		if err := (&controllers.KubeconfigReconciler{
+			Client:        mgrClient,
+			Log:           ctrl.Log.WithName("KubeconfigReconciler"),
+			CheckInterval: kubeconfigInterval,
+			Recorder:      mgr.GetEventRecorderFor("kubeconfig-controller"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "KubeconfigReconciler")
+			os.Exit(1)
+		}
+	}
+	if tokenSweepInterval > 0 {
+		if err := (&controllers.TokenSweeperReconciler{
+			Client:               mgrClient,
+			SecretsClientFactory: controllers.ClusterSecretsClientFactory{AllowedExecCommands: allowedExecCommands, Scoped: scopedSecretsClient},
+			RBACClientFactory:    controllers.ClusterRBACClientFactory{AllowedExecCommands: allowedExecCommands},
+			Log:                  ctrl.Log.WithName("TokenSweeperReconciler"),
+			SweepInterval:        tokenSweepInterval,
+			ReconcileTimeout:     reconcileTimeout,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "TokenSweeperReconciler")
+			os.Exit(1)
+		}
+	}
+	if err := (&controllers.TokenPoolReconciler{
+		Client:               mgrClient,
+		SecretsClientFactory: controllers.ClusterSecretsClientFactory{AllowedExecCommands: allowedExecCommands, Scoped: scopedSecretsClient},
+		Log:                  ctrl.Log.WithName("TokenPoolReconciler"),
+		ReconcileTimeout:     reconcileTimeout,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TokenPoolReconciler")
+		os.Exit(1)
+	}
+	if webhookPort != 0 {
+		if err := webhooks.SetupKubeadmConfigWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "KubeadmConfig")
+			os.Exit(1)
+		}
+		if err := webhooks.SetupKubeadmConfigTemplateWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "KubeadmConfigTemplate")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if diagnosticsAddress != "" {
+		if err := mgr.Add(&diagnostics.Server{
+			Client:        mgr.GetClient(),
+			LockInspector: initLock,
+			Log:           ctrl.Log.WithName("diagnostics"),
+			Address:       diagnosticsAddress,
+		}); err != nil {
+			setupLog.Error(err, "unable to add diagnostics server")
+			os.Exit(1)
+		}
+	}
+
+	if cacheMetricsInterval > 0 {
+		if err := mgr.Add(&controllers.CacheMetricsRecorder{
+			Reader:   mgr.GetCache(),
+			Log:      ctrl.Log.WithName("cache-metrics"),
+			Interval: cacheMetricsInterval,
+		}); err != nil {
+			setupLog.Error(err, "unable to add cache metrics recorder")
+			os.Exit(1)
+		}
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+const mintKubeconfigCommand = "mint-kubeconfig"
+
+// mintKubeconfig prints a short-lived admin kubeconfig for a workload cluster, signed with the cluster CA stored in
+// the management cluster the current kubeconfig points to. It returns the exit code of the command.
+func mintKubeconfig(args []string) int {
+	fs := flag.NewFlagSet(mintKubeconfigCommand, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s --cluster <namespace>/<name> --user <name> [--group <group>] [--ttl <duration>]\n", os.Args[0], mintKubeconfigCommand)
+		fs.PrintDefaults()
+	}
+	var (
+		clusterName string
+		user        string
+		groups      string
+		ttl         time.Duration
+	)
+	fs.StringVar(&clusterName, "cluster", "", "The namespace/name of the Cluster to mint a kubeconfig for.")
+	fs.StringVar(&user, "user", "", "The user name the kubeconfig is authenticated as in the workload cluster, recorded in its audit logs.")
+	fs.StringVar(&groups, "group", "", "Comma separated list of the groups the kubeconfig is authenticated with. Defaults to system:masters.")
+	fs.DurationVar(&ttl, "ttl", controllers.DefaultAdminKubeconfigTTL, fmt.Sprintf("The validity of the kubeconfig, at most %s.", controllers.MaxAdminKubeconfigTTL))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	key, err := parseClusterName(clusterName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	opts := controllers.AdminKubeconfigOptions{User: user, TTL: ttl}
+	if groups != "" {
+		opts.Groups = strings.Split(groups, ",")
+	}
+
+	ctx := context.Background()
+	c, cluster, err := getManagedCluster(ctx, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	out, err := controllers.NewAdminKubeconfig(ctx, c, cluster, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to mint kubeconfig: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stdout.Write(out); err != nil {
+		return 1
+	}
+	return 0
+}
+
+const signSSHKeyCommand = "sign-ssh-key"
+
+// signSSHKey prints a short-lived SSH user certificate for a public key, signed with the SSH certificate authority
+// of a workload cluster stored in the management cluster the current kubeconfig points to. It returns the exit code
+// of the command.
+func signSSHKey(args []string) int {
+	fs := flag.NewFlagSet(signSSHKeyCommand, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s --cluster <namespace>/<name> --public-key <file> --key-id <name> --principal <user> [--ttl <duration>]\n", os.Args[0], signSSHKeyCommand)
+		fs.PrintDefaults()
+	}
+	var (
+		clusterName   string
+		publicKeyPath string
+		keyID         string
+		principals    string
+		ttl           time.Duration
+	)
+	fs.StringVar(&clusterName, "cluster", "", "The namespace/name of the Cluster whose machines the certificate logs in to.")
+	fs.StringVar(&publicKeyPath, "public-key", "", "The path of the SSH public key to sign, e.g. ~/.ssh/id_ed25519.pub.")
+	fs.StringVar(&keyID, "key-id", "", "The identity of the certificate, recorded in the sshd logs.")
+	fs.StringVar(&principals, "principal", "", "Comma separated list of the users the certificate can log in as.")
+	fs.DurationVar(&ttl, "ttl", controllers.DefaultSSHUserCertificateTTL, fmt.Sprintf("The validity of the certificate, at most %s.", controllers.MaxSSHUserCertificateTTL))
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	key, err := parseClusterName(clusterName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	publicKey, err := ioutil.ReadFile(publicKeyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read the public key: %v\n", err)
+		return 2
+	}
+	opts := controllers.SSHUserCertificateOptions{PublicKey: publicKey, KeyID: keyID, TTL: ttl}
+	if principals != "" {
+		opts.Principals = strings.Split(principals, ",")
+	}
+
+	ctx := context.Background()
+	c, cluster, err := getManagedCluster(ctx, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	out, err := controllers.SignSSHUserCertificate(ctx, c, cluster, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to sign SSH key: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stdout.Write(out); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// validateSignatureVerifierFlags checks that the signature verifier can verify the user data of the machines: it
+// needs the signing key, and the user data as received by cloud-init must not be compressed.
+func validateSignatureVerifierFlags(verifySignature bool, signingKeyFile string, compressLegacyData bool) error {
+	if !verifySignature {
+		return nil
+	}
+	if signingKeyFile == "" {
+		return errors.New("--bootstrap-data-signature-verifier requires --bootstrap-data-signing-key-file")
+	}
+	if compressLegacyData {
+		return errors.New("--bootstrap-data-signature-verifier and --compress-legacy-bootstrap-data are mutually exclusive")
+	}
+	return nil
+}
+
+// validateWatchNamespaces parses the --namespaces flag, and checks that the namespaces the controller reads from
+// outside of the Cluster namespaces are watched.
+func validateWatchNamespaces(watchNamespaces, watchNamespace, controllerConfigMap string) ([]string, error) {
+	if watchNamespace != "" {
+		return nil, errors.New("--namespace and --namespaces are mutually exclusive")
+	}
+	namespaces, err := rbac.ParseNamespaces(watchNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	watched := func(ns string) bool {
+		for _, n := range namespaces {
+			if n == ns {
+				return true
+			}
+		}
+		return false
+	}
+	if ns := certsecret.DefaultPKINamespace; ns != "" && !watched(ns) {
+		return nil, errors.Errorf("the PKI namespace %s is not watched", ns)
+	}
+	for _, ns := range certsecret.AllowedPKINamespaces {
+		if !watched(ns) {
+			return nil, errors.Errorf("the allowed PKI namespace %s is not watched", ns)
+		}
+	}
+	if controllerConfigMap != "" && !watched(strings.Split(controllerConfigMap, "/")[0]) {
+		return nil, errors.Errorf("the namespace of the controller config map %s is not watched", controllerConfigMap)
+	}
+	return namespaces, nil
+}
+
+const rbacManifestsCommand = "rbac-manifests"
+
+// rbacManifests prints the Roles and RoleBindings granting the service account of the controller the permissions it
+// needs in each of the namespaces it watches, to be applied instead of the cluster-wide manager role. It returns the
+// exit code of the command.
+func rbacManifests(args []string) int {
+	fs := flag.NewFlagSet(rbacManifestsCommand, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s --namespaces <namespace>[,<namespace>...] --service-account <namespace>/<name> [--name <name>]\n", os.Args[0], rbacManifestsCommand)
+		fs.PrintDefaults()
+	}
+	var (
+		namespaces     string
+		serviceAccount string
+		name           string
+	)
+	fs.StringVar(&namespaces, "namespaces", "", "Comma separated list of the namespaces the controller watches, as given to its --namespaces flag.")
+	fs.StringVar(&serviceAccount, "service-account", "cabpk-system/default", "The namespace/name of the service account of the controller.")
+	fs.StringVar(&name, "name", rbac.DefaultRoleName, "The name of the Roles and RoleBindings.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	parsed, err := rbac.ParseNamespaces(namespaces)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	parts := strings.Split(serviceAccount, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		fmt.Fprintf(os.Stderr, "invalid --service-account %q, expected namespace/name\n", serviceAccount)
+		return 2
+	}
+	out, err := rbac.NamespacedManifests(parsed, types.NamespacedName{Namespace: parts[0], Name: parts[1]}, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to generate the RBAC manifests: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stdout.Write(out); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// parseClusterName parses the namespace/name of a Cluster given to the subcommands.
+func parseClusterName(s string) (types.NamespacedName, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, errors.Errorf("invalid --cluster %q, expected namespace/name", s)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// getManagedCluster returns a client of the management cluster the current kubeconfig points to, and the Cluster.
+func getManagedCluster(ctx context.Context, key types.NamespacedName) (client.Client, *clusterv1.Cluster, error) {
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to get the management cluster kubeconfig")
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to create the management cluster client")
+	}
+	cluster := &clusterv1.Cluster{}
+	if err := c.Get(ctx, key, cluster); err != nil {
+		return nil, nil, errors.Wrapf(err, "unable to get cluster %s", key)
+	}
+	return c, cluster, nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "testing"
+
+func TestValidateSignatureVerifierFlags(t *testing.T) {
+	testcases := []struct {
+		name               string
+		verifySignature    bool
+		signingKeyFile     string
+		compressLegacyData bool
+		expectErr          bool
+	}{
+		{
+			name: "no signature verifier",
+		},
+		{
+			name:               "compression without signature verifier",
+			compressLegacyData: true,
+		},
+		{
+			name:            "signature verifier with signing key",
+			verifySignature: true,
+			signingKeyFile:  "/etc/cabpk/signing.key",
+		},
+		{
+			name:            "signature verifier without signing key",
+			verifySignature: true,
+			expectErr:       true,
+		},
+		{
+			name:               "signature verifier with compression",
+			verifySignature:    true,
+			signingKeyFile:     "/etc/cabpk/signing.key",
+			compressLegacyData: true,
+			expectErr:          true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateSignatureVerifierFlags(tc.verifySignature, tc.signingKeyFile, tc.compressLegacyData)
+			if (err != nil) != tc.expectErr {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package standalone generates the bootstrap data of a KubeadmConfig without a management cluster, reading and
+// writing the cluster certificates from a local directory instead of secrets. It is meant for pre-provisioning
+// machines, e.g. in air-gapped environments, and for projects embedding the kubeadm bootstrap logic.
+package standalone
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	"sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/cloudinit"
+	internalcluster "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/internal/cluster"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+// Input is the input of the standalone generation of bootstrap data.
+type Input struct {
+	// Config is the KubeadmConfig to generate the bootstrap data for. It is not modified.
+	Config *bootstrapv1.KubeadmConfig
+
+	// CertificatesDir is the directory holding the cluster certificates, laid out like the kubeadm certificates
+	// directory, e.g. ca.crt and ca.key for the cluster CA. The missing certificates are generated into it for the
+	// first control plane machine, and must exist for joining control plane machines.
+	CertificatesDir string
+
+	// ClusterName, ControlPlaneEndpoint and KubernetesVersion replace the settings otherwise taken from the Cluster
+	// and the Machine. They are only injected where the config does not set them.
+	ClusterName          string
+	ControlPlaneEndpoint string
+	KubernetesVersion    string
+}
+
+// Generate returns the bootstrap data of the config of the input: the data of the first control plane machine when
+// the config has no JoinConfiguration, and the join data of a control plane or worker machine otherwise.
+// Only the fields listed by the error of an unsupported config are supported, as the other ones require a
+// management or workload cluster.
+func Generate(input *Input) ([]byte, error) {
+	if input.Config == nil {
+		return nil, errors.New("a KubeadmConfig is required")
+	}
+	if input.CertificatesDir == "" {
+		return nil, errors.New("a certificates directory is required")
+	}
+	config := input.Config.DeepCopy()
+	if err := validateSupported(&config.Spec); err != nil {
+		return nil, err
+	}
+
+	baseUserData := cloudinit.BaseUserData{
+		AdditionalFiles:     config.Spec.Files,
+		NTP:                 config.Spec.NTP,
+		PreKubeadmCommands:  config.Spec.PreKubeadmCommands,
+		PostKubeadmCommands: config.Spec.PostKubeadmCommands,
+		Users:               config.Spec.Users,
+		ResetBeforeJoin:     config.Spec.ResetBeforeJoin,
+		IdempotentCommands:  config.Spec.IdempotentCommands,
+	}
+
+	if config.Spec.JoinConfiguration == nil {
+		return generateInit(input, config, baseUserData)
+	}
+	return generateJoin(input, config, baseUserData)
+}
+
+func generateInit(input *Input, config *bootstrapv1.KubeadmConfig, baseUserData cloudinit.BaseUserData) ([]byte, error) {
+	if config.Spec.InitConfiguration == nil {
+		config.Spec.InitConfiguration = &kubeadmv1beta1.InitConfiguration{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "kubeadm.k8s.io/v1beta1",
+				Kind:       "InitConfiguration",
+			},
+		}
+	}
+	if config.Spec.ClusterConfiguration == nil {
+		config.Spec.ClusterConfiguration = &kubeadmv1beta1.ClusterConfiguration{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "kubeadm.k8s.io/v1beta1",
+				Kind:       "ClusterConfiguration",
+			},
+		}
+	}
+	clusterConfiguration := config.Spec.ClusterConfiguration
+	if clusterConfiguration.ControlPlaneEndpoint == "" {
+		clusterConfiguration.ControlPlaneEndpoint = input.ControlPlaneEndpoint
+	}
+	if clusterConfiguration.ClusterName == "" {
+		clusterConfiguration.ClusterName = input.ClusterName
+	}
+	if clusterConfiguration.KubernetesVersion == "" {
+		clusterConfiguration.KubernetesVersion = input.KubernetesVersion
+	}
+	if errs := bootstrapv1.ValidateExtraArgs(&config.Spec, field.NewPath("spec")); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	if errs := bootstrapv1.ValidateExternalEtcd(&config.Spec, field.NewPath("spec")); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+
+	initData, err := kubeadmv1beta1.ConfigurationToYAML(config.Spec.InitConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal init configuration")
+	}
+	clusterData, err := kubeadmv1beta1.ConfigurationToYAML(clusterConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal cluster configuration")
+	}
+
+	certificates := internalcluster.NewCertificatesForInitialControlPlane(clusterConfiguration)
+	if err := certificates.LookupDir(input.CertificatesDir); err != nil {
+		return nil, errors.Wrap(err, "failed to read the cluster certificates")
+	}
+	if err := certificates.Generate(); err != nil {
+		return nil, errors.Wrap(err, "failed to generate the cluster certificates")
+	}
+	if err := certificates.SaveGeneratedDir(input.CertificatesDir); err != nil {
+		return nil, errors.Wrap(err, "failed to save the cluster certificates")
+	}
+
+	return cloudinit.NewInitControlPlane(&cloudinit.ControlPlaneInput{
+		BaseUserData:         baseUserData,
+		InitConfiguration:    initData,
+		ClusterConfiguration: clusterData,
+		Certificates:         certificates,
+	})
+}
+
+func generateJoin(input *Input, config *bootstrapv1.KubeadmConfig, baseUserData cloudinit.BaseUserData) ([]byte, error) {
+	joinConfiguration := config.Spec.JoinConfiguration
+	if joinConfiguration.Discovery.File == nil {
+		if joinConfiguration.Discovery.BootstrapToken == nil || joinConfiguration.Discovery.BootstrapToken.Token == "" {
+			return nil, errors.New("JoinConfiguration.Discovery requires a bootstrap token or a file, as no token can be created without a workload cluster")
+		}
+		if err := reconcileTokenDiscovery(input, joinConfiguration.Discovery.BootstrapToken); err != nil {
+			return nil, err
+		}
+	}
+
+	joinData, err := kubeadmv1beta1.ConfigurationToYAML(joinConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal join configuration")
+	}
+
+	if joinConfiguration.ControlPlane == nil {
+		return cloudinit.NewNode(&cloudinit.NodeInput{
+			BaseUserData:      baseUserData,
+			JoinConfiguration: joinData,
+		})
+	}
+
+	certificates := internalcluster.NewCertificatesForJoiningControlPlane()
+	if err := certificates.LookupDir(input.CertificatesDir); err != nil {
+		return nil, errors.Wrap(err, "failed to read the cluster certificates")
+	}
+	if err := certificates.EnsureAllExist(); err != nil {
+		return nil, errors.Wrapf(err, "the cluster certificates are missing from %s", input.CertificatesDir)
+	}
+	return cloudinit.NewJoinControlPlane(&cloudinit.ControlPlaneJoinInput{
+		BaseUserData:      baseUserData,
+		JoinConfiguration: joinData,
+		Certificates:      certificates,
+	})
+}
+
+// reconcileTokenDiscovery injects the control plane endpoint and the hashes of the cluster CA of the certificates
+// directory into the token discovery, skipping the CA verification when neither is available, as the controller does.
+func reconcileTokenDiscovery(input *Input, discovery *kubeadmv1beta1.BootstrapTokenDiscovery) error {
+	if discovery.APIServerEndpoint == "" {
+		if input.ControlPlaneEndpoint == "" {
+			return errors.New("JoinConfiguration.Discovery.BootstrapToken.APIServerEndpoint or a control plane endpoint is required")
+		}
+		discovery.APIServerEndpoint = input.ControlPlaneEndpoint
+	}
+	if len(discovery.CACertHashes) == 0 {
+		certificates := internalcluster.Certificates{&internalcluster.Certificate{Purpose: internalcluster.ClusterCA}}
+		if err := certificates.LookupDir(input.CertificatesDir); err != nil {
+			return errors.Wrap(err, "failed to read the cluster CA")
+		}
+		if ca := certificates.GetByPurpose(internalcluster.ClusterCA); ca.KeyPair != nil {
+			hashes, err := ca.Hashes()
+			if err != nil {
+				return errors.Wrap(err, "failed to hash the cluster CA")
+			}
+			discovery.CACertHashes = hashes
+		}
+	}
+	if len(discovery.CACertHashes) == 0 {
+		discovery.UnsafeSkipCAVerification = true
+	}
+	return nil
+}
+
+// validateSupported returns an error if the spec sets any field requiring a management or workload cluster.
+func validateSupported(spec *bootstrapv1.KubeadmConfigSpec) error {
+	supported := bootstrapv1.KubeadmConfigSpec{
+		ClusterConfiguration: spec.ClusterConfiguration,
+		InitConfiguration:    spec.InitConfiguration,
+		JoinConfiguration:    spec.JoinConfiguration,
+		Files:                spec.Files,
+		PreKubeadmCommands:   spec.PreKubeadmCommands,
+		PostKubeadmCommands:  spec.PostKubeadmCommands,
+		Users:                spec.Users,
+		NTP:                  spec.NTP,
+		ResetBeforeJoin:      spec.ResetBeforeJoin,
+		IdempotentCommands:   spec.IdempotentCommands,
+	}
+	if spec.Format == bootstrapv1.CloudConfig {
+		supported.Format = spec.Format
+	}
+	if !equality.Semantic.DeepEqual(&supported, spec) {
+		return errors.New("the standalone mode only supports the clusterConfiguration, initConfiguration, " +
+			"joinConfiguration, files, preKubeadmCommands, postKubeadmCommands, users, ntp, resetBeforeJoin and " +
+			"idempotentCommands fields, with the cloud-config format")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package standalone
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+)
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := &Input{
+		Config:               &bootstrapv1.KubeadmConfig{},
+		CertificatesDir:      dir,
+		ClusterName:          "cluster",
+		ControlPlaneEndpoint: "10.0.0.1:6443",
+		KubernetesVersion:    "v1.16.2",
+	}
+	initData, err := Generate(input)
+	if err != nil {
+		t.Fatalf("failed to generate init data: %v", err)
+	}
+	if !bytes.Contains(initData, []byte("controlPlaneEndpoint: 10.0.0.1:6443")) {
+		t.Errorf("expected the control plane endpoint to be injected, got:\n%s", initData)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ca.crt")); err != nil {
+		t.Fatalf("expected the cluster CA to be written: %v", err)
+	}
+	if input.Config.Spec.ClusterConfiguration != nil {
+		t.Error("expected the config of the input not to be modified")
+	}
+
+	// a second control plane machine joins with the certificates of the directory
+	input.Config = &bootstrapv1.KubeadmConfig{
+		Spec: bootstrapv1.KubeadmConfigSpec{
+			JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+				ControlPlane: &kubeadmv1beta1.JoinControlPlane{},
+				Discovery: kubeadmv1beta1.Discovery{
+					BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{Token: "abcdef.0123456789abcdef"},
+				},
+			},
+		},
+	}
+	joinData, err := Generate(input)
+	if err != nil {
+		t.Fatalf("failed to generate control plane join data: %v", err)
+	}
+	if !bytes.Contains(joinData, []byte("apiServerEndpoint: 10.0.0.1:6443")) || !bytes.Contains(joinData, []byte("sha256:")) {
+		t.Errorf("expected the discovery to be set from the input and the cluster CA, got:\n%s", joinData)
+	}
+	if !bytes.Contains(joinData, []byte("/etc/kubernetes/pki/ca.key")) {
+		t.Error("expected the cluster CA of the directory to be written to the joining machine")
+	}
+
+	// the settings requiring a cluster are rejected
+	input.Config.Spec.UploadCerts = true
+	if _, err := Generate(input); err == nil {
+		t.Error("expected unsupported fields to be rejected")
+	}
+
+	// joining without a token is not possible
+	input.Config = &bootstrapv1.KubeadmConfig{
+		Spec: bootstrapv1.KubeadmConfigSpec{JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{}},
+	}
+	if _, err := Generate(input); err == nil {
+		t.Error("expected a join without bootstrap token to be rejected")
+	}
+}
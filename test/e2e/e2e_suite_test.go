@@ -0,0 +1,194 @@
+// +build e2e
+
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The e2e suite is configured with environment variables, see docs/e2e.md.
+const (
+	defaultKindCluster       = "cabpk-e2e"
+	defaultCAPIComponents    = "https://github.com/kubernetes-sigs/cluster-api/releases/download/v0.2.5/cluster-api-components.yaml"
+	defaultCNIManifest       = "https://docs.projectcalico.org/v3.10/manifests/calico.yaml"
+	defaultKubernetesVersion = "v1.16.3"
+	// defaultConformanceFocus is a smoke subset of the conformance tests, covering pods, services, DNS and
+	// kubelet behavior across the control plane and the worker node.
+	defaultConformanceFocus = `\[Conformance\].*(` +
+		`Pods should be submitted and removed|` +
+		`Services should serve a basic endpoint from pods|` +
+		`DNS should provide DNS for the cluster|` +
+		`Kubelet when scheduling a busybox command in a pod should print the output to logs|` +
+		`Networking Granular Checks: Pods should function for intra-pod communication: http)`
+
+	// managerNamespace is the namespace CABPK is deployed to by config/default.
+	managerNamespace = "cabpk-system"
+)
+
+var (
+	kindCluster          string
+	managementKubeconfig string
+	artifactsDir         string
+	scheme               = runtime.NewScheme()
+	managementClient     client.Client
+)
+
+func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bootstrapv1.AddToScheme(scheme)
+	_ = clusterv1.AddToScheme(scheme)
+}
+
+func TestE2E(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CABPK e2e Suite")
+}
+
+var _ = BeforeSuite(func() {
+	kindCluster = envOrDefault("E2E_KIND_CLUSTER", defaultKindCluster)
+	managerImage := requiredEnv("E2E_MANAGER_IMAGE")
+	bootstrapComponents := requiredEnv("E2E_BOOTSTRAP_COMPONENTS")
+	capdComponents := requiredEnv("E2E_CAPD_COMPONENTS")
+
+	var err error
+	artifactsDir = os.Getenv("E2E_ARTIFACTS")
+	if artifactsDir == "" {
+		artifactsDir, err = ioutil.TempDir("", "cabpk-e2e")
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(os.MkdirAll(artifactsDir, 0750)).To(Succeed())
+
+	By("creating the kind management cluster")
+	// CAPD creates the machines of the workload clusters as containers of the docker daemon of the host
+	kindConfig := filepath.Join(artifactsDir, "kind-config.yaml")
+	Expect(ioutil.WriteFile(kindConfig, []byte(`kind: Cluster
+apiVersion: kind.sigs.k8s.io/v1alpha3
+nodes:
+- role: control-plane
+  extraMounts:
+  - hostPath: /var/run/docker.sock
+    containerPath: /var/run/docker.sock
+`), 0640)).To(Succeed())
+	run("kind", "create", "cluster", "--name", kindCluster, "--config", kindConfig, "--wait", "5m")
+	managementKubeconfig = filepath.Join(artifactsDir, "management.kubeconfig")
+	kubeconfig, err := exec.Command("kind", "get", "kubeconfig", "--name", kindCluster).Output()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(managementKubeconfig, kubeconfig, 0600)).To(Succeed())
+
+	restConfig, err := clientcmd.BuildConfigFromFlags("", managementKubeconfig)
+	Expect(err).NotTo(HaveOccurred())
+	managementClient, err = client.New(restConfig, client.Options{Scheme: scheme})
+	Expect(err).NotTo(HaveOccurred())
+
+	By("loading the manager images")
+	images := []string{managerImage}
+	if capdImage := os.Getenv("E2E_CAPD_IMAGE"); capdImage != "" {
+		images = append(images, capdImage)
+	}
+	for _, image := range images {
+		run("kind", "load", "docker-image", "--name", kindCluster, image)
+	}
+
+	By("installing Cluster API, CAPD and CABPK")
+	for _, components := range []string{
+		envOrDefault("E2E_CAPI_COMPONENTS", defaultCAPIComponents),
+		capdComponents,
+		bootstrapComponents,
+	} {
+		kubectl(managementKubeconfig, "apply", "-f", components)
+	}
+	for _, deployment := range []struct {
+		namespace, name string
+	}{
+		{"capi-system", "capi-controller-manager"},
+		{"capd-system", "capd-controller-manager"},
+		{managerNamespace, "cabpk-controller-manager"},
+	} {
+		kubectl(managementKubeconfig, "wait", "--for=condition=Available", "--timeout=5m", "deployment", "--namespace", deployment.namespace, deployment.name)
+	}
+})
+
+var _ = AfterSuite(func() {
+	if kindCluster == "" || managementKubeconfig == "" {
+		return
+	}
+	By("collecting the CABPK logs")
+	logs, _ := exec.Command("kubectl", "--kubeconfig", managementKubeconfig, "logs", "--namespace", managerNamespace, "deployment/cabpk-controller-manager", "--container", "manager").CombinedOutput()
+	_ = ioutil.WriteFile(filepath.Join(artifactsDir, "cabpk-controller-manager.log"), logs, 0640)
+
+	if os.Getenv("E2E_SKIP_CLEANUP") != "" {
+		fmt.Fprintf(GinkgoWriter, "Keeping kind cluster %s, artifacts in %s\n", kindCluster, artifactsDir)
+		return
+	}
+	By("deleting the kind management cluster")
+	run("kind", "delete", "cluster", "--name", kindCluster)
+})
+
+// run runs a command, failing the test if it fails.
+func run(name string, args ...string) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = GinkgoWriter
+	cmd.Stderr = GinkgoWriter
+	Expect(cmd.Run()).To(Succeed(), "%s %v", name, args)
+}
+
+// kubectl runs kubectl against the cluster of the kubeconfig, failing the test if it fails.
+func kubectl(kubeconfig string, args ...string) {
+	run("kubectl", append([]string{"--kubeconfig", kubeconfig}, args...)...)
+}
+
+// kubectlWithRetries runs kubectl until it succeeds or the timeout expires, e.g. while an API server is starting.
+func kubectlWithRetries(kubeconfig string, timeout time.Duration, args ...string) {
+	Eventually(func() error {
+		cmd := exec.Command("kubectl", append([]string{"--kubeconfig", kubeconfig}, args...)...)
+		cmd.Stdout = GinkgoWriter
+		cmd.Stderr = GinkgoWriter
+		return cmd.Run()
+	}, timeout, 10*time.Second).Should(Succeed())
+}
+
+func envOrDefault(name, value string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return value
+}
+
+func requiredEnv(name string) string {
+	v := os.Getenv(name)
+	if v == "" {
+		Fail(fmt.Sprintf("%s must be set, see docs/e2e.md", name))
+	}
+	return v
+}
@@ -0,0 +1,226 @@
+// +build e2e
+
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
+	bootstrapv1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/api/v1alpha2"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api-bootstrap-provider-kubeadm/kubeadm/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// infrastructureGroupVersion is the API group version of the CAPD resources, which are handled as unstructured
+// objects so that the suite does not depend on CAPD.
+var infrastructureGroupVersion = schema.GroupVersion{Group: "infrastructure.cluster.x-k8s.io", Version: "v1alpha2"}
+
+// kindKubeletExtraArgs disable the disk based evictions, as the disks of the docker machines are shared with the host.
+var kindKubeletExtraArgs = map[string]string{
+	"eviction-hard": "nodefs.available<0%,nodefs.inodesFree<0%,imagefs.available<0%",
+}
+
+var _ = Describe("Golden cluster", func() {
+	var (
+		ctx       = context.Background()
+		namespace = "default"
+		name      string
+	)
+
+	BeforeEach(func() {
+		name = fmt.Sprintf("golden-%d", time.Now().Unix())
+	})
+
+	It("brings up a control plane and a worker from CABPK bootstrap data and passes the conformance smoke tests", func() {
+		version := envOrDefault("E2E_KUBERNETES_VERSION", defaultKubernetesVersion)
+
+		By("creating the cluster")
+		createInfrastructure(ctx, namespace, name, "DockerCluster")
+		cluster := &clusterv1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: clusterv1.ClusterSpec{
+				ClusterNetwork: &clusterv1.ClusterNetwork{
+					Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"10.96.0.0/12"}},
+					Pods:     &clusterv1.NetworkRanges{CIDRBlocks: []string{"192.168.0.0/16"}},
+				},
+				InfrastructureRef: infrastructureRef(namespace, name, "DockerCluster"),
+			},
+		}
+		Expect(managementClient.Create(ctx, cluster)).To(Succeed())
+
+		By("creating the control plane machine")
+		controlPlane := newMachine(ctx, cluster, name+"-controlplane", version, &bootstrapv1.KubeadmConfigSpec{
+			ClusterConfiguration: &kubeadmv1beta1.ClusterConfiguration{
+				APIServer: kubeadmv1beta1.APIServer{CertSANs: []string{"localhost", "127.0.0.1"}},
+			},
+			InitConfiguration: &kubeadmv1beta1.InitConfiguration{
+				NodeRegistration: kubeadmv1beta1.NodeRegistrationOptions{KubeletExtraArgs: kindKubeletExtraArgs},
+			},
+		})
+
+		By("installing the CNI once the control plane is initialized")
+		workloadKubeconfig := waitForWorkloadKubeconfig(ctx, cluster)
+		kubectlWithRetries(workloadKubeconfig, 10*time.Minute, "apply", "-f", envOrDefault("E2E_CNI_MANIFEST", defaultCNIManifest))
+
+		By("creating the worker machine")
+		worker := newMachine(ctx, cluster, name+"-worker", version, &bootstrapv1.KubeadmConfigSpec{
+			JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+				NodeRegistration: kubeadmv1beta1.NodeRegistrationOptions{KubeletExtraArgs: kindKubeletExtraArgs},
+			},
+		})
+
+		By("waiting for the machines to become nodes")
+		for _, machine := range []*clusterv1.Machine{controlPlane, worker} {
+			key := client.ObjectKey{Namespace: machine.Namespace, Name: machine.Name}
+			Eventually(func() bool {
+				m := &clusterv1.Machine{}
+				if err := managementClient.Get(ctx, key, m); err != nil {
+					return false
+				}
+				return m.Status.NodeRef != nil
+			}, 15*time.Minute, 15*time.Second).Should(BeTrue(), "Machine %s has no node", machine.Name)
+
+			config := &bootstrapv1.KubeadmConfig{}
+			Expect(managementClient.Get(ctx, key, config)).To(Succeed())
+			Expect(config.Status.Ready).To(BeTrue())
+		}
+
+		By("waiting for the nodes to be ready")
+		kubectlWithRetries(workloadKubeconfig, 10*time.Minute, "wait", "--for=condition=Ready", "--timeout=1m", "nodes", "--all")
+		nodes, err := exec.Command("kubectl", "--kubeconfig", workloadKubeconfig, "get", "nodes", "--output", "name").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Fields(string(nodes))).To(HaveLen(2))
+
+		By("running the conformance smoke tests")
+		conformanceBinary := os.Getenv("E2E_CONFORMANCE_BINARY")
+		if conformanceBinary == "" {
+			Skip("E2E_CONFORMANCE_BINARY is not set, skipping the conformance smoke tests")
+		}
+		cmd := exec.Command(conformanceBinary,
+			"--kubeconfig", workloadKubeconfig,
+			"--provider", "skeleton",
+			"--ginkgo.focus", envOrDefault("E2E_CONFORMANCE_FOCUS", defaultConformanceFocus),
+			"--ginkgo.skip", `\[Serial\]|\[Disruptive\]`,
+			"--report-dir", artifactsDir,
+		)
+		cmd.Stdout = GinkgoWriter
+		cmd.Stderr = GinkgoWriter
+		Expect(cmd.Run()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		if os.Getenv("E2E_SKIP_CLEANUP") != "" {
+			return
+		}
+		By("deleting the cluster")
+		cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+		Expect(client.IgnoreNotFound(managementClient.Delete(ctx, cluster))).To(Succeed())
+		Eventually(func() bool {
+			err := managementClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &clusterv1.Cluster{})
+			return apierrors.IsNotFound(err)
+		}, 10*time.Minute, 10*time.Second).Should(BeTrue())
+	})
+})
+
+// createInfrastructure creates a CAPD resource of the given kind.
+func createInfrastructure(ctx context.Context, namespace, name, kind string) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(infrastructureGroupVersion.WithKind(kind))
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	Expect(managementClient.Create(ctx, obj)).To(Succeed())
+}
+
+func infrastructureRef(namespace, name, kind string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: infrastructureGroupVersion.String(),
+		Kind:       kind,
+		Namespace:  namespace,
+		Name:       name,
+	}
+}
+
+// newMachine creates a Machine of the cluster with its DockerMachine and KubeadmConfig, named after the Machine.
+// Machines with an init configuration are control plane machines.
+func newMachine(ctx context.Context, cluster *clusterv1.Cluster, name, version string, spec *bootstrapv1.KubeadmConfigSpec) *clusterv1.Machine {
+	createInfrastructure(ctx, cluster.Namespace, name, "DockerMachine")
+
+	config := &bootstrapv1.KubeadmConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: cluster.Namespace, Name: name},
+		Spec:       *spec,
+	}
+	Expect(managementClient.Create(ctx, config)).To(Succeed())
+
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      name,
+			Labels:    map[string]string{clusterv1.MachineClusterLabelName: cluster.Name},
+		},
+		Spec: clusterv1.MachineSpec{
+			Version: &version,
+			Bootstrap: clusterv1.Bootstrap{
+				ConfigRef: &corev1.ObjectReference{
+					APIVersion: bootstrapv1.GroupVersion.String(),
+					Kind:       "KubeadmConfig",
+					Namespace:  cluster.Namespace,
+					Name:       name,
+				},
+			},
+			InfrastructureRef: *infrastructureRef(cluster.Namespace, name, "DockerMachine"),
+		},
+	}
+	if spec.InitConfiguration != nil {
+		machine.Labels[clusterv1.MachineControlPlaneLabelName] = "true"
+	}
+	Expect(managementClient.Create(ctx, machine)).To(Succeed())
+	return machine
+}
+
+// waitForWorkloadKubeconfig waits for the kubeconfig secret of the cluster, written by CABPK once the control plane
+// is initialized, and returns the path of the kubeconfig.
+func waitForWorkloadKubeconfig(ctx context.Context, cluster *clusterv1.Cluster) string {
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Name + "-kubeconfig"}
+	Eventually(func() error {
+		return managementClient.Get(ctx, key, secret)
+	}, 15*time.Minute, 10*time.Second).Should(Succeed())
+
+	data := secret.Data["value"]
+	_, err := clientcmd.Load(data)
+	Expect(err).NotTo(HaveOccurred())
+	path := filepath.Join(artifactsDir, cluster.Name+".kubeconfig")
+	Expect(ioutil.WriteFile(path, data, 0600)).To(Succeed())
+	return path
+}